@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+type Config struct {
+	InPath string
+
+	// Exts are the file extensions scanned (lowercase, with the dot).
+	Exts []string
+
+	// Check reports what would change without writing, and fails when any file needs repair.
+	Check bool
+
+	ReportPath string
+
+	Durability  string
+	AtomicWrite string
+	// CanonicalJSON writes JSON outputs in canonical form (see fileutils.Canonicalize).
+	CanonicalJSON bool
+}
+
+func (c Config) Validate() error {
+	if c.InPath == "" {
+		return errors.New("missing -in")
+	}
+	if len(c.Exts) == 0 {
+		return errors.New("ext must list at least one extension")
+	}
+	if _, err := fileutils.ParseDurability(c.Durability); err != nil {
+		return err
+	}
+	if _, err := fileutils.ParseAtomicWrite(c.AtomicWrite); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseExts turns "json, .MD" into [".json", ".md"].
+func parseExts(s string) []string {
+	var out []string
+	for _, e := range strings.Split(s, ",") {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e == "" {
+			continue
+		}
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func defaultConfig() Config {
+	return Config{
+		InPath:     filepath.FromSlash("docs/peanut-gallery/threads"),
+		Exts:       []string{".json", ".jsonl", ".md"},
+		Durability: fileutils.DurabilityFull,
+	}
+}
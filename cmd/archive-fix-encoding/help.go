@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+var help = cli.Help{
+	Name:    "archive-fix-encoding",
+	Summary: "repair mojibake and invalid UTF-8 in archive files in place",
+	Groups: []cli.Group{
+		{Title: "Input", Flags: []string{"in", "ext"}},
+		{Title: "Repair", Flags: []string{"check", "report", "durability", "atomic-write", "canonical-json"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "list files that need repair without changing them", Command: "archive-fix-encoding -in docs/peanut-gallery -check"},
+		{Comment: "repair everything and keep a report of what changed", Command: "archive-fix-encoding -in docs/peanut-gallery -report fix-encoding.jsonl"},
+	},
+	Values: map[string][]string{"durability": fileutils.DurabilityModes, "atomic-write": fileutils.AtomicWriteModes},
+}
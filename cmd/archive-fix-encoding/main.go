@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+func main() {
+	cfg, err := parseFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetDurability(cfg.Durability); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetAtomicWrite(cfg.AtomicWrite); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	fileutils.SetCanonicalJSON(cfg.CanonicalJSON)
+
+	rep, err := fixEncoding(cfg, os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if err := fileutils.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if cfg.ReportPath != "" {
+		if err := fileutils.WriteJSONFileAtomic(cfg.ReportPath, rep, true); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	fmt.Fprintf(os.Stdout, "files_scanned=%d files_changed=%d mojibake=%d invalid_bytes=%d check=%t\n",
+		rep.Scanned, len(rep.Files), rep.Mojibake, rep.InvalidBytes, cfg.Check)
+	if cfg.Check && len(rep.Files) > 0 {
+		os.Exit(1)
+	}
+}
+
+// fileRepair is one repaired (or, with -check, repairable) file in the report.
+type fileRepair struct {
+	Path string `json:"path"`
+	migration.EncodingRepair
+}
+
+type encodingReport struct {
+	Scanned      int          `json:"files_scanned"`
+	Mojibake     int          `json:"mojibake"`
+	InvalidBytes int          `json:"invalid_bytes"`
+	Files        []fileRepair `json:"files"`
+}
+
+// fixEncoding repairs every matching file under cfg.InPath in place (unless cfg.Check) and logs one line
+// per changed file to log.
+func fixEncoding(cfg Config, log io.Writer) (encodingReport, error) {
+	var rep encodingReport
+	paths, err := collectArtifactFiles(cfg.InPath, cfg.Exts)
+	if err != nil {
+		return rep, err
+	}
+	for _, p := range paths {
+		rep.Scanned++
+		fr, err := fixFile(p, cfg.Check)
+		if err != nil {
+			return rep, err
+		}
+		if !fr.Changed() {
+			continue
+		}
+		rep.Files = append(rep.Files, fr)
+		rep.Mojibake += fr.Mojibake
+		rep.InvalidBytes += fr.InvalidBytes
+		verb := "fixed"
+		if cfg.Check {
+			verb = "needs repair"
+		}
+		fmt.Fprintf(log, "%s %s: mojibake=%d invalid_bytes=%d e.g. %s\n", verb, p, fr.Mojibake, fr.InvalidBytes, strings.Join(fr.Examples, ", "))
+	}
+	return rep, nil
+}
+
+// fixFile repairs one file atomically, keeping its permissions. With check set it only reports.
+func fixFile(path string, check bool) (fileRepair, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fileRepair{}, fmt.Errorf("read %s: %w", path, err)
+	}
+	fixed, r := migration.RepairEncoding(string(b))
+	fr := fileRepair{Path: path, EncodingRepair: r}
+	if !r.Changed() || check {
+		return fr, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fr, fmt.Errorf("stat %s: %w", path, err)
+	}
+	// WriteFileAtomicSameDir appends the trailing newline itself.
+	if err := fileutils.WriteFileAtomicSameDir(path, []byte(strings.TrimSuffix(fixed, "\n")), info.Mode().Perm()); err != nil {
+		return fr, fmt.Errorf("write %s: %w", path, err)
+	}
+	return fr, nil
+}
+
+// collectArtifactFiles returns the files under inPath (or inPath itself) with one of exts, skipping
+// hidden directories and the temp files atomic writes leave behind.
+func collectArtifactFiles(inPath string, exts []string) ([]string, error) {
+	info, err := os.Stat(inPath)
+	if err != nil {
+		return nil, fmt.Errorf("stat -in: %w", err)
+	}
+	if !info.IsDir() {
+		return []string{inPath}, nil
+	}
+	var out []string
+	err = filepath.WalkDir(inPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != inPath && strings.HasPrefix(name, ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(name, ".tmp_") || !slices.Contains(exts, strings.ToLower(filepath.Ext(name))) {
+			return nil
+		}
+		out = append(out, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk -in: %w", err)
+	}
+	return out, nil
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
+	cfg := defaultConfig()
+	fs.SetOutput(os.Stderr)
+	cli.Setup(fs, help)
+
+	exts := strings.Join(cfg.Exts, ",")
+	fs.StringVar(&cfg.InPath, "in", cfg.InPath, "Archive directory (scanned recursively) or a single file to repair")
+	fs.StringVar(&exts, "ext", exts, "Comma-separated file extensions to scan")
+	fs.BoolVar(&cfg.Check, "check", cfg.Check, "Only report files that need repair; exit 1 if any do")
+	fs.StringVar(&cfg.ReportPath, "report", "", "Optional path for a JSON report of every changed file")
+	fs.StringVar(&cfg.Durability, "durability", cfg.Durability, "fsync policy for repaired files: none, group (sync in batches), or full (sync every file)")
+	fs.StringVar(&cfg.AtomicWrite, "atomic-write", fileutils.AtomicRename, "How finished files replace their targets: rename (atomic), staged (temp files in TMPDIR, kept out of synced folders), or copy (written in place, for shares that refuse rename)")
+	fs.BoolVar(&cfg.CanonicalJSON, "canonical-json", cfg.CanonicalJSON, "Write JSON outputs with sorted keys and stable number formatting so regenerated files diff cleanly")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	cfg.Exts = parseExts(exts)
+	cfg.InPath = filepath.Clean(cfg.InPath)
+	if cfg.ReportPath != "" {
+		cfg.ReportPath = filepath.Clean(cfg.ReportPath)
+	}
+	return cfg, nil
+}
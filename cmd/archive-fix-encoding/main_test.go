@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+func TestParseFlags_Exts(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("archive-fix-encoding", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-in", "out/../archive", "-ext", "JSON, .md,", "-check"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.InPath != "archive" || !cfg.Check {
+		t.Fatalf("InPath=%q Check=%t", cfg.InPath, cfg.Check)
+	}
+	if want := []string{".json", ".md"}; !reflect.DeepEqual(cfg.Exts, want) {
+		t.Fatalf("Exts=%v, want %v", cfg.Exts, want)
+	}
+
+	cfg.Exts = parseExts(" , ")
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for empty -ext")
+	}
+}
+
+func TestFixEncoding_RepairsInPlaceAndChecks(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	write := func(rel, content string) string {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		return p
+	}
+	bad := write("t1/a.summary.json", "{\"summary\":\"waitâ€¦ itâ€™s fine\"}\n")
+	md := write("shards/s1.md", "# Caf\xe9\n")
+	clean := write("t1/b.summary.json", "{\"summary\":\"café\"}\n")
+	skipped := write("notes.txt", "waitâ€¦")
+	hidden := write(".git/x.json", "waitâ€¦")
+
+	cfg := defaultConfig()
+	cfg.InPath = root
+	cfg.Check = true
+	var log bytes.Buffer
+	rep, err := fixEncoding(cfg, &log)
+	if err != nil {
+		t.Fatalf("fixEncoding check: %v", err)
+	}
+	if rep.Scanned != 3 || len(rep.Files) != 2 || rep.Mojibake != 2 || rep.InvalidBytes != 1 {
+		t.Fatalf("check report=%+v", rep)
+	}
+	if b, _ := os.ReadFile(bad); !strings.Contains(string(b), "â€¦") {
+		t.Fatalf("-check modified %s", bad)
+	}
+	if !strings.Contains(log.String(), "needs repair "+bad) {
+		t.Fatalf("log=%q", log.String())
+	}
+
+	cfg.Check = false
+	if _, err := fixEncoding(cfg, &log); err != nil {
+		t.Fatalf("fixEncoding: %v", err)
+	}
+	if err := fileutils.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	for path, want := range map[string]string{
+		bad:     "{\"summary\":\"wait… it’s fine\"}\n",
+		md:      "# Café\n",
+		clean:   "{\"summary\":\"café\"}\n",
+		skipped: "waitâ€¦",
+		hidden:  "waitâ€¦",
+	} {
+		b, err := os.ReadFile(path)
+		if err != nil || string(b) != want {
+			t.Fatalf("%s=%q err=%v, want %q", path, b, err, want)
+		}
+	}
+	if info, _ := os.Stat(bad); info.Mode().Perm() != 0o600 {
+		t.Fatalf("mode=%v, want 0600", info.Mode().Perm())
+	}
+
+	rep, err = fixEncoding(cfg, &log)
+	if err != nil || len(rep.Files) != 0 {
+		t.Fatalf("second pass report=%+v err=%v", rep, err)
+	}
+}
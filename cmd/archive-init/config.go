@@ -0,0 +1,30 @@
+package main
+
+import "errors"
+
+type Config struct {
+	// OutPath is the archive-pipeline config file the wizard writes.
+	OutPath string
+
+	// PilotSize is how many conversations the optional pilot run splits (0 skips the pilot question).
+	PilotSize int
+
+	Overwrite bool
+}
+
+func (c Config) Validate() error {
+	if c.OutPath == "" {
+		return errors.New("missing -out")
+	}
+	if c.PilotSize < 0 {
+		return errors.New("pilot-size must be >= 0")
+	}
+	return nil
+}
+
+func defaultConfig() Config {
+	return Config{
+		OutPath:   "compress-o-bot.json",
+		PilotSize: 5,
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import "github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+
+var help = cli.Help{
+	Name:    "archive-init",
+	Summary: "ask a few questions, write an archive-pipeline config file, and optionally run a small pilot",
+	Groups: []cli.Group{
+		{Title: "Output", Flags: []string{"out", "overwrite"}},
+		{Title: "Pilot", Flags: []string{"pilot-size"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "set up, pilot five conversations, then run everything", Command: "archive-init\n  archive-pipeline -config compress-o-bot.json"},
+		{Comment: "write a second config without a pilot", Command: "archive-init -out work.json -pilot-size 0"},
+	},
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+func main() {
+	cfg, err := parseFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if _, err := os.Stat(cfg.OutPath); err == nil && !cfg.Overwrite {
+		fmt.Fprintf(os.Stderr, "%s already exists (use -overwrite to replace it)\n", cfg.OutPath)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stderr}
+	s, err := askSettings(p, cfg.PilotSize)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.WriteJSONFileAtomic(cfg.OutPath, s.fileValues(), true); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "\nwrote %s; run the full archive with:\n  go run ./cmd/archive-pipeline -config %s\n", cfg.OutPath, cfg.OutPath)
+
+	pilot := "skipped"
+	pilotDir := ""
+	if s.Pilot {
+		pilotDir = filepath.Join(s.BaseDir, "pilot")
+		env := os.Environ()
+		if os.Getenv("OPENAI_API_KEY") == "" {
+			key, err := p.ask("OpenAI API key for the pilot (not saved; export OPENAI_API_KEY for full runs)", "", requireValue)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(2)
+			}
+			env = append(env, "OPENAI_API_KEY="+key)
+		}
+		fmt.Fprintf(os.Stderr, "\nrunning a pilot on %d representative conversations into %s\n", cfg.PilotSize, pilotDir)
+		if err := runPilot(ctx, env, cfg.OutPath, cfg.PilotSize); err != nil {
+			fmt.Fprintf(os.Stderr, "pilot failed: %v\ncheck the API key, model name, and export path, then rerun archive-init or archive-pipeline -config %s\n", err, cfg.OutPath)
+			fmt.Fprintf(os.Stdout, "config=%s pilot=failed pilot_dir=%s\n", cfg.OutPath, pilotDir)
+			os.Exit(1)
+		}
+		if err := showSamples(os.Stderr, pilotDir); err != nil {
+			fmt.Fprintln(os.Stderr, "warning:", err.Error())
+		}
+		pilot = "ok"
+	}
+
+	fmt.Fprintf(os.Stdout, "config=%s pilot=%s pilot_dir=%s\n", cfg.OutPath, pilot, pilotDir)
+}
+
+// settings are the wizard's answers.
+type settings struct {
+	Conversations  string
+	BaseDir        string
+	Model          string
+	SentimentModel string
+	MaxUSD         float64
+	Pilot          bool
+}
+
+// fileValues returns the archive-pipeline config file contents, keyed by flag name. Answers equal to
+// the pipeline's own defaults are still written so the file documents the run on its own.
+func (s settings) fileValues() map[string]any {
+	v := map[string]any{
+		"conversations": s.Conversations,
+		"base-dir":      s.BaseDir,
+		"model":         s.Model,
+	}
+	if s.SentimentModel != "" && s.SentimentModel != s.Model {
+		v["sentiment-model"] = s.SentimentModel
+	}
+	if s.MaxUSD > 0 {
+		v["max-usd"] = s.MaxUSD
+	}
+	return v
+}
+
+// askSettings walks through the questions. pilotSize 0 skips the pilot question.
+func askSettings(p *prompter, pilotSize int) (settings, error) {
+	fmt.Fprintln(p.out, "compress-o-bot setup: press Enter to accept the [default].")
+	var s settings
+	var err error
+	if s.Conversations, err = p.ask("Path to your ChatGPT export (conversations.json, or a directory of exports)", filepath.FromSlash("docs/peanut-gallery/conversations.json"), func(v string) error {
+		if _, err := os.Stat(v); err != nil {
+			return fmt.Errorf("cannot read %s", v)
+		}
+		return nil
+	}); err != nil {
+		return settings{}, err
+	}
+	if s.BaseDir, err = p.ask("Output directory", filepath.FromSlash("docs/peanut-gallery"), requireValue); err != nil {
+		return settings{}, err
+	}
+	fmt.Fprintln(p.out, "Chunking, summaries, and rollups call the OpenAI Responses API.")
+	if s.Model, err = p.ask("OpenAI model", "gpt-5-mini", requireValue); err != nil {
+		return settings{}, err
+	}
+	if s.SentimentModel, err = p.ask("OpenAI model for sentiment passes", s.Model, requireValue); err != nil {
+		return settings{}, err
+	}
+	usd, err := p.ask("Spend cap in USD across all stages (0 = no cap)", "0", func(v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			return errors.New("enter a number >= 0")
+		}
+		return nil
+	})
+	if err != nil {
+		return settings{}, err
+	}
+	s.MaxUSD, _ = strconv.ParseFloat(usd, 64)
+	if pilotSize > 0 {
+		pilot, err := p.ask(fmt.Sprintf("Run a pilot on %d conversations now to check credentials, preview outputs, and estimate the full cost? (y/n)", pilotSize), "y", func(v string) error {
+			if _, ok := parseYesNo(v); !ok {
+				return errors.New("answer y or n")
+			}
+			return nil
+		})
+		if err != nil {
+			return settings{}, err
+		}
+		s.Pilot, _ = parseYesNo(pilot)
+	}
+	s.Conversations, s.BaseDir = filepath.Clean(s.Conversations), filepath.Clean(s.BaseDir)
+	return s, nil
+}
+
+// prompter asks questions on out and reads one answer per line from in.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask prints question with its default and returns the trimmed answer, or def for an empty line.
+// Answers that fail check are reported and asked again. Running out of input is an error, so a
+// closed stdin never silently accepts the remaining defaults.
+func (p *prompter) ask(question, def string, check func(string) error) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(p.out, "%s: ", question)
+		}
+		line, err := p.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			fmt.Fprintln(p.out)
+			return "", fmt.Errorf("no answer for %q: input ended", question)
+		}
+		v := strings.TrimSpace(line)
+		if v == "" {
+			v = def
+		}
+		if cerr := check(v); cerr != nil {
+			fmt.Fprintf(p.out, "  %v\n", cerr)
+			if err == io.EOF {
+				return "", cerr
+			}
+			continue
+		}
+		return v, nil
+	}
+}
+
+func requireValue(v string) error {
+	if v == "" {
+		return errors.New("a value is required")
+	}
+	return nil
+}
+
+func parseYesNo(v string) (bool, bool) {
+	switch strings.ToLower(v) {
+	case "y", "yes":
+		return true, true
+	case "n", "no":
+		return false, true
+	}
+	return false, false
+}
+
+// runPilot runs archive-pipeline -pilot with the new config, which samples n representative
+// conversations into <base-dir>/pilot and prints the projected cost of the full run.
+func runPilot(ctx context.Context, env []string, configPath string, n int) error {
+	cmd := exec.CommandContext(ctx, "go", "run", "./cmd/archive-pipeline",
+		"-config", configPath,
+		"-pilot", strconv.Itoa(n),
+	)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = env
+	return cmd.Run()
+}
+
+// showSamples prints the pilot's thread rollups from its thread index and lists its memory shards.
+func showSamples(w io.Writer, dir string) error {
+	threadsDir := filepath.Join(dir, "threads")
+	rows, err := migration.ReadThreadIndex(filepath.Join(threadsDir, "thread_summaries", "thread_index.json"))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\npilot thread summaries (%d):\n", len(rows))
+	for _, r := range rows {
+		title := r.Title
+		if title == "" {
+			title = r.ConversationID
+		}
+		fmt.Fprintf(w, "\n  %s\n    %s\n", title, fileutils.Truncate(r.Summary, 300))
+	}
+	shards, err := filepath.Glob(filepath.Join(threadsDir, "memory_shards", "*.md"))
+	if err != nil {
+		return err
+	}
+	if len(shards) > 0 {
+		fmt.Fprintln(w, "\npilot memory shards:")
+		for _, s := range shards {
+			fmt.Fprintf(w, "  %s\n", s)
+		}
+	}
+	return nil
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
+	cfg := defaultConfig()
+	fs.SetOutput(os.Stderr)
+	cli.Setup(fs, help)
+	fs.StringVar(&cfg.OutPath, "out", cfg.OutPath, "Config file to write (pass it to archive-pipeline -config)")
+	fs.IntVar(&cfg.PilotSize, "pilot-size", cfg.PilotSize, "Conversations in the optional pilot run (0 skips the pilot)")
+	fs.BoolVar(&cfg.Overwrite, "overwrite", false, "Replace an existing -out file")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	cfg.OutPath = filepath.Clean(cfg.OutPath)
+	return cfg, nil
+}
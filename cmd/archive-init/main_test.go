@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+func TestParseFlags_DefaultsAndValidate(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("archive-init", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-out", "x/../cfg.json"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if cfg.OutPath != "cfg.json" || cfg.PilotSize != 5 {
+		t.Fatalf("cfg=%+v", cfg)
+	}
+	cfg.PilotSize = -1
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for negative pilot-size")
+	}
+}
+
+func TestAskSettings_DefaultsRetriesAndFileValues(t *testing.T) {
+	t.Parallel()
+
+	export := filepath.Join(t.TempDir(), "conversations.json")
+	if err := os.WriteFile(export, []byte("[]"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	// A missing export and a negative cap are asked again; empty lines take the defaults.
+	answers := strings.Join([]string{"/no/such/export.json", export, "out/", "", "gpt-5", "-1", "2.5", "maybe", "n"}, "\n") + "\n"
+	var out bytes.Buffer
+	s, err := askSettings(&prompter{in: bufio.NewReader(strings.NewReader(answers)), out: &out}, 5)
+	if err != nil {
+		t.Fatalf("askSettings: %v\n%s", err, out.String())
+	}
+	want := settings{Conversations: export, BaseDir: "out", Model: "gpt-5-mini", SentimentModel: "gpt-5", MaxUSD: 2.5}
+	if s != want {
+		t.Fatalf("settings=%+v want %+v", s, want)
+	}
+	for _, msg := range []string{"cannot read /no/such/export.json", "enter a number >= 0", "answer y or n"} {
+		if !strings.Contains(out.String(), msg) {
+			t.Fatalf("prompts missing %q:\n%s", msg, out.String())
+		}
+	}
+	v := s.fileValues()
+	if v["conversations"] != export || v["base-dir"] != "out" || v["sentiment-model"] != "gpt-5" || v["max-usd"] != 2.5 {
+		t.Fatalf("fileValues=%v", v)
+	}
+}
+
+func TestAskSettings_InputEndsEarly(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	if _, err := askSettings(&prompter{in: bufio.NewReader(strings.NewReader("")), out: &out}, 5); err == nil {
+		t.Fatalf("expected error when stdin is closed")
+	}
+}
+
+func TestShowSamples_PrintsPilotRollupsAndShards(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	threads := filepath.Join(dir, "threads")
+	index := filepath.Join(threads, "thread_summaries", "thread_index.json")
+	if err := fileutils.WriteJSONFileAtomic(index, migration.ThreadIndexRecord{ConversationID: "c1", Title: "Moving to Lisbon", Summary: "Planned the visa paperwork."}, false); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+	shard := filepath.Join(threads, "memory_shards", "memory_0001.md")
+	if err := os.MkdirAll(filepath.Dir(shard), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(shard, []byte("# shard"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := showSamples(&buf, dir); err != nil {
+		t.Fatalf("showSamples: %v", err)
+	}
+	for _, want := range []string{"pilot thread summaries (1)", "Moving to Lisbon\n    Planned the visa paperwork.", shard} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("samples missing %q:\n%s", want, buf.String())
+		}
+	}
+	if err := showSamples(&buf, t.TempDir()); err == nil {
+		t.Fatalf("expected error without a thread index")
+	}
+}
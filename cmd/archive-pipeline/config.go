@@ -2,7 +2,14 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"path/filepath"
+	"slices"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
 )
 
 func (c Config) Validate() error {
@@ -18,8 +25,20 @@ func (c Config) Validate() error {
 	if c.TargetTurns <= 0 {
 		return errors.New("target-turns must be > 0")
 	}
-	if c.Concurrency < 0 || c.BatchSize < 0 || c.MaxChunks < 0 {
-		return errors.New("concurrency/batch-size/max-chunks must be >= 0")
+	if c.MinTurns < 0 || c.MinMessages < 0 {
+		return errors.New("min-turns/min-messages must be >= 0")
+	}
+	if c.Concurrency < 0 || c.BatchSize < 0 || c.MaxChunks < 0 || c.MaxConversations < 0 {
+		return errors.New("concurrency/batch-size/max-chunks/max-conversations must be >= 0")
+	}
+	if c.SummarizeConcurrency < 0 || c.RollupConcurrency < 0 {
+		return errors.New("summarize-concurrency/rollup-concurrency must be >= 0")
+	}
+	if c.QPS < 0 || c.ChunkQPS < 0 || c.SummarizeQPS < 0 || c.RollupQPS < 0 {
+		return errors.New("qps/chunk-qps/summarize-qps/rollup-qps must be >= 0")
+	}
+	if c.MaxFilesPerDir < 0 || c.MaxOutputBytes < 0 {
+		return errors.New("max-files-per-dir/max-output-bytes must be >= 0")
 	}
 	if c.MaxShardBytes <= 0 {
 		return errors.New("max-shard-bytes must be > 0")
@@ -27,12 +46,113 @@ func (c Config) Validate() error {
 	if c.IndexSummaryMaxChars < 0 || c.IndexTagsMax < 0 || c.IndexTermsMax < 0 {
 		return errors.New("index limits must be >= 0")
 	}
+	if c.MaxUSD < 0 || c.MaxTokensTotal < 0 {
+		return errors.New("max-usd/max-tokens-total must be >= 0")
+	}
+	if c.Pilot < 0 {
+		return errors.New("pilot must be >= 0")
+	}
+	if _, err := migration.ParseMessageMatches(c.DropMessages); err != nil {
+		return fmt.Errorf("drop-messages: %w", err)
+	}
+	if _, err := migration.ParseMessageMatches(c.CompressMessages); err != nil {
+		return fmt.Errorf("compress-messages: %w", err)
+	}
+	if c.Pilot > 0 && (c.OnlyStage != "" || c.FromStage != "" || c.MaxConversations > 0) {
+		return errors.New("-pilot runs every stage on its own sample; drop -from-stage, -only-stage, and -max-conversations")
+	}
+	if c.ConversationID != "" {
+		if c.ConversationID != filepath.Base(c.ConversationID) || c.ConversationID == "." || c.ConversationID == ".." {
+			return fmt.Errorf("invalid -conversation-id %q", c.ConversationID)
+		}
+		if c.Pilot > 0 {
+			return errors.New("use only one of -pilot or -conversation-id")
+		}
+		if c.OnlyStage == "split" || c.FromStage == "split" {
+			return errors.New("-conversation-id starts at the chunk stage; split the export first")
+		}
+	}
 	if c.OnlyStage != "" && c.FromStage != "" {
 		return errors.New("use only one of -only-stage or -from-stage")
 	}
+	if _, err := fileutils.ParseDurability(c.Durability); err != nil {
+		return err
+	}
+	if _, err := fileutils.ParseAtomicWrite(c.AtomicWrite); err != nil {
+		return err
+	}
+	if _, err := provider.ParsePromptBudget(c.PromptBudget); err != nil {
+		return err
+	}
+	if _, err := provider.ParseStructuredOutput(c.StructuredOutput); err != nil {
+		return err
+	}
+	if _, err := migration.ParseSentimentIndexFields(c.SentimentIndexFields); err != nil {
+		return err
+	}
+	if _, err := migration.ParseDateRanges(c.TurnSentiment); err != nil {
+		return err
+	}
+	compression, err := migration.ParseArchiveCompression(c.ArchiveCompression)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(selectStages(c), "pack-archive") && !migration.ArchiveCompressionAvailable(compression) {
+		return fmt.Errorf("-archive-compression %s needs the %s binary on PATH; install it or pass -archive-compression gzip", compression, compression)
+	}
+	if _, err := provider.ParseChaos(c.Chaos); err != nil {
+		return err
+	}
+	if c.GitTag != "" {
+		if !c.GitCommit {
+			return errors.New("-git-tag needs -git-commit")
+		}
+		if !validGitTagPrefix(c.GitTag) {
+			return fmt.Errorf("invalid -git-tag %q: not usable in a git tag name", c.GitTag)
+		}
+	}
+	for _, h := range c.Hooks {
+		switch h.Stage {
+		case "split", "chunk", "summarize", "rollup", "pack", "pack-archive":
+		default:
+			return fmt.Errorf("invalid -hook %q: unknown stage %q", h, h.Stage)
+		}
+	}
 	return nil
 }
 
+// quickMinTurns is the chunk stage's -min-turns under -quick: every thread that fits the prompt
+// budget (see chunkMaxTinyTokens) is tiny, so it becomes one chunk without a breakpoint request and
+// thread-rollup passes its chunk summaries through.
+const quickMinTurns = math.MaxInt32
+
+// chunkMinTurns is the -min-turns passed to thread-chunker.
+func (c Config) chunkMinTurns() int {
+	if c.Quick {
+		return quickMinTurns
+	}
+	return c.MinTurns
+}
+
+// chunkMaxTinyTokens is the -max-tiny-tokens passed to thread-chunker: under -quick, the smaller of
+// the semantic and sentiment models' prompt budgets, so a thread the summarize stage would cut is
+// chunked normally instead; otherwise 0 (no limit).
+func (c Config) chunkMaxTinyTokens() int {
+	if !c.Quick {
+		return 0
+	}
+	// Validate has already rejected a bad spec.
+	budget, _ := provider.ParsePromptBudget(c.PromptBudget)
+	return min(budget.Limit(c.Model), budget.Limit(c.SentimentModel))
+}
+
+// overwrite reports whether stages replace existing outputs: with -overwrite, or for the one
+// conversation -conversation-id reprocesses (the stages it runs are scoped to that thread, and pack
+// rebuilds shards from every rollup).
+func (c Config) overwrite() bool {
+	return c.Overwrite || c.ConversationID != ""
+}
+
 func defaultConfig() Config {
 	return Config{
 		ConversationsPath:    filepath.FromSlash("docs/peanut-gallery/conversations.json"),
@@ -49,5 +169,8 @@ func defaultConfig() Config {
 		IndexTermsMax:        15,
 		Pretty:               false,
 		Overwrite:            false,
+		Durability:           fileutils.DurabilityFull,
+		MaxFilesPerDir:       fileutils.DefaultMaxFilesPerDir,
+		ArchiveCompression:   migration.ArchiveZstd,
 	}
 }
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+)
+
+// gitArchive commits the archive directory after each stage for -git-commit, so every state a run
+// leaves behind can be checked out again.
+type gitArchive struct {
+	// dir is the archive directory. It always gets its own repository in dir/.git, even when it
+	// lives inside another work tree (the default base dir sits in this one), so stage commits and
+	// tags never land in the enclosing repository.
+	dir string
+	// tagPrefix names the tags put on each commit, <prefix>/<run>/<stage>; empty disables tags.
+	tagPrefix string
+	// run is the run's start time, shared by its tags.
+	run string
+}
+
+// openGitArchive prepares dir for stage commits, creating it and running git init there when it has
+// no dir/.git yet.
+func openGitArchive(ctx context.Context, dir, tagPrefix string, started time.Time) (*gitArchive, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("git-commit: %w", err)
+	}
+	g := &gitArchive{dir: dir, tagPrefix: tagPrefix, run: started.UTC().Format("20060102T150405Z")}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); errors.Is(err, fs.ErrNotExist) {
+		if _, err := g.git(ctx, "init", "-q"); err != nil {
+			return nil, err
+		}
+		fmt.Fprintln(os.Stdout, "git-commit: initialized a repository in", dir)
+	} else if err != nil {
+		return nil, fmt.Errorf("git-commit: %w", err)
+	}
+	return g, nil
+}
+
+// commitStage stages every change under the archive directory and commits it with a message
+// summarizing reports, the run reports the stage left, then tags the commit when a tag prefix is
+// set. It returns the short commit hash, or "" when the stage changed nothing.
+func (g *gitArchive) commitStage(ctx context.Context, stage string, reports []migration.RunReport) (string, error) {
+	if _, err := g.git(ctx, "add", "-A", "--", "."); err != nil {
+		return "", err
+	}
+	status, err := g.git(ctx, "status", "--porcelain", "--", ".")
+	if err != nil {
+		return "", err
+	}
+	if status == "" {
+		return "", nil
+	}
+	subject, body := stageCommitMessage(stage, reports)
+	if _, err := g.git(ctx, "commit", "-q", "-m", subject, "-m", body, "--", "."); err != nil {
+		return "", err
+	}
+	rev, err := g.git(ctx, "rev-parse", "--short", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	if g.tagPrefix != "" {
+		if _, err := g.git(ctx, "tag", g.tagPrefix+"/"+g.run+"/"+stage, rev); err != nil {
+			return "", err
+		}
+	}
+	return rev, nil
+}
+
+// git runs a git command against the archive directory's own repository, never a repository
+// enclosing it, and returns its trimmed stdout. Errors carry git's stderr.
+func (g *gitArchive) git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", g.dir, "--git-dir=.git", "--work-tree=."}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// stageCommitMessage builds the commit message for a stage: a subject line and a body of
+// "Key: value" trailers totalling its run reports (pack runs twice, once per shard mode), so the
+// history can be read with git log and parsed with git interpret-trailers.
+func stageCommitMessage(stage string, reports []migration.RunReport) (subject, body string) {
+	var total migration.RunReport
+	total.Status = migration.RunStatusOK
+	var warnings int
+	for _, r := range reports {
+		total.Total += r.Total
+		total.Processed += r.Processed
+		total.Skipped += r.Skipped
+		total.Failed += r.Failed
+		total.InputTokens += r.InputTokens
+		total.OutputTokens += r.OutputTokens
+		total.EstimatedUSD += r.EstimatedUSD
+		total.DurationSec += r.DurationSec
+		warnings += len(r.Warnings)
+		if r.Status != migration.RunStatusOK && total.Status == migration.RunStatusOK {
+			total.Status = r.Status
+		}
+	}
+
+	subject = fmt.Sprintf("archive-pipeline: %s (%d processed, %d skipped, %d failed)", stage, total.Processed, total.Skipped, total.Failed)
+	var b strings.Builder
+	fmt.Fprintf(&b, "Stage: %s\n", stage)
+	fmt.Fprintf(&b, "Status: %s\n", total.Status)
+	fmt.Fprintf(&b, "Reports: %d\n", len(reports))
+	fmt.Fprintf(&b, "Total: %d\n", total.Total)
+	fmt.Fprintf(&b, "Processed: %d\n", total.Processed)
+	fmt.Fprintf(&b, "Skipped: %d\n", total.Skipped)
+	fmt.Fprintf(&b, "Failed: %d\n", total.Failed)
+	fmt.Fprintf(&b, "Warnings: %d\n", warnings)
+	fmt.Fprintf(&b, "Input-Tokens: %d\n", total.InputTokens)
+	fmt.Fprintf(&b, "Output-Tokens: %d\n", total.OutputTokens)
+	fmt.Fprintf(&b, "Estimated-USD: %.4f\n", total.EstimatedUSD)
+	fmt.Fprintf(&b, "Duration-Seconds: %.1f\n", total.DurationSec)
+	fmt.Fprintf(&b, "Tool-Version: %s\n", migration.ToolVersion())
+	return subject, b.String()
+}
+
+// validGitTagPrefix reports whether p can start a tag name: no whitespace or characters git refuses
+// in ref names, no "..", and no leading "-" or trailing "/" or ".".
+func validGitTagPrefix(p string) bool {
+	if p == "" || strings.HasPrefix(p, "-") || strings.HasSuffix(p, "/") || strings.HasSuffix(p, ".") {
+		return false
+	}
+	if strings.Contains(p, "..") || strings.Contains(p, "@{") || strings.Contains(p, "//") {
+		return false
+	}
+	return !strings.ContainsFunc(p, func(r rune) bool {
+		return r <= ' ' || r == 0x7f || strings.ContainsRune("~^:?*[\\", r)
+	})
+}
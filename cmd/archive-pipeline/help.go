@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
+)
+
+var help = cli.Help{
+	Name:    "archive-pipeline",
+	Summary: "run split, chunk, summarize, rollup, and pack over a conversations.json export, optionally archiving the result",
+	Groups: []cli.Group{
+		{Title: "Input and output", Flags: []string{"config", "conversations", "base-dir", "max-conversations", "pretty", "overwrite", "durability", "atomic-write", "canonical-json", "max-files-per-dir", "max-output-bytes", "git-commit", "git-tag"}},
+		{Title: "Stages", Flags: []string{"from-stage", "only-stage", "conversation-id", "pilot", "quick", "archive", "archive-compression", "hook"}},
+		{Title: "Model", Flags: []string{"model", "sentiment-model", "sentiment-prompt-file", "source-prompts", "sentiment-evidence", "turn-sentiment", "style", "output-language", "terms-model", "prompt-budget", "structured-output"}},
+		{Title: "Stage options", Flags: []string{"tool-calls", "drop-messages", "compress-messages", "target-turns", "min-turns", "min-messages", "batch-size", "max-chunks", "max-shard-bytes", "index-summary-max-chars", "index-tags-max", "index-terms-max", "lowercase-tags", "sentiment-index-fields", "bundle", "force-pack", "source-links", "template-dir"}},
+		{Title: "Throughput", Flags: []string{"concurrency", "summarize-concurrency", "rollup-concurrency", "qps", "chunk-qps", "summarize-qps", "rollup-qps"}},
+		{Title: "Spend caps", Flags: []string{"max-usd", "max-tokens-total", "budget-ledger"}},
+		{Title: "Testing", Flags: []string{"chaos"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "the whole pipeline with a $10 cap", Command: "archive-pipeline -conversations conversations.json -max-usd 10"},
+		{Comment: "run with the settings archive-init saved", Command: "archive-pipeline -config compress-o-bot.json"},
+		{Comment: "measure 20 representative conversations and project the full run's cost", Command: "archive-pipeline -conversations conversations.json -pilot 20"},
+		{Comment: "redo rollups and packing after editing overrides", Command: "archive-pipeline -conversations conversations.json -from-stage rollup"},
+		{Comment: "exercise retries and resume against a pilot with injected provider failures", Command: "archive-pipeline -conversations conversations.json -pilot 5 -chaos rate-limit=0.1,server-error=0.1,truncate=0.05,garbage=0.05"},
+		{Comment: "keep rollups under a tighter rate limit than chunk summaries", Command: "archive-pipeline -conversations conversations.json -concurrency 8 -rollup-concurrency 2 -rollup-qps 0.5"},
+		{Comment: "reprocess one bad thread end to end and patch the indices and shards", Command: "archive-pipeline -conversations conversations.json -conversation-id <conversation_id>"},
+		{Comment: "rebuild the shards only", Command: "archive-pipeline -conversations conversations.json -only-stage pack"},
+		{Comment: "a few hundred short conversations: one summary per thread, no chunking", Command: "archive-pipeline -conversations conversations.json -quick"},
+		{Comment: "run everything and keep a versioned tarball of the result for backup", Command: "archive-pipeline -conversations conversations.json -archive"},
+		{Comment: "commit and tag the archive after every stage so any earlier state can be checked out", Command: "archive-pipeline -conversations conversations.json -git-commit -git-tag archive"},
+	},
+	Values: map[string][]string{
+		"from-stage":          {"split", "chunk", "summarize", "rollup", "pack", "pack-archive"},
+		"only-stage":          {"split", "chunk", "summarize", "rollup", "pack", "pack-archive"},
+		"archive-compression": migration.ArchiveCompressions,
+		"durability":          fileutils.DurabilityModes,
+		"atomic-write":        fileutils.AtomicWriteModes,
+		"structured-output":   provider.StructuredOutputModes,
+	},
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"plugin"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+)
+
+// hook runs before or after a pipeline stage, either as an external command or a Go plugin function.
+type hook struct {
+	When  string
+	Stage string
+
+	// Command is a shell command line, run with sh -c (cmd /C on Windows) so quoting works as in a
+	// shell; the event is written to its stdin.
+	Command string
+
+	// Plugin and Symbol name a Go plugin (.so) and the exported HookFunc in it.
+	Plugin string
+	Symbol string
+}
+
+// parseHook parses a -hook value of the form "<pre|post>:<stage>=<command>" or
+// "<pre|post>:<stage>=plugin:<path.so>#<Symbol>". The command is kept whole for the shell.
+func parseHook(spec string) (hook, error) {
+	target, action, ok := strings.Cut(spec, "=")
+	if !ok {
+		return hook{}, fmt.Errorf("invalid hook %q: want <pre|post>:<stage>=<command>", spec)
+	}
+	when, stage, ok := strings.Cut(strings.TrimSpace(target), ":")
+	if !ok || (when != migration.HookPre && when != migration.HookPost) || stage == "" {
+		return hook{}, fmt.Errorf("invalid hook %q: target must be pre:<stage> or post:<stage>", spec)
+	}
+	h := hook{When: when, Stage: stage}
+	action = strings.TrimSpace(action)
+	if p, ok := strings.CutPrefix(action, "plugin:"); ok {
+		path, sym, ok := strings.Cut(p, "#")
+		if !ok || path == "" || sym == "" {
+			return hook{}, fmt.Errorf("invalid hook %q: want plugin:<path.so>#<Symbol>", spec)
+		}
+		h.Plugin, h.Symbol = path, sym
+		return h, nil
+	}
+	h.Command = action
+	if h.Command == "" {
+		return hook{}, fmt.Errorf("invalid hook %q: empty command", spec)
+	}
+	return h, nil
+}
+
+// String returns the hook in parseHook form.
+func (h hook) String() string {
+	if h.Plugin != "" {
+		return fmt.Sprintf("%s:%s=plugin:%s#%s", h.When, h.Stage, h.Plugin, h.Symbol)
+	}
+	return fmt.Sprintf("%s:%s=%s", h.When, h.Stage, h.Command)
+}
+
+// Run invokes the hook with ev. Command hooks inherit the environment, run in the current directory,
+// and have their stdout and stderr forwarded to stderr; a non-zero exit is an error.
+func (h hook) Run(ctx context.Context, ev migration.HookEvent) error {
+	if ev.Time == "" {
+		ev.Time = time.Now().UTC().Format(time.RFC3339)
+	}
+	if h.Plugin != "" {
+		fn, err := loadHookFunc(h.Plugin, h.Symbol)
+		if err != nil {
+			return fmt.Errorf("hook %s: %w", h, err)
+		}
+		if err := fn(ctx, ev); err != nil {
+			return fmt.Errorf("hook %s: %w", h, err)
+		}
+		return nil
+	}
+
+	in, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("hook %s: marshal event: %w", h, err)
+	}
+	cmd := shellCommand(ctx, h.Command)
+	cmd.Stdin = bytes.NewReader(append(in, '\n'))
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		// Not wrapped: a hook's exit status must not be mistaken for a stage's.
+		return fmt.Errorf("hook %s: %v", h, err)
+	}
+	return nil
+}
+
+// shellCommand runs line through the platform shell.
+func shellCommand(ctx context.Context, line string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", line)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", line)
+}
+
+func loadHookFunc(path, symbol string) (migration.HookFunc, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(symbol)
+	if err != nil {
+		return nil, err
+	}
+	switch fn := sym.(type) {
+	case migration.HookFunc:
+		return fn, nil
+	case *migration.HookFunc:
+		return *fn, nil
+	}
+	return nil, fmt.Errorf("symbol %s has type %T, want func(context.Context, migration.HookEvent) error", symbol, sym)
+}
+
+// runHooks runs the hooks registered for ev.Stage at ev.When, in flag order, stopping at the first error.
+func runHooks(ctx context.Context, hooks []hook, ev migration.HookEvent) error {
+	for _, h := range hooks {
+		if h.Stage != ev.Stage || h.When != ev.When {
+			continue
+		}
+		fmt.Fprintln(os.Stderr, "hook:", h.String())
+		if err := h.Run(ctx, ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changedFiles lists regular files under dir modified at or after since, sorted. Run and pipeline
+// reports are skipped. A missing dir yields no files.
+func changedFiles(dir string, since time.Time) ([]string, error) {
+	var out []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || d.Name() == migration.RunReportFileName || d.Name() == migration.PipelineReportFileName {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().Before(since.Truncate(time.Second)) {
+			out = append(out, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list changed files: %w", err)
+	}
+	sort.Strings(out)
+	return out, nil
+}
@@ -2,15 +2,22 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
 	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
 )
 
 func main() {
@@ -23,18 +30,18 @@ func main() {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(2)
 	}
+	// The pipeline report is written here; the stages get -canonical-json below.
+	fileutils.SetCanonicalJSON(cfg.CanonicalJSON)
 
 	ctx := context.Background()
 
-	stages := []string{"split", "chunk", "summarize", "rollup", "pack"}
-	if cfg.OnlyStage != "" {
-		stages = []string{cfg.OnlyStage}
-	} else if cfg.FromStage != "" {
-		stages = stagesFrom(stages, cfg.FromStage)
-	}
+	stages := selectStages(cfg)
 
 	base := filepath.Clean(cfg.BaseDir)
 	conversations := filepath.Clean(cfg.ConversationsPath)
+	if cfg.Pilot > 0 {
+		base = filepath.Join(base, "pilot")
+	}
 
 	threadsDir := filepath.Join(base, "threads")
 	chunksDir := filepath.Join(threadsDir, "chunks")
@@ -43,13 +50,156 @@ func main() {
 	threadSentimentSummariesDir := filepath.Join(threadsDir, "thread_sentiment_summaries")
 	semanticShardsDir := filepath.Join(threadsDir, "memory_shards")
 	sentimentShardsDir := filepath.Join(threadsDir, "memory_shards_sentiment")
+	overridesDir := filepath.Join(threadsDir, migration.OverridesDirName)
+	archivesDir := filepath.Join(threadsDir, "archives")
+
+	// Stages share one ledger so the spend cap is cumulative across the whole pipeline.
+	budgetLedger := cfg.BudgetLedger
+	if budgetLedger == "" && (cfg.MaxUSD > 0 || cfg.MaxTokensTotal > 0) {
+		budgetLedger = filepath.Join(threadsDir, "spend_ledger.json")
+	}
+
+	// A pilot profiles the whole export, splits only a representative sample into a fresh
+	// <base-dir>/pilot, and projects the full run's cost from what the sample used.
+	var pilotCands []migration.PilotCandidate
+	var pilotIDs []string
+	pilotIDsPath := filepath.Join(base, migration.PilotIDsFileName)
+	if cfg.Pilot > 0 {
+		exports, err := migration.CollectExports([]string{conversations})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(2)
+		}
+		if pilotCands, err = migration.ProfileArchive(ctx, exports, migration.SplitOptions{}); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		pilotIDs = migration.SamplePilot(pilotCands, cfg.Pilot)
+		if err := os.RemoveAll(threadsDir); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		if err := migration.WriteIDFile(pilotIDsPath, pilotIDs); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stdout, "pilot: sampled %d of %d conversations into %s\n", len(pilotIDs), len(pilotCands), base)
+	}
+
+	pipeline := migration.NewPipelineReport()
+	pipeline.GitRevision = gitRevision(ctx)
+	pipelineReportPath := filepath.Join(threadsDir, migration.PipelineReportFileName)
+	exit := func(status string, code int) {
+		pipeline.Status = status
+		if err := migration.WritePipelineReport(pipelineReportPath, pipeline); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+		os.Exit(code)
+	}
+	// runStage runs one tool and folds the run reports it left in outDirs into the pipeline report.
+	// Pre hooks run first and can veto the stage; post hooks run after it whether or not it succeeded.
+	runStage := func(stage string, args []string, outDirs ...string) error {
+		ev := migration.HookEvent{Stage: stage, When: migration.HookPre, BaseDir: base, InPath: argValue(args, "-in"), OutDir: outDirs[0]}
+		if err := runHooks(ctx, cfg.Hooks, ev); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return err
+		}
+
+		started := time.Now()
+		args = append(args, "-durability", cfg.Durability, "-atomic-write", cfg.AtomicWrite,
+			"-max-files-per-dir", fmt.Sprintf("%d", cfg.MaxFilesPerDir), "-max-output-bytes", fmt.Sprintf("%d", cfg.MaxOutputBytes))
+		if cfg.CanonicalJSON {
+			args = append(args, "-canonical-json")
+		}
+		err := runGo(ctx, args...)
+		for _, dir := range outDirs {
+			collectStageReport(pipeline, stage, filepath.Join(dir, migration.RunReportFileName), started, err)
+		}
+
+		ev.When, ev.Status = migration.HookPost, migration.RunStatusOK
+		if err != nil {
+			ev.Status, ev.Error = migration.RunStatusFailed, err.Error()
+		}
+		items, cerr := changedFiles(ev.OutDir, started)
+		if cerr != nil {
+			fmt.Fprintln(os.Stderr, "warning:", cerr.Error())
+		}
+		ev.Items = items
+		if herr := runHooks(ctx, cfg.Hooks, ev); herr != nil {
+			fmt.Fprintln(os.Stderr, herr.Error())
+			if err == nil {
+				err = herr
+			}
+		}
+		return err
+	}
+	runAPIStage := func(stage string, args []string, outDir string) {
+		args = append(args, budgetArgs(cfg, budgetLedger)...)
+		args = append(args, throughputArgs(cfg, stage)...)
+		if cfg.StructuredOutput != "" {
+			args = append(args, "-structured-output", cfg.StructuredOutput)
+		}
+		if cfg.Chaos != "" {
+			args = append(args, "-chaos", cfg.Chaos)
+		}
+		if err := runStage(stage, args, outDir); err != nil {
+			if budgetStopped(cfg, budgetLedger, err) {
+				fmt.Fprintf(os.Stderr, "stopping after %s: spend cap reached; completed work is checkpointed, rerun to continue\n", stage)
+				exit(migration.RunStatusBudgetExhausted, provider.ExitBudgetExhausted)
+			}
+			exit(migration.RunStatusFailed, 1)
+		}
+	}
+
+	var archiveRepo *gitArchive
+	if cfg.GitCommit {
+		var err error
+		if archiveRepo, err = openGitArchive(ctx, base, cfg.GitTag, time.Now()); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			exit(migration.RunStatusFailed, 1)
+		}
+	}
+	// commitStage commits what a stage changed under the base dir with -git-commit; reports are the
+	// run reports it added to the pipeline report.
+	commitStage := func(stage string, reports []migration.RunReport) {
+		if archiveRepo == nil {
+			return
+		}
+		rev, err := archiveRepo.commitStage(ctx, stage, reports)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			exit(migration.RunStatusFailed, 1)
+		}
+		if rev == "" {
+			fmt.Fprintln(os.Stdout, "git-commit: nothing changed in", stage)
+			return
+		}
+		fmt.Fprintf(os.Stdout, "git-commit: %s %s\n", rev, stage)
+	}
+
+	// splitThread finds the split file of -conversation-id on first use, since a -from-stage split run
+	// writes it first. Its base name, not the ID, names the thread's chunk and summary directories.
+	var splitThread string
+	findThread := func() string {
+		if splitThread == "" {
+			p, err := findSplitThread(threadsDir, cfg.ConversationID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "-conversation-id %s: %s\n", cfg.ConversationID, err.Error())
+				exit(migration.RunStatusFailed, 2)
+			}
+			splitThread = p
+		}
+		return splitThread
+	}
 
 	for _, stage := range stages {
+		stageReports := len(pipeline.Stages)
 		switch stage {
 		case "split":
 			// If threads already exist and we're not overwriting, skip.
 			if !cfg.Overwrite && dirHasJSON(threadsDir) {
 				fmt.Fprintln(os.Stdout, "skip split: threads already exist")
+				pipeline.Warnings = append(pipeline.Warnings, "skip split: threads already exist")
 				continue
 			}
 			args := []string{
@@ -63,30 +213,58 @@ func main() {
 			if cfg.Overwrite {
 				args = append(args, "-overwrite")
 			}
-			if err := runGo(ctx, args...); err != nil {
-				os.Exit(1)
+			if cfg.ToolCalls {
+				args = append(args, "-tool-calls")
+			}
+			if cfg.MaxConversations > 0 {
+				args = append(args, "-max-conversations", strconv.Itoa(cfg.MaxConversations))
+			}
+			if cfg.Pilot > 0 {
+				args = append(args, "-ids", pilotIDsPath)
+			}
+			if err := runStage("split", args, threadsDir); err != nil {
+				exit(migration.RunStatusFailed, 1)
 			}
 		case "chunk":
-			if !cfg.Overwrite && dirHasAny(chunksDir) {
-				fmt.Fprintln(os.Stdout, "skip chunk: chunks already exist")
-				continue
+			// thread-chunker skips threads that already have chunks, so a run stopped by the spend cap
+			// picks up where it left off.
+			in := threadsDir
+			if cfg.ConversationID != "" {
+				// Rechunking can change the chunk count, so the thread's old chunks and their
+				// summaries go first rather than lingering beside the new ones.
+				in = findThread()
+				name := splitThreadName(in)
+				for _, dir := range []string{filepath.Join(chunksDir, name), filepath.Join(summariesDir, name)} {
+					if err := os.RemoveAll(dir); err != nil {
+						fmt.Fprintln(os.Stderr, err.Error())
+						exit(migration.RunStatusFailed, 1)
+					}
+				}
 			}
 			args := []string{
 				"run", "./cmd/thread-chunker",
-				"-in", threadsDir,
+				"-in", in,
 				"-out", chunksDir,
 				"-model", cfg.Model,
 				"-target-turns", fmt.Sprintf("%d", cfg.TargetTurns),
+				"-min-turns", fmt.Sprintf("%d", cfg.chunkMinTurns()),
+				"-min-messages", fmt.Sprintf("%d", cfg.MinMessages),
+				"-max-tiny-tokens", fmt.Sprintf("%d", cfg.chunkMaxTinyTokens()),
+				"-resume=true",
 			}
 			if cfg.Pretty {
 				args = append(args, "-pretty")
 			}
-			if cfg.Overwrite {
+			if cfg.overwrite() {
 				args = append(args, "-overwrite")
 			}
-			if err := runGo(ctx, args...); err != nil {
-				os.Exit(1)
+			if cfg.DropMessages != "" {
+				args = append(args, "-drop-messages", cfg.DropMessages)
+			}
+			if cfg.CompressMessages != "" {
+				args = append(args, "-compress-messages", cfg.CompressMessages)
 			}
+			runAPIStage("chunk", args, chunksDir)
 		case "summarize":
 			args := []string{
 				"run", "./cmd/chunk-summarizer",
@@ -96,7 +274,6 @@ func main() {
 				"-sentiment-model", cfg.SentimentModel,
 				"-resume=true",
 				"-reindex=true",
-				"-concurrency", fmt.Sprintf("%d", cfg.Concurrency),
 				"-batch-size", fmt.Sprintf("%d", cfg.BatchSize),
 				"-max-chunks", fmt.Sprintf("%d", cfg.MaxChunks),
 				"-index-summary-max-chars", fmt.Sprintf("%d", cfg.IndexSummaryMaxChars),
@@ -106,15 +283,44 @@ func main() {
 			if cfg.Pretty {
 				args = append(args, "-pretty")
 			}
-			if cfg.Overwrite {
+			if cfg.overwrite() {
 				args = append(args, "-overwrite")
 			}
+			if cfg.ConversationID != "" {
+				// chunk-summarizer selects threads by chunk directory; thread-rollup below by ID.
+				args = append(args, "-threads", splitThreadName(findThread()))
+			}
 			if cfg.SentimentPromptFile != "" {
 				args = append(args, "-sentiment-prompt-file", cfg.SentimentPromptFile)
 			}
-			if err := runGo(ctx, args...); err != nil {
-				os.Exit(1)
+			if cfg.SourcePromptDir != "" {
+				args = append(args, "-source-prompts", cfg.SourcePromptDir)
 			}
+			if cfg.PromptBudget != "" {
+				args = append(args, "-prompt-budget", cfg.PromptBudget)
+			}
+			if cfg.TermsModel != "" {
+				args = append(args, "-terms-model", cfg.TermsModel)
+			}
+			if cfg.StylePath != "" {
+				args = append(args, "-style", cfg.StylePath)
+			}
+			if cfg.OutputLanguage != "" {
+				args = append(args, "-output-language", cfg.OutputLanguage)
+			}
+			if cfg.SentimentIndexFields != "" {
+				args = append(args, "-sentiment-index-fields", cfg.SentimentIndexFields)
+			}
+			if cfg.SentimentEvidence {
+				args = append(args, "-sentiment-evidence")
+			}
+			if cfg.TurnSentiment != "" {
+				args = append(args, "-turn-sentiment", cfg.TurnSentiment)
+			}
+			if cfg.LowercaseTags {
+				args = append(args, "-lowercase-tags")
+			}
+			runAPIStage("summarize", args, summariesDir)
 		case "rollup":
 			args := []string{
 				"run", "./cmd/thread-rollup",
@@ -125,7 +331,7 @@ func main() {
 				"-sentiment-model", cfg.SentimentModel,
 				"-resume=true",
 				"-reindex=true",
-				"-concurrency", fmt.Sprintf("%d", cfg.Concurrency),
+				"-overrides", overridesDir,
 				"-index-summary-max-chars", fmt.Sprintf("%d", cfg.IndexSummaryMaxChars),
 				"-index-tags-max", fmt.Sprintf("%d", cfg.IndexTagsMax),
 				"-index-terms-max", fmt.Sprintf("%d", cfg.IndexTermsMax),
@@ -133,12 +339,34 @@ func main() {
 			if cfg.Pretty {
 				args = append(args, "-pretty")
 			}
-			if cfg.Overwrite {
+			if cfg.overwrite() {
 				args = append(args, "-overwrite")
 			}
-			if err := runGo(ctx, args...); err != nil {
-				os.Exit(1)
+			if cfg.ConversationID != "" {
+				args = append(args, "-threads", cfg.ConversationID)
+			}
+			if cfg.PromptBudget != "" {
+				args = append(args, "-prompt-budget", cfg.PromptBudget)
 			}
+			if cfg.LowercaseTags {
+				args = append(args, "-lowercase-tags")
+			}
+			if cfg.StylePath != "" {
+				args = append(args, "-style", cfg.StylePath)
+			}
+			if cfg.OutputLanguage != "" {
+				args = append(args, "-output-language", cfg.OutputLanguage)
+			}
+			if cfg.SentimentIndexFields != "" {
+				args = append(args, "-sentiment-index-fields", cfg.SentimentIndexFields)
+			}
+			if cfg.SentimentEvidence {
+				args = append(args, "-sentiment-evidence")
+			}
+			if cfg.Bundle {
+				args = append(args, "-bundle-out", filepath.Join(threadsDir, "bundles"), "-threads-dir", threadsDir)
+			}
+			runAPIStage("rollup", args, threadSummariesDir)
 		case "pack":
 			// Semantic
 			{
@@ -148,15 +376,27 @@ func main() {
 					"-in", threadSummariesDir,
 					"-out", semanticShardsDir,
 					"-max-bytes", fmt.Sprintf("%d", cfg.MaxShardBytes),
+					"-overrides", overridesDir,
 					"-index-summary-max-chars", fmt.Sprintf("%d", cfg.IndexSummaryMaxChars),
 					"-index-tags-max", fmt.Sprintf("%d", cfg.IndexTagsMax),
 					"-index-terms-max", fmt.Sprintf("%d", cfg.IndexTermsMax),
 				}
-				if cfg.Overwrite {
+				if cfg.overwrite() {
 					args = append(args, "-overwrite")
+				} else {
+					args = append(args, "-incremental")
 				}
-				if err := runGo(ctx, args...); err != nil {
-					os.Exit(1)
+				if cfg.ForcePack {
+					args = append(args, "-force")
+				}
+				if cfg.SourceLinks {
+					args = append(args, "-source-index", filepath.Join(summariesDir, "index.json"))
+				}
+				if cfg.TemplateDir != "" {
+					args = append(args, "-template-dir", cfg.TemplateDir)
+				}
+				if err := runStage("pack", args, semanticShardsDir); err != nil {
+					exit(migration.RunStatusFailed, 1)
 				}
 			}
 			// Sentiment
@@ -167,15 +407,27 @@ func main() {
 					"-in", threadSentimentSummariesDir,
 					"-out", sentimentShardsDir,
 					"-max-bytes", fmt.Sprintf("%d", cfg.MaxShardBytes),
+					"-overrides", overridesDir,
 					"-index-summary-max-chars", fmt.Sprintf("%d", cfg.IndexSummaryMaxChars),
 					"-index-tags-max", fmt.Sprintf("%d", cfg.IndexTagsMax),
 					"-index-terms-max", fmt.Sprintf("%d", cfg.IndexTermsMax),
 				}
-				if cfg.Overwrite {
+				if cfg.overwrite() {
 					args = append(args, "-overwrite")
+				} else {
+					args = append(args, "-incremental")
+				}
+				if cfg.ForcePack {
+					args = append(args, "-force")
+				}
+				if cfg.SourceLinks {
+					args = append(args, "-source-index", filepath.Join(summariesDir, "sentiment_index.json"))
 				}
-				if err := runGo(ctx, args...); err != nil {
-					os.Exit(1)
+				if cfg.TemplateDir != "" {
+					args = append(args, "-template-dir", cfg.TemplateDir)
+				}
+				if err := runStage("pack", args, sentimentShardsDir); err != nil {
+					exit(migration.RunStatusFailed, 1)
 				}
 			}
 
@@ -184,60 +436,204 @@ func main() {
 			glossarySrc := filepath.Join(summariesDir, "glossary.json")
 			for _, dstDir := range []string{semanticShardsDir, sentimentShardsDir} {
 				dst := filepath.Join(dstDir, "glossary.json")
-				copied, err := fileutils.CopyFileIfExists(glossarySrc, dst, cfg.Overwrite)
+				copied, err := fileutils.CopyFileIfExists(glossarySrc, dst, cfg.overwrite())
 				if err != nil {
 					fmt.Fprintln(os.Stderr, "failed copying glossary:", err.Error())
-					os.Exit(1)
+					exit(migration.RunStatusFailed, 1)
 				}
 				if copied {
 					fmt.Fprintln(os.Stdout, "copied glossary:", dst)
 				}
 			}
+		case "pack-archive":
+			// Write the report so far first, so the archive carries it.
+			pipeline.Status = migration.RunStatusOK
+			if err := migration.WritePipelineReport(pipelineReportPath, pipeline); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				exit(migration.RunStatusFailed, 1)
+			}
+			args := []string{
+				"run", "./cmd/pack-archive",
+				"-in", threadsDir,
+				"-compression", cfg.ArchiveCompression,
+			}
+			if cfg.overwrite() {
+				args = append(args, "-overwrite")
+			}
+			if err := runStage("pack-archive", args, archivesDir); err != nil {
+				exit(migration.RunStatusFailed, 1)
+			}
 		default:
 			fmt.Fprintln(os.Stderr, "unknown stage:", stage)
-			os.Exit(2)
+			exit(migration.RunStatusFailed, 2)
+		}
+		commitStage(stage, pipeline.Stages[stageReports:])
+	}
+
+	pipeline.Status = migration.RunStatusOK
+	if err := migration.WritePipelineReport(pipelineReportPath, pipeline); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Fprintln(os.Stdout, "pipeline report:", pipelineReportPath)
+
+	if cfg.Pilot > 0 {
+		proj := migration.ProjectPilot(pilotCands, pilotIDs, pipeline)
+		projPath := filepath.Join(threadsDir, migration.PilotProjectionFileName)
+		if err := fileutils.WriteJSONFileAtomic(projPath, proj, true); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
 		}
+		fmt.Fprintf(os.Stdout, "pilot_conversations=%d archive_conversations=%d scale=%.1f measured_usd=%.4f projected_usd=%.2f projected_tokens=%d projected_duration=%s out=%s\n",
+			proj.SampleConversations, proj.ArchiveConversations, proj.Scale, proj.MeasuredUSD, proj.ProjectedUSD, proj.ProjectedTokens,
+			(time.Duration(proj.ProjectedSeconds) * time.Second).String(), projPath)
 	}
+	// The last commit carries the pipeline report (and pilot projection) with the run's totals.
+	commitStage("report", pipeline.Stages)
 }
 
 type Config struct {
+	// ConfigPath is a JSON file of flag values (see archive-init); flags on the command line win.
+	ConfigPath string
+
 	ConversationsPath string
 	BaseDir           string
+	// MaxConversations limits the split to the first N conversations (0 = all).
+	MaxConversations int
+	// Pilot runs every stage on N representative conversations under <base-dir>/pilot and projects
+	// the whole archive's cost (0 = normal run).
+	Pilot int
 
 	Model          string
 	SentimentModel string
 	TargetTurns    int
+	// MinTurns and MinMessages are thread-chunker's tiny-thread thresholds.
+	MinTurns    int
+	MinMessages int
+	// Quick treats every thread that fits the prompt budget as tiny (see chunkMinTurns).
+	Quick bool
 
 	Concurrency int
 	BatchSize   int
 	MaxChunks   int
 
+	// SummarizeConcurrency and RollupConcurrency override Concurrency for one stage (0 = Concurrency).
+	SummarizeConcurrency int
+	RollupConcurrency    int
+	// QPS caps model requests per second in each API stage; ChunkQPS, SummarizeQPS, and RollupQPS
+	// override it for one stage (0 = QPS, and 0 there = unlimited).
+	QPS          float64
+	ChunkQPS     float64
+	SummarizeQPS float64
+	RollupQPS    float64
+
 	MaxShardBytes int
 
 	IndexSummaryMaxChars int
 	IndexTagsMax         int
 	IndexTermsMax        int
+	SentimentIndexFields string
+	SentimentEvidence    bool
+	TurnSentiment        string
+	Bundle               bool
+	// ForcePack passes -force to memory-pack, packing past a stale thread index.
+	ForcePack bool
+	// SourceLinks has memory-pack link each section to its chunks and chunk summaries.
+	SourceLinks bool
+
+	// Archive appends the pack-archive stage, bundling the finished run into one tarball under
+	// <base-dir>/threads/archives with ArchiveCompression.
+	Archive            bool
+	ArchiveCompression string
 
 	FromStage string
 	OnlyStage string
+	// ConversationID reprocesses one split thread: its chunks, summaries, and rollups are rebuilt
+	// with overwrite, and indices and shards are rebuilt around it. The rest of the archive is left
+	// alone. The indices are rebuilt whole rather than patched with chunk-summarizer's append writer
+	// because rechunking can leave fewer chunks, and appended rows cannot retract the rows of chunks
+	// that no longer exist; thread-rollup has no append writer at all.
+	ConversationID string
 
 	Pretty    bool
 	Overwrite bool
+	ToolCalls bool
+
+	// LowercaseTags is passed to the summarize and rollup stages.
+	LowercaseTags bool
+
+	// DropMessages and CompressMessages are thread-chunker's -drop-messages and -compress-messages.
+	DropMessages     string
+	CompressMessages string
 
 	SentimentPromptFile string
+	// SourcePromptDir is chunk-summarizer's -source-prompts.
+	SourcePromptDir string
+
+	// PromptBudget is passed to the summarize and rollup stages (see provider.ParsePromptBudget).
+	PromptBudget string
+
+	// TermsModel is passed to the summarize stage to build the glossary in a cheap pass first.
+	TermsModel string
+
+	// StylePath is passed to the summarize and rollup stages (see migration.StyleProfile).
+	StylePath string
+	// OutputLanguage is passed to the summarize and rollup stages, and TemplateDir to pack, so an
+	// archive can be written and rendered in another language.
+	OutputLanguage string
+	TemplateDir    string
+
+	MaxUSD         float64
+	MaxTokensTotal int64
+	BudgetLedger   string
+
+	Durability  string
+	AtomicWrite string
+	// CanonicalJSON writes JSON outputs in canonical form (see fileutils.Canonicalize).
+	CanonicalJSON bool
+
+	// GitCommit commits the base dir after each stage (running git init there when it is not in a
+	// work tree); GitTag, when set, tags each commit <GitTag>/<run start>/<stage>.
+	GitCommit bool
+	GitTag    string
+
+	// MaxFilesPerDir and MaxOutputBytes are passed to every stage (see fileutils.Quota); the byte cap
+	// applies to each stage separately.
+	MaxFilesPerDir int
+	MaxOutputBytes int64
+
+	// StructuredOutput is passed to the API stages (see provider.SetStructuredOutput).
+	StructuredOutput string
+
+	// Chaos is passed to the API stages (chunk, summarize, rollup) to inject provider failures.
+	Chaos string
+
+	Hooks []hook
 }
 
 func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
 	cfg := defaultConfig()
 	fs.SetOutput(os.Stderr)
+	cli.Setup(fs, help)
 
+	fs.StringVar(&cfg.ConfigPath, "config", "", "JSON file of flag values, e.g. written by archive-init (flags given on the command line override it)")
 	fs.StringVar(&cfg.ConversationsPath, "conversations", cfg.ConversationsPath, "Path to conversations.json")
 	fs.StringVar(&cfg.BaseDir, "base-dir", cfg.BaseDir, "Base output directory (defaults to docs/peanut-gallery)")
+	fs.IntVar(&cfg.Pilot, "pilot", cfg.Pilot, "Run every stage on N conversations sampled by year and length into <base-dir>/pilot, then print projected cost and time for the whole archive (0 = normal run)")
+	fs.IntVar(&cfg.MaxConversations, "max-conversations", cfg.MaxConversations, "Split only the first N conversations, e.g. for a pilot run (0 = all)")
 	fs.StringVar(&cfg.Model, "model", cfg.Model, "OpenAI model for chunking/summarization/rollups (uses OPENAI_API_KEY)")
 	fs.StringVar(&cfg.SentimentModel, "sentiment-model", cfg.SentimentModel, "OpenAI model override for sentiment passes (chunk sentiment + thread sentiment rollup)")
 	fs.IntVar(&cfg.TargetTurns, "target-turns", cfg.TargetTurns, "Target turns per chunk for thread chunking")
+	fs.IntVar(&cfg.MinTurns, "min-turns", cfg.MinTurns, "Threads with fewer turns skip breakpoint detection and become one chunk, forwarded to thread-chunker (0 disables)")
+	fs.IntVar(&cfg.MinMessages, "min-messages", cfg.MinMessages, "Threads with fewer messages are treated like -min-turns, forwarded to thread-chunker (0 disables)")
 
-	fs.IntVar(&cfg.Concurrency, "concurrency", cfg.Concurrency, "Concurrent chunk summarizations per batch")
+	fs.IntVar(&cfg.Concurrency, "concurrency", cfg.Concurrency, "Concurrent chunk summarizations per batch and concurrent thread rollups")
+	fs.IntVar(&cfg.SummarizeConcurrency, "summarize-concurrency", 0, "Concurrency for the summarize stage only (0 = -concurrency)")
+	fs.IntVar(&cfg.RollupConcurrency, "rollup-concurrency", 0, "Concurrency for the rollup stage only (0 = -concurrency)")
+	fs.Float64Var(&cfg.QPS, "qps", 0, "Max model requests started per second in each of the chunk, summarize, and rollup stages (0 disables)")
+	fs.Float64Var(&cfg.ChunkQPS, "chunk-qps", 0, "Requests per second for the chunk stage only (0 = -qps)")
+	fs.Float64Var(&cfg.SummarizeQPS, "summarize-qps", 0, "Requests per second for the summarize stage only (0 = -qps)")
+	fs.Float64Var(&cfg.RollupQPS, "rollup-qps", 0, "Requests per second for the rollup stage only (0 = -qps)")
 	fs.IntVar(&cfg.BatchSize, "batch-size", cfg.BatchSize, "Batch size for glossary chaining/merging (0 = all)")
 	fs.IntVar(&cfg.MaxChunks, "max-chunks", cfg.MaxChunks, "Limit number of chunks processed (0 = all)")
 
@@ -246,26 +642,147 @@ func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
 	fs.IntVar(&cfg.IndexSummaryMaxChars, "index-summary-max-chars", cfg.IndexSummaryMaxChars, "Max chars in index summary fields (0 disables truncation)")
 	fs.IntVar(&cfg.IndexTagsMax, "index-tags-max", cfg.IndexTagsMax, "Max tags/themes stored in index rows (0 disables limiting)")
 	fs.IntVar(&cfg.IndexTermsMax, "index-terms-max", cfg.IndexTermsMax, "Max terms/emotions stored in index rows (0 disables limiting)")
+	fs.BoolVar(&cfg.SentimentEvidence, "sentiment-evidence", false, "Ask chunk and thread sentiment passes for emotion confidences and the turn ranges evidencing each emotional tension")
+	fs.BoolVar(&cfg.SourceLinks, "source-links", false, "Have the pack stage link each shard section to its chunk files and chunk summaries (memory-pack -source-index)")
+	fs.BoolVar(&cfg.ForcePack, "force-pack", false, "Have the pack stage pack even when a thread index disagrees with the rollups on disk (memory-pack -force)")
+	fs.BoolVar(&cfg.Bundle, "bundle", false, "Have the rollup stage write <base-dir>/threads/bundles/<conversation_id>.bundle.json per thread (simplified thread, chunk summaries, sentiment summaries, rollups)")
+	fs.StringVar(&cfg.TurnSentiment, "turn-sentiment", "", "Date ranges (2024-01-01..2024-03-31,...) whose chunks also get per-turn sentiment in the summarize stage")
+	fs.StringVar(&cfg.SentimentIndexFields, "sentiment-index-fields", "", "Comma-separated sentiment fields kept in chunk and thread sentiment index rows (default all)")
+
+	fs.BoolVar(&cfg.Archive, "archive", false, "After pack, bundle shards, indexes, glossary, and the pipeline report into <base-dir>/threads/archives/compress-o-bot-<timestamp>.tar.zst with an integrity manifest")
+	fs.StringVar(&cfg.ArchiveCompression, "archive-compression", cfg.ArchiveCompression, "Compression for -archive: zstd (needs the zstd binary on PATH), gzip, or none")
 
-	fs.StringVar(&cfg.FromStage, "from-stage", "", "Start at stage: split|chunk|summarize|rollup|pack")
-	fs.StringVar(&cfg.OnlyStage, "only-stage", "", "Run only one stage: split|chunk|summarize|rollup|pack")
+	fs.StringVar(&cfg.FromStage, "from-stage", "", "Start at stage: split|chunk|summarize|rollup|pack|pack-archive")
+	fs.StringVar(&cfg.OnlyStage, "only-stage", "", "Run only one stage: split|chunk|summarize|rollup|pack|pack-archive")
+	fs.BoolVar(&cfg.Quick, "quick", false, "For small archives: summarize each thread that fits -prompt-budget whole, with no breakpoint requests, and use its summaries as its rollups (longer threads are chunked as usual)")
+	fs.StringVar(&cfg.ConversationID, "conversation-id", "", "Reprocess one conversation: rechunk, resummarize, and roll up just its split thread under <base-dir>/threads with overwrite, then rebuild indices and shards")
 
 	fs.BoolVar(&cfg.Pretty, "pretty", cfg.Pretty, "Pretty-print JSON outputs where supported")
 	fs.BoolVar(&cfg.Overwrite, "overwrite", cfg.Overwrite, "Overwrite existing outputs (disables resume behavior)")
+	fs.BoolVar(&cfg.ToolCalls, "tool-calls", cfg.ToolCalls, "Preserve structured tool call name/arguments/status when splitting")
+	fs.BoolVar(&cfg.LowercaseTags, "lowercase-tags", cfg.LowercaseTags, "Lowercase summary and rollup tags, forwarded to the summarize and rollup stages")
+	fs.StringVar(&cfg.DropMessages, "drop-messages", "", "Roles/content types left out of chunks, forwarded to thread-chunker (e.g. tool,assistant/thoughts)")
+	fs.StringVar(&cfg.CompressMessages, "compress-messages", "", "Roles/content types whose text is shortened in chunks, forwarded to thread-chunker")
 	fs.StringVar(&cfg.SentimentPromptFile, "sentiment-prompt-file", "", "Optional path to a file containing a custom sentiment prompt header (prepended before required SECURITY+schema tail)")
+	fs.StringVar(&cfg.SourcePromptDir, "source-prompts", "", "Directory of per-source prompt headers, forwarded to chunk-summarizer")
+	fs.StringVar(&cfg.TermsModel, "terms-model", "", "Cheap model for a terms-only glossary pass before chunk summaries (empty disables)")
+	fs.StringVar(&cfg.StylePath, "style", "", "Style profile JSON for chunk summaries and rollups (bullets, max_paragraphs, formality, person, notes, language)")
+	fs.StringVar(&cfg.OutputLanguage, "output-language", "", "Language to write chunk summaries and rollups in, e.g. German (chunk-summarizer and thread-rollup -output-language)")
+	fs.StringVar(&cfg.TemplateDir, "template-dir", "", "Thread section templates and labels.json for the pack stage (memory-pack -template-dir)")
+	fs.StringVar(&cfg.StructuredOutput, "structured-output", provider.StructuredJSONSchema, "How the chunk, summarize, and rollup stages request schema-constrained output: json-schema or tool (a required function call, for models without json_schema support)")
+	fs.StringVar(&cfg.PromptBudget, "prompt-budget", "", "Max prompt input tokens per model for the summarize and rollup stages, e.g. gpt-5-mini=60000,gpt-4o-mini=12000 or a bare number for all models (default 20000)")
+
+	fs.Float64Var(&cfg.MaxUSD, "max-usd", cfg.MaxUSD, "Stop scheduling API work once estimated spend across all stages reaches this many USD (0 disables)")
+	fs.Int64Var(&cfg.MaxTokensTotal, "max-tokens-total", cfg.MaxTokensTotal, "Stop scheduling API work once input+output tokens across all stages reach this total (0 disables)")
+	fs.StringVar(&cfg.BudgetLedger, "budget-ledger", "", "Spend ledger shared by stages (defaults to <base-dir>/threads/spend_ledger.json when a cap is set)")
+	fs.StringVar(&cfg.Durability, "durability", cfg.Durability, "fsync policy passed to every stage: none, group (sync in batches), or full (sync every file)")
+	fs.StringVar(&cfg.AtomicWrite, "atomic-write", fileutils.AtomicRename, "Atomic write strategy passed to every stage: rename, staged (temp files in TMPDIR, for synced folders), or copy (in place, for shares that refuse rename)")
+	fs.BoolVar(&cfg.CanonicalJSON, "canonical-json", cfg.CanonicalJSON, "Write JSON outputs in canonical form (sorted keys, stable numbers), passed to every stage")
+	fs.BoolVar(&cfg.GitCommit, "git-commit", false, "Commit <base-dir> to git after each stage with the stage's run stats in the message (in its own repository, created with git init when missing)")
+	fs.StringVar(&cfg.GitTag, "git-tag", "", "With -git-commit, also tag each stage commit <prefix>/<run start>/<stage>, e.g. -git-tag archive")
+	fs.IntVar(&cfg.MaxFilesPerDir, "max-files-per-dir", cfg.MaxFilesPerDir, "Passed to every stage: stop with an error before any output directory holds more than N files (0 disables)")
+	fs.Int64Var(&cfg.MaxOutputBytes, "max-output-bytes", cfg.MaxOutputBytes, "Passed to every stage: stop a stage with an error before it writes more than N bytes (0 disables)")
+	fs.StringVar(&cfg.Chaos, "chaos", "", "Inject provider failures into the chunk, summarize, and rollup stages for testing, e.g. rate-limit=0.1,server-error=0.05,truncate=0.05,garbage=0.05 (plus seed=N, max=N)")
+	fs.Func("hook", "Run a command or Go plugin before/after a stage: <pre|post>:<stage>=<command> or <pre|post>:<stage>=plugin:<path.so>#<Symbol> (repeatable; event JSON on stdin)", func(v string) error {
+		h, err := parseHook(v)
+		if err != nil {
+			return err
+		}
+		cfg.Hooks = append(cfg.Hooks, h)
+		return nil
+	})
 
 	if err := fs.Parse(args); err != nil {
 		return Config{}, err
 	}
+	if cfg.ConfigPath != "" {
+		if err := cli.LoadConfigFile(fs, cfg.ConfigPath); err != nil {
+			return Config{}, err
+		}
+	}
 	if cfg.SentimentModel == "" {
 		cfg.SentimentModel = cfg.Model
 	}
 	if cfg.SentimentPromptFile != "" {
 		cfg.SentimentPromptFile = filepath.Clean(cfg.SentimentPromptFile)
 	}
+	if cfg.SourcePromptDir != "" {
+		cfg.SourcePromptDir = filepath.Clean(cfg.SourcePromptDir)
+	}
+	if cfg.StylePath != "" {
+		cfg.StylePath = filepath.Clean(cfg.StylePath)
+	}
+	if cfg.BudgetLedger != "" {
+		cfg.BudgetLedger = filepath.Clean(cfg.BudgetLedger)
+	}
 	return cfg, nil
 }
 
+func budgetArgs(cfg Config, ledger string) []string {
+	var args []string
+	if cfg.MaxUSD > 0 {
+		args = append(args, "-max-usd", strconv.FormatFloat(cfg.MaxUSD, 'f', -1, 64))
+	}
+	if cfg.MaxTokensTotal > 0 {
+		args = append(args, "-max-tokens-total", strconv.FormatInt(cfg.MaxTokensTotal, 10))
+	}
+	if ledger != "" {
+		args = append(args, "-budget-ledger", ledger)
+	}
+	return args
+}
+
+// throughputArgs returns the -concurrency and -qps flags for an API stage, applying the per-stage
+// overrides.
+func throughputArgs(cfg Config, stage string) []string {
+	concurrency, qps := 0, cfg.QPS
+	switch stage {
+	case "chunk":
+		// thread-chunker works through threads one at a time.
+		if cfg.ChunkQPS > 0 {
+			qps = cfg.ChunkQPS
+		}
+	case "summarize":
+		concurrency = cfg.Concurrency
+		if cfg.SummarizeConcurrency > 0 {
+			concurrency = cfg.SummarizeConcurrency
+		}
+		if cfg.SummarizeQPS > 0 {
+			qps = cfg.SummarizeQPS
+		}
+	case "rollup":
+		concurrency = cfg.Concurrency
+		if cfg.RollupConcurrency > 0 {
+			concurrency = cfg.RollupConcurrency
+		}
+		if cfg.RollupQPS > 0 {
+			qps = cfg.RollupQPS
+		}
+	}
+	var args []string
+	if concurrency > 0 {
+		args = append(args, "-concurrency", strconv.Itoa(concurrency))
+	}
+	if qps > 0 {
+		args = append(args, "-qps", strconv.FormatFloat(qps, 'f', -1, 64))
+	}
+	return args
+}
+
+// budgetStopped reports whether a failed stage stopped because of the spend cap rather than an error.
+// `go run` reports child failures as exit status 1, so the shared ledger is consulted as well.
+func budgetStopped(cfg Config, ledger string, err error) bool {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == provider.ExitBudgetExhausted {
+		return true
+	}
+	if ledger == "" {
+		return false
+	}
+	b, berr := provider.NewBudget(cfg.MaxUSD, cfg.MaxTokensTotal, ledger)
+	return berr == nil && b.Exceeded()
+}
+
 func runGo(ctx context.Context, args ...string) error {
 	cmd := exec.CommandContext(ctx, "go", args...)
 	cmd.Stdout = os.Stdout
@@ -283,6 +800,60 @@ func runGo(ctx context.Context, args ...string) error {
 	return nil
 }
 
+// collectStageReport appends the run report a stage wrote at path, if it was written during this run.
+// When the stage failed without leaving a fresh report, a minimal failed entry is recorded instead.
+func collectStageReport(p *migration.PipelineReport, stage string, path string, started time.Time, runErr error) {
+	r, err := migration.ReadRunReport(path)
+	if err == nil {
+		if t, perr := time.Parse(time.RFC3339, r.StartedAt); perr == nil && !t.Before(started.Truncate(time.Second)) {
+			p.AddStage(r)
+			return
+		}
+	}
+	if runErr != nil {
+		p.AddStage(migration.RunReport{Stage: stage, Status: migration.RunStatusFailed, Warnings: []string{runErr.Error()}})
+		return
+	}
+	p.Warnings = append(p.Warnings, fmt.Sprintf("%s: no run report at %s", stage, path))
+}
+
+// gitRevision returns the short HEAD revision of the working tree the stages are run from, or "".
+func gitRevision(ctx context.Context) string {
+	out, err := exec.CommandContext(ctx, "git", "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// argValue returns the value following flag in a stage's argument list, or "".
+func argValue(args []string, flag string) string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == flag {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// selectStages returns the stages to run. Reprocessing one conversation starts at chunk, since the
+// split thread is its input. pack-archive runs after pack with -archive, or when asked for by name.
+func selectStages(cfg Config) []string {
+	stages := []string{"split", "chunk", "summarize", "rollup", "pack"}
+	if cfg.Archive || cfg.FromStage == "pack-archive" {
+		stages = append(stages, "pack-archive")
+	}
+	switch {
+	case cfg.OnlyStage != "":
+		return []string{cfg.OnlyStage}
+	case cfg.FromStage != "":
+		return stagesFrom(stages, cfg.FromStage)
+	case cfg.ConversationID != "":
+		return stagesFrom(stages, "chunk")
+	}
+	return stages
+}
+
 func stagesFrom(stages []string, from string) []string {
 	from = strings.ToLower(strings.TrimSpace(from))
 	for i, s := range stages {
@@ -293,6 +864,39 @@ func stagesFrom(stages []string, from string) []string {
 	return stages
 }
 
+// findSplitThread returns the split thread file under threadsDir holding conversation id. The splitter
+// names it after layout.Component(id), with a content hash appended when several conversations share
+// that name, so each file with that stem is checked for the ID.
+func findSplitThread(threadsDir, id string) (string, error) {
+	base := layout.Component(id)
+	if base == "" {
+		base = "thread"
+	}
+	matches, err := filepath.Glob(filepath.Join(threadsDir, base+"*.json"))
+	if err != nil {
+		return "", err
+	}
+	for _, p := range matches {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return "", err
+		}
+		var thread struct {
+			ConversationID string `json:"conversation_id"`
+		}
+		if json.Unmarshal(b, &thread) == nil && thread.ConversationID == id {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no split thread in %s (run the split stage first)", threadsDir)
+}
+
+// splitThreadName is the base name of a split thread file, which thread-chunker names the thread's
+// chunk directory after and chunk-summarizer its summary directory.
+func splitThreadName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
 func dirHasJSON(dir string) bool {
 	ents, err := os.ReadDir(dir)
 	if err != nil {
@@ -302,17 +906,9 @@ func dirHasJSON(dir string) bool {
 		if e.IsDir() {
 			continue
 		}
-		if strings.HasSuffix(strings.ToLower(e.Name()), ".json") {
+		if strings.HasSuffix(strings.ToLower(e.Name()), ".json") && !migration.IsBookkeepingFile(e.Name()) {
 			return true
 		}
 	}
 	return false
 }
-
-func dirHasAny(dir string) bool {
-	ents, err := os.ReadDir(dir)
-	if err != nil {
-		return false
-	}
-	return len(ents) > 0
-}
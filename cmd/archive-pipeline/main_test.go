@@ -1,8 +1,23 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/openai/openai-go/responses"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
 )
 
 func TestParseFlags_Overrides(t *testing.T) {
@@ -36,3 +51,524 @@ func TestParseFlags_Overrides(t *testing.T) {
 		t.Fatalf("concurrency/batch/max=%d/%d/%d", cfg.Concurrency, cfg.BatchSize, cfg.MaxChunks)
 	}
 }
+
+func TestParseFlags_QuickChunksThreadsWhole(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := parseFlags(flag.NewFlagSet("archive-pipeline", flag.ContinueOnError), []string{"-min-turns", "5"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.Quick || cfg.chunkMinTurns() != 5 {
+		t.Fatalf("Quick=%v chunkMinTurns=%d, want false and 5", cfg.Quick, cfg.chunkMinTurns())
+	}
+	cfg, err = parseFlags(flag.NewFlagSet("archive-pipeline", flag.ContinueOnError), []string{"-quick", "-min-turns", "5"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if !cfg.Quick || cfg.chunkMinTurns() != quickMinTurns {
+		t.Fatalf("Quick=%v chunkMinTurns=%d, want true and %d", cfg.Quick, cfg.chunkMinTurns(), quickMinTurns)
+	}
+	if n := cfg.chunkMaxTinyTokens(); n != provider.DefaultInputTokens {
+		t.Fatalf("chunkMaxTinyTokens=%d, want the default prompt budget %d", n, provider.DefaultInputTokens)
+	}
+
+	// Threads over the smaller of the two summarize budgets are chunked normally.
+	cfg, err = parseFlags(flag.NewFlagSet("archive-pipeline", flag.ContinueOnError), []string{"-quick", "-model", "gpt-5-mini", "-sentiment-model", "gpt-4o-mini", "-prompt-budget", "gpt-5-mini=60000,gpt-4o-mini=12000"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if n := cfg.chunkMaxTinyTokens(); n != 12000 {
+		t.Fatalf("chunkMaxTinyTokens=%d, want 12000", n)
+	}
+	cfg.Quick = false
+	if n := cfg.chunkMaxTinyTokens(); n != 0 {
+		t.Fatalf("chunkMaxTinyTokens without -quick=%d, want 0", n)
+	}
+}
+
+func TestParseFlags_ConfigFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "compress-o-bot.json")
+	if err := os.WriteFile(path, []byte(`{"conversations": "export", "base-dir": "out", "model": "gpt-5", "max-usd": 3}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	fs := flag.NewFlagSet("archive-pipeline", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-config", path, "-base-dir", "pilot", "-max-conversations", "5"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.ConversationsPath != "export" || cfg.BaseDir != "pilot" || cfg.Model != "gpt-5" || cfg.SentimentModel != "gpt-5" || cfg.MaxUSD != 3 || cfg.MaxConversations != 5 {
+		t.Fatalf("cfg=%+v", cfg)
+	}
+}
+
+func TestConfig_ValidatePilot(t *testing.T) {
+	t.Parallel()
+
+	cfg := defaultConfig()
+	cfg.Pilot = 5
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	for _, mod := range []func(*Config){
+		func(c *Config) { c.Pilot = -1 },
+		func(c *Config) { c.OnlyStage = "pack" },
+		func(c *Config) { c.FromStage = "rollup" },
+		func(c *Config) { c.MaxConversations = 3 },
+	} {
+		c := cfg
+		mod(&c)
+		if err := c.Validate(); err == nil {
+			t.Fatalf("expected error for %+v", c)
+		}
+	}
+}
+
+func TestSelectStages_ConversationID(t *testing.T) {
+	t.Parallel()
+
+	cfg := defaultConfig()
+	cfg.ConversationID = "abc-123"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if got := selectStages(cfg); !reflect.DeepEqual(got, []string{"chunk", "summarize", "rollup", "pack"}) {
+		t.Fatalf("stages=%v", got)
+	}
+	if !cfg.overwrite() {
+		t.Fatal("reprocessing one conversation should overwrite its outputs")
+	}
+	cfg.FromStage = "rollup"
+	if got := selectStages(cfg); !reflect.DeepEqual(got, []string{"rollup", "pack"}) {
+		t.Fatalf("stages from rollup=%v", got)
+	}
+
+	for _, mod := range []func(*Config){
+		func(c *Config) { c.ConversationID = "../threads" },
+		func(c *Config) { c.ConversationID = ".." },
+		func(c *Config) { c.OnlyStage = "split" },
+		func(c *Config) { c.Pilot = 3 },
+	} {
+		c := defaultConfig()
+		c.ConversationID = "abc-123"
+		mod(&c)
+		if err := c.Validate(); err == nil {
+			t.Fatalf("expected error for %+v", c)
+		}
+	}
+}
+
+func TestConfig_ValidateChaos(t *testing.T) {
+	t.Parallel()
+
+	cfg := defaultConfig()
+	cfg.Chaos = "rate-limit=0.1,garbage=0.05,seed=2"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	cfg.Chaos = "timeouts=0.1"
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for -chaos %q", cfg.Chaos)
+	}
+}
+
+func TestConfig_ValidateArchiveNeedsZstd(t *testing.T) {
+	// Not parallel: empties PATH so zstd cannot be found.
+	t.Setenv("PATH", t.TempDir())
+
+	cfg := defaultConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate without -archive: %v", err)
+	}
+	cfg.Archive = true
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "zstd binary") {
+		t.Fatalf("Validate -archive without zstd: err=%v, want a missing zstd error", err)
+	}
+	cfg.ArchiveCompression = migration.ArchiveGzip
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate -archive-compression gzip: %v", err)
+	}
+}
+
+func TestThroughputArgs_PerStageOverrides(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "compress-o-bot.json")
+	if err := os.WriteFile(path, []byte(`{"concurrency": 8, "rollup-concurrency": 2, "qps": 4, "rollup-qps": 0.5}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	fs := flag.NewFlagSet("archive-pipeline", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-config", path, "-chunk-qps", "1"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	for stage, want := range map[string][]string{
+		"chunk":     {"-qps", "1"},
+		"summarize": {"-concurrency", "8", "-qps", "4"},
+		"rollup":    {"-concurrency", "2", "-qps", "0.5"},
+	} {
+		if got := throughputArgs(cfg, stage); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: throughputArgs=%v want %v", stage, got, want)
+		}
+	}
+	if args := throughputArgs(Config{Concurrency: 3}, "chunk"); len(args) != 0 {
+		t.Fatalf("chunk without -qps: %v", args)
+	}
+
+	cfg.RollupQPS = -1
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for negative -rollup-qps")
+	}
+}
+
+func TestBudgetArgsAndStopped(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{MaxUSD: 1.5, MaxTokensTotal: 1000}
+	ledger := filepath.Join(t.TempDir(), "spend_ledger.json")
+	got := budgetArgs(cfg, ledger)
+	want := []string{"-max-usd", "1.5", "-max-tokens-total", "1000", "-budget-ledger", ledger}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("budgetArgs=%v", got)
+	}
+	if args := budgetArgs(Config{}, ""); len(args) != 0 {
+		t.Fatalf("budgetArgs(no caps)=%v", args)
+	}
+
+	stageErr := errors.New("exit status 1")
+	if budgetStopped(cfg, ledger, stageErr) {
+		t.Fatalf("stopped without any recorded spend")
+	}
+	b, err := provider.NewBudget(0, 0, ledger)
+	if err != nil {
+		t.Fatalf("NewBudget: %v", err)
+	}
+	b.Record("gpt-5-mini", responses.ResponseUsage{InputTokens: 1200})
+	if err := b.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if !budgetStopped(cfg, ledger, stageErr) {
+		t.Fatalf("expected ledger over the token cap to count as a budget stop")
+	}
+}
+
+func TestCollectStageReport_FreshStaleAndMissing(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, migration.RunReportFileName)
+	started := time.Now()
+
+	p := migration.NewPipelineReport()
+	collectStageReport(p, "summarize", path, started, errors.New("exit status 1"))
+	if len(p.Stages) != 1 || p.Stages[0].Status != migration.RunStatusFailed {
+		t.Fatalf("missing report on failure: %+v", p.Stages)
+	}
+
+	r := migration.NewRunReport("chunk-summarizer", nil)
+	r.Processed = 3
+	if err := migration.WriteRunReport(path, r); err != nil {
+		t.Fatalf("WriteRunReport: %v", err)
+	}
+	collectStageReport(p, "summarize", path, started, nil)
+	if len(p.Stages) != 2 || p.Stages[1].Processed != 3 {
+		t.Fatalf("fresh report not collected: %+v", p.Stages)
+	}
+
+	collectStageReport(p, "summarize", path, started.Add(time.Hour), nil)
+	if len(p.Stages) != 2 || len(p.Warnings) != 1 {
+		t.Fatalf("stale report should be ignored with a warning: stages=%d warnings=%v", len(p.Stages), p.Warnings)
+	}
+}
+
+func TestParseHook(t *testing.T) {
+	t.Parallel()
+
+	h, err := parseHook(`post:summarize="./my hooks/tag-summaries" --fast`)
+	if err != nil {
+		t.Fatalf("parseHook: %v", err)
+	}
+	if h.When != migration.HookPost || h.Stage != "summarize" || h.Command != `"./my hooks/tag-summaries" --fast` {
+		t.Fatalf("hook=%+v", h)
+	}
+
+	h, err = parseHook("pre:pack=plugin:hooks.so#BeforePack")
+	if err != nil {
+		t.Fatalf("parseHook plugin: %v", err)
+	}
+	if h.Plugin != "hooks.so" || h.Symbol != "BeforePack" || h.String() != "pre:pack=plugin:hooks.so#BeforePack" {
+		t.Fatalf("hook=%+v", h)
+	}
+
+	for _, bad := range []string{"summarize=./x", "during:summarize=./x", "post:=./x", "post:summarize=", "post:pack=plugin:hooks.so"} {
+		if _, err := parseHook(bad); err == nil {
+			t.Fatalf("parseHook(%q) succeeded", bad)
+		}
+	}
+
+	cfg := defaultConfig()
+	cfg.Hooks = []hook{{When: migration.HookPost, Stage: "summarise", Command: "true"}}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("Validate accepted unknown hook stage")
+	}
+}
+
+func TestRunHooks_CommandReceivesEventJSON(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("hook script is a shell script")
+	}
+	// The hook script's path has a space in it; the command line quotes it as a shell would.
+	dir := filepath.Join(t.TempDir(), "my hooks")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "save event.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\ncat > \"$1\"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "event.json")
+	hooks := []hook{
+		{When: migration.HookPost, Stage: "summarize", Command: fmt.Sprintf("%q %q", script, out)},
+		{When: migration.HookPre, Stage: "summarize", Command: "false"},
+	}
+	ev := migration.HookEvent{Stage: "summarize", When: migration.HookPost, OutDir: dir, Items: []string{"a.json"}, Status: migration.RunStatusOK}
+	if err := runHooks(context.Background(), hooks, ev); err != nil {
+		t.Fatalf("runHooks: %v", err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read event: %v", err)
+	}
+	var got migration.HookEvent
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("unmarshal event: %v", err)
+	}
+	if got.Stage != "summarize" || got.When != migration.HookPost || !reflect.DeepEqual(got.Items, []string{"a.json"}) || got.Time == "" {
+		t.Fatalf("event=%+v", got)
+	}
+
+	ev.When = migration.HookPre
+	if err := runHooks(context.Background(), hooks, ev); err == nil {
+		t.Fatalf("failing pre hook returned nil")
+	}
+}
+
+func TestChangedFiles_SkipsReportsAndOldFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.json")
+	if err := os.WriteFile(old, []byte("{}"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(old, past, past); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	since := time.Now()
+	fresh := filepath.Join(dir, "sub", "new.json")
+	if err := os.MkdirAll(filepath.Dir(fresh), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for _, p := range []string{fresh, filepath.Join(dir, migration.RunReportFileName)} {
+		if err := os.WriteFile(p, []byte("{}"), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	got, err := changedFiles(dir, since)
+	if err != nil {
+		t.Fatalf("changedFiles: %v", err)
+	}
+	if !reflect.DeepEqual(got, []string{fresh}) {
+		t.Fatalf("got=%v", got)
+	}
+	if got, err := changedFiles(filepath.Join(dir, "missing"), since); err != nil || len(got) != 0 {
+		t.Fatalf("missing dir: got=%v err=%v", got, err)
+	}
+}
+
+func TestSelectStages_Archive(t *testing.T) {
+	t.Parallel()
+
+	cfg := defaultConfig()
+	if got := selectStages(cfg); !reflect.DeepEqual(got, []string{"split", "chunk", "summarize", "rollup", "pack"}) {
+		t.Fatalf("stages=%v", got)
+	}
+	cfg.Archive = true
+	cfg.FromStage = "pack"
+	if got := selectStages(cfg); !reflect.DeepEqual(got, []string{"pack", "pack-archive"}) {
+		t.Fatalf("stages with -archive=%v", got)
+	}
+	cfg.Archive = false
+	cfg.FromStage = "pack-archive"
+	if got := selectStages(cfg); !reflect.DeepEqual(got, []string{"pack-archive"}) {
+		t.Fatalf("stages from pack-archive=%v", got)
+	}
+	cfg.ArchiveCompression = "xz"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for an unknown archive compression")
+	}
+}
+
+func TestConfig_ValidateGitTag(t *testing.T) {
+	t.Parallel()
+
+	cfg := defaultConfig()
+	cfg.GitCommit, cfg.GitTag = true, "archive/runs"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	for _, tag := range []string{"a b", "a..b", "-a", "a/", "a:b", "a~1"} {
+		c := cfg
+		c.GitTag = tag
+		if err := c.Validate(); err == nil {
+			t.Fatalf("expected error for -git-tag %q", tag)
+		}
+	}
+	c := cfg
+	c.GitCommit = false
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for -git-tag without -git-commit")
+	}
+}
+
+func TestStageCommitMessage_TotalsReports(t *testing.T) {
+	t.Parallel()
+
+	subject, body := stageCommitMessage("pack", []migration.RunReport{
+		{Stage: "pack", Status: migration.RunStatusOK, Total: 3, Processed: 2, Skipped: 1, DurationSec: 1.25},
+		{Stage: "pack", Status: migration.RunStatusFailed, Total: 3, Processed: 1, Failed: 2, InputTokens: 10, OutputTokens: 5, EstimatedUSD: 0.5, Warnings: []string{"w"}},
+	})
+	if want := "archive-pipeline: pack (3 processed, 1 skipped, 2 failed)"; subject != want {
+		t.Fatalf("subject=%q, want %q", subject, want)
+	}
+	for _, line := range []string{"Stage: pack\n", "Status: failed\n", "Reports: 2\n", "Total: 6\n", "Warnings: 1\n", "Input-Tokens: 10\n", "Output-Tokens: 5\n", "Estimated-USD: 0.5000\n", "Duration-Seconds: 1.2\n"} {
+		if !strings.Contains(body, line) {
+			t.Fatalf("body missing %q:\n%s", line, body)
+		}
+	}
+}
+
+func TestGitArchive_CommitsAndTagsStages(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "archive")
+	g, err := openGitArchive(ctx, dir, "archive", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("openGitArchive: %v", err)
+	}
+	for _, kv := range [][2]string{{"user.name", "test"}, {"user.email", "test@example.com"}, {"commit.gpgsign", "false"}, {"tag.gpgsign", "false"}} {
+		if _, err := g.git(ctx, "config", kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "a.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rev, err := g.commitStage(ctx, "split", []migration.RunReport{{Stage: "split", Status: migration.RunStatusOK, Processed: 4}})
+	if err != nil || rev == "" {
+		t.Fatalf("commitStage rev=%q err=%v", rev, err)
+	}
+	if rev, err := g.commitStage(ctx, "chunk", nil); err != nil || rev != "" {
+		t.Fatalf("commitStage with no changes rev=%q err=%v", rev, err)
+	}
+
+	msg, err := g.git(ctx, "log", "-1", "--format=%B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(msg, "archive-pipeline: split (4 processed") || !strings.Contains(msg, "Processed: 4") {
+		t.Fatalf("commit message:\n%s", msg)
+	}
+	tags, err := g.git(ctx, "tag", "--points-at", rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags != "archive/20260102T030405Z/split" {
+		t.Fatalf("tags=%q", tags)
+	}
+}
+
+func TestGitArchive_NestedBaseDirGetsItsOwnRepository(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	ctx := context.Background()
+	outer := t.TempDir()
+	if out, err := exec.Command("git", "-C", outer, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	// The enclosing repository ignores the archive; that must not matter to its own repository.
+	if err := os.WriteFile(filepath.Join(outer, ".gitignore"), []byte("docs/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(outer, "docs", "archive")
+	g, err := openGitArchive(ctx, dir, "archive", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("openGitArchive: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		t.Fatalf("archive repository not created: %v", err)
+	}
+	for _, kv := range [][2]string{{"user.name", "test"}, {"user.email", "test@example.com"}, {"commit.gpgsign", "false"}, {"tag.gpgsign", "false"}} {
+		if _, err := g.git(ctx, "config", kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if rev, err := g.commitStage(ctx, "split", nil); err != nil || rev == "" {
+		t.Fatalf("commitStage rev=%q err=%v", rev, err)
+	}
+
+	if out, err := exec.Command("git", "-C", outer, "rev-parse", "--verify", "-q", "HEAD").Output(); err == nil {
+		t.Fatalf("enclosing repository got a commit: %s", out)
+	}
+	if out, _ := exec.Command("git", "-C", outer, "tag").Output(); len(out) != 0 {
+		t.Fatalf("enclosing repository got tags: %s", out)
+	}
+	if files, err := g.git(ctx, "ls-files"); err != nil || files != "a.json" {
+		t.Fatalf("archive repository files=%q err=%v", files, err)
+	}
+}
+
+func TestFindSplitThread_MatchesConversationID(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for name, id := range map[string]string{
+		"a_b-1111aaaa.json": "a:b",
+		"a_b-2222bbbb.json": "a/b",
+		"a_bc.json":         "a_bc",
+		"plain.json":        "plain",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(`{"conversation_id":"`+id+`"}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id, want := range map[string]string{"a/b": "a_b-2222bbbb", "a:b": "a_b-1111aaaa", "plain": "plain"} {
+		p, err := findSplitThread(dir, id)
+		if err != nil {
+			t.Fatalf("%s: %v", id, err)
+		}
+		if got := splitThreadName(p); got != want {
+			t.Fatalf("%s: name=%q, want %q", id, got, want)
+		}
+	}
+	if _, err := findSplitThread(dir, "a?b"); err == nil {
+		t.Fatal("expected an error for an ID with no split thread")
+	}
+}
@@ -3,29 +3,129 @@ package main
 import (
 	"fmt"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/importers"
 )
 
+// formatChatGPT is the default -format: OpenAI conversations.json exports.
+const formatChatGPT = "chatgpt"
+
 type Config struct {
-	InputPath  string
+	// InputPaths are exports (conversations.json files) or directories of them.
+	InputPaths []string
 	OutputDir  string
 	ArrayField string
 	Pretty     bool
 	Overwrite  bool
+
+	// Format is formatChatGPT or one of importers.Formats.
+	Format string
+	// TimeZone and DateOrder read the timestamps of imported chats (see importers.Options).
+	TimeZone  string
+	DateOrder string
+
+	ToolCalls        bool
+	ToolArgsMaxChars int
+
+	// Stats writes per-conversation stats to <out>/threads_stats.jsonl.
+	Stats bool
+
+	// MaxConversations stops after this many threads are written (0 = all).
+	MaxConversations int
+
+	// IDsPath is a file of conversation IDs, one per line; only those are split.
+	IDsPath string
+
+	// RoleMap is the -role-map value ("human=user,bot=assistant").
+	RoleMap string
+
+	// Memories writes the assistant's saved memories as one more thread (see migration.SplitOptions.Memories).
+	Memories bool
+
+	Durability  string
+	AtomicWrite string
+	// CanonicalJSON writes JSON outputs in canonical form (see fileutils.Canonicalize).
+	CanonicalJSON bool
+
+	// MaxFilesPerDir and MaxOutputBytes set the output quota (see fileutils.Quota).
+	MaxFilesPerDir int
+	MaxOutputBytes int64
 }
 
 func (c Config) Validate() error {
-	if c.InputPath == "" {
+	if len(c.InputPaths) == 0 {
 		return fmt.Errorf("missing -in")
 	}
+	for _, p := range c.InputPaths {
+		if p == "" {
+			return fmt.Errorf("empty -in path")
+		}
+	}
 	if c.OutputDir == "" {
 		return fmt.Errorf("missing -out")
 	}
+	if c.importing() && !slices.Contains(importers.Formats, c.Format) {
+		return fmt.Errorf("unknown -format %q (want %s or %s)", c.Format, formatChatGPT, strings.Join(importers.Formats, ", "))
+	}
+	if c.importing() && c.ArrayField != "" {
+		return fmt.Errorf("-array-field applies to -format %s", formatChatGPT)
+	}
+	if _, err := c.importOptions(); err != nil {
+		return err
+	}
+	if _, err := migration.ParseRoleMap(c.RoleMap); err != nil {
+		return err
+	}
+	if c.ToolArgsMaxChars < 0 {
+		return fmt.Errorf("tool-args-max-chars must be >= 0")
+	}
+	if c.MaxConversations < 0 {
+		return fmt.Errorf("max-conversations must be >= 0")
+	}
+	if _, err := fileutils.ParseDurability(c.Durability); err != nil {
+		return err
+	}
+	if _, err := fileutils.ParseAtomicWrite(c.AtomicWrite); err != nil {
+		return err
+	}
 	return nil
 }
 
+// importing reports whether -in is another platform's export rather than a ChatGPT one.
+func (c Config) importing() bool {
+	return c.Format != "" && c.Format != formatChatGPT
+}
+
+// importOptions reads -timezone and -date-order.
+func (c Config) importOptions() (importers.Options, error) {
+	opts := importers.Options{DateOrder: c.DateOrder}
+	switch c.DateOrder {
+	case "", "dmy", "mdy", "ymd":
+	default:
+		return opts, fmt.Errorf("unknown -date-order %q (want dmy, mdy or ymd)", c.DateOrder)
+	}
+	if c.TimeZone != "" {
+		loc, err := time.LoadLocation(c.TimeZone)
+		if err != nil {
+			return opts, fmt.Errorf("-timezone: %w", err)
+		}
+		opts.Location = loc
+	}
+	return opts, nil
+}
+
 func defaultConfig() Config {
 	return Config{
-		InputPath: filepath.FromSlash("docs/peanut-gallery/conversations.json"),
-		OutputDir: filepath.FromSlash("docs/peanut-gallery/threads"),
+		InputPaths:       []string{filepath.FromSlash("docs/peanut-gallery/conversations.json")},
+		OutputDir:        filepath.FromSlash("docs/peanut-gallery/threads"),
+		Format:           formatChatGPT,
+		ToolArgsMaxChars: migration.DefaultToolArgsMaxChars,
+		Memories:         true,
+		Durability:       fileutils.DurabilityFull,
 	}
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/importers"
+)
+
+var help = cli.Help{
+	Name:    "archive-splitter",
+	Summary: "split a ChatGPT conversations.json export, or import other chat exports, into one JSON file per thread",
+	Groups: []cli.Group{
+		{Title: "Input and output", Flags: []string{"in", "format", "out", "array-field", "ids", "max-conversations", "pretty", "overwrite", "durability", "atomic-write", "canonical-json", "max-files-per-dir", "max-output-bytes"}},
+		{Title: "Imports", Flags: []string{"timezone", "date-order"}},
+		{Title: "Messages", Flags: []string{"role-map", "tool-calls", "tool-args-max-chars", "memories"}},
+		{Title: "Reports", Flags: []string{"stats"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "split one export", Command: "archive-splitter -in docs/peanut-gallery/conversations.json -out docs/peanut-gallery/threads"},
+		{Comment: "merge two exports and write per-thread stats", Command: "archive-splitter -in old/conversations.json -in new/conversations.json -stats"},
+		{Comment: "import WhatsApp chat exports", Command: "archive-splitter -format whatsapp -in whatsapp_exports/ -timezone Europe/Berlin"},
+		{Comment: "import a Telegram Desktop export", Command: "archive-splitter -format telegram -in DataExport_2024-01-01/result.json"},
+		{Comment: "import a mail archive, one thread per email conversation", Command: "archive-splitter -format mbox -in Takeout/Mail/All.mbox"},
+		{Comment: "import an Obsidian vault's notes as journal entries", Command: "archive-splitter -format markdown -in ~/Vault -out docs/journal/threads"},
+		{Comment: "import another platform's group chat", Command: "archive-splitter -in chats.json -array-field conversations -role-map human=user,bot=assistant"},
+	},
+	Values: map[string][]string{"durability": fileutils.DurabilityModes, "atomic-write": fileutils.AtomicWriteModes, "format": append([]string{formatChatGPT}, importers.Formats...), "date-order": {"dmy", "mdy", "ymd"}},
+}
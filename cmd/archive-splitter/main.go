@@ -10,6 +10,9 @@ import (
 	"syscall"
 
 	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/importers"
 )
 
 func main() {
@@ -22,23 +25,114 @@ func main() {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(2)
 	}
+	if err := fileutils.SetDurability(cfg.Durability); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetAtomicWrite(cfg.AtomicWrite); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	fileutils.SetCanonicalJSON(cfg.CanonicalJSON)
+	if err := fileutils.SetQuota(fileutils.Quota{MaxFilesPerDir: cfg.MaxFilesPerDir, MaxBytes: cfg.MaxOutputBytes}); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	res, err := migration.SplitConversationArchive(ctx, cfg.InputPath, cfg.OutputDir, migration.SplitOptions{
+	roleMap, err := migration.ParseRoleMap(cfg.RoleMap)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	var onlyIDs map[string]bool
+	if cfg.IDsPath != "" {
+		if onlyIDs, err = migration.ReadIDFile(cfg.IDsPath); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(2)
+		}
+	}
+
+	report := migration.NewRunReport("archive-splitter", cfg)
+
+	statsPath := ""
+	if cfg.Stats {
+		statsPath = filepath.Join(cfg.OutputDir, migration.ThreadStatsFileName)
+	}
+	opts := migration.SplitOptions{
 		ArrayField:        cfg.ArrayField,
 		OverwriteExisting: cfg.Overwrite,
 		Pretty:            cfg.Pretty,
 		DirMode:           0o755,
 		FileMode:          0o644,
-	})
+		PreserveToolCalls: cfg.ToolCalls,
+		ToolArgsMaxChars:  cfg.ToolArgsMaxChars,
+		StatsPath:         statsPath,
+		RoleMap:           roleMap,
+		MaxConversations:  cfg.MaxConversations,
+		OnlyIDs:           onlyIDs,
+		Memories:          cfg.Memories,
+	}
+	inputs, res, err := split(ctx, cfg, opts)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
 
-	fmt.Fprintf(os.Stdout, "threads_written=%d bytes_written=%d out_dir=%s\n", res.ThreadsWritten, res.BytesWritten, cfg.OutputDir)
+	report.Total = int64(res.ThreadsWritten + res.DuplicatesSkipped)
+	report.Processed = int64(res.ThreadsWritten)
+	report.Skipped = int64(res.DuplicatesSkipped)
+	report.Outputs = map[string]string{"out_dir": cfg.OutputDir}
+	if statsPath != "" {
+		report.Outputs["stats"] = statsPath
+	}
+	if err := fileutils.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if err := migration.WriteRunReport(filepath.Join(cfg.OutputDir, migration.RunReportFileName), report); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stdout, "exports=%d threads_written=%d duplicates_skipped=%d bytes_written=%d out_dir=%s\n", len(inputs), res.ThreadsWritten, res.DuplicatesSkipped, res.BytesWritten, cfg.OutputDir)
+}
+
+// split writes the threads of cfg's inputs: ChatGPT exports are streamed, other formats are imported
+// whole. It returns the input files it read.
+func split(ctx context.Context, cfg Config, opts migration.SplitOptions) ([]string, migration.SplitResult, error) {
+	if !cfg.importing() {
+		inputs, err := migration.CollectExports(cfg.InputPaths)
+		if err != nil {
+			return nil, migration.SplitResult{}, err
+		}
+		res, err := migration.SplitConversationArchives(ctx, inputs, cfg.OutputDir, opts)
+		return inputs, res, err
+	}
+	inputs, err := importers.Collect(cfg.Format, cfg.InputPaths)
+	if err != nil {
+		return nil, migration.SplitResult{}, err
+	}
+	importOpts, err := cfg.importOptions()
+	if err != nil {
+		return nil, migration.SplitResult{}, err
+	}
+	var convs []migration.SimplifiedConversation
+	for _, in := range inputs {
+		if err := ctx.Err(); err != nil {
+			return nil, migration.SplitResult{}, err
+		}
+		imported, err := importers.Import(cfg.Format, in, importOpts)
+		if err != nil {
+			return nil, migration.SplitResult{}, err
+		}
+		convs = append(convs, imported...)
+	}
+	res, err := migration.WriteConversations(cfg.OutputDir, convs, opts)
+	return inputs, res, err
 }
 
 func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
@@ -46,26 +140,46 @@ func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
 
 	// Avoid mutating the global FlagSet if called from tests.
 	fs.SetOutput(os.Stderr)
+	cli.Setup(fs, help)
 
-	fs.StringVar(&cfg.InputPath, "in", cfg.InputPath, "Path to conversations.json (OpenAI export)")
+	inSet := false
+	fs.Func("in", "Path to conversations.json (OpenAI export) or a directory of exports (repeatable; a conversation in several exports is kept from the one with the newest update_time; default "+cfg.InputPaths[0]+")", func(v string) error {
+		if !inSet {
+			cfg.InputPaths, inSet = nil, true
+		}
+		cfg.InputPaths = append(cfg.InputPaths, v)
+		return nil
+	})
+	fs.StringVar(&cfg.Format, "format", cfg.Format, "Export format of -in: chatgpt (conversations.json), whatsapp (a chat's .txt export), telegram (Telegram Desktop's result.json), mbox (an mbox or .eml mail archive), or markdown (dated notes; directories are searched recursively); directories contribute their files with the format's extensions")
+	fs.StringVar(&cfg.TimeZone, "timezone", "", "Time zone of imported chats' timestamps, e.g. Europe/Berlin (default: local time)")
+	fs.StringVar(&cfg.DateOrder, "date-order", "", "Order of numeric dates in imported chats: dmy, mdy or ymd (default: detected from the dates)")
 	fs.StringVar(&cfg.OutputDir, "out", cfg.OutputDir, "Directory to write per-thread JSON files into")
 	fs.BoolVar(&cfg.Pretty, "pretty", false, "Pretty-print each output JSON file (more CPU/memory per thread)")
 	fs.BoolVar(&cfg.Overwrite, "overwrite", false, "Overwrite existing output files")
+	fs.BoolVar(&cfg.ToolCalls, "tool-calls", false, "Keep tool name, truncated arguments, and status as structured tool_call fields on messages")
+	fs.IntVar(&cfg.ToolArgsMaxChars, "tool-args-max-chars", cfg.ToolArgsMaxChars, "Max chars of tool call arguments kept with -tool-calls")
+	fs.IntVar(&cfg.MaxConversations, "max-conversations", 0, "Stop after writing this many threads, e.g. for a pilot run (0 = all)")
+	fs.StringVar(&cfg.IDsPath, "ids", "", "File of conversation IDs, one per line; only those conversations are split (e.g. a pilot sample)")
+	fs.BoolVar(&cfg.Stats, "stats", false, "Also write "+migration.ThreadStatsFileName+" into -out: per-conversation message counts, first/last timestamps, roles, and byte sizes")
+	fs.StringVar(&cfg.RoleMap, "role-map", "", "Rename author roles from other platforms' exports: from=to pairs, comma-separated (e.g. human=user,bot=assistant)")
+	fs.BoolVar(&cfg.Memories, "memories", cfg.Memories, "Also write the assistant's saved memories (model_set_context entries and bio tool calls) as one thread, "+migration.MemoriesConversationID+", so they reach the glossary and memory shards")
 	fs.StringVar(&cfg.ArrayField, "array-field", "", "If top-level JSON is an object, name of field containing conversations array (e.g. conversations)")
-
-	fs.Usage = func() {
-		fmt.Fprintf(fs.Output(), "Usage:\n  %s [flags]\n\nFlags:\n", filepath.Base(os.Args[0]))
-		fs.PrintDefaults()
-		fmt.Fprintln(fs.Output(), "\nExamples:")
-		fmt.Fprintln(fs.Output(), "  go run ./cmd/archive-splitter -pretty -overwrite")
-		fmt.Fprintln(fs.Output(), "  go run ./cmd/archive-splitter -in docs/peanut-gallery/conversations.json -out docs/peanut-gallery/threads")
-	}
+	fs.StringVar(&cfg.Durability, "durability", cfg.Durability, "fsync policy for output files: none, group (sync in batches), or full (sync every file)")
+	fs.StringVar(&cfg.AtomicWrite, "atomic-write", fileutils.AtomicRename, "How finished files replace their targets: rename (atomic), staged (temp files in TMPDIR, kept out of synced folders), or copy (written in place, for shares that refuse rename)")
+	fs.BoolVar(&cfg.CanonicalJSON, "canonical-json", cfg.CanonicalJSON, "Write JSON outputs with sorted keys and stable number formatting so regenerated files diff cleanly")
+	fs.IntVar(&cfg.MaxFilesPerDir, "max-files-per-dir", fileutils.DefaultMaxFilesPerDir, "Stop with an error before any output directory holds more than N files (0 disables)")
+	fs.Int64Var(&cfg.MaxOutputBytes, "max-output-bytes", 0, "Stop with an error before this run writes more than N bytes (0 disables)")
 
 	if err := fs.Parse(args); err != nil {
 		return Config{}, err
 	}
 
-	cfg.InputPath = filepath.Clean(cfg.InputPath)
+	for i, p := range cfg.InputPaths {
+		cfg.InputPaths[i] = filepath.Clean(p)
+	}
 	cfg.OutputDir = filepath.Clean(cfg.OutputDir)
+	if cfg.IDsPath != "" {
+		cfg.IDsPath = filepath.Clean(cfg.IDsPath)
+	}
 	return cfg, nil
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"path/filepath"
 	"testing"
 )
 
@@ -13,8 +14,8 @@ func TestParseFlags_Defaults(t *testing.T) {
 	if err != nil {
 		t.Fatalf("parseFlags: %v", err)
 	}
-	if cfg.InputPath == "" {
-		t.Fatalf("expected default InputPath")
+	if len(cfg.InputPaths) != 1 || cfg.InputPaths[0] == "" {
+		t.Fatalf("expected default InputPaths, got %v", cfg.InputPaths)
 	}
 	if cfg.OutputDir == "" {
 		t.Fatalf("expected default OutputDir")
@@ -31,12 +32,14 @@ func TestParseFlags_Overrides(t *testing.T) {
 		"-pretty",
 		"-overwrite",
 		"-array-field", "conversations",
+		"-stats",
+		"-max-conversations", "5",
 	})
 	if err != nil {
 		t.Fatalf("parseFlags: %v", err)
 	}
-	if cfg.InputPath != "a/b/c.json" {
-		t.Fatalf("InputPath=%q, want %q", cfg.InputPath, "a/b/c.json")
+	if len(cfg.InputPaths) != 1 || cfg.InputPaths[0] != "a/b/c.json" {
+		t.Fatalf("InputPaths=%q, want [a/b/c.json]", cfg.InputPaths)
 	}
 	if cfg.OutputDir != "x/y" {
 		t.Fatalf("OutputDir=%q, want %q", cfg.OutputDir, "x/y")
@@ -50,6 +53,12 @@ func TestParseFlags_Overrides(t *testing.T) {
 	if cfg.ArrayField != "conversations" {
 		t.Fatalf("ArrayField=%q, want %q", cfg.ArrayField, "conversations")
 	}
+	if !cfg.Stats {
+		t.Fatalf("Stats=false, want true")
+	}
+	if cfg.MaxConversations != 5 {
+		t.Fatalf("MaxConversations=%d, want 5", cfg.MaxConversations)
+	}
 }
 
 func TestConfig_Validate(t *testing.T) {
@@ -58,10 +67,50 @@ func TestConfig_Validate(t *testing.T) {
 	if err := (Config{}).Validate(); err == nil {
 		t.Fatalf("expected error for empty config")
 	}
-	if err := (Config{InputPath: "in.json"}).Validate(); err == nil {
+	if err := (Config{InputPaths: []string{"in.json"}}).Validate(); err == nil {
 		t.Fatalf("expected error for missing OutputDir")
 	}
-	if err := (Config{InputPath: "in.json", OutputDir: "out"}).Validate(); err != nil {
+	if err := (Config{InputPaths: []string{"in.json"}, OutputDir: "out"}).Validate(); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestParseFlags_RepeatedIn(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("archive-splitter", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-in", "a/2024.json", "-in", "exports/"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if len(cfg.InputPaths) != 2 || cfg.InputPaths[0] != filepath.FromSlash("a/2024.json") || cfg.InputPaths[1] != "exports" {
+		t.Fatalf("InputPaths=%q", cfg.InputPaths)
+	}
+}
+
+func TestParseFlags_ImportFormat(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("archive-splitter", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-format", "whatsapp", "-in", "chats/", "-timezone", "UTC", "-date-order", "dmy"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if opts, err := cfg.importOptions(); err != nil || opts.Location.String() != "UTC" || opts.DateOrder != "dmy" {
+		t.Fatalf("importOptions=%+v, %v", opts, err)
+	}
+
+	for _, bad := range []Config{
+		{InputPaths: []string{"a"}, OutputDir: "out", Format: "icq"},
+		{InputPaths: []string{"a"}, OutputDir: "out", Format: "whatsapp", ArrayField: "conversations"},
+		{InputPaths: []string{"a"}, OutputDir: "out", Format: "whatsapp", TimeZone: "Nowhere/Nope"},
+		{InputPaths: []string{"a"}, OutputDir: "out", Format: "whatsapp", DateOrder: "dym"},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Fatalf("expected an error for %+v", bad)
+		}
+	}
+}
@@ -3,6 +3,25 @@ package main
 import (
 	"errors"
 	"path/filepath"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
+)
+
+const backfillSentiment = "sentiment"
+
+// Summary providers.
+const (
+	providerOpenAI     = "openai"
+	providerExtractive = "extractive"
+)
+
+// Index modes.
+const (
+	indexModeRebuild = "rebuild"
+	indexModeAppend  = "append"
 )
 
 type Config struct {
@@ -11,25 +30,108 @@ type Config struct {
 	Model               string
 	SentimentModel      string
 	SentimentPromptFile string
-	Pretty              bool
-	Overwrite           bool
-	APIKey              string
-	IndexPath           string
-	SentimentIndexPath  string
-	GlossaryPath        string
-	GlossaryMaxTerms    int
-	GlossaryMinCount    int
-	MaxChunks           int
+	// SourcePromptDir holds per-source prompt headers (see buildSourceInstructions).
+	SourcePromptDir    string
+	Pretty             bool
+	Overwrite          bool
+	APIKey             string
+	IndexPath          string
+	SentimentIndexPath string
+	GlossaryPath       string
+	GlossaryMaxTerms   int
+	GlossaryMinCount   int
+	MaxChunks          int
+
+	// Provider is providerOpenAI or providerExtractive (rough local summaries, no API calls, no
+	// sentiment pass).
+	Provider string
+
+	// Threads limits the run to chunks in these thread directories (conversation IDs); empty means all.
+	Threads []string
 
 	Resume  bool
 	Reindex bool
+	Rescan  bool
+
+	// IndexMode is indexModeRebuild (rewrite the indices from every summary at the end of the run) or
+	// indexModeAppend (append rows for the chunks each batch summarized, so large archives skip the walk).
+	IndexMode string
+
+	// ReindexWorkers is how many goroutines read summary files during an index rebuild.
+	ReindexWorkers int
+
+	// Backfill runs only one summary pass over chunks that already have the other. "sentiment" fills in
+	// sentiment summaries for archives summarized before the sentiment pass existed.
+	Backfill string
+
+	RefreshOlderThan     time.Duration
+	RefreshModelMismatch bool
+
+	MaxUSD         float64
+	MaxTokensTotal int64
+	BudgetLedger   string
+
+	// Strict fails the run when any chunk is unreadable instead of recording it and continuing.
+	Strict       bool
+	FailuresPath string
 
 	Concurrency int
 	BatchSize   int
+	Schedule    string
+	// QPS caps model request attempts per second across all workers (see provider.SetQPS); 0 disables.
+	QPS float64
 
 	IndexSummaryMaxChars int
 	IndexTagsMax         int
 	IndexTermsMax        int
+	// LowercaseTags lowercases summary tags as they are normalized (see migration.NormalizeTags).
+	LowercaseTags bool
+	// SentimentIndexFields is the optional sentiment fields kept in sentiment index rows (nil = all).
+	SentimentIndexFields migration.SentimentIndexFieldSet
+
+	// TranscriptFormat and SentimentTranscriptFormat pick how chunk messages are framed in each stage's
+	// prompt; different models summarize better with different input framing.
+	TranscriptFormat          string
+	SentimentTranscriptFormat string
+
+	// SentimentEvidence asks the sentiment pass for a confidence per listed emotion and the turn range
+	// behind each emotional tension (migration.SentimentEvidence). Off by default: it changes the request.
+	SentimentEvidence bool
+
+	// TurnSentiment selects chunks (by message date) that also get per-turn affect classification
+	// with TurnSentimentModel (default SentimentModel), written to *.turns.sentiment.json.
+	TurnSentiment      migration.DateRanges
+	TurnSentimentModel string
+
+	// StylePath is the -style profile appended to both summary prompts (see migration.StyleProfile).
+	StylePath string
+	// OutputLanguage is the language model output is written in (see migration.StyleProfile.Language).
+	OutputLanguage string
+
+	// TermsModel, when set, runs a terms-only pass with this (cheap) model over every chunk before the
+	// summary passes, so the glossary is complete from the first summary; summaries then leave the
+	// glossary alone. TermsOnly stops after that pass.
+	TermsModel string
+	TermsOnly  bool
+
+	// PromptBudget is a -prompt-budget spec (see provider.ParsePromptBudget) capping prompt input
+	// tokens per model; empty uses provider.DefaultInputTokens.
+	PromptBudget string
+
+	Durability  string
+	AtomicWrite string
+	// CanonicalJSON writes JSON outputs in canonical form (see fileutils.Canonicalize).
+	CanonicalJSON bool
+
+	// MaxFilesPerDir and MaxOutputBytes set the output quota (see fileutils.Quota).
+	MaxFilesPerDir int
+	MaxOutputBytes int64
+
+	// StructuredOutput is how schema-constrained output is requested (see provider.SetStructuredOutput).
+	StructuredOutput string
+
+	// Chaos is a -chaos spec (see provider.ParseChaos) injecting provider failures; empty disables.
+	Chaos string
 }
 
 func (c Config) Validate() error {
@@ -39,6 +141,21 @@ func (c Config) Validate() error {
 	if c.OutDir == "" {
 		return errors.New("missing -out")
 	}
+	if c.Provider != providerOpenAI && c.Provider != providerExtractive {
+		return errors.New("provider must be openai or extractive")
+	}
+	if c.Provider == providerExtractive && c.Backfill != "" {
+		return errors.New("-backfill needs -provider openai")
+	}
+	if c.Provider == providerExtractive && c.TermsModel != "" {
+		return errors.New("-terms-model needs -provider openai")
+	}
+	if c.Provider == providerExtractive && len(c.TurnSentiment) > 0 {
+		return errors.New("-turn-sentiment needs -provider openai")
+	}
+	if c.TermsOnly && c.TermsModel == "" {
+		return errors.New("-terms-only needs -terms-model")
+	}
 	if c.Model == "" {
 		return errors.New("missing -model")
 	}
@@ -57,29 +174,78 @@ func (c Config) Validate() error {
 	if c.Concurrency < 0 {
 		return errors.New("concurrency must be >= 0")
 	}
+	if c.QPS < 0 {
+		return errors.New("qps must be >= 0")
+	}
 	if c.BatchSize < 0 {
 		return errors.New("batch-size must be >= 0")
 	}
+	if c.Schedule != "path" && c.Schedule != "thread" {
+		return errors.New("schedule must be path or thread")
+	}
+	if c.Backfill != "" && c.Backfill != backfillSentiment {
+		return errors.New("backfill must be sentiment (or empty)")
+	}
+	if c.Backfill != "" && (c.Overwrite || c.Rescan || c.refreshPolicy().Enabled()) {
+		return errors.New("-backfill cannot be combined with -overwrite, -rescan, or -refresh-*")
+	}
+	if c.ReindexWorkers < 1 {
+		return errors.New("reindex-workers must be >= 1")
+	}
+	if c.IndexMode != indexModeRebuild && c.IndexMode != indexModeAppend {
+		return errors.New("index-mode must be rebuild or append")
+	}
 	if c.IndexSummaryMaxChars < 0 || c.IndexTagsMax < 0 || c.IndexTermsMax < 0 {
 		return errors.New("index limits must be >= 0")
 	}
+	if !validTranscriptFormat(c.TranscriptFormat) || !validTranscriptFormat(c.SentimentTranscriptFormat) {
+		return errors.New("transcript-format must be compact, markdown, role-grouped, or tool-collapsed")
+	}
+	if _, err := provider.ParsePromptBudget(c.PromptBudget); err != nil {
+		return err
+	}
+	if c.MaxUSD < 0 || c.MaxTokensTotal < 0 {
+		return errors.New("max-usd/max-tokens-total must be >= 0")
+	}
+	if _, err := fileutils.ParseDurability(c.Durability); err != nil {
+		return err
+	}
+	if _, err := fileutils.ParseAtomicWrite(c.AtomicWrite); err != nil {
+		return err
+	}
+	if _, err := provider.ParseStructuredOutput(c.StructuredOutput); err != nil {
+		return err
+	}
+	if _, err := provider.ParseChaos(c.Chaos); err != nil {
+		return err
+	}
 	return nil
 }
 
+func (c Config) refreshPolicy() migration.RefreshPolicy {
+	return migration.RefreshPolicy{OlderThan: c.RefreshOlderThan, ModelMismatch: c.RefreshModelMismatch}
+}
+
 func defaultConfig() Config {
 	return Config{
 		InPath:               filepath.FromSlash("docs/peanut-gallery/threads/chunks"),
 		OutDir:               filepath.FromSlash("docs/peanut-gallery/threads/summaries"),
+		Provider:             providerOpenAI,
 		Model:                "gpt-5-mini",
 		SentimentModel:       "",
 		GlossaryMaxTerms:     60,
 		GlossaryMinCount:     2,
 		Resume:               true,
 		Reindex:              true,
+		IndexMode:            indexModeRebuild,
+		ReindexWorkers:       8,
 		Concurrency:          6,
 		BatchSize:            25,
+		Schedule:             "path",
 		IndexSummaryMaxChars: 600,
 		IndexTagsMax:         5,
 		IndexTermsMax:        15,
+		TranscriptFormat:     transcriptCompact,
+		Durability:           fileutils.DurabilityFull,
 	}
 }
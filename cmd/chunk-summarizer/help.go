@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
+)
+
+var help = cli.Help{
+	Name:    "chunk-summarizer",
+	Summary: "write semantic and sentiment summaries for each chunk, plus the chunk indices and glossary",
+	Groups: []cli.Group{
+		{Title: "Input and output", Flags: []string{"in", "out", "threads", "max-chunks", "pretty", "overwrite", "durability", "atomic-write", "canonical-json", "max-files-per-dir", "max-output-bytes"}},
+		{Title: "Model and prompts", Flags: []string{"provider", "model", "sentiment-model", "sentiment-prompt-file", "source-prompts", "style", "output-language", "transcript-format", "sentiment-transcript-format", "lowercase-tags", "sentiment-evidence", "turn-sentiment", "turn-sentiment-model", "prompt-budget", "api-key", "structured-output"}},
+		{Title: "Reruns", Flags: []string{"resume", "rescan", "refresh-older-than", "refresh-model-mismatch", "backfill", "strict", "failures"}},
+		{Title: "Glossary", Flags: []string{"glossary", "glossary-max-terms", "glossary-min-count", "terms-model", "terms-only"}},
+		{Title: "Indices", Flags: []string{"index", "sentiment-index", "index-mode", "reindex", "reindex-workers", "index-summary-max-chars", "index-tags-max", "index-terms-max", "sentiment-index-fields"}},
+		{Title: "Throughput", Flags: []string{"concurrency", "qps", "batch-size", "schedule"}},
+		{Title: "Spend caps", Flags: []string{"max-usd", "max-tokens-total", "budget-ledger"}},
+		{Title: "Testing", Flags: []string{"chaos"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "summarize every chunk", Command: "chunk-summarizer -in docs/peanut-gallery/threads/chunks -out docs/peanut-gallery/threads/summaries -model gpt-5-mini"},
+		{Comment: "continue an interrupted run and rebuild the indices", Command: "chunk-summarizer -resume -reindex"},
+		{Comment: "free offline baseline summaries, then replace them with model summaries later", Command: "chunk-summarizer -provider extractive\n  chunk-summarizer -refresh-model-mismatch"},
+		{Comment: "add sentiment summaries to chunks that only have semantic ones", Command: "chunk-summarizer -backfill sentiment"},
+		{Comment: "build the glossary with a cheap model first, then summarize with it from the first chunk", Command: "chunk-summarizer -terms-model gpt-5-nano -model gpt-5"},
+	},
+	Values: map[string][]string{
+		"provider":                    {providerOpenAI, providerExtractive},
+		"transcript-format":           {transcriptCompact, transcriptMarkdown, transcriptRoleGrouped, transcriptToolCollapsed},
+		"sentiment-transcript-format": {transcriptCompact, transcriptMarkdown, transcriptRoleGrouped, transcriptToolCollapsed},
+		"index-mode":                  {indexModeRebuild, indexModeAppend},
+		"schedule":                    {"path", "thread"},
+		"backfill":                    {backfillSentiment},
+		"durability":                  fileutils.DurabilityModes,
+		"atomic-write":                fileutils.AtomicWriteModes,
+		"structured-output":           provider.StructuredOutputModes,
+	},
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
@@ -12,6 +11,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -19,10 +19,11 @@ import (
 	"time"
 
 	"github.com/openai/openai-go"
-	"github.com/openai/openai-go/option"
 	"github.com/openai/openai-go/responses"
 	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
 	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
 	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
 )
 
@@ -36,12 +37,34 @@ func main() {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(2)
 	}
+	if err := layout.LoadConventionsFromEnv(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetDurability(cfg.Durability); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetAtomicWrite(cfg.AtomicWrite); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	fileutils.SetCanonicalJSON(cfg.CanonicalJSON)
+	if err := fileutils.SetQuota(fileutils.Quota{MaxFilesPerDir: cfg.MaxFilesPerDir, MaxBytes: cfg.MaxOutputBytes}); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	provider.SetQPS(cfg.QPS)
+	if err := provider.SetStructuredOutput(cfg.StructuredOutput); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
 
 	apiKey := cfg.APIKey
 	if apiKey == "" {
 		apiKey = os.Getenv("OPENAI_API_KEY")
 	}
-	if apiKey == "" {
+	if apiKey == "" && cfg.Provider == providerOpenAI {
 		fmt.Fprintln(os.Stderr, "missing OPENAI_API_KEY (or pass -api-key)")
 		os.Exit(2)
 	}
@@ -59,14 +82,32 @@ func main() {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(2)
 	}
+	if len(cfg.Threads) > 0 {
+		chunkFiles = filterChunkFilesByThread(chunkFiles, cfg.Threads)
+	}
 	if len(chunkFiles) == 0 {
 		fmt.Fprintln(os.Stderr, "no chunk .json files found")
 		os.Exit(2)
 	}
+	if cfg.Schedule == "thread" {
+		chunkFiles = orderChunkFilesByThread(chunkFiles)
+	}
 	if cfg.MaxChunks > 0 && len(chunkFiles) > cfg.MaxChunks {
 		chunkFiles = chunkFiles[:cfg.MaxChunks]
 	}
 
+	if cfg.Backfill == backfillSentiment {
+		total := len(chunkFiles)
+		chunkFiles = sentimentBackfillCandidates(cfg, chunkFiles)
+		fmt.Fprintf(os.Stderr, "backfill sentiment: %d of %d chunk(s) have a semantic summary but no sentiment summary\n", len(chunkFiles), total)
+	}
+
+	var regen map[string]bool
+	if cfg.Rescan || cfg.refreshPolicy().Enabled() {
+		regen = scanChunkArtifacts(cfg, chunkFiles)
+		fmt.Fprintf(os.Stderr, "rescan chunk-summarizer: %d chunk(s) queued for regeneration\n", len(regen))
+	}
+
 	start := time.Now()
 	totalChunks := int64(len(chunkFiles))
 
@@ -89,7 +130,13 @@ func main() {
 		os.Exit(2)
 	}
 
-	sentimentHeader := defaultSentimentPromptHeader
+	journal, err := recoverJournal(cfg, &glossary, glossaryPath, indexPath, sentimentIndexPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	var sentimentHeader string
 	if cfg.SentimentPromptFile != "" {
 		h, err := loadPromptHeaderFromFile(cfg.SentimentPromptFile)
 		if err != nil {
@@ -98,15 +145,53 @@ func main() {
 		}
 		sentimentHeader = h
 	}
-	sentimentInstructions := composeSentimentInstructions(sentimentHeader)
+	style, err := migration.LoadStyleProfile(cfg.StylePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	style = style.WithLanguage(cfg.OutputLanguage)
+	instructions, err := buildSourceInstructions(cfg.SourcePromptDir, sentimentHeader, style)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	budget, err := provider.NewBudget(cfg.MaxUSD, cfg.MaxTokensTotal, cfg.BudgetLedger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
 
-	client := openai.NewClient(option.WithAPIKey(apiKey))
-	summarizer := openAISummarizer{
-		client:                &client,
-		model:                 cfg.Model,
-		sentimentModel:        cfg.SentimentModel,
-		sentimentInstructions: sentimentInstructions,
+	var summarizer chunkSummarizer = extractiveSummarizer{}
+	var terms termsExtractor
+	var turns turnClassifier
+	chaos, _ := provider.ParseChaos(cfg.Chaos)
+	prompts, _ := provider.ParsePromptBudget(cfg.PromptBudget)
+	if cfg.Provider == providerOpenAI {
+		client := provider.NewClient(apiKey, chaos)
+		if cfg.TermsModel != "" {
+			terms = openAITermsExtractor{client: &client, budget: budget, model: cfg.TermsModel, prompts: prompts, language: cfg.OutputLanguage}
+		}
+		if len(cfg.TurnSentiment) > 0 {
+			model := cfg.TurnSentimentModel
+			if model == "" {
+				model = cfg.SentimentModel
+			}
+			turns = openAITurnClassifier{client: &client, budget: budget, model: model, prompts: prompts, language: cfg.OutputLanguage}
+		}
+		summarizer = openAISummarizer{
+			client:         &client,
+			budget:         budget,
+			model:          cfg.Model,
+			sentimentModel: cfg.SentimentModel,
+			instructions:   instructions,
+			prompts:        prompts,
+			evidence:       cfg.SentimentEvidence,
+		}
 	}
+	// The extractive provider writes no sentiment summaries, so a chunk is done once it has a semantic one.
+	extractive := cfg.Provider == providerExtractive
 
 	if cfg.BatchSize == 0 {
 		cfg.BatchSize = len(chunkFiles)
@@ -115,92 +200,227 @@ func main() {
 		cfg.Concurrency = 1
 	}
 
-	type glossaryUpdate struct {
-		additions []migration.GlossaryAddition
-		seenAt    *float64
+	failuresPath := cfg.FailuresPath
+	if failuresPath == "" {
+		failuresPath = filepath.Join(cfg.OutDir, "failures.jsonl")
+	}
+	var failures []migration.FailureRecord
+
+	reportCfg := cfg
+	reportCfg.APIKey = ""
+	report := migration.NewRunReport("chunk-summarizer", reportCfg)
+	report.Total = int64(len(chunkFiles))
+
+	var processed, skipped int64
+	budgetExhausted := false
+	writeReport := func(status string) {
+		session := budget.SessionSpend()
+		report.Status = status
+		report.Processed = atomic.LoadInt64(&processed)
+		report.Skipped = atomic.LoadInt64(&skipped)
+		report.Failed = int64(len(failures))
+		report.InputTokens, report.OutputTokens, report.EstimatedUSD = session.InputTokens, session.OutputTokens, session.USD
+		report.Outputs = map[string]string{"out_dir": cfg.OutDir, "index": indexPath, "sentiment_index": sentimentIndexPath, "key_points": filepath.Join(filepath.Dir(indexPath), migration.KeyPointsFileName), "glossary": glossaryPath}
+		if len(failures) > 0 {
+			report.Outputs["failures"] = failuresPath
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%d chunk(s) failed", len(failures)))
+		}
+		if err := migration.WriteRunReport(filepath.Join(cfg.OutDir, migration.RunReportFileName), report); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
 	}
 
-	var processed int64
-	for bstart := 0; bstart < len(chunkFiles); bstart += cfg.BatchSize {
-		bend := bstart + cfg.BatchSize
+	if terms != nil {
+		stats, err := runTermsPass(ctx, cfg, terms, budget, chunkFiles, &glossary, glossaryPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "terms pass: extracted=%d already_done=%d failed=%d glossary_terms=%d model=%s\n",
+			stats.Extracted, stats.Skipped, stats.Failed, len(glossary.Entries), cfg.TermsModel)
+		if stats.Failed > 0 {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("terms pass: %d chunk(s) failed; rerun to retry them", stats.Failed))
+		}
+		if stats.BudgetExhausted {
+			writeReport(migration.RunStatusBudgetExhausted)
+			spend := budget.Spend()
+			fmt.Fprintf(os.Stderr, "budget exhausted during the terms pass: tokens_total=%d estimated_usd=%.4f; rerun to continue\n", spend.TotalTokens(), spend.USD)
+			os.Exit(provider.ExitBudgetExhausted)
+		}
+		// Cull now rather than at the end so every summary prompt sees the final glossary.
+		if cfg.GlossaryMinCount > 1 && stats.Failed == 0 {
+			migration.CullGlossary(&glossary, cfg.GlossaryMinCount)
+			if err := migration.SaveGlossary(glossaryPath, glossary); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+		}
+		if cfg.TermsOnly {
+			report.Total = int64(stats.Extracted + stats.Skipped + stats.Failed)
+			atomic.StoreInt64(&processed, int64(stats.Extracted))
+			atomic.StoreInt64(&skipped, int64(stats.Skipped))
+			writeReport(migration.RunStatusOK)
+			if err := fileutils.Flush(); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+			if err := journal.Close(); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+			}
+			spend := budget.Spend()
+			fmt.Fprintf(os.Stdout, "terms_extracted=%d terms_failed=%d glossary_terms=%d tokens_total=%d estimated_usd=%.4f glossary=%s\n", stats.Extracted, stats.Failed, len(glossary.Entries), spend.TotalTokens(), spend.USD, glossaryPath)
+			return
+		}
+	}
+	for bstart, bend := 0, 0; bstart < len(chunkFiles); bstart = bend {
+		bend = bstart + cfg.BatchSize
 		if bend > len(chunkFiles) {
 			bend = len(chunkFiles)
 		}
+		if cfg.Schedule == "thread" {
+			// Never split a thread across batches so each batch leaves only complete threads behind.
+			for bend < len(chunkFiles) && filepath.Dir(chunkFiles[bend]) == filepath.Dir(chunkFiles[bend-1]) {
+				bend++
+			}
+		}
 		batch := chunkFiles[bstart:bend]
-		glossaryExcerpt := glossaryForPrompt(glossary, cfg.GlossaryMaxTerms)
+		glossaryExcerpt, glossaryRef, err := snapshotPromptGlossary(cfg.OutDir, glossary, cfg.GlossaryMaxTerms)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
 
-		sem := make(chan struct{}, cfg.Concurrency)
 		errCh := make(chan error, len(batch))
 		updatesCh := make(chan glossaryUpdate, len(batch))
+		failuresCh := make(chan migration.FailureRecord, len(batch))
+		committedCh := make(chan string, len(batch))
+
+		processChunk := func(chunkPath string) {
+			select {
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			default:
+			}
 
-		wg := sync.WaitGroup{}
-		for _, chunkPath := range batch {
-			wg.Add(1)
-			go func(chunkPath string) {
-				defer wg.Done()
-				sem <- struct{}{}
-				defer func() { <-sem }()
-
-				select {
-				case <-ctx.Done():
-					errCh <- ctx.Err()
-					return
-				default:
-				}
+			semanticOut := semanticSummaryOutPath(cfg.InPath, cfg.OutDir, chunkPath)
+			sentOut := sentimentSummaryOutPath(cfg.InPath, cfg.OutDir, chunkPath)
+			overwrite := cfg.Overwrite || regen[chunkPath]
+			if cfg.Resume && !regen[chunkPath] && fileutils.FileExists(semanticOut) && (extractive || fileutils.FileExists(sentOut)) {
+				atomic.AddInt64(&skipped, 1)
+				return
+			}
+			// Artifacts a person edited or approved in review-ui are never regenerated.
+			// A sentiment backfill treats the existing semantic summary as locked.
+			semLocked := cfg.Backfill == backfillSentiment || overwrite && migration.IsHumanEdited(semanticOut)
+			sentLocked := extractive || overwrite && migration.IsHumanEdited(sentOut)
+			if semLocked && sentLocked {
+				atomic.AddInt64(&skipped, 1)
+				return
+			}
 
-				semanticOut := semanticSummaryOutPath(cfg.InPath, cfg.OutDir, chunkPath)
-				sentOut := sentimentSummaryOutPath(cfg.InPath, cfg.OutDir, chunkPath)
-				if cfg.Resume && fileutils.FileExists(semanticOut) && fileutils.FileExists(sentOut) {
-					return
-				}
+			chunk, err := readChunkFile(chunkPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: skipping unreadable chunk %s: %v\n", chunkPath, err)
+				failuresCh <- migration.NewFailureRecord("chunk-summarizer", chunkPath, err)
+				return
+			}
 
-				chunk, err := readChunkFile(chunkPath)
-				if err != nil {
-					return
-				}
+			// Only files this chunk will actually create or replace are journaled, so a rollback never
+			// removes a summary a resumed run already kept.
+			var writes []string
+			if !semLocked && (overwrite || !fileutils.FileExists(semanticOut)) {
+				writes = append(writes, semanticOut)
+			}
+			if !sentLocked && (overwrite || !fileutils.FileExists(sentOut)) {
+				writes = append(writes, sentOut)
+			}
+			if err := journal.Begin(chunkPath, writes); err != nil {
+				errCh <- err
+				return
+			}
 
-				sumResp, err := summarizer.SummarizeChunkWithOptions(ctx, chunk, glossaryExcerpt, promptOptions{MaxTranscriptChars: 80_000, IncludeToolText: true})
+			var sumResp summarizeResponse
+			if !semLocked {
+				var semCalls provider.CallLog
+				semCtx := provider.WithCallLog(ctx, &semCalls)
+				sumResp, err = summarizer.SummarizeChunkWithOptions(semCtx, chunk, glossaryExcerpt, promptOptions{IncludeToolText: true, Format: cfg.TranscriptFormat})
 				if err != nil {
-					sumResp, err = summarizer.SummarizeChunkWithOptions(ctx, chunk, glossaryExcerpt, promptOptions{MaxTranscriptChars: 40_000, IncludeToolText: false})
+					sumResp, err = summarizer.SummarizeChunkWithOptions(semCtx, chunk, glossaryExcerpt, promptOptions{Shrink: true, IncludeToolText: false, Format: cfg.TranscriptFormat})
 					if err != nil {
 						errCh <- fmt.Errorf("semantic summarize %s: %w", chunkPath, err)
 						return
 					}
 				}
 
-				sentResp, err := summarizer.SummarizeChunkSentimentWithOptions(ctx, chunk, glossaryExcerpt, promptOptions{MaxTranscriptChars: 80_000, IncludeToolText: true})
-				if err != nil {
-					sentResp, err = summarizer.SummarizeChunkSentimentWithOptions(ctx, chunk, glossaryExcerpt, promptOptions{MaxTranscriptChars: 40_000, IncludeToolText: false})
-					if err != nil {
-						errCh <- fmt.Errorf("sentiment summarize %s: %w", chunkPath, err)
-						return
-					}
-				}
-
 				semantic := migration.ChunkSummary{
 					ConversationID: chunk.ConversationID,
 					ThreadStart:    chunk.ThreadStart,
+					ThreadUpdate:   chunk.ThreadUpdate,
 					ChunkNumber:    chunk.ChunkNumber,
 					TurnStart:      chunk.TurnStart,
 					TurnEnd:        chunk.TurnEnd,
+					Project:        chunk.Project,
+					SourceType:     chunk.SourceType,
+					OriginalTitle:  chunk.Title,
 					Summary:        sumResp.Summary,
 					KeyPoints:      sumResp.KeyPoints,
 					Tags:           sumResp.Tags,
 					Terms:          sumResp.Terms,
+					SourceTokens:   migration.ChunkSourceTokens(chunk),
+					Tiny:           chunk.Tiny,
+					Model:          cfg.Model,
+				}
+				if !extractive {
+					semantic.Style = style
 				}
-				if _, err := writeSummaryFile(cfg.InPath, cfg.OutDir, chunkPath, semantic, cfg.Pretty, cfg.Overwrite); err != nil {
+				semantic.NormalizeTags(cfg.LowercaseTags)
+				if outPath, err := writeSummaryFile(cfg.InPath, cfg.OutDir, chunkPath, semantic, cfg.Pretty, overwrite); err != nil {
 					if !(cfg.Resume && strings.Contains(err.Error(), "already exists")) {
 						errCh <- err
 						return
 					}
+				} else if err := provider.WriteMetaWithGlossary(outPath, semCalls.Records(), glossaryRef); err != nil {
+					errCh <- err
+					return
+				}
+			}
+
+			if !sentLocked {
+				var sentCalls provider.CallLog
+				sentCtx := provider.WithCallLog(ctx, &sentCalls)
+				sentResp, err := summarizer.SummarizeChunkSentimentWithOptions(sentCtx, chunk, glossaryExcerpt, promptOptions{IncludeToolText: true, Format: cfg.SentimentTranscriptFormat})
+				if err != nil {
+					sentResp, err = summarizer.SummarizeChunkSentimentWithOptions(sentCtx, chunk, glossaryExcerpt, promptOptions{Shrink: true, IncludeToolText: false, Format: cfg.SentimentTranscriptFormat})
+					if err != nil {
+						errCh <- fmt.Errorf("sentiment summarize %s: %w", chunkPath, err)
+						return
+					}
+				}
+
+				var turnAgg *migration.TurnSentimentAggregate
+				if turns != nil && cfg.TurnSentiment.MatchChunk(chunk) {
+					ts, err := turns.ClassifyTurns(sentCtx, chunk)
+					if err != nil {
+						errCh <- fmt.Errorf("turn sentiment %s: %w", chunkPath, err)
+						return
+					}
+					if turnAgg, err = writeTurnSentimentFile(cfg.InPath, cfg.OutDir, chunkPath, ts, cfg.Pretty); err != nil {
+						errCh <- err
+						return
+					}
 				}
 
 				sentiment := migrationChunkSentimentSummary{
 					ConversationID:     chunk.ConversationID,
 					ThreadStart:        chunk.ThreadStart,
+					ThreadUpdate:       chunk.ThreadUpdate,
 					ChunkNumber:        chunk.ChunkNumber,
 					TurnStart:          chunk.TurnStart,
 					TurnEnd:            chunk.TurnEnd,
+					Project:            chunk.Project,
+					SourceType:         chunk.SourceType,
+					OriginalTitle:      chunk.Title,
 					EmotionalSummary:   sentResp.EmotionalSummary,
 					DominantEmotions:   sentResp.DominantEmotions,
 					RememberedEmotions: sentResp.RememberedEmotions,
@@ -212,29 +432,83 @@ func main() {
 					SymbolsOrMetaphors: sentResp.SymbolsOrMetaphors,
 					ResonanceNotes:     sentResp.ResonanceNotes,
 					ToneMarkers:        sentResp.ToneMarkers,
+					SentimentEvidence:  sentResp.Evidence,
+					TurnSentiment:      turnAgg,
+					Tiny:               chunk.Tiny,
+					Model:              cfg.SentimentModel,
+					Style:              style,
 				}
-				if _, err := writeSentimentSummaryFile(cfg.InPath, cfg.OutDir, chunkPath, sentiment, cfg.Pretty, cfg.Overwrite); err != nil {
+				if outPath, err := writeSentimentSummaryFile(cfg.InPath, cfg.OutDir, chunkPath, sentiment, cfg.Pretty, overwrite); err != nil {
 					if !(cfg.Resume && strings.Contains(err.Error(), "already exists")) {
 						errCh <- err
 						return
 					}
+				} else if err := provider.WriteMetaWithGlossary(outPath, sentCalls.Records(), glossaryRef); err != nil {
+					errCh <- err
+					return
 				}
+			}
 
-				additions := append([]migration.GlossaryAddition(nil), sumResp.GlossaryAdditions...)
-				for _, t := range sumResp.Terms {
-					additions = append(additions, migration.GlossaryAddition{Term: t})
-				}
-				updatesCh <- glossaryUpdate{additions: additions, seenAt: chunk.ThreadStart}
+			additions := append([]migration.GlossaryAddition(nil), sumResp.GlossaryAdditions...)
+			for _, t := range sumResp.Terms {
+				additions = append(additions, migration.GlossaryAddition{Term: t})
+			}
+			update := glossaryUpdate{Additions: additions, SeenAt: chunk.ThreadStart}
+			if terms != nil {
+				// The terms pass already counted this chunk's terms.
+				update = glossaryUpdate{}
+			}
+			if err := journal.Commit(chunkPath, update); err != nil {
+				errCh <- err
+				return
+			}
+			updatesCh <- update
+			committedCh <- chunkPath
 
-				n := atomic.AddInt64(&processed, 1)
-				fmt.Fprintf(os.Stderr, "progress chunk-summarizer: %d/%d chunks summarized (last=%s elapsed=%s)\n",
-					n, totalChunks, filepath.Base(chunkPath), time.Since(start).Round(time.Second))
-			}(chunkPath)
+			n := atomic.AddInt64(&processed, 1)
+			fmt.Fprintf(os.Stderr, "progress chunk-summarizer: %d/%d chunks summarized (last=%s elapsed=%s)\n",
+				n, totalChunks, filepath.Base(chunkPath), time.Since(start).Round(time.Second))
 		}
 
+		// Workers pull from an unbuffered queue fed in schedule order, so chunks start in the
+		// order they were scheduled and the feeder blocks while all workers are busy.
+		jobs := make(chan string)
+		wg := sync.WaitGroup{}
+		for w := 0; w < cfg.Concurrency; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for chunkPath := range jobs {
+					processChunk(chunkPath)
+				}
+			}()
+		}
+		for _, chunkPath := range batch {
+			// Stop scheduling new API work once the spend cap is hit; in-flight chunks drain normally.
+			if budget.Exceeded() {
+				budgetExhausted = true
+				break
+			}
+			jobs <- chunkPath
+		}
+		close(jobs)
 		wg.Wait()
 		close(errCh)
 		close(updatesCh)
+		close(failuresCh)
+		close(committedCh)
+
+		for f := range failuresCh {
+			failures = append(failures, f)
+		}
+		if cfg.Strict && len(failures) > 0 {
+			if err := migration.WriteFailureReport(failuresPath, failures); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+			}
+			fmt.Fprintf(os.Stderr, "-strict: %d chunk(s) failed; see %s\n", len(failures), failuresPath)
+			writeReport(migration.RunStatusFailed)
+			os.Exit(1)
+		}
 
 		for err := range errCh {
 			if err != nil {
@@ -244,43 +518,191 @@ func main() {
 		}
 
 		for u := range updatesCh {
-			migration.MergeGlossary(&glossary, u.additions, u.seenAt)
+			migration.MergeGlossary(&glossary, u.Additions, u.SeenAt)
 		}
 
 		if err := migration.SaveGlossary(glossaryPath, glossary); err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 			os.Exit(1)
 		}
+		// Reload so the next batch's prompts also see terms saved by any concurrent run.
+		if glossary, err = migration.LoadGlossary(glossaryPath); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		if err := fileutils.Flush(); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		if err := journal.Applied(); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		if cfg.IndexMode == indexModeAppend {
+			var committed []string
+			for p := range committedCh {
+				committed = append(committed, p)
+			}
+			sort.Strings(committed)
+			if err := appendIndexRows(cfg, indexPath, sentimentIndexPath, committed); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+			if err := fileutils.Flush(); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+			// The appended rows cover every chunk committed so far.
+			if err := journal.Checkpoint(); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+		}
+		if err := budget.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		if budgetExhausted || budget.Exceeded() {
+			budgetExhausted = true
+			break
+		}
+	}
+
+	if chaos != nil {
+		fmt.Fprintf(os.Stderr, "chaos chunk-summarizer: injected %s\n", chaos)
 	}
 
-	if cfg.GlossaryMinCount > 1 {
+	if cfg.GlossaryMinCount > 1 && cfg.Backfill == "" {
 		migration.CullGlossary(&glossary, cfg.GlossaryMinCount)
 	}
 	if err := migration.SaveGlossary(glossaryPath, glossary); err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
-	if cfg.Reindex {
-		if err := rebuildIndices(cfg, indexPath, sentimentIndexPath); err != nil {
+	if cfg.IndexMode == indexModeAppend {
+		fmt.Fprintln(os.Stderr, "index-mode=append: rows appended per batch; run index-compact to drop superseded rows")
+	} else if cfg.Reindex {
+		if cfg.Backfill == backfillSentiment {
+			// Semantic summaries were not touched, so index.json and key points stay as they are.
+			err = rebuildSentimentIndex(cfg, sentimentIndexPath)
+		} else {
+			err = rebuildIndices(cfg, indexPath, sentimentIndexPath)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		if err := fileutils.Flush(); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		// Indices now cover every committed chunk; with -reindex=false the journal is kept so the
+		// next run rebuilds them.
+		if err := journal.Checkpoint(); err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 			os.Exit(1)
 		}
 	} else {
 		fmt.Fprintln(os.Stderr, "warning: -reindex=false may produce incomplete indices when -resume=true")
+		report.Warnings = append(report.Warnings, "-reindex=false may produce incomplete indices when -resume=true")
+	}
+
+	if err := migration.WriteFailureReport(failuresPath, failures); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if len(failures) > 0 {
+		fmt.Fprintf(os.Stderr, "warning: %d chunk(s) failed; see %s\n", len(failures), failuresPath)
+	}
+
+	if budgetExhausted {
+		writeReport(migration.RunStatusBudgetExhausted)
+	} else {
+		writeReport(migration.RunStatusOK)
+	}
+
+	if err := fileutils.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if err := journal.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
 	}
 
-	fmt.Fprintf(os.Stdout, "chunks_processed=%d summaries_out=%s index=%s sentiment_index=%s glossary=%s\n", processed, cfg.OutDir, indexPath, sentimentIndexPath, glossaryPath)
+	spend := budget.Spend()
+	fmt.Fprintf(os.Stdout, "chunks_processed=%d chunks_failed=%d tokens_total=%d estimated_usd=%.4f summaries_out=%s index=%s sentiment_index=%s glossary=%s\n", processed, len(failures), spend.TotalTokens(), spend.USD, cfg.OutDir, indexPath, sentimentIndexPath, glossaryPath)
+	if budgetExhausted {
+		fmt.Fprintf(os.Stderr, "budget exhausted: stopped scheduling after tokens_total=%d estimated_usd=%.4f; rerun with -resume to continue\n", spend.TotalTokens(), spend.USD)
+		os.Exit(provider.ExitBudgetExhausted)
+	}
+}
+
+// glossaryUpdate is the glossary side effect of one summarized chunk. It is journaled with the chunk's
+// commit so it can be replayed if the run dies before the glossary is saved.
+type glossaryUpdate struct {
+	Additions []migration.GlossaryAddition `json:"additions,omitempty"`
+	SeenAt    *float64                     `json:"seen_at,omitempty"`
+}
+
+// recoverJournal opens the write journal in the output directory and settles what an interrupted run
+// left behind: half-written chunks are rolled back, glossary additions that were never saved are
+// merged, and indices are rebuilt if any chunk committed after they were last built.
+func recoverJournal(cfg Config, glossary *migration.Glossary, glossaryPath, indexPath, sentimentIndexPath string) (*migration.Journal, error) {
+	journal, rec, err := migration.OpenJournal(filepath.Join(cfg.OutDir, migration.JournalFileName))
+	if err != nil {
+		return nil, err
+	}
+	if len(rec.RolledBack) > 0 {
+		fmt.Fprintf(os.Stderr, "journal: rolled back %d interrupted chunk(s)\n", len(rec.RolledBack))
+	}
+	if len(rec.Unapplied) > 0 {
+		for _, e := range rec.Unapplied {
+			var u glossaryUpdate
+			if err := json.Unmarshal(e.Data, &u); err != nil {
+				continue
+			}
+			migration.MergeGlossary(glossary, u.Additions, u.SeenAt)
+		}
+		if err := migration.SaveGlossary(glossaryPath, *glossary); err != nil {
+			return nil, err
+		}
+		if err := fileutils.Flush(); err != nil {
+			return nil, err
+		}
+		if err := journal.Applied(); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "journal: replayed glossary additions from %d chunk(s)\n", len(rec.Unapplied))
+	}
+	if rec.Stale {
+		if err := rebuildIndices(cfg, indexPath, sentimentIndexPath); err != nil {
+			return nil, err
+		}
+		if err := fileutils.Flush(); err != nil {
+			return nil, err
+		}
+		if err := journal.Checkpoint(); err != nil {
+			return nil, err
+		}
+		fmt.Fprintln(os.Stderr, "journal: rebuilt indices from an interrupted run")
+	}
+	return journal, nil
 }
 
 func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
 	cfg := defaultConfig()
 	fs.SetOutput(os.Stderr)
+	cli.Setup(fs, help)
 
 	fs.StringVar(&cfg.InPath, "in", cfg.InPath, "Path to chunk JSON file OR directory of chunk JSON files (recursively)")
 	fs.StringVar(&cfg.OutDir, "out", cfg.OutDir, "Output directory for summary files + index/glossary")
+	fs.StringVar(&cfg.Provider, "provider", cfg.Provider, "Summary provider: openai, or extractive (rough local summaries from lead sentences, TF-IDF key points and frequent terms; no API key, no sentiment summaries)")
 	fs.StringVar(&cfg.Model, "model", cfg.Model, "OpenAI model to use (e.g. gpt-5-mini)")
 	fs.StringVar(&cfg.SentimentModel, "sentiment-model", cfg.SentimentModel, "OpenAI model override for sentiment chunk summaries (default: -model)")
 	fs.StringVar(&cfg.SentimentPromptFile, "sentiment-prompt-file", "", "Optional path to a file containing a custom sentiment prompt header (prepended before required SECURITY+schema tail)")
+	fs.StringVar(&cfg.SourcePromptDir, "source-prompts", "", "Directory of per-source prompt headers: <source_type>.md replaces the summary prompt header and <source_type>.sentiment.md the sentiment header for chunks of that source (chatgpt, whatsapp, telegram, email, journal); the required SECURITY+schema tails are still appended")
+	fs.StringVar(&cfg.StylePath, "style", "", "Style profile JSON (bullets, max_paragraphs, formality, person, notes, language) appended to the summary prompts and recorded in each summary")
+	fs.StringVar(&cfg.OutputLanguage, "output-language", "", "Language to write summaries, glossary definitions, and affect labels in, e.g. German (overrides the -style language)")
 	fs.BoolVar(&cfg.Pretty, "pretty", false, "Pretty-print summary JSON files")
 	fs.BoolVar(&cfg.Overwrite, "overwrite", false, "Overwrite existing summary JSON files")
 	fs.StringVar(&cfg.IndexPath, "index", "", "Optional path for index.json (default: <out>/index.json)")
@@ -289,27 +711,90 @@ func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
 	fs.IntVar(&cfg.GlossaryMaxTerms, "glossary-max-terms", cfg.GlossaryMaxTerms, "Max glossary terms to include in the prompt (0 disables)")
 	fs.IntVar(&cfg.GlossaryMinCount, "glossary-min-count", cfg.GlossaryMinCount, "Cull glossary terms with count < N at end of run (0 disables)")
 	fs.IntVar(&cfg.MaxChunks, "max-chunks", 0, "Process only the first N chunks (0 = all)")
+	fs.Func("threads", "Comma-separated thread directory names (conversation IDs) to summarize; others are left alone", func(v string) error {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				cfg.Threads = append(cfg.Threads, id)
+			}
+		}
+		return nil
+	})
 	fs.BoolVar(&cfg.Resume, "resume", cfg.Resume, "Skip chunks that already have both semantic+sentiment summary outputs")
+	fs.BoolVar(&cfg.Rescan, "rescan", cfg.Rescan, "Scan existing outputs for empty/truncated/degenerate summaries and regenerate just those chunks")
+	fs.Func("refresh-older-than", "Regenerate existing outputs older than this age (e.g. 90d, 2w, 36h)", func(v string) error {
+		d, err := migration.ParseAge(v)
+		cfg.RefreshOlderThan = d
+		return err
+	})
+	fs.BoolVar(&cfg.RefreshModelMismatch, "refresh-model-mismatch", cfg.RefreshModelMismatch, "Regenerate existing outputs produced by a different model than -model/-sentiment-model")
+	fs.StringVar(&cfg.Backfill, "backfill", "", "Generate only a missing pass for chunks that already have the other: sentiment (chunks with a semantic summary but no sentiment summary)")
+	fs.StringVar(&cfg.IndexMode, "index-mode", cfg.IndexMode, "How indices are updated: rebuild (walk every summary at end of run) or append (append rows for chunks summarized in this run; compact later with index-compact)")
+	fs.IntVar(&cfg.ReindexWorkers, "reindex-workers", cfg.ReindexWorkers, "Workers reading summary files when rebuilding indices (rows are still written in path order)")
 	fs.BoolVar(&cfg.Reindex, "reindex", cfg.Reindex, "Rebuild index files from existing outputs at end of run (recommended with -resume)")
 	fs.IntVar(&cfg.Concurrency, "concurrency", cfg.Concurrency, "Max concurrent chunk inferences within a batch")
+	fs.Float64Var(&cfg.QPS, "qps", cfg.QPS, "Max model requests started per second across all workers, retries included (0 disables)")
+	fs.StringVar(&cfg.Schedule, "schedule", cfg.Schedule, "Work order: path (file path order) or thread (finish each conversation's chunks before starting the next)")
 	fs.IntVar(&cfg.BatchSize, "batch-size", cfg.BatchSize, "Batch size for glossary chaining/merging (0 = all)")
 	fs.IntVar(&cfg.IndexSummaryMaxChars, "index-summary-max-chars", cfg.IndexSummaryMaxChars, "Max chars to keep in index summary fields (0 disables truncation)")
 	fs.IntVar(&cfg.IndexTagsMax, "index-tags-max", cfg.IndexTagsMax, "Max tags/emotion/theme labels stored in index rows (0 disables limiting)")
 	fs.IntVar(&cfg.IndexTermsMax, "index-terms-max", cfg.IndexTermsMax, "Max terms stored in index rows (0 disables limiting)")
+	fs.BoolVar(&cfg.LowercaseTags, "lowercase-tags", cfg.LowercaseTags, "Lowercase summary tags (terms keep their case); tags and terms are always deduplicated and sorted")
+	fs.Func("sentiment-index-fields", "Comma-separated sentiment fields kept in sentiment_index.json rows besides emotional_summary (default all: "+strings.Join(migration.SentimentIndexFieldNames, ",")+")", func(v string) error {
+		set, err := migration.ParseSentimentIndexFields(v)
+		cfg.SentimentIndexFields = set
+		return err
+	})
+	fs.StringVar(&cfg.TranscriptFormat, "transcript-format", cfg.TranscriptFormat, "Transcript framing for semantic prompts: compact, markdown, role-grouped, or tool-collapsed")
+	fs.StringVar(&cfg.SentimentTranscriptFormat, "sentiment-transcript-format", "", "Transcript framing for sentiment prompts (default: -transcript-format)")
+	fs.BoolVar(&cfg.SentimentEvidence, "sentiment-evidence", false, "Ask the sentiment pass for a 0-1 confidence per listed emotion and the turn range evidencing each emotional tension (numbers turns in the transcript)")
+	fs.Func("turn-sentiment", "Comma-separated date ranges (2024-01-01..2024-03-31, open ends allowed) whose chunks also get per-turn affect classification in *.turns.sentiment.json", func(v string) error {
+		ranges, err := migration.ParseDateRanges(v)
+		cfg.TurnSentiment = ranges
+		return err
+	})
+	fs.StringVar(&cfg.TurnSentimentModel, "turn-sentiment-model", "", "Model for -turn-sentiment classification (default: -sentiment-model)")
+	fs.StringVar(&cfg.TermsModel, "terms-model", "", "Run a terms-only pass with this cheap model (e.g. gpt-5-nano) over every chunk first, so summaries start with the complete glossary (empty disables)")
+	fs.BoolVar(&cfg.TermsOnly, "terms-only", false, "Stop after the -terms-model pass: build the glossary without writing summaries")
+	fs.StringVar(&cfg.PromptBudget, "prompt-budget", "", "Max prompt input tokens per model, e.g. gpt-5-mini=60000,gpt-4o-mini=12000 or a bare number for all models (default 20000; always kept within the model's context window)")
+	fs.BoolVar(&cfg.Strict, "strict", cfg.Strict, "Fail the run if any chunk cannot be read (default: record it in the failures report and continue)")
+	fs.StringVar(&cfg.FailuresPath, "failures", "", "Optional path for failures.jsonl (default: <out>/failures.jsonl)")
+	fs.Float64Var(&cfg.MaxUSD, "max-usd", cfg.MaxUSD, "Stop scheduling new API work once estimated spend reaches this many USD (0 disables)")
+	fs.Int64Var(&cfg.MaxTokensTotal, "max-tokens-total", cfg.MaxTokensTotal, "Stop scheduling new API work once input+output tokens reach this total (0 disables)")
+	fs.StringVar(&cfg.BudgetLedger, "budget-ledger", "", "Optional JSON file to load/save cumulative spend so caps span several runs or stages")
 	fs.StringVar(&cfg.APIKey, "api-key", "", "OpenAI API key (overrides OPENAI_API_KEY env var)")
+	fs.StringVar(&cfg.StructuredOutput, "structured-output", provider.StructuredJSONSchema, "How schema-constrained output is requested: json-schema (response format) or tool (a required function call, for models without json_schema support)")
+	fs.StringVar(&cfg.Durability, "durability", cfg.Durability, "fsync policy for output files: none, group (sync in batches), or full (sync every file)")
+	fs.StringVar(&cfg.AtomicWrite, "atomic-write", fileutils.AtomicRename, "How finished files replace their targets: rename (atomic), staged (temp files in TMPDIR, kept out of synced folders), or copy (written in place, for shares that refuse rename)")
+	fs.BoolVar(&cfg.CanonicalJSON, "canonical-json", cfg.CanonicalJSON, "Write JSON outputs with sorted keys and stable number formatting so regenerated files diff cleanly")
+	fs.IntVar(&cfg.MaxFilesPerDir, "max-files-per-dir", fileutils.DefaultMaxFilesPerDir, "Stop with an error before any output directory holds more than N files (0 disables)")
+	fs.Int64Var(&cfg.MaxOutputBytes, "max-output-bytes", 0, "Stop with an error before this run writes more than N bytes (0 disables)")
+	fs.StringVar(&cfg.Chaos, "chaos", "", "Inject provider failures for testing, e.g. rate-limit=0.1,server-error=0.05,truncate=0.05,garbage=0.05 (plus seed=N, max=N)")
 
 	if err := fs.Parse(args); err != nil {
 		return Config{}, err
 	}
 
+	if cfg.Provider == providerExtractive {
+		// Recorded on every summary so a later -refresh-model-mismatch run with an LLM replaces them.
+		cfg.Model = migration.ExtractiveModel
+	}
 	if cfg.SentimentModel == "" {
 		cfg.SentimentModel = cfg.Model
 	}
+	if cfg.SentimentTranscriptFormat == "" {
+		cfg.SentimentTranscriptFormat = cfg.TranscriptFormat
+	}
 	cfg.InPath = filepath.Clean(cfg.InPath)
 	cfg.OutDir = filepath.Clean(cfg.OutDir)
 	if cfg.SentimentPromptFile != "" {
 		cfg.SentimentPromptFile = filepath.Clean(cfg.SentimentPromptFile)
 	}
+	if cfg.SourcePromptDir != "" {
+		cfg.SourcePromptDir = filepath.Clean(cfg.SourcePromptDir)
+	}
+	if cfg.StylePath != "" {
+		cfg.StylePath = filepath.Clean(cfg.StylePath)
+	}
 	if cfg.IndexPath != "" {
 		cfg.IndexPath = filepath.Clean(cfg.IndexPath)
 	}
@@ -319,29 +804,33 @@ func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
 	if cfg.GlossaryPath != "" {
 		cfg.GlossaryPath = filepath.Clean(cfg.GlossaryPath)
 	}
+	if cfg.FailuresPath != "" {
+		cfg.FailuresPath = filepath.Clean(cfg.FailuresPath)
+	}
+	if cfg.BudgetLedger != "" {
+		cfg.BudgetLedger = filepath.Clean(cfg.BudgetLedger)
+	}
 	return cfg, nil
 }
 
 func semanticSummaryOutPath(inRoot, outRoot, chunkPath string) string {
-	rel := chunkPath
-	if fi, err := os.Stat(inRoot); err == nil && fi.IsDir() {
-		if r, err := filepath.Rel(inRoot, chunkPath); err == nil {
-			rel = r
-		}
-	}
-	base := strings.TrimSuffix(rel, filepath.Ext(rel)) + ".summary.json"
-	return filepath.Join(outRoot, base)
+	return summaryOutPath(inRoot, outRoot, chunkPath, layout.ChunkSummary)
 }
 
 func sentimentSummaryOutPath(inRoot, outRoot, chunkPath string) string {
+	return summaryOutPath(inRoot, outRoot, chunkPath, layout.ChunkSentiment)
+}
+
+// summaryOutPath mirrors chunkPath's position under inRoot into outRoot with kind's suffix. A summary
+// already on disk under a legacy suffix keeps its name, so it is found and overwritten in place.
+func summaryOutPath(inRoot, outRoot, chunkPath string, kind layout.Kind) string {
 	rel := chunkPath
 	if fi, err := os.Stat(inRoot); err == nil && fi.IsDir() {
 		if r, err := filepath.Rel(inRoot, chunkPath); err == nil {
 			rel = r
 		}
 	}
-	base := strings.TrimSuffix(rel, filepath.Ext(rel)) + ".sentiment.summary.json"
-	return filepath.Join(outRoot, base)
+	return layout.Find(filepath.Join(outRoot, strings.TrimSuffix(rel, filepath.Ext(rel))), kind)
 }
 
 func limitStrings(in []string, max int) []string {
@@ -352,177 +841,308 @@ func limitStrings(in []string, max int) []string {
 }
 
 func rebuildIndices(cfg Config, indexPath string, sentimentIndexPath string) error {
-	var semanticPaths []string
-	var sentimentPaths []string
+	start := time.Now()
+	semanticPaths, sentimentPaths, err := collectSummaryPaths(cfg)
+	if err != nil {
+		return err
+	}
+	walked := time.Since(start)
+	if err := writeSemanticIndex(cfg, indexPath, semanticPaths); err != nil {
+		return err
+	}
+	if err := writeSentimentIndex(cfg, sentimentIndexPath, sentimentPaths); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "reindex chunk-summarizer: semantic=%d sentiment=%d workers=%d walk=%s total=%s\n",
+		len(semanticPaths), len(sentimentPaths), cfg.ReindexWorkers, walked.Round(time.Millisecond), time.Since(start).Round(time.Millisecond))
+	return nil
+}
 
-	err := filepath.WalkDir(cfg.OutDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-		lp := strings.ToLower(path)
-		if strings.HasSuffix(lp, ".sentiment.summary.json") {
+// rebuildSentimentIndex rebuilds only sentiment_index.json, leaving index.json and key points untouched.
+func rebuildSentimentIndex(cfg Config, sentimentIndexPath string) error {
+	start := time.Now()
+	_, sentimentPaths, err := collectSummaryPaths(cfg)
+	if err != nil {
+		return err
+	}
+	if err := writeSentimentIndex(cfg, sentimentIndexPath, sentimentPaths); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "reindex chunk-summarizer: sentiment=%d workers=%d total=%s\n",
+		len(sentimentPaths), cfg.ReindexWorkers, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func collectSummaryPaths(cfg Config) (semanticPaths, sentimentPaths []string, err error) {
+	paths, err := fileutils.WalkShards(cfg.OutDir, cfg.ReindexWorkers, func(path string) bool {
+		return layout.Is(path, layout.ChunkSummary) || layout.Is(path, layout.ChunkSentiment)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("reindex: walk summaries: %w", err)
+	}
+	for _, path := range paths {
+		if layout.Is(path, layout.ChunkSentiment) {
 			sentimentPaths = append(sentimentPaths, path)
-			return nil
-		}
-		if strings.HasSuffix(lp, ".summary.json") {
+		} else {
 			semanticPaths = append(semanticPaths, path)
-			return nil
 		}
-		return nil
-	})
+	}
+	return semanticPaths, sentimentPaths, nil
+}
+
+// writeSemanticIndex writes index.json and the key points file next to it. Summaries are read by
+// cfg.ReindexWorkers workers; rows are written in path order.
+func writeSemanticIndex(cfg Config, indexPath string, semanticPaths []string) error {
+	indexW, err := fileutils.CreateJSONL(indexPath)
+	if err != nil {
+		return err
+	}
+	defer indexW.Close()
+	keyPointsW, err := fileutils.CreateJSONL(keyPointsPath(indexPath))
 	if err != nil {
-		return fmt.Errorf("reindex: walk summaries: %w", err)
+		return err
 	}
-	sort.Strings(semanticPaths)
-	sort.Strings(sentimentPaths)
+	defer keyPointsW.Close()
 
-	if err := os.MkdirAll(filepath.Dir(indexPath), 0o755); err != nil {
+	err = fileutils.ParallelOrdered(semanticPaths, cfg.ReindexWorkers, func(sumPath string) (semanticRows, error) {
+		return buildSemanticRows(cfg, sumPath), nil
+	}, func(rows semanticRows) error {
+		return rows.write(indexW, keyPointsW)
+	})
+	if err != nil {
 		return err
 	}
-	if err := os.MkdirAll(filepath.Dir(sentimentIndexPath), 0o755); err != nil {
+	if err := indexW.Close(); err != nil {
 		return err
 	}
+	return keyPointsW.Close()
+}
 
-	indexFile, err := os.OpenFile(indexPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+func writeSentimentIndex(cfg Config, sentimentIndexPath string, sentimentPaths []string) error {
+	sentW, err := fileutils.CreateJSONL(sentimentIndexPath)
 	if err != nil {
 		return err
 	}
-	defer indexFile.Close()
-	indexW := bufio.NewWriterSize(indexFile, 1<<20)
-	defer indexW.Flush()
+	defer sentW.Close()
 
-	sentFile, err := os.OpenFile(sentimentIndexPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	err = fileutils.ParallelOrdered(sentimentPaths, cfg.ReindexWorkers, func(sumPath string) (sentimentRow, error) {
+		return buildSentimentRow(cfg, sumPath), nil
+	}, func(row sentimentRow) error {
+		return row.write(sentW)
+	})
 	if err != nil {
 		return err
 	}
-	defer sentFile.Close()
-	sentW := bufio.NewWriterSize(sentFile, 1<<20)
-	defer sentW.Flush()
+	return sentW.Close()
+}
 
-	for _, sumPath := range semanticPaths {
-		rel, err := filepath.Rel(cfg.OutDir, sumPath)
-		if err != nil {
-			continue
+// appendIndexRows appends the index, key point, and sentiment rows of chunkPaths to the existing index
+// files instead of rebuilding them. Rows replace earlier rows for the same summary when the files are
+// read or compacted (see migration.IndexKey).
+func appendIndexRows(cfg Config, indexPath, sentimentIndexPath string, chunkPaths []string) error {
+	// A sentiment backfill leaves semantic summaries, and so their rows, as they are.
+	semantic := cfg.Backfill != backfillSentiment
+	var indexW, keyPointsW *fileutils.JSONLWriter
+	var err error
+	if semantic {
+		if indexW, err = fileutils.AppendJSONL(indexPath); err != nil {
+			return err
 		}
-		chunkRel := strings.TrimSuffix(rel, ".summary.json") + ".json"
-		chunkPath := filepath.Join(cfg.InPath, chunkRel)
+		defer indexW.Close()
+		if keyPointsW, err = fileutils.AppendJSONL(keyPointsPath(indexPath)); err != nil {
+			return err
+		}
+		defer keyPointsW.Close()
+	}
+	sentW, err := fileutils.AppendJSONL(sentimentIndexPath)
+	if err != nil {
+		return err
+	}
+	defer sentW.Close()
 
-		chunk, err := readChunkFile(chunkPath)
-		if err != nil {
-			continue
+	for _, chunkPath := range chunkPaths {
+		if semantic {
+			if err := buildSemanticRows(cfg, semanticSummaryOutPath(cfg.InPath, cfg.OutDir, chunkPath)).write(indexW, keyPointsW); err != nil {
+				return err
+			}
 		}
-		b, err := os.ReadFile(sumPath)
-		if err != nil {
-			continue
+		if err := buildSentimentRow(cfg, sentimentSummaryOutPath(cfg.InPath, cfg.OutDir, chunkPath)).write(sentW); err != nil {
+			return err
 		}
-		var summary migration.ChunkSummary
-		if err := json.Unmarshal(b, &summary); err != nil {
-			continue
+	}
+	if semantic {
+		if err := indexW.Close(); err != nil {
+			return err
 		}
-
-		rec := migration.BuildIndexRecord(chunk, chunkPath, summary, sumPath)
-		if cfg.IndexSummaryMaxChars > 0 {
-			rec.Summary = fileutils.Truncate(rec.Summary, cfg.IndexSummaryMaxChars)
+		if err := keyPointsW.Close(); err != nil {
+			return err
 		}
-		rec.Tags = limitStrings(rec.Tags, cfg.IndexTagsMax)
-		rec.Terms = limitStrings(rec.Terms, cfg.IndexTermsMax)
+	}
+	return sentW.Close()
+}
 
-		line, err := json.Marshal(rec)
-		if err != nil {
-			continue
-		}
-		if _, err := indexW.Write(append(line, '\n')); err != nil {
+func keyPointsPath(indexPath string) string {
+	return filepath.Join(filepath.Dir(indexPath), migration.KeyPointsFileName)
+}
+
+// semanticRows is the index row and key point rows of one semantic summary. ok is false when the summary
+// or its chunk could not be read; such summaries are left out of the index.
+type semanticRows struct {
+	rec       migration.IndexRecord
+	keyPoints []migration.KeyPointRecord
+	ok        bool
+}
+
+func buildSemanticRows(cfg Config, sumPath string) semanticRows {
+	rel, err := filepath.Rel(cfg.OutDir, sumPath)
+	if err != nil {
+		return semanticRows{}
+	}
+	_, base, _ := layout.Detect(rel)
+	chunkRel := base + ".json"
+	chunkPath := filepath.Join(cfg.InPath, chunkRel)
+
+	chunk, err := readChunkFile(chunkPath)
+	if err != nil {
+		return semanticRows{}
+	}
+	b, err := os.ReadFile(sumPath)
+	if err != nil {
+		return semanticRows{}
+	}
+	var summary migration.ChunkSummary
+	if err := json.Unmarshal(b, &summary); err != nil {
+		return semanticRows{}
+	}
+
+	rec := migration.BuildIndexRecord(chunk, chunkPath, summary, sumPath)
+	if cfg.IndexSummaryMaxChars > 0 {
+		rec.Summary = fileutils.Truncate(rec.Summary, cfg.IndexSummaryMaxChars)
+	}
+	rec.Tags = migration.SortTags(limitStrings(rec.Tags, cfg.IndexTagsMax))
+	rec.Terms = migration.SortTags(limitStrings(rec.Terms, cfg.IndexTermsMax))
+	return semanticRows{rec: rec, keyPoints: migration.BuildKeyPointRecords(chunk, summary, sumPath), ok: true}
+}
+
+func (r semanticRows) write(indexW, keyPointsW *fileutils.JSONLWriter) error {
+	if !r.ok {
+		return nil
+	}
+	if err := indexW.Write(r.rec); err != nil {
+		return err
+	}
+	for _, kp := range r.keyPoints {
+		if err := keyPointsW.Write(kp); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	for _, sumPath := range sentimentPaths {
-		rel, err := filepath.Rel(cfg.OutDir, sumPath)
-		if err != nil {
-			continue
-		}
-		chunkRel := strings.TrimSuffix(rel, ".sentiment.summary.json") + ".json"
-		chunkPath := filepath.Join(cfg.InPath, chunkRel)
+// sentimentRow is the sentiment index row of one sentiment summary; ok is false when it could not be read.
+type sentimentRow struct {
+	rec SentimentIndexRecord
+	ok  bool
+}
 
-		chunk, err := readChunkFile(chunkPath)
-		if err != nil {
-			continue
-		}
-		b, err := os.ReadFile(sumPath)
-		if err != nil {
-			continue
-		}
-		var summary migrationChunkSentimentSummary
-		if err := json.Unmarshal(b, &summary); err != nil {
-			continue
-		}
+func buildSentimentRow(cfg Config, sumPath string) sentimentRow {
+	rel, err := filepath.Rel(cfg.OutDir, sumPath)
+	if err != nil {
+		return sentimentRow{}
+	}
+	_, base, _ := layout.Detect(rel)
+	chunkRel := base + ".json"
+	chunkPath := filepath.Join(cfg.InPath, chunkRel)
 
-		rec := sentimentIndexRecordFrom(chunk, chunkPath, sumPath, summary)
-		if cfg.IndexSummaryMaxChars > 0 {
-			rec.EmotionalSummary = fileutils.Truncate(rec.EmotionalSummary, cfg.IndexSummaryMaxChars)
-		}
-		rec.DominantEmotions = limitStrings(rec.DominantEmotions, cfg.IndexTagsMax)
-		rec.Themes = limitStrings(rec.Themes, cfg.IndexTagsMax)
+	chunk, err := readChunkFile(chunkPath)
+	if err != nil {
+		return sentimentRow{}
+	}
+	b, err := os.ReadFile(sumPath)
+	if err != nil {
+		return sentimentRow{}
+	}
+	var summary migration.ChunkSentimentSummary
+	if err := json.Unmarshal(b, &summary); err != nil {
+		return sentimentRow{}
+	}
 
-		line, err := json.Marshal(rec)
-		if err != nil {
+	rec := sentimentIndexRecordFrom(chunk, chunkPath, sumPath, summary)
+	rec.Select(cfg.SentimentIndexFields)
+	if cfg.IndexSummaryMaxChars > 0 {
+		rec.EmotionalSummary = fileutils.Truncate(rec.EmotionalSummary, cfg.IndexSummaryMaxChars)
+	}
+	rec.DominantEmotions = limitStrings(rec.DominantEmotions, cfg.IndexTagsMax)
+	rec.Themes = limitStrings(rec.Themes, cfg.IndexTagsMax)
+	return sentimentRow{rec: rec, ok: true}
+}
+
+func (r sentimentRow) write(sentW *fileutils.JSONLWriter) error {
+	if !r.ok {
+		return nil
+	}
+	return sentW.Write(r.rec)
+}
+
+// sentimentBackfillCandidates keeps the chunks that have a semantic summary but no sentiment summary,
+// i.e. chunks summarized before the sentiment pass existed.
+func sentimentBackfillCandidates(cfg Config, chunkFiles []string) []string {
+	var out []string
+	for _, chunkPath := range chunkFiles {
+		if !fileutils.FileExists(semanticSummaryOutPath(cfg.InPath, cfg.OutDir, chunkPath)) {
 			continue
 		}
-		if _, err := sentW.Write(append(line, '\n')); err != nil {
-			return err
+		if fileutils.FileExists(sentimentSummaryOutPath(cfg.InPath, cfg.OutDir, chunkPath)) {
+			continue
 		}
+		out = append(out, chunkPath)
 	}
-
-	return nil
+	return out
 }
 
+// SentimentIndexRecord is a sentiment_index.json row; its sentiment fields have the same shape as
+// thread-rollup's sentiment_thread_index.json rows.
 type SentimentIndexRecord struct {
 	ConversationID string   `json:"conversation_id"`
 	ThreadStart    *float64 `json:"thread_start_time,omitempty"`
 	ChunkNumber    int      `json:"chunk_number"`
 	TurnStart      int      `json:"turn_start"`
 	TurnEnd        int      `json:"turn_end"`
+	SourceType     string   `json:"source_type,omitempty"`
 
 	ChunkPath            string `json:"chunk_path"`
 	SentimentSummaryPath string `json:"sentiment_summary_path"`
 
-	EmotionalSummary   string   `json:"emotional_summary"`
-	DominantEmotions   []string `json:"dominant_emotions"`
-	RememberedEmotions []string `json:"remembered_emotions"`
-	PresentEmotions    []string `json:"present_emotions"`
-	EmotionalTensions  []string `json:"emotional_tensions"`
-	EmotionalArc       string   `json:"emotional_arc"`
-	Themes             []string `json:"themes"`
-	SymbolsOrMetaphors []string `json:"symbols_or_metaphors"`
-	RelationalShift    string   `json:"relational_shift"`
-	ResonanceNotes     string   `json:"resonance_notes,omitempty"`
-	ToneMarkers        []string `json:"tone_markers,omitempty"`
+	migration.SentimentIndexFields
 }
 
-func sentimentIndexRecordFrom(chunk migration.Chunk, chunkPath string, sentimentSummaryPath string, summary migrationChunkSentimentSummary) SentimentIndexRecord {
+func sentimentIndexRecordFrom(chunk migration.Chunk, chunkPath string, sentimentSummaryPath string, summary migration.ChunkSentimentSummary) SentimentIndexRecord {
 	return SentimentIndexRecord{
 		ConversationID:       chunk.ConversationID,
 		ThreadStart:          chunk.ThreadStart,
 		ChunkNumber:          chunk.ChunkNumber,
 		TurnStart:            chunk.TurnStart,
 		TurnEnd:              chunk.TurnEnd,
+		SourceType:           chunk.SourceType,
 		ChunkPath:            chunkPath,
 		SentimentSummaryPath: sentimentSummaryPath,
-		EmotionalSummary:     strings.TrimSpace(summary.EmotionalSummary),
-		DominantEmotions:     summary.DominantEmotions,
-		RememberedEmotions:   summary.RememberedEmotions,
-		PresentEmotions:      summary.PresentEmotions,
-		EmotionalTensions:    summary.EmotionalTensions,
-		EmotionalArc:         strings.TrimSpace(summary.EmotionalArc),
-		Themes:               summary.Themes,
-		SymbolsOrMetaphors:   summary.SymbolsOrMetaphors,
-		RelationalShift:      strings.TrimSpace(summary.RelationalShift),
-		ResonanceNotes:       strings.TrimSpace(summary.ResonanceNotes),
-		ToneMarkers:          summary.ToneMarkers,
+		SentimentIndexFields: migration.BuildChunkSentimentIndexFields(summary),
+	}
+}
+
+// filterChunkFilesByThread keeps the chunk files whose thread directory is named in threads.
+func filterChunkFilesByThread(files, threads []string) []string {
+	want := make(map[string]bool, len(threads))
+	for _, t := range threads {
+		want[t] = true
+	}
+	var out []string
+	for _, f := range files {
+		if want[filepath.Base(filepath.Dir(f))] {
+			out = append(out, f)
+		}
 	}
+	return out
 }
 
 func collectChunkFiles(inPath string) ([]string, error) {
@@ -553,7 +1173,7 @@ func collectChunkFiles(inPath string) ([]string, error) {
 		if strings.ToLower(filepath.Ext(path)) != ".json" {
 			return nil
 		}
-		if strings.HasSuffix(strings.ToLower(path), ".summary.json") {
+		if _, _, ok := layout.Detect(path); ok || layout.IsPart(path) || migration.IsBookkeepingFile(path) {
 			return nil
 		}
 		files = append(files, path)
@@ -566,6 +1186,98 @@ func collectChunkFiles(inPath string) ([]string, error) {
 	return files, nil
 }
 
+// scanChunkArtifacts inspects existing semantic and sentiment outputs for the given chunks and returns
+// the chunks that should be regenerated under -resume: artifacts that look truncated or degenerate
+// (-rescan) and artifacts selected by the -refresh-* policy.
+func scanChunkArtifacts(cfg Config, chunkFiles []string) map[string]bool {
+	regen := make(map[string]bool)
+	policy := cfg.refreshPolicy()
+	now := time.Now()
+	for _, chunkPath := range chunkFiles {
+		var problems []string
+
+		semanticOut := semanticSummaryOutPath(cfg.InPath, cfg.OutDir, chunkPath)
+		if b, err := os.ReadFile(semanticOut); err == nil {
+			var cs migration.ChunkSummary
+			if err := json.Unmarshal(b, &cs); err != nil {
+				problems = append(problems, "semantic summary is not valid JSON")
+			} else if !cs.EditedByHuman {
+				if cfg.Rescan {
+					problems = append(problems, migration.ChunkSummaryProblems(cs)...)
+				}
+				if r := policy.Reason(semanticOut, cs.Model, cfg.Model, now); r != "" {
+					problems = append(problems, "semantic refresh: "+r)
+				}
+			}
+		}
+
+		sentOut := sentimentSummaryOutPath(cfg.InPath, cfg.OutDir, chunkPath)
+		if b, err := os.ReadFile(sentOut); err == nil {
+			var ss migration.ChunkSentimentSummary
+			if err := json.Unmarshal(b, &ss); err != nil {
+				problems = append(problems, "sentiment summary is not valid JSON")
+			} else if !ss.EditedByHuman {
+				if cfg.Rescan {
+					for _, p := range migration.ChunkSentimentSummaryProblems(ss) {
+						problems = append(problems, "sentiment "+p)
+					}
+				}
+				if r := policy.Reason(sentOut, ss.Model, cfg.SentimentModel, now); r != "" {
+					problems = append(problems, "sentiment refresh: "+r)
+				}
+			}
+		}
+
+		if len(problems) > 0 {
+			regen[chunkPath] = true
+			fmt.Fprintf(os.Stderr, "rescan: %s: %s\n", chunkPath, strings.Join(problems, "; "))
+		}
+	}
+	return regen
+}
+
+// orderChunkFilesByThread groups chunk files by their thread directory (keeping the first-seen order
+// of directories) and orders each group by chunk number, so a thread's chunks are scheduled together.
+func orderChunkFilesByThread(files []string) []string {
+	var dirs []string
+	groups := make(map[string][]string)
+	for _, f := range files {
+		d := filepath.Dir(f)
+		if _, ok := groups[d]; !ok {
+			dirs = append(dirs, d)
+		}
+		groups[d] = append(groups[d], f)
+	}
+
+	out := make([]string, 0, len(files))
+	for _, d := range dirs {
+		g := groups[d]
+		sort.SliceStable(g, func(i, j int) bool {
+			ni, nj := chunkNumberFromPath(g[i]), chunkNumberFromPath(g[j])
+			if ni != nj {
+				return ni < nj
+			}
+			return g[i] < g[j]
+		})
+		out = append(out, g...)
+	}
+	return out
+}
+
+// chunkNumberFromPath parses N from chunk filenames of the form <start>_<N>.json (0 if absent).
+func chunkNumberFromPath(path string) int {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	i := strings.LastIndexByte(base, '_')
+	if i < 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(base[i+1:])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
 func readChunkFile(path string) (migration.Chunk, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
@@ -582,15 +1294,7 @@ func readChunkFile(path string) (migration.Chunk, error) {
 }
 
 func writeSummaryFile(inRoot, outRoot, chunkPath string, summary migration.ChunkSummary, pretty bool, overwrite bool) (string, error) {
-	rel := chunkPath
-	if fi, err := os.Stat(inRoot); err == nil && fi.IsDir() {
-		if r, err := filepath.Rel(inRoot, chunkPath); err == nil {
-			rel = r
-		}
-	}
-
-	base := strings.TrimSuffix(rel, filepath.Ext(rel)) + ".summary.json"
-	outPath := filepath.Join(outRoot, base)
+	outPath := semanticSummaryOutPath(inRoot, outRoot, chunkPath)
 
 	if !overwrite {
 		if _, err := os.Stat(outPath); err == nil {
@@ -603,16 +1307,13 @@ func writeSummaryFile(inRoot, outRoot, chunkPath string, summary migration.Chunk
 		return "", fmt.Errorf("mkdir summary dir: %w", err)
 	}
 
-	var b []byte
-	var err error
-	if pretty {
-		b, err = json.MarshalIndent(summary, "", "  ")
-	} else {
-		b, err = json.Marshal(summary)
-	}
+	b, err := fileutils.MarshalJSON(summary, pretty)
 	if err != nil {
 		return "", fmt.Errorf("marshal summary: %w", err)
 	}
+	if b, err = fileutils.StampChecksum(b, pretty); err != nil {
+		return "", fmt.Errorf("checksum summary: %w", err)
+	}
 
 	if err := fileutils.WriteFileAtomicSameDir(outPath, b, 0o644); err != nil {
 		return "", fmt.Errorf("write summary: %w", err)
@@ -623,9 +1324,13 @@ func writeSummaryFile(inRoot, outRoot, chunkPath string, summary migration.Chunk
 type migrationChunkSentimentSummary struct {
 	ConversationID string   `json:"conversation_id"`
 	ThreadStart    *float64 `json:"thread_start_time,omitempty"`
+	ThreadUpdate   *float64 `json:"thread_update_time,omitempty"`
 	ChunkNumber    int      `json:"chunk_number"`
 	TurnStart      int      `json:"turn_start"`
 	TurnEnd        int      `json:"turn_end"`
+	Project        string   `json:"project,omitempty"`
+	SourceType     string   `json:"source_type,omitempty"`
+	OriginalTitle  string   `json:"original_title,omitempty"`
 
 	// EmotionalSummary is "how it felt" in this chunk.
 	EmotionalSummary string `json:"emotional_summary"`
@@ -661,18 +1366,25 @@ type migrationChunkSentimentSummary struct {
 
 	// ToneMarkers are optional compact indicators of tone; emojis allowed.
 	ToneMarkers []string `json:"tone_markers,omitempty"`
+
+	// SentimentEvidence holds emotion confidences and tension turn ranges under -sentiment-evidence.
+	migration.SentimentEvidence
+
+	// TurnSentiment summarizes the chunk's *.turns.sentiment.json under -turn-sentiment.
+	TurnSentiment *migration.TurnSentimentAggregate `json:"turn_sentiment,omitempty"`
+
+	// Tiny is carried from the chunk (see migration.ChunkSummary.Tiny).
+	Tiny bool `json:"tiny,omitempty"`
+
+	// Model is the model that produced this artifact.
+	Model string `json:"model,omitempty"`
+
+	// Style is the -style profile the artifact was written with.
+	Style *migration.StyleProfile `json:"style,omitempty"`
 }
 
 func writeSentimentSummaryFile(inRoot, outRoot, chunkPath string, summary migrationChunkSentimentSummary, pretty bool, overwrite bool) (string, error) {
-	rel := chunkPath
-	if fi, err := os.Stat(inRoot); err == nil && fi.IsDir() {
-		if r, err := filepath.Rel(inRoot, chunkPath); err == nil {
-			rel = r
-		}
-	}
-
-	base := strings.TrimSuffix(rel, filepath.Ext(rel)) + ".sentiment.summary.json"
-	outPath := filepath.Join(outRoot, base)
+	outPath := sentimentSummaryOutPath(inRoot, outRoot, chunkPath)
 
 	if !overwrite {
 		if _, err := os.Stat(outPath); err == nil {
@@ -685,16 +1397,13 @@ func writeSentimentSummaryFile(inRoot, outRoot, chunkPath string, summary migrat
 		return "", fmt.Errorf("mkdir sentiment summary dir: %w", err)
 	}
 
-	var b []byte
-	var err error
-	if pretty {
-		b, err = json.MarshalIndent(summary, "", "  ")
-	} else {
-		b, err = json.Marshal(summary)
-	}
+	b, err := fileutils.MarshalJSON(summary, pretty)
 	if err != nil {
 		return "", fmt.Errorf("marshal sentiment summary: %w", err)
 	}
+	if b, err = fileutils.StampChecksum(b, pretty); err != nil {
+		return "", fmt.Errorf("checksum sentiment summary: %w", err)
+	}
 
 	if err := fileutils.WriteFileAtomicSameDir(outPath, b, 0o644); err != nil {
 		return "", fmt.Errorf("write sentiment summary: %w", err)
@@ -702,15 +1411,18 @@ func writeSentimentSummaryFile(inRoot, outRoot, chunkPath string, summary migrat
 	return outPath, nil
 }
 
-func glossaryForPrompt(g migration.Glossary, maxTerms int) string {
+// glossaryForPrompt renders up to maxTerms defined glossary entries for a prompt and returns the terms
+// it listed.
+func glossaryForPrompt(g migration.Glossary, maxTerms int) (string, []string) {
 	if maxTerms == 0 || len(g.Entries) == 0 {
-		return ""
+		return "", nil
 	}
 	entries := g.Entries
 	if maxTerms > 0 && len(entries) > maxTerms {
 		entries = entries[:maxTerms]
 	}
 	var b strings.Builder
+	var terms []string
 	for _, e := range entries {
 		term := strings.TrimSpace(e.Term)
 		if term == "" {
@@ -721,8 +1433,28 @@ func glossaryForPrompt(g migration.Glossary, maxTerms int) string {
 			continue
 		}
 		fmt.Fprintf(&b, "- %s: %s\n", term, def)
+		terms = append(terms, term)
 	}
-	return b.String()
+	return b.String(), terms
+}
+
+// snapshotPromptGlossary renders the glossary excerpt for a batch's prompts and archives the glossary
+// it came from under <out>/glossary_snapshots, returning the excerpt and the reference summaries
+// record in their .meta.json sidecars. An empty excerpt has no snapshot and a nil reference.
+func snapshotPromptGlossary(outDir string, g migration.Glossary, maxTerms int) (string, *provider.PromptGlossary, error) {
+	excerpt, terms := glossaryForPrompt(g, maxTerms)
+	if excerpt == "" {
+		return "", nil, nil
+	}
+	path, err := migration.WriteGlossarySnapshot(filepath.Join(outDir, migration.GlossarySnapshotsDirName), g, excerpt, terms)
+	if err != nil {
+		return "", nil, err
+	}
+	ref := &provider.PromptGlossary{SHA256: migration.GlossaryExcerptSHA256(excerpt), Terms: terms}
+	if rel, err := filepath.Rel(outDir, path); err == nil {
+		ref.Snapshot = filepath.ToSlash(rel)
+	}
+	return excerpt, ref, nil
 }
 
 type summarizeResponse struct {
@@ -748,25 +1480,60 @@ type summarizeSentimentResponse struct {
 	SymbolsOrMetaphors []string `json:"symbols_or_metaphors"`
 	ResonanceNotes     string   `json:"resonance_notes"`
 	ToneMarkers        []string `json:"tone_markers"`
+
+	// Evidence is decoded from the same output when -sentiment-evidence asked for it.
+	Evidence migration.SentimentEvidence `json:"-"`
+}
+
+// chunkSummarizer produces a chunk's semantic and sentiment summaries.
+type chunkSummarizer interface {
+	SummarizeChunkWithOptions(ctx context.Context, chunk migration.Chunk, glossaryExcerpt string, opt promptOptions) (summarizeResponse, error)
+	SummarizeChunkSentimentWithOptions(ctx context.Context, chunk migration.Chunk, glossaryExcerpt string, opt promptOptions) (summarizeSentimentResponse, error)
+}
+
+// extractiveSummarizer builds rough semantic summaries locally with migration.ExtractiveSummarize.
+type extractiveSummarizer struct{}
+
+func (extractiveSummarizer) SummarizeChunkWithOptions(_ context.Context, chunk migration.Chunk, _ string, _ promptOptions) (summarizeResponse, error) {
+	s := migration.ExtractiveSummarize(chunk, migration.ExtractiveOptions{})
+	return summarizeResponse{Summary: s.Summary, KeyPoints: s.KeyPoints, Tags: s.Tags, Terms: []string{}}, nil
+}
+
+func (extractiveSummarizer) SummarizeChunkSentimentWithOptions(context.Context, migration.Chunk, string, promptOptions) (summarizeSentimentResponse, error) {
+	return summarizeSentimentResponse{}, errors.New("the extractive provider does not write sentiment summaries")
 }
 
 type openAISummarizer struct {
-	client                *openai.Client
-	model                 string
-	sentimentModel        string
-	sentimentInstructions string
+	client         *openai.Client
+	budget         *provider.Budget
+	model          string
+	sentimentModel string
+	// instructions picks each chunk's prompts by its source type; they already carry the -style section.
+	instructions sourceInstructions
+	prompts      provider.PromptBudget
+	// evidence asks the sentiment pass for migration.SentimentEvidence as well.
+	evidence bool
 }
 
 var summarizeSchema = provider.GenerateSchema[summarizeResponse]()
 var summarizeSentimentSchema = provider.GenerateSchema[summarizeSentimentResponse]()
+var summarizeSentimentEvidenceSchema = provider.MergeSchemas(summarizeSentimentSchema, provider.GenerateSchema[migration.SentimentEvidence]())
 
 type promptOptions struct {
-	MaxTranscriptChars int
-	IncludeToolText    bool
+	// MaxInputTokens caps the whole prompt input (metadata, glossary, and transcript); the transcript is
+	// cut to fit. 0 lets the summarizer fill it from its prompt budget for the model.
+	MaxInputTokens int
+	// Shrink halves the budget, for retries after a request failed under size pressure.
+	Shrink          bool
+	IncludeToolText bool
+	// Format selects the transcript renderer (compact, markdown, role-grouped, tool-collapsed).
+	Format string
+	// NumberTurns marks where each turn starts in the transcript, for prompts that cite turns.
+	NumberTurns bool
 }
 
 func (s openAISummarizer) SummarizeChunk(ctx context.Context, chunk migration.Chunk, glossaryExcerpt string) (summarizeResponse, error) {
-	return s.SummarizeChunkWithOptions(ctx, chunk, glossaryExcerpt, promptOptions{MaxTranscriptChars: 80_000, IncludeToolText: true})
+	return s.SummarizeChunkWithOptions(ctx, chunk, glossaryExcerpt, promptOptions{IncludeToolText: true})
 }
 
 func (s openAISummarizer) SummarizeChunkWithOptions(ctx context.Context, chunk migration.Chunk, glossaryExcerpt string, opt promptOptions) (summarizeResponse, error) {
@@ -777,6 +1544,9 @@ func (s openAISummarizer) SummarizeChunkWithOptions(ctx context.Context, chunk m
 		return summarizeResponse{}, errors.New("openAISummarizer: model is empty")
 	}
 
+	const maxOut = 2500
+	instructions := s.instructions.semanticFor(chunk.SourceType)
+	opt = s.sizeOptions(opt, s.model, instructions, summarizeSchema, maxOut)
 	input := buildChunkPromptInputWithOptions(chunk, glossaryExcerpt, opt)
 	format := responses.ResponseFormatTextConfigUnionParam{
 		OfJSONSchema: &responses.ResponseFormatTextJSONSchemaConfigParam{
@@ -790,8 +1560,8 @@ func (s openAISummarizer) SummarizeChunkWithOptions(ctx context.Context, chunk m
 
 	params := responses.ResponseNewParams{
 		Model:           s.model,
-		MaxOutputTokens: openai.Int(2500),
-		Instructions:    openai.String(chunkSummarizerPrompt),
+		MaxOutputTokens: openai.Int(maxOut),
+		Instructions:    openai.String(instructions),
 		ServiceTier:     responses.ResponseNewParamsServiceTierFlex,
 		Input: responses.ResponseNewParamsInputUnion{
 			OfInputItemList: []responses.ResponseInputItemUnionParam{
@@ -807,6 +1577,7 @@ func (s openAISummarizer) SummarizeChunkWithOptions(ctx context.Context, chunk m
 	if err != nil {
 		return summarizeResponse{}, err
 	}
+	s.budget.Record(s.model, resp.Usage)
 
 	var out summarizeResponse
 	if err := fileutils.DecodeModelJSON(resp.OutputText(), &out); err != nil {
@@ -817,7 +1588,7 @@ func (s openAISummarizer) SummarizeChunkWithOptions(ctx context.Context, chunk m
 }
 
 func (s openAISummarizer) SummarizeChunkSentiment(ctx context.Context, chunk migration.Chunk, glossaryExcerpt string) (summarizeSentimentResponse, error) {
-	return s.SummarizeChunkSentimentWithOptions(ctx, chunk, glossaryExcerpt, promptOptions{MaxTranscriptChars: 80_000, IncludeToolText: true})
+	return s.SummarizeChunkSentimentWithOptions(ctx, chunk, glossaryExcerpt, promptOptions{IncludeToolText: true})
 }
 
 func (s openAISummarizer) SummarizeChunkSentimentWithOptions(ctx context.Context, chunk migration.Chunk, glossaryExcerpt string, opt promptOptions) (summarizeSentimentResponse, error) {
@@ -827,15 +1598,23 @@ func (s openAISummarizer) SummarizeChunkSentimentWithOptions(ctx context.Context
 	if s.sentimentModel == "" {
 		return summarizeSentimentResponse{}, errors.New("openAISummarizer: sentiment model is empty")
 	}
-	if strings.TrimSpace(s.sentimentInstructions) == "" {
+	instructions, schema := s.instructions.sentimentFor(chunk.SourceType), summarizeSentimentSchema
+	if strings.TrimSpace(instructions) == "" {
 		return summarizeSentimentResponse{}, errors.New("openAISummarizer: sentiment instructions are empty")
 	}
 
+	const maxOut = 2500
+	if s.evidence {
+		instructions += "\n\n" + sentimentEvidencePrompt
+		schema = summarizeSentimentEvidenceSchema
+		opt.NumberTurns = true
+	}
+	opt = s.sizeOptions(opt, s.sentimentModel, instructions+chunkSentimentSystemTurnStub, schema, maxOut)
 	input := buildChunkPromptInputWithOptions(chunk, glossaryExcerpt, opt)
 	format := responses.ResponseFormatTextConfigUnionParam{
 		OfJSONSchema: &responses.ResponseFormatTextJSONSchemaConfigParam{
 			Name:        "ChunkSentimentSummary",
-			Schema:      summarizeSentimentSchema,
+			Schema:      schema,
 			Strict:      openai.Bool(true),
 			Description: openai.String("Chunk sentiment summary JSON"),
 			Type:        "json_schema",
@@ -844,8 +1623,8 @@ func (s openAISummarizer) SummarizeChunkSentimentWithOptions(ctx context.Context
 
 	params := responses.ResponseNewParams{
 		Model:           s.sentimentModel,
-		MaxOutputTokens: openai.Int(2500),
-		Instructions:    openai.String(s.sentimentInstructions),
+		MaxOutputTokens: openai.Int(maxOut),
+		Instructions:    openai.String(instructions),
 		ServiceTier:     responses.ResponseNewParamsServiceTierFlex,
 		Input: responses.ResponseNewParamsInputUnion{
 			OfInputItemList: []responses.ResponseInputItemUnionParam{
@@ -862,11 +1641,18 @@ func (s openAISummarizer) SummarizeChunkSentimentWithOptions(ctx context.Context
 	if err != nil {
 		return summarizeSentimentResponse{}, err
 	}
+	s.budget.Record(s.sentimentModel, resp.Usage)
 
 	var out summarizeSentimentResponse
 	if err := fileutils.DecodeModelJSON(resp.OutputText(), &out); err != nil {
 		return summarizeSentimentResponse{}, fmt.Errorf("unmarshal sentiment summary: %w", err)
 	}
+	if s.evidence {
+		if err := fileutils.DecodeModelJSON(resp.OutputText(), &out.Evidence); err != nil {
+			return summarizeSentimentResponse{}, fmt.Errorf("unmarshal sentiment evidence: %w", err)
+		}
+		out.Evidence.Normalize(chunk.TurnStart, chunk.TurnEnd)
+	}
 	out.EmotionalSummary = strings.TrimSpace(out.EmotionalSummary)
 	out.EmotionalArc = strings.TrimSpace(out.EmotionalArc)
 	out.RelationalShift = strings.TrimSpace(out.RelationalShift)
@@ -874,6 +1660,17 @@ func (s openAISummarizer) SummarizeChunkSentimentWithOptions(ctx context.Context
 	return out, nil
 }
 
+// sizeOptions fills in opt's input budget for a request to model with the given instructions, schema,
+// and output reservation, unless the caller set one.
+func (s openAISummarizer) sizeOptions(opt promptOptions, model, instructions string, schema any, maxOut int64) promptOptions {
+	if opt.MaxInputTokens <= 0 {
+		// At least one token, so a model whose context is already full sends no transcript rather than
+		// falling back to the default budget.
+		opt.MaxInputTokens = max(s.prompts.InputTokens(model, instructions, schema, maxOut), 1)
+	}
+	return opt
+}
+
 func composeSentimentInstructions(header string) string {
 	header = strings.TrimSpace(header)
 	if header == "" {
@@ -885,8 +1682,12 @@ func composeSentimentInstructions(header string) string {
 
 func buildChunkPromptInputWithOptions(chunk migration.Chunk, glossaryExcerpt string, opt promptOptions) string {
 	var b strings.Builder
-	fmt.Fprintf(&b, "chunk_metadata:\nconversation_id=%s\nchunk_number=%d\nturn_range=%d..%d\n\n",
+	fmt.Fprintf(&b, "chunk_metadata:\nconversation_id=%s\nchunk_number=%d\nturn_range=%d..%d\n",
 		chunk.ConversationID, chunk.ChunkNumber, chunk.TurnStart, chunk.TurnEnd)
+	if line := migration.ParticipantsLine(chunk.Participants); line != "" {
+		fmt.Fprintf(&b, "participants=%s\n", line)
+	}
+	b.WriteString("\n")
 
 	if glossaryExcerpt != "" {
 		b.WriteString("glossary:\n")
@@ -895,48 +1696,36 @@ func buildChunkPromptInputWithOptions(chunk migration.Chunk, glossaryExcerpt str
 	}
 
 	b.WriteString("transcript:\n")
-	maxTranscriptChars := opt.MaxTranscriptChars
-	if maxTranscriptChars <= 0 {
-		maxTranscriptChars = 80_000
-	}
-	total := 0
-	for _, m := range chunk.Messages {
-		role := m.Role
-		if role == "" {
-			role = "unknown"
-		}
-		name := ""
-		if m.Name != "" {
-			name = ":" + m.Name
-		}
-
-		line := ""
-		if !opt.IncludeToolText && role == "tool" {
-			// For retries / size pressure, keep tool outputs as compact references.
-			desc := strings.TrimSpace(m.ContentType)
-			if desc == "" {
-				desc = "tool"
-			}
-			parts := []string{"[tool", m.Name, desc, m.Title, m.URL}
-			line = strings.TrimSpace(strings.Join(parts, " "))
-		} else if strings.TrimSpace(m.Text) != "" {
-			line = m.Text
-		} else if m.URL != "" || m.Title != "" {
-			line = strings.TrimSpace(strings.Join([]string{m.Title, m.URL}, " "))
-		} else {
-			line = "[" + strings.TrimSpace(m.ContentType) + "]"
-		}
-		line = fileutils.Truncate(line, 2000)
-		row := fmt.Sprintf("- %s%s: %s\n", role, name, fileutils.SanitizeNewlines(line))
-		if total+len(row) > maxTranscriptChars {
+	maxInputTokens := opt.MaxInputTokens
+	if maxInputTokens <= 0 {
+		maxInputTokens = provider.DefaultInputTokens
+	}
+	if opt.Shrink {
+		maxInputTokens /= 2
+	}
+	render, err := newTranscriptRenderer(opt.Format)
+	if err != nil {
+		// Config.Validate rejects unknown formats; fall back rather than send an empty transcript.
+		render = renderCompact
+	}
+	msgs := chunk.Messages
+	if opt.NumberTurns {
+		msgs = numberTurns(chunk)
+	}
+	// Rows are rendered one at a time, so a huge chunk stops costing memory once the budget is spent.
+	left := maxInputTokens - provider.CountTokens(b.String())
+	for row := range render(msgs, opt) {
+		n := provider.CountTokens(row)
+		if n > left {
 			b.WriteString("... [transcript truncated]\n")
 			break
 		}
 		b.WriteString(row)
-		total += len(row)
+		left -= n
 	}
 	return b.String()
 }
+
 func loadPromptHeaderFromFile(path string) (string, error) {
 	if strings.TrimSpace(path) == "" {
 		return "", errors.New("sentiment-prompt-file is empty")
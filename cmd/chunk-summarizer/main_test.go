@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
 )
 
 func TestParseFlags_Overrides(t *testing.T) {
@@ -49,6 +58,100 @@ func TestParseFlags_Overrides(t *testing.T) {
 	}
 }
 
+func TestParseFlags_StrictAndFailuresPath(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("chunk-summarizer", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-strict", "-failures", "out/../fail.jsonl"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if !cfg.Strict {
+		t.Fatalf("Strict=false")
+	}
+	if cfg.FailuresPath != "fail.jsonl" {
+		t.Fatalf("FailuresPath=%q", cfg.FailuresPath)
+	}
+}
+
+func TestParseFlags_BudgetCaps(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("chunk-summarizer", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-max-usd", "2.5", "-max-tokens-total", "100000", "-budget-ledger", "out/../spend.json"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.MaxUSD != 2.5 || cfg.MaxTokensTotal != 100000 {
+		t.Fatalf("MaxUSD=%v MaxTokensTotal=%d", cfg.MaxUSD, cfg.MaxTokensTotal)
+	}
+	if cfg.BudgetLedger != "spend.json" {
+		t.Fatalf("BudgetLedger=%q", cfg.BudgetLedger)
+	}
+
+	cfg.MaxUSD = -1
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for negative -max-usd")
+	}
+}
+
+func TestParseFlags_SentimentIndexFields(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("chunk-summarizer", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-sentiment-index-fields", "themes,tone_markers"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if len(cfg.SentimentIndexFields) != 2 || !cfg.SentimentIndexFields["tone_markers"] {
+		t.Fatalf("SentimentIndexFields=%v", cfg.SentimentIndexFields)
+	}
+
+	fs = flag.NewFlagSet("chunk-summarizer", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if _, err := parseFlags(fs, []string{"-sentiment-index-fields", "mood"}); err == nil {
+		t.Fatalf("expected error for unknown sentiment index field")
+	}
+}
+
+func TestParseFlags_TurnSentiment(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("chunk-summarizer", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-turn-sentiment", "2024-01-01..2024-03-31", "-turn-sentiment-model", "gpt-5-nano"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if len(cfg.TurnSentiment) != 1 || cfg.TurnSentimentModel != "gpt-5-nano" {
+		t.Fatalf("TurnSentiment=%v model=%q", cfg.TurnSentiment, cfg.TurnSentimentModel)
+	}
+	cfg.Provider = providerExtractive
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for -turn-sentiment with the extractive provider")
+	}
+}
+
+func TestWriteTurnSentimentFile_AggregatesIntoSentiment(t *testing.T) {
+	t.Parallel()
+
+	in, out := t.TempDir(), t.TempDir()
+	chunkPath := filepath.Join(in, "c1", "chunk_0001.json")
+	ts := migration.ChunkTurnSentiment{ConversationID: "c1", TurnStart: 0, TurnEnd: 2, Turns: []migration.TurnSentiment{
+		{Turn: 0, Affect: "worry", Valence: -0.5, Intensity: 0.7},
+		{Turn: 1, Affect: "relief", Valence: 0.5, Intensity: 0.3},
+	}}
+	agg, err := writeTurnSentimentFile(in, out, chunkPath, ts, false)
+	if err != nil {
+		t.Fatalf("writeTurnSentimentFile: %v", err)
+	}
+	if agg.Path != "c1/chunk_0001"+migration.TurnSentimentSuffix || agg.Turns != 2 || agg.PeakTurn != 0 {
+		t.Fatalf("aggregate=%+v", agg)
+	}
+	if _, err := os.Stat(filepath.Join(out, filepath.FromSlash(agg.Path))); err != nil {
+		t.Fatalf("turns file: %v", err)
+	}
+}
+
 func TestLoadPromptHeaderFromFile(t *testing.T) {
 	t.Parallel()
 
@@ -81,6 +184,165 @@ func TestComposeSentimentInstructions_AppendsRequiredTail(t *testing.T) {
 	}
 }
 
+func TestBuildChunkPromptInput_LabelsToolCalls(t *testing.T) {
+	t.Parallel()
+
+	chunk := migration.Chunk{
+		ConversationID: "c1",
+		Messages: []migration.SimplifiedMessage{
+			{Role: "assistant", ContentType: "code", Text: "print(1)", ToolCall: &migration.ToolCall{Name: "python", Arguments: "print(1)"}},
+			{Role: "tool", Name: "python", ContentType: "execution_output", Text: "1", ToolCall: &migration.ToolCall{Name: "python", Status: "success"}},
+		},
+	}
+	got := buildChunkPromptInputWithOptions(chunk, "", promptOptions{IncludeToolText: true})
+	if !strings.Contains(got, "- assistant: [tool call python] print(1)") {
+		t.Fatalf("missing invocation label:\n%s", got)
+	}
+	if !strings.Contains(got, "- tool:python: [tool result python status=success] 1") {
+		t.Fatalf("missing result label:\n%s", got)
+	}
+
+	compact := buildChunkPromptInputWithOptions(chunk, "", promptOptions{IncludeToolText: false})
+	if !strings.Contains(compact, "- tool:python: [tool python execution_output") || !strings.Contains(compact, "status=success") {
+		t.Fatalf("compact tool reference missing status:\n%s", compact)
+	}
+}
+
+func TestBuildChunkPromptInput_NamesSpeakers(t *testing.T) {
+	t.Parallel()
+
+	msgs := []migration.SimplifiedMessage{
+		{Role: "user", Speaker: "Alice", Text: "lunch?"},
+		{Role: "user", Speaker: "Bob", Text: "yes"},
+		{Role: "assistant", Text: "booked"},
+	}
+	chunk := migration.Chunk{ConversationID: "g1", Participants: migration.MessageParticipants(msgs), Messages: msgs}
+	got := buildChunkPromptInputWithOptions(chunk, "", promptOptions{IncludeToolText: true})
+	for _, want := range []string{"participants=Alice (user), Bob (user)\n", "- user:Alice: lunch?\n", "- user:Bob: yes\n", "- assistant: booked\n"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %q:\n%s", want, got)
+		}
+	}
+
+	solo := buildChunkPromptInputWithOptions(migration.Chunk{ConversationID: "c1", Messages: []migration.SimplifiedMessage{{Role: "user", Text: "hi"}}}, "", promptOptions{})
+	if strings.Contains(solo, "participants=") {
+		t.Fatalf("unexpected participants line:\n%s", solo)
+	}
+}
+
+func TestBuildChunkPromptInput_TranscriptFormats(t *testing.T) {
+	t.Parallel()
+
+	chunk := migration.Chunk{
+		ConversationID: "c1",
+		Messages: []migration.SimplifiedMessage{
+			{Role: "user", Text: "plot this\nplease"},
+			{Role: "assistant", ContentType: "code", Text: "plot()", ToolCall: &migration.ToolCall{Name: "python"}},
+			{Role: "tool", Name: "python", Text: "<image>", ToolCall: &migration.ToolCall{Name: "python", Status: "success"}},
+			{Role: "assistant", Text: "Here it is."},
+			{Role: "assistant", Text: "Anything else?"},
+		},
+	}
+
+	md := buildChunkPromptInputWithOptions(chunk, "", promptOptions{IncludeToolText: true, Format: transcriptMarkdown})
+	if !strings.Contains(md, "### user\nplot this\nplease\n\n") {
+		t.Fatalf("markdown should keep line breaks:\n%s", md)
+	}
+
+	grouped := buildChunkPromptInputWithOptions(chunk, "", promptOptions{IncludeToolText: true, Format: transcriptRoleGrouped})
+	if strings.Count(grouped, "[assistant]\n") != 2 || !strings.Contains(grouped, "[assistant]\n  - Here it is.\n  - Anything else?\n") {
+		t.Fatalf("role-grouped should share one header per run:\n%s", grouped)
+	}
+
+	collapsed := buildChunkPromptInputWithOptions(chunk, "", promptOptions{IncludeToolText: true, Format: transcriptToolCollapsed})
+	if !strings.Contains(collapsed, "- tools: [2 tool messages: python call, python result status=success]\n") {
+		t.Fatalf("tool run not collapsed:\n%s", collapsed)
+	}
+	if strings.Contains(collapsed, "plot()") || strings.Contains(collapsed, "<image>") {
+		t.Fatalf("collapsed transcript kept tool text:\n%s", collapsed)
+	}
+}
+
+func TestBuildChunkPromptInput_TokenBudget(t *testing.T) {
+	t.Parallel()
+
+	var msgs []migration.SimplifiedMessage
+	for i := 0; i < 200; i++ {
+		msgs = append(msgs, migration.SimplifiedMessage{Role: "user", Text: strings.Repeat("visa paperwork ", 40)})
+	}
+	chunk := migration.Chunk{ConversationID: "c1", Messages: msgs}
+
+	got := buildChunkPromptInputWithOptions(chunk, "glossary line\n", promptOptions{MaxInputTokens: 2000, IncludeToolText: true})
+	if n := provider.CountTokens(got); n > 2000 {
+		t.Fatalf("input tokens=%d, budget 2000", n)
+	}
+	if !strings.HasSuffix(got, "... [transcript truncated]\n") || !strings.Contains(got, "glossary line") {
+		t.Fatalf("expected glossary kept and transcript truncated:\n%s", got[len(got)-200:])
+	}
+
+	half := buildChunkPromptInputWithOptions(chunk, "", promptOptions{MaxInputTokens: 2000, Shrink: true, IncludeToolText: true})
+	if n := provider.CountTokens(half); n > 1000 || n < 800 {
+		t.Fatalf("shrunk input tokens=%d, want just under 1000", n)
+	}
+
+	// The summarizer sizes the budget from the model's context window and its -prompt-budget entry.
+	budget, _ := provider.ParsePromptBudget("gpt-5-mini=3000")
+	s := openAISummarizer{model: "gpt-5-mini", prompts: budget}
+	opt := s.sizeOptions(promptOptions{}, s.model, composeChunkInstructions(""), summarizeSchema, 2500)
+	if opt.MaxInputTokens != 3000 {
+		t.Fatalf("MaxInputTokens=%d", opt.MaxInputTokens)
+	}
+}
+
+func TestBuildChunkPromptInput_NumberTurnsForEvidence(t *testing.T) {
+	t.Parallel()
+
+	chunk := migration.Chunk{ConversationID: "c1", TurnStart: 4, TurnEnd: 6, Messages: []migration.SimplifiedMessage{
+		{Role: "user", Text: "first question"},
+		{Role: "assistant", Text: "an answer"},
+		{Role: "user", Text: "a follow-up"},
+	}}
+	got := buildChunkPromptInputWithOptions(chunk, "", promptOptions{NumberTurns: true})
+	if !strings.Contains(got, "[turn 4] first question") || !strings.Contains(got, "[turn 5] a follow-up") || strings.Contains(got, "[turn 4] an answer") {
+		t.Fatalf("turns not numbered:\n%s", got)
+	}
+	if chunk.Messages[0].Text != "first question" {
+		t.Fatalf("chunk messages modified: %q", chunk.Messages[0].Text)
+	}
+	if plain := buildChunkPromptInputWithOptions(chunk, "", promptOptions{}); strings.Contains(plain, "[turn") {
+		t.Fatalf("turns numbered without NumberTurns:\n%s", plain)
+	}
+
+	props := summarizeSentimentEvidenceSchema["properties"].(map[string]interface{})
+	if props["emotion_confidence"] == nil || props["tension_evidence"] == nil || props["emotional_summary"] == nil {
+		t.Fatalf("evidence schema properties=%v", props)
+	}
+	if base := summarizeSentimentSchema["properties"].(map[string]interface{}); base["emotion_confidence"] != nil {
+		t.Fatalf("base sentiment schema changed: %v", base)
+	}
+}
+
+func TestParseFlags_TranscriptFormats(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("chunk-summarizer", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-transcript-format", "markdown"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.TranscriptFormat != transcriptMarkdown || cfg.SentimentTranscriptFormat != transcriptMarkdown {
+		t.Fatalf("TranscriptFormat=%q SentimentTranscriptFormat=%q", cfg.TranscriptFormat, cfg.SentimentTranscriptFormat)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	cfg.SentimentTranscriptFormat = "xml"
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for unknown transcript format")
+	}
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -113,3 +375,528 @@ func TestCollectChunkFiles_DirRecursiveAndSkipsSummaryFiles(t *testing.T) {
 		t.Fatalf("got %s", files[0])
 	}
 }
+
+func TestOrderChunkFilesByThread_GroupsAndSortsByChunkNumber(t *testing.T) {
+	t.Parallel()
+
+	in := []string{
+		filepath.Join("chunks", "a", "100_1.json"),
+		filepath.Join("chunks", "a", "100_10.json"),
+		filepath.Join("chunks", "a", "100_2.json"),
+		filepath.Join("chunks", "b", "200_1.json"),
+		filepath.Join("chunks", "b", "200_2.json"),
+	}
+	got := orderChunkFilesByThread(in)
+	want := []string{in[0], in[2], in[1], in[3], in[4]}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("got=%v want=%v", got, want)
+	}
+}
+
+func TestParseFlags_ExtractiveProviderAndThreads(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("chunk-summarizer", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-provider", "extractive", "-threads", "a, b,,"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.Model != migration.ExtractiveModel || cfg.SentimentModel != migration.ExtractiveModel {
+		t.Fatalf("Model=%q SentimentModel=%q", cfg.Model, cfg.SentimentModel)
+	}
+	if strings.Join(cfg.Threads, ",") != "a,b" {
+		t.Fatalf("Threads=%q", cfg.Threads)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	cfg.Backfill = backfillSentiment
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for -backfill with the extractive provider")
+	}
+	cfg.Backfill, cfg.Provider = "", "local"
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for unknown provider")
+	}
+}
+
+func TestFilterChunkFilesByThread(t *testing.T) {
+	t.Parallel()
+
+	in := []string{
+		filepath.Join("chunks", "a", "100_1.json"),
+		filepath.Join("chunks", "b", "200_1.json"),
+		filepath.Join("chunks", "c", "300_1.json"),
+	}
+	got := filterChunkFilesByThread(in, []string{"c", "a", "missing"})
+	if strings.Join(got, ",") != strings.Join([]string{in[0], in[2]}, ",") {
+		t.Fatalf("got=%v", got)
+	}
+}
+
+func TestExtractiveSummarizer_SemanticOnly(t *testing.T) {
+	t.Parallel()
+
+	chunk := migration.Chunk{Messages: []migration.SimplifiedMessage{
+		{Role: "user", Text: "Can you plan the garden beds for spring planting?"},
+		{Role: "assistant", Text: "Sure. The garden beds need compost before spring planting starts."},
+	}}
+	var s chunkSummarizer = extractiveSummarizer{}
+	resp, err := s.SummarizeChunkWithOptions(context.Background(), chunk, "", promptOptions{})
+	if err != nil {
+		t.Fatalf("SummarizeChunkWithOptions: %v", err)
+	}
+	if !strings.HasPrefix(resp.Summary, "User: Can you plan the garden beds") || len(resp.Tags) == 0 {
+		t.Fatalf("resp=%+v", resp)
+	}
+	if _, err := s.SummarizeChunkSentimentWithOptions(context.Background(), chunk, "", promptOptions{}); err == nil {
+		t.Fatalf("expected the extractive provider to refuse sentiment summaries")
+	}
+}
+
+func TestConfigValidate_Schedule(t *testing.T) {
+	t.Parallel()
+
+	cfg := defaultConfig()
+	cfg.SentimentModel = cfg.Model
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("default Validate: %v", err)
+	}
+	cfg.Schedule = "random"
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for unknown schedule")
+	}
+}
+
+func TestScanChunkArtifacts_FlagsTruncatedSummaries(t *testing.T) {
+	t.Parallel()
+
+	in := t.TempDir()
+	out := t.TempDir()
+	good := filepath.Join(in, "t", "1_1.json")
+	bad := filepath.Join(in, "t", "1_2.json")
+	cfg := Config{InPath: in, OutDir: out, Rescan: true}
+
+	write := func(path, body string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	write(good, `{}`)
+	write(bad, `{}`)
+	write(semanticSummaryOutPath(in, out, good), `{"summary":"All done.","key_points":["k"]}`)
+	write(sentimentSummaryOutPath(in, out, good), `{"emotional_summary":"Calm."}`)
+	write(semanticSummaryOutPath(in, out, bad), `{"summary":"They started to","key_points":["k"]}`)
+	write(sentimentSummaryOutPath(in, out, bad), `{"emotional_summary":"Calm."}`)
+
+	regen := scanChunkArtifacts(cfg, []string{good, bad})
+	if len(regen) != 1 || !regen[bad] {
+		t.Fatalf("regen=%v", regen)
+	}
+}
+
+func TestConfigValidate_Backfill(t *testing.T) {
+	t.Parallel()
+
+	cfg := defaultConfig()
+	cfg.SentimentModel = cfg.Model
+	cfg.Backfill = backfillSentiment
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	cfg.Backfill = "semantic"
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for unknown backfill pass")
+	}
+	cfg.Backfill = backfillSentiment
+	cfg.Overwrite = true
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for -backfill with -overwrite")
+	}
+}
+
+type fakeTermsExtractor struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (f *fakeTermsExtractor) ExtractTerms(_ context.Context, chunk migration.Chunk) (termsResponse, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, chunk.Title)
+	f.mu.Unlock()
+	if chunk.Title == "broken" {
+		return termsResponse{}, errors.New("model unavailable")
+	}
+	return termsResponse{
+		Terms:             []string{"Arroios", chunk.Title},
+		GlossaryAdditions: []migration.GlossaryAddition{{Term: "NIF", Definition: "Portuguese tax number"}},
+	}, nil
+}
+
+func TestRunTermsPass_BuildsGlossaryAndResumes(t *testing.T) {
+	t.Parallel()
+
+	in := t.TempDir()
+	out := t.TempDir()
+	var chunkFiles []string
+	for i, title := range []string{"visa", "flat", "broken"} {
+		p := filepath.Join(in, "t", fmt.Sprintf("t_%d.json", i+1))
+		chunk := migration.Chunk{ConversationID: "t", ChunkNumber: i + 1, Title: title, Messages: []migration.SimplifiedMessage{{Role: "user", Text: "Moving to Lisbon."}}}
+		if err := fileutils.WriteJSONFileAtomic(p, chunk, false); err != nil {
+			t.Fatalf("write chunk: %v", err)
+		}
+		chunkFiles = append(chunkFiles, p)
+	}
+	cfg := Config{InPath: in, OutDir: out, TermsModel: "gpt-5-nano", Concurrency: 2, BatchSize: 2}
+	glossaryPath := filepath.Join(out, "glossary.json")
+	glossary, err := migration.LoadGlossary(glossaryPath)
+	if err != nil {
+		t.Fatalf("LoadGlossary: %v", err)
+	}
+
+	ex := &fakeTermsExtractor{}
+	stats, err := runTermsPass(context.Background(), cfg, ex, nil, chunkFiles, &glossary, glossaryPath)
+	if err != nil {
+		t.Fatalf("runTermsPass: %v", err)
+	}
+	if stats.Extracted != 2 || stats.Failed != 1 || stats.Skipped != 0 {
+		t.Fatalf("stats=%+v", stats)
+	}
+	saved, err := migration.LoadGlossary(glossaryPath)
+	if err != nil {
+		t.Fatalf("LoadGlossary(saved): %v", err)
+	}
+	counts := map[string]int{}
+	for _, e := range saved.Entries {
+		counts[e.Term] = e.Count
+	}
+	if counts["Arroios"] != 2 || counts["NIF"] != 2 || counts["visa"] != 1 {
+		t.Fatalf("glossary counts=%v", counts)
+	}
+
+	// A rerun extracts only the chunk that failed.
+	ex2 := &fakeTermsExtractor{}
+	stats, err = runTermsPass(context.Background(), cfg, ex2, nil, chunkFiles, &saved, glossaryPath)
+	if err != nil {
+		t.Fatalf("runTermsPass(rerun): %v", err)
+	}
+	if stats.Skipped != 2 || len(ex2.calls) != 1 || ex2.calls[0] != "broken" {
+		t.Fatalf("rerun stats=%+v calls=%v", stats, ex2.calls)
+	}
+}
+
+func TestSnapshotPromptGlossary_RecordsExcerptProvenance(t *testing.T) {
+	t.Parallel()
+
+	out := t.TempDir()
+	excerpt, ref, err := snapshotPromptGlossary(out, migration.Glossary{Version: 1}, 50)
+	if err != nil || excerpt != "" || ref != nil {
+		t.Fatalf("empty glossary: excerpt=%q ref=%+v err=%v", excerpt, ref, err)
+	}
+
+	g := migration.Glossary{Version: 1, Entries: []migration.GlossaryEntry{
+		{Term: "Vix", Definition: "companion agent", Count: 3},
+		{Term: "undefined", Count: 2},
+		{Term: "Lisbon plan", Definition: "the 2024 move", Count: 1},
+	}}
+	excerpt, ref, err = snapshotPromptGlossary(out, g, 50)
+	if err != nil {
+		t.Fatalf("snapshotPromptGlossary: %v", err)
+	}
+	if ref == nil || ref.SHA256 != migration.GlossaryExcerptSHA256(excerpt) || strings.Join(ref.Terms, ",") != "Vix,Lisbon plan" {
+		t.Fatalf("ref=%+v", ref)
+	}
+	if ref.Snapshot != migration.GlossarySnapshotsDirName+"/"+migration.GlossarySnapshotName(ref.SHA256) || !fileutils.FileExists(filepath.Join(out, ref.Snapshot)) {
+		t.Fatalf("snapshot=%q not written", ref.Snapshot)
+	}
+}
+
+func TestConfigValidate_TermsPass(t *testing.T) {
+	t.Parallel()
+
+	cfg := defaultConfig()
+	cfg.SentimentModel = cfg.Model
+	cfg.TermsOnly = true
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for -terms-only without -terms-model")
+	}
+	cfg.TermsModel = "gpt-5-nano"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	cfg.Provider = providerExtractive
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for -terms-model with the extractive provider")
+	}
+}
+
+func TestSentimentBackfillCandidates(t *testing.T) {
+	t.Parallel()
+
+	in := t.TempDir()
+	out := t.TempDir()
+	cfg := Config{InPath: in, OutDir: out, Backfill: backfillSentiment}
+	both := filepath.Join(in, "t", "1_1.json")
+	semOnly := filepath.Join(in, "t", "1_2.json")
+	neither := filepath.Join(in, "t", "1_3.json")
+
+	write := func(path, body string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	for _, p := range []string{both, semOnly, neither} {
+		write(p, `{}`)
+	}
+	write(semanticSummaryOutPath(in, out, both), `{"summary":"Done."}`)
+	write(sentimentSummaryOutPath(in, out, both), `{"emotional_summary":"Calm."}`)
+	write(semanticSummaryOutPath(in, out, semOnly), `{"summary":"Done."}`)
+
+	got := sentimentBackfillCandidates(cfg, []string{both, semOnly, neither})
+	if len(got) != 1 || got[0] != semOnly {
+		t.Fatalf("candidates=%v", got)
+	}
+}
+
+func TestRebuildSentimentIndex_LeavesSemanticIndex(t *testing.T) {
+	t.Parallel()
+
+	in := t.TempDir()
+	out := t.TempDir()
+	cfg := Config{InPath: in, OutDir: out}
+	chunkPath := filepath.Join(in, "t", "1_1.json")
+	if err := os.MkdirAll(filepath.Dir(chunkPath), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(chunkPath, []byte(`{"conversation_id":"c1","chunk_number":1}`), 0o644); err != nil {
+		t.Fatalf("write chunk: %v", err)
+	}
+	sentOut := sentimentSummaryOutPath(in, out, chunkPath)
+	if err := os.MkdirAll(filepath.Dir(sentOut), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(sentOut, []byte(`{"conversation_id":"c1","emotional_summary":"Calm."}`), 0o644); err != nil {
+		t.Fatalf("write sentiment: %v", err)
+	}
+	indexPath := filepath.Join(out, "index.json")
+	if err := os.WriteFile(indexPath, []byte("existing\n"), 0o644); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	sentIndexPath := filepath.Join(out, "sentiment_index.json")
+	if err := rebuildSentimentIndex(cfg, sentIndexPath); err != nil {
+		t.Fatalf("rebuildSentimentIndex: %v", err)
+	}
+	b, err := os.ReadFile(sentIndexPath)
+	if err != nil {
+		t.Fatalf("read sentiment index: %v", err)
+	}
+	if !strings.Contains(string(b), "Calm.") {
+		t.Fatalf("sentiment index=%q", b)
+	}
+	if b, _ := os.ReadFile(indexPath); string(b) != "existing\n" {
+		t.Fatalf("index.json rewritten: %q", b)
+	}
+}
+
+func TestAppendIndexRows_SupersedesEarlierRows(t *testing.T) {
+	t.Parallel()
+
+	in := t.TempDir()
+	out := t.TempDir()
+	cfg := defaultConfig()
+	cfg.InPath, cfg.OutDir = in, out
+	chunkPath := filepath.Join(in, "t", "1_1.json")
+	write := func(path, body string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	write(chunkPath, `{"conversation_id":"c1","chunk_number":1}`)
+	indexPath := filepath.Join(out, "index.json")
+	sentIndexPath := filepath.Join(out, "sentiment_index.json")
+
+	write(semanticSummaryOutPath(in, out, chunkPath), `{"summary":"First.","key_points":["a","b"]}`)
+	write(sentimentSummaryOutPath(in, out, chunkPath), `{"emotional_summary":"Calm."}`)
+	if err := rebuildIndices(cfg, indexPath, sentIndexPath); err != nil {
+		t.Fatalf("rebuildIndices: %v", err)
+	}
+	write(semanticSummaryOutPath(in, out, chunkPath), `{"summary":"Second.","key_points":["c"]}`)
+	if err := appendIndexRows(cfg, indexPath, sentIndexPath, []string{chunkPath}); err != nil {
+		t.Fatalf("appendIndexRows: %v", err)
+	}
+
+	lines := func(path string) []string {
+		t.Helper()
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		return strings.Split(strings.TrimSpace(string(b)), "\n")
+	}
+	if got := lines(indexPath); len(got) != 2 || !strings.Contains(got[1], "Second.") {
+		t.Fatalf("index=%v", got)
+	}
+	if got := lines(keyPointsPath(indexPath)); len(got) != 3 {
+		t.Fatalf("key points=%v", got)
+	}
+
+	for _, p := range []string{indexPath, keyPointsPath(indexPath), sentIndexPath} {
+		key, _ := migration.IndexKey(p)
+		if _, err := fileutils.CompactJSONL(p, key); err != nil {
+			t.Fatalf("CompactJSONL %s: %v", p, err)
+		}
+	}
+	if got := lines(indexPath); len(got) != 1 || !strings.Contains(got[0], "Second.") {
+		t.Fatalf("compacted index=%v", got)
+	}
+	if got := lines(keyPointsPath(indexPath)); len(got) != 1 || !strings.Contains(got[0], `"text":"c"`) {
+		t.Fatalf("compacted key points=%v", got)
+	}
+	if got := lines(sentIndexPath); len(got) != 1 {
+		t.Fatalf("compacted sentiment index=%v", got)
+	}
+}
+
+var record = flag.Bool("record", false, "re-record testdata cassettes against the OpenAI API (needs OPENAI_API_KEY)")
+
+func TestBuildSourceInstructions(t *testing.T) {
+	t.Parallel()
+
+	got, err := buildSourceInstructions("", "", nil)
+	if err != nil {
+		t.Fatalf("buildSourceInstructions: %v", err)
+	}
+	chatgpt := got.semanticFor("")
+	if chatgpt != composeChunkInstructions("") || got.semanticFor("slack") != chatgpt {
+		t.Fatalf("unknown and legacy chunks should get the ChatGPT prompt")
+	}
+	email := got.semanticFor(migration.SourceTypeEmail)
+	if !strings.Contains(email, "email thread") || !strings.HasSuffix(email, chunkSummarizerPromptRequiredTail) {
+		t.Fatalf("email prompt lacks its header or the required tail: %q", email)
+	}
+	if s := got.sentimentFor(migration.SourceTypeJournal); !strings.Contains(s, "personal journal") || !strings.HasSuffix(s, "Return only JSON matching the schema.") {
+		t.Fatalf("journal sentiment prompt=%q", s)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "journal.md"), []byte("Journal header\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Email.sentiment.md"), []byte("Email feelings"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	got, err = buildSourceInstructions(dir, "Persona", &migration.StyleProfile{Formality: migration.FormalityFormal})
+	if err != nil {
+		t.Fatalf("buildSourceInstructions(dir): %v", err)
+	}
+	if s := got.semanticFor(migration.SourceTypeJournal); !strings.HasPrefix(s, "Journal header\n\nSECURITY / SAFETY:") || !strings.Contains(s, "OUTPUT STYLE") {
+		t.Fatalf("journal prompt=%q", s)
+	}
+	if s := got.sentimentFor(migration.SourceTypeEmail); !strings.HasPrefix(s, "Email feelings\n\nSECURITY:") {
+		t.Fatalf("email sentiment prompt=%q", s)
+	}
+	// -sentiment-prompt-file covers every source without its own file.
+	if s := got.sentimentFor(migration.SourceTypeWhatsApp); !strings.HasPrefix(s, "Persona\n\n") {
+		t.Fatalf("whatsapp sentiment prompt=%q", s)
+	}
+
+	if _, err := buildSourceInstructions(t.TempDir(), "", nil); err == nil {
+		t.Fatalf("expected error for a directory without prompts")
+	}
+}
+
+func TestOpenAISummarizer_Cassette(t *testing.T) {
+	t.Parallel()
+
+	cas, err := provider.OpenCassette(filepath.Join("testdata", "summarize.cassette.json"), *record)
+	if err != nil {
+		t.Fatalf("OpenCassette: %v", err)
+	}
+	defer func() {
+		if err := cas.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}()
+	client := cas.Client()
+	instructions, err := buildSourceInstructions("", "", nil)
+	if err != nil {
+		t.Fatalf("buildSourceInstructions: %v", err)
+	}
+	s := openAISummarizer{
+		client:         &client,
+		model:          "gpt-5-mini",
+		sentimentModel: "gpt-5-mini",
+		instructions:   instructions,
+	}
+	chunk := migration.Chunk{
+		ConversationID: "cassette-lisbon",
+		Title:          "Moving to Lisbon",
+		ChunkNumber:    0,
+		TurnStart:      0,
+		TurnEnd:        4,
+		Messages: []migration.SimplifiedMessage{
+			{Role: "user", Text: "I got the job offer in Lisbon. I'm excited but nervous about the D7 visa paperwork and finding a flat before September."},
+			{Role: "assistant", Text: "Congratulations! For the D7 you'll need proof of passive income, a Portuguese tax number (NIF), and 12 months of accommodation. Start with the NIF; a lawyer or service can get it remotely in about a week."},
+			{Role: "user", Text: "Okay, NIF first. My budget for a one-bedroom is about 1200 euros. Is Arroios realistic?"},
+			{Role: "assistant", Text: "Arroios is realistic at that budget, though the best flats go fast. Have your documents ready and plan a short scouting trip in July."},
+		},
+	}
+
+	sum, err := s.SummarizeChunk(context.Background(), chunk, "")
+	if err != nil {
+		t.Fatalf("SummarizeChunk: %v", err)
+	}
+	if sum.Summary == "" || len(sum.KeyPoints) == 0 || len(sum.Tags) == 0 {
+		t.Fatalf("summary=%+v", sum)
+	}
+	sent, err := s.SummarizeChunkSentiment(context.Background(), chunk, "")
+	if err != nil {
+		t.Fatalf("SummarizeChunkSentiment: %v", err)
+	}
+	if sent.EmotionalSummary == "" || len(sent.DominantEmotions) == 0 {
+		t.Fatalf("sentiment=%+v", sent)
+	}
+}
+
+func TestWriteSummaryFile_CanonicalJSON(t *testing.T) {
+	// Not parallel: -canonical-json is process-wide.
+	fileutils.SetCanonicalJSON(true)
+	defer fileutils.SetCanonicalJSON(false)
+
+	dir := t.TempDir()
+	in := filepath.Join(dir, "chunks")
+	start := 1717333333.5
+	summary := migration.ChunkSummary{ConversationID: "c1", ThreadStart: &start, ChunkNumber: 1, TurnEnd: 2, Summary: "s"}
+	for _, pretty := range []bool{false, true} {
+		out := filepath.Join(dir, fmt.Sprintf("out-%v", pretty))
+		path, err := writeSummaryFile(in, out, filepath.Join(in, "c1", "1.json"), summary, pretty, false)
+		if err != nil {
+			t.Fatalf("writeSummaryFile(pretty=%v): %v", pretty, err)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Keys are sorted, so chunk_number precedes conversation_id despite the struct order.
+		if i, j := strings.Index(string(b), `"chunk_number"`), strings.Index(string(b), `"conversation_id"`); i < 0 || j < 0 || i > j {
+			t.Fatalf("pretty=%v: summary not canonical:\n%s", pretty, b)
+		}
+		var got migration.ChunkSummary
+		if err := fileutils.ReadArtifact(path, &got); err != nil || got.Summary != "s" {
+			t.Fatalf("pretty=%v: ReadArtifact=%+v err=%v", pretty, got, err)
+		}
+	}
+}
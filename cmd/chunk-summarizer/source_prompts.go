@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+)
+
+// sentimentPromptSuffix marks -source-prompts files that hold a sentiment header.
+const sentimentPromptSuffix = ".sentiment.md"
+
+// sourceInstructions are the summary instructions per source type (see migration.NormalizeSourceType).
+// Each is a header framing the source, the required tail every source shares, and the -style section.
+// Source types without their own variant use the ChatGPT one.
+type sourceInstructions struct {
+	semantic  map[string]string
+	sentiment map[string]string
+}
+
+// buildSourceInstructions composes the instructions for every source type. A header comes from, in
+// order: <source_type>.md (semantic) or <source_type>.sentiment.md (sentiment) in promptDir; for
+// sentiment, sentimentHeader from -sentiment-prompt-file, which applies to every source; then the
+// built-in variant for the source.
+func buildSourceInstructions(promptDir, sentimentHeader string, style *migration.StyleProfile) (sourceInstructions, error) {
+	semantic := map[string]string{migration.SourceTypeChatGPT: chunkSummarizerPromptHeader}
+	for k, v := range chunkSummarizerSourceHeaders {
+		semantic[k] = v
+	}
+	sentiment := map[string]string{migration.SourceTypeChatGPT: defaultSentimentPromptHeader}
+	for k, v := range sentimentSourceHeaders {
+		sentiment[k] = v
+	}
+	if sentimentHeader != "" {
+		for k := range sentiment {
+			sentiment[k] = sentimentHeader
+		}
+	}
+	if promptDir != "" {
+		semanticFiles, sentimentFiles, err := loadSourcePromptDir(promptDir)
+		if err != nil {
+			return sourceInstructions{}, err
+		}
+		for k, v := range semanticFiles {
+			semantic[k] = v
+		}
+		for k, v := range sentimentFiles {
+			sentiment[k] = v
+		}
+	}
+
+	out := sourceInstructions{semantic: map[string]string{}, sentiment: map[string]string{}}
+	for k, header := range semantic {
+		out.semantic[k] = style.Instructions(composeChunkInstructions(header))
+	}
+	for k, header := range sentiment {
+		out.sentiment[k] = style.Instructions(composeSentimentInstructions(header))
+	}
+	return out, nil
+}
+
+// semanticFor returns the semantic instructions for a chunk of sourceType.
+func (s sourceInstructions) semanticFor(sourceType string) string {
+	if v, ok := s.semantic[migration.NormalizeSourceType(sourceType)]; ok {
+		return v
+	}
+	return s.semantic[migration.SourceTypeChatGPT]
+}
+
+// sentimentFor returns the sentiment instructions for a chunk of sourceType.
+func (s sourceInstructions) sentimentFor(sourceType string) string {
+	if v, ok := s.sentiment[migration.NormalizeSourceType(sourceType)]; ok {
+		return v
+	}
+	return s.sentiment[migration.SourceTypeChatGPT]
+}
+
+// loadSourcePromptDir reads the -source-prompts headers: <source_type>.md for the semantic pass and
+// <source_type>.sentiment.md for the sentiment pass, keyed by lowercased source type.
+func loadSourcePromptDir(dir string) (semantic, sentiment map[string]string, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read source-prompts: %w", err)
+	}
+	semantic, sentiment = map[string]string{}, map[string]string{}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.EqualFold(filepath.Ext(name), ".md") {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, nil, fmt.Errorf("read source-prompts: %w", err)
+		}
+		header := strings.TrimSpace(string(b))
+		if header == "" {
+			return nil, nil, fmt.Errorf("source-prompts: %s is empty", name)
+		}
+		lower := strings.ToLower(name)
+		if source, ok := strings.CutSuffix(lower, sentimentPromptSuffix); ok {
+			sentiment[source] = header
+		} else {
+			semantic[strings.TrimSuffix(lower, ".md")] = header
+		}
+	}
+	if len(semantic) == 0 && len(sentiment) == 0 {
+		return nil, nil, errors.New("source-prompts: no <source_type>.md or <source_type>.sentiment.md files in " + dir)
+	}
+	return semantic, sentiment, nil
+}
+
+// composeChunkInstructions is composeSentimentInstructions for the semantic prompt.
+func composeChunkInstructions(header string) string {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		header = chunkSummarizerPromptHeader
+	}
+	return header + "\n\n" + chunkSummarizerPromptRequiredTail
+}
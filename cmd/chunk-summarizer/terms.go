@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/responses"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
+)
+
+// termsPassFileName is the terms pass ledger in the output directory: one row per chunk whose terms are
+// already in the glossary, so a rerun only extracts terms from new chunks.
+const termsPassFileName = "terms_pass.jsonl"
+
+// termsMaxOutputTokens is small: the pass returns a short list of terms and definitions.
+const termsMaxOutputTokens = 800
+
+type termsResponse struct {
+	Terms             []string                     `json:"terms"`
+	GlossaryAdditions []migration.GlossaryAddition `json:"glossary_additions"`
+}
+
+var termsSchema = provider.GenerateSchema[termsResponse]()
+
+// termsExtractor pulls only glossary material (terms and short definitions) out of a chunk, so a cheap
+// model can build the glossary before the summary passes run.
+type termsExtractor interface {
+	ExtractTerms(ctx context.Context, chunk migration.Chunk) (termsResponse, error)
+}
+
+type openAITermsExtractor struct {
+	client  *openai.Client
+	budget  *provider.Budget
+	model   string
+	prompts provider.PromptBudget
+	// language is -output-language, for the definitions.
+	language string
+}
+
+func (e openAITermsExtractor) ExtractTerms(ctx context.Context, chunk migration.Chunk) (termsResponse, error) {
+	if e.client == nil {
+		return termsResponse{}, errors.New("openAITermsExtractor: client is nil")
+	}
+	if e.model == "" {
+		return termsResponse{}, errors.New("openAITermsExtractor: model is empty")
+	}
+
+	instructions := migration.LanguageInstructions(termsPrompt, e.language)
+	opt := promptOptions{
+		MaxInputTokens:  max(e.prompts.InputTokens(e.model, instructions, termsSchema, termsMaxOutputTokens), 1),
+		IncludeToolText: false,
+	}
+	input := buildChunkPromptInputWithOptions(chunk, "", opt)
+	params := responses.ResponseNewParams{
+		Model:           e.model,
+		MaxOutputTokens: openai.Int(termsMaxOutputTokens),
+		Instructions:    openai.String(instructions),
+		ServiceTier:     responses.ResponseNewParamsServiceTierFlex,
+		Input: responses.ResponseNewParamsInputUnion{
+			OfInputItemList: []responses.ResponseInputItemUnionParam{
+				responses.ResponseInputItemParamOfMessage(input, responses.EasyInputMessageRoleUser),
+			},
+		},
+		Text: responses.ResponseTextConfigParam{
+			Format: responses.ResponseFormatTextConfigUnionParam{
+				OfJSONSchema: &responses.ResponseFormatTextJSONSchemaConfigParam{
+					Name:        "ChunkTerms",
+					Schema:      termsSchema,
+					Strict:      openai.Bool(true),
+					Description: openai.String("Chunk terms JSON"),
+					Type:        "json_schema",
+				},
+			},
+		},
+	}
+
+	resp, err := provider.CallWithRetry(ctx, e.client, params)
+	if err != nil {
+		return termsResponse{}, err
+	}
+	e.budget.Record(e.model, resp.Usage)
+
+	var out termsResponse
+	if err := fileutils.DecodeModelJSON(resp.OutputText(), &out); err != nil {
+		return termsResponse{}, fmt.Errorf("unmarshal terms: %w", err)
+	}
+	return out, nil
+}
+
+// termsPassRow is one line of the terms pass ledger.
+type termsPassRow struct {
+	Chunk string `json:"chunk"`
+	Model string `json:"model"`
+	Terms int    `json:"terms"`
+}
+
+type termsPassStats struct {
+	Extracted int
+	Skipped   int
+	Failed    int
+	// BudgetExhausted is set when the pass stopped scheduling chunks because a spend cap was reached.
+	BudgetExhausted bool
+}
+
+// runTermsPass extracts terms from every chunk not yet in the ledger and merges them into glossary,
+// saving it after each batch, so the summary passes start with the whole archive's glossary. Chunks
+// are recorded in the ledger only after the glossary holding their terms is saved; an interrupted pass
+// therefore redoes at most one batch. Unreadable or failed chunks are reported and left for a rerun.
+func runTermsPass(ctx context.Context, cfg Config, ex termsExtractor, budget *provider.Budget, chunkFiles []string, glossary *migration.Glossary, glossaryPath string) (termsPassStats, error) {
+	var stats termsPassStats
+	ledgerPath := filepath.Join(cfg.OutDir, termsPassFileName)
+	done, err := readTermsPassLedger(ledgerPath)
+	if err != nil {
+		return stats, err
+	}
+	var todo []string
+	for _, p := range chunkFiles {
+		if done[termsPassKey(cfg.InPath, p)] {
+			stats.Skipped++
+			continue
+		}
+		todo = append(todo, p)
+	}
+	if len(todo) == 0 {
+		return stats, nil
+	}
+
+	ledger, err := fileutils.AppendJSONL(ledgerPath)
+	if err != nil {
+		return stats, fmt.Errorf("open terms pass ledger: %w", err)
+	}
+	defer ledger.Close()
+
+	start := time.Now()
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(todo)
+	}
+	var extracted int64
+	for bstart := 0; bstart < len(todo); bstart += batchSize {
+		batch := todo[bstart:min(bstart+batchSize, len(todo))]
+
+		type result struct {
+			row    termsPassRow
+			update glossaryUpdate
+		}
+		results := make(chan result, len(batch))
+		var failed atomic.Int64
+		jobs := make(chan string)
+		var wg sync.WaitGroup
+		for w := 0; w < max(cfg.Concurrency, 1); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for chunkPath := range jobs {
+					chunk, err := readChunkFile(chunkPath)
+					if err == nil {
+						var out termsResponse
+						if out, err = ex.ExtractTerms(ctx, chunk); err == nil {
+							additions := append([]migration.GlossaryAddition(nil), out.GlossaryAdditions...)
+							for _, t := range out.Terms {
+								additions = append(additions, migration.GlossaryAddition{Term: t})
+							}
+							results <- result{
+								row:    termsPassRow{Chunk: termsPassKey(cfg.InPath, chunkPath), Model: cfg.TermsModel, Terms: len(additions)},
+								update: glossaryUpdate{Additions: additions, SeenAt: chunk.ThreadStart},
+							}
+							n := atomic.AddInt64(&extracted, 1)
+							fmt.Fprintf(os.Stderr, "progress terms pass: %d/%d chunks (last=%s elapsed=%s)\n",
+								n, len(todo), filepath.Base(chunkPath), time.Since(start).Round(time.Second))
+							continue
+						}
+					}
+					if ctx.Err() == nil {
+						fmt.Fprintf(os.Stderr, "warning: terms pass skipped %s: %v\n", chunkPath, err)
+					}
+					failed.Add(1)
+				}
+			}()
+		}
+		for _, chunkPath := range batch {
+			if budget.Exceeded() {
+				stats.BudgetExhausted = true
+				break
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			jobs <- chunkPath
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+
+		var rows []termsPassRow
+		for r := range results {
+			migration.MergeGlossary(glossary, r.update.Additions, r.update.SeenAt)
+			rows = append(rows, r.row)
+		}
+		stats.Failed += int(failed.Load())
+		if err := migration.SaveGlossary(glossaryPath, *glossary); err != nil {
+			return stats, err
+		}
+		if err := fileutils.Flush(); err != nil {
+			return stats, err
+		}
+		for _, row := range rows {
+			if err := ledger.Write(row); err != nil {
+				return stats, fmt.Errorf("write terms pass ledger: %w", err)
+			}
+		}
+		stats.Extracted += len(rows)
+		if err := budget.Save(); err != nil {
+			return stats, err
+		}
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		if stats.BudgetExhausted || budget.Exceeded() {
+			stats.BudgetExhausted = true
+			break
+		}
+	}
+	if err := ledger.Close(); err != nil {
+		return stats, fmt.Errorf("close terms pass ledger: %w", err)
+	}
+	return stats, nil
+}
+
+// termsPassKey identifies a chunk in the ledger by its slash path relative to the input root.
+func termsPassKey(inRoot, chunkPath string) string {
+	if rel, err := filepath.Rel(inRoot, chunkPath); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(chunkPath)
+}
+
+// readTermsPassLedger returns the chunks the ledger at path records. A missing file is an empty ledger,
+// and lines that do not parse, such as one torn by a crash, are ignored.
+func readTermsPassLedger(path string) (map[string]bool, error) {
+	done := map[string]bool{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read terms pass ledger: %w", err)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for sc.Scan() {
+		var row termsPassRow
+		if json.Unmarshal(sc.Bytes(), &row) != nil || row.Chunk == "" {
+			continue
+		}
+		done[row.Chunk] = true
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read terms pass ledger: %w", err)
+	}
+	return done, nil
+}
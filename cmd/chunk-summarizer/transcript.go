@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"iter"
+	"strings"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+const (
+	transcriptCompact       = "compact"
+	transcriptMarkdown      = "markdown"
+	transcriptRoleGrouped   = "role-grouped"
+	transcriptToolCollapsed = "tool-collapsed"
+)
+
+// maxMessageChars caps a single rendered message so one pasted log cannot crowd out the rest of the chunk.
+const maxMessageChars = 2000
+
+// transcriptRenderer turns chunk messages into transcript rows. Rows are written in order until the
+// transcript budget runs out, so a renderer should keep each row self-contained and render it only
+// when asked for it.
+type transcriptRenderer func(msgs []migration.SimplifiedMessage, opt promptOptions) iter.Seq[string]
+
+func newTranscriptRenderer(format string) (transcriptRenderer, error) {
+	switch format {
+	case "", transcriptCompact:
+		return renderCompact, nil
+	case transcriptMarkdown:
+		return renderMarkdown, nil
+	case transcriptRoleGrouped:
+		return renderRoleGrouped, nil
+	case transcriptToolCollapsed:
+		return renderToolCollapsed, nil
+	}
+	return nil, fmt.Errorf("unknown transcript format %q", format)
+}
+
+func validTranscriptFormat(format string) bool {
+	_, err := newTranscriptRenderer(format)
+	return err == nil
+}
+
+// renderCompact writes one flattened line per message: "- role[:name]: text".
+func renderCompact(msgs []migration.SimplifiedMessage, opt promptOptions) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, m := range msgs {
+			line := fileutils.Truncate(messageText(m, opt), maxMessageChars)
+			if !yield(fmt.Sprintf("- %s: %s\n", speaker(m), fileutils.SanitizeNewlines(line))) {
+				return
+			}
+		}
+	}
+}
+
+// renderMarkdown gives each message a heading and keeps its line breaks, so code and lists survive.
+func renderMarkdown(msgs []migration.SimplifiedMessage, opt promptOptions) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, m := range msgs {
+			text := fileutils.Truncate(messageText(m, opt), maxMessageChars)
+			text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+			if !yield(fmt.Sprintf("### %s\n%s\n\n", speaker(m), text)) {
+				return
+			}
+		}
+	}
+}
+
+// renderRoleGrouped writes a speaker header once per run of consecutive messages from the same speaker
+// and indents the messages under it.
+func renderRoleGrouped(msgs []migration.SimplifiedMessage, opt promptOptions) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		prev := ""
+		for _, m := range msgs {
+			line := fileutils.Truncate(messageText(m, opt), maxMessageChars)
+			row := "  - " + fileutils.SanitizeNewlines(line) + "\n"
+			if who := speaker(m); who != prev {
+				// The header travels with the first message so truncation never leaves an empty group.
+				row = "[" + who + "]\n" + row
+				prev = who
+			}
+			if !yield(row) {
+				return
+			}
+		}
+	}
+}
+
+// renderToolCollapsed renders conversation turns like compact but folds each run of tool traffic
+// (invocations and results) into a single line naming the tools and their statuses.
+func renderToolCollapsed(msgs []migration.SimplifiedMessage, opt promptOptions) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		var run []string
+		flush := func() bool {
+			if len(run) == 0 {
+				return true
+			}
+			row := fmt.Sprintf("- tools: [%d tool messages: %s]\n", len(run), strings.Join(run, ", "))
+			run = nil
+			return yield(row)
+		}
+		for _, m := range msgs {
+			if isToolTraffic(m) {
+				run = append(run, toolActivityLabel(m))
+				continue
+			}
+			if !flush() {
+				return
+			}
+			line := fileutils.Truncate(messageText(m, opt), maxMessageChars)
+			if !yield(fmt.Sprintf("- %s: %s\n", speaker(m), fileutils.SanitizeNewlines(line))) {
+				return
+			}
+		}
+		flush()
+	}
+}
+
+func speaker(m migration.SimplifiedMessage) string {
+	role := m.Role
+	if role == "" {
+		role = "unknown"
+	}
+	if m.Speaker != "" {
+		return role + ":" + m.Speaker
+	}
+	if m.Name != "" {
+		return role + ":" + m.Name
+	}
+	return role
+}
+
+// messageText is the untruncated body of one message. With IncludeToolText off, tool outputs are
+// reduced to compact references (used on retries under size pressure).
+func messageText(m migration.SimplifiedMessage, opt promptOptions) string {
+	if !opt.IncludeToolText && m.Role == "tool" {
+		desc := strings.TrimSpace(m.ContentType)
+		if desc == "" {
+			desc = "tool"
+		}
+		parts := []string{"[tool", m.Name, desc, m.Title, m.URL}
+		if m.ToolCall != nil && m.ToolCall.Status != "" {
+			parts = append(parts, "status="+m.ToolCall.Status)
+		}
+		return strings.TrimSpace(strings.Join(parts, " "))
+	}
+	if strings.TrimSpace(m.Text) != "" {
+		return toolCallPrefix(m) + m.Text
+	}
+	if m.URL != "" || m.Title != "" {
+		return toolCallPrefix(m) + strings.TrimSpace(strings.Join([]string{m.Title, m.URL}, " "))
+	}
+	return toolCallPrefix(m) + "[" + strings.TrimSpace(m.ContentType) + "]"
+}
+
+// toolCallPrefix labels structured tool traffic so the model can tell invocations from results.
+func toolCallPrefix(m migration.SimplifiedMessage) string {
+	tc := m.ToolCall
+	if tc == nil {
+		return ""
+	}
+	kind := "tool call"
+	if m.Role == "tool" {
+		kind = "tool result"
+	}
+	if tc.Status != "" {
+		return fmt.Sprintf("[%s %s status=%s] ", kind, tc.Name, tc.Status)
+	}
+	return fmt.Sprintf("[%s %s] ", kind, tc.Name)
+}
+
+func isToolTraffic(m migration.SimplifiedMessage) bool {
+	return m.Role == "tool" || m.ToolCall != nil
+}
+
+func toolActivityLabel(m migration.SimplifiedMessage) string {
+	name := m.Name
+	if m.ToolCall != nil && m.ToolCall.Name != "" {
+		name = m.ToolCall.Name
+	}
+	if name == "" {
+		name = "tool"
+	}
+	if m.Role != "tool" {
+		return name + " call"
+	}
+	if m.ToolCall != nil && m.ToolCall.Status != "" {
+		return name + " result status=" + m.ToolCall.Status
+	}
+	return name + " result"
+}
+
+// numberTurns returns a copy of chunk's messages with "[turn N] " before each user message, the
+// start of a turn, numbered from chunk.TurnStart as in the prompt's turn_range.
+func numberTurns(chunk migration.Chunk) []migration.SimplifiedMessage {
+	msgs := append([]migration.SimplifiedMessage(nil), chunk.Messages...)
+	turn := chunk.TurnStart - 1
+	for i := range msgs {
+		if msgs[i].Role != "user" {
+			continue
+		}
+		if turn < chunk.TurnEnd-1 {
+			turn++
+		}
+		msgs[i].Text = fmt.Sprintf("[turn %d] %s", turn, msgs[i].Text)
+	}
+	return msgs
+}
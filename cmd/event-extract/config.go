@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
+)
+
+type Config struct {
+	InPath  string
+	OutPath string
+	// CachePath keeps each chunk's result; empty means events_cache.jsonl next to OutPath.
+	CachePath      string
+	Model          string
+	OutputLanguage string
+	APIKey         string
+
+	// MinConfidence drops events the model is less sure were explicitly dated.
+	MinConfidence float64
+
+	Resume          bool
+	List            bool
+	Concurrency     int
+	MaxOutputTokens int
+	MaxUSD          float64
+	MaxTokensTotal  int64
+	BudgetLedger    string
+	Durability      string
+	AtomicWrite     string
+	// CanonicalJSON writes JSON outputs in canonical form (see fileutils.Canonicalize).
+	CanonicalJSON bool
+
+	// MaxFilesPerDir and MaxOutputBytes set the output quota (see fileutils.Quota).
+	MaxFilesPerDir int
+	MaxOutputBytes int64
+
+	// StructuredOutput is how schema-constrained output is requested (see provider.SetStructuredOutput).
+	StructuredOutput string
+
+	// Chaos is a -chaos spec (see provider.ParseChaos) injecting provider failures; empty disables.
+	Chaos string
+}
+
+func (c Config) Validate() error {
+	if c.InPath == "" {
+		return errors.New("missing -in")
+	}
+	if c.OutPath == "" {
+		return errors.New("missing -out")
+	}
+	if !c.List && c.Model == "" {
+		return errors.New("missing -model")
+	}
+	if c.MinConfidence < 0 || c.MinConfidence > 1 {
+		return errors.New("min-confidence must be between 0 and 1")
+	}
+	if c.Concurrency < 1 {
+		return errors.New("concurrency must be >= 1")
+	}
+	if c.MaxOutputTokens < 1 {
+		return errors.New("max-output-tokens must be >= 1")
+	}
+	if c.MaxUSD < 0 || c.MaxTokensTotal < 0 {
+		return errors.New("max-usd/max-tokens-total must be >= 0")
+	}
+	if _, err := fileutils.ParseDurability(c.Durability); err != nil {
+		return err
+	}
+	if _, err := fileutils.ParseAtomicWrite(c.AtomicWrite); err != nil {
+		return err
+	}
+	if _, err := provider.ParseStructuredOutput(c.StructuredOutput); err != nil {
+		return err
+	}
+	if _, err := provider.ParseChaos(c.Chaos); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c Config) cachePath() string {
+	if c.CachePath != "" {
+		return c.CachePath
+	}
+	return filepath.Join(filepath.Dir(c.OutPath), migration.EventCacheFileName)
+}
+
+func defaultConfig() Config {
+	return Config{
+		InPath:          filepath.FromSlash("docs/peanut-gallery/threads/chunks"),
+		OutPath:         filepath.Join(filepath.FromSlash("docs/peanut-gallery/threads"), migration.EventsFileName),
+		Model:           "gpt-5-mini",
+		MinConfidence:   0.6,
+		Resume:          true,
+		Concurrency:     4,
+		MaxOutputTokens: 1500,
+		Durability:      fileutils.DurabilityFull,
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
+)
+
+var help = cli.Help{
+	Name:    "event-extract",
+	Summary: "build a timeline of dated life and project events mentioned in chunks",
+	Groups: []cli.Group{
+		{Title: "Input and output", Flags: []string{"in", "out", "cache", "resume", "list", "durability", "atomic-write", "canonical-json", "max-files-per-dir", "max-output-bytes"}},
+		{Title: "Model", Flags: []string{"model", "output-language", "min-confidence", "max-output-tokens", "api-key", "structured-output"}},
+		{Title: "Throughput", Flags: []string{"concurrency"}},
+		{Title: "Spend caps", Flags: []string{"max-usd", "max-tokens-total", "budget-ledger"}},
+		{Title: "Testing", Flags: []string{"chaos"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "extract events from every chunk", Command: "event-extract -in docs/peanut-gallery/threads/chunks -out docs/peanut-gallery/threads/events.jsonl"},
+		{Comment: "print the timeline", Command: "event-extract -list"},
+	},
+	Values: map[string][]string{"durability": fileutils.DurabilityModes, "atomic-write": fileutils.AtomicWriteModes, "structured-output": provider.StructuredOutputModes},
+}
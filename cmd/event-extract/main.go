@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/responses"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
+)
+
+func main() {
+	cfg, err := parseFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := layout.LoadConventionsFromEnv(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetDurability(cfg.Durability); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetAtomicWrite(cfg.AtomicWrite); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	fileutils.SetCanonicalJSON(cfg.CanonicalJSON)
+	if err := fileutils.SetQuota(fileutils.Quota{MaxFilesPerDir: cfg.MaxFilesPerDir, MaxBytes: cfg.MaxOutputBytes}); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := provider.SetStructuredOutput(cfg.StructuredOutput); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	if cfg.List {
+		events, err := migration.ReadEvents(cfg.OutPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		migration.SortEvents(events)
+		if err := writeTimeline(os.Stdout, events); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	apiKey := cfg.APIKey
+	if apiKey == "" {
+		apiKey = os.Getenv("OPENAI_API_KEY")
+	}
+	if apiKey == "" {
+		fmt.Fprintln(os.Stderr, "missing OPENAI_API_KEY (or pass -api-key)")
+		os.Exit(2)
+	}
+
+	paths, err := collectChunkFiles(cfg.InPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "no chunk files found")
+	}
+
+	cache, err := migration.LoadEventCache(cfg.cachePath())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	budget, err := provider.NewBudget(cfg.MaxUSD, cfg.MaxTokensTotal, cfg.BudgetLedger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	chaos, _ := provider.ParseChaos(cfg.Chaos)
+	client := provider.NewClient(apiKey, chaos)
+	extractor := openAIExtractor{client: &client, model: cfg.Model, maxOutputTokens: int64(cfg.MaxOutputTokens), language: cfg.OutputLanguage, budget: budget}
+	stats, err := extractEvents(ctx, cfg, paths, cache, extractor, budget.Exceeded)
+	if saveErr := budget.Save(); err == nil {
+		err = saveErr
+	}
+	if chaos != nil {
+		fmt.Fprintf(os.Stderr, "chaos event-extract: injected %s\n", chaos)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	spend := budget.Spend()
+	fmt.Fprintf(os.Stdout, "chunks_checked=%d skipped=%d events=%d tokens_total=%d estimated_usd=%.4f out=%s\n",
+		stats.Checked, stats.Skipped, stats.Events, spend.TotalTokens(), spend.USD, cfg.OutPath)
+	if stats.BudgetExhausted {
+		fmt.Fprintf(os.Stderr, "budget exhausted: stopped after %d chunks (tokens_total=%d estimated_usd=%.4f); rerun to continue\n", stats.Checked, spend.TotalTokens(), spend.USD)
+		os.Exit(provider.ExitBudgetExhausted)
+	}
+}
+
+// extractor finds the dated events in one chunk transcript.
+type extractor interface {
+	Extract(ctx context.Context, input string) ([]migration.ExtractedEvent, error)
+}
+
+type extractStats struct {
+	Checked, Skipped, Events int
+	BudgetExhausted          bool
+}
+
+// extractResult is one chunk's outcome; row is nil when the chunk was skipped.
+type extractResult struct {
+	row *migration.EventExtraction
+}
+
+// extractEvents asks the model for the dated events in each chunk in paths and appends a row per
+// checked chunk to the event cache, then compacts the cache and rewrites cfg.OutPath as a chronological
+// timeline of every cached chunk still in paths. With cfg.Resume, chunks whose text is unchanged since
+// their cached row are skipped. exceeded stops new model calls once a spend cap is hit; the timeline is
+// still rewritten from what was extracted.
+func extractEvents(ctx context.Context, cfg Config, paths []string, cache map[string]migration.EventExtraction, x extractor, exceeded func() bool) (extractStats, error) {
+	var stats extractStats
+	cachePath := cfg.cachePath()
+	w, err := fileutils.AppendJSONL(cachePath)
+	if err != nil {
+		return stats, fmt.Errorf("open event cache: %w", err)
+	}
+	defer w.Close()
+
+	rows := make(map[string]migration.EventExtraction, len(cache))
+	for k, v := range cache {
+		rows[k] = v
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	err = fileutils.ParallelOrdered(paths, cfg.Concurrency, func(p string) (extractResult, error) {
+		if err := ctx.Err(); err != nil {
+			return extractResult{}, err
+		}
+		var c migration.Chunk
+		if err := fileutils.ReadArtifact(p, &c); err != nil {
+			return extractResult{}, fmt.Errorf("read chunk %s: %w", p, err)
+		}
+		if c.ConversationID == "" || c.ChunkNumber == 0 {
+			return extractResult{}, nil
+		}
+		text := migration.EventSourceText(c)
+		hash := migration.EventSourceHash(text)
+		if prev, ok := cache[p]; cfg.Resume && ok && prev.SourceSHA256 == hash {
+			return extractResult{}, nil
+		}
+		if exceeded() {
+			return extractResult{}, errBudget
+		}
+		events, err := x.Extract(ctx, text)
+		if err != nil {
+			return extractResult{}, fmt.Errorf("extract events %s: %w", p, err)
+		}
+		return extractResult{row: &migration.EventExtraction{
+			ChunkPath:    p,
+			Events:       migration.BuildDatedEvents(c, p, events, cfg.MinConfidence),
+			SourceSHA256: hash,
+			Model:        cfg.Model,
+			ExtractedAt:  now,
+		}}, nil
+	}, func(r extractResult) error {
+		if r.row == nil {
+			stats.Skipped++
+			return nil
+		}
+		stats.Checked++
+		rows[r.row.ChunkPath] = *r.row
+		return w.Write(r.row)
+	})
+	if errors.Is(err, errBudget) {
+		stats.BudgetExhausted, err = true, nil
+	}
+	if err != nil {
+		return stats, err
+	}
+	if err := w.Close(); err != nil {
+		return stats, fmt.Errorf("write event cache: %w", err)
+	}
+	if _, err := fileutils.CompactJSONL(cachePath, fileutils.JSONLFieldKey("chunk_path", "")); err != nil {
+		return stats, fmt.Errorf("compact event cache: %w", err)
+	}
+
+	var events []migration.DatedEvent
+	for _, p := range paths {
+		events = append(events, rows[p].Events...)
+	}
+	migration.SortEvents(events)
+	stats.Events = len(events)
+	if err := writeEvents(cfg.OutPath, events); err != nil {
+		return stats, fmt.Errorf("write events: %w", err)
+	}
+	return stats, nil
+}
+
+// errBudget stops extractEvents once the spend cap is reached; rows already written are kept.
+var errBudget = errors.New("budget exhausted")
+
+// writeEvents atomically replaces path with one JSON line per event.
+func writeEvents(path string, events []migration.DatedEvent) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return fileutils.WriteFileAtomicSameDir(path, buf.Bytes(), 0o644)
+}
+
+func collectChunkFiles(inPath string) ([]string, error) {
+	fi, err := os.Stat(inPath)
+	if err != nil {
+		return nil, fmt.Errorf("stat -in: %w", err)
+	}
+	if !fi.IsDir() {
+		return nil, errors.New("-in must be a directory")
+	}
+	var files []string
+	err = filepath.WalkDir(inPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.ToLower(filepath.Ext(path)) != ".json" {
+			return nil
+		}
+		if _, _, ok := layout.Detect(path); ok || layout.IsPart(path) || migration.IsBookkeepingFile(path) {
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk chunks: %w", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// writeTimeline prints one line per event for review.
+func writeTimeline(w io.Writer, events []migration.DatedEvent) error {
+	for _, e := range events {
+		title := e.Title
+		if title == "" {
+			title = "(untitled)"
+		}
+		if _, err := fmt.Fprintf(w, "%-10s  %s  (%s, %s chunk %d)\n", e.Date, e.Description, title, e.ConversationID, e.ChunkNumber); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type eventResponse struct {
+	Events []migration.ExtractedEvent `json:"events"`
+}
+
+type openAIExtractor struct {
+	client          *openai.Client
+	model           string
+	maxOutputTokens int64
+	budget          *provider.Budget
+	// language is -output-language.
+	language string
+}
+
+var eventSchema = provider.GenerateSchema[eventResponse]()
+
+func (x openAIExtractor) Extract(ctx context.Context, input string) ([]migration.ExtractedEvent, error) {
+	params := responses.ResponseNewParams{
+		Model:           x.model,
+		MaxOutputTokens: openai.Int(x.maxOutputTokens),
+		Instructions:    openai.String(migration.LanguageInstructions(eventPrompt, x.language)),
+		Input: responses.ResponseNewParamsInputUnion{
+			OfInputItemList: []responses.ResponseInputItemUnionParam{
+				responses.ResponseInputItemParamOfMessage(input, responses.EasyInputMessageRoleUser),
+			},
+		},
+		Text: responses.ResponseTextConfigParam{
+			Format: responses.ResponseFormatTextConfigUnionParam{
+				OfJSONSchema: &responses.ResponseFormatTextJSONSchemaConfigParam{
+					Name:        "DatedEvents",
+					Schema:      eventSchema,
+					Strict:      openai.Bool(true),
+					Description: openai.String("Explicitly dated events mentioned in one conversation chunk"),
+					Type:        "json_schema",
+				},
+			},
+		},
+	}
+	resp, err := provider.CallWithRetry(ctx, x.client, params)
+	if err != nil {
+		return nil, err
+	}
+	if x.budget != nil {
+		x.budget.Record(x.model, resp.Usage)
+	}
+	var out eventResponse
+	if err := fileutils.DecodeModelJSON(resp.OutputText(), &out); err != nil {
+		return nil, fmt.Errorf("unmarshal events: %w (model_output_prefix=%q)", err, fileutils.Truncate(resp.OutputText(), 500))
+	}
+	return out.Events, nil
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
+	cfg := defaultConfig()
+	fs.SetOutput(os.Stderr)
+	cli.Setup(fs, help)
+	fs.StringVar(&cfg.InPath, "in", cfg.InPath, "Directory of thread chunks (*.json, recursively)")
+	fs.StringVar(&cfg.OutPath, "out", cfg.OutPath, "Events JSONL timeline (rewritten in date order each run)")
+	fs.StringVar(&cfg.CachePath, "cache", "", "Per-chunk results JSONL (default: events_cache.jsonl next to -out)")
+	fs.StringVar(&cfg.Model, "model", cfg.Model, "OpenAI model that extracts events")
+	fs.StringVar(&cfg.OutputLanguage, "output-language", "", "Language to write the event descriptions in, e.g. German")
+	fs.Float64Var(&cfg.MinConfidence, "min-confidence", cfg.MinConfidence, "Drop events the model is less confident about than this (0-1)")
+	fs.BoolVar(&cfg.Resume, "resume", cfg.Resume, "Skip chunks whose text is unchanged since they were last extracted")
+	fs.BoolVar(&cfg.List, "list", false, "Print the timeline from -out in date order and exit (no API calls)")
+	fs.IntVar(&cfg.Concurrency, "concurrency", cfg.Concurrency, "Max concurrent model calls")
+	fs.IntVar(&cfg.MaxOutputTokens, "max-output-tokens", cfg.MaxOutputTokens, "Max output tokens per chunk")
+	fs.Float64Var(&cfg.MaxUSD, "max-usd", cfg.MaxUSD, "Stop starting new chunks once estimated spend reaches this many USD (0 disables)")
+	fs.Int64Var(&cfg.MaxTokensTotal, "max-tokens-total", cfg.MaxTokensTotal, "Stop starting new chunks once input+output tokens reach this total (0 disables)")
+	fs.StringVar(&cfg.BudgetLedger, "budget-ledger", "", "Optional JSON file to load/save cumulative spend so caps span several runs or stages")
+	fs.StringVar(&cfg.APIKey, "api-key", "", "OpenAI API key (overrides OPENAI_API_KEY env var)")
+	fs.StringVar(&cfg.StructuredOutput, "structured-output", provider.StructuredJSONSchema, "How schema-constrained output is requested: json-schema (response format) or tool (a required function call, for models without json_schema support)")
+	fs.StringVar(&cfg.Durability, "durability", cfg.Durability, "fsync policy for output files: none, group (sync in batches), or full (sync every file)")
+	fs.StringVar(&cfg.AtomicWrite, "atomic-write", fileutils.AtomicRename, "How finished files replace their targets: rename (atomic), staged (temp files in TMPDIR, kept out of synced folders), or copy (written in place, for shares that refuse rename)")
+	fs.BoolVar(&cfg.CanonicalJSON, "canonical-json", cfg.CanonicalJSON, "Write JSON outputs with sorted keys and stable number formatting so regenerated files diff cleanly")
+	fs.IntVar(&cfg.MaxFilesPerDir, "max-files-per-dir", fileutils.DefaultMaxFilesPerDir, "Stop with an error before any output directory holds more than N files (0 disables)")
+	fs.Int64Var(&cfg.MaxOutputBytes, "max-output-bytes", 0, "Stop with an error before this run writes more than N bytes (0 disables)")
+	fs.StringVar(&cfg.Chaos, "chaos", "", "Inject provider failures for testing, e.g. rate-limit=0.1,server-error=0.05,truncate=0.05,garbage=0.05 (plus seed=N, max=N)")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	cfg.InPath = filepath.Clean(cfg.InPath)
+	cfg.OutPath = filepath.Clean(cfg.OutPath)
+	if cfg.CachePath != "" {
+		cfg.CachePath = filepath.Clean(cfg.CachePath)
+	}
+	return cfg, nil
+}
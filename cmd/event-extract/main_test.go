@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+type fakeExtractor struct {
+	calls atomic.Int32
+}
+
+func (f *fakeExtractor) Extract(_ context.Context, input string) ([]migration.ExtractedEvent, error) {
+	f.calls.Add(1)
+	var out []migration.ExtractedEvent
+	if strings.Contains(input, "launched") {
+		out = append(out, migration.ExtractedEvent{Date: "2024-05-03", DateText: "May 3rd", Description: "Launched the beta", Message: 0, Confidence: 0.9})
+	}
+	if strings.Contains(input, "moved") {
+		out = append(out, migration.ExtractedEvent{Date: "2019", Description: "Moved to Lisbon", Message: 0, Confidence: 0.8})
+	}
+	return out, nil
+}
+
+func TestParseFlags_DefaultsAndValidate(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("event-extract", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-out", "x/../out/events.jsonl"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if cfg.OutPath != filepath.Join("out", "events.jsonl") || cfg.cachePath() != filepath.Join("out", migration.EventCacheFileName) || !cfg.Resume {
+		t.Fatalf("cfg=%+v cache=%s", cfg, cfg.cachePath())
+	}
+	cfg.MinConfidence = -0.1
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for negative min-confidence")
+	}
+}
+
+func TestExtractEvents_WritesTimelineAndResumes(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	in := filepath.Join(dir, "chunks")
+	write := func(c migration.Chunk) string {
+		p := filepath.Join(in, c.ConversationID, "chunk_0001.json")
+		if err := fileutils.WriteJSONFileAtomic(p, c, false); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		return p
+	}
+	write(migration.Chunk{ConversationID: "a", Title: "Launch", ChunkNumber: 1, Messages: []migration.SimplifiedMessage{{Role: "user", Text: "On May 3rd we launched the beta."}}})
+	write(migration.Chunk{ConversationID: "b", Title: "Bread", ChunkNumber: 1, Messages: []migration.SimplifiedMessage{{Role: "user", Text: "How do I bake bread?"}}})
+
+	cfg := defaultConfig()
+	cfg.InPath, cfg.OutPath = in, filepath.Join(dir, migration.EventsFileName)
+	paths, err := collectChunkFiles(in)
+	if err != nil || len(paths) != 2 {
+		t.Fatalf("collectChunkFiles: %v %v", paths, err)
+	}
+
+	x := &fakeExtractor{}
+	never := func() bool { return false }
+	stats, err := extractEvents(context.Background(), cfg, paths, nil, x, never)
+	if err != nil {
+		t.Fatalf("extractEvents: %v", err)
+	}
+	if stats.Checked != 2 || stats.Events != 1 {
+		t.Fatalf("stats=%+v", stats)
+	}
+
+	// Unchanged chunks, including the one with no events, are skipped; a changed one is extracted again.
+	cache, err := migration.LoadEventCache(cfg.cachePath())
+	if err != nil || len(cache) != 2 {
+		t.Fatalf("cache=%v err=%v", cache, err)
+	}
+	write(migration.Chunk{ConversationID: "b", Title: "Bread", ChunkNumber: 1, Messages: []migration.SimplifiedMessage{{Role: "user", Text: "We moved in 2019 and I started baking."}}})
+	stats, err = extractEvents(context.Background(), cfg, paths, cache, x, never)
+	if err != nil {
+		t.Fatalf("extractEvents resume: %v", err)
+	}
+	if stats.Checked != 1 || stats.Skipped != 1 || stats.Events != 2 || x.calls.Load() != 3 {
+		t.Fatalf("stats=%+v calls=%d", stats, x.calls.Load())
+	}
+
+	events, err := migration.ReadEvents(cfg.OutPath)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("events=%+v err=%v", events, err)
+	}
+	if events[0].Date != "2019" || events[1].ID != "a:1:0" || events[1].ChunkPath != paths[0] {
+		t.Fatalf("events=%+v", events)
+	}
+
+	var buf bytes.Buffer
+	if err := writeTimeline(&buf, events); err != nil {
+		t.Fatalf("writeTimeline: %v", err)
+	}
+	if !strings.Contains(buf.String(), "2024-05-03  Launched the beta  (Launch, a chunk 1)") {
+		t.Fatalf("timeline=%q", buf.String())
+	}
+}
+
+func TestExtractEvents_StopsAtBudget(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a", "chunk_0001.json")
+	if err := fileutils.WriteJSONFileAtomic(path, migration.Chunk{ConversationID: "a", ChunkNumber: 1}, false); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	cfg := defaultConfig()
+	cfg.OutPath = filepath.Join(dir, migration.EventsFileName)
+	x := &fakeExtractor{}
+	stats, err := extractEvents(context.Background(), cfg, []string{path}, nil, x, func() bool { return true })
+	if err != nil || !stats.BudgetExhausted || x.calls.Load() != 0 {
+		t.Fatalf("stats=%+v err=%v calls=%d", stats, err, x.calls.Load())
+	}
+}
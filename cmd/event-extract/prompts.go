@@ -0,0 +1,23 @@
+package main
+
+const eventPrompt = `You build a personal timeline from a person's past AI chat conversations. You are given one part of a
+conversation; each message is numbered and shows the date it was written.
+
+Find events the conversation says happened (or are scheduled to happen) on a specific calendar date:
+"on May 3rd we launched the beta", "my daughter was born in March 2019", "the move is on 2024-09-14".
+
+Rules:
+- Only explicitly dated events. Skip undated facts, vague times ("a while ago", "someday"), and dates that are
+  only mentioned in passing without something happening on them.
+- Resolve the date to YYYY-MM-DD, or YYYY-MM / YYYY when the text gives only a month or a year. When the year is
+  left out, use the year that makes sense given the date the message was written. Resolve relative dates
+  ("yesterday", "last Friday") only when the message date makes them unambiguous.
+- Ignore dates inside code, logs, and examples, and events in fiction the person is writing.
+- description is one short sentence in the past or future tense saying what happened, without the date.
+- date_text is the date exactly as written in the message.
+- message is the number of the message that mentions the event.
+- confidence is 0 to 1: how sure you are the event and its date are stated in the text.
+- Return an empty list when there are none; most conversations have none.
+
+Return JSON:
+- events: list of {date, date_text, description, message, confidence}.`
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+type Config struct {
+	// InPath is one index file, or a directory whose known index files (index.json, key_points.jsonl,
+	// sentiment_index.json, thread_index.json, sentiment_thread_index.json) are compacted.
+	InPath string
+
+	// KeyField and IDField override the record key for index files with custom names.
+	KeyField string
+	IDField  string
+
+	Durability  string
+	AtomicWrite string
+	// CanonicalJSON writes JSON outputs in canonical form (see fileutils.Canonicalize).
+	CanonicalJSON bool
+}
+
+func (c Config) Validate() error {
+	if c.InPath == "" {
+		return errors.New("missing -in")
+	}
+	if c.IDField != "" && c.KeyField == "" {
+		return errors.New("-id requires -key")
+	}
+	if _, err := fileutils.ParseDurability(c.Durability); err != nil {
+		return err
+	}
+	if _, err := fileutils.ParseAtomicWrite(c.AtomicWrite); err != nil {
+		return err
+	}
+	return nil
+}
+
+func defaultConfig() Config {
+	return Config{
+		InPath:     filepath.FromSlash("docs/peanut-gallery/threads/summaries"),
+		Durability: fileutils.DurabilityFull,
+	}
+}
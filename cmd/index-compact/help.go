@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+var help = cli.Help{
+	Name:    "index-compact",
+	Summary: "drop superseded rows from append-mode index files, keeping the last row per key",
+	Groups: []cli.Group{
+		{Title: "Input", Flags: []string{"in", "key", "id"}},
+		{Title: "Output", Flags: []string{"durability", "atomic-write", "canonical-json"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "compact every index file under the summaries directory", Command: "index-compact -in docs/peanut-gallery/threads/summaries"},
+		{Comment: "compact a custom-named index keyed by chunk_path", Command: "index-compact -in extra_index.jsonl -key chunk_path"},
+	},
+	Values: map[string][]string{"durability": fileutils.DurabilityModes, "atomic-write": fileutils.AtomicWriteModes},
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+func main() {
+	cfg, err := parseFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetDurability(cfg.Durability); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetAtomicWrite(cfg.AtomicWrite); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	fileutils.SetCanonicalJSON(cfg.CanonicalJSON)
+
+	files, err := indexFiles(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "no index files found")
+		os.Exit(2)
+	}
+
+	total, err := compactAll(cfg, files, os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if err := fileutils.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stdout, "files_compacted=%d records_kept=%d records_dropped=%d\n", len(files), total.Kept, total.Dropped)
+}
+
+// indexFiles lists the files to compact: -in itself, or the known index files directly inside it.
+func indexFiles(cfg Config) ([]string, error) {
+	info, err := os.Stat(cfg.InPath)
+	if err != nil {
+		return nil, fmt.Errorf("stat -in: %w", err)
+	}
+	if !info.IsDir() {
+		return []string{cfg.InPath}, nil
+	}
+	entries, err := os.ReadDir(cfg.InPath)
+	if err != nil {
+		return nil, fmt.Errorf("read -in: %w", err)
+	}
+	var out []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if _, ok := migration.IndexKey(e.Name()); ok {
+			out = append(out, filepath.Join(cfg.InPath, e.Name()))
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// compactAll compacts each file with its key and logs one line per file to log.
+func compactAll(cfg Config, files []string, log io.Writer) (fileutils.CompactStats, error) {
+	var total fileutils.CompactStats
+	for _, path := range files {
+		key, ok := migration.IndexKey(path)
+		if cfg.KeyField != "" {
+			key, ok = fileutils.JSONLFieldKey(cfg.KeyField, cfg.IDField), true
+		}
+		if !ok {
+			return total, fmt.Errorf("%s: unknown index file; pass -key", path)
+		}
+		stats, err := fileutils.CompactJSONL(path, key)
+		if err != nil {
+			return total, err
+		}
+		total.Kept += stats.Kept
+		total.Dropped += stats.Dropped
+		fmt.Fprintf(log, "compacted %s: kept=%d dropped=%d\n", path, stats.Kept, stats.Dropped)
+	}
+	return total, nil
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
+	cfg := defaultConfig()
+	fs.SetOutput(os.Stderr)
+	cli.Setup(fs, help)
+
+	fs.StringVar(&cfg.InPath, "in", cfg.InPath, "Index file, or a directory whose index files are compacted")
+	fs.StringVar(&cfg.KeyField, "key", "", "Record key field for index files with custom names (default: chosen by file name)")
+	fs.StringVar(&cfg.IDField, "id", "", "With -key: per-row id field for keys written as groups of rows")
+	fs.StringVar(&cfg.Durability, "durability", cfg.Durability, "fsync policy for rewritten files: none, group (sync in batches), or full (sync every file)")
+	fs.StringVar(&cfg.AtomicWrite, "atomic-write", fileutils.AtomicRename, "How finished files replace their targets: rename (atomic), staged (temp files in TMPDIR, kept out of synced folders), or copy (written in place, for shares that refuse rename)")
+	fs.BoolVar(&cfg.CanonicalJSON, "canonical-json", cfg.CanonicalJSON, "Write JSON outputs with sorted keys and stable number formatting so regenerated files diff cleanly")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	cfg.InPath = filepath.Clean(cfg.InPath)
+	return cfg, nil
+}
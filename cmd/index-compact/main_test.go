@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseFlags_Validate(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("index-compact", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-in", "out/summaries/", "-key", "summary_path"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if cfg.InPath != filepath.FromSlash("out/summaries") || cfg.KeyField != "summary_path" {
+		t.Fatalf("cfg=%+v", cfg)
+	}
+	cfg.KeyField = ""
+	cfg.IDField = "id"
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for -id without -key")
+	}
+}
+
+func TestCompactAll_Directory(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	write := func(name, body string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	write("index.json", `{"summary_path":"a","summary":"old"}
+{"summary_path":"b","summary":"b"}
+{"summary_path":"a","summary":"new"}
+`)
+	write("key_points.jsonl", `{"id":"c:1:0","summary_path":"a"}
+{"id":"c:1:1","summary_path":"a"}
+{"id":"c:1:0","summary_path":"a"}
+`)
+	write("memory_index.json", `{"conversation_id":"c"}
+`)
+
+	cfg := defaultConfig()
+	cfg.InPath = dir
+	files, err := indexFiles(cfg)
+	if err != nil {
+		t.Fatalf("indexFiles: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("files=%v", files)
+	}
+	var log bytes.Buffer
+	total, err := compactAll(cfg, files, &log)
+	if err != nil {
+		t.Fatalf("compactAll: %v", err)
+	}
+	if total.Kept != 3 || total.Dropped != 3 {
+		t.Fatalf("total=%+v log=%s", total, log.String())
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "index.json"))
+	if !strings.Contains(string(b), `"new"`) || strings.Contains(string(b), `"old"`) {
+		t.Fatalf("index.json=%s", b)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
+)
+
+const dateLayout = "2006-01-02"
+
+type Config struct {
+	Question string
+
+	ThreadIndexPath string
+	ChunkIndexPath  string
+	ShardsDir       string
+	MemoryIndexPath string
+	EmbeddingsPath  string
+	EmbeddingModel  string
+
+	Model           string
+	OutputLanguage  string
+	TopK            int
+	ContextTokens   int
+	MaxOutputTokens int
+	// StructuredOutput is how schema-constrained output is requested (see provider.SetStructuredOutput).
+	StructuredOutput string
+
+	Kinds   string
+	Project string
+	Source  string
+	Since   string
+	Until   string
+
+	JSON   bool
+	APIKey string
+}
+
+func (c Config) Validate() error {
+	if strings.TrimSpace(c.Question) == "" {
+		return errors.New("missing question (pass -q or trailing arguments)")
+	}
+	if c.ThreadIndexPath == "" && c.ChunkIndexPath == "" {
+		return errors.New("missing -thread-index and -chunk-index")
+	}
+	if c.Model == "" {
+		return errors.New("missing -model")
+	}
+	if c.TopK <= 0 {
+		return errors.New("top-k must be > 0")
+	}
+	if c.ContextTokens <= 0 {
+		return errors.New("context-tokens must be > 0")
+	}
+	if c.MaxOutputTokens <= 0 {
+		return errors.New("max-output-tokens must be > 0")
+	}
+	if _, err := provider.ParseStructuredOutput(c.StructuredOutput); err != nil {
+		return err
+	}
+	for _, k := range c.kinds() {
+		if k != "thread" && k != "chunk" {
+			return errors.New("kinds must list thread and/or chunk")
+		}
+	}
+	if _, err := c.since(); err != nil {
+		return errors.New("since must be YYYY-MM-DD")
+	}
+	if _, err := c.until(); err != nil {
+		return errors.New("until must be YYYY-MM-DD")
+	}
+	return nil
+}
+
+func (c Config) kinds() []string {
+	var out []string
+	for _, k := range strings.Split(c.Kinds, ",") {
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+func (c Config) since() (time.Time, error) { return parseDate(c.Since) }
+
+// until is exclusive, so -until 2024-03-31 includes threads started that day.
+func (c Config) until() (time.Time, error) {
+	t, err := parseDate(c.Until)
+	if err != nil || t.IsZero() {
+		return t, err
+	}
+	return t.AddDate(0, 0, 1), nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	if strings.TrimSpace(s) == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(dateLayout, strings.TrimSpace(s))
+}
+
+func defaultConfig() Config {
+	return Config{
+		ThreadIndexPath: filepath.FromSlash("docs/peanut-gallery/threads/thread_summaries/thread_index.json"),
+		ChunkIndexPath:  filepath.FromSlash("docs/peanut-gallery/threads/summaries/index.json"),
+		ShardsDir:       filepath.FromSlash("docs/peanut-gallery/threads/memory_shards"),
+		EmbeddingsPath:  filepath.FromSlash("docs/peanut-gallery/threads/embeddings.jsonl"),
+		EmbeddingModel:  "text-embedding-3-small",
+		Model:           "gpt-5-mini",
+		TopK:            12,
+		ContextTokens:   12000,
+		MaxOutputTokens: 2000,
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
+)
+
+var help = cli.Help{
+	Name:    "memory-ask",
+	Summary: "answer a question from the archive, citing the threads and chunks it used",
+	Groups: []cli.Group{
+		{Title: "Question", Flags: []string{"q", "kinds", "project", "source", "since", "until"}},
+		{Title: "Sources", Flags: []string{"thread-index", "chunk-index", "shards", "memory-index", "embeddings", "embedding-model"}},
+		{Title: "Model", Flags: []string{"model", "output-language", "top-k", "context-tokens", "max-output-tokens", "api-key", "structured-output"}},
+		{Title: "Output", Flags: []string{"json"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "ask across threads and chunks", Command: `memory-ask -q "when did we pick the database for the garden app?"`},
+		{Comment: "restrict to one project and year, as JSON", Command: `memory-ask -q "what did we decide about pricing?" -project garden -since 2024-01-01 -until 2024-12-31 -json`},
+	},
+	Values: map[string][]string{"kinds": {"thread", "chunk"}, "structured-output": provider.StructuredOutputModes},
+}
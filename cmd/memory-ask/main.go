@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/responses"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/retrieval"
+)
+
+func main() {
+	cfg, err := parseFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := provider.SetStructuredOutput(cfg.StructuredOutput); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	apiKey := cfg.APIKey
+	if apiKey == "" {
+		apiKey = os.Getenv("OPENAI_API_KEY")
+	}
+	if apiKey == "" {
+		fmt.Fprintln(os.Stderr, "missing OPENAI_API_KEY (or pass -api-key)")
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	engine, err := retrieval.Load(retrieval.Sources{
+		ThreadIndexPath: cfg.ThreadIndexPath,
+		ChunkIndexPath:  cfg.ChunkIndexPath,
+		MemoryIndexPath: cfg.MemoryIndexPath,
+		EmbeddingsPath:  cfg.EmbeddingsPath,
+		EmbeddingModel:  cfg.EmbeddingModel,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if engine.Len() == 0 {
+		fmt.Fprintln(os.Stderr, "no index rows found; run thread-rollup/chunk-summarizer first")
+		os.Exit(2)
+	}
+
+	client := openai.NewClient(option.WithAPIKey(apiKey))
+	var emb questionEmbedder
+	if engine.HasVectors() {
+		emb = openAIQuestionEmbedder{client: &client, model: cfg.EmbeddingModel}
+	}
+	ans, err := ask(ctx, cfg, engine, emb, openAIAnswerer{client: &client, model: cfg.Model, maxOutputTokens: int64(cfg.MaxOutputTokens), language: cfg.OutputLanguage})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if err := writeAnswer(os.Stdout, cfg, ans); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "sources=%d cited=%d context_tokens=%d tokens_total=%d\n", len(ans.Sources), len(ans.Citations), ans.ContextTokens, ans.TokensTotal)
+}
+
+// answer is the result of one question; it is also the -json output.
+type answer struct {
+	Question      string   `json:"question"`
+	Answer        string   `json:"answer"`
+	Citations     []source `json:"citations"`
+	Sources       []source `json:"sources"`
+	ContextTokens int      `json:"context_tokens"`
+	TokensTotal   int64    `json:"tokens_total"`
+	Model         string   `json:"model"`
+}
+
+type answerResponse struct {
+	Answer    string   `json:"answer"`
+	Citations []string `json:"citations"`
+}
+
+type questionEmbedder interface {
+	EmbedQuestion(ctx context.Context, question string) ([]float64, error)
+}
+
+type answerer interface {
+	Answer(ctx context.Context, input string) (answerResponse, int64, error)
+}
+
+// ask retrieves, assembles the context window, and asks the model. With no usable sources it answers
+// without calling the model.
+func ask(ctx context.Context, cfg Config, engine *retrieval.Engine, emb questionEmbedder, a answerer) (answer, error) {
+	since, _ := cfg.since()
+	until, _ := cfg.until()
+	q := retrieval.Query{
+		Text: cfg.Question, Kinds: cfg.kinds(), Project: cfg.Project, SourceType: cfg.Source, Since: since, Until: until, Limit: cfg.TopK,
+	}
+	if emb != nil {
+		v, err := emb.EmbedQuestion(ctx, cfg.Question)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: embed question: %v (falling back to keyword retrieval)\n", err)
+		} else {
+			q.Vector = v
+		}
+	}
+
+	hits := engine.Search(q)
+	sources, used := buildSources(engine.FS(), hits, cfg.ShardsDir, cfg.ContextTokens)
+	out := answer{Question: cfg.Question, Sources: sources, ContextTokens: used, Model: cfg.Model, Citations: []source{}}
+	if len(sources) == 0 {
+		out.Answer = "No matching conversations were found in the archive."
+		return out, nil
+	}
+
+	resp, tokens, err := a.Answer(ctx, buildInput(cfg.Question, sources))
+	if err != nil {
+		return answer{}, fmt.Errorf("answer: %w", err)
+	}
+	out.Answer = strings.TrimSpace(resp.Answer)
+	out.Citations = citedSources(out.Answer, resp.Citations, sources)
+	out.TokensTotal = tokens
+	return out, nil
+}
+
+func writeAnswer(w io.Writer, cfg Config, ans answer) error {
+	if cfg.JSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(ans)
+	}
+	if _, err := fmt.Fprintf(w, "%s\n", ans.Answer); err != nil {
+		return err
+	}
+	if len(ans.Citations) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintln(w, "\nSources:"); err != nil {
+		return err
+	}
+	for _, s := range ans.Citations {
+		line := fmt.Sprintf("[%s] %s", s.Ref, s.ConversationID)
+		if s.ChunkNumber > 0 {
+			line += fmt.Sprintf(" (chunk %d)", s.ChunkNumber)
+		}
+		if loc := s.location(); loc != "" {
+			line += " " + loc
+		}
+		if s.Title != "" {
+			line += " — " + s.Title
+		}
+		if s.Date != "" {
+			line += " (" + s.Date + ")"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type openAIQuestionEmbedder struct {
+	client *openai.Client
+	model  string
+}
+
+func (e openAIQuestionEmbedder) EmbedQuestion(ctx context.Context, question string) ([]float64, error) {
+	resp, err := e.client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: []string{question}},
+		Model: openai.EmbeddingModel(e.model),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return nil, errors.New("empty embedding response")
+	}
+	return resp.Data[0].Embedding, nil
+}
+
+type openAIAnswerer struct {
+	client          *openai.Client
+	model           string
+	maxOutputTokens int64
+	// language is -output-language.
+	language string
+}
+
+var answerSchema = provider.GenerateSchema[answerResponse]()
+
+func (a openAIAnswerer) Answer(ctx context.Context, input string) (answerResponse, int64, error) {
+	format := responses.ResponseFormatTextConfigUnionParam{
+		OfJSONSchema: &responses.ResponseFormatTextJSONSchemaConfigParam{
+			Name:        "ArchiveAnswer",
+			Schema:      answerSchema,
+			Strict:      openai.Bool(true),
+			Description: openai.String("Answer with source citations"),
+			Type:        "json_schema",
+		},
+	}
+	params := responses.ResponseNewParams{
+		Model:           a.model,
+		MaxOutputTokens: openai.Int(a.maxOutputTokens),
+		Instructions:    openai.String(migration.LanguageInstructions(answerPrompt, a.language)),
+		Input: responses.ResponseNewParamsInputUnion{
+			OfInputItemList: []responses.ResponseInputItemUnionParam{
+				responses.ResponseInputItemParamOfMessage(input, responses.EasyInputMessageRoleUser),
+			},
+		},
+		Text: responses.ResponseTextConfigParam{
+			Format: format,
+		},
+	}
+
+	resp, err := provider.CallWithRetry(ctx, a.client, params)
+	if err != nil {
+		return answerResponse{}, 0, err
+	}
+	var out answerResponse
+	if err := fileutils.DecodeModelJSON(resp.OutputText(), &out); err != nil {
+		return answerResponse{}, resp.Usage.TotalTokens, fmt.Errorf("unmarshal answer: %w (model_output_prefix=%q)", err, fileutils.Truncate(resp.OutputText(), 500))
+	}
+	return out, resp.Usage.TotalTokens, nil
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
+	cfg := defaultConfig()
+	fs.SetOutput(os.Stderr)
+	cli.Setup(fs, help)
+	fs.StringVar(&cfg.Question, "q", "", "Question to ask (trailing arguments are used when -q is empty)")
+	fs.StringVar(&cfg.ThreadIndexPath, "thread-index", cfg.ThreadIndexPath, "Path to thread_index.json (empty disables thread retrieval)")
+	fs.StringVar(&cfg.ChunkIndexPath, "chunk-index", cfg.ChunkIndexPath, "Path to chunk index.json (empty disables chunk retrieval)")
+	fs.StringVar(&cfg.ShardsDir, "shards", cfg.ShardsDir, "Memory shards directory (thread context is read from here)")
+	fs.StringVar(&cfg.MemoryIndexPath, "memory-index", "", "Path to memory_index.json for shard anchors (default: <shards>/memory_index.json)")
+	fs.StringVar(&cfg.EmbeddingsPath, "embeddings", cfg.EmbeddingsPath, "vector-load embeddings JSONL; when present the question is embedded for hybrid retrieval")
+	fs.StringVar(&cfg.EmbeddingModel, "embedding-model", cfg.EmbeddingModel, "Embedding model (must match the one used for -embeddings)")
+	fs.StringVar(&cfg.Model, "model", cfg.Model, "OpenAI model that writes the answer")
+	fs.StringVar(&cfg.OutputLanguage, "output-language", "", "Language to write the answer in, e.g. German")
+	fs.IntVar(&cfg.TopK, "top-k", cfg.TopK, "Number of retrieval hits considered for context")
+	fs.IntVar(&cfg.ContextTokens, "context-tokens", cfg.ContextTokens, "Approximate token budget for retrieved context")
+	fs.IntVar(&cfg.MaxOutputTokens, "max-output-tokens", cfg.MaxOutputTokens, "Max output tokens for the answer")
+	fs.StringVar(&cfg.Kinds, "kinds", "", "Comma-separated record kinds to retrieve: thread, chunk (default: both)")
+	fs.StringVar(&cfg.Project, "project", "", "Only retrieve threads from this project")
+	fs.StringVar(&cfg.Source, "source", "", "Only retrieve threads from this source type: chatgpt, whatsapp, telegram, email, journal")
+	fs.StringVar(&cfg.Since, "since", "", "Only retrieve threads started on or after this date (YYYY-MM-DD)")
+	fs.StringVar(&cfg.Until, "until", "", "Only retrieve threads started on or before this date (YYYY-MM-DD)")
+	fs.BoolVar(&cfg.JSON, "json", false, "Print the answer, citations, and sources as JSON")
+	fs.StringVar(&cfg.APIKey, "api-key", "", "OpenAI API key (optional; defaults to OPENAI_API_KEY)")
+	fs.StringVar(&cfg.StructuredOutput, "structured-output", provider.StructuredJSONSchema, "How schema-constrained output is requested: json-schema (response format) or tool (a required function call, for models without json_schema support)")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if cfg.Question == "" {
+		cfg.Question = strings.Join(fs.Args(), " ")
+	}
+	cfg.Question = strings.TrimSpace(cfg.Question)
+
+	for _, p := range []*string{&cfg.ThreadIndexPath, &cfg.ChunkIndexPath, &cfg.ShardsDir, &cfg.MemoryIndexPath, &cfg.EmbeddingsPath} {
+		if *p != "" {
+			*p = filepath.Clean(*p)
+		}
+	}
+	if cfg.MemoryIndexPath == "" && cfg.ShardsDir != "" {
+		cfg.MemoryIndexPath = filepath.Join(cfg.ShardsDir, "memory_index.json")
+	}
+	return cfg, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/retrieval"
+)
+
+func TestParseFlags_QuestionFromArgs(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("memory-ask", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-shards", "out/shards/", "-until", "2024-03-31", "when", "did", "I", "move?"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.Question != "when did I move?" {
+		t.Fatalf("Question=%q", cfg.Question)
+	}
+	if cfg.MemoryIndexPath != filepath.Join("out", "shards", "memory_index.json") {
+		t.Fatalf("MemoryIndexPath=%q", cfg.MemoryIndexPath)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	until, _ := cfg.until()
+	if until.Format(dateLayout) != "2024-04-01" {
+		t.Fatalf("until=%v", until)
+	}
+
+	cfg.Since = "March"
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for bad -since")
+	}
+}
+
+func TestParseFlags_StructuredOutput(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("memory-ask", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-q", "when?", "-structured-output", "tool"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.StructuredOutput != provider.StructuredTool {
+		t.Fatalf("StructuredOutput=%q", cfg.StructuredOutput)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	cfg.StructuredOutput = "xml"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for bad -structured-output")
+	}
+}
+
+func TestCitedSources_InlineOrderAndUnknownRefs(t *testing.T) {
+	t.Parallel()
+
+	sources := []source{{Ref: "S1", ConversationID: "a"}, {Ref: "S2", ConversationID: "b"}, {Ref: "S3", ConversationID: "c"}}
+	got := citedSources("Moved in 2021 [S2][S1]. Later [S9].", []string{"S1", "S3", "S7"}, sources)
+	var ids []string
+	for _, s := range got {
+		ids = append(ids, s.ConversationID)
+	}
+	if strings.Join(ids, ",") != "b,a,c" {
+		t.Fatalf("cited=%v", ids)
+	}
+}
+
+func writeJSONL(t *testing.T, path string, rows ...any) {
+	t.Helper()
+	var b bytes.Buffer
+	for _, r := range rows {
+		line, err := json.Marshal(r)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+type fakeAnswerer struct {
+	input string
+}
+
+func (f *fakeAnswerer) Answer(_ context.Context, input string) (answerResponse, int64, error) {
+	f.input = input
+	return answerResponse{Answer: "You moved to Lisbon [S1].", Citations: []string{"S1"}}, 42, nil
+}
+
+func TestAsk_UsesShardContextAndCitesAnchors(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	shards := filepath.Join(root, "memory_shards")
+	start := 1700000000.0
+	if _, err := migration.WriteMemoryShards([]migration.ThreadSummary{
+		{ConversationID: "c1", Title: "Moving to Lisbon", ThreadStart: &start, Summary: "Chose Lisbon for the visa."},
+		{ConversationID: "c2", Title: "Sourdough", Summary: "Starter feeding."},
+	}, migration.MemoryPackOptions{OutDir: shards}); err != nil {
+		t.Fatalf("WriteMemoryShards: %v", err)
+	}
+	writeJSONL(t, filepath.Join(shards, "memory_index.json"),
+		migration.MemoryShardIndexRecord{ConversationID: "c1", ShardFile: "memories_0001.md", Anchor: "thread-c1"},
+		migration.MemoryShardIndexRecord{ConversationID: "c2", ShardFile: "memories_0001.md", Anchor: "thread-c2"})
+	threadIndex := filepath.Join(root, "thread_index.json")
+	writeJSONL(t, threadIndex,
+		migration.ThreadIndexRecord{ConversationID: "c1", Title: "Moving to Lisbon", ThreadStart: &start, Summary: "Chose Lisbon for the visa."},
+		migration.ThreadIndexRecord{ConversationID: "c2", Title: "Sourdough", Summary: "Starter feeding."})
+
+	cfg := defaultConfig()
+	cfg.Question = "Why did I pick Lisbon?"
+	cfg.ThreadIndexPath = threadIndex
+	cfg.ChunkIndexPath = ""
+	cfg.ShardsDir = shards
+	cfg.MemoryIndexPath = filepath.Join(shards, "memory_index.json")
+	engine, err := retrieval.Load(retrieval.Sources{ThreadIndexPath: cfg.ThreadIndexPath, MemoryIndexPath: cfg.MemoryIndexPath})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	fa := &fakeAnswerer{}
+	ans, err := ask(context.Background(), cfg, engine, nil, fa)
+	if err != nil {
+		t.Fatalf("ask: %v", err)
+	}
+	if len(ans.Sources) != 1 || !strings.Contains(fa.input, `<a id="thread-c1"></a>`) || strings.Contains(fa.input, "Sourdough") {
+		t.Fatalf("context input=%q", fa.input)
+	}
+	if len(ans.Citations) != 1 || ans.Citations[0].location() != "memories_0001.md#thread-c1" {
+		t.Fatalf("citations=%+v", ans.Citations)
+	}
+
+	var out bytes.Buffer
+	if err := writeAnswer(&out, cfg, ans); err != nil {
+		t.Fatalf("writeAnswer: %v", err)
+	}
+	if !strings.Contains(out.String(), "[S1] c1 memories_0001.md#thread-c1 — Moving to Lisbon (2023-11-14)") {
+		t.Fatalf("output=%q", out.String())
+	}
+
+	// No hits: answered without calling the model.
+	cfg.Question = "quantum chromodynamics"
+	ans, err = ask(context.Background(), cfg, engine, nil, nil)
+	if err != nil || len(ans.Sources) != 0 || ans.Answer == "" {
+		t.Fatalf("no-hit ans=%+v err=%v", ans, err)
+	}
+}
+
+func TestBuildSources_RespectsTokenBudget(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("word ", 400)
+	hits := []retrieval.Hit{
+		{Doc: &retrieval.Doc{Kind: retrieval.KindChunk, ConversationID: "a"}, Chunk: &migration.ChunkSummary{Summary: long}},
+		{Doc: &retrieval.Doc{Kind: retrieval.KindChunk, ConversationID: "b"}, Chunk: &migration.ChunkSummary{Summary: long}},
+		{Doc: &retrieval.Doc{Kind: retrieval.KindChunk, ConversationID: "c"}, Chunk: &migration.ChunkSummary{Summary: "short"}},
+	}
+	sources, used := buildSources(fileutils.OS, hits, "", 600)
+	if len(sources) != 2 || sources[0].ConversationID != "a" || sources[1].ConversationID != "c" || sources[1].Ref != "S2" {
+		t.Fatalf("sources=%+v", sources)
+	}
+	if used > 600 {
+		t.Fatalf("used=%d", used)
+	}
+
+	// The top passage is truncated rather than dropped when it alone exceeds the budget.
+	sources, used = buildSources(fileutils.OS, hits[:1], "", 100)
+	if len(sources) != 1 || !strings.HasSuffix(sources[0].text, "…") || used > 100 {
+		t.Fatalf("truncated sources=%+v used=%d", sources, used)
+	}
+}
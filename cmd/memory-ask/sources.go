@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/retrieval"
+)
+
+// source is one retrieved passage placed in the model's context window.
+type source struct {
+	Ref            string  `json:"ref"`
+	Kind           string  `json:"kind"`
+	ConversationID string  `json:"conversation_id"`
+	Title          string  `json:"title,omitempty"`
+	ChunkNumber    int     `json:"chunk_number,omitempty"`
+	ShardFile      string  `json:"shard_file,omitempty"`
+	Anchor         string  `json:"anchor,omitempty"`
+	Date           string  `json:"date,omitempty"`
+	Score          float64 `json:"score"`
+
+	text string
+}
+
+// approxTokens matches memory-pack's ~4 bytes per token estimate.
+func approxTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// buildSources turns ranked hits into context passages, in rank order, until maxTokens is spent. Thread
+// passages come from the memory shards when available so the model sees exactly what was packed; a
+// passage that does not fit is skipped so smaller, lower-ranked ones can still be used. Shards are read
+// from fsys.
+func buildSources(fsys fs.FS, hits []retrieval.Hit, shardsDir string, maxTokens int) ([]source, int) {
+	var out []source
+	used := 0
+	for _, h := range hits {
+		d := h.Doc
+		src := source{
+			Kind: d.Kind, ConversationID: d.ConversationID, Title: d.Title, ChunkNumber: d.ChunkNumber,
+			ShardFile: d.ShardFile, Anchor: d.Anchor, Score: h.Score,
+		}
+		if d.ThreadStart != nil && *d.ThreadStart > 0 {
+			src.Date = time.Unix(int64(*d.ThreadStart), 0).UTC().Format(dateLayout)
+		}
+		switch {
+		case h.Thread != nil:
+			if src.Title == "" {
+				src.Title = h.Thread.Title
+			}
+			src.text, _ = retrieval.ShardSection(fsys, shardsDir, d)
+			if src.text == "" {
+				src.text = passage(h.Thread.Summary, h.Thread.KeyPoints)
+			}
+		case h.Chunk != nil:
+			src.text = passage(h.Chunk.Summary, h.Chunk.KeyPoints)
+		}
+		if strings.TrimSpace(src.text) == "" {
+			continue
+		}
+
+		src.Ref = fmt.Sprintf("S%d", len(out)+1)
+		block := renderSource(src)
+		tokens := approxTokens(block)
+		if used+tokens > maxTokens {
+			if len(out) > 0 {
+				continue
+			}
+			// Always keep the best passage, cut down to the budget.
+			head := src
+			head.text = ""
+			src.text = truncateToTokens(src.text, maxTokens-approxTokens(renderSource(head)))
+			block = renderSource(src)
+			tokens = approxTokens(block)
+		}
+		used += tokens
+		out = append(out, src)
+	}
+	return out, used
+}
+
+func passage(summary string, keyPoints []string) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(summary))
+	for _, kp := range keyPoints {
+		if kp = strings.TrimSpace(kp); kp != "" {
+			b.WriteString("\n- ")
+			b.WriteString(kp)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func truncateToTokens(s string, tokens int) string {
+	limit := tokens * 4
+	if len(s) <= limit {
+		return s
+	}
+	limit -= len("…")
+	if limit <= 0 {
+		return ""
+	}
+	cut := s[:limit]
+	// Step back off a partial multi-byte rune.
+	for len(cut) > 0 && !utf8.ValidString(cut) {
+		cut = cut[:len(cut)-1]
+	}
+	return strings.TrimSpace(cut) + "…"
+}
+
+func renderSource(s source) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] %s conversation_id=%s", s.Ref, s.Kind, s.ConversationID)
+	if s.ChunkNumber > 0 {
+		fmt.Fprintf(&b, " chunk=%d", s.ChunkNumber)
+	}
+	if s.Date != "" {
+		fmt.Fprintf(&b, " date=%s", s.Date)
+	}
+	if s.Title != "" {
+		fmt.Fprintf(&b, " title=%q", s.Title)
+	}
+	b.WriteString("\n")
+	b.WriteString(s.text)
+	b.WriteString("\n\n")
+	return b.String()
+}
+
+func buildInput(question string, sources []source) string {
+	var b strings.Builder
+	b.WriteString("QUESTION:\n")
+	b.WriteString(strings.TrimSpace(question))
+	b.WriteString("\n\nSOURCES:\n\n")
+	for _, s := range sources {
+		b.WriteString(renderSource(s))
+	}
+	return b.String()
+}
+
+var citationRef = regexp.MustCompile(`\[(S\d+)\]`)
+
+// citedSources returns the sources the answer cites, in order of first use. Inline [S#] markers are
+// authoritative; the model's citations list only adds refs the text did not mark. Unknown refs are
+// dropped.
+func citedSources(answer string, listed []string, sources []source) []source {
+	byRef := make(map[string]source, len(sources))
+	for _, s := range sources {
+		byRef[s.Ref] = s
+	}
+	seen := map[string]bool{}
+	var out []source
+	add := func(ref string) {
+		ref = strings.Trim(strings.TrimSpace(ref), "[]")
+		if s, ok := byRef[ref]; ok && !seen[ref] {
+			seen[ref] = true
+			out = append(out, s)
+		}
+	}
+	for _, m := range citationRef.FindAllStringSubmatch(answer, -1) {
+		add(m[1])
+	}
+	for _, ref := range listed {
+		add(ref)
+	}
+	return out
+}
+
+// location is the human-facing pointer for a citation: shard file and anchor when packed.
+func (s source) location() string {
+	switch {
+	case s.ShardFile != "" && s.Anchor != "":
+		return s.ShardFile + "#" + s.Anchor
+	case s.Anchor != "":
+		return "#" + s.Anchor
+	}
+	return ""
+}
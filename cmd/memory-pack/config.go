@@ -3,23 +3,78 @@ package main
 import (
 	"errors"
 	"path/filepath"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+// Output profiles.
+const (
+	profileShards     = "shards"
+	profileFileSearch = "file-search"
+	profileAggregate  = "aggregate"
 )
 
 type Config struct {
-	InPath           string
-	OutDir           string
-	IndexPath        string
-	MaxBytes         int
-	Overwrite        bool
+	InPath    string
+	OutDir    string
+	IndexPath string
+	MaxBytes  int
+	Overwrite bool
+	// Incremental keeps the shards already in OutDir and packs only new or changed threads (see
+	// migration.MemoryPackOptions.Packed).
+	Incremental      bool
 	IncludeKeyPoints bool
 	IncludeTags      bool
-	Mode             string
+	ThreadFiles      bool
+	JSONShards       bool
+	// Footer ends each shard with the tool version, models, prompt versions and generation time.
+	Footer bool
+	// TemplateDir holds thread section templates (see migration.LoadShardTemplates).
+	TemplateDir string
+	// SourceIndex is chunk-summarizer's chunk index, used to link each section to its chunks; links
+	// are relative to SourceRoot (default OutDir, so they resolve from the shards).
+	SourceIndex  string
+	SourceRoot   string
+	Mode         string
+	OverridesDir string
+	Profile      string
+	GroupBy      string
+	// Source packs only the threads of one source type (see migration.NormalizeSourceType), so each
+	// platform can get its own shard tree.
+	Source string
+
+	ShareSafe   bool
+	NamesMap    string
+	NamesList   string
+	DetectNames bool
+
+	// AggregateMinCount and AggregateEpsilon control the aggregate profile (see migration.AggregateOptions).
+	AggregateMinCount int
+	AggregateEpsilon  float64
 
 	IndexSummaryMaxChars int
 	IndexTagsMax         int
 	IndexTermsMax        int
 	IndexIncludeTags     bool
 	IndexIncludeTerms    bool
+
+	// FromIndex reads thread-rollup's thread index instead of walking InPath.
+	FromIndex string
+	// LoadWorkers is how many rollups are read at a time.
+	LoadWorkers int
+	// Force packs even when the thread index disagrees with the rollups on disk (see checkThreadIndex).
+	Force bool
+
+	Durability  string
+	AtomicWrite string
+	// CanonicalJSON writes JSON outputs in canonical form (see fileutils.Canonicalize).
+	CanonicalJSON bool
+
+	// MaxFilesPerDir and MaxOutputBytes set the output quota (see fileutils.Quota).
+	MaxFilesPerDir int
+	MaxOutputBytes int64
 }
 
 func (c Config) Validate() error {
@@ -32,9 +87,131 @@ func (c Config) Validate() error {
 	if c.MaxBytes <= 0 {
 		return errors.New("max-bytes must be > 0")
 	}
+	switch c.Profile {
+	case profileShards:
+	case profileFileSearch:
+		if c.GroupBy != migration.FileSearchGroupThread && c.GroupBy != migration.FileSearchGroupMonth {
+			return errors.New("group-by must be thread or month")
+		}
+		if c.MaxBytes > migration.FileSearchMaxFileBytes {
+			return errors.New("max-bytes exceeds the file-search upload limit")
+		}
+	case profileAggregate:
+		if c.ShareSafe {
+			return errors.New("-share-safe does not apply to -profile aggregate, which writes no text")
+		}
+		if c.AggregateMinCount < 0 || c.AggregateEpsilon < 0 {
+			return errors.New("min-count and epsilon must be >= 0")
+		}
+	default:
+		return errors.New("profile must be shards, file-search, or aggregate")
+	}
+	if c.Incremental && (c.Overwrite || c.Profile != profileShards) {
+		return errors.New("-incremental applies to -profile shards without -overwrite")
+	}
+	if c.TemplateDir != "" && c.Profile == profileAggregate {
+		return errors.New("-template-dir does not apply to -profile aggregate, which writes no sections")
+	}
+	if c.SourceIndex != "" && c.Profile != profileShards {
+		return errors.New("-source-index applies to -profile shards")
+	}
+	if c.SourceIndex != "" && c.ShareSafe {
+		return errors.New("-source-index links the raw chunks, which a -share-safe copy must not point at")
+	}
+	if c.SourceRoot != "" && c.SourceIndex == "" {
+		return errors.New("-source-root needs -source-index")
+	}
+	if c.JSONShards && c.Profile != profileShards {
+		return errors.New("-json-shards applies to -profile shards")
+	}
+	if c.Footer && c.Profile != profileShards {
+		return errors.New("-footer applies to -profile shards")
+	}
+	if c.LoadWorkers < 1 {
+		return errors.New("load-workers must be >= 1")
+	}
+	if c.ShareSafe && c.NamesMap == "" {
+		return errors.New("missing -names-map")
+	}
+	if _, err := fileutils.ParseDurability(c.Durability); err != nil {
+		return err
+	}
+	if _, err := fileutils.ParseAtomicWrite(c.AtomicWrite); err != nil {
+		return err
+	}
 	return nil
 }
 
+func (c Config) fileSearchOptions(templates *migration.ShardTemplates) migration.FileSearchPackOptions {
+	return migration.FileSearchPackOptions{
+		OutDir:           c.OutDir,
+		GroupBy:          c.GroupBy,
+		MaxBytes:         c.MaxBytes,
+		Overwrite:        c.Overwrite,
+		IncludeKeyPoints: c.IncludeKeyPoints,
+		IncludeTags:      c.IncludeTags,
+		Templates:        templates,
+	}
+}
+
+func (c Config) aggregateOptions() migration.AggregateOptions {
+	return migration.AggregateOptions{
+		OutDir:    c.OutDir,
+		Overwrite: c.Overwrite,
+		MinCount:  c.AggregateMinCount,
+		Epsilon:   c.AggregateEpsilon,
+	}
+}
+
+// fromSource reports whether a thread of sourceType is packed under -source.
+func (c Config) fromSource(sourceType string) bool {
+	return c.Source == "" || migration.NormalizeSourceType(sourceType) == migration.NormalizeSourceType(c.Source)
+}
+
+// shardTemplates loads -template-dir, or returns nil for the built-in layout.
+func (c Config) shardTemplates() (*migration.ShardTemplates, error) {
+	if c.TemplateDir == "" {
+		return nil, nil
+	}
+	return migration.LoadShardTemplates(c.TemplateDir)
+}
+
+// packOptions returns the shard options; with -incremental they carry the threads indexPath lists.
+func (c Config) packOptions(indexPath string, templates *migration.ShardTemplates) (migration.MemoryPackOptions, error) {
+	opts := migration.MemoryPackOptions{
+		OutDir:           c.OutDir,
+		MaxBytes:         c.MaxBytes,
+		Overwrite:        c.Overwrite,
+		IncludeKeyPoints: c.IncludeKeyPoints,
+		IncludeTags:      c.IncludeTags,
+		ThreadFiles:      c.ThreadFiles,
+		JSONShards:       c.JSONShards,
+		Templates:        templates,
+	}
+	if c.Footer {
+		opts.Footer = &migration.ShardFooter{ToolVersion: migration.ToolVersion(), GeneratedAt: time.Now()}
+	}
+	if c.SourceIndex != "" {
+		root := c.SourceRoot
+		if root == "" {
+			root = c.OutDir
+		}
+		sources, err := migration.ReadSourceLinks(c.SourceIndex, root)
+		if err != nil {
+			return opts, err
+		}
+		opts.Sources = sources
+	}
+	if c.Incremental {
+		packed, err := migration.ReadPackedThreads(indexPath)
+		if err != nil {
+			return opts, err
+		}
+		opts.Packed = packed
+	}
+	return opts, nil
+}
+
 func defaultConfig() Config {
 	return Config{
 		InPath:               filepath.FromSlash("docs/peanut-gallery/threads/thread_summaries"),
@@ -43,10 +220,18 @@ func defaultConfig() Config {
 		IncludeKeyPoints:     true,
 		IncludeTags:          true,
 		Mode:                 "semantic",
+		OverridesDir:         filepath.FromSlash("docs/peanut-gallery/threads/overrides"),
+		Profile:              profileShards,
+		GroupBy:              migration.FileSearchGroupThread,
+		NamesMap:             filepath.FromSlash("docs/peanut-gallery/threads/" + migration.ShareSafeNamesFileName),
+		DetectNames:          true,
+		AggregateMinCount:    migration.DefaultAggregateMinCount,
 		IndexSummaryMaxChars: 400,
 		IndexTagsMax:         5,
 		IndexTermsMax:        15,
 		IndexIncludeTags:     true,
 		IndexIncludeTerms:    true,
+		LoadWorkers:          8,
+		Durability:           fileutils.DurabilityFull,
 	}
 }
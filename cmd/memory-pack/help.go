@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+var help = cli.Help{
+	Name:    "memory-pack",
+	Summary: "pack thread rollups into markdown memory shards or file-search uploads",
+	Groups: []cli.Group{
+		{Title: "Input and output", Flags: []string{"in", "from-index", "load-workers", "force", "out", "index", "overrides", "overwrite", "incremental", "durability", "atomic-write", "canonical-json", "max-files-per-dir", "max-output-bytes"}},
+		{Title: "Packing", Flags: []string{"mode", "source", "profile", "group-by", "max-bytes", "thread-files", "json-shards", "footer", "template-dir", "source-index", "source-root", "include-keypoints", "include-tags"}},
+		{Title: "Index rows", Flags: []string{"index-summary-max-chars", "index-tags-max", "index-terms-max", "index-include-tags", "index-include-terms"}},
+		{Title: "Sharing", Flags: []string{"share-safe", "names-map", "names", "detect-names", "min-count", "epsilon"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "pack semantic rollups into ~100KB shards", Command: "memory-pack -in docs/peanut-gallery/threads/thread_summaries -out docs/peanut-gallery/threads/memory_shards"},
+		{Comment: "pack straight from the thread index without walking the archive", Command: "memory-pack -from-index docs/peanut-gallery/threads/thread_summaries/thread_index.json"},
+		{Comment: "one upload file per month for a file-search tool", Command: "memory-pack -profile file-search -group-by month -out docs/peanut-gallery/threads/file_search"},
+		{Comment: "a separate shard tree for WhatsApp chats", Command: "memory-pack -source whatsapp -out docs/peanut-gallery/threads/memory_shards/whatsapp"},
+		{Comment: "an anonymized copy to share", Command: "memory-pack -share-safe -out docs/peanut-gallery/threads/memory_shards_shared"},
+		{Comment: "emotion counts per month with no text, for publishing", Command: "memory-pack -mode sentiment -profile aggregate -min-count 5 -epsilon 1"},
+	},
+	Values: map[string][]string{
+		"mode":         {"semantic", "sentiment"},
+		"profile":      {profileShards, profileFileSearch, profileAggregate},
+		"group-by":     {"thread", "month"},
+		"durability":   fileutils.DurabilityModes,
+		"atomic-write": fileutils.AtomicWriteModes,
+	},
+}
@@ -1,17 +1,18 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
-	"io/fs"
 	"os"
 	"path/filepath"
-	"sort"
+	"slices"
 	"strings"
 
 	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
 )
 
 func main() {
@@ -24,25 +25,76 @@ func main() {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(2)
 	}
+	if err := layout.LoadConventionsFromEnv(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetDurability(cfg.Durability); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetAtomicWrite(cfg.AtomicWrite); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	fileutils.SetCanonicalJSON(cfg.CanonicalJSON)
+	if err := fileutils.SetQuota(fileutils.Quota{MaxFilesPerDir: cfg.MaxFilesPerDir, MaxBytes: cfg.MaxOutputBytes}); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	templates, err := cfg.shardTemplates()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
 
 	mode := strings.ToLower(strings.TrimSpace(cfg.Mode))
 	if mode == "" {
 		mode = "semantic"
 	}
 
-	paths, err := collectThreadSummaryFiles(cfg.InPath, mode)
+	var (
+		paths    []string
+		rows     []migration.ThreadIndexRecord
+		sentRows []migration.ThreadSentimentIndexRecord
+		total    int
+	)
+	switch {
+	case cfg.FromIndex != "" && mode == "sentiment":
+		sentRows, err = migration.ReadThreadSentimentIndex(cfg.FromIndex)
+		total = len(sentRows)
+		sentRows = slices.DeleteFunc(sentRows, func(r migration.ThreadSentimentIndexRecord) bool { return !cfg.fromSource(r.SourceType) })
+	case cfg.FromIndex != "":
+		rows, err = migration.ReadThreadIndex(cfg.FromIndex)
+		total = len(rows)
+		rows = slices.DeleteFunc(rows, func(r migration.ThreadIndexRecord) bool { return !cfg.fromSource(r.SourceType) })
+	default:
+		paths, err = collectThreadSummaryFiles(cfg.InPath, mode)
+		total = len(paths)
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(2)
 	}
-	if len(paths) == 0 {
-		if mode == "sentiment" {
-			fmt.Fprintln(os.Stderr, "no *.thread.sentiment.summary.json files found")
+	if total == 0 {
+		if cfg.FromIndex != "" {
+			fmt.Fprintf(os.Stderr, "no rows in %s\n", cfg.FromIndex)
 		} else {
-			fmt.Fprintln(os.Stderr, "no *.thread.summary.json files found")
+			fmt.Fprintf(os.Stderr, "no *%s files found\n", layout.Suffix(rollupKind(mode)))
 		}
 		os.Exit(2)
 	}
+	indexWarnings, err := checkThreadIndex(cfg, mode, paths, rows, sentRows)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	for _, w := range indexWarnings {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+	// Without share-safe or the file-search and aggregate profiles, which need every summary up front, -from-index
+	// streams rollups into the shards as they are rendered.
+	stream := cfg.FromIndex != "" && cfg.Profile == profileShards && !cfg.ShareSafe
 
 	indexPath := cfg.IndexPath
 	if indexPath == "" {
@@ -53,33 +105,67 @@ func main() {
 		}
 	}
 
+	overrides, err := migration.LoadOverrides(fileutils.OS, cfg.OverridesDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	report := migration.NewRunReport("memory-pack", cfg)
+	report.Total = int64(total)
+	report.Warnings = append(report.Warnings, indexWarnings...)
+
 	switch mode {
 	case "sentiment":
-		summaries := make([]migration.ThreadSentimentSummary, 0, len(paths))
-		for _, p := range paths {
-			b, err := os.ReadFile(p)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, fmt.Errorf("read %s: %w", p, err).Error())
+		load := sentimentLoader(overrides)
+		var summaries []migration.ThreadSentimentSummary
+		if !stream {
+			if summaries, err = loadSentimentSummaries(cfg, paths, sentRows, load); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
 				os.Exit(1)
 			}
-			var ts migration.ThreadSentimentSummary
-			if err := json.Unmarshal(b, &ts); err != nil {
-				fmt.Fprintln(os.Stderr, fmt.Errorf("unmarshal %s: %w", p, err).Error())
+		}
+		if cfg.ShareSafe {
+			if summaries, err = anonymizeSentiment(cfg, summaries); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
 				os.Exit(1)
 			}
-			if ts.ConversationID == "" {
-				continue
+		}
+
+		if cfg.Profile == profileAggregate {
+			export, err := migration.WriteSentimentAggregateExport(summaries, cfg.aggregateOptions())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
 			}
-			summaries = append(summaries, ts)
+			finishAggregateExport(report, cfg, "sentiment", len(summaries), export)
+			return
+		}
+		if cfg.Profile == profileFileSearch {
+			manifest, err := migration.WriteSentimentFileSearchPack(summaries, cfg.fileSearchOptions(templates))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+			finishFileSearchPack(report, cfg, "sentiment", len(summaries), manifest)
+			return
 		}
 
-		index, err := migration.WriteSentimentMemoryShards(summaries, migration.MemoryPackOptions{
-			OutDir:           cfg.OutDir,
-			MaxBytes:         cfg.MaxBytes,
-			Overwrite:        cfg.Overwrite,
-			IncludeKeyPoints: cfg.IncludeKeyPoints,
-			IncludeTags:      cfg.IncludeTags,
-		})
+		opts, err := cfg.packOptions(indexPath, templates)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		var index []migration.SentimentMemoryShardIndexRecord
+		valid := len(summaries)
+		if stream {
+			index, err = migration.WriteSentimentMemoryShardsFromIndex(sentRows, cfg.LoadWorkers, func(r migration.ThreadSentimentIndexRecord) (migration.ThreadSentimentSummary, error) {
+				return load(r.ThreadSentimentSummaryPath)
+			}, opts)
+			valid = len(sentRows)
+		} else {
+			index, err = migration.WriteSentimentMemoryShards(summaries, opts)
+		}
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 			os.Exit(1)
@@ -106,37 +192,72 @@ func main() {
 			}
 		}
 
-		if err := migration.WriteSentimentMemoryIndex(indexPath, index, cfg.Overwrite); err != nil {
+		if err := migration.WriteSentimentMemoryIndex(indexPath, index, cfg.Overwrite || cfg.Incremental); err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 			os.Exit(1)
 		}
-		fmt.Fprintf(os.Stdout, "threads_packed=%d mode=sentiment out_dir=%s index=%s\n", len(index), cfg.OutDir, indexPath)
+		kept := 0
+		for _, r := range index {
+			if p, ok := opts.Packed[r.ConversationID]; ok && p.ShardFile == r.ShardFile && p.SectionHash == r.SectionHash {
+				kept++
+			}
+		}
+		writePackReport(report, cfg, valid, len(index), indexPath)
+		if err := fileutils.Flush(); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stdout, "threads_packed=%d threads_kept=%d mode=sentiment out_dir=%s index=%s\n", len(index)-kept, kept, cfg.OutDir, indexPath)
 	default:
-		summaries := make([]migration.ThreadSummary, 0, len(paths))
-		for _, p := range paths {
-			b, err := os.ReadFile(p)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, fmt.Errorf("read %s: %w", p, err).Error())
+		load := threadLoader(overrides)
+		var summaries []migration.ThreadSummary
+		if !stream {
+			if summaries, err = loadThreadSummaries(cfg, paths, rows, load); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
 				os.Exit(1)
 			}
-			var ts migration.ThreadSummary
-			if err := json.Unmarshal(b, &ts); err != nil {
-				fmt.Fprintln(os.Stderr, fmt.Errorf("unmarshal %s: %w", p, err).Error())
+		}
+		if cfg.ShareSafe {
+			if summaries, err = anonymizeThreads(cfg, summaries); err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+			}
+		}
+
+		if cfg.Profile == profileAggregate {
+			export, err := migration.WriteAggregateExport(summaries, cfg.aggregateOptions())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
 				os.Exit(1)
 			}
-			if ts.ConversationID == "" {
-				continue
+			finishAggregateExport(report, cfg, "semantic", len(summaries), export)
+			return
+		}
+		if cfg.Profile == profileFileSearch {
+			manifest, err := migration.WriteFileSearchPack(summaries, cfg.fileSearchOptions(templates))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
 			}
-			summaries = append(summaries, ts)
+			finishFileSearchPack(report, cfg, "semantic", len(summaries), manifest)
+			return
 		}
 
-		index, err := migration.WriteMemoryShards(summaries, migration.MemoryPackOptions{
-			OutDir:           cfg.OutDir,
-			MaxBytes:         cfg.MaxBytes,
-			Overwrite:        cfg.Overwrite,
-			IncludeKeyPoints: cfg.IncludeKeyPoints,
-			IncludeTags:      cfg.IncludeTags,
-		})
+		opts, err := cfg.packOptions(indexPath, templates)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		var index []migration.MemoryShardIndexRecord
+		valid := len(summaries)
+		if stream {
+			index, err = migration.WriteMemoryShardsFromIndex(rows, cfg.LoadWorkers, func(r migration.ThreadIndexRecord) (migration.ThreadSummary, error) {
+				return load(r.ThreadSummaryPath)
+			}, opts)
+			valid = len(rows)
+		} else {
+			index, err = migration.WriteMemoryShards(summaries, opts)
+		}
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 			os.Exit(1)
@@ -145,25 +266,160 @@ func main() {
 		for i := range index {
 			index[i].Summary = truncateLimit(index[i].Summary, cfg.IndexSummaryMaxChars)
 			if cfg.IndexIncludeTags {
-				index[i].Tags = limitSlice(index[i].Tags, cfg.IndexTagsMax)
+				index[i].Tags = migration.SortTags(limitSlice(index[i].Tags, cfg.IndexTagsMax))
 			} else {
 				index[i].Tags = nil
 			}
 			if cfg.IndexIncludeTerms {
-				index[i].Terms = limitSlice(index[i].Terms, cfg.IndexTermsMax)
+				index[i].Terms = migration.SortTags(limitSlice(index[i].Terms, cfg.IndexTermsMax))
 			} else {
 				index[i].Terms = nil
 			}
 		}
 
-		if err := migration.WriteMemoryIndex(indexPath, index, cfg.Overwrite); err != nil {
+		if err := migration.WriteMemoryIndex(indexPath, index, cfg.Overwrite || cfg.Incremental); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		kept := 0
+		for _, r := range index {
+			if p, ok := opts.Packed[r.ConversationID]; ok && p.ShardFile == r.ShardFile && p.SectionHash == r.SectionHash {
+				kept++
+			}
+		}
+		writePackReport(report, cfg, valid, len(index), indexPath)
+		if err := fileutils.Flush(); err != nil {
 			fmt.Fprintln(os.Stderr, err.Error())
 			os.Exit(1)
 		}
-		fmt.Fprintf(os.Stdout, "threads_packed=%d mode=semantic out_dir=%s index=%s\n", len(index), cfg.OutDir, indexPath)
+		fmt.Fprintf(os.Stdout, "threads_packed=%d threads_kept=%d mode=semantic out_dir=%s index=%s\n", len(index)-kept, kept, cfg.OutDir, indexPath)
+	}
+}
+
+// threadLoader reads one semantic rollup and applies its overrides. A rollup without a conversation_id
+// loads as the zero summary, which packing skips.
+func threadLoader(overrides *migration.Overrides) func(path string) (migration.ThreadSummary, error) {
+	return func(p string) (migration.ThreadSummary, error) {
+		var ts migration.ThreadSummary
+		if err := fileutils.ReadArtifact(p, &ts); err != nil {
+			return migration.ThreadSummary{}, fmt.Errorf("read %s: %w", p, err)
+		}
+		if ts.ConversationID == "" {
+			return migration.ThreadSummary{}, nil
+		}
+		if err := overrides.ApplySemantic(&ts); err != nil {
+			return migration.ThreadSummary{}, fmt.Errorf("override %s: %w", ts.ConversationID, err)
+		}
+		return ts, nil
+	}
+}
+
+// sentimentLoader is threadLoader for sentiment rollups.
+func sentimentLoader(overrides *migration.Overrides) func(path string) (migration.ThreadSentimentSummary, error) {
+	return func(p string) (migration.ThreadSentimentSummary, error) {
+		var ts migration.ThreadSentimentSummary
+		if err := fileutils.ReadArtifact(p, &ts); err != nil {
+			return migration.ThreadSentimentSummary{}, fmt.Errorf("read %s: %w", p, err)
+		}
+		if ts.ConversationID == "" {
+			return migration.ThreadSentimentSummary{}, nil
+		}
+		if err := overrides.ApplySentiment(&ts); err != nil {
+			return migration.ThreadSentimentSummary{}, fmt.Errorf("override %s: %w", ts.ConversationID, err)
+		}
+		return ts, nil
+	}
+}
+
+// loadThreadSummaries loads every rollup up front: the walked paths, or with -from-index the rows'
+// rollups, cfg.LoadWorkers at a time.
+func loadThreadSummaries(cfg Config, paths []string, rows []migration.ThreadIndexRecord, load func(string) (migration.ThreadSummary, error)) ([]migration.ThreadSummary, error) {
+	if cfg.FromIndex != "" {
+		paths = make([]string, 0, len(rows))
+		for _, r := range rows {
+			paths = append(paths, r.ThreadSummaryPath)
+		}
+	}
+	summaries := make([]migration.ThreadSummary, 0, len(paths))
+	err := fileutils.ParallelOrdered(paths, cfg.LoadWorkers, load, func(ts migration.ThreadSummary) error {
+		if ts.ConversationID != "" && cfg.fromSource(ts.SourceType) {
+			summaries = append(summaries, ts)
+		}
+		return nil
+	})
+	return summaries, err
+}
+
+// loadSentimentSummaries is loadThreadSummaries for sentiment rollups.
+func loadSentimentSummaries(cfg Config, paths []string, rows []migration.ThreadSentimentIndexRecord, load func(string) (migration.ThreadSentimentSummary, error)) ([]migration.ThreadSentimentSummary, error) {
+	if cfg.FromIndex != "" {
+		paths = make([]string, 0, len(rows))
+		for _, r := range rows {
+			paths = append(paths, r.ThreadSentimentSummaryPath)
+		}
+	}
+	summaries := make([]migration.ThreadSentimentSummary, 0, len(paths))
+	err := fileutils.ParallelOrdered(paths, cfg.LoadWorkers, load, func(ts migration.ThreadSentimentSummary) error {
+		if ts.ConversationID != "" && cfg.fromSource(ts.SourceType) {
+			summaries = append(summaries, ts)
+		}
+		return nil
+	})
+	return summaries, err
+}
+
+// writePackReport records a finished pack in <out>/run_report.json. Summary files without a
+// conversation_id, or from another -source, are counted as skipped.
+func writePackReport(report *migration.RunReport, cfg Config, valid int, packed int, indexPath string) {
+	report.Processed = int64(packed)
+	report.Skipped = report.Total - int64(valid)
+	report.Outputs = map[string]string{"out_dir": cfg.OutDir, "index": indexPath}
+	if err := migration.WriteRunReport(filepath.Join(cfg.OutDir, migration.RunReportFileName), report); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
 	}
 }
 
+// finishFileSearchPack records a file-search pack in <out>/run_report.json and prints the final stats.
+func finishFileSearchPack(report *migration.RunReport, cfg Config, mode string, valid int, manifest migration.FileSearchManifest) {
+	manifestPath := filepath.Join(cfg.OutDir, migration.FileSearchManifestFileName)
+	threads := 0
+	for _, f := range manifest.Files {
+		threads += len(f.ConversationIDs)
+	}
+	report.Processed = int64(threads)
+	report.Skipped = report.Total - int64(valid)
+	report.Outputs = map[string]string{"out_dir": cfg.OutDir, "manifest": manifestPath}
+	if err := migration.WriteRunReport(filepath.Join(cfg.OutDir, migration.RunReportFileName), report); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if err := fileutils.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stdout, "files_written=%d threads_packed=%d profile=%s mode=%s group_by=%s out_dir=%s manifest=%s\n",
+		len(manifest.Files), threads, profileFileSearch, mode, manifest.GroupBy, cfg.OutDir, manifestPath)
+}
+
+// finishAggregateExport records an aggregate export in <out>/run_report.json and prints the final stats.
+func finishAggregateExport(report *migration.RunReport, cfg Config, mode string, valid int, export migration.AggregateExport) {
+	exportPath := filepath.Join(cfg.OutDir, migration.AggregatesFileName)
+	report.Processed = int64(valid)
+	report.Skipped = report.Total - int64(valid)
+	report.Outputs = map[string]string{"out_dir": cfg.OutDir, "aggregates": exportPath}
+	if err := migration.WriteRunReport(filepath.Join(cfg.OutDir, migration.RunReportFileName), report); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if err := fileutils.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stdout, "threads_counted=%d profile=%s mode=%s min_count=%d epsilon=%g aggregates=%s\n",
+		valid, profileAggregate, mode, export.MinCount, export.Epsilon, exportPath)
+}
+
 func truncateLimit(s string, max int) string {
 	s = strings.TrimSpace(s)
 	if max <= 0 || len(s) <= max {
@@ -183,23 +439,58 @@ func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
 	semanticDefaults := defaultConfig()
 	cfg := semanticDefaults
 	fs.SetOutput(os.Stderr)
+	cli.Setup(fs, help)
 	fs.StringVar(&cfg.InPath, "in", cfg.InPath, "Path to thread summaries directory (mode-dependent, recursively)")
 	fs.StringVar(&cfg.OutDir, "out", cfg.OutDir, "Output directory for markdown shard files")
 	fs.StringVar(&cfg.IndexPath, "index", "", "Optional path for memory_index.json (default: <out>/memory_index.json)")
 	fs.IntVar(&cfg.MaxBytes, "max-bytes", cfg.MaxBytes, "Max UTF-8 bytes per markdown shard file (default ~100KB)")
 	fs.BoolVar(&cfg.Overwrite, "overwrite", false, "Overwrite existing shard/index files")
+	fs.BoolVar(&cfg.Incremental, "incremental", false, "Keep the shards already in -out and pack only threads that are new or changed since the existing index, into new shards; the index is rewritten")
 	fs.BoolVar(&cfg.IncludeKeyPoints, "include-keypoints", cfg.IncludeKeyPoints, "Include key points section per thread")
 	fs.BoolVar(&cfg.IncludeTags, "include-tags", cfg.IncludeTags, "Include tags/terms lines per thread")
+	fs.BoolVar(&cfg.ThreadFiles, "thread-files", cfg.ThreadFiles, "Also write each thread to <out>/threads_md/<conversation_id>.md")
+	fs.StringVar(&cfg.TemplateDir, "template-dir", "", "Directory with thread.md.tmpl and/or sentiment_thread.md.tmpl (Go text/template) to render thread sections instead of the built-in layout")
+	fs.StringVar(&cfg.SourceIndex, "source-index", "", "chunk-summarizer's index.json (sentiment_index.json with -mode sentiment); each section links to its chunk files and chunk summaries")
+	fs.StringVar(&cfg.SourceRoot, "source-root", "", "Directory the -source-index links are relative to (default: -out, so they resolve from the shards)")
+	fs.BoolVar(&cfg.JSONShards, "json-shards", false, "Also write each shard's sections as JSON beside it (memories_0001.json next to memories_0001.md), with the same anchors as the markdown")
+	fs.BoolVar(&cfg.Footer, "footer", false, "End each shard with a generation footer: tool version, the models and prompt versions of its threads, and the date")
 	fs.StringVar(&cfg.Mode, "mode", cfg.Mode, "Packing mode: semantic or sentiment")
+	fs.StringVar(&cfg.Source, "source", "", "Only pack threads from this source type (chatgpt, whatsapp, telegram, email, journal); with its own -out, each source gets its own shard tree")
+	fs.StringVar(&cfg.Profile, "profile", cfg.Profile, "Output profile: shards (markdown shards + index), file-search (files + manifest for vector store upload), or aggregate (counts only, no text, for sharing analysis)")
+	fs.IntVar(&cfg.AggregateMinCount, "min-count", cfg.AggregateMinCount, "aggregate: drop counts below N so rare labels and months do not single out threads (0 keeps all)")
+	fs.Float64Var(&cfg.AggregateEpsilon, "epsilon", 0, "aggregate: add Laplace noise of scale 1/epsilon to every count (0 = exact counts)")
+	fs.StringVar(&cfg.GroupBy, "group-by", cfg.GroupBy, "file-search profile: one file per thread or per month")
+	fs.BoolVar(&cfg.ShareSafe, "share-safe", false, "Write an anonymized copy for sharing: names become stable pseudonyms, dates are coarsened to the month, quotes are removed (default out: <out>_share_safe)")
+	fs.StringVar(&cfg.NamesMap, "names-map", cfg.NamesMap, "share-safe: name -> pseudonym mapping file, reused and extended across runs (keep it private)")
+	fs.StringVar(&cfg.NamesList, "names", "", "share-safe: optional file of names to always pseudonymize, one per line")
+	fs.BoolVar(&cfg.DetectNames, "detect-names", cfg.DetectNames, "share-safe: also pseudonymize capitalized mid-sentence words that look like names")
+	fs.StringVar(&cfg.OverridesDir, "overrides", cfg.OverridesDir, "Directory of hand-written partial JSON corrections (<conversation_id>.json, <conversation_id>.sentiment.json) merged over thread summaries before packing")
 	fs.IntVar(&cfg.IndexSummaryMaxChars, "index-summary-max-chars", cfg.IndexSummaryMaxChars, "Max chars in index summary fields (0 disables truncation)")
 	fs.IntVar(&cfg.IndexTagsMax, "index-tags-max", cfg.IndexTagsMax, "Max tag/theme labels stored in index rows (0 disables limiting)")
 	fs.IntVar(&cfg.IndexTermsMax, "index-terms-max", cfg.IndexTermsMax, "Max term/emotion labels stored in index rows (0 disables limiting)")
 	fs.BoolVar(&cfg.IndexIncludeTags, "index-include-tags", cfg.IndexIncludeTags, "Include tag/theme arrays in index rows")
 	fs.BoolVar(&cfg.IndexIncludeTerms, "index-include-terms", cfg.IndexIncludeTerms, "Include term/emotion arrays in index rows")
+	fs.StringVar(&cfg.FromIndex, "from-index", "", "Read thread-rollup's thread_index.json (sentiment_thread_index.json with -mode sentiment) instead of walking -in; rollups are loaded as they are packed")
+	fs.IntVar(&cfg.LoadWorkers, "load-workers", cfg.LoadWorkers, "Goroutines reading rollups")
+	fs.BoolVar(&cfg.Force, "force", false, "Pack even when the thread index is stale (rollups missing from it or edited since, rows without a rollup, an unfinished rollup run); the problems become warnings")
+	fs.StringVar(&cfg.Durability, "durability", cfg.Durability, "fsync policy for output files: none, group (sync in batches), or full (sync every file)")
+	fs.StringVar(&cfg.AtomicWrite, "atomic-write", fileutils.AtomicRename, "How finished files replace their targets: rename (atomic), staged (temp files in TMPDIR, kept out of synced folders), or copy (written in place, for shares that refuse rename)")
+	fs.BoolVar(&cfg.CanonicalJSON, "canonical-json", cfg.CanonicalJSON, "Write JSON outputs with sorted keys and stable number formatting so regenerated files diff cleanly")
+	fs.IntVar(&cfg.MaxFilesPerDir, "max-files-per-dir", fileutils.DefaultMaxFilesPerDir, "Stop with an error before any output directory holds more than N files (0 disables)")
+	fs.Int64Var(&cfg.MaxOutputBytes, "max-output-bytes", 0, "Stop with an error before this run writes more than N bytes (0 disables)")
 
 	if err := fs.Parse(args); err != nil {
 		return Config{}, err
 	}
+	maxBytesSet, outSet := false, false
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "max-bytes":
+			maxBytesSet = true
+		case "out":
+			outSet = true
+		}
+	})
 
 	// If user chose sentiment mode but left in/out at semantic defaults, switch to sentiment defaults.
 	mode := strings.ToLower(strings.TrimSpace(cfg.Mode))
@@ -212,14 +503,109 @@ func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
 		}
 	}
 
+	// The file-search profile gets its own default output dir and file size.
+	cfg.Profile = strings.ToLower(strings.TrimSpace(cfg.Profile))
+	if cfg.Profile == profileFileSearch {
+		switch cfg.OutDir {
+		case semanticDefaults.OutDir:
+			cfg.OutDir = filepath.FromSlash("docs/peanut-gallery/threads/file_search")
+		case filepath.FromSlash("docs/peanut-gallery/threads/memory_shards_sentiment"):
+			cfg.OutDir = filepath.FromSlash("docs/peanut-gallery/threads/file_search_sentiment")
+		}
+		if !maxBytesSet {
+			cfg.MaxBytes = migration.DefaultFileSearchFileBytes
+		}
+	}
+
+	// The aggregate profile writes a single file, so it gets its own default output dir.
+	if cfg.Profile == profileAggregate {
+		switch cfg.OutDir {
+		case semanticDefaults.OutDir:
+			cfg.OutDir = filepath.FromSlash("docs/peanut-gallery/threads/aggregates")
+		case filepath.FromSlash("docs/peanut-gallery/threads/memory_shards_sentiment"):
+			cfg.OutDir = filepath.FromSlash("docs/peanut-gallery/threads/aggregates_sentiment")
+		}
+	}
+
+	// Share-safe output goes next to the regular output rather than over it.
+	if cfg.ShareSafe && !outSet {
+		cfg.OutDir = filepath.Clean(cfg.OutDir) + "_share_safe"
+	}
+
 	cfg.InPath = filepath.Clean(cfg.InPath)
 	cfg.OutDir = filepath.Clean(cfg.OutDir)
 	if cfg.IndexPath != "" {
 		cfg.IndexPath = filepath.Clean(cfg.IndexPath)
 	}
+	for _, p := range []*string{&cfg.FromIndex, &cfg.OverridesDir, &cfg.NamesMap, &cfg.NamesList} {
+		if *p != "" {
+			*p = filepath.Clean(*p)
+		}
+	}
 	return cfg, nil
 }
 
+// rollupKind is the artifact kind memory-pack reads in mode.
+// checkThreadIndex compares thread-rollup's index (-from-index, or the one in -in) with the rollups
+// under -in before anything is packed: rollups the index lacks, rows whose rollup is gone, rollups
+// edited since the index was written, and an unfinished rollup run. Any of these fails the run unless
+// -force, which packs anyway and returns them as warnings. rows and sentRows are the -from-index rows.
+func checkThreadIndex(cfg Config, mode string, paths []string, rows []migration.ThreadIndexRecord, sentRows []migration.ThreadSentimentIndexRecord) ([]string, error) {
+	indexPath := cfg.FromIndex
+	if indexPath == "" {
+		indexPath = filepath.Join(cfg.InPath, "thread_index.json")
+		if mode == "sentiment" {
+			indexPath = filepath.Join(cfg.InPath, "sentiment_thread_index.json")
+		}
+		if !fileutils.FileExists(indexPath) {
+			return []string{fmt.Sprintf("no %s; packing without checking it against the rollups", indexPath)}, nil
+		}
+		var err error
+		if mode == "sentiment" {
+			sentRows, err = migration.ReadThreadSentimentIndex(indexPath)
+		} else {
+			rows, err = migration.ReadThreadIndex(indexPath)
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else if fi, err := os.Stat(cfg.InPath); err == nil && fi.IsDir() {
+		if paths, err = collectThreadSummaryFiles(cfg.InPath, mode); err != nil {
+			return nil, err
+		}
+	}
+
+	indexed := make([]string, 0, len(rows)+len(sentRows))
+	for _, r := range rows {
+		indexed = append(indexed, r.ThreadSummaryPath)
+	}
+	for _, r := range sentRows {
+		indexed = append(indexed, r.ThreadSentimentSummaryPath)
+	}
+	check, err := migration.CheckThreadIndex(indexPath, paths, indexed)
+	if err != nil {
+		return nil, err
+	}
+	if !check.Stale() {
+		return nil, nil
+	}
+	problems := check.Problems()
+	if !cfg.Force {
+		return nil, fmt.Errorf("%s is stale:\n  %s\nrerun thread-rollup with -reindex to rebuild it from the rollups on disk, or pass -force to pack anyway", indexPath, strings.Join(problems, "\n  "))
+	}
+	for i, p := range problems {
+		problems[i] = indexPath + ": " + p
+	}
+	return problems, nil
+}
+
+func rollupKind(mode string) layout.Kind {
+	if mode == "sentiment" {
+		return layout.ThreadSentiment
+	}
+	return layout.ThreadSummary
+}
+
 func collectThreadSummaryFiles(inPath string, mode string) ([]string, error) {
 	fi, err := os.Stat(inPath)
 	if err != nil {
@@ -229,27 +615,9 @@ func collectThreadSummaryFiles(inPath string, mode string) ([]string, error) {
 		return nil, errors.New("-in must be a directory")
 	}
 
-	wantSuffix := ".thread.summary.json"
-	if mode == "sentiment" {
-		wantSuffix = ".thread.sentiment.summary.json"
-	}
-
-	var files []string
-	err = filepath.WalkDir(inPath, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-		if strings.HasSuffix(strings.ToLower(path), wantSuffix) {
-			files = append(files, path)
-		}
-		return nil
-	})
+	files, err := migration.ArtifactPaths(fileutils.OS, inPath, rollupKind(mode))
 	if err != nil {
-		return nil, fmt.Errorf("walk thread summaries: %w", err)
+		return nil, fmt.Errorf("thread summaries: %w", err)
 	}
-	sort.Strings(files)
 	return files, nil
 }
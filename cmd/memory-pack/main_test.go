@@ -5,9 +5,11 @@ import (
 	"flag"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
 )
 
 func TestParseFlags_Overrides(t *testing.T) {
@@ -130,3 +132,236 @@ func repeat(s string, n int) string {
 	}
 	return out
 }
+
+func TestParseFlags_FileSearchProfileDefaults(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("memory-pack", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-profile", "file-search", "-mode", "sentiment", "-group-by", "month"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.OutDir != filepath.FromSlash("docs/peanut-gallery/threads/file_search_sentiment") {
+		t.Fatalf("OutDir=%q", cfg.OutDir)
+	}
+	if cfg.MaxBytes != migration.DefaultFileSearchFileBytes || cfg.GroupBy != "month" {
+		t.Fatalf("MaxBytes=%d GroupBy=%q", cfg.MaxBytes, cfg.GroupBy)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	fs = flag.NewFlagSet("memory-pack", flag.ContinueOnError)
+	cfg, err = parseFlags(fs, []string{"-profile", "file-search", "-max-bytes", "5000", "-group-by", "year"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.MaxBytes != 5000 {
+		t.Fatalf("MaxBytes=%d", cfg.MaxBytes)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected group-by error")
+	}
+}
+
+func TestParseFlags_AggregateProfile(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("memory-pack", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-profile", "aggregate", "-mode", "sentiment", "-epsilon", "1"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.OutDir != filepath.FromSlash("docs/peanut-gallery/threads/aggregates_sentiment") {
+		t.Fatalf("OutDir=%q", cfg.OutDir)
+	}
+	if cfg.AggregateMinCount != migration.DefaultAggregateMinCount || cfg.AggregateEpsilon != 1 {
+		t.Fatalf("MinCount=%d Epsilon=%v", cfg.AggregateMinCount, cfg.AggregateEpsilon)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	fs = flag.NewFlagSet("memory-pack", flag.ContinueOnError)
+	cfg, err = parseFlags(fs, []string{"-profile", "aggregate", "-share-safe"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for -share-safe with the aggregate profile")
+	}
+}
+
+func TestParseFlags_ShareSafeOutDir(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("memory-pack", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-share-safe", "-mode", "sentiment"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.OutDir != filepath.FromSlash("docs/peanut-gallery/threads/memory_shards_sentiment_share_safe") {
+		t.Fatalf("OutDir=%q", cfg.OutDir)
+	}
+	if cfg.NamesMap != filepath.FromSlash("docs/peanut-gallery/threads/share_safe_names.json") || !cfg.DetectNames {
+		t.Fatalf("NamesMap=%q DetectNames=%v", cfg.NamesMap, cfg.DetectNames)
+	}
+
+	fs = flag.NewFlagSet("memory-pack", flag.ContinueOnError)
+	cfg, err = parseFlags(fs, []string{"-share-safe", "-out", "shared/"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.OutDir != "shared" {
+		t.Fatalf("explicit OutDir=%q", cfg.OutDir)
+	}
+}
+
+func TestAnonymizeThreads_WritesParallelArchiveAndMapping(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	namesList := filepath.Join(root, "names.txt")
+	if err := os.WriteFile(namesList, []byte("# people\nAlice\n"), 0o644); err != nil {
+		t.Fatalf("write names: %v", err)
+	}
+	cfg := defaultConfig()
+	cfg.OutDir = filepath.Join(root, "out_share_safe")
+	cfg.NamesMap = filepath.Join(root, migration.ShareSafeNamesFileName)
+	cfg.NamesList = namesList
+
+	start := 1710499200.0
+	out, err := anonymizeThreads(cfg, []migration.ThreadSummary{
+		{ConversationID: "c1", Title: "Lunch with Alice", ThreadStart: &start, Summary: "Alice said \"let us meet on the third\" on 2024-03-15."},
+	})
+	if err != nil {
+		t.Fatalf("anonymizeThreads: %v", err)
+	}
+	if out[0].Title != "Lunch with Name 1" || *out[0].ThreadStart != 1709251200 {
+		t.Fatalf("out=%+v", out[0])
+	}
+	b, err := os.ReadFile(filepath.Join(cfg.OutDir, "thread_summaries", "c1.thread.summary.json"))
+	if err != nil {
+		t.Fatalf("read anonymized summary: %v", err)
+	}
+	if strings.Contains(string(b), "Alice") || strings.Contains(string(b), "2024-03-15") || strings.Contains(string(b), "third") {
+		t.Fatalf("anonymized summary leaks: %s", b)
+	}
+	names, err := migration.LoadShareSafeNames(cfg.NamesMap)
+	if err != nil || names.Names["Alice"] != "Name 1" {
+		t.Fatalf("mapping=%+v err=%v", names, err)
+	}
+
+	// Without -overwrite, a second run refuses to replace the archive.
+	if _, err := anonymizeThreads(cfg, []migration.ThreadSummary{{ConversationID: "c1", Summary: "x"}}); err == nil {
+		t.Fatalf("expected file exists error")
+	}
+}
+
+func TestLoadThreadSummaries_FromIndexRowsWithOverrides(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	var rows []migration.ThreadIndexRecord
+	for _, ts := range []migration.ThreadSummary{{ConversationID: "b", Title: "B"}, {}, {ConversationID: "a", Title: "A"}} {
+		name := ts.ConversationID
+		if name == "" {
+			name = "empty"
+		}
+		p := filepath.Join(dir, name+".thread.summary.json")
+		if err := fileutils.WriteArtifactAtomic(p, ts, false); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		rows = append(rows, migration.ThreadIndexRecord{ConversationID: name, ThreadSummaryPath: p})
+	}
+	overridesDir := filepath.Join(dir, "overrides")
+	if err := os.MkdirAll(overridesDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(overridesDir, "a.json"), []byte(`{"title":"Fixed A"}`), 0o644); err != nil {
+		t.Fatalf("write override: %v", err)
+	}
+	overrides, err := migration.LoadOverrides(fileutils.OS, overridesDir)
+	if err != nil {
+		t.Fatalf("LoadOverrides: %v", err)
+	}
+
+	cfg := defaultConfig()
+	cfg.FromIndex = filepath.Join(dir, "thread_index.json")
+	got, err := loadThreadSummaries(cfg, nil, rows, threadLoader(overrides))
+	if err != nil {
+		t.Fatalf("loadThreadSummaries: %v", err)
+	}
+	if len(got) != 2 || got[0].ConversationID != "b" || got[1].Title != "Fixed A" {
+		t.Fatalf("summaries=%+v", got)
+	}
+
+	cfg.Source = migration.SourceTypeJournal
+	if got, err = loadThreadSummaries(cfg, nil, rows, threadLoader(overrides)); err != nil || len(got) != 0 {
+		t.Fatalf("-source journal: summaries=%+v err=%v", got, err)
+	}
+	cfg.Source = ""
+
+	rows = append(rows, migration.ThreadIndexRecord{ConversationID: "gone", ThreadSummaryPath: filepath.Join(dir, "gone.thread.summary.json")})
+	if _, err := loadThreadSummaries(cfg, nil, rows, threadLoader(overrides)); err == nil || !strings.Contains(err.Error(), "gone") {
+		t.Fatalf("expected error for missing rollup, got %v", err)
+	}
+}
+
+func TestCheckThreadIndex_FailsUnlessForce(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	indexed := filepath.Join(dir, "a.thread.summary.json")
+	if err := fileutils.WriteArtifactAtomic(indexed, migration.ThreadSummary{ConversationID: "a"}, false); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	row, _ := json.Marshal(migration.ThreadIndexRecord{ConversationID: "a", ThreadSummaryPath: indexed})
+	if err := os.WriteFile(filepath.Join(dir, "thread_index.json"), append(row, '\n'), 0o644); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+	cfg := defaultConfig()
+	cfg.InPath = dir
+	paths, err := collectThreadSummaryFiles(dir, "semantic")
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if warnings, err := checkThreadIndex(cfg, "semantic", paths, nil, nil); err != nil || len(warnings) != 0 {
+		t.Fatalf("fresh index: warnings=%q err=%v", warnings, err)
+	}
+
+	// A rollup written after the index was built is not in it.
+	if err := fileutils.WriteArtifactAtomic(filepath.Join(dir, "b.thread.summary.json"), migration.ThreadSummary{ConversationID: "b"}, false); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if paths, err = collectThreadSummaryFiles(dir, "semantic"); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if _, err := checkThreadIndex(cfg, "semantic", paths, nil, nil); err == nil || !strings.Contains(err.Error(), "-force") {
+		t.Fatalf("err=%v, want stale index error", err)
+	}
+	cfg.Force = true
+	warnings, err := checkThreadIndex(cfg, "semantic", paths, nil, nil)
+	if err != nil || len(warnings) != 1 || !strings.Contains(warnings[0], "b.thread.summary.json") {
+		t.Fatalf("forced: warnings=%q err=%v", warnings, err)
+	}
+}
+
+func TestParseFlags_IncrementalRejectsOverwrite(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := parseFlags(flag.NewFlagSet("memory-pack", flag.ContinueOnError), []string{"-incremental"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	cfg, err = parseFlags(flag.NewFlagSet("memory-pack", flag.ContinueOnError), []string{"-incremental", "-overwrite"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected -incremental -overwrite to be rejected")
+	}
+}
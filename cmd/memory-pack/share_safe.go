@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+)
+
+// newAnonymizer loads the pseudonym mapping and the optional names list.
+func newAnonymizer(cfg Config) (*migration.Anonymizer, *migration.ShareSafeNames, error) {
+	names, err := migration.LoadShareSafeNames(cfg.NamesMap)
+	if err != nil {
+		return nil, nil, err
+	}
+	var known []string
+	if cfg.NamesList != "" {
+		f, err := os.Open(cfg.NamesList)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open -names: %w", err)
+		}
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				known = append(known, line)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return nil, nil, fmt.Errorf("read -names: %w", err)
+		}
+	}
+	return migration.NewAnonymizer(names, known, cfg.DetectNames), names, nil
+}
+
+// anonymizeThreads rewrites summaries for -share-safe, saves the updated mapping, and writes the
+// anonymized summaries under <out>/thread_summaries so the share-safe output is a complete archive.
+func anonymizeThreads(cfg Config, summaries []migration.ThreadSummary) ([]migration.ThreadSummary, error) {
+	anon, names, err := newAnonymizer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, ts := range summaries {
+		anon.LearnThread(ts)
+	}
+	out := make([]migration.ThreadSummary, 0, len(summaries))
+	for _, ts := range summaries {
+		ts = anon.Thread(ts)
+		path := filepath.Join(cfg.OutDir, "thread_summaries", layout.Name(ts.ConversationID, layout.ThreadSummary))
+		if err := writeShareSafeJSON(path, ts, cfg.Overwrite); err != nil {
+			return nil, err
+		}
+		out = append(out, ts)
+	}
+	return out, saveNames(cfg, names)
+}
+
+// anonymizeSentiment is anonymizeThreads for sentiment summaries.
+func anonymizeSentiment(cfg Config, summaries []migration.ThreadSentimentSummary) ([]migration.ThreadSentimentSummary, error) {
+	anon, names, err := newAnonymizer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, ts := range summaries {
+		anon.LearnSentiment(ts)
+	}
+	out := make([]migration.ThreadSentimentSummary, 0, len(summaries))
+	for _, ts := range summaries {
+		ts = anon.Sentiment(ts)
+		path := filepath.Join(cfg.OutDir, "thread_sentiment_summaries", layout.Name(ts.ConversationID, layout.ThreadSentiment))
+		if err := writeShareSafeJSON(path, ts, cfg.Overwrite); err != nil {
+			return nil, err
+		}
+		out = append(out, ts)
+	}
+	return out, saveNames(cfg, names)
+}
+
+func writeShareSafeJSON(path string, v any, overwrite bool) error {
+	if !overwrite && fileutils.FileExists(path) {
+		return fmt.Errorf("share-safe: file exists: %s", path)
+	}
+	if err := fileutils.WriteJSONFileAtomic(path, v, true); err != nil {
+		return fmt.Errorf("share-safe: write %s: %w", path, err)
+	}
+	return nil
+}
+
+func saveNames(cfg Config, names *migration.ShareSafeNames) error {
+	if err := names.Save(cfg.NamesMap); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "share-safe: %d names in mapping %s (keep it private)\n", len(names.Names), cfg.NamesMap)
+	return nil
+}
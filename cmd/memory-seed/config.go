@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+type Config struct {
+	InPath       string
+	OutPath      string
+	OverridesDir string
+	ReportPath   string
+	Title        string
+
+	MaxTokens int
+
+	ImportanceWeight float64
+	RecencyWeight    float64
+	CoverageWeight   float64
+	RecencyHalfLife  time.Duration
+
+	Overwrite   bool
+	Durability  string
+	AtomicWrite string
+	// CanonicalJSON writes JSON outputs in canonical form (see fileutils.Canonicalize).
+	CanonicalJSON bool
+
+	// MaxFilesPerDir and MaxOutputBytes set the output quota (see fileutils.Quota).
+	MaxFilesPerDir int
+	MaxOutputBytes int64
+}
+
+func (c Config) Validate() error {
+	if c.InPath == "" {
+		return errors.New("missing -in")
+	}
+	if c.OutPath == "" {
+		return errors.New("missing -out")
+	}
+	if c.MaxTokens <= 0 {
+		return errors.New("max-tokens must be > 0")
+	}
+	if c.ImportanceWeight < 0 || c.RecencyWeight < 0 || c.CoverageWeight < 0 {
+		return errors.New("weights must be >= 0")
+	}
+	if c.RecencyHalfLife < 0 {
+		return errors.New("recency-half-life must be >= 0")
+	}
+	if _, err := fileutils.ParseDurability(c.Durability); err != nil {
+		return err
+	}
+	if _, err := fileutils.ParseAtomicWrite(c.AtomicWrite); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c Config) seedOptions() migration.MemorySeedOptions {
+	return migration.MemorySeedOptions{
+		MaxTokens:        c.MaxTokens,
+		ImportanceWeight: c.ImportanceWeight,
+		RecencyWeight:    c.RecencyWeight,
+		CoverageWeight:   c.CoverageWeight,
+		RecencyHalfLife:  c.RecencyHalfLife,
+		Title:            c.Title,
+	}
+}
+
+func defaultConfig() Config {
+	opt := migration.DefaultMemorySeedOptions()
+	return Config{
+		InPath:           filepath.FromSlash("docs/peanut-gallery/threads/thread_summaries"),
+		OutPath:          filepath.FromSlash("docs/peanut-gallery/threads/memory_seed.md"),
+		OverridesDir:     filepath.FromSlash("docs/peanut-gallery/threads/overrides"),
+		MaxTokens:        opt.MaxTokens,
+		ImportanceWeight: opt.ImportanceWeight,
+		RecencyWeight:    opt.RecencyWeight,
+		CoverageWeight:   opt.CoverageWeight,
+		RecencyHalfLife:  opt.RecencyHalfLife,
+		Durability:       fileutils.DurabilityFull,
+	}
+}
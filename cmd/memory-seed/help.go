@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+var help = cli.Help{
+	Name:    "memory-seed",
+	Summary: "write one token-budgeted markdown file of the most important threads",
+	Groups: []cli.Group{
+		{Title: "Input and output", Flags: []string{"in", "out", "overrides", "report", "title", "overwrite", "durability", "atomic-write", "canonical-json", "max-files-per-dir", "max-output-bytes"}},
+		{Title: "Selection", Flags: []string{"max-tokens", "importance-weight", "recency-weight", "coverage-weight", "recency-half-life"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "an 8k-token seed file", Command: "memory-seed -in docs/peanut-gallery/threads/thread_summaries -out seed.md -max-tokens 8000"},
+		{Comment: "favor recent threads and see why each was picked", Command: "memory-seed -recency-weight 2 -recency-half-life 90d -report seed_report.jsonl -overwrite"},
+	},
+	Values: map[string][]string{"durability": fileutils.DurabilityModes, "atomic-write": fileutils.AtomicWriteModes},
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+)
+
+func main() {
+	cfg, err := parseFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := layout.LoadConventionsFromEnv(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetDurability(cfg.Durability); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetAtomicWrite(cfg.AtomicWrite); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	fileutils.SetCanonicalJSON(cfg.CanonicalJSON)
+	if err := fileutils.SetQuota(fileutils.Quota{MaxFilesPerDir: cfg.MaxFilesPerDir, MaxBytes: cfg.MaxOutputBytes}); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if !cfg.Overwrite && fileutils.FileExists(cfg.OutPath) {
+		fmt.Fprintf(os.Stderr, "%s already exists (use -overwrite)\n", cfg.OutPath)
+		os.Exit(2)
+	}
+
+	summaries, err := loadThreadSummaries(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if len(summaries) == 0 {
+		fmt.Fprintf(os.Stderr, "no *%s files found\n", layout.Suffix(layout.ThreadSummary))
+		os.Exit(2)
+	}
+
+	seed := migration.BuildMemorySeed(summaries, cfg.seedOptions())
+	if err := os.MkdirAll(filepath.Dir(cfg.OutPath), 0o755); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if err := fileutils.WriteFileAtomicSameDir(cfg.OutPath, []byte(seed.Markdown), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if cfg.ReportPath != "" {
+		if err := fileutils.WriteJSONFileAtomic(cfg.ReportPath, seed.Entries, true); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+	if err := fileutils.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	counts := seed.DetailCounts()
+	fmt.Fprintf(os.Stdout, "threads_total=%d threads_full=%d threads_brief=%d threads_line=%d threads_dropped=%d approx_tokens=%d out=%s\n",
+		len(summaries), counts[migration.SeedDetailFull], counts[migration.SeedDetailBrief], counts[migration.SeedDetailLine], seed.Dropped, seed.Tokens, cfg.OutPath)
+}
+
+// loadThreadSummaries reads every semantic rollup under cfg.InPath (split parts are skipped) with
+// hand-written overrides applied, in path order.
+func loadThreadSummaries(cfg Config) ([]migration.ThreadSummary, error) {
+	info, err := os.Stat(cfg.InPath)
+	if err != nil {
+		return nil, fmt.Errorf("stat -in: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, errors.New("-in must be a directory")
+	}
+	overrides, err := migration.LoadOverrides(fileutils.OS, cfg.OverridesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []migration.ThreadSummary
+	archive := &migration.Archive{ThreadSummariesDir: cfg.InPath}
+	err = archive.ForEachThreadSummary(func(_ string, ts migration.ThreadSummary) error {
+		if err := overrides.ApplySemantic(&ts); err != nil {
+			return fmt.Errorf("override %s: %w", ts.ConversationID, err)
+		}
+		out = append(out, ts)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
+	cfg := defaultConfig()
+	fs.SetOutput(os.Stderr)
+	cli.Setup(fs, help)
+
+	fs.StringVar(&cfg.InPath, "in", cfg.InPath, "Directory of thread summaries (*.thread.summary.json, recursively)")
+	fs.StringVar(&cfg.OutPath, "out", cfg.OutPath, "Output markdown file")
+	fs.StringVar(&cfg.OverridesDir, "overrides", cfg.OverridesDir, "Directory of hand-written partial JSON corrections merged over thread summaries before selection")
+	fs.StringVar(&cfg.ReportPath, "report", "", "Optional path for a JSON list of selected threads with their score and detail level")
+	fs.StringVar(&cfg.Title, "title", "", "Heading for the seed file (default: Memory seed)")
+	fs.IntVar(&cfg.MaxTokens, "max-tokens", cfg.MaxTokens, "Token budget for the whole file (~4 bytes per token)")
+	fs.Float64Var(&cfg.ImportanceWeight, "importance-weight", cfg.ImportanceWeight, "Weight of thread importance (key points, open items, distinct tags/terms)")
+	fs.Float64Var(&cfg.RecencyWeight, "recency-weight", cfg.RecencyWeight, "Weight of recency relative to the newest thread")
+	fs.Float64Var(&cfg.CoverageWeight, "coverage-weight", cfg.CoverageWeight, "Weight of tags not yet covered by threads selected earlier")
+	fs.Func("recency-half-life", "Age at which recency counts half (e.g. 180d, 26w; 0 disables recency)", func(v string) error {
+		d, err := migration.ParseAge(v)
+		cfg.RecencyHalfLife = d
+		return err
+	})
+	fs.BoolVar(&cfg.Overwrite, "overwrite", false, "Overwrite an existing -out file")
+	fs.StringVar(&cfg.Durability, "durability", cfg.Durability, "fsync policy for output files: none, group (sync in batches), or full (sync every file)")
+	fs.StringVar(&cfg.AtomicWrite, "atomic-write", fileutils.AtomicRename, "How finished files replace their targets: rename (atomic), staged (temp files in TMPDIR, kept out of synced folders), or copy (written in place, for shares that refuse rename)")
+	fs.BoolVar(&cfg.CanonicalJSON, "canonical-json", cfg.CanonicalJSON, "Write JSON outputs with sorted keys and stable number formatting so regenerated files diff cleanly")
+	fs.IntVar(&cfg.MaxFilesPerDir, "max-files-per-dir", fileutils.DefaultMaxFilesPerDir, "Stop with an error before any output directory holds more than N files (0 disables)")
+	fs.Int64Var(&cfg.MaxOutputBytes, "max-output-bytes", 0, "Stop with an error before this run writes more than N bytes (0 disables)")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	cfg.InPath = filepath.Clean(cfg.InPath)
+	cfg.OutPath = filepath.Clean(cfg.OutPath)
+	for _, p := range []*string{&cfg.OverridesDir, &cfg.ReportPath} {
+		if *p != "" {
+			*p = filepath.Clean(*p)
+		}
+	}
+	return cfg, nil
+}
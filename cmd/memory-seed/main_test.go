@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+)
+
+func TestParseFlags_Overrides(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("memory-seed", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-in", "x/thread_summaries/", "-out", "x/seed.md", "-max-tokens", "8000", "-recency-half-life", "90d", "-coverage-weight", "0"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if cfg.InPath != filepath.FromSlash("x/thread_summaries") || cfg.OutPath != filepath.FromSlash("x/seed.md") {
+		t.Fatalf("paths=%q %q", cfg.InPath, cfg.OutPath)
+	}
+	if cfg.MaxTokens != 8000 || cfg.RecencyHalfLife != 90*24*time.Hour || cfg.CoverageWeight != 0 {
+		t.Fatalf("cfg=%+v", cfg)
+	}
+
+	cfg.MaxTokens = 0
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for max-tokens=0")
+	}
+	cfg = defaultConfig()
+	cfg.RecencyWeight = -1
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for negative weight")
+	}
+}
+
+func TestLoadThreadSummaries_AppliesOverridesAndSkipsParts(t *testing.T) {
+	t.Parallel()
+
+	in := t.TempDir()
+	overrides := t.TempDir()
+	write := func(path string, v any) {
+		t.Helper()
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	write(filepath.Join(in, "a.thread.summary.json"), migration.ThreadSummary{ConversationID: "a", Title: "Old title", Summary: "A."})
+	write(filepath.Join(in, "a.thread.summary.part01of02.json"), migration.ThreadSummary{ConversationID: "a", Summary: "part"})
+	write(filepath.Join(in, "b.thread.sentiment.summary.json"), map[string]string{"conversation_id": "b"})
+	write(filepath.Join(overrides, "a.json"), map[string]string{"title": "Fixed title"})
+
+	cfg := defaultConfig()
+	cfg.InPath = in
+	cfg.OverridesDir = overrides
+	got, err := loadThreadSummaries(cfg)
+	if err != nil {
+		t.Fatalf("loadThreadSummaries: %v", err)
+	}
+	if len(got) != 1 || got[0].Title != "Fixed title" {
+		t.Fatalf("got=%+v", got)
+	}
+}
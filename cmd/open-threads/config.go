@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+)
+
+const dateLayout = "2006-01-02"
+
+type Config struct {
+	InPath string
+
+	Status  string
+	Kind    string
+	Project string
+	Since   string
+	Until   string
+
+	// Set holds "<id>=<status>" changes; when present the command updates the tracker instead of listing it.
+	Set  []string
+	Note string
+
+	JSON bool
+}
+
+func (c Config) Validate() error {
+	if c.InPath == "" {
+		return errors.New("missing -in")
+	}
+	if c.Status != "all" && !migration.IsOpenThreadStatus(c.Status) {
+		return errors.New("status must be open, done, dropped, or all")
+	}
+	if c.Kind != "" && c.Kind != migration.OpenItemQuestion && c.Kind != migration.OpenItemTodo {
+		return errors.New("kind must be question or todo")
+	}
+	if _, err := c.since(); err != nil {
+		return errors.New("since must be YYYY-MM-DD")
+	}
+	if _, err := c.until(); err != nil {
+		return errors.New("until must be YYYY-MM-DD")
+	}
+	if _, err := c.changes(); err != nil {
+		return err
+	}
+	if c.Note != "" && len(c.Set) == 0 {
+		return errors.New("-note requires -set")
+	}
+	return nil
+}
+
+// changes parses -set values into id -> status.
+func (c Config) changes() (map[string]string, error) {
+	out := map[string]string{}
+	for _, s := range c.Set {
+		id, status, ok := strings.Cut(s, "=")
+		id, status = strings.TrimSpace(id), strings.ToLower(strings.TrimSpace(status))
+		if !ok || id == "" || !migration.IsOpenThreadStatus(status) {
+			return nil, fmt.Errorf("invalid -set %q: want <id>=open|done|dropped", s)
+		}
+		out[id] = status
+	}
+	return out, nil
+}
+
+func (c Config) since() (time.Time, error) { return parseDate(c.Since) }
+
+// until is exclusive, so -until 2024-03-31 includes threads started that day.
+func (c Config) until() (time.Time, error) {
+	t, err := parseDate(c.Until)
+	if err != nil || t.IsZero() {
+		return t, err
+	}
+	return t.AddDate(0, 0, 1), nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	if strings.TrimSpace(s) == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(dateLayout, strings.TrimSpace(s))
+}
+
+func defaultConfig() Config {
+	return Config{
+		InPath: filepath.FromSlash("docs/peanut-gallery/threads/thread_summaries/" + migration.OpenThreadsFileName),
+		Status: migration.OpenThreadOpen,
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+)
+
+var help = cli.Help{
+	Name:    "open-threads",
+	Summary: "list and update the open questions and todos thread-rollup found",
+	Groups: []cli.Group{
+		{Title: "Input", Flags: []string{"in"}},
+		{Title: "Filters", Flags: []string{"status", "kind", "project", "since", "until"}},
+		{Title: "Updates", Flags: []string{"set", "note"}},
+		{Title: "Output", Flags: []string{"json"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "open todos for one project", Command: "open-threads -kind todo -project garden"},
+		{Comment: "mark an item done with a note", Command: `open-threads -set 3f9a1c07b2de=done -note "shipped in v2"`},
+	},
+	Values: map[string][]string{
+		"status": {migration.OpenThreadOpen, migration.OpenThreadDone, migration.OpenThreadDropped, "all"},
+		"kind":   {migration.OpenItemQuestion, migration.OpenItemTodo},
+	},
+}
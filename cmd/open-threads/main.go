@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+func main() {
+	cfg, err := parseFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	if len(cfg.Set) > 0 {
+		n, err := setStatuses(cfg, time.Now())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stdout, "updated=%d in=%s\n", n, cfg.InPath)
+		return
+	}
+
+	rows, err := migration.ReadOpenThreads(fileutils.OS, cfg.InPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	rows = filterOpenThreads(cfg, rows)
+	if err := writeOpenThreads(os.Stdout, cfg, rows); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "items=%d status=%s\n", len(rows), cfg.Status)
+}
+
+// filterOpenThreads keeps the rows matching the status, kind, project and date filters, in tracker order.
+func filterOpenThreads(cfg Config, rows []migration.OpenThread) []migration.OpenThread {
+	since, _ := cfg.since()
+	until, _ := cfg.until()
+	var out []migration.OpenThread
+	for _, r := range rows {
+		if cfg.Status != "all" && r.Status != cfg.Status {
+			continue
+		}
+		if cfg.Kind != "" && r.Kind != cfg.Kind {
+			continue
+		}
+		if cfg.Project != "" && !strings.EqualFold(r.Project, cfg.Project) {
+			continue
+		}
+		if !since.IsZero() || !until.IsZero() {
+			if r.ThreadStart == nil {
+				continue
+			}
+			start := time.Unix(int64(*r.ThreadStart), 0).UTC()
+			if (!since.IsZero() && start.Before(since)) || (!until.IsZero() && !start.Before(until)) {
+				continue
+			}
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// writeOpenThreads prints one line per item (date, id, kind, thread title, text), or JSONL with -json.
+func writeOpenThreads(w io.Writer, cfg Config, rows []migration.OpenThread) error {
+	if cfg.JSON {
+		enc := json.NewEncoder(w)
+		for _, r := range rows {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, r := range rows {
+		date := "----------"
+		if r.ThreadStart != nil {
+			date = time.Unix(int64(*r.ThreadStart), 0).UTC().Format(dateLayout)
+		}
+		title := r.Title
+		if title == "" {
+			title = r.ConversationID
+		}
+		line := fmt.Sprintf("%s  %s  %-8s  %s: %s", date, r.ID, r.Kind, fileutils.Truncate(title, 60), r.Text)
+		if cfg.Status == "all" {
+			line += " [" + r.Status + "]"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setStatuses applies the -set changes to the tracker and returns how many items changed. Unknown IDs are an error.
+func setStatuses(cfg Config, now time.Time) (int, error) {
+	changes, err := cfg.changes()
+	if err != nil {
+		return 0, err
+	}
+	stamp := now.UTC().Format(time.RFC3339)
+	n := 0
+	err = migration.UpdateOpenThreads(cfg.InPath, func(rows []migration.OpenThread) ([]migration.OpenThread, error) {
+		found := map[string]bool{}
+		for i := range rows {
+			status, ok := changes[rows[i].ID]
+			if !ok {
+				continue
+			}
+			found[rows[i].ID] = true
+			if rows[i].Status != status || (cfg.Note != "" && rows[i].Note != cfg.Note) {
+				rows[i].Status, rows[i].StatusAt = status, stamp
+				if cfg.Note != "" {
+					rows[i].Note = cfg.Note
+				}
+				n++
+			}
+		}
+		var missing []string
+		for id := range changes {
+			if !found[id] {
+				missing = append(missing, id)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			return nil, fmt.Errorf("unknown open thread id(s): %s", strings.Join(missing, ", "))
+		}
+		return rows, nil
+	})
+	return n, err
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
+	cfg := defaultConfig()
+	fs.SetOutput(os.Stderr)
+	cli.Setup(fs, help)
+	fs.StringVar(&cfg.InPath, "in", cfg.InPath, "Path to open_threads.jsonl (written by thread-rollup next to thread_index.json)")
+	fs.StringVar(&cfg.Status, "status", cfg.Status, "Only list items with this status: open, done, dropped, or all")
+	fs.StringVar(&cfg.Kind, "kind", "", "Only list items of this kind: question or todo")
+	fs.StringVar(&cfg.Project, "project", "", "Only list items from threads in this project")
+	fs.StringVar(&cfg.Since, "since", "", "Only list items from threads started on or after this date (YYYY-MM-DD)")
+	fs.StringVar(&cfg.Until, "until", "", "Only list items from threads started on or before this date (YYYY-MM-DD)")
+	fs.Func("set", "Change an item's status instead of listing: <id>=open|done|dropped (repeatable)", func(v string) error {
+		cfg.Set = append(cfg.Set, v)
+		return nil
+	})
+	fs.StringVar(&cfg.Note, "note", "", "Note recorded on the items changed by -set")
+	fs.BoolVar(&cfg.JSON, "json", false, "Print matching items as JSONL")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	cfg.Status = strings.ToLower(strings.TrimSpace(cfg.Status))
+	cfg.Kind = strings.ToLower(strings.TrimSpace(cfg.Kind))
+	if cfg.InPath != "" {
+		cfg.InPath = filepath.Clean(cfg.InPath)
+	}
+	return cfg, nil
+}
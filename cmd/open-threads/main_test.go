@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+func TestParseFlags_SetAndValidate(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("open-threads", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-in", "out/open_threads.jsonl", "-set", "abc=Done", "-set", "def=dropped", "-note", "handled"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	changes, _ := cfg.changes()
+	if changes["abc"] != migration.OpenThreadDone || changes["def"] != migration.OpenThreadDropped {
+		t.Fatalf("changes=%v", changes)
+	}
+
+	cfg.Set = []string{"abc=later"}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for unknown status")
+	}
+	cfg = defaultConfig()
+	cfg.Status = "closed"
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for bad -status")
+	}
+}
+
+func TestFilterAndWriteOpenThreads(t *testing.T) {
+	t.Parallel()
+
+	march := float64(time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC).Unix())
+	june := float64(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC).Unix())
+	rows := []migration.OpenThread{
+		{ID: "a1", Title: "Garden", ThreadStart: &march, Kind: migration.OpenItemTodo, Text: "build a cold frame", Status: migration.OpenThreadOpen},
+		{ID: "b2", Title: "Garden", ThreadStart: &march, Kind: migration.OpenItemQuestion, Text: "which tomatoes?", Status: migration.OpenThreadDone},
+		{ID: "c3", Title: "Taxes", ThreadStart: &june, Kind: migration.OpenItemTodo, Text: "file extension", Status: migration.OpenThreadOpen},
+	}
+	cfg := defaultConfig()
+	cfg.Until = "2024-03-05"
+	got := filterOpenThreads(cfg, rows)
+	if len(got) != 1 || got[0].ID != "a1" {
+		t.Fatalf("got=%+v", got)
+	}
+
+	var buf bytes.Buffer
+	if err := writeOpenThreads(&buf, cfg, got); err != nil {
+		t.Fatalf("writeOpenThreads: %v", err)
+	}
+	if line := buf.String(); !strings.HasPrefix(line, "2024-03-05  a1  todo") || !strings.Contains(line, "Garden: build a cold frame") {
+		t.Fatalf("line=%q", line)
+	}
+
+	cfg = defaultConfig()
+	cfg.Status = "all"
+	cfg.Kind = migration.OpenItemQuestion
+	if got := filterOpenThreads(cfg, rows); len(got) != 1 || got[0].ID != "b2" {
+		t.Fatalf("got=%+v", got)
+	}
+}
+
+func TestSetStatuses_UpdatesAndRejectsUnknownIDs(t *testing.T) {
+	t.Parallel()
+
+	cfg := defaultConfig()
+	cfg.InPath = filepath.Join(t.TempDir(), migration.OpenThreadsFileName)
+	if err := migration.WriteOpenThreads(cfg.InPath, []migration.OpenThread{{ID: "a1", Status: migration.OpenThreadOpen}}); err != nil {
+		t.Fatalf("WriteOpenThreads: %v", err)
+	}
+
+	cfg.Set = []string{"a1=done"}
+	cfg.Note = "built it"
+	now := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	n, err := setStatuses(cfg, now)
+	if err != nil || n != 1 {
+		t.Fatalf("n=%d err=%v", n, err)
+	}
+	rows, _ := migration.ReadOpenThreads(fileutils.OS, cfg.InPath)
+	if rows[0].Status != migration.OpenThreadDone || rows[0].Note != "built it" || rows[0].StatusAt != "2024-07-01T00:00:00Z" {
+		t.Fatalf("row=%+v", rows[0])
+	}
+
+	cfg.Set = []string{"a1=open", "zz=done"}
+	if _, err := setStatuses(cfg, now); err == nil || !strings.Contains(err.Error(), "zz") {
+		t.Fatalf("err=%v", err)
+	}
+	rows, _ = migration.ReadOpenThreads(fileutils.OS, cfg.InPath)
+	if rows[0].Status != migration.OpenThreadDone {
+		t.Fatalf("failed -set modified the tracker: %+v", rows[0])
+	}
+}
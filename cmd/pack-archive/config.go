@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+type Config struct {
+	// ThreadsDir is the pipeline's threads directory; archive paths are relative to it.
+	ThreadsDir string
+	// OutPath is the archive to write (default <in>/archives/compress-o-bot-<version><ext>).
+	OutPath string
+	// Version names the archive and is recorded in its manifest (default: a UTC timestamp).
+	Version     string
+	Compression string
+	// Include replaces migration.DefaultArchiveEntries; unlike the defaults, each entry must exist.
+	Include   []string
+	Overwrite bool
+
+	// VerifyPath checks an existing archive against its manifest instead of packing.
+	VerifyPath string
+
+	Durability  string
+	AtomicWrite string
+	// CanonicalJSON writes JSON outputs in canonical form (see fileutils.Canonicalize).
+	CanonicalJSON bool
+
+	// MaxFilesPerDir and MaxOutputBytes set the output quota (see fileutils.Quota).
+	MaxFilesPerDir int
+	MaxOutputBytes int64
+}
+
+func (c Config) Validate() error {
+	if c.VerifyPath == "" && c.ThreadsDir == "" {
+		return errors.New("missing -in")
+	}
+	if c.Version != "" && (c.Version != filepath.Base(c.Version) || c.Version == "." || c.Version == "..") {
+		return errors.New("-version must not contain path separators")
+	}
+	if _, err := migration.ParseArchiveCompression(c.Compression); err != nil {
+		return err
+	}
+	if _, err := fileutils.ParseDurability(c.Durability); err != nil {
+		return err
+	}
+	if _, err := fileutils.ParseAtomicWrite(c.AtomicWrite); err != nil {
+		return err
+	}
+	return nil
+}
+
+// outPath is OutPath, or the versioned default under ThreadsDir.
+func (c Config) outPath() string {
+	if c.OutPath != "" {
+		return c.OutPath
+	}
+	return filepath.Join(c.ThreadsDir, "archives", "compress-o-bot-"+c.Version+migration.ArchiveExt(c.Compression))
+}
+
+func defaultConfig() Config {
+	return Config{
+		ThreadsDir:  filepath.FromSlash("docs/peanut-gallery/threads"),
+		Compression: migration.ArchiveZstd,
+		Durability:  fileutils.DurabilityFull,
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+var help = cli.Help{
+	Name:    "pack-archive",
+	Summary: "bundle shards, indexes, glossary, and the pipeline report into one versioned tarball with an integrity manifest",
+	Groups: []cli.Group{
+		{Title: "Input", Flags: []string{"in", "include"}},
+		{Title: "Output", Flags: []string{"out", "version", "compression", "overwrite", "durability", "atomic-write", "canonical-json", "max-files-per-dir", "max-output-bytes"}},
+		{Title: "Verify", Flags: []string{"verify"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "archive a finished run for backup", Command: "pack-archive -in docs/peanut-gallery/threads"},
+		{Comment: "name the archive and use gzip where zstd is not installed", Command: "pack-archive -version 2024-06 -compression gzip"},
+		{Comment: "check a copy against its manifest", Command: "pack-archive -verify backups/compress-o-bot-2024-06.tar.zst"},
+	},
+	Values: map[string][]string{"compression": migration.ArchiveCompressions, "durability": fileutils.DurabilityModes, "atomic-write": fileutils.AtomicWriteModes},
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+func main() {
+	cfg, err := parseFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	if cfg.VerifyPath != "" {
+		m, err := verifyArchive(cfg.VerifyPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stdout, "verified=%s version=%s files=%d bytes=%d\n", cfg.VerifyPath, m.Version, len(m.Files), m.TotalBytes)
+		return
+	}
+
+	if err := fileutils.SetDurability(cfg.Durability); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetAtomicWrite(cfg.AtomicWrite); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	fileutils.SetCanonicalJSON(cfg.CanonicalJSON)
+	if err := fileutils.SetQuota(fileutils.Quota{MaxFilesPerDir: cfg.MaxFilesPerDir, MaxBytes: cfg.MaxOutputBytes}); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	report := migration.NewRunReport("pack-archive", cfg)
+	outPath := cfg.outPath()
+	m, sum, err := packArchive(cfg, outPath, time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if err := fileutils.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	report.Total = int64(len(m.Files))
+	report.Processed = int64(len(m.Files))
+	report.Outputs = map[string]string{"archive": outPath, "checksum": outPath + ".sha256"}
+	if err := migration.WriteRunReport(filepath.Join(filepath.Dir(outPath), migration.RunReportFileName), report); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stdout, "archive=%s version=%s files=%d bytes=%d sha256=%s\n", outPath, m.Version, len(m.Files), m.TotalBytes, sum)
+}
+
+// packArchive writes the archive to outPath and its checksum to <outPath>.sha256 (a line in the format
+// sha256sum -c reads), and returns the manifest and the archive's SHA-256.
+func packArchive(cfg Config, outPath string, now time.Time) (migration.ArchiveManifest, string, error) {
+	if !cfg.Overwrite && fileutils.FileExists(outPath) {
+		return migration.ArchiveManifest{}, "", fmt.Errorf("archive exists: %s (use -overwrite or a new -version)", outPath)
+	}
+	opts := migration.ArchivePackOptions{
+		Root:        cfg.ThreadsDir,
+		Entries:     cfg.Include,
+		Version:     cfg.Version,
+		Compression: cfg.Compression,
+		CreatedAt:   now,
+	}
+	if len(opts.Entries) == 0 {
+		opts.Entries, opts.SkipMissing = migration.DefaultArchiveEntries, true
+	}
+
+	f, err := fileutils.CreateAtomic(outPath, ".pack-archive-*", 0o644)
+	if err != nil {
+		return migration.ArchiveManifest{}, "", fmt.Errorf("create archive: %w", err)
+	}
+	defer f.Abort()
+	h := sha256.New()
+	m, err := migration.WriteArchivePack(io.MultiWriter(f, h), opts)
+	if err != nil {
+		return migration.ArchiveManifest{}, "", err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return migration.ArchiveManifest{}, "", err
+	}
+	if err := fileutils.Reserve(outPath, info.Size()); err != nil {
+		return migration.ArchiveManifest{}, "", err
+	}
+	if err := f.Commit(); err != nil {
+		return migration.ArchiveManifest{}, "", fmt.Errorf("write archive: %w", err)
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	line := sum + "  " + filepath.Base(outPath)
+	if err := fileutils.WriteFileAtomicSameDir(outPath+".sha256", []byte(line), 0o644); err != nil {
+		return migration.ArchiveManifest{}, "", fmt.Errorf("write checksum: %w", err)
+	}
+	return m, sum, nil
+}
+
+// verifyArchive checks the archive at path against its <path>.sha256, when there is one, and every
+// file in it against the manifest.
+func verifyArchive(path string) (migration.ArchiveManifest, error) {
+	want, err := os.ReadFile(path + ".sha256")
+	switch {
+	case err == nil:
+		fields := strings.Fields(string(want))
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return migration.ArchiveManifest{}, err
+		}
+		if len(fields) == 0 || fields[0] != sum {
+			return migration.ArchiveManifest{}, fmt.Errorf("%s does not match %s.sha256", path, path)
+		}
+	case !os.IsNotExist(err):
+		return migration.ArchiveManifest{}, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return migration.ArchiveManifest{}, err
+	}
+	defer f.Close()
+	return migration.VerifyArchivePack(f, migration.ArchiveCompressionFor(path))
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
+	cfg := defaultConfig()
+	fs.SetOutput(os.Stderr)
+	cli.Setup(fs, help)
+
+	fs.StringVar(&cfg.ThreadsDir, "in", cfg.ThreadsDir, "Threads directory of a pipeline run; archive paths are relative to it")
+	fs.Func("include", "Comma-separated files or directories under -in to pack instead of the defaults ("+strings.Join(migration.DefaultArchiveEntries, ",")+"); each must exist", func(v string) error {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				cfg.Include = append(cfg.Include, part)
+			}
+		}
+		return nil
+	})
+	fs.StringVar(&cfg.OutPath, "out", "", "Archive path (default: <in>/archives/compress-o-bot-<version>.tar.zst, or .tar.gz / .tar by -compression)")
+	fs.StringVar(&cfg.Version, "version", "", "Archive version, used in the default file name and recorded in the manifest (default: UTC timestamp)")
+	fs.StringVar(&cfg.Compression, "compression", cfg.Compression, "zstd (needs the zstd binary on PATH), gzip, or none")
+	fs.BoolVar(&cfg.Overwrite, "overwrite", false, "Replace an existing archive of the same name")
+	fs.StringVar(&cfg.VerifyPath, "verify", "", "Check an existing archive against its manifest and .sha256 file instead of packing")
+	fs.StringVar(&cfg.Durability, "durability", cfg.Durability, "fsync policy for output files: none, group (sync in batches), or full (sync every file)")
+	fs.StringVar(&cfg.AtomicWrite, "atomic-write", fileutils.AtomicRename, "How finished files replace their targets: rename (atomic), staged (temp files in TMPDIR, kept out of synced folders), or copy (written in place, for shares that refuse rename)")
+	fs.BoolVar(&cfg.CanonicalJSON, "canonical-json", cfg.CanonicalJSON, "Write JSON outputs with sorted keys and stable number formatting so regenerated files diff cleanly")
+	fs.IntVar(&cfg.MaxFilesPerDir, "max-files-per-dir", fileutils.DefaultMaxFilesPerDir, "Stop with an error before any output directory holds more than N files (0 disables)")
+	fs.Int64Var(&cfg.MaxOutputBytes, "max-output-bytes", 0, "Stop with an error before this run writes more than N bytes (0 disables)")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	cfg.ThreadsDir = filepath.Clean(cfg.ThreadsDir)
+	cfg.Compression = strings.ToLower(strings.TrimSpace(cfg.Compression))
+	if cfg.OutPath != "" {
+		cfg.OutPath = filepath.Clean(cfg.OutPath)
+	}
+	if cfg.Version == "" {
+		cfg.Version = time.Now().UTC().Format("20060102T150405Z")
+	}
+	return cfg, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+)
+
+func TestParseFlags_DefaultOutPath(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("pack-archive", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-in", "out/threads/", "-version", "2024-06", "-compression", "GZIP", "-include", "memory_shards, summaries/index.json"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if got, want := cfg.outPath(), filepath.FromSlash("out/threads/archives/compress-o-bot-2024-06.tar.gz"); got != want {
+		t.Fatalf("outPath=%q want %q", got, want)
+	}
+	if len(cfg.Include) != 2 || cfg.Include[1] != "summaries/index.json" {
+		t.Fatalf("include=%q", cfg.Include)
+	}
+	cfg.Version = "../x"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for a version with a path separator")
+	}
+	cfg.Version, cfg.Compression = "v", "xz"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for an unknown compression")
+	}
+}
+
+func TestPackArchive_WritesChecksumAndVerifies(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	shard := filepath.Join(dir, "memory_shards", "memory_0001.md")
+	if err := os.MkdirAll(filepath.Dir(shard), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(shard, []byte("# shard\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	cfg := defaultConfig()
+	cfg.ThreadsDir, cfg.Version, cfg.Compression = dir, "v1", migration.ArchiveGzip
+	out := cfg.outPath()
+
+	m, sum, err := packArchive(cfg, out, time.Now())
+	if err != nil {
+		t.Fatalf("packArchive: %v", err)
+	}
+	if len(m.Files) != 1 || m.Files[0].Path != "memory_shards/memory_0001.md" {
+		t.Fatalf("files=%+v", m.Files)
+	}
+	line, err := os.ReadFile(out + ".sha256")
+	if err != nil {
+		t.Fatalf("read checksum: %v", err)
+	}
+	if string(line) != sum+"  compress-o-bot-v1.tar.gz\n" {
+		t.Fatalf("checksum line=%q", line)
+	}
+	if _, err := verifyArchive(out); err != nil {
+		t.Fatalf("verifyArchive: %v", err)
+	}
+
+	if _, _, err := packArchive(cfg, out, time.Now()); err == nil || !strings.Contains(err.Error(), "archive exists") {
+		t.Fatalf("err=%v, want archive exists", err)
+	}
+
+	// A copy that no longer matches its checksum fails verification.
+	b, _ := os.ReadFile(out)
+	b[len(b)-1] ^= 0xff
+	if err := os.WriteFile(out, b, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := verifyArchive(out); err == nil {
+		t.Fatal("expected verify error for a corrupted archive")
+	}
+}
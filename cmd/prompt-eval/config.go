@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+)
+
+type Config struct {
+	CasesDir string
+	WorkDir  string
+
+	Model               string
+	SentimentModel      string
+	SentimentPromptFile string
+	TranscriptFormat    string
+	APIKey              string
+
+	// ScoreOnly re-scores the summaries already in WorkDir without calling the model.
+	ScoreOnly bool
+
+	ReportPath   string
+	BaselinePath string
+	MinScore     float64
+}
+
+func (c Config) Validate() error {
+	if c.CasesDir == "" {
+		return errors.New("missing -cases")
+	}
+	if c.ScoreOnly && c.WorkDir == "" {
+		return errors.New("-score-only requires -work")
+	}
+	if !c.ScoreOnly && c.Model == "" {
+		return errors.New("missing -model")
+	}
+	if c.MinScore < 0 || c.MinScore > 1 {
+		return errors.New("min-score must be between 0 and 1")
+	}
+	return nil
+}
+
+func defaultConfig() Config {
+	return Config{
+		CasesDir: filepath.FromSlash("eval/fixtures"),
+		Model:    "gpt-5-mini",
+	}
+}
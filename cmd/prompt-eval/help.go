@@ -0,0 +1,18 @@
+package main
+
+import "github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+
+var help = cli.Help{
+	Name:    "prompt-eval",
+	Summary: "score chunk-summarizer's prompts against golden fixtures",
+	Groups: []cli.Group{
+		{Title: "Fixtures", Flags: []string{"cases", "work"}},
+		{Title: "Model and prompts", Flags: []string{"model", "sentiment-model", "sentiment-prompt-file", "transcript-format", "api-key"}},
+		{Title: "Scoring", Flags: []string{"score-only", "report", "baseline", "min-score"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "score a prompt change against the last accepted report", Command: "prompt-eval -sentiment-prompt-file prompts/sentiment.txt -baseline eval_report.json"},
+		{Comment: "re-score an earlier run without calling the model, failing below 0.8", Command: "prompt-eval -work /tmp/eval -score-only -min-score 0.8"},
+	},
+	Values: map[string][]string{"transcript-format": {"compact", "markdown", "role-grouped", "tool-collapsed"}},
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/eval"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+)
+
+func main() {
+	cfg, err := parseFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := layout.LoadConventionsFromEnv(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cases, err := eval.LoadCases(fileutils.OS, cfg.CasesDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if cfg.WorkDir == "" {
+		cfg.WorkDir, err = os.MkdirTemp("", "prompt-eval-*")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+	if cfg.ReportPath == "" {
+		cfg.ReportPath = filepath.Join(cfg.WorkDir, eval.ReportFileName)
+	}
+
+	if !cfg.ScoreOnly {
+		if err := summarizeCases(ctx, cfg, cases, runGo); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	report := eval.NewReport(cfg.Model, cfg.sentimentModel(), scoreCases(cases, filepath.Join(cfg.WorkDir, "summaries")))
+	if cfg.ScoreOnly {
+		report.Model, report.SentimentModel = "", ""
+	}
+	var baseline *eval.Report
+	if cfg.BaselinePath != "" {
+		b, err := readReport(cfg.BaselinePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(2)
+		}
+		baseline = &b
+	}
+	printReport(os.Stderr, report, baseline)
+	if err := fileutils.WriteJSONFileAtomic(cfg.ReportPath, report, true); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stdout, "cases=%d checks_passed=%d checks_total=%d score=%.3f work_dir=%s report=%s\n", len(report.Cases), report.Passed, report.Total, report.Score, cfg.WorkDir, cfg.ReportPath)
+	if cfg.MinScore > 0 && report.Score < cfg.MinScore {
+		fmt.Fprintf(os.Stderr, "score %.3f is below -min-score %.3f\n", report.Score, cfg.MinScore)
+		os.Exit(1)
+	}
+}
+
+func (c Config) sentimentModel() string {
+	if c.SentimentModel == "" {
+		return c.Model
+	}
+	return c.SentimentModel
+}
+
+// summarizeCases writes each case's chunk under <work>/chunks and runs chunk-summarizer over them into
+// <work>/summaries, replacing any earlier outputs.
+func summarizeCases(ctx context.Context, cfg Config, cases []eval.Case, run func(context.Context, ...string) error) error {
+	chunksDir := filepath.Join(cfg.WorkDir, "chunks")
+	summariesDir := filepath.Join(cfg.WorkDir, "summaries")
+	// Stale chunks or summaries from a different fixture set would otherwise be scored or summarized too.
+	for _, dir := range []string{chunksDir, summariesDir} {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("clean %s: %w", dir, err)
+		}
+	}
+	for _, c := range cases {
+		if err := fileutils.WriteJSONFileAtomic(filepath.Join(chunksDir, c.ChunkFileName()), c.Chunk, true); err != nil {
+			return fmt.Errorf("write case %s: %w", c.Name, err)
+		}
+	}
+
+	args := []string{"run", "./cmd/chunk-summarizer",
+		"-in", chunksDir,
+		"-out", summariesDir,
+		"-model", cfg.Model,
+		"-sentiment-model", cfg.sentimentModel(),
+		"-glossary", filepath.Join(summariesDir, "glossary.json"),
+		"-overwrite",
+		"-strict",
+		"-durability", "none",
+	}
+	if cfg.SentimentPromptFile != "" {
+		args = append(args, "-sentiment-prompt-file", cfg.SentimentPromptFile)
+	}
+	if cfg.TranscriptFormat != "" {
+		args = append(args, "-transcript-format", cfg.TranscriptFormat)
+	}
+	if cfg.APIKey != "" {
+		args = append(args, "-api-key", cfg.APIKey)
+	}
+	return run(ctx, args...)
+}
+
+// scoreCases reads each case's summaries from summariesDir and scores them. A missing or unreadable
+// semantic summary fails the case; a missing sentiment summary only fails sentiment checks.
+func scoreCases(cases []eval.Case, summariesDir string) []eval.CaseResult {
+	out := make([]eval.CaseResult, 0, len(cases))
+	for _, c := range cases {
+		base := filepath.Join(summariesDir, strings.TrimSuffix(c.ChunkFileName(), ".json"))
+		var sum migration.ChunkSummary
+		if err := readJSON(layout.Find(base, layout.ChunkSummary), &sum); err != nil {
+			out = append(out, eval.CaseResult{Name: c.Name, Error: err.Error()})
+			continue
+		}
+		var sent *migration.ChunkSentimentSummary
+		var s migration.ChunkSentimentSummary
+		if err := readJSON(layout.Find(base, layout.ChunkSentiment), &s); err == nil {
+			sent = &s
+		}
+		out = append(out, eval.Score(c, sum, sent))
+	}
+	return out
+}
+
+// printReport writes one line per case with its failed checks, and the change from baseline when given.
+func printReport(w io.Writer, r eval.Report, baseline *eval.Report) {
+	prev := map[string]float64{}
+	if baseline != nil {
+		for _, c := range baseline.Cases {
+			prev[c.Name] = c.Score
+		}
+	}
+	for _, c := range r.Cases {
+		status := "PASS"
+		if c.Score < 1 {
+			status = "FAIL"
+		}
+		line := fmt.Sprintf("%s %-28s score=%.2f", status, c.Name, c.Score)
+		if p, ok := prev[c.Name]; ok && baseline != nil {
+			line += fmt.Sprintf(" (%+.2f)", c.Score-p)
+		}
+		fmt.Fprintln(w, line)
+		if c.Error != "" {
+			fmt.Fprintln(w, "    error:", c.Error)
+		}
+		for _, ck := range c.Checks {
+			if ck.Pass {
+				continue
+			}
+			if ck.Detail != "" {
+				fmt.Fprintf(w, "    failed: %s (%s)\n", ck.Name, ck.Detail)
+			} else {
+				fmt.Fprintf(w, "    failed: %s\n", ck.Name)
+			}
+		}
+	}
+	total := fmt.Sprintf("score=%.3f checks=%d/%d", r.Score, r.Passed, r.Total)
+	if baseline != nil {
+		total += fmt.Sprintf(" baseline=%.3f (%+.3f)", baseline.Score, r.Score-baseline.Score)
+	}
+	fmt.Fprintln(w, total)
+}
+
+func readReport(path string) (eval.Report, error) {
+	var r eval.Report
+	if err := readJSON(path, &r); err != nil {
+		return eval.Report{}, fmt.Errorf("read -baseline: %w", err)
+	}
+	return r, nil
+}
+
+func readJSON(path string, v any) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("missing %s", filepath.Base(path))
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("unmarshal %s: %w", path, err)
+	}
+	return nil
+}
+
+func runGo(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
+	cfg := defaultConfig()
+	fs.SetOutput(os.Stderr)
+	cli.Setup(fs, help)
+	fs.StringVar(&cfg.CasesDir, "cases", cfg.CasesDir, "Directory of golden fixture *.json files")
+	fs.StringVar(&cfg.WorkDir, "work", "", "Directory for fixture chunks, summaries, and the report (default: a new temp dir)")
+	fs.StringVar(&cfg.Model, "model", cfg.Model, "OpenAI model for semantic summaries")
+	fs.StringVar(&cfg.SentimentModel, "sentiment-model", "", "OpenAI model for sentiment summaries (default: -model)")
+	fs.StringVar(&cfg.SentimentPromptFile, "sentiment-prompt-file", "", "Custom sentiment prompt header passed to chunk-summarizer")
+	fs.StringVar(&cfg.TranscriptFormat, "transcript-format", "", "Transcript framing passed to chunk-summarizer (compact, markdown, role-grouped, tool-collapsed)")
+	fs.StringVar(&cfg.APIKey, "api-key", "", "OpenAI API key (optional; defaults to OPENAI_API_KEY)")
+	fs.BoolVar(&cfg.ScoreOnly, "score-only", false, "Re-score the summaries already in -work without calling the model")
+	fs.StringVar(&cfg.ReportPath, "report", "", "Path for the scored report JSON (default: <work>/eval_report.json)")
+	fs.StringVar(&cfg.BaselinePath, "baseline", "", "Earlier report to compare against (per-case and overall score change)")
+	fs.Float64Var(&cfg.MinScore, "min-score", 0, "Exit with status 1 when the overall score is below this (0..1; 0 disables)")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	for _, p := range []*string{&cfg.CasesDir, &cfg.WorkDir, &cfg.SentimentPromptFile, &cfg.ReportPath, &cfg.BaselinePath} {
+		if *p != "" {
+			*p = filepath.Clean(*p)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/eval"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+func TestParseFlags_ScoreOnlyNeedsWork(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("prompt-eval", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-score-only", "-min-score", "0.8"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error without -work")
+	}
+	cfg.WorkDir = "out/eval"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	cfg.MinScore = 2
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for -min-score > 1")
+	}
+}
+
+func TestSummarizeAndScoreCases(t *testing.T) {
+	t.Parallel()
+
+	cases := []eval.Case{
+		{Name: "good", Chunk: migration.Chunk{ConversationID: "g"}, Expect: eval.Expectation{MustMention: []string{"lisbon"}, Banned: []string{"PWNED"}}},
+		{Name: "missing", Chunk: migration.Chunk{ConversationID: "m"}, Expect: eval.Expectation{MinKeyPoints: 1}},
+	}
+	cfg := defaultConfig()
+	cfg.WorkDir = t.TempDir()
+	cfg.SentimentModel = "big-model"
+
+	stale := filepath.Join(cfg.WorkDir, "summaries", "old.summary.json")
+	if err := os.MkdirAll(filepath.Dir(stale), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(stale, []byte("{}"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var gotArgs []string
+	fake := func(_ context.Context, args ...string) error {
+		gotArgs = args
+		// Stand in for chunk-summarizer: summarize only the first case.
+		out := filepath.Join(cfg.WorkDir, "summaries", "good.summary.json")
+		return fileutils.WriteJSONFileAtomic(out, migration.ChunkSummary{ConversationID: "g", Summary: "Moving to Lisbon."}, false)
+	}
+	if err := summarizeCases(context.Background(), cfg, cases, fake); err != nil {
+		t.Fatalf("summarizeCases: %v", err)
+	}
+	joined := strings.Join(gotArgs, " ")
+	if !strings.Contains(joined, "-model gpt-5-mini") || !strings.Contains(joined, "-sentiment-model big-model") || !strings.Contains(joined, "-overwrite") {
+		t.Fatalf("args=%v", gotArgs)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.WorkDir, "chunks", "missing.json")); err != nil {
+		t.Fatalf("chunk not written: %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("stale summary kept: %v", err)
+	}
+
+	results := scoreCases(cases, filepath.Join(cfg.WorkDir, "summaries"))
+	if results[0].Score != 1 || results[1].Score != 0 || results[1].Error == "" {
+		t.Fatalf("results=%+v", results)
+	}
+
+	var buf bytes.Buffer
+	baseline := eval.Report{Score: 1, Cases: []eval.CaseResult{{Name: "good", Score: 0.5}}}
+	printReport(&buf, eval.NewReport(cfg.Model, "", results), &baseline)
+	out := buf.String()
+	if !strings.Contains(out, "PASS good") || !strings.Contains(out, "(+0.50)") || !strings.Contains(out, "FAIL missing") || !strings.Contains(out, "baseline=1.000 (-0.500)") {
+		t.Fatalf("report:\n%s", out)
+	}
+}
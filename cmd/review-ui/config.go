@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+)
+
+type Config struct {
+	Addr string
+
+	ChunksDir          string
+	SummariesDir       string
+	ThreadSummariesDir string
+	ThreadSentimentDir string
+}
+
+func (c Config) Validate() error {
+	if c.Addr == "" {
+		return errors.New("missing -addr")
+	}
+	if c.SummariesDir == "" {
+		return errors.New("missing -summaries")
+	}
+	if c.ThreadSummariesDir == "" {
+		return errors.New("missing -thread-summaries")
+	}
+	return nil
+}
+
+func defaultConfig() Config {
+	return Config{
+		Addr:               "127.0.0.1:8765",
+		ChunksDir:          filepath.FromSlash("docs/peanut-gallery/threads/chunks"),
+		SummariesDir:       filepath.FromSlash("docs/peanut-gallery/threads/summaries"),
+		ThreadSummariesDir: filepath.FromSlash("docs/peanut-gallery/threads/thread_summaries"),
+		ThreadSentimentDir: filepath.FromSlash("docs/peanut-gallery/threads/thread_sentiment_summaries"),
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import "github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+
+var help = cli.Help{
+	Name:    "review-ui",
+	Summary: "serve a local web UI for reviewing summaries next to their transcripts",
+	Groups: []cli.Group{
+		{Title: "Server", Flags: []string{"addr"}},
+		{Title: "Archive", Flags: []string{"chunks", "summaries", "thread-summaries", "thread-sentiment-summaries"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "review the default archive at http://127.0.0.1:8765", Command: "review-ui"},
+		{Comment: "review another archive on a different port", Command: "review-ui -addr :9090 -chunks archive/chunks -summaries archive/summaries -thread-summaries archive/thread-summaries"},
+	},
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+)
+
+func main() {
+	cfg, err := parseFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := layout.LoadConventionsFromEnv(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s, err := newServer(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "review-ui listening on http://%s\n", cfg.Addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+// Artifact kinds accepted by /save.
+const (
+	kindChunk           = "chunk"
+	kindChunkSentiment  = "chunk-sentiment"
+	kindThread          = "thread"
+	kindThreadSentiment = "thread-sentiment"
+)
+
+type server struct {
+	cfg  Config
+	tmpl *template.Template
+	now  func() time.Time
+	// chunks lists each thread's chunk summaries, found once at startup.
+	chunks map[string][]chunkRef
+}
+
+// chunkRef locates one chunk summary under SummariesDir.
+type chunkRef struct {
+	Number int
+	Rel    string
+}
+
+// newServer indexes the chunk summaries under cfg.SummariesDir by thread, so thread pages don't walk
+// the directory. Chunk summaries written after startup show up after a restart.
+func newServer(cfg Config) (*server, error) {
+	chunks, err := indexChunks(cfg.SummariesDir)
+	if err != nil {
+		return nil, err
+	}
+	return &server{
+		cfg:    cfg,
+		tmpl:   template.Must(template.New("review-ui").Parse(pageTemplates)),
+		now:    time.Now,
+		chunks: chunks,
+	}, nil
+}
+
+// routes serves the UI. Cross-origin POSTs are refused, so a page open in the same browser can't
+// submit a form to /save and overwrite artifacts.
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleIndex)
+	mux.HandleFunc("GET /thread", s.handleThread)
+	mux.HandleFunc("POST /save", s.handleSave)
+	return http.NewCrossOriginProtection().Handler(mux)
+}
+
+type threadListItem struct {
+	ID             string
+	Title          string
+	Project        string
+	Edited         bool
+	SentimentFound bool
+	SentimentEdit  bool
+}
+
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	entries, err := os.ReadDir(s.cfg.ThreadSummariesDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var items []threadListItem
+	for _, e := range entries {
+		name := e.Name()
+		_, base, _ := layout.Detect(name)
+		if e.IsDir() || !layout.Is(name, layout.ThreadSummary) {
+			continue
+		}
+		var ts migration.ThreadSummary
+		if err := readJSON(filepath.Join(s.cfg.ThreadSummariesDir, name), &ts); err != nil {
+			continue
+		}
+		id := ts.ConversationID
+		if id == "" {
+			id = base
+		}
+		item := threadListItem{ID: id, Title: ts.Title, Project: ts.Project, Edited: ts.EditedByHuman}
+		if s.cfg.ThreadSentimentDir != "" {
+			sentPath := layout.Find(filepath.Join(s.cfg.ThreadSentimentDir, id), layout.ThreadSentiment)
+			item.SentimentFound = fileutils.FileExists(sentPath)
+			item.SentimentEdit = migration.IsHumanEdited(sentPath)
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	s.render(w, "index", map[string]any{"Threads": items})
+}
+
+// artifactView is one editable artifact on the thread page.
+type artifactView struct {
+	ThreadID string
+	Kind     string
+	Rel      string
+	JSON     string
+	Edited   bool
+	Found    bool
+}
+
+type chunkView struct {
+	Number     int
+	Summary    artifactView
+	Sentiment  artifactView
+	Transcript []migration.SimplifiedMessage
+}
+
+func (s *server) handleThread(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		http.Error(w, "invalid thread id", http.StatusBadRequest)
+		return
+	}
+
+	thread := s.loadArtifact(id, kindThread, s.artifactRel(kindThread, id))
+	if !thread.Found {
+		http.NotFound(w, r)
+		return
+	}
+	var sentiment artifactView
+	if s.cfg.ThreadSentimentDir != "" {
+		sentiment = s.loadArtifact(id, kindThreadSentiment, s.artifactRel(kindThreadSentiment, id))
+	}
+
+	chunks := s.threadChunks(id)
+	s.render(w, "thread", map[string]any{
+		"ID":        id,
+		"Thread":    thread,
+		"Sentiment": sentiment,
+		"Chunks":    chunks,
+		"Saved":     r.URL.Query().Get("saved"),
+	})
+}
+
+// indexChunks maps each thread ID to its chunk summaries under dir, ordered by chunk number. A missing
+// dir has none.
+func indexChunks(dir string) (map[string][]chunkRef, error) {
+	paths, err := migration.ArtifactPaths(fileutils.OS, dir, layout.ChunkSummary)
+	if err != nil {
+		return nil, fmt.Errorf("summaries: %w", err)
+	}
+	out := make(map[string][]chunkRef)
+	for _, path := range paths {
+		var cs migration.ChunkSummary
+		if err := readJSON(path, &cs); err != nil || cs.ConversationID == "" {
+			continue
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil, err
+		}
+		out[cs.ConversationID] = append(out[cs.ConversationID], chunkRef{Number: cs.ChunkNumber, Rel: rel})
+	}
+	for _, refs := range out {
+		sort.Slice(refs, func(i, j int) bool { return refs[i].Number < refs[j].Number })
+	}
+	return out, nil
+}
+
+// threadChunks pairs each of threadID's chunk summaries with its sentiment summary and source chunk
+// transcript, in chunk order.
+func (s *server) threadChunks(threadID string) []chunkView {
+	var out []chunkView
+	for _, ref := range s.chunks[threadID] {
+		_, base, _ := layout.Detect(ref.Rel)
+		cv := chunkView{
+			Number:    ref.Number,
+			Summary:   s.loadArtifact(threadID, kindChunk, ref.Rel),
+			Sentiment: s.loadArtifact(threadID, kindChunkSentiment, s.artifactRel(kindChunkSentiment, base)),
+		}
+		if s.cfg.ChunksDir != "" {
+			var chunk migration.Chunk
+			if err := readJSON(filepath.Join(s.cfg.ChunksDir, base+".json"), &chunk); err == nil {
+				cv.Transcript = chunk.Messages
+			}
+		}
+		out = append(out, cv)
+	}
+	return out
+}
+
+func (s *server) loadArtifact(threadID, kind, rel string) artifactView {
+	v := artifactView{ThreadID: threadID, Kind: kind, Rel: filepath.ToSlash(rel)}
+	path, err := s.artifactPath(kind, rel)
+	if err != nil {
+		return v
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return v
+	}
+	v.Found = true
+	v.JSON = string(b)
+	v.Edited = migration.IsHumanEdited(path)
+	return v
+}
+
+// artifactRel returns the name, relative to kind's root, of the artifact with the given base: the first
+// of its current and legacy names that exists, otherwise the current name.
+func (s *server) artifactRel(kind, base string) string {
+	lk := layoutKind(kind)
+	for _, rel := range layout.Candidates(base, lk) {
+		if path, err := s.artifactPath(kind, rel); err == nil && fileutils.FileExists(path) {
+			return rel
+		}
+	}
+	return layout.Name(base, lk)
+}
+
+// layoutKind maps a review-ui artifact kind to its file naming kind.
+func layoutKind(kind string) layout.Kind {
+	switch kind {
+	case kindChunkSentiment:
+		return layout.ChunkSentiment
+	case kindThread:
+		return layout.ThreadSummary
+	case kindThreadSentiment:
+		return layout.ThreadSentiment
+	}
+	return layout.ChunkSummary
+}
+
+// artifactPath resolves rel under the root directory for kind, rejecting paths that escape it.
+func (s *server) artifactPath(kind, rel string) (string, error) {
+	var root string
+	switch kind {
+	case kindChunk, kindChunkSentiment:
+		root = s.cfg.SummariesDir
+	case kindThread:
+		root = s.cfg.ThreadSummariesDir
+	case kindThreadSentiment:
+		root = s.cfg.ThreadSentimentDir
+	default:
+		return "", fmt.Errorf("unknown artifact kind %q", kind)
+	}
+	if root == "" {
+		return "", fmt.Errorf("no directory configured for %s artifacts", kind)
+	}
+	rel = filepath.FromSlash(rel)
+	if !filepath.IsLocal(rel) || !strings.HasSuffix(strings.ToLower(rel), ".json") {
+		return "", fmt.Errorf("invalid artifact path %q", rel)
+	}
+	return filepath.Join(root, rel), nil
+}
+
+func (s *server) handleSave(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	kind := r.PostForm.Get("kind")
+	path, err := s.artifactPath(kind, r.PostForm.Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// "approve" stamps the artifact on disk as-is; "save" writes the edited JSON from the form.
+	var raw []byte
+	switch action := r.PostForm.Get("action"); action {
+	case "approve":
+		raw, err = os.ReadFile(path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	case "save", "":
+		raw = []byte(r.PostForm.Get("json"))
+	default:
+		http.Error(w, fmt.Sprintf("unknown action %q", action), http.StatusBadRequest)
+		return
+	}
+
+	v, err := markReviewed(kind, raw, s.now().UTC().Format(time.RFC3339))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := fileutils.WriteArtifactAtomic(path, v, true); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	redirect := "/"
+	if id := r.PostForm.Get("thread"); id != "" {
+		redirect = "/thread?" + url.Values{"id": {id}, "saved": {r.PostForm.Get("path")}}.Encode()
+	}
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// markReviewed decodes raw as the artifact type for kind and stamps it as edited by a human.
+func markReviewed(kind string, raw []byte, reviewedAt string) (any, error) {
+	switch kind {
+	case kindChunk:
+		var v migration.ChunkSummary
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, fmt.Errorf("parse chunk summary: %w", err)
+		}
+		v.EditedByHuman, v.ReviewedAt = true, reviewedAt
+		return v, nil
+	case kindChunkSentiment:
+		var v migration.ChunkSentimentSummary
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, fmt.Errorf("parse chunk sentiment summary: %w", err)
+		}
+		v.EditedByHuman, v.ReviewedAt = true, reviewedAt
+		return v, nil
+	case kindThread:
+		var v migration.ThreadSummary
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, fmt.Errorf("parse thread summary: %w", err)
+		}
+		v.EditedByHuman, v.ReviewedAt = true, reviewedAt
+		return v, nil
+	case kindThreadSentiment:
+		var v migration.ThreadSentimentSummary
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, fmt.Errorf("parse thread sentiment summary: %w", err)
+		}
+		v.EditedByHuman, v.ReviewedAt = true, reviewedAt
+		return v, nil
+	}
+	return nil, fmt.Errorf("unknown artifact kind %q", kind)
+}
+
+func (s *server) render(w http.ResponseWriter, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.tmpl.ExecuteTemplate(w, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func readJSON(path string, v any) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
+	cfg := defaultConfig()
+	fs.SetOutput(os.Stderr)
+	cli.Setup(fs, help)
+	fs.StringVar(&cfg.Addr, "addr", cfg.Addr, "Listen address for the review server")
+	fs.StringVar(&cfg.ChunksDir, "chunks", cfg.ChunksDir, "Path to chunk JSON directory (transcripts shown next to summaries)")
+	fs.StringVar(&cfg.SummariesDir, "summaries", cfg.SummariesDir, "Path to chunk summaries directory (*.summary.json, *.sentiment.summary.json)")
+	fs.StringVar(&cfg.ThreadSummariesDir, "thread-summaries", cfg.ThreadSummariesDir, "Path to thread rollups directory (*.thread.summary.json)")
+	fs.StringVar(&cfg.ThreadSentimentDir, "thread-sentiment-summaries", cfg.ThreadSentimentDir, "Path to thread sentiment rollups directory (*.thread.sentiment.summary.json)")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	for _, p := range []*string{&cfg.ChunksDir, &cfg.SummariesDir, &cfg.ThreadSummariesDir, &cfg.ThreadSentimentDir} {
+		if *p != "" {
+			*p = filepath.Clean(*p)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+)
+
+func TestParseFlags_Overrides(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("review-ui", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{
+		"-addr", "127.0.0.1:9999",
+		"-chunks", "a/chunks/",
+		"-summaries", "a/summaries/",
+		"-thread-summaries", "a/threads/",
+		"-thread-sentiment-summaries", "a/sent/",
+	})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.Addr != "127.0.0.1:9999" {
+		t.Fatalf("Addr=%q", cfg.Addr)
+	}
+	if cfg.ChunksDir != filepath.Clean("a/chunks") || cfg.SummariesDir != filepath.Clean("a/summaries") {
+		t.Fatalf("dirs=%q %q", cfg.ChunksDir, cfg.SummariesDir)
+	}
+	if cfg.ThreadSummariesDir != filepath.Clean("a/threads") || cfg.ThreadSentimentDir != filepath.Clean("a/sent") {
+		t.Fatalf("thread dirs=%q %q", cfg.ThreadSummariesDir, cfg.ThreadSentimentDir)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func writeTestJSON(t *testing.T, path string, v any) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func newTestServer(t *testing.T) (*server, Config) {
+	t.Helper()
+	root := t.TempDir()
+	cfg := Config{
+		Addr:               "127.0.0.1:0",
+		ChunksDir:          filepath.Join(root, "chunks"),
+		SummariesDir:       filepath.Join(root, "summaries"),
+		ThreadSummariesDir: filepath.Join(root, "thread_summaries"),
+		ThreadSentimentDir: filepath.Join(root, "thread_sentiment_summaries"),
+	}
+	writeTestJSON(t, filepath.Join(cfg.ThreadSummariesDir, "t1.thread.summary.json"), migration.ThreadSummary{
+		ConversationID: "t1", Title: "First thread", Summary: "generated rollup",
+	})
+	writeTestJSON(t, filepath.Join(cfg.SummariesDir, "t1", "chunk_0001.summary.json"), migration.ChunkSummary{
+		ConversationID: "t1", ChunkNumber: 1, Summary: "generated chunk summary",
+	})
+	writeTestJSON(t, filepath.Join(cfg.ChunksDir, "t1", "chunk_0001.json"), migration.Chunk{
+		ConversationID: "t1", ChunkNumber: 1,
+		Messages: []migration.SimplifiedMessage{{Role: "user", Text: "hello transcript"}},
+	})
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+	s.now = func() time.Time { return time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC) }
+	return s, cfg
+}
+
+func TestHandleThread_ShowsSummaryAndTranscript(t *testing.T) {
+	t.Parallel()
+	s, _ := newTestServer(t)
+
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/thread?id=t1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"generated rollup", "generated chunk summary", "hello transcript", "t1/chunk_0001.summary.json"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("missing %q in page", want)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "First thread") {
+		t.Fatalf("index code=%d body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandleSave_MarksEditedByHuman(t *testing.T) {
+	t.Parallel()
+	s, cfg := newTestServer(t)
+
+	form := url.Values{
+		"kind":   {kindChunk},
+		"path":   {"t1/chunk_0001.summary.json"},
+		"thread": {"t1"},
+		"action": {"save"},
+		"json":   {`{"conversation_id":"t1","chunk_number":1,"summary":"fixed by hand"}`},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/save", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("code=%d body=%s", rec.Code, rec.Body.String())
+	}
+
+	var got migration.ChunkSummary
+	if err := readJSON(filepath.Join(cfg.SummariesDir, "t1", "chunk_0001.summary.json"), &got); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got.Summary != "fixed by hand" || !got.EditedByHuman || got.ReviewedAt != "2025-01-02T03:04:05Z" {
+		t.Fatalf("got=%+v", got)
+	}
+
+	// Approve stamps the on-disk rollup without changing its content.
+	form = url.Values{"kind": {kindThread}, "path": {"t1.thread.summary.json"}, "action": {"approve"}}
+	req = httptest.NewRequest(http.MethodPost, "/save", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("approve code=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var ts migration.ThreadSummary
+	if err := readJSON(filepath.Join(cfg.ThreadSummariesDir, "t1.thread.summary.json"), &ts); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if ts.Summary != "generated rollup" || !ts.EditedByHuman {
+		t.Fatalf("ts=%+v", ts)
+	}
+}
+
+func TestHandleSave_RejectsBadInput(t *testing.T) {
+	t.Parallel()
+	s, _ := newTestServer(t)
+
+	cases := []url.Values{
+		{"kind": {kindChunk}, "path": {"../escape.summary.json"}, "json": {`{}`}},
+		{"kind": {kindChunk}, "path": {"/abs.summary.json"}, "json": {`{}`}},
+		{"kind": {"bogus"}, "path": {"t1/chunk_0001.summary.json"}, "json": {`{}`}},
+		{"kind": {kindChunk}, "path": {"t1/chunk_0001.summary.json"}, "json": {`not json`}},
+	}
+	for _, form := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/save", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		s.routes().ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("form=%v code=%d", form, rec.Code)
+		}
+	}
+}
+
+func TestHandleSave_RejectsCrossOriginPosts(t *testing.T) {
+	t.Parallel()
+	s, cfg := newTestServer(t)
+
+	form := url.Values{"kind": {kindThread}, "path": {"t1.thread.summary.json"}, "action": {"save"}, "json": {`{"conversation_id":"t1","summary":"planted"}`}}
+	for _, hdr := range []map[string]string{
+		{"Sec-Fetch-Site": "cross-site"},
+		{"Origin": "https://attacker.example"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "http://127.0.0.1:8765/save", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		s.routes().ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("headers=%v code=%d", hdr, rec.Code)
+		}
+	}
+	var ts migration.ThreadSummary
+	if err := readJSON(filepath.Join(cfg.ThreadSummariesDir, "t1.thread.summary.json"), &ts); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if ts.Summary != "generated rollup" {
+		t.Fatalf("cross-origin save was written: %+v", ts)
+	}
+
+	// The UI's own form posts come from the same origin.
+	req := httptest.NewRequest(http.MethodPost, "http://127.0.0.1:8765/save", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Sec-Fetch-Site", "same-origin")
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("same-origin code=%d body=%s", rec.Code, rec.Body.String())
+	}
+}
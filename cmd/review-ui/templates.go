@@ -0,0 +1,70 @@
+package main
+
+// pageTemplates holds the review-ui pages. They are kept inline so the binary has no asset files to ship.
+const pageTemplates = `
+{{define "head"}}<!doctype html>
+<html><head><meta charset="utf-8"><title>compress-o-bot review</title>
+<style>
+body { font-family: sans-serif; margin: 1.5em; }
+table { border-collapse: collapse; }
+td, th { padding: 0.2em 0.8em; text-align: left; vertical-align: top; }
+.pair { display: flex; gap: 1em; }
+.pair > div { flex: 1; min-width: 0; }
+textarea { width: 100%; height: 22em; font-family: monospace; font-size: 0.85em; }
+.transcript { max-height: 30em; overflow: auto; border: 1px solid #ccc; padding: 0.5em; white-space: pre-wrap; }
+.edited { color: #060; font-weight: bold; }
+.saved { background: #efe; padding: 0.3em; }
+</style></head><body>{{end}}
+
+{{define "artifact"}}
+<h4>{{.Kind}}{{if .Edited}} <span class="edited">edited_by_human</span>{{end}}</h4>
+{{if .Found}}
+<form method="post" action="/save">
+<input type="hidden" name="kind" value="{{.Kind}}">
+<input type="hidden" name="path" value="{{.Rel}}">
+<input type="hidden" name="thread" value="{{.ThreadID}}">
+<textarea name="json">{{.JSON}}</textarea>
+<button type="submit" name="action" value="save">Save edits</button>
+<button type="submit" name="action" value="approve">Approve as-is</button>
+</form>
+{{else}}<p><em>missing: {{.Rel}}</em></p>{{end}}
+{{end}}
+
+{{define "index"}}{{template "head"}}
+<h1>Threads</h1>
+{{if .Threads}}
+<table>
+<tr><th>Thread</th><th>Title</th><th>Project</th><th>Summary</th><th>Sentiment</th></tr>
+{{range .Threads}}
+<tr>
+<td><a href="/thread?id={{.ID}}">{{.ID}}</a></td>
+<td>{{.Title}}</td>
+<td>{{.Project}}</td>
+<td>{{if .Edited}}<span class="edited">edited</span>{{else}}generated{{end}}</td>
+<td>{{if not .SentimentFound}}-{{else if .SentimentEdit}}<span class="edited">edited</span>{{else}}generated{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{else}}<p>No *.thread.summary.json files found.</p>{{end}}
+</body></html>{{end}}
+
+{{define "thread"}}{{template "head"}}
+<p><a href="/">&larr; all threads</a></p>
+<h1>{{.ID}}</h1>
+{{if .Saved}}<p class="saved">Saved {{.Saved}}</p>{{end}}
+<h2>Thread rollup</h2>
+<div class="pair">
+<div>{{template "artifact" .Thread}}</div>
+<div>{{if .Sentiment.Kind}}{{template "artifact" .Sentiment}}{{end}}</div>
+</div>
+{{range .Chunks}}
+<h2>Chunk {{.Number}}</h2>
+<div class="pair">
+<div><h4>transcript</h4><div class="transcript">{{range .Transcript}}<b>{{.Role}}</b>: {{.Text}}
+{{else}}<em>chunk file not found</em>{{end}}</div></div>
+<div>{{template "artifact" .Summary}}</div>
+<div>{{template "artifact" .Sentiment}}</div>
+</div>
+{{end}}
+</body></html>{{end}}
+`
@@ -2,7 +2,12 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"path/filepath"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
 )
 
 type Config struct {
@@ -12,7 +17,64 @@ type Config struct {
 	TargetTurns int
 	Pretty      bool
 	Overwrite   bool
+	Resume      bool
 	APIKey      string
+
+	// BreakpointCache reuses breakpoint decisions stored in the output directory.
+	BreakpointCache bool
+
+	// Turn text budgets for breakpoint requests; see textBudget.
+	RequestMaxBytes            int
+	FullTextMaxTurns           int
+	UserSnippetChars           int
+	AssistantSnippetChars      int
+	ShortUserSnippetChars      int
+	ShortAssistantSnippetChars int
+
+	// Sanity limits on model breakpoints; 0 derives each from TargetTurns.
+	MinChunkTurns int
+	MaxChunkTurns int
+	MaxChunks     int
+
+	// MinTurns and MinMessages mark tiny threads, chunked whole without a breakpoint request (see
+	// migration.ChunkOptions); 0 disables a check.
+	MinTurns    int
+	MinMessages int
+	// MaxTinyTokens keeps larger threads from being tiny (see migration.ChunkOptions); 0 disables it.
+	MaxTinyTokens int
+
+	// FlagShortTurns and FlagLongTurns set which chunks the segmentation report flags (see
+	// migration.SegmentationFlags).
+	FlagShortTurns int
+	FlagLongTurns  int
+
+	// DropMessages and CompressMessages are the -drop-messages and -compress-messages values (see
+	// migration.ParseMessageMatches); CompressChars is the text a compressed message keeps.
+	DropMessages     string
+	CompressMessages string
+	CompressChars    int
+
+	MaxUSD         float64
+	MaxTokensTotal int64
+	BudgetLedger   string
+
+	// QPS caps model request attempts per second (see provider.SetQPS); 0 disables.
+	QPS float64
+
+	Durability  string
+	AtomicWrite string
+	// CanonicalJSON writes JSON outputs in canonical form (see fileutils.Canonicalize).
+	CanonicalJSON bool
+
+	// MaxFilesPerDir and MaxOutputBytes set the output quota (see fileutils.Quota).
+	MaxFilesPerDir int
+	MaxOutputBytes int64
+
+	// StructuredOutput is how schema-constrained output is requested (see provider.SetStructuredOutput).
+	StructuredOutput string
+
+	// Chaos is a -chaos spec (see provider.ParseChaos) injecting provider failures; empty disables.
+	Chaos string
 }
 
 func (c Config) Validate() error {
@@ -28,14 +90,94 @@ func (c Config) Validate() error {
 	if c.TargetTurns <= 0 {
 		return errors.New("target turns must be > 0")
 	}
+	if c.RequestMaxBytes < 0 || c.FullTextMaxTurns < 0 || c.UserSnippetChars < 0 || c.AssistantSnippetChars < 0 || c.ShortUserSnippetChars < 0 || c.ShortAssistantSnippetChars < 0 {
+		return errors.New("turn text budgets must be >= 0")
+	}
+	if c.MinChunkTurns < 0 || c.MaxChunkTurns < 0 || c.MaxChunks < 0 {
+		return errors.New("min-chunk-turns/max-chunk-turns/max-chunks must be >= 0")
+	}
+	if c.MinTurns < 0 || c.MinMessages < 0 || c.MaxTinyTokens < 0 {
+		return errors.New("min-turns/min-messages/max-tiny-tokens must be >= 0")
+	}
+	if c.FlagShortTurns < 0 || c.FlagLongTurns < 0 {
+		return errors.New("flag-short-turns/flag-long-turns must be >= 0")
+	}
+	if _, err := c.messageFilter(); err != nil {
+		return err
+	}
+	if c.MaxChunkTurns > 0 && c.MinChunkTurns > c.MaxChunkTurns {
+		return errors.New("min-chunk-turns must be <= max-chunk-turns")
+	}
+	if c.MaxUSD < 0 || c.MaxTokensTotal < 0 {
+		return errors.New("max-usd/max-tokens-total must be >= 0")
+	}
+	if c.QPS < 0 {
+		return errors.New("qps must be >= 0")
+	}
+	if _, err := fileutils.ParseDurability(c.Durability); err != nil {
+		return err
+	}
+	if _, err := fileutils.ParseAtomicWrite(c.AtomicWrite); err != nil {
+		return err
+	}
+	if _, err := provider.ParseStructuredOutput(c.StructuredOutput); err != nil {
+		return err
+	}
+	if _, err := provider.ParseChaos(c.Chaos); err != nil {
+		return err
+	}
 	return nil
 }
 
+func (c Config) breakpointLimits() migration.BreakpointLimits {
+	return migration.BreakpointLimits{
+		MinChunkTurns: c.MinChunkTurns,
+		MaxChunkTurns: c.MaxChunkTurns,
+		MaxChunks:     c.MaxChunks,
+	}
+}
+
+func (c Config) messageFilter() (migration.MessageFilter, error) {
+	drop, err := migration.ParseMessageMatches(c.DropMessages)
+	if err != nil {
+		return migration.MessageFilter{}, fmt.Errorf("drop-messages: %w", err)
+	}
+	compress, err := migration.ParseMessageMatches(c.CompressMessages)
+	if err != nil {
+		return migration.MessageFilter{}, fmt.Errorf("compress-messages: %w", err)
+	}
+	f := migration.MessageFilter{Drop: drop, Compress: compress, CompressChars: c.CompressChars}
+	if err := f.Validate(); err != nil {
+		return migration.MessageFilter{}, err
+	}
+	return f, nil
+}
+
+func (c Config) segmentationFlags() migration.SegmentationFlags {
+	return migration.SegmentationFlags{ShortTurns: c.FlagShortTurns, LongTurns: c.FlagLongTurns}
+}
+
 func defaultConfig() Config {
 	return Config{
 		InputPath:   "",
 		OutputDir:   filepath.FromSlash("docs/peanut-gallery/threads/chunks"),
 		Model:       "gpt-5-mini",
 		TargetTurns: 20,
+		Resume:      true,
+		Durability:  fileutils.DurabilityFull,
+
+		BreakpointCache: true,
+
+		FlagShortTurns: migration.DefaultSegmentationFlags.ShortTurns,
+		FlagLongTurns:  migration.DefaultSegmentationFlags.LongTurns,
+
+		CompressChars: migration.DefaultCompressChars,
+
+		RequestMaxBytes:            250_000,
+		FullTextMaxTurns:           250,
+		UserSnippetChars:           400,
+		AssistantSnippetChars:      600,
+		ShortUserSnippetChars:      80,
+		ShortAssistantSnippetChars: 120,
 	}
 }
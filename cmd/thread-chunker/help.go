@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
+)
+
+var help = cli.Help{
+	Name:    "thread-chunker",
+	Summary: "split threads into chunks at topic breaks chosen by a model",
+	Groups: []cli.Group{
+		{Title: "Input and output", Flags: []string{"in", "out", "pretty", "overwrite", "resume", "breakpoint-cache", "durability", "atomic-write", "canonical-json", "max-files-per-dir", "max-output-bytes"}},
+		{Title: "Model", Flags: []string{"model", "api-key", "structured-output", "qps"}},
+		{Title: "Chunk size", Flags: []string{"target-turns", "min-chunk-turns", "max-chunk-turns", "max-chunks", "min-turns", "min-messages", "max-tiny-tokens"}},
+		{Title: "Message filter", Flags: []string{"drop-messages", "compress-messages", "compress-chars"}},
+		{Title: "Segmentation report", Flags: []string{"flag-short-turns", "flag-long-turns"}},
+		{Title: "Breakpoint request", Flags: []string{"request-max-bytes", "full-text-max-turns", "user-snippet-chars", "assistant-snippet-chars", "short-user-snippet-chars", "short-assistant-snippet-chars"}},
+		{Title: "Spend caps", Flags: []string{"max-usd", "max-tokens-total", "budget-ledger"}},
+		{Title: "Testing", Flags: []string{"chaos"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "chunk every split thread", Command: "thread-chunker -in docs/peanut-gallery/threads -out docs/peanut-gallery/threads/chunks -model gpt-5-mini"},
+		{Comment: "pick up where an interrupted run stopped, spending at most $2", Command: "thread-chunker -in docs/peanut-gallery/threads -resume -max-usd 2"},
+		{Comment: "rechunk without tool output or reasoning traces", Command: "thread-chunker -in docs/peanut-gallery/threads -drop-messages 'tool,*/thoughts,*/reasoning_recap' -overwrite"},
+		{Comment: "rechunk one thread with smaller chunks", Command: "thread-chunker -in docs/peanut-gallery/threads/<conversation_id>.json -target-turns 6 -overwrite"},
+	},
+	Values: map[string][]string{"durability": fileutils.DurabilityModes, "atomic-write": fileutils.AtomicWriteModes, "structured-output": provider.StructuredOutputModes},
+}
@@ -15,9 +15,9 @@ import (
 	"time"
 
 	"github.com/openai/openai-go"
-	"github.com/openai/openai-go/option"
 	"github.com/openai/openai-go/responses"
 	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
 	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
 	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
 )
@@ -32,6 +32,24 @@ func main() {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(2)
 	}
+	if err := fileutils.SetDurability(cfg.Durability); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetAtomicWrite(cfg.AtomicWrite); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	fileutils.SetCanonicalJSON(cfg.CanonicalJSON)
+	if err := fileutils.SetQuota(fileutils.Quota{MaxFilesPerDir: cfg.MaxFilesPerDir, MaxBytes: cfg.MaxOutputBytes}); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	provider.SetQPS(cfg.QPS)
+	if err := provider.SetStructuredOutput(cfg.StructuredOutput); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
 
 	apiKey := cfg.APIKey
 	if apiKey == "" {
@@ -45,12 +63,32 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	client := openai.NewClient(option.WithAPIKey(apiKey))
-	decider := openAIBreakpointDecider{
+	budget, err := provider.NewBudget(cfg.MaxUSD, cfg.MaxTokensTotal, cfg.BudgetLedger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	chaos, _ := provider.ParseChaos(cfg.Chaos)
+	client := provider.NewClient(apiKey, chaos)
+	var decider migration.BreakpointDecider = openAIBreakpointDecider{
 		client: &client,
 		model:  cfg.Model,
+		budget: budget,
+		text:   cfg.textBudget(),
+	}
+	var cache *migration.BreakpointCache
+	if cfg.BreakpointCache {
+		cache, err = migration.OpenBreakpointCache(filepath.Join(cfg.OutputDir, migration.BreakpointCacheFileName))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		decider = cache.Decider(decider)
 	}
 
+	filter, _ := cfg.messageFilter()
+
 	inputFiles, err := collectInputFiles(cfg.InputPath)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
@@ -61,37 +99,135 @@ func main() {
 		os.Exit(2)
 	}
 
+	reportCfg := cfg
+	reportCfg.APIKey = ""
+	report := migration.NewRunReport("thread-chunker", reportCfg)
+	report.Total = int64(len(inputFiles))
+
 	start := time.Now()
-	var allWritten []string
+	var (
+		allWritten []string
+		segmented  []migration.SegmentedThread
+	)
+	threadsProcessed, tinyThreads := 0, 0
+	budgetExhausted := false
 	for i, inFile := range inputFiles {
+		if budget.Exceeded() {
+			budgetExhausted = true
+			break
+		}
+
 		// To avoid filename collisions across threads (same thread_start_time), create a per-thread subdir.
 		threadSubdir := filepath.Join(cfg.OutputDir, strings.TrimSuffix(filepath.Base(inFile), filepath.Ext(inFile)))
+		overwrite := cfg.Overwrite
+		if cfg.Resume && !cfg.Overwrite {
+			done, err := resumeThread(inFile, threadSubdir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed checking %s: %s\n", inFile, err.Error())
+				os.Exit(1)
+			}
+			if done {
+				threadsProcessed++
+				report.Skipped++
+				if segmented, err = appendSegmentedThread(segmented, threadSubdir); err != nil {
+					fmt.Fprintln(os.Stderr, err.Error())
+					os.Exit(1)
+				}
+				continue
+			}
+			overwrite = true
+		}
 
 		written, err := migration.ChunkThread(ctx, inFile, decider, cfg.TargetTurns, migration.ChunkOptions{
 			OutputDir:         threadSubdir,
-			OverwriteExisting: cfg.Overwrite,
+			OverwriteExisting: overwrite,
 			Pretty:            cfg.Pretty,
+			Limits:            cfg.breakpointLimits(),
+			Filter:            filter,
+			MinTurns:          cfg.MinTurns,
+			MinMessages:       cfg.MinMessages,
+			MaxTinyTokens:     cfg.MaxTinyTokens,
+			OnTiny:            func(string) { tinyThreads++ },
+			Warn: func(msg string) {
+				fmt.Fprintln(os.Stderr, "warning thread-chunker: "+msg)
+				report.Warnings = append(report.Warnings, msg)
+			},
 		})
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed chunking %s: %s\n", inFile, err.Error())
+			if cache != nil {
+				_ = cache.Close()
+			}
 			os.Exit(1)
 		}
 		allWritten = append(allWritten, written...)
+		threadsProcessed++
+		if segmented, err = appendSegmentedThread(segmented, threadSubdir); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		if err := budget.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
 
 		// Progress logging: this can take a long time and is otherwise mostly silent.
 		fmt.Fprintf(os.Stderr, "progress thread-chunker: %d/%d threads chunked (last=%s chunks=%d elapsed=%s)\n",
 			i+1, len(inputFiles), filepath.Base(inFile), len(written), time.Since(start).Round(time.Second))
 	}
 
-	fmt.Fprintf(os.Stdout, "threads_processed=%d chunks_written=%d out_dir=%s\n", len(inputFiles), len(allWritten), cfg.OutputDir)
+	cachedThreads := 0
+	if cache != nil {
+		if err := cache.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		cachedThreads, _ = cache.Stats()
+	}
+
+	if chaos != nil {
+		fmt.Fprintf(os.Stderr, "chaos thread-chunker: injected %s\n", chaos)
+	}
+
+	segmentationPath := filepath.Join(cfg.OutputDir, migration.SegmentationReportFileName)
+	flagged, err := migration.WriteSegmentationReport(segmentationPath, segmented, cfg.segmentationFlags())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "segmentation thread-chunker: %d flagged chunks, see %s\n", flagged, segmentationPath)
+
+	spend := budget.Spend()
+	session := budget.SessionSpend()
+	report.Processed = int64(threadsProcessed) - report.Skipped
+	report.InputTokens, report.OutputTokens, report.EstimatedUSD = session.InputTokens, session.OutputTokens, session.USD
+	report.Outputs = map[string]string{"out_dir": cfg.OutputDir, "segmentation_report": segmentationPath}
+	if budgetExhausted {
+		report.Status = migration.RunStatusBudgetExhausted
+	}
+	if err := migration.WriteRunReport(filepath.Join(cfg.OutputDir, migration.RunReportFileName), report); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	if err := fileutils.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stdout, "threads_processed=%d chunks_written=%d tiny_threads=%d breakpoints_cached=%d tokens_total=%d estimated_usd=%.4f out_dir=%s\n", threadsProcessed, len(allWritten), tinyThreads, cachedThreads, spend.TotalTokens(), spend.USD, cfg.OutputDir)
 	for _, p := range allWritten {
 		fmt.Fprintln(os.Stdout, p)
 	}
+	if budgetExhausted {
+		fmt.Fprintf(os.Stderr, "budget exhausted: stopped after %d/%d threads (tokens_total=%d estimated_usd=%.4f)\n", threadsProcessed, len(inputFiles), spend.TotalTokens(), spend.USD)
+		os.Exit(provider.ExitBudgetExhausted)
+	}
 }
 
 func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
 	cfg := defaultConfig()
 	fs.SetOutput(os.Stderr)
+	cli.Setup(fs, help)
 
 	fs.StringVar(&cfg.InputPath, "in", cfg.InputPath, "Path to a single simplified thread JSON file OR a directory containing thread JSON files")
 	fs.StringVar(&cfg.OutputDir, "out", cfg.OutputDir, "Directory to write chunk JSON files into")
@@ -99,20 +235,46 @@ func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
 	fs.IntVar(&cfg.TargetTurns, "target-turns", cfg.TargetTurns, "Target turns per chunk (a turn is user message + following assistant/tool messages)")
 	fs.BoolVar(&cfg.Pretty, "pretty", false, "Pretty-print each chunk JSON file")
 	fs.BoolVar(&cfg.Overwrite, "overwrite", false, "Overwrite existing chunk files")
+	fs.BoolVar(&cfg.Resume, "resume", cfg.Resume, "Skip threads whose chunk files already cover every turn; rechunk partially chunked threads (ignored with -overwrite)")
+	fs.IntVar(&cfg.RequestMaxBytes, "request-max-bytes", cfg.RequestMaxBytes, "Largest breakpoint request in bytes (0: no cap); longer threads fall back to short snippets, then to structure only")
+	fs.IntVar(&cfg.FullTextMaxTurns, "full-text-max-turns", cfg.FullTextMaxTurns, "Threads with more turns than this skip full-length snippets")
+	fs.IntVar(&cfg.UserSnippetChars, "user-snippet-chars", cfg.UserSnippetChars, "Per-turn user text sent for breakpoint detection")
+	fs.IntVar(&cfg.AssistantSnippetChars, "assistant-snippet-chars", cfg.AssistantSnippetChars, "Per-turn assistant text sent for breakpoint detection")
+	fs.IntVar(&cfg.ShortUserSnippetChars, "short-user-snippet-chars", cfg.ShortUserSnippetChars, "Per-turn user text for threads too large for full snippets (0 with -short-assistant-snippet-chars=0 sends structure only)")
+	fs.IntVar(&cfg.ShortAssistantSnippetChars, "short-assistant-snippet-chars", cfg.ShortAssistantSnippetChars, "Per-turn assistant text for threads too large for full snippets")
+	fs.IntVar(&cfg.MinChunkTurns, "min-chunk-turns", 0, "Reject model breakpoints leaving a chunk (other than the last) smaller than this (0: a quarter of -target-turns)")
+	fs.IntVar(&cfg.MaxChunkTurns, "max-chunk-turns", 0, "Reject model breakpoints leaving a chunk larger than this (0: three times -target-turns)")
+	fs.IntVar(&cfg.MaxChunks, "max-chunks", 0, "Reject model breakpoints producing more chunks than this per thread (0: about twice what -target-turns implies)")
+	fs.IntVar(&cfg.MinTurns, "min-turns", cfg.MinTurns, "Threads with fewer turns are tiny: written as one chunk without a breakpoint request, so they get one summary and a passthrough rollup (0 disables)")
+	fs.IntVar(&cfg.MinMessages, "min-messages", cfg.MinMessages, "Threads with fewer messages are tiny, like -min-turns (0 disables)")
+	fs.IntVar(&cfg.MaxTinyTokens, "max-tiny-tokens", cfg.MaxTinyTokens, "Threads estimated at more message tokens are never tiny and are chunked normally (0 disables)")
+	fs.IntVar(&cfg.FlagShortTurns, "flag-short-turns", cfg.FlagShortTurns, "Flag chunks of at most this many turns (in threads of several chunks) in "+migration.SegmentationReportFileName+" (0 disables)")
+	fs.IntVar(&cfg.FlagLongTurns, "flag-long-turns", cfg.FlagLongTurns, "Flag chunks of at least this many turns in "+migration.SegmentationReportFileName+" (0 disables)")
+	fs.StringVar(&cfg.DropMessages, "drop-messages", "", "Comma-separated role[/content_type] entries (* for any role) whose messages are left out of chunks, e.g. tool,assistant/thoughts (user messages are always kept)")
+	fs.StringVar(&cfg.CompressMessages, "compress-messages", "", "Comma-separated role[/content_type] entries whose message text is cut to -compress-chars in chunks, e.g. tool/execution_output")
+	fs.IntVar(&cfg.CompressChars, "compress-chars", cfg.CompressChars, "Characters of text a -compress-messages message keeps")
+	fs.BoolVar(&cfg.BreakpointCache, "breakpoint-cache", cfg.BreakpointCache, "Reuse breakpoint decisions from <out>/"+migration.BreakpointCacheFileName+" for threads whose content and -target-turns are unchanged")
+	fs.Float64Var(&cfg.MaxUSD, "max-usd", cfg.MaxUSD, "Stop starting new threads once estimated spend reaches this many USD (0 disables)")
+	fs.Int64Var(&cfg.MaxTokensTotal, "max-tokens-total", cfg.MaxTokensTotal, "Stop starting new threads once input+output tokens reach this total (0 disables)")
+	fs.StringVar(&cfg.BudgetLedger, "budget-ledger", "", "Optional JSON file to load/save cumulative spend so caps span several runs or stages")
 	fs.StringVar(&cfg.APIKey, "api-key", "", "OpenAI API key (overrides OPENAI_API_KEY env var)")
-
-	fs.Usage = func() {
-		fmt.Fprintf(fs.Output(), "Usage:\n  %s [flags]\n\nFlags:\n", filepath.Base(os.Args[0]))
-		fs.PrintDefaults()
-		fmt.Fprintln(fs.Output(), "\nExample:")
-		fmt.Fprintln(fs.Output(), "  go run ./cmd/thread-chunker -in docs/peanut-gallery/threads/<thread>.json -overwrite -pretty")
-	}
+	fs.StringVar(&cfg.StructuredOutput, "structured-output", provider.StructuredJSONSchema, "How schema-constrained output is requested: json-schema (response format) or tool (a required function call, for models without json_schema support)")
+	fs.Float64Var(&cfg.QPS, "qps", cfg.QPS, "Max model requests started per second, retries included (0 disables)")
+	fs.StringVar(&cfg.Durability, "durability", cfg.Durability, "fsync policy for output files: none, group (sync in batches), or full (sync every file)")
+	fs.StringVar(&cfg.AtomicWrite, "atomic-write", fileutils.AtomicRename, "How finished files replace their targets: rename (atomic), staged (temp files in TMPDIR, kept out of synced folders), or copy (written in place, for shares that refuse rename)")
+	fs.BoolVar(&cfg.CanonicalJSON, "canonical-json", cfg.CanonicalJSON, "Write JSON outputs with sorted keys and stable number formatting so regenerated files diff cleanly")
+	fs.IntVar(&cfg.MaxFilesPerDir, "max-files-per-dir", fileutils.DefaultMaxFilesPerDir, "Stop with an error before any output directory holds more than N files (0 disables)")
+	fs.Int64Var(&cfg.MaxOutputBytes, "max-output-bytes", 0, "Stop with an error before this run writes more than N bytes (0 disables)")
+	fs.StringVar(&cfg.Chaos, "chaos", "", "Inject provider failures for testing, e.g. rate-limit=0.1,server-error=0.05,truncate=0.05,garbage=0.05 (plus seed=N, max=N)")
 
 	if err := fs.Parse(args); err != nil {
 		return Config{}, err
 	}
 	cfg.InputPath = filepath.Clean(cfg.InputPath)
 	cfg.OutputDir = filepath.Clean(cfg.OutputDir)
+	if cfg.BudgetLedger != "" {
+		cfg.BudgetLedger = filepath.Clean(cfg.BudgetLedger)
+	}
 	return cfg, nil
 }
 
@@ -144,7 +306,7 @@ func collectInputFiles(inputPath string) ([]string, error) {
 			continue
 		}
 		name := e.Name()
-		if strings.ToLower(filepath.Ext(name)) != ".json" {
+		if strings.ToLower(filepath.Ext(name)) != ".json" || migration.IsBookkeepingFile(name) {
 			continue
 		}
 		info, err := e.Info()
@@ -174,6 +336,8 @@ func sortStrings(s []string) {
 type openAIBreakpointDecider struct {
 	client *openai.Client
 	model  string
+	budget *provider.Budget
+	text   textBudget
 }
 
 type breakpointRequest struct {
@@ -205,7 +369,7 @@ func (d openAIBreakpointDecider) DecideBreakpoints(ctx context.Context, thread m
 		return nil, errors.New("openAIBreakpointDecider: model is empty")
 	}
 
-	payload, err := buildBreakpointRequestPayload(thread, turns, targetTurnsPerChunk)
+	payload, err := buildBreakpointRequestPayload(thread, turns, targetTurnsPerChunk, d.text)
 	if err != nil {
 		return nil, err
 	}
@@ -241,6 +405,7 @@ func (d openAIBreakpointDecider) DecideBreakpoints(ctx context.Context, thread m
 	if err != nil {
 		return nil, err
 	}
+	d.budget.Record(d.model, resp.Usage)
 
 	var out breakpointResponse
 	if err := fileutils.DecodeModelJSON(resp.OutputText(), &out); err != nil {
@@ -251,25 +416,68 @@ func (d openAIBreakpointDecider) DecideBreakpoints(ctx context.Context, thread m
 	return out.Breakpoints, nil
 }
 
-func buildBreakpointRequestPayload(thread migration.SimplifiedConversation, turns []migration.Turn, targetTurnsPerChunk int) ([]byte, error) {
-	// First attempt: include light text snippets.
-	payload, err := json.Marshal(buildBreakpointRequest(thread, turns, targetTurnsPerChunk, true))
-	if err != nil {
-		return nil, err
+// textBudget bounds how much turn text a breakpoint request carries.
+type textBudget struct {
+	// MaxRequestBytes caps the encoded request (0: no cap); a tier that exceeds it falls through to the
+	// next.
+	MaxRequestBytes int
+	// FullTextMaxTurns is the longest thread (in turns) sent with full-length snippets.
+	FullTextMaxTurns int
+
+	UserChars      int
+	AssistantChars int
+
+	// ShortUserChars/ShortAssistantChars size the middle tier tried before dropping text entirely
+	// (both 0 disables it).
+	ShortUserChars      int
+	ShortAssistantChars int
+}
+
+func (c Config) textBudget() textBudget {
+	return textBudget{
+		MaxRequestBytes:     c.RequestMaxBytes,
+		FullTextMaxTurns:    c.FullTextMaxTurns,
+		UserChars:           c.UserSnippetChars,
+		AssistantChars:      c.AssistantSnippetChars,
+		ShortUserChars:      c.ShortUserSnippetChars,
+		ShortAssistantChars: c.ShortAssistantSnippetChars,
+	}
+}
+
+func buildBreakpointRequestPayload(thread migration.SimplifiedConversation, turns []migration.Turn, targetTurnsPerChunk int, budget textBudget) ([]byte, error) {
+	fits := func(payload []byte) bool {
+		return budget.MaxRequestBytes == 0 || len(payload) <= budget.MaxRequestBytes
 	}
 
-	// If the thread is huge, the request itself can exceed context limits. In that case, drop text entirely
-	// (omitempty will remove user/assistant) and rely on structure-only segmentation.
-	const maxRequestBytes = 250_000
-	const maxTurnsWithText = 250
-	if len(payload) > maxRequestBytes || len(turns) > maxTurnsWithText {
-		return json.Marshal(buildBreakpointRequest(thread, turns, targetTurnsPerChunk, false))
+	// First attempt: full-length snippets, unless the thread is too long for them.
+	if len(turns) <= budget.FullTextMaxTurns {
+		payload, err := json.Marshal(buildBreakpointRequest(thread, turns, targetTurnsPerChunk, budget.UserChars, budget.AssistantChars))
+		if err != nil {
+			return nil, err
+		}
+		if fits(payload) {
+			return payload, nil
+		}
+	}
+
+	// Huge threads: short snippets still give the model topic cues at each turn, which segments far
+	// better than structure alone.
+	if budget.ShortUserChars > 0 || budget.ShortAssistantChars > 0 {
+		payload, err := json.Marshal(buildBreakpointRequest(thread, turns, targetTurnsPerChunk, budget.ShortUserChars, budget.ShortAssistantChars))
+		if err != nil {
+			return nil, err
+		}
+		if fits(payload) {
+			return payload, nil
+		}
 	}
 
-	return payload, nil
+	// The request itself can exceed context limits. In that case, drop text entirely (omitempty will
+	// remove user/assistant) and rely on structure-only segmentation.
+	return json.Marshal(buildBreakpointRequest(thread, turns, targetTurnsPerChunk, 0, 0))
 }
 
-func buildBreakpointRequest(thread migration.SimplifiedConversation, turns []migration.Turn, targetTurnsPerChunk int, includeText bool) breakpointRequest {
+func buildBreakpointRequest(thread migration.SimplifiedConversation, turns []migration.Turn, targetTurnsPerChunk int, userChars, assistantChars int) breakpointRequest {
 	req := breakpointRequest{
 		ConversationID:      thread.ConversationID,
 		Title:               thread.Title,
@@ -283,9 +491,11 @@ func buildBreakpointRequest(thread migration.SimplifiedConversation, turns []mig
 			Turn:      t.TurnIndex,
 			StartTime: t.StartTime,
 		}
-		if includeText {
-			td.User = fileutils.Truncate(t.UserText, 400)
-			td.Assistant = fileutils.Truncate(t.AssistantText, 600)
+		if userChars > 0 {
+			td.User = fileutils.Truncate(t.UserText, userChars)
+		}
+		if assistantChars > 0 {
+			td.Assistant = fileutils.Truncate(t.AssistantText, assistantChars)
 		}
 		req.Turns = append(req.Turns, td)
 	}
@@ -302,3 +512,35 @@ func fallbackBreakpoints(totalTurns int, targetTurnsPerChunk int) []int {
 	}
 	return bps
 }
+
+// appendSegmentedThread adds the chunks in threadSubdir to the segmentation report's threads.
+func appendSegmentedThread(threads []migration.SegmentedThread, threadSubdir string) ([]migration.SegmentedThread, error) {
+	st, err := migration.ReadSegmentedThread(threadSubdir)
+	if err != nil || len(st.Chunks) == 0 {
+		return threads, err
+	}
+	return append(threads, st), nil
+}
+
+// resumeThread reports whether threadSubdir already holds a complete chunking of inFile. Otherwise any
+// chunk files a crashed run left behind are removed, since a fresh breakpoint decision may produce fewer
+// chunks and stale higher-numbered files would be summarized as part of the thread.
+func resumeThread(inFile, threadSubdir string) (bool, error) {
+	done, err := migration.ThreadChunked(inFile, threadSubdir)
+	if err != nil || done {
+		return done, err
+	}
+	stale, err := migration.ChunkFiles(threadSubdir)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range stale {
+		if err := os.Remove(p); err != nil {
+			return false, err
+		}
+	}
+	if len(stale) > 0 {
+		fmt.Fprintf(os.Stderr, "resume thread-chunker: rechunking %s (%d incomplete chunk files removed)\n", filepath.Base(inFile), len(stale))
+	}
+	return false, nil
+}
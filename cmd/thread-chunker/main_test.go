@@ -1,10 +1,14 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
 )
 
 func TestParseFlags_Overrides(t *testing.T) {
@@ -19,6 +23,7 @@ func TestParseFlags_Overrides(t *testing.T) {
 		"-pretty",
 		"-overwrite",
 		"-api-key", "k",
+		"-breakpoint-cache=false",
 	})
 	if err != nil {
 		t.Fatalf("parseFlags: %v", err)
@@ -41,6 +46,13 @@ func TestParseFlags_Overrides(t *testing.T) {
 	if cfg.APIKey != "k" {
 		t.Fatalf("APIKey=%q", cfg.APIKey)
 	}
+	if cfg.BreakpointCache || !defaultConfig().BreakpointCache {
+		t.Fatalf("BreakpointCache=%v", cfg.BreakpointCache)
+	}
+	// Tiny-thread handling is opt-in, so default runs chunk every thread as before.
+	if d := defaultConfig(); d.MinTurns != 0 || d.MinMessages != 0 {
+		t.Fatalf("default MinTurns=%d MinMessages=%d, want 0", d.MinTurns, d.MinMessages)
+	}
 }
 
 func TestConfig_Validate(t *testing.T) {
@@ -52,6 +64,18 @@ func TestConfig_Validate(t *testing.T) {
 	if err := (Config{InputPath: "in.json", OutputDir: "out", Model: "m", TargetTurns: 20}).Validate(); err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
+	if err := (Config{InputPath: "in.json", OutputDir: "out", Model: "m", TargetTurns: 20, MinChunkTurns: 30, MaxChunkTurns: 10}).Validate(); err == nil {
+		t.Fatalf("expected error for min-chunk-turns > max-chunk-turns")
+	}
+	if err := (Config{InputPath: "in.json", OutputDir: "out", Model: "m", TargetTurns: 20, MaxChunks: -1}).Validate(); err == nil {
+		t.Fatalf("expected error for negative max-chunks")
+	}
+	if err := (Config{InputPath: "in.json", OutputDir: "out", Model: "m", TargetTurns: 20, DropMessages: "tool,user"}).Validate(); err == nil {
+		t.Fatalf("expected error for dropping user messages")
+	}
+	if err := (Config{InputPath: "in.json", OutputDir: "out", Model: "m", TargetTurns: 20, CompressMessages: "tool/"}).Validate(); err == nil {
+		t.Fatalf("expected error for an empty content type")
+	}
 }
 
 func TestCollectInputFiles_File(t *testing.T) {
@@ -94,6 +118,11 @@ func TestCollectInputFiles_Directory_SortedAndSkipsNonJSONAndChunksDir(t *testin
 	if err := os.WriteFile(filepath.Join(dir, "chunks", "c.json"), []byte(`{}`), 0o644); err != nil {
 		t.Fatalf("write chunks/c.json: %v", err)
 	}
+	for _, name := range []string{"run_report.json", "spend_ledger.json"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(`{}`), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
 
 	files, err := collectInputFiles(dir)
 	if err != nil {
@@ -106,3 +135,95 @@ func TestCollectInputFiles_Directory_SortedAndSkipsNonJSONAndChunksDir(t *testin
 		t.Fatalf("files=%v, want [a.json b.json] sorted", files)
 	}
 }
+
+func TestResumeThread_RemovesIncompleteChunks(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	inFile := filepath.Join(dir, "t.json")
+	thread := migration.SimplifiedConversation{
+		ConversationID: "c1",
+		Messages: []migration.SimplifiedMessage{
+			{Role: "user", Text: "u1"},
+			{Role: "user", Text: "u2"},
+		},
+	}
+	write := func(path string, v any) {
+		t.Helper()
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	write(inFile, thread)
+	sub := filepath.Join(dir, "chunks", "t")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	first := filepath.Join(sub, "thread_1.json")
+	write(first, migration.Chunk{ConversationID: "c1", ChunkNumber: 1, TurnStart: 0, TurnEnd: 1})
+
+	done, err := resumeThread(inFile, sub)
+	if err != nil || done {
+		t.Fatalf("partial: done=%v err=%v", done, err)
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Fatalf("stale chunk not removed: %v", err)
+	}
+
+	write(first, migration.Chunk{ConversationID: "c1", ChunkNumber: 1, TurnStart: 0, TurnEnd: 2})
+	done, err = resumeThread(inFile, sub)
+	if err != nil || !done {
+		t.Fatalf("complete: done=%v err=%v", done, err)
+	}
+}
+
+func TestBuildBreakpointRequestPayload_Tiers(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("x", 1000)
+	turns := make([]migration.Turn, 50)
+	for i := range turns {
+		turns[i] = migration.Turn{TurnIndex: i, UserText: long, AssistantText: long}
+	}
+	decode := func(budget textBudget) breakpointRequest {
+		t.Helper()
+		b, err := buildBreakpointRequestPayload(migration.SimplifiedConversation{ConversationID: "c"}, turns, 20, budget)
+		if err != nil {
+			t.Fatalf("payload: %v", err)
+		}
+		var req breakpointRequest
+		if err := json.Unmarshal(b, &req); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		return req
+	}
+
+	budget := defaultConfig().textBudget()
+	if req := decode(budget); req.Turns[0].User != long[:400]+"…" || req.Turns[0].Assistant != long[:600]+"…" {
+		t.Fatalf("full tier: user=%d assistant=%d", len(req.Turns[0].User), len(req.Turns[0].Assistant))
+	}
+
+	// Too many turns for full snippets: the short tier keeps some text.
+	budget.FullTextMaxTurns = 10
+	if req := decode(budget); req.Turns[0].User != long[:80]+"…" || req.Turns[0].Assistant != long[:120]+"…" {
+		t.Fatalf("short tier: user=%d assistant=%d", len(req.Turns[0].User), len(req.Turns[0].Assistant))
+	}
+
+	// Even short snippets exceed the byte cap: structure only.
+	budget.MaxRequestBytes = 5_000
+	if req := decode(budget); req.Turns[0].User != "" || req.Turns[0].Assistant != "" || len(req.Turns) != 50 {
+		t.Fatalf("structure tier: %+v", req.Turns[0])
+	}
+
+	// Disabling the short tier goes straight to structure only.
+	budget = defaultConfig().textBudget()
+	budget.FullTextMaxTurns = 10
+	budget.ShortUserChars, budget.ShortAssistantChars = 0, 0
+	if req := decode(budget); req.Turns[0].User != "" {
+		t.Fatalf("short tier disabled: %+v", req.Turns[0])
+	}
+}
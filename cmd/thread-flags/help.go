@@ -0,0 +1,24 @@
+package main
+
+import (
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
+)
+
+var help = cli.Help{
+	Name:    "thread-flags",
+	Summary: "label sensitive or private threads so they can be kept out of shared outputs",
+	Groups: []cli.Group{
+		{Title: "Input and output", Flags: []string{"in", "sentiment", "out", "resume", "list", "durability", "atomic-write", "canonical-json", "max-files-per-dir", "max-output-bytes"}},
+		{Title: "Model", Flags: []string{"model", "output-language", "min-confidence", "max-output-tokens", "api-key", "structured-output"}},
+		{Title: "Throughput", Flags: []string{"concurrency"}},
+		{Title: "Spend caps", Flags: []string{"max-usd", "max-tokens-total", "budget-ledger"}},
+		{Title: "Testing", Flags: []string{"chaos"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "flag every thread rollup", Command: "thread-flags -in docs/peanut-gallery/threads/thread_summaries"},
+		{Comment: "show what was flagged", Command: "thread-flags -list"},
+	},
+	Values: map[string][]string{"durability": fileutils.DurabilityModes, "atomic-write": fileutils.AtomicWriteModes, "structured-output": provider.StructuredOutputModes},
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/responses"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
+)
+
+func main() {
+	cfg, err := parseFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := layout.LoadConventionsFromEnv(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetDurability(cfg.Durability); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetAtomicWrite(cfg.AtomicWrite); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	fileutils.SetCanonicalJSON(cfg.CanonicalJSON)
+	if err := fileutils.SetQuota(fileutils.Quota{MaxFilesPerDir: cfg.MaxFilesPerDir, MaxBytes: cfg.MaxOutputBytes}); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := provider.SetStructuredOutput(cfg.StructuredOutput); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	existing, err := migration.LoadThreadFlags(cfg.OutPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if cfg.List {
+		if err := writeFlagged(os.Stdout, migration.FlaggedThreads(existing)); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	apiKey := cfg.APIKey
+	if apiKey == "" {
+		apiKey = os.Getenv("OPENAI_API_KEY")
+	}
+	if apiKey == "" {
+		fmt.Fprintln(os.Stderr, "missing OPENAI_API_KEY (or pass -api-key)")
+		os.Exit(2)
+	}
+
+	paths, err := collectRollups(cfg.InPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if len(paths) == 0 {
+		fmt.Fprintf(os.Stderr, "no *%s files found\n", layout.Suffix(layout.ThreadSummary))
+	}
+
+	budget, err := provider.NewBudget(cfg.MaxUSD, cfg.MaxTokensTotal, cfg.BudgetLedger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	chaos, _ := provider.ParseChaos(cfg.Chaos)
+	client := provider.NewClient(apiKey, chaos)
+	flagger := openAIFlagger{client: &client, model: cfg.Model, maxOutputTokens: int64(cfg.MaxOutputTokens), language: cfg.OutputLanguage, budget: budget}
+	stats, err := flagThreads(ctx, cfg, paths, existing, flagger, budget.Exceeded)
+	if saveErr := budget.Save(); err == nil {
+		err = saveErr
+	}
+	if chaos != nil {
+		fmt.Fprintf(os.Stderr, "chaos thread-flags: injected %s\n", chaos)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	spend := budget.Spend()
+	fmt.Fprintf(os.Stdout, "threads_checked=%d threads_flagged=%d skipped=%d tokens_total=%d estimated_usd=%.4f out=%s\n",
+		stats.Checked, stats.Flagged, stats.Skipped, spend.TotalTokens(), spend.USD, cfg.OutPath)
+	if stats.BudgetExhausted {
+		fmt.Fprintf(os.Stderr, "budget exhausted: stopped after %d threads (tokens_total=%d estimated_usd=%.4f); rerun to continue\n", stats.Checked, spend.TotalTokens(), spend.USD)
+		os.Exit(provider.ExitBudgetExhausted)
+	}
+}
+
+// flagger labels one thread's rollup text.
+type flagger interface {
+	Flag(ctx context.Context, input string) ([]migration.ContentFlag, error)
+}
+
+type flagStats struct {
+	Checked, Flagged, Skipped int
+	BudgetExhausted           bool
+}
+
+// flagResult is one thread's outcome; row is nil when the thread was skipped.
+type flagResult struct {
+	row *migration.ThreadFlags
+}
+
+// flagThreads flags each rollup in paths and appends a row per checked thread to cfg.OutPath, then
+// compacts the file to one row per thread. With cfg.Resume, threads whose rollup text is unchanged
+// since their last row are skipped. exceeded stops new model calls once a spend cap is hit.
+func flagThreads(ctx context.Context, cfg Config, paths []string, existing map[string]migration.ThreadFlags, f flagger, exceeded func() bool) (flagStats, error) {
+	var stats flagStats
+	w, err := fileutils.AppendJSONL(cfg.OutPath)
+	if err != nil {
+		return stats, fmt.Errorf("open flags: %w", err)
+	}
+	defer w.Close()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	err = fileutils.ParallelOrdered(paths, cfg.Concurrency, func(p string) (flagResult, error) {
+		if err := ctx.Err(); err != nil {
+			return flagResult{}, err
+		}
+		var ts migration.ThreadSummary
+		if err := fileutils.ReadArtifact(p, &ts); err != nil {
+			return flagResult{}, fmt.Errorf("read thread summary %s: %w", p, err)
+		}
+		if ts.ConversationID == "" {
+			return flagResult{}, nil
+		}
+		var sentiment *migration.ThreadSentimentSummary
+		if cfg.SentimentDir != "" {
+			sentPath := layout.Find(filepath.Join(cfg.SentimentDir, ts.ConversationID), layout.ThreadSentiment)
+			var ss migration.ThreadSentimentSummary
+			if err := fileutils.ReadArtifact(sentPath, &ss); err == nil {
+				sentiment = &ss
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return flagResult{}, fmt.Errorf("read thread sentiment summary %s: %w", sentPath, err)
+			}
+		}
+		text := migration.FlagSourceText(ts, sentiment)
+		hash := migration.FlagSourceHash(text)
+		if prev, ok := existing[ts.ConversationID]; cfg.Resume && ok && prev.SourceSHA256 == hash {
+			return flagResult{}, nil
+		}
+		if exceeded() {
+			return flagResult{}, errBudget
+		}
+		flags, err := f.Flag(ctx, text)
+		if err != nil {
+			return flagResult{}, fmt.Errorf("flag %s: %w", ts.ConversationID, err)
+		}
+		return flagResult{row: &migration.ThreadFlags{
+			ConversationID:    ts.ConversationID,
+			Title:             ts.Title,
+			Project:           ts.Project,
+			ThreadStart:       ts.ThreadStart,
+			Flags:             migration.NormalizeContentFlags(flags, cfg.MinConfidence),
+			ThreadSummaryPath: p,
+			SourceSHA256:      hash,
+			Model:             cfg.Model,
+			FlaggedAt:         now,
+		}}, nil
+	}, func(r flagResult) error {
+		if r.row == nil {
+			stats.Skipped++
+			return nil
+		}
+		stats.Checked++
+		if len(r.row.Flags) > 0 {
+			stats.Flagged++
+		}
+		return w.Write(r.row)
+	})
+	if errors.Is(err, errBudget) {
+		stats.BudgetExhausted, err = true, nil
+	}
+	if err != nil {
+		return stats, err
+	}
+	if err := w.Close(); err != nil {
+		return stats, fmt.Errorf("write flags: %w", err)
+	}
+	if _, err := fileutils.CompactJSONL(cfg.OutPath, fileutils.JSONLFieldKey("conversation_id", "")); err != nil {
+		return stats, fmt.Errorf("compact flags: %w", err)
+	}
+	return stats, nil
+}
+
+// errBudget stops flagThreads once the spend cap is reached; rows already written are kept.
+var errBudget = errors.New("budget exhausted")
+
+func collectRollups(inPath string) ([]string, error) {
+	fi, err := os.Stat(inPath)
+	if err != nil {
+		return nil, fmt.Errorf("stat -in: %w", err)
+	}
+	if !fi.IsDir() {
+		return nil, errors.New("-in must be a directory")
+	}
+	files, err := migration.ArtifactPaths(fileutils.OS, inPath, layout.ThreadSummary)
+	if err != nil {
+		return nil, fmt.Errorf("thread summaries: %w", err)
+	}
+	return files, nil
+}
+
+// writeFlagged prints one line per flagged thread for review.
+func writeFlagged(w io.Writer, rows []migration.ThreadFlags) error {
+	for _, r := range rows {
+		labels := make([]string, 0, len(r.Flags))
+		for _, f := range r.Flags {
+			s := fmt.Sprintf("%s %.2f", f.Label, f.Confidence)
+			if f.Note != "" {
+				s += " (" + f.Note + ")"
+			}
+			labels = append(labels, s)
+		}
+		title := r.Title
+		if title == "" {
+			title = "(untitled)"
+		}
+		if _, err := fmt.Fprintf(w, "%s  %s: %s\n", r.ConversationID, title, strings.Join(labels, "; ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type flagResponse struct {
+	Flags []migration.ContentFlag `json:"flags"`
+}
+
+type openAIFlagger struct {
+	client          *openai.Client
+	model           string
+	maxOutputTokens int64
+	budget          *provider.Budget
+	// language is -output-language.
+	language string
+}
+
+var flagSchema = provider.GenerateSchema[flagResponse]()
+
+func (f openAIFlagger) Flag(ctx context.Context, input string) ([]migration.ContentFlag, error) {
+	params := responses.ResponseNewParams{
+		Model:           f.model,
+		MaxOutputTokens: openai.Int(f.maxOutputTokens),
+		Instructions:    openai.String(migration.LanguageInstructions(flagPrompt, f.language)),
+		Input: responses.ResponseNewParamsInputUnion{
+			OfInputItemList: []responses.ResponseInputItemUnionParam{
+				responses.ResponseInputItemParamOfMessage(input, responses.EasyInputMessageRoleUser),
+			},
+		},
+		Text: responses.ResponseTextConfigParam{
+			Format: responses.ResponseFormatTextConfigUnionParam{
+				OfJSONSchema: &responses.ResponseFormatTextJSONSchemaConfigParam{
+					Name:        "ThreadContentFlags",
+					Schema:      flagSchema,
+					Strict:      openai.Bool(true),
+					Description: openai.String("Coarse sensitive-content labels for one thread"),
+					Type:        "json_schema",
+				},
+			},
+		},
+	}
+	resp, err := provider.CallWithRetry(ctx, f.client, params)
+	if err != nil {
+		return nil, err
+	}
+	if f.budget != nil {
+		f.budget.Record(f.model, resp.Usage)
+	}
+	var out flagResponse
+	if err := fileutils.DecodeModelJSON(resp.OutputText(), &out); err != nil {
+		return nil, fmt.Errorf("unmarshal flags: %w (model_output_prefix=%q)", err, fileutils.Truncate(resp.OutputText(), 500))
+	}
+	return out.Flags, nil
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
+	cfg := defaultConfig()
+	fs.SetOutput(os.Stderr)
+	cli.Setup(fs, help)
+	fs.StringVar(&cfg.InPath, "in", cfg.InPath, "Directory of thread rollups (*.thread.summary.json, recursively)")
+	fs.StringVar(&cfg.SentimentDir, "sentiment", cfg.SentimentDir, "Directory of thread sentiment rollups whose emotional summaries are included (empty disables)")
+	fs.StringVar(&cfg.OutPath, "out", cfg.OutPath, "Flags JSONL file (one row per checked thread; never packed into shards)")
+	fs.StringVar(&cfg.Model, "model", cfg.Model, "OpenAI model that labels threads")
+	fs.StringVar(&cfg.OutputLanguage, "output-language", "", "Language to write the flag notes in, e.g. German")
+	fs.Float64Var(&cfg.MinConfidence, "min-confidence", cfg.MinConfidence, "Drop labels the model is less confident about than this (0-1)")
+	fs.BoolVar(&cfg.Resume, "resume", cfg.Resume, "Skip threads whose rollup text is unchanged since they were last flagged")
+	fs.BoolVar(&cfg.List, "list", false, "Print the flagged threads from -out, most confident first, and exit (no API calls)")
+	fs.IntVar(&cfg.Concurrency, "concurrency", cfg.Concurrency, "Max concurrent model calls")
+	fs.IntVar(&cfg.MaxOutputTokens, "max-output-tokens", cfg.MaxOutputTokens, "Max output tokens per thread")
+	fs.Float64Var(&cfg.MaxUSD, "max-usd", cfg.MaxUSD, "Stop starting new threads once estimated spend reaches this many USD (0 disables)")
+	fs.Int64Var(&cfg.MaxTokensTotal, "max-tokens-total", cfg.MaxTokensTotal, "Stop starting new threads once input+output tokens reach this total (0 disables)")
+	fs.StringVar(&cfg.BudgetLedger, "budget-ledger", "", "Optional JSON file to load/save cumulative spend so caps span several runs or stages")
+	fs.StringVar(&cfg.APIKey, "api-key", "", "OpenAI API key (overrides OPENAI_API_KEY env var)")
+	fs.StringVar(&cfg.StructuredOutput, "structured-output", provider.StructuredJSONSchema, "How schema-constrained output is requested: json-schema (response format) or tool (a required function call, for models without json_schema support)")
+	fs.StringVar(&cfg.Durability, "durability", cfg.Durability, "fsync policy for output files: none, group (sync in batches), or full (sync every file)")
+	fs.StringVar(&cfg.AtomicWrite, "atomic-write", fileutils.AtomicRename, "How finished files replace their targets: rename (atomic), staged (temp files in TMPDIR, kept out of synced folders), or copy (written in place, for shares that refuse rename)")
+	fs.BoolVar(&cfg.CanonicalJSON, "canonical-json", cfg.CanonicalJSON, "Write JSON outputs with sorted keys and stable number formatting so regenerated files diff cleanly")
+	fs.IntVar(&cfg.MaxFilesPerDir, "max-files-per-dir", fileutils.DefaultMaxFilesPerDir, "Stop with an error before any output directory holds more than N files (0 disables)")
+	fs.Int64Var(&cfg.MaxOutputBytes, "max-output-bytes", 0, "Stop with an error before this run writes more than N bytes (0 disables)")
+	fs.StringVar(&cfg.Chaos, "chaos", "", "Inject provider failures for testing, e.g. rate-limit=0.1,server-error=0.05,truncate=0.05,garbage=0.05 (plus seed=N, max=N)")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	cfg.InPath = filepath.Clean(cfg.InPath)
+	cfg.OutPath = filepath.Clean(cfg.OutPath)
+	if cfg.SentimentDir != "" {
+		cfg.SentimentDir = filepath.Clean(cfg.SentimentDir)
+	}
+	return cfg, nil
+}
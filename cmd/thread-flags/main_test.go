@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+type fakeFlagger struct {
+	calls atomic.Int32
+}
+
+func (f *fakeFlagger) Flag(_ context.Context, input string) ([]migration.ContentFlag, error) {
+	f.calls.Add(1)
+	if strings.Contains(input, "hospital") {
+		return []migration.ContentFlag{{Label: "health", Confidence: 0.8, Note: "hospital stay"}, {Label: "crisis", Confidence: 0.2}}, nil
+	}
+	return nil, nil
+}
+
+func TestParseFlags_DefaultsAndValidate(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("thread-flags", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-out", "x/../flags.jsonl", "-min-confidence", "0.7"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if cfg.OutPath != "flags.jsonl" || cfg.MinConfidence != 0.7 || !cfg.Resume {
+		t.Fatalf("cfg=%+v", cfg)
+	}
+	cfg.MinConfidence = 1.5
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for min-confidence > 1")
+	}
+}
+
+func TestFlagThreads_WritesRowsAndResumes(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	in := filepath.Join(dir, "thread_summaries")
+	write := func(ts migration.ThreadSummary) {
+		if err := fileutils.WriteArtifactAtomic(filepath.Join(in, ts.ConversationID+".thread.summary.json"), ts, false); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	write(migration.ThreadSummary{ConversationID: "a", Title: "Surgery", Summary: "A hospital stay after surgery."})
+	write(migration.ThreadSummary{ConversationID: "b", Title: "Sourdough", Summary: "Baking bread."})
+
+	cfg := defaultConfig()
+	cfg.InPath, cfg.SentimentDir, cfg.OutPath = in, "", filepath.Join(dir, migration.ContentFlagsFileName)
+	paths, err := collectRollups(in)
+	if err != nil || len(paths) != 2 {
+		t.Fatalf("collectRollups: %v %v", paths, err)
+	}
+
+	f := &fakeFlagger{}
+	never := func() bool { return false }
+	stats, err := flagThreads(context.Background(), cfg, paths, nil, f, never)
+	if err != nil {
+		t.Fatalf("flagThreads: %v", err)
+	}
+	if stats.Checked != 2 || stats.Flagged != 1 {
+		t.Fatalf("stats=%+v", stats)
+	}
+	rows, err := migration.LoadThreadFlags(cfg.OutPath)
+	if err != nil {
+		t.Fatalf("LoadThreadFlags: %v", err)
+	}
+	if got := rows["a"].Flags; len(got) != 1 || got[0].Label != migration.FlagHealth {
+		t.Fatalf("a flags=%+v", got)
+	}
+	if rows["b"].Flags == nil || len(rows["b"].Flags) != 0 {
+		t.Fatalf("b flags=%#v", rows["b"].Flags)
+	}
+
+	// Unchanged rollups are skipped; a changed one is flagged again and replaces its row.
+	write(migration.ThreadSummary{ConversationID: "b", Title: "Sourdough", Summary: "Baking bread, then a hospital visit for a burn."})
+	stats, err = flagThreads(context.Background(), cfg, paths, rows, f, never)
+	if err != nil {
+		t.Fatalf("flagThreads resume: %v", err)
+	}
+	if stats.Checked != 1 || stats.Skipped != 1 || f.calls.Load() != 3 {
+		t.Fatalf("stats=%+v calls=%d", stats, f.calls.Load())
+	}
+	rows, _ = migration.LoadThreadFlags(cfg.OutPath)
+	if len(rows["b"].Flags) != 1 {
+		t.Fatalf("b flags after resume=%+v", rows["b"].Flags)
+	}
+
+	var buf bytes.Buffer
+	if err := writeFlagged(&buf, migration.FlaggedThreads(rows)); err != nil {
+		t.Fatalf("writeFlagged: %v", err)
+	}
+	if !strings.Contains(buf.String(), "a  Surgery: health 0.80 (hospital stay)") {
+		t.Fatalf("list=%q", buf.String())
+	}
+}
+
+func TestFlagThreads_StopsAtBudget(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ts := migration.ThreadSummary{ConversationID: "a", Summary: "s"}
+	path := filepath.Join(dir, "a.thread.summary.json")
+	if err := fileutils.WriteArtifactAtomic(path, ts, false); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	cfg := defaultConfig()
+	cfg.SentimentDir, cfg.OutPath = "", filepath.Join(dir, migration.ContentFlagsFileName)
+	f := &fakeFlagger{}
+	stats, err := flagThreads(context.Background(), cfg, []string{path}, nil, f, func() bool { return true })
+	if err != nil || !stats.BudgetExhausted || f.calls.Load() != 0 {
+		t.Fatalf("stats=%+v err=%v calls=%d", stats, err, f.calls.Load())
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
+)
+
+type Config struct {
+	InPath         string
+	OutPath        string
+	Model          string
+	OutputLanguage string
+	APIKey         string
+
+	// MaxGap, MinTitleSimilarity, and MaxCandidates pick which thread pairs are put to the model.
+	MaxGap             time.Duration
+	MinTitleSimilarity float64
+	MaxCandidates      int
+
+	// MinConfidence is the confidence the model needs before a pair is recorded as a continuation.
+	MinConfidence float64
+
+	Resume          bool
+	Candidates      bool
+	Concurrency     int
+	MaxOutputTokens int
+	MaxUSD          float64
+	MaxTokensTotal  int64
+	BudgetLedger    string
+	Durability      string
+	AtomicWrite     string
+	// CanonicalJSON writes JSON outputs in canonical form (see fileutils.Canonicalize).
+	CanonicalJSON bool
+
+	// MaxFilesPerDir and MaxOutputBytes set the output quota (see fileutils.Quota).
+	MaxFilesPerDir int
+	MaxOutputBytes int64
+
+	// StructuredOutput is how schema-constrained output is requested (see provider.SetStructuredOutput).
+	StructuredOutput string
+
+	// Chaos is a -chaos spec (see provider.ParseChaos) injecting provider failures; empty disables.
+	Chaos string
+}
+
+func (c Config) Validate() error {
+	if c.InPath == "" {
+		return errors.New("missing -in")
+	}
+	if c.OutPath == "" {
+		return errors.New("missing -out")
+	}
+	if !c.Candidates && c.Model == "" {
+		return errors.New("missing -model")
+	}
+	if c.MaxGap <= 0 {
+		return errors.New("max-gap must be > 0")
+	}
+	if c.MinTitleSimilarity < 0 || c.MinTitleSimilarity > 1 {
+		return errors.New("min-title-similarity must be between 0 and 1")
+	}
+	if c.MaxCandidates < 0 {
+		return errors.New("max-candidates must be >= 0")
+	}
+	if c.MinConfidence < 0 || c.MinConfidence > 1 {
+		return errors.New("min-confidence must be between 0 and 1")
+	}
+	if c.Concurrency < 1 {
+		return errors.New("concurrency must be >= 1")
+	}
+	if c.MaxOutputTokens < 1 {
+		return errors.New("max-output-tokens must be >= 1")
+	}
+	if c.MaxUSD < 0 || c.MaxTokensTotal < 0 {
+		return errors.New("max-usd/max-tokens-total must be >= 0")
+	}
+	if _, err := fileutils.ParseDurability(c.Durability); err != nil {
+		return err
+	}
+	if _, err := fileutils.ParseAtomicWrite(c.AtomicWrite); err != nil {
+		return err
+	}
+	if _, err := provider.ParseStructuredOutput(c.StructuredOutput); err != nil {
+		return err
+	}
+	if _, err := provider.ParseChaos(c.Chaos); err != nil {
+		return err
+	}
+	return nil
+}
+
+func defaultConfig() Config {
+	return Config{
+		InPath:             filepath.FromSlash("docs/peanut-gallery/threads/thread_summaries"),
+		OutPath:            filepath.Join(filepath.FromSlash("docs/peanut-gallery/threads"), migration.ThreadLinksFileName),
+		Model:              "gpt-5-mini",
+		MaxGap:             14 * 24 * time.Hour,
+		MinTitleSimilarity: 0.3,
+		MaxCandidates:      3,
+		MinConfidence:      0.6,
+		Resume:             true,
+		Concurrency:        4,
+		MaxOutputTokens:    600,
+		Durability:         fileutils.DurabilityFull,
+	}
+}
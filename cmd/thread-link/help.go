@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
+)
+
+var help = cli.Help{
+	Name:    "thread-link",
+	Summary: "find threads that continue an earlier thread",
+	Groups: []cli.Group{
+		{Title: "Input and output", Flags: []string{"in", "out", "resume", "candidates", "durability", "atomic-write", "canonical-json", "max-files-per-dir", "max-output-bytes"}},
+		{Title: "Candidates", Flags: []string{"max-gap", "min-title-similarity", "max-candidates"}},
+		{Title: "Model", Flags: []string{"model", "output-language", "min-confidence", "max-output-tokens", "api-key", "structured-output"}},
+		{Title: "Throughput", Flags: []string{"concurrency"}},
+		{Title: "Spend caps", Flags: []string{"max-usd", "max-tokens-total", "budget-ledger"}},
+		{Title: "Testing", Flags: []string{"chaos"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "preview the pairs that would be checked", Command: "thread-link -candidates"},
+		{Comment: "link threads up to two weeks apart, then roll them up as sagas", Command: "thread-link -max-gap 14d\n  thread-rollup -links docs/peanut-gallery/threads/thread_links.jsonl -saga-out docs/peanut-gallery/threads/sagas"},
+	},
+	Values: map[string][]string{"durability": fileutils.DurabilityModes, "atomic-write": fileutils.AtomicWriteModes, "structured-output": provider.StructuredOutputModes},
+}
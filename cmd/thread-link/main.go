@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/responses"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
+)
+
+func main() {
+	cfg, err := parseFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := layout.LoadConventionsFromEnv(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetDurability(cfg.Durability); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := fileutils.SetAtomicWrite(cfg.AtomicWrite); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	fileutils.SetCanonicalJSON(cfg.CanonicalJSON)
+	if err := fileutils.SetQuota(fileutils.Quota{MaxFilesPerDir: cfg.MaxFilesPerDir, MaxBytes: cfg.MaxOutputBytes}); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := provider.SetStructuredOutput(cfg.StructuredOutput); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	paths, err := collectRollups(cfg.InPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	threads, err := readRollups(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	candidates := migration.LinkCandidates(threads, migration.LinkCandidateOptions{
+		MaxGap:             cfg.MaxGap,
+		MinTitleSimilarity: cfg.MinTitleSimilarity,
+		MaxPerThread:       cfg.MaxCandidates,
+	})
+	if cfg.Candidates {
+		if err := writeCandidates(os.Stdout, candidates); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	apiKey := cfg.APIKey
+	if apiKey == "" {
+		apiKey = os.Getenv("OPENAI_API_KEY")
+	}
+	if apiKey == "" {
+		fmt.Fprintln(os.Stderr, "missing OPENAI_API_KEY (or pass -api-key)")
+		os.Exit(2)
+	}
+
+	existing, err := migration.LoadThreadLinks(cfg.OutPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	budget, err := provider.NewBudget(cfg.MaxUSD, cfg.MaxTokensTotal, cfg.BudgetLedger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	chaos, _ := provider.ParseChaos(cfg.Chaos)
+	client := provider.NewClient(apiKey, chaos)
+	linker := openAILinker{client: &client, model: cfg.Model, maxOutputTokens: int64(cfg.MaxOutputTokens), language: cfg.OutputLanguage, budget: budget}
+	stats, err := linkThreads(ctx, cfg, candidates, existing, linker, budget.Exceeded)
+	if saveErr := budget.Save(); err == nil {
+		err = saveErr
+	}
+	if chaos != nil {
+		fmt.Fprintf(os.Stderr, "chaos thread-link: injected %s\n", chaos)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	links, err := migration.LoadThreadLinks(cfg.OutPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	spend := budget.Spend()
+	fmt.Fprintf(os.Stdout, "threads=%d candidates=%d pairs_checked=%d continuations=%d skipped=%d sagas=%d tokens_total=%d estimated_usd=%.4f out=%s\n",
+		len(threads), len(candidates), stats.Checked, stats.Linked, stats.Skipped, len(migration.Sagas(links)), spend.TotalTokens(), spend.USD, cfg.OutPath)
+	if stats.BudgetExhausted {
+		fmt.Fprintf(os.Stderr, "budget exhausted: stopped after %d pairs (tokens_total=%d estimated_usd=%.4f); rerun to continue\n", stats.Checked, spend.TotalTokens(), spend.USD)
+		os.Exit(provider.ExitBudgetExhausted)
+	}
+}
+
+// linkVerdict is the model's answer for one candidate pair.
+type linkVerdict struct {
+	Continuation bool    `json:"continuation"`
+	Confidence   float64 `json:"confidence"`
+	Reason       string  `json:"reason"`
+}
+
+// linker confirms whether a later thread continues an earlier one.
+type linker interface {
+	Confirm(ctx context.Context, earlier, later string) (linkVerdict, error)
+}
+
+type linkStats struct {
+	Checked, Linked, Skipped int
+	BudgetExhausted          bool
+}
+
+// linkResult is one candidate's outcome; row is nil when the pair was skipped.
+type linkResult struct {
+	row *migration.ThreadLink
+}
+
+// linkThreads asks l about each candidate pair and appends a row per checked pair to cfg.OutPath, then
+// compacts the file to one row per pair. With cfg.Resume, pairs whose rollups are unchanged since their
+// last row are skipped. exceeded stops new model calls once a spend cap is hit.
+func linkThreads(ctx context.Context, cfg Config, candidates []migration.LinkCandidate, existing map[string]migration.ThreadLink, l linker, exceeded func() bool) (linkStats, error) {
+	var stats linkStats
+	w, err := fileutils.AppendJSONL(cfg.OutPath)
+	if err != nil {
+		return stats, fmt.Errorf("open thread links: %w", err)
+	}
+	defer w.Close()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	err = fileutils.ParallelOrdered(candidates, cfg.Concurrency, func(c migration.LinkCandidate) (linkResult, error) {
+		if err := ctx.Err(); err != nil {
+			return linkResult{}, err
+		}
+		id := migration.ThreadLinkID(c.From.ConversationID, c.To.ConversationID)
+		hash := migration.LinkSourceHash(c.From, c.To)
+		if prev, ok := existing[id]; cfg.Resume && ok && prev.SourceSHA256 == hash {
+			return linkResult{}, nil
+		}
+		if exceeded() {
+			return linkResult{}, errBudget
+		}
+		v, err := l.Confirm(ctx, migration.LinkSourceText(c.From), migration.LinkSourceText(c.To))
+		if err != nil {
+			return linkResult{}, fmt.Errorf("confirm %s: %w", id, err)
+		}
+		conf := math.Round(math.Max(0, math.Min(1, v.Confidence))*100) / 100
+		return linkResult{row: &migration.ThreadLink{
+			ID:              id,
+			From:            c.From.ConversationID,
+			To:              c.To.ConversationID,
+			FromTitle:       c.From.Title,
+			ToTitle:         c.To.Title,
+			TitleSimilarity: c.TitleSimilarity,
+			GapHours:        math.Round(c.Gap.Hours()*10) / 10,
+			Continuation:    v.Continuation && conf >= cfg.MinConfidence,
+			Confidence:      conf,
+			Reason:          v.Reason,
+			SourceSHA256:    hash,
+			Model:           cfg.Model,
+			LinkedAt:        now,
+		}}, nil
+	}, func(r linkResult) error {
+		if r.row == nil {
+			stats.Skipped++
+			return nil
+		}
+		stats.Checked++
+		if r.row.Continuation {
+			stats.Linked++
+		}
+		return w.Write(r.row)
+	})
+	if errors.Is(err, errBudget) {
+		stats.BudgetExhausted, err = true, nil
+	}
+	if err != nil {
+		return stats, err
+	}
+	if err := w.Close(); err != nil {
+		return stats, fmt.Errorf("write thread links: %w", err)
+	}
+	if _, err := fileutils.CompactJSONL(cfg.OutPath, fileutils.JSONLFieldKey("id", "")); err != nil {
+		return stats, fmt.Errorf("compact thread links: %w", err)
+	}
+	return stats, nil
+}
+
+// errBudget stops linkThreads once the spend cap is reached; rows already written are kept.
+var errBudget = errors.New("budget exhausted")
+
+func collectRollups(inPath string) ([]string, error) {
+	fi, err := os.Stat(inPath)
+	if err != nil {
+		return nil, fmt.Errorf("stat -in: %w", err)
+	}
+	if !fi.IsDir() {
+		return nil, errors.New("-in must be a directory")
+	}
+	files, err := migration.ArtifactPaths(fileutils.OS, inPath, layout.ThreadSummary)
+	if err != nil {
+		return nil, fmt.Errorf("thread summaries: %w", err)
+	}
+	return files, nil
+}
+
+func readRollups(paths []string) ([]migration.ThreadSummary, error) {
+	out := make([]migration.ThreadSummary, 0, len(paths))
+	for _, p := range paths {
+		var ts migration.ThreadSummary
+		if err := fileutils.ReadArtifact(p, &ts); err != nil {
+			return nil, fmt.Errorf("read thread summary %s: %w", p, err)
+		}
+		if ts.ConversationID != "" {
+			out = append(out, ts)
+		}
+	}
+	return out, nil
+}
+
+// writeCandidates prints one line per candidate pair for review.
+func writeCandidates(w io.Writer, candidates []migration.LinkCandidate) error {
+	for _, c := range candidates {
+		if _, err := fmt.Fprintf(w, "%s -> %s  similarity=%.2f gap=%s  %q -> %q\n",
+			c.From.ConversationID, c.To.ConversationID, c.TitleSimilarity, c.Gap.Round(time.Hour), c.From.Title, c.To.Title); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type openAILinker struct {
+	client          *openai.Client
+	model           string
+	maxOutputTokens int64
+	budget          *provider.Budget
+	// language is -output-language.
+	language string
+}
+
+var linkSchema = provider.GenerateSchema[linkVerdict]()
+
+func (l openAILinker) Confirm(ctx context.Context, earlier, later string) (linkVerdict, error) {
+	input := "EARLIER:\n" + earlier + "\nLATER:\n" + later
+	params := responses.ResponseNewParams{
+		Model:           l.model,
+		MaxOutputTokens: openai.Int(l.maxOutputTokens),
+		Instructions:    openai.String(migration.LanguageInstructions(linkPrompt, l.language)),
+		Input: responses.ResponseNewParamsInputUnion{
+			OfInputItemList: []responses.ResponseInputItemUnionParam{
+				responses.ResponseInputItemParamOfMessage(input, responses.EasyInputMessageRoleUser),
+			},
+		},
+		Text: responses.ResponseTextConfigParam{
+			Format: responses.ResponseFormatTextConfigUnionParam{
+				OfJSONSchema: &responses.ResponseFormatTextJSONSchemaConfigParam{
+					Name:        "ThreadContinuation",
+					Schema:      linkSchema,
+					Strict:      openai.Bool(true),
+					Description: openai.String("Whether a later thread continues an earlier one"),
+					Type:        "json_schema",
+				},
+			},
+		},
+	}
+	resp, err := provider.CallWithRetry(ctx, l.client, params)
+	if err != nil {
+		return linkVerdict{}, err
+	}
+	if l.budget != nil {
+		l.budget.Record(l.model, resp.Usage)
+	}
+	var out linkVerdict
+	if err := fileutils.DecodeModelJSON(resp.OutputText(), &out); err != nil {
+		return linkVerdict{}, fmt.Errorf("unmarshal verdict: %w (model_output_prefix=%q)", err, fileutils.Truncate(resp.OutputText(), 500))
+	}
+	return out, nil
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
+	cfg := defaultConfig()
+	fs.SetOutput(os.Stderr)
+	cli.Setup(fs, help)
+	fs.StringVar(&cfg.InPath, "in", cfg.InPath, "Directory of thread rollups (*.thread.summary.json, recursively)")
+	fs.StringVar(&cfg.OutPath, "out", cfg.OutPath, "Links JSONL file (one row per checked thread pair)")
+	fs.StringVar(&cfg.Model, "model", cfg.Model, "OpenAI model that confirms continuations")
+	fs.StringVar(&cfg.OutputLanguage, "output-language", "", "Language to write the verdict reasons in, e.g. German")
+	fs.Func("max-gap", "Longest time between the earlier thread's last update and the later thread's start (e.g. 14d, 36h; default 14d)", func(v string) error {
+		d, err := migration.ParseAge(v)
+		cfg.MaxGap = d
+		return err
+	})
+	fs.Float64Var(&cfg.MinTitleSimilarity, "min-title-similarity", cfg.MinTitleSimilarity, "Least title word overlap (Jaccard, 0-1) for a pair to be checked")
+	fs.IntVar(&cfg.MaxCandidates, "max-candidates", cfg.MaxCandidates, "Check at most this many earlier threads per thread, most similar first (0 = all)")
+	fs.Float64Var(&cfg.MinConfidence, "min-confidence", cfg.MinConfidence, "Record a continuation only when the model is at least this confident (0-1)")
+	fs.BoolVar(&cfg.Resume, "resume", cfg.Resume, "Skip pairs whose rollups are unchanged since they were last checked")
+	fs.BoolVar(&cfg.Candidates, "candidates", false, "Print the candidate pairs and exit (no API calls)")
+	fs.IntVar(&cfg.Concurrency, "concurrency", cfg.Concurrency, "Max concurrent model calls")
+	fs.IntVar(&cfg.MaxOutputTokens, "max-output-tokens", cfg.MaxOutputTokens, "Max output tokens per pair")
+	fs.Float64Var(&cfg.MaxUSD, "max-usd", cfg.MaxUSD, "Stop starting new pairs once estimated spend reaches this many USD (0 disables)")
+	fs.Int64Var(&cfg.MaxTokensTotal, "max-tokens-total", cfg.MaxTokensTotal, "Stop starting new pairs once input+output tokens reach this total (0 disables)")
+	fs.StringVar(&cfg.BudgetLedger, "budget-ledger", "", "Optional JSON file to load/save cumulative spend so caps span several runs or stages")
+	fs.StringVar(&cfg.APIKey, "api-key", "", "OpenAI API key (overrides OPENAI_API_KEY env var)")
+	fs.StringVar(&cfg.StructuredOutput, "structured-output", provider.StructuredJSONSchema, "How schema-constrained output is requested: json-schema (response format) or tool (a required function call, for models without json_schema support)")
+	fs.StringVar(&cfg.Durability, "durability", cfg.Durability, "fsync policy for output files: none, group (sync in batches), or full (sync every file)")
+	fs.StringVar(&cfg.AtomicWrite, "atomic-write", fileutils.AtomicRename, "How finished files replace their targets: rename (atomic), staged (temp files in TMPDIR, kept out of synced folders), or copy (written in place, for shares that refuse rename)")
+	fs.BoolVar(&cfg.CanonicalJSON, "canonical-json", cfg.CanonicalJSON, "Write JSON outputs with sorted keys and stable number formatting so regenerated files diff cleanly")
+	fs.IntVar(&cfg.MaxFilesPerDir, "max-files-per-dir", fileutils.DefaultMaxFilesPerDir, "Stop with an error before any output directory holds more than N files (0 disables)")
+	fs.Int64Var(&cfg.MaxOutputBytes, "max-output-bytes", 0, "Stop with an error before this run writes more than N bytes (0 disables)")
+	fs.StringVar(&cfg.Chaos, "chaos", "", "Inject provider failures for testing, e.g. rate-limit=0.1,server-error=0.05,truncate=0.05,garbage=0.05 (plus seed=N, max=N)")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	cfg.InPath = filepath.Clean(cfg.InPath)
+	cfg.OutPath = filepath.Clean(cfg.OutPath)
+	return cfg, nil
+}
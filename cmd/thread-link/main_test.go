@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+type fakeLinker struct {
+	calls atomic.Int32
+}
+
+func (f *fakeLinker) Confirm(_ context.Context, earlier, later string) (linkVerdict, error) {
+	f.calls.Add(1)
+	if strings.Contains(earlier, "drip lines") && strings.Contains(later, "drip lines") {
+		return linkVerdict{Continuation: true, Confidence: 0.9, Reason: "same drip irrigation install"}, nil
+	}
+	return linkVerdict{Continuation: true, Confidence: 0.4, Reason: "both about gardens"}, nil
+}
+
+func TestParseFlags_DefaultsAndValidate(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("thread-link", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-out", "x/../links.jsonl", "-max-gap", "3d"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if cfg.OutPath != "links.jsonl" || cfg.MaxGap != 72*time.Hour || !cfg.Resume {
+		t.Fatalf("cfg=%+v", cfg)
+	}
+	cfg.MinTitleSimilarity = 2
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for min-title-similarity > 1")
+	}
+}
+
+func TestLinkThreads_RecordsVerdictsAndResumes(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	in := filepath.Join(dir, "thread_summaries")
+	day := 24 * 3600.0
+	write := func(id, title, summary string, start float64) {
+		ts := migration.ThreadSummary{ConversationID: id, Title: title, Summary: summary, ThreadStart: &start}
+		if err := fileutils.WriteArtifactAtomic(filepath.Join(in, id+".thread.summary.json"), ts, false); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	write("a", "Garden irrigation plan", "Planning drip lines for the beds.", 0)
+	write("b", "Garden irrigation plan part 2", "Installing the drip lines.", 2*day)
+	write("c", "Garden irrigation costs", "Comparing sprinkler prices.", 4*day)
+	write("d", "Tax questions", "Deductions.", 5*day)
+
+	paths, err := collectRollups(in)
+	if err != nil {
+		t.Fatalf("collectRollups: %v", err)
+	}
+	threads, err := readRollups(paths)
+	if err != nil {
+		t.Fatalf("readRollups: %v", err)
+	}
+	cfg := defaultConfig()
+	cfg.OutPath = filepath.Join(dir, migration.ThreadLinksFileName)
+	candidates := migration.LinkCandidates(threads, migration.LinkCandidateOptions{MaxGap: cfg.MaxGap, MinTitleSimilarity: cfg.MinTitleSimilarity, MaxPerThread: cfg.MaxCandidates})
+	if len(candidates) != 3 {
+		t.Fatalf("candidates=%d want 3 (a>b, a>c, b>c)", len(candidates))
+	}
+
+	l := &fakeLinker{}
+	never := func() bool { return false }
+	stats, err := linkThreads(context.Background(), cfg, candidates, nil, l, never)
+	if err != nil {
+		t.Fatalf("linkThreads: %v", err)
+	}
+	if stats.Checked != 3 || stats.Linked != 1 {
+		t.Fatalf("stats=%+v", stats)
+	}
+	links, err := migration.LoadThreadLinks(cfg.OutPath)
+	if err != nil {
+		t.Fatalf("LoadThreadLinks: %v", err)
+	}
+	ab := links["a>b"]
+	if !ab.Continuation || ab.Confidence != 0.9 || ab.GapHours != 48 || ab.Model != cfg.Model {
+		t.Fatalf("a>b=%+v", ab)
+	}
+	if links["a>c"].Continuation {
+		t.Fatalf("a low-confidence verdict was recorded as a continuation: %+v", links["a>c"])
+	}
+	if sagas := migration.Sagas(links); len(sagas) != 1 || strings.Join(sagas[0], ",") != "a,b" {
+		t.Fatalf("sagas=%v", sagas)
+	}
+
+	stats, err = linkThreads(context.Background(), cfg, candidates, links, l, never)
+	if err != nil {
+		t.Fatalf("linkThreads resume: %v", err)
+	}
+	if stats.Skipped != 3 || l.calls.Load() != 3 {
+		t.Fatalf("resume stats=%+v calls=%d", stats, l.calls.Load())
+	}
+
+	var buf bytes.Buffer
+	if err := writeCandidates(&buf, candidates[:1]); err != nil {
+		t.Fatalf("writeCandidates: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "a -> b  similarity=1.00 gap=48h0m0s") {
+		t.Fatalf("candidates output=%q", buf.String())
+	}
+}
+
+func TestLinkThreads_StopsAtBudget(t *testing.T) {
+	t.Parallel()
+
+	start, later := 0.0, 3600.0
+	candidates := []migration.LinkCandidate{{
+		From: migration.ThreadSummary{ConversationID: "a", Title: "Plan", ThreadStart: &start},
+		To:   migration.ThreadSummary{ConversationID: "b", Title: "Plan", ThreadStart: &later},
+	}}
+	cfg := defaultConfig()
+	cfg.OutPath = filepath.Join(t.TempDir(), migration.ThreadLinksFileName)
+	l := &fakeLinker{}
+	stats, err := linkThreads(context.Background(), cfg, candidates, nil, l, func() bool { return true })
+	if err != nil || !stats.BudgetExhausted || l.calls.Load() != 0 {
+		t.Fatalf("stats=%+v err=%v calls=%d", stats, err, l.calls.Load())
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+// writeThreadBundles writes a bundle to cfg.BundleOutDir for each of threadIDs from the chunk summaries
+// already read and the rollups on disk, so bundles reflect rollups kept from earlier runs as well as
+// this run's. Threads whose rollups are missing (a spend cap stopped the run, say) get bundles without
+// them. It returns the number written.
+func writeThreadBundles(cfg Config, threadIDs []string, byThread map[string][]migration.ChunkSummary, byThreadSent map[string][]migration.ChunkSentimentSummary) (int, error) {
+	n := 0
+	for _, id := range threadIDs {
+		b := migration.ThreadBundle{
+			ConversationID:          id,
+			ChunkSummaries:          byThread[id],
+			ChunkSentimentSummaries: byThreadSent[id],
+		}
+		if cfg.ThreadsDir != "" {
+			var thread migration.SimplifiedConversation
+			if err := fileutils.ReadArtifact(filepath.Join(cfg.ThreadsDir, id+".json"), &thread); err == nil {
+				b.Thread = &thread
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return n, fmt.Errorf("read thread %s: %w", id, err)
+			}
+		}
+		if p := threadSummaryOutPath(cfg.OutDir, id); fileExists(p) {
+			ts, err := readThreadSummaryFile(p)
+			if err != nil {
+				return n, err
+			}
+			b.ThreadSummary = &ts
+		}
+		if cfg.SentimentOutDir != "" {
+			if p := threadSentimentOutPath(cfg.SentimentOutDir, id); fileExists(p) {
+				ts, err := readThreadSentimentSummaryFile(p)
+				if err != nil {
+					return n, err
+				}
+				b.ThreadSentimentSummary = &ts
+			}
+		}
+		if _, err := migration.WriteThreadBundle(cfg.BundleOutDir, b, cfg.Pretty); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -3,6 +3,11 @@ package main
 import (
 	"errors"
 	"path/filepath"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
 )
 
 type Config struct {
@@ -19,12 +24,85 @@ type Config struct {
 	SentimentIndexPath   string
 	SentimentModel       string
 	Resume               bool
+	Rescan               bool
+	RefreshOlderThan     time.Duration
+	RefreshModelMismatch bool
 	Reindex              bool
+	ReindexWorkers       int
+	Retitle              bool
+	OverridesDir         string
 	Concurrency          int
+	QPS                  float64
+	// Threads limits the run to these conversation IDs; empty means all.
+	Threads              []string
 	MaxChunksPerThread   int
 	IndexSummaryMaxChars int
 	IndexTagsMax         int
 	IndexTermsMax        int
+	// SentimentEvidence asks sentiment rollups for emotion confidences and tension turn ranges
+	// (migration.SentimentEvidence), given the chunks' own under chunk-summarizer -sentiment-evidence.
+	SentimentEvidence bool
+	// SentimentIndexFields is the optional sentiment fields kept in sentiment index rows (nil = all).
+	SentimentIndexFields migration.SentimentIndexFieldSet
+	MaxUSD               float64
+	MaxTokensTotal       int64
+	BudgetLedger         string
+
+	// RelatedThreads is how many earlier rollups sharing the thread's project or top tags/terms are
+	// included as background in semantic rollup prompts (0 disables).
+	RelatedThreads int
+
+	// MaxSummaryFraction warns about rollups whose summary and key points exceed this fraction of the
+	// thread transcript's estimated tokens (0 disables).
+	MaxSummaryFraction float64
+
+	// VerifyTerms is the -verify-terms mode (see migration.VerifyTerms) for rollup tags and terms the
+	// source chunk summaries never mention.
+	VerifyTerms string
+	// LowercaseTags lowercases rollup tags as they are normalized (see migration.NormalizeTags).
+	LowercaseTags bool
+
+	// LinksPath is a thread_links.jsonl from thread-link; when set, each group of linked conversations
+	// also gets a combined saga rollup in SagaOutDir (default: "sagas" next to OutDir).
+	LinksPath  string
+	SagaOutDir string
+
+	// BundleOutDir, when set, gets a <conversation_id>.bundle.json per thread in the run combining its
+	// chunk summaries, sentiment summaries, and rollups, plus the simplified thread from ThreadsDir.
+	BundleOutDir string
+	ThreadsDir   string
+
+	// StylePath is the -style profile appended to every rollup prompt (see migration.StyleProfile).
+	StylePath string
+	// OutputLanguage is the language rollups are written in (see migration.StyleProfile.Language).
+	OutputLanguage string
+
+	// PassthroughSingleChunk copies the chunk summary of single-chunk threads into their rollups
+	// instead of calling the model.
+	PassthroughSingleChunk bool
+
+	// CleanupParts removes a thread's intermediate .partNNofMM rollups once its final rollup is
+	// verified written.
+	CleanupParts bool
+
+	// PromptBudget is a -prompt-budget spec (see provider.ParsePromptBudget) capping prompt input
+	// tokens per model; empty uses provider.DefaultInputTokens.
+	PromptBudget string
+
+	Durability  string
+	AtomicWrite string
+	// CanonicalJSON writes JSON outputs in canonical form (see fileutils.Canonicalize).
+	CanonicalJSON bool
+
+	// MaxFilesPerDir and MaxOutputBytes set the output quota (see fileutils.Quota).
+	MaxFilesPerDir int
+	MaxOutputBytes int64
+
+	// StructuredOutput is how schema-constrained output is requested (see provider.SetStructuredOutput).
+	StructuredOutput string
+
+	// Chaos is a -chaos spec (see provider.ParseChaos) injecting provider failures; empty disables.
+	Chaos string
 }
 
 func (c Config) Validate() error {
@@ -34,6 +112,9 @@ func (c Config) Validate() error {
 	if c.OutDir == "" {
 		return errors.New("missing -out")
 	}
+	if c.ReindexWorkers < 1 {
+		return errors.New("reindex-workers must be >= 1")
+	}
 	if c.Model == "" {
 		return errors.New("missing -model")
 	}
@@ -43,15 +124,60 @@ func (c Config) Validate() error {
 	if c.Concurrency < 0 {
 		return errors.New("concurrency must be >= 0")
 	}
+	if c.QPS < 0 {
+		return errors.New("qps must be >= 0")
+	}
+	if c.RelatedThreads < 0 {
+		return errors.New("related-threads must be >= 0")
+	}
 	if c.MaxChunksPerThread < 0 {
 		return errors.New("max-chunks-per-thread must be >= 0")
 	}
 	if c.IndexSummaryMaxChars < 0 || c.IndexTagsMax < 0 || c.IndexTermsMax < 0 {
 		return errors.New("index limits must be >= 0")
 	}
+	if c.MaxSummaryFraction < 0 {
+		return errors.New("max-summary-fraction must be >= 0")
+	}
+	if _, err := migration.ParseVerifyTerms(c.VerifyTerms); err != nil {
+		return err
+	}
+	if c.ThreadsDir != "" && c.BundleOutDir == "" {
+		return errors.New("-threads-dir needs -bundle-out")
+	}
+	if _, err := provider.ParsePromptBudget(c.PromptBudget); err != nil {
+		return err
+	}
+	if c.MaxUSD < 0 || c.MaxTokensTotal < 0 {
+		return errors.New("max-usd/max-tokens-total must be >= 0")
+	}
+	if _, err := fileutils.ParseDurability(c.Durability); err != nil {
+		return err
+	}
+	if _, err := fileutils.ParseAtomicWrite(c.AtomicWrite); err != nil {
+		return err
+	}
+	if _, err := provider.ParseStructuredOutput(c.StructuredOutput); err != nil {
+		return err
+	}
+	if _, err := provider.ParseChaos(c.Chaos); err != nil {
+		return err
+	}
 	return nil
 }
 
+func (c Config) refreshPolicy() migration.RefreshPolicy {
+	return migration.RefreshPolicy{OlderThan: c.RefreshOlderThan, ModelMismatch: c.RefreshModelMismatch}
+}
+
+// sagaOutDir is where saga rollups are written.
+func (c Config) sagaOutDir() string {
+	if c.SagaOutDir != "" {
+		return c.SagaOutDir
+	}
+	return filepath.Join(filepath.Dir(c.OutDir), "sagas")
+}
+
 func defaultConfig() Config {
 	return Config{
 		InPath:               filepath.FromSlash("docs/peanut-gallery/threads/summaries"),
@@ -62,10 +188,15 @@ func defaultConfig() Config {
 		SentimentModel:       "gpt-5-mini",
 		Resume:               true,
 		Reindex:              true,
+		ReindexWorkers:       8,
+		OverridesDir:         filepath.FromSlash("docs/peanut-gallery/threads/overrides"),
 		Concurrency:          6,
 		MaxChunksPerThread:   5,
 		IndexSummaryMaxChars: 600,
 		IndexTagsMax:         5,
 		IndexTermsMax:        15,
+		MaxSummaryFraction:   0.5,
+		VerifyTerms:          migration.VerifyTermsDrop,
+		Durability:           fileutils.DurabilityFull,
 	}
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
+)
+
+var help = cli.Help{
+	Name:    "thread-rollup",
+	Summary: "roll chunk summaries up into one semantic and one sentiment summary per thread",
+	Groups: []cli.Group{
+		{Title: "Input and output", Flags: []string{"in", "out", "sentiment-out", "threads", "overrides", "pretty", "overwrite", "durability", "atomic-write", "canonical-json", "max-files-per-dir", "max-output-bytes"}},
+		{Title: "Model", Flags: []string{"model", "sentiment-model", "sentiment-evidence", "style", "output-language", "glossary", "glossary-max-terms", "related-threads", "max-chunks-per-thread", "passthrough-single-chunk", "cleanup-parts", "max-summary-fraction", "verify-terms", "lowercase-tags", "prompt-budget", "api-key", "structured-output"}},
+		{Title: "Reruns", Flags: []string{"resume", "rescan", "refresh-older-than", "refresh-model-mismatch", "retitle"}},
+		{Title: "Indices", Flags: []string{"index", "sentiment-index", "reindex", "reindex-workers", "index-summary-max-chars", "index-tags-max", "index-terms-max", "sentiment-index-fields"}},
+		{Title: "Sagas", Flags: []string{"links", "saga-out"}},
+		{Title: "Bundles", Flags: []string{"bundle-out", "threads-dir"}},
+		{Title: "Throughput", Flags: []string{"concurrency", "qps"}},
+		{Title: "Spend caps", Flags: []string{"max-usd", "max-tokens-total", "budget-ledger"}},
+		{Title: "Testing", Flags: []string{"chaos"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "roll up every thread", Command: "thread-rollup -in docs/peanut-gallery/threads/summaries -out docs/peanut-gallery/threads/thread_summaries"},
+		{Comment: "regenerate rollups older than three months and rebuild the indices", Command: "thread-rollup -refresh-older-than 90d -reindex"},
+		{Comment: "also write saga rollups for threads thread-link found to be continuations", Command: "thread-rollup -links docs/peanut-gallery/threads/thread_links.jsonl -saga-out docs/peanut-gallery/threads/sagas"},
+	},
+	Values: map[string][]string{"durability": fileutils.DurabilityModes, "atomic-write": fileutils.AtomicWriteModes, "structured-output": provider.StructuredOutputModes, "verify-terms": migration.VerifyTermsModes},
+}
@@ -8,12 +8,17 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/provider"
 )
 
 func TestIsJSONTruncationError(t *testing.T) {
@@ -182,6 +187,164 @@ func TestPartOutPaths(t *testing.T) {
 	}
 }
 
+func TestCleanupThreadParts_AfterFinalRollupVerified(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{OutDir: t.TempDir(), SentimentOutDir: t.TempDir()}
+	write := func(path, body string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	semParts := []string{semanticPartOutPath(cfg.OutDir, "t1", 1, 2), semanticPartOutPath(cfg.OutDir, "t1", 2, 2)}
+	sentParts := []string{sentimentPartOutPath(cfg.SentimentOutDir, "t1", 1, 2)}
+	for _, p := range append(append([]string{}, semParts...), sentParts...) {
+		write(p, `{"conversation_id":"t1"}`)
+	}
+	write(layout.MetaName(semParts[0]), `{}`)
+	other := semanticPartOutPath(cfg.OutDir, "t10", 1, 2)
+	write(other, `{"conversation_id":"t10"}`)
+
+	// Without final rollups every part is kept.
+	if err := cleanupThreadParts(cfg, "t1"); err != nil {
+		t.Fatalf("cleanupThreadParts: %v", err)
+	}
+	for _, p := range append(semParts, sentParts...) {
+		if !fileExists(p) {
+			t.Fatalf("%s removed before the final rollup exists", p)
+		}
+	}
+
+	// A valid semantic rollup frees its parts; a torn sentiment rollup keeps its own.
+	if err := fileutils.WriteArtifactAtomic(threadSummaryOutPath(cfg.OutDir, "t1"), migration.ThreadSummary{ConversationID: "t1", Summary: "s"}, false); err != nil {
+		t.Fatal(err)
+	}
+	write(threadSentimentOutPath(cfg.SentimentOutDir, "t1"), `{"conversation_id":`)
+	if err := cleanupThreadParts(cfg, "t1"); err != nil {
+		t.Fatalf("cleanupThreadParts: %v", err)
+	}
+	for _, p := range append(semParts, layout.MetaName(semParts[0])) {
+		if fileExists(p) {
+			t.Fatalf("%s not removed", p)
+		}
+	}
+	if !fileExists(sentParts[0]) || !fileExists(other) {
+		t.Fatal("removed parts of an unverified rollup or another thread")
+	}
+}
+
+func TestPassthroughSingleChunk_WritesRollupWithoutModel(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{OutDir: t.TempDir(), SentimentOutDir: t.TempDir(), Model: "gpt-5-mini", PassthroughSingleChunk: true, RefreshModelMismatch: true}
+	start := 100.0
+	chunk := migration.ChunkSummary{
+		ConversationID: "t1", ThreadStart: &start, OriginalTitle: "New chat", Project: "p",
+		Summary:   "Planned the Lisbon move in detail. Compared visas.",
+		KeyPoints: []string{"visa D7"}, Tags: []string{"moving"}, SourceTokens: 900, Model: "gpt-4o-mini",
+	}
+	outPath := threadSummaryOutPath(cfg.OutDir, "t1")
+	if err := os.WriteFile(layout.MetaName(outPath), []byte(`{"calls":[]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The zero rolluper has no client, so any model call would fail.
+	if err := writeThreadSummaryWithOptionalSplit(context.Background(), cfg, "t1", []migration.ChunkSummary{chunk}, openAIThreadRolluper{}, "", "", outPath); err != nil {
+		t.Fatalf("semantic passthrough: %v", err)
+	}
+	sent := migration.ChunkSentimentSummary{ConversationID: "t1", EmotionalSummary: " Hopeful. ", Themes: []string{"change"}, Model: "gpt-4o-mini"}
+	sentPath := threadSentimentOutPath(cfg.SentimentOutDir, "t1")
+	if err := writeThreadSentimentSummaryWithOptionalSplit(context.Background(), cfg, "t1", []migration.ChunkSentimentSummary{sent}, openAIThreadSentimentRolluper{}, "", sentPath); err != nil {
+		t.Fatalf("sentiment passthrough: %v", err)
+	}
+
+	ts, err := readThreadSummaryFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ts.Passthrough || ts.Title != "Planned the Lisbon move in detail" || ts.Summary != chunk.Summary || ts.MicroSummary == "" ||
+		ts.SourceTokens != 900 || ts.Model != "gpt-4o-mini" || ts.ThreadStart == nil || len(ts.KeyPoints) != 1 ||
+		!reflect.DeepEqual(ts.KeyPointSources, [][]int{{0}}) {
+		t.Fatalf("rollup=%+v", ts)
+	}
+	if fileExists(layout.MetaName(outPath)) {
+		t.Fatal("stale sidecar kept")
+	}
+	ss, err := readThreadSentimentSummaryFile(sentPath)
+	if err != nil || !ss.Passthrough || ss.EmotionalSummary != "Hopeful." {
+		t.Fatalf("sentiment rollup=%+v err=%v", ss, err)
+	}
+
+	// A passthrough rollup never counts as made by another model.
+	if regen := scanThreadArtifacts(cfg, []string{"t1"}); regen["t1"] {
+		t.Fatal("passthrough rollup flagged for model refresh")
+	}
+	if got := passthroughTitle("Lisbon visas", chunk.Summary); got != "Lisbon visas" {
+		t.Fatalf("passthroughTitle kept export title? got %q", got)
+	}
+}
+
+func TestTinyChunk_PassesThroughWithoutFlag(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{OutDir: t.TempDir(), SentimentOutDir: t.TempDir(), Model: "gpt-5-mini"}
+	chunk := migration.ChunkSummary{ConversationID: "t1", OriginalTitle: "Oven temperature", Summary: "Asked how hot to bake bread.", Tiny: true}
+	outPath := threadSummaryOutPath(cfg.OutDir, "t1")
+	// The zero rolluper has no client, so any model call would fail.
+	if err := writeThreadSummaryWithOptionalSplit(context.Background(), cfg, "t1", []migration.ChunkSummary{chunk}, openAIThreadRolluper{}, "", "", outPath); err != nil {
+		t.Fatalf("semantic passthrough: %v", err)
+	}
+	sent := migration.ChunkSentimentSummary{ConversationID: "t1", EmotionalSummary: "Curious.", Tiny: true}
+	sentPath := threadSentimentOutPath(cfg.SentimentOutDir, "t1")
+	if err := writeThreadSentimentSummaryWithOptionalSplit(context.Background(), cfg, "t1", []migration.ChunkSentimentSummary{sent}, openAIThreadSentimentRolluper{}, "", sentPath); err != nil {
+		t.Fatalf("sentiment passthrough: %v", err)
+	}
+	ts, err := readThreadSummaryFile(outPath)
+	if err != nil || !ts.Passthrough || ts.Title != "Oven temperature" {
+		t.Fatalf("rollup=%+v err=%v", ts, err)
+	}
+
+	// Without the tiny mark a single chunk still goes to the model.
+	chunk.Tiny = false
+	if err := writeThreadSummaryWithOptionalSplit(context.Background(), cfg, "t2", []migration.ChunkSummary{chunk}, openAIThreadRolluper{}, "", "", threadSummaryOutPath(cfg.OutDir, "t2")); err == nil {
+		t.Fatal("expected the model call to fail")
+	}
+}
+
+func TestWriteThreadBundles_CombinesThreadArtifacts(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{OutDir: t.TempDir(), SentimentOutDir: t.TempDir(), ThreadsDir: t.TempDir(), BundleOutDir: t.TempDir()}
+	writeJSON(t, cfg.ThreadsDir, "t1.json", migration.SimplifiedConversation{ConversationID: "t1", Title: "Lisbon"})
+	writeJSON(t, cfg.OutDir, filepath.Base(threadSummaryOutPath(cfg.OutDir, "t1")), migration.ThreadSummary{ConversationID: "t1", Summary: "Planned the move."})
+	byThread := map[string][]migration.ChunkSummary{
+		"t1": {{ConversationID: "t1", ChunkNumber: 1}, {ConversationID: "t1", ChunkNumber: 2}},
+		"t2": {{ConversationID: "t2", ChunkNumber: 1}},
+	}
+	byThreadSent := map[string][]migration.ChunkSentimentSummary{"t1": {{ConversationID: "t1", ChunkNumber: 1}}}
+
+	n, err := writeThreadBundles(cfg, []string{"t1", "t2"}, byThread, byThreadSent)
+	if err != nil || n != 2 {
+		t.Fatalf("writeThreadBundles n=%d err=%v", n, err)
+	}
+	var b migration.ThreadBundle
+	if err := fileutils.ReadArtifact(migration.ThreadBundlePath(cfg.BundleOutDir, "t1"), &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Thread == nil || b.Thread.Title != "Lisbon" || len(b.ChunkSummaries) != 2 || len(b.ChunkSentimentSummaries) != 1 ||
+		b.ThreadSummary == nil || b.ThreadSummary.Summary != "Planned the move." || b.ThreadSentimentSummary != nil {
+		t.Fatalf("bundle=%+v", b)
+	}
+	// A thread with no simplified thread or rollups on disk still gets its chunk summaries.
+	b = migration.ThreadBundle{}
+	if err := fileutils.ReadArtifact(migration.ThreadBundlePath(cfg.BundleOutDir, "t2"), &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Thread != nil || b.ThreadSummary != nil || len(b.ChunkSummaries) != 1 || b.ChunkSentimentSummaries == nil {
+		t.Fatalf("bundle=%+v", b)
+	}
+}
+
 func TestForEachThreadIDConcurrent_RespectsConcurrencyLimit(t *testing.T) {
 	t.Parallel()
 
@@ -342,3 +505,420 @@ func writeJSON(t *testing.T, dir, name string, v any) string {
 	}
 	return p
 }
+
+func TestScanThreadArtifacts_FlagsDegenerateRollups(t *testing.T) {
+	t.Parallel()
+
+	out := t.TempDir()
+	sout := t.TempDir()
+	cfg := Config{OutDir: out, SentimentOutDir: sout, Rescan: true}
+
+	_ = writeJSON(t, out, "ok.thread.summary.json", migration.ThreadSummary{ConversationID: "ok", Summary: "Fine.", KeyPoints: []string{"k"}})
+	_ = writeJSON(t, out, "bad.thread.summary.json", migration.ThreadSummary{ConversationID: "bad", Summary: "Fine.", KeyPoints: []string{"k"}})
+	_ = writeJSON(t, sout, "bad.thread.sentiment.summary.json", migration.ThreadSentimentSummary{ConversationID: "bad"})
+
+	regen := scanThreadArtifacts(cfg, []string{"ok", "bad", "missing"})
+	if len(regen) != 1 || !regen["bad"] {
+		t.Fatalf("regen=%v", regen)
+	}
+}
+
+func TestParseFlags_RefreshPolicy(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("thread-rollup", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-refresh-older-than", "90d", "-refresh-model-mismatch"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.RefreshOlderThan != 90*24*time.Hour || !cfg.RefreshModelMismatch {
+		t.Fatalf("RefreshOlderThan=%v RefreshModelMismatch=%v", cfg.RefreshOlderThan, cfg.RefreshModelMismatch)
+	}
+}
+
+func TestParseFlags_VerifyTerms(t *testing.T) {
+	t.Parallel()
+
+	cfg, err := parseFlags(flag.NewFlagSet("thread-rollup", flag.ContinueOnError), nil)
+	if err != nil || cfg.VerifyTerms != migration.VerifyTermsDrop {
+		t.Fatalf("default VerifyTerms=%q err=%v", cfg.VerifyTerms, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	cfg.VerifyTerms = "strict"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected an error for an unknown -verify-terms mode")
+	}
+}
+
+func TestParseFlags_ThreadsFilter(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("thread-rollup", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-threads", "b, c"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	got := filterThreadIDs([]string{"a", "b", "c", "d"}, cfg.Threads)
+	if strings.Join(got, ",") != "b,c" {
+		t.Fatalf("filterThreadIDs=%v", got)
+	}
+}
+
+func TestScanThreadArtifacts_RefreshModelMismatch(t *testing.T) {
+	t.Parallel()
+
+	out := t.TempDir()
+	cfg := Config{OutDir: out, Model: "new", RefreshModelMismatch: true}
+	_ = writeJSON(t, out, "a.thread.summary.json", migration.ThreadSummary{ConversationID: "a", Summary: "Fine.", KeyPoints: []string{"k"}, Model: "old"})
+	_ = writeJSON(t, out, "b.thread.summary.json", migration.ThreadSummary{ConversationID: "b", Summary: "Fine", KeyPoints: []string{"k"}, Model: "new"})
+
+	regen := scanThreadArtifacts(cfg, []string{"a", "b"})
+	if len(regen) != 1 || !regen["a"] {
+		t.Fatalf("regen=%v", regen)
+	}
+}
+
+func TestRebuildThreadIndices_AppliesOverrides(t *testing.T) {
+	t.Parallel()
+
+	out := t.TempDir()
+	overridesDir := t.TempDir()
+	_ = writeJSON(t, out, "a.thread.summary.json", migration.ThreadSummary{ConversationID: "a", Title: "generated", Summary: "model text", Tags: []string{"x"}})
+	_ = writeJSON(t, overridesDir, "a.json", map[string]any{"title": "Corrected title", "tags": []string{"fixed"}})
+
+	cfg := Config{OutDir: out, OverridesDir: overridesDir}
+	indexPath := filepath.Join(out, "thread_index.jsonl")
+	if err := rebuildThreadIndices(cfg, indexPath, ""); err != nil {
+		t.Fatalf("rebuildThreadIndices: %v", err)
+	}
+	b, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatalf("read index: %v", err)
+	}
+	var rec migration.ThreadIndexRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if rec.Title != "Corrected title" || rec.Summary != "model text" || len(rec.Tags) != 1 || rec.Tags[0] != "fixed" {
+		t.Fatalf("rec=%+v", rec)
+	}
+
+	// The rollup file itself is left untouched so regeneration never loses the correction.
+	var ts migration.ThreadSummary
+	raw, _ := os.ReadFile(filepath.Join(out, "a.thread.summary.json"))
+	if err := json.Unmarshal(raw, &ts); err != nil || ts.Title != "generated" {
+		t.Fatalf("ts=%+v err=%v", ts, err)
+	}
+}
+
+func TestRebuildThreadIndices_TracksOpenItems(t *testing.T) {
+	t.Parallel()
+
+	out := t.TempDir()
+	_ = writeJSON(t, out, "a.thread.summary.json", migration.ThreadSummary{
+		ConversationID: "a",
+		Summary:        "garden",
+		OpenItems:      []migration.OpenItem{{Kind: "todo", Text: "build a cold frame"}, {Kind: "question", Text: "which tomatoes?"}},
+	})
+	cfg := Config{OutDir: out}
+	indexPath := filepath.Join(out, "thread_index.json")
+	openPath := filepath.Join(out, migration.OpenThreadsFileName)
+	if err := rebuildThreadIndices(cfg, indexPath, ""); err != nil {
+		t.Fatalf("rebuildThreadIndices: %v", err)
+	}
+	rows, err := migration.ReadOpenThreads(fileutils.OS, openPath)
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("rows=%+v err=%v", rows, err)
+	}
+
+	// A status set by hand survives the next rebuild.
+	rows[0].Status = migration.OpenThreadDone
+	if err := migration.WriteOpenThreads(openPath, rows); err != nil {
+		t.Fatalf("WriteOpenThreads: %v", err)
+	}
+	if err := rebuildThreadIndices(cfg, indexPath, ""); err != nil {
+		t.Fatalf("rebuildThreadIndices: %v", err)
+	}
+	rows, _ = migration.ReadOpenThreads(fileutils.OS, openPath)
+	if len(rows) != 2 || rows[0].Status != migration.OpenThreadDone || rows[1].Status != migration.OpenThreadOpen {
+		t.Fatalf("rows=%+v", rows)
+	}
+}
+
+func TestRetitleThread_NormalizesAndSyncsSentiment(t *testing.T) {
+	t.Parallel()
+
+	out := t.TempDir()
+	sout := t.TempDir()
+	cfg := Config{OutDir: out, SentimentOutDir: sout, Retitle: true}
+	outPath := writeJSON(t, out, "a.thread.summary.json", migration.ThreadSummary{ConversationID: "a", Title: `"Moving to Lisbon."`, Summary: "s"})
+	sentPath := writeJSON(t, sout, "a.thread.sentiment.summary.json", migration.ThreadSentimentSummary{ConversationID: "a", Title: "A hopeful move"})
+	early, late := 1700000000.0, 1700086400.0
+	chunks := []migration.ChunkSummary{
+		{ConversationID: "a", OriginalTitle: "New chat", ThreadUpdate: &early},
+		{ConversationID: "a", ThreadUpdate: &late},
+	}
+
+	if err := retitleThread(cfg, chunks, outPath, sentPath); err != nil {
+		t.Fatalf("retitleThread: %v", err)
+	}
+	ts, err := readThreadSummaryFile(outPath)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if ts.Title != "Moving to Lisbon" || ts.OriginalTitle != "New chat" {
+		t.Fatalf("ts title=%q original=%q", ts.Title, ts.OriginalTitle)
+	}
+	if ts.ThreadUpdate == nil || *ts.ThreadUpdate != late {
+		t.Fatalf("ts thread_update_time=%v", ts.ThreadUpdate)
+	}
+	ss, err := readThreadSentimentSummaryFile(sentPath)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if ss.Title != ts.Title || ss.OriginalTitle != ts.OriginalTitle || ss.ThreadUpdate == nil || *ss.ThreadUpdate != late {
+		t.Fatalf("ss title=%q original=%q thread_update_time=%v", ss.Title, ss.OriginalTitle, ss.ThreadUpdate)
+	}
+}
+
+func TestCompressionTally_TotalsAndWarns(t *testing.T) {
+	t.Parallel()
+
+	out := t.TempDir()
+	tight := writeJSON(t, out, "a.thread.summary.json", migration.ThreadSummary{ConversationID: "a", Summary: strings.Repeat("x", 400), SourceTokens: 10000})
+	loose := writeJSON(t, out, "b.thread.summary.json", migration.ThreadSummary{ConversationID: "b", Summary: strings.Repeat("x", 400), SourceTokens: 150})
+	unknown := writeJSON(t, out, "c.thread.summary.json", migration.ThreadSummary{ConversationID: "c", Summary: "s"})
+
+	var tally compressionTally
+	for _, p := range []string{tight, loose, unknown, filepath.Join(out, "missing.thread.summary.json")} {
+		if err := tally.add(p, 0.5); err != nil {
+			t.Fatalf("add %s: %v", p, err)
+		}
+	}
+	if tally.source != 10150 || tally.summary != 200 {
+		t.Fatalf("source=%d summary=%d", tally.source, tally.summary)
+	}
+	if len(tally.warnings) != 1 || !strings.HasPrefix(tally.warnings[0], "b:") {
+		t.Fatalf("warnings=%v", tally.warnings)
+	}
+}
+
+func TestSumSourceTokens_UnknownWhenAnyChunkLacksIt(t *testing.T) {
+	t.Parallel()
+
+	field := func(c migration.ChunkSummary) int { return c.SourceTokens }
+	if got := sumSourceTokens([]migration.ChunkSummary{{SourceTokens: 100}, {SourceTokens: 50}}, field); got != 150 {
+		t.Fatalf("sum=%d want 150", got)
+	}
+	if got := sumSourceTokens([]migration.ChunkSummary{{SourceTokens: 100}, {}}, field); got != 0 {
+		t.Fatalf("sum=%d want 0", got)
+	}
+}
+
+func TestRelatedThreadsForPrompt_UsesPriorRollups(t *testing.T) {
+	t.Parallel()
+
+	out := t.TempDir()
+	_ = writeJSON(t, out, "a.thread.summary.json", migration.ThreadSummary{ConversationID: "a", Title: "Cold frame", MicroSummary: "Built a cold frame for the garden.", Tags: []string{"garden"}})
+	_ = writeJSON(t, out, "b.thread.summary.json", migration.ThreadSummary{ConversationID: "b", Title: "Taxes", MicroSummary: "Filed taxes.", Tags: []string{"taxes"}})
+	_ = writeJSON(t, out, "a.thread.summary.part01of02.json", migration.ThreadSummary{ConversationID: "a", MicroSummary: "part", Tags: []string{"garden"}})
+
+	prior, err := loadThreadSummaries(out)
+	if err != nil {
+		t.Fatalf("loadThreadSummaries: %v", err)
+	}
+	if len(prior) != 2 {
+		t.Fatalf("prior=%d, want 2 (parts skipped)", len(prior))
+	}
+	related := migration.NewRelatedThreads(prior)
+	chunks := []migration.ChunkSummary{{ConversationID: "c", Tags: []string{"Garden", "tomatoes"}}}
+
+	got := relatedThreadsForPrompt(related, "c", chunks, 3)
+	if !strings.HasPrefix(got, "related_threads") || !strings.Contains(got, "micro_summary=Built a cold frame for the garden.") {
+		t.Fatalf("missing related thread:\n%s", got)
+	}
+	if strings.Contains(got, "Filed taxes.") {
+		t.Fatalf("unrelated thread included:\n%s", got)
+	}
+	if got := relatedThreadsForPrompt(related, "c", chunks, 0); got != "" {
+		t.Fatalf("disabled lookup returned %q", got)
+	}
+	in := buildThreadRollupInput("c", chunks, "", got, 0)
+	if i, j := strings.Index(in, "related_threads"), strings.Index(in, "chunk_summaries:"); i < 0 || j < i {
+		t.Fatalf("related threads should precede chunk summaries:\n%s", in)
+	}
+}
+
+func TestBuildThreadRollupInput_TokenBudget(t *testing.T) {
+	t.Parallel()
+
+	var chunks []migration.ChunkSummary
+	for i := 0; i < 100; i++ {
+		chunks = append(chunks, migration.ChunkSummary{ConversationID: "c", ChunkNumber: i, Summary: strings.Repeat("They compared neighborhoods and rents. ", 20)})
+	}
+	in := buildThreadRollupInput("c", chunks, "", "", 3000)
+	if n := provider.CountTokens(in); n > 3000 {
+		t.Fatalf("input tokens=%d, budget 3000", n)
+	}
+	if !strings.HasSuffix(in, "... [chunk_summaries truncated]\n") || !strings.Contains(in, "- chunk=0 ") {
+		t.Fatalf("expected leading chunks kept and the rest truncated:\n%s", in)
+	}
+
+	budget, _ := provider.ParsePromptBudget("gpt-5-mini=5000")
+	r := openAIThreadRolluper{model: "gpt-5-mini", prompts: budget}
+	if got := r.inputTokens(threadRollupPrompt, rollupSchema); got != 5000 {
+		t.Fatalf("inputTokens=%d", got)
+	}
+}
+
+func TestKeyPointSources_AlignsWithKeyPoints(t *testing.T) {
+	t.Parallel()
+
+	valid := func(n int) bool { return n >= 1 && n <= 3 }
+	got := keyPointSources([][]int{{3, 1, 3}, {9}, {2}, {1}}, 3, valid)
+	if want := [][]int{{1, 3}, {}, {2}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("keyPointSources=%v, want %v", got, want)
+	}
+	if got := keyPointSources([][]int{{2}}, 3, valid); !reflect.DeepEqual(got, [][]int{{2}, {}, {}}) {
+		t.Fatalf("short sources=%v", got)
+	}
+	if got := keyPointSources([][]int{{}, {9}}, 2, valid); got != nil {
+		t.Fatalf("uncited sources=%v, want nil", got)
+	}
+
+	in := formatKeyPointsWithSources([]string{"Arroios fits", "Trip in July"}, [][]int{{1, 3}, {}})
+	if in != "Arroios fits [chunks 1, 3]; Trip in July" {
+		t.Fatalf("merge input key points=%q", in)
+	}
+}
+
+type fakeSagaRolluper struct {
+	calls []string
+}
+
+func (f *fakeSagaRolluper) RollupSaga(_ context.Context, sagaID string, threads []migration.ThreadSummary, _ string) (migration.ThreadSummary, error) {
+	var ids []string
+	for _, t := range threads {
+		ids = append(ids, t.ConversationID)
+	}
+	f.calls = append(f.calls, sagaID+":"+strings.Join(ids, ","))
+	return migration.ThreadSummary{ConversationID: sagaID, Title: "Garden saga", Summary: "Across " + strings.Join(ids, ", ") + "."}, nil
+}
+
+func TestRollupSagas_WritesLinkedGroupsChronologically(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cfg := defaultConfig()
+	cfg.OutDir = filepath.Join(dir, "thread_summaries")
+	cfg.LinksPath = filepath.Join(dir, migration.ThreadLinksFileName)
+	for id, start := range map[string]float64{"z1": 100, "a2": 200, "m3": 300} {
+		ts := migration.ThreadSummary{ConversationID: id, Title: "Garden", Summary: "Part " + id, ThreadStart: &start}
+		if err := fileutils.WriteArtifactAtomic(threadSummaryOutPath(cfg.OutDir, id), ts, false); err != nil {
+			t.Fatalf("write rollup: %v", err)
+		}
+	}
+	links := `{"from":"z1","to":"a2","continuation":true}
+{"from":"a2","to":"m3","continuation":true}
+{"from":"m3","to":"gone","continuation":true}
+{"from":"x","to":"y","continuation":false}
+`
+	if err := os.WriteFile(cfg.LinksPath, []byte(links), 0o644); err != nil {
+		t.Fatalf("write links: %v", err)
+	}
+
+	r := &fakeSagaRolluper{}
+	never := func() bool { return false }
+	stats, err := rollupSagas(context.Background(), cfg, r, "", never)
+	if err != nil {
+		t.Fatalf("rollupSagas: %v", err)
+	}
+	if stats.Written != 1 || len(stats.Warnings) != 1 || strings.Join(r.calls, ";") != "saga-z1:z1,a2,m3" {
+		t.Fatalf("stats=%+v calls=%v", stats, r.calls)
+	}
+	var saga migration.SagaSummary
+	path := filepath.Join(dir, "sagas", "saga-z1"+migration.SagaSuffix)
+	if err := fileutils.ReadArtifact(path, &saga); err != nil {
+		t.Fatalf("read saga: %v", err)
+	}
+	if saga.ConversationID != "saga-z1" || strings.Join(saga.ConversationIDs, ",") != "z1,a2,m3" || saga.SourceSHA256 == "" {
+		t.Fatalf("saga=%+v", saga)
+	}
+
+	// Unchanged members: nothing is rolled up again.
+	stats, err = rollupSagas(context.Background(), cfg, r, "", never)
+	if err != nil || stats.Skipped != 1 || len(r.calls) != 1 {
+		t.Fatalf("rerun stats=%+v err=%v calls=%v", stats, err, r.calls)
+	}
+	// A changed member rollup makes the saga stale.
+	start := 300.0
+	changed := migration.ThreadSummary{ConversationID: "m3", Title: "Garden", Summary: "Revised", ThreadStart: &start}
+	if err := fileutils.WriteArtifactAtomic(threadSummaryOutPath(cfg.OutDir, "m3"), changed, false); err != nil {
+		t.Fatalf("rewrite rollup: %v", err)
+	}
+	if stats, err = rollupSagas(context.Background(), cfg, r, "", func() bool { return true }); err != nil || !stats.BudgetExhausted {
+		t.Fatalf("budget stats=%+v err=%v", stats, err)
+	}
+	if stats, err = rollupSagas(context.Background(), cfg, r, "", never); err != nil || stats.Written != 1 || len(r.calls) != 2 {
+		t.Fatalf("stale stats=%+v err=%v calls=%v", stats, err, r.calls)
+	}
+}
+
+var record = flag.Bool("record", false, "re-record testdata cassettes against the OpenAI API (needs OPENAI_API_KEY)")
+
+func TestOpenAIThreadRolluper_Cassette(t *testing.T) {
+	t.Parallel()
+
+	cas, err := provider.OpenCassette(filepath.Join("testdata", "rollup.cassette.json"), *record)
+	if err != nil {
+		t.Fatalf("OpenCassette: %v", err)
+	}
+	defer func() {
+		if err := cas.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}()
+	client := cas.Client()
+	start := 1717200000.0
+	chunks := []migration.ChunkSummary{
+		{
+			ConversationID: "cassette-lisbon", ThreadStart: &start, ChunkNumber: 0, TurnStart: 0, TurnEnd: 4, OriginalTitle: "Moving to Lisbon",
+			Summary:   "The user accepted a job in Lisbon and planned the D7 visa: get a NIF first, then prove income and accommodation.",
+			KeyPoints: []string{"Job offer in Lisbon, start in September", "Get the NIF remotely first", "Budget 1200 EUR for a one-bedroom"},
+			Tags:      []string{"relocation", "visa"},
+		},
+		{
+			ConversationID: "cassette-lisbon", ThreadStart: &start, ChunkNumber: 1, TurnStart: 4, TurnEnd: 8, OriginalTitle: "Moving to Lisbon",
+			Summary:   "They compared Arroios and Alvalade and booked a July scouting trip to view flats.",
+			KeyPoints: []string{"Arroios fits the budget", "Scouting trip booked for July"},
+			Tags:      []string{"relocation", "housing"},
+		},
+	}
+	sentiments := []migration.ChunkSentimentSummary{
+		{ConversationID: "cassette-lisbon", ChunkNumber: 0, EmotionalSummary: "Excited about the offer but anxious about paperwork.", DominantEmotions: []string{"excitement", "anxiety"}},
+		{ConversationID: "cassette-lisbon", ChunkNumber: 1, EmotionalSummary: "Anxiety eases into confidence once a plan exists.", DominantEmotions: []string{"relief", "confidence"}},
+	}
+
+	rolluper := openAIThreadRolluper{client: &client, model: "gpt-5-mini"}
+	sum, err := rolluper.Rollup(context.Background(), "cassette-lisbon", chunks, "", "")
+	if err != nil {
+		t.Fatalf("Rollup: %v", err)
+	}
+	if sum.Summary == "" || sum.Title == "" || len(sum.KeyPoints) == 0 || sum.Model != "gpt-5-mini" {
+		t.Fatalf("rollup=%+v", sum)
+	}
+	// The recorded reply cites chunk 7, which the thread does not have.
+	if want := [][]int{{0}, {0}, {0, 1}, {1}}; !reflect.DeepEqual(sum.KeyPointSources, want) {
+		t.Fatalf("key_point_sources=%v, want %v", sum.KeyPointSources, want)
+	}
+	sentRolluper := openAIThreadSentimentRolluper{client: &client, model: "gpt-5-mini"}
+	sent, err := sentRolluper.Rollup(context.Background(), "cassette-lisbon", sentiments, "")
+	if err != nil {
+		t.Fatalf("sentiment Rollup: %v", err)
+	}
+	if sent.EmotionalSummary == "" || len(sent.DominantEmotions) == 0 {
+		t.Fatalf("sentiment rollup=%+v", sent)
+	}
+}
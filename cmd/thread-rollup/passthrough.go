@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+)
+
+// passthroughTitleMaxWords bounds titles taken from the first sentence of a summary.
+const passthroughTitleMaxWords = 8
+
+// passthroughThreadSummary builds the rollup of a single-chunk thread from its chunk summary without
+// a model call: a rollup of one chunk would mostly restate it.
+func passthroughThreadSummary(conversationID string, c migration.ChunkSummary) migration.ThreadSummary {
+	summary := strings.TrimSpace(c.Summary)
+	return migration.ThreadSummary{
+		ConversationID:  conversationID,
+		Title:           passthroughTitle(c.OriginalTitle, summary),
+		OriginalTitle:   c.OriginalTitle,
+		Project:         c.Project,
+		SourceType:      c.SourceType,
+		ThreadStart:     c.ThreadStart,
+		ThreadUpdate:    c.ThreadUpdate,
+		Summary:         summary,
+		MicroSummary:    migration.ClampMicroSummary(summary),
+		KeyPoints:       c.KeyPoints,
+		KeyPointSources: passthroughKeyPointSources(len(c.KeyPoints), c.ChunkNumber),
+		Tags:            c.Tags,
+		Terms:           c.Terms,
+		SourceTokens:    c.SourceTokens,
+		Model:           c.Model,
+		Passthrough:     true,
+	}
+}
+
+// passthroughKeyPointSources cites the one chunk for each of a passthrough rollup's n key points.
+func passthroughKeyPointSources(n, chunk int) [][]int {
+	if n == 0 {
+		return nil
+	}
+	out := make([][]int, n)
+	for i := range out {
+		out[i] = []int{chunk}
+	}
+	return out
+}
+
+// passthroughThreadSentimentSummary is passthroughThreadSummary for sentiment rollups. The title is
+// filled in from the semantic rollup by retitleThread.
+func passthroughThreadSentimentSummary(conversationID string, c migration.ChunkSentimentSummary) migration.ThreadSentimentSummary {
+	return migration.ThreadSentimentSummary{
+		ConversationID:     conversationID,
+		Title:              migration.ThreadTitle("", c.OriginalTitle),
+		OriginalTitle:      c.OriginalTitle,
+		Project:            c.Project,
+		SourceType:         c.SourceType,
+		ThreadStart:        c.ThreadStart,
+		ThreadUpdate:       c.ThreadUpdate,
+		EmotionalSummary:   strings.TrimSpace(c.EmotionalSummary),
+		DominantEmotions:   c.DominantEmotions,
+		RememberedEmotions: c.RememberedEmotions,
+		PresentEmotions:    c.PresentEmotions,
+		EmotionalTensions:  c.EmotionalTensions,
+		RelationalShift:    strings.TrimSpace(c.RelationalShift),
+		EmotionalArc:       strings.TrimSpace(c.EmotionalArc),
+		Themes:             c.Themes,
+		SymbolsOrMetaphors: c.SymbolsOrMetaphors,
+		ResonanceNotes:     c.ResonanceNotes,
+		ToneMarkers:        c.ToneMarkers,
+		SentimentEvidence:  c.SentimentEvidence,
+		Model:              c.Model,
+		Passthrough:        true,
+	}
+}
+
+// passthroughTitle keeps the export title unless it is a placeholder, in which case the title is the
+// first few words of the summary's first sentence.
+func passthroughTitle(original, summary string) string {
+	if t := migration.NormalizeTitle(original); !migration.IsPlaceholderTitle(t) {
+		return t
+	}
+	sentence := summary
+	if i := strings.IndexAny(sentence, ".!?\n"); i >= 0 {
+		sentence = sentence[:i]
+	}
+	words := strings.Fields(sentence)
+	if len(words) > passthroughTitleMaxWords {
+		words = words[:passthroughTitleMaxWords]
+	}
+	title := strings.TrimRightFunc(strings.Join(words, " "), func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSpace(r)
+	})
+	return migration.ThreadTitle(title, original)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// Supported vector database targets.
+const (
+	targetQdrant   = "qdrant"
+	targetChroma   = "chroma"
+	targetPGVector = "pgvector"
+)
+
+// Record kinds.
+const (
+	kindThread   = "thread"
+	kindChunk    = "chunk"
+	kindKeyPoint = "key_point"
+)
+
+type Config struct {
+	Target     string
+	URL        string
+	Collection string
+	DBAPIKey   string
+
+	ChromaTenant   string
+	ChromaDatabase string
+	// PGOut writes pgvector upserts to this SQL script instead of applying them at URL.
+	PGOut string
+
+	SummariesDir       string
+	ThreadSummariesDir string
+	ThreadSentimentDir string
+	KeyPointsPath      string
+	Kinds              string
+
+	EmbeddingsPath string
+	EmbeddingModel string
+	BatchSize      int
+	APIKey         string
+}
+
+func (c Config) Validate() error {
+	switch c.Target {
+	case targetQdrant, targetChroma:
+		if c.URL == "" {
+			return errors.New("missing -url")
+		}
+	case targetPGVector:
+		if c.URL == "" && c.PGOut == "" {
+			return errors.New("missing -url or -pg-out")
+		}
+	default:
+		return errors.New("target must be qdrant, chroma, or pgvector")
+	}
+	if c.Collection == "" {
+		return errors.New("missing -collection")
+	}
+	if c.EmbeddingModel == "" {
+		return errors.New("missing -embedding-model")
+	}
+	if c.BatchSize <= 0 {
+		return errors.New("batch-size must be > 0")
+	}
+	kinds := c.kinds()
+	if len(kinds) == 0 {
+		return errors.New("kinds must list thread, chunk, and/or key_point")
+	}
+	for k := range kinds {
+		if k != kindThread && k != kindChunk && k != kindKeyPoint {
+			return errors.New("kinds must list thread, chunk, and/or key_point")
+		}
+	}
+	if kinds[kindThread] && c.ThreadSummariesDir == "" {
+		return errors.New("missing -thread-summaries")
+	}
+	if kinds[kindChunk] && c.SummariesDir == "" {
+		return errors.New("missing -summaries")
+	}
+	if kinds[kindKeyPoint] && c.KeyPointsPath == "" {
+		return errors.New("missing -key-points")
+	}
+	return nil
+}
+
+func (c Config) kinds() map[string]bool {
+	out := map[string]bool{}
+	for _, k := range strings.Split(c.Kinds, ",") {
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			out[k] = true
+		}
+	}
+	return out
+}
+
+func defaultConfig() Config {
+	return Config{
+		Target:             targetQdrant,
+		Collection:         "compress_o_bot",
+		ChromaTenant:       "default_tenant",
+		ChromaDatabase:     "default_database",
+		SummariesDir:       filepath.FromSlash("docs/peanut-gallery/threads/summaries"),
+		ThreadSummariesDir: filepath.FromSlash("docs/peanut-gallery/threads/thread_summaries"),
+		ThreadSentimentDir: filepath.FromSlash("docs/peanut-gallery/threads/thread_sentiment_summaries"),
+		Kinds:              "thread,chunk,key_point",
+		EmbeddingsPath:     filepath.FromSlash("docs/peanut-gallery/threads/embeddings.jsonl"),
+		EmbeddingModel:     "text-embedding-3-small",
+		BatchSize:          64,
+	}
+}
+
+// defaultURL is the local default endpoint for target when -url is not given.
+func defaultURL(target string) string {
+	switch target {
+	case targetQdrant:
+		return "http://localhost:6333"
+	case targetChroma:
+		return "http://localhost:8000"
+	case targetPGVector:
+		return "postgres://localhost:5432/postgres"
+	}
+	return ""
+}
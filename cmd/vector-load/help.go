@@ -0,0 +1,19 @@
+package main
+
+import "github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+
+var help = cli.Help{
+	Name:    "vector-load",
+	Summary: "embed summaries and key points and load them into a vector database",
+	Groups: []cli.Group{
+		{Title: "Target", Flags: []string{"target", "url", "collection", "db-api-key", "chroma-tenant", "chroma-database", "pg-out"}},
+		{Title: "Records", Flags: []string{"summaries", "thread-summaries", "thread-sentiment-summaries", "key-points", "kinds"}},
+		{Title: "Embeddings", Flags: []string{"embeddings", "embedding-model", "batch-size", "api-key"}},
+	},
+	Examples: []cli.Example{
+		{Comment: "load threads and chunks into a local qdrant", Command: "vector-load -target qdrant -kinds thread,chunk"},
+		{Comment: "upsert into a pgvector table (psql must be on PATH)", Command: "vector-load -target pgvector -url postgres://me@localhost:5432/memories -collection memories"},
+		{Comment: "write a pgvector upsert script to apply later", Command: "vector-load -target pgvector -pg-out memories.sql\n  psql -f memories.sql"},
+	},
+	Values: map[string][]string{"target": {targetQdrant, targetChroma, targetPGVector}},
+}
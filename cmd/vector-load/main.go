@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/cli"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+)
+
+func main() {
+	cfg, err := parseFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	if err := layout.LoadConventionsFromEnv(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	recs, err := loadRecords(fileutils.OS, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if len(recs) == 0 {
+		fmt.Fprintln(os.Stderr, "no thread summaries, chunk summaries, or key points found")
+		os.Exit(2)
+	}
+
+	cache, err := loadEmbeddingCache(cfg.EmbeddingsPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	var emb embedder
+	if cache.misses(recs, cfg.EmbeddingModel) > 0 {
+		apiKey := cfg.APIKey
+		if apiKey == "" {
+			apiKey = os.Getenv("OPENAI_API_KEY")
+		}
+		if apiKey == "" {
+			fmt.Fprintln(os.Stderr, "missing OPENAI_API_KEY (or pass -api-key); needed to embed records not in -embeddings")
+			os.Exit(2)
+		}
+		client := openai.NewClient(option.WithAPIKey(apiKey))
+		emb = &openAIEmbedder{client: client, model: cfg.EmbeddingModel}
+	}
+
+	s, err := newSink(cfg, &http.Client{Timeout: 2 * time.Minute})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	st, err := run(ctx, cfg, recs, cache, emb, s)
+	if cerr := s.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stdout, "records=%d embedded=%d cached=%d target=%s collection=%s\n", st.Records, st.Embedded, st.Cached, cfg.Target, cfg.Collection)
+}
+
+type runStats struct {
+	Records  int
+	Embedded int
+	Cached   int
+}
+
+// run embeds records (reusing cached vectors), saves the cache, and upserts in batches of cfg.BatchSize.
+func run(ctx context.Context, cfg Config, recs []vectorRecord, cache *embeddingCache, emb embedder, s sink) (runStats, error) {
+	st := runStats{Records: len(recs)}
+	var pending []int
+	for i := range recs {
+		if v, ok := cache.lookup(recs[i], cfg.EmbeddingModel); ok {
+			recs[i].Vector = v
+			st.Cached++
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	for start := 0; start < len(pending); start += cfg.BatchSize {
+		if emb == nil {
+			return st, errors.New("embedder is not configured")
+		}
+		end := min(start+cfg.BatchSize, len(pending))
+		texts := make([]string, 0, end-start)
+		for _, i := range pending[start:end] {
+			texts = append(texts, recs[i].Text)
+		}
+		vecs, err := emb.Embed(ctx, texts)
+		if err != nil {
+			return st, fmt.Errorf("embed: %w", err)
+		}
+		if len(vecs) != len(texts) {
+			return st, fmt.Errorf("embed: got %d vectors for %d inputs", len(vecs), len(texts))
+		}
+		for j, i := range pending[start:end] {
+			recs[i].Vector = vecs[j]
+			cache.store(recs[i], cfg.EmbeddingModel)
+		}
+		st.Embedded += len(texts)
+		fmt.Fprintf(os.Stderr, "embedded %d/%d\n", st.Embedded, len(pending))
+	}
+	if st.Embedded > 0 && cfg.EmbeddingsPath != "" {
+		if err := cache.save(cfg.EmbeddingsPath); err != nil {
+			return st, err
+		}
+	}
+
+	for start := 0; start < len(recs); start += cfg.BatchSize {
+		end := min(start+cfg.BatchSize, len(recs))
+		if err := s.Upsert(ctx, recs[start:end]); err != nil {
+			return st, err
+		}
+		fmt.Fprintf(os.Stderr, "upserted %d/%d\n", end, len(recs))
+	}
+	return st, nil
+}
+
+// embedder turns texts into vectors, one per input in order.
+type embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+type openAIEmbedder struct {
+	client openai.Client
+	model  string
+}
+
+func (e *openAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	resp, err := e.client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: texts},
+		Model: openai.EmbeddingModel(e.model),
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]float64, len(texts))
+	for _, d := range resp.Data {
+		if d.Index < 0 || int(d.Index) >= len(out) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		out[d.Index] = d.Embedding
+	}
+	for i, v := range out {
+		if len(v) == 0 {
+			return nil, fmt.Errorf("missing embedding for input %d", i)
+		}
+	}
+	return out, nil
+}
+
+// embeddingRow is one line of the -embeddings JSONL cache.
+type embeddingRow struct {
+	Key        string    `json:"key"`
+	Model      string    `json:"model"`
+	TextSHA256 string    `json:"text_sha256"`
+	Embedding  []float64 `json:"embedding"`
+}
+
+// embeddingCache holds previously computed vectors keyed by record key. A row is reused only when the
+// model and text hash still match, so edited summaries are re-embedded.
+type embeddingCache struct {
+	rows map[string]embeddingRow
+}
+
+func loadEmbeddingCache(path string) (*embeddingCache, error) {
+	c := &embeddingCache{rows: map[string]embeddingRow{}}
+	if path == "" {
+		return c, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open -embeddings: %w", err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 1<<20), 64<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		b := bytes.TrimSpace(sc.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		var row embeddingRow
+		if err := json.Unmarshal(b, &row); err != nil {
+			return nil, fmt.Errorf("parse -embeddings line %d: %w", line, err)
+		}
+		if row.Key != "" && len(row.Embedding) > 0 {
+			c.rows[row.Key] = row
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read -embeddings: %w", err)
+	}
+	return c, nil
+}
+
+func (c *embeddingCache) lookup(r vectorRecord, model string) ([]float64, bool) {
+	row, ok := c.rows[r.Key]
+	if !ok || row.Model != model || row.TextSHA256 != r.textHash() {
+		return nil, false
+	}
+	return row.Embedding, true
+}
+
+func (c *embeddingCache) misses(recs []vectorRecord, model string) int {
+	n := 0
+	for _, r := range recs {
+		if _, ok := c.lookup(r, model); !ok {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *embeddingCache) store(r vectorRecord, model string) {
+	c.rows[r.Key] = embeddingRow{Key: r.Key, Model: model, TextSHA256: r.textHash(), Embedding: r.Vector}
+}
+
+func (c *embeddingCache) save(path string) error {
+	keys := make([]string, 0, len(c.rows))
+	for k := range c.rows {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for _, k := range keys {
+		b, err := json.Marshal(c.rows[k])
+		if err != nil {
+			return fmt.Errorf("marshal embedding %s: %w", k, err)
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	if err := fileutils.WriteFileAtomicSameDir(path, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write -embeddings: %w", err)
+	}
+	return nil
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) (Config, error) {
+	cfg := defaultConfig()
+	fs.SetOutput(os.Stderr)
+	cli.Setup(fs, help)
+	fs.StringVar(&cfg.Target, "target", cfg.Target, "Vector database: qdrant, chroma, or pgvector")
+	fs.StringVar(&cfg.URL, "url", "", "Base URL of the qdrant/chroma server, or the pgvector database's postgres:// connection URI (default: localhost on the target's standard port)")
+	fs.StringVar(&cfg.Collection, "collection", cfg.Collection, "Collection (qdrant/chroma) or table (pgvector) name")
+	fs.StringVar(&cfg.DBAPIKey, "db-api-key", "", "Vector database API key (qdrant api-key / chroma x-chroma-token)")
+	fs.StringVar(&cfg.ChromaTenant, "chroma-tenant", cfg.ChromaTenant, "Chroma tenant")
+	fs.StringVar(&cfg.ChromaDatabase, "chroma-database", cfg.ChromaDatabase, "Chroma database")
+	fs.StringVar(&cfg.PGOut, "pg-out", "", "pgvector: write the upserts to this SQL script (apply later with psql -f) instead of applying them at -url")
+	fs.StringVar(&cfg.SummariesDir, "summaries", cfg.SummariesDir, "Path to chunk summaries directory (*.summary.json, *.sentiment.summary.json)")
+	fs.StringVar(&cfg.ThreadSummariesDir, "thread-summaries", cfg.ThreadSummariesDir, "Path to thread rollups directory (*.thread.summary.json)")
+	fs.StringVar(&cfg.ThreadSentimentDir, "thread-sentiment-summaries", cfg.ThreadSentimentDir, "Path to thread sentiment rollups directory (emotion/theme metadata; optional)")
+	fs.StringVar(&cfg.KeyPointsPath, "key-points", "", "Path to chunk-summarizer's key_points.jsonl (default: <summaries>/key_points.jsonl)")
+	fs.StringVar(&cfg.Kinds, "kinds", cfg.Kinds, "Comma-separated record kinds to load: thread, chunk, key_point")
+	fs.StringVar(&cfg.EmbeddingsPath, "embeddings", cfg.EmbeddingsPath, "JSONL embeddings cache; vectors are reused when model and text match, and new vectors are saved back (empty disables)")
+	fs.StringVar(&cfg.EmbeddingModel, "embedding-model", cfg.EmbeddingModel, "OpenAI embedding model for records not in -embeddings")
+	fs.IntVar(&cfg.BatchSize, "batch-size", cfg.BatchSize, "Records per embedding request and per upsert")
+	fs.StringVar(&cfg.APIKey, "api-key", "", "OpenAI API key (optional; defaults to OPENAI_API_KEY; only needed when embedding)")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.URL == "" && cfg.PGOut == "" {
+		cfg.URL = defaultURL(cfg.Target)
+	}
+	for _, p := range []*string{&cfg.PGOut, &cfg.SummariesDir, &cfg.ThreadSummariesDir, &cfg.ThreadSentimentDir, &cfg.KeyPointsPath, &cfg.EmbeddingsPath} {
+		if *p != "" {
+			*p = filepath.Clean(*p)
+		}
+	}
+	if cfg.KeyPointsPath == "" && cfg.SummariesDir != "" {
+		cfg.KeyPointsPath = filepath.Join(cfg.SummariesDir, migration.KeyPointsFileName)
+	}
+	return cfg, nil
+}
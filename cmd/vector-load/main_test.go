@@ -0,0 +1,463 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+func TestParseFlags_Defaults(t *testing.T) {
+	t.Parallel()
+
+	fs := flag.NewFlagSet("vector-load", flag.ContinueOnError)
+	cfg, err := parseFlags(fs, []string{"-target", "chroma"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.URL != "http://localhost:8000" {
+		t.Fatalf("URL=%q", cfg.URL)
+	}
+	if cfg.KeyPointsPath != filepath.Join(cfg.SummariesDir, migration.KeyPointsFileName) {
+		t.Fatalf("KeyPointsPath=%q", cfg.KeyPointsPath)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	fs = flag.NewFlagSet("vector-load", flag.ContinueOnError)
+	cfg, err = parseFlags(fs, []string{"-target", "pgvector", "-collection", "memories", "-kinds", "thread"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.PGOut != "" || cfg.URL != "postgres://localhost:5432/postgres" {
+		t.Fatalf("PGOut=%q URL=%q", cfg.PGOut, cfg.URL)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	fs = flag.NewFlagSet("vector-load", flag.ContinueOnError)
+	cfg, err = parseFlags(fs, []string{"-target", "pgvector", "-pg-out", "memories.sql", "-kinds", "thread"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.PGOut != "memories.sql" || cfg.URL != "" {
+		t.Fatalf("PGOut=%q URL=%q", cfg.PGOut, cfg.URL)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	cfg.Kinds = "thread,turn"
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected error for unknown kind")
+	}
+}
+
+func writeTestJSON(t *testing.T, path string, v any) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func testConfig(t *testing.T) Config {
+	t.Helper()
+	root := t.TempDir()
+	cfg := defaultConfig()
+	cfg.SummariesDir = filepath.Join(root, "summaries")
+	cfg.ThreadSummariesDir = filepath.Join(root, "thread_summaries")
+	cfg.ThreadSentimentDir = filepath.Join(root, "thread_sentiment_summaries")
+	cfg.EmbeddingsPath = filepath.Join(root, "embeddings.jsonl")
+	cfg.BatchSize = 2
+
+	start := 1700000000.0
+	writeTestJSON(t, filepath.Join(cfg.ThreadSummariesDir, "c1.thread.summary.json"), migration.ThreadSummary{
+		ConversationID: "c1", Title: "Trip planning", ThreadStart: &start,
+		Summary: "Planned a trip.", KeyPoints: []string{"Book trains"}, Tags: []string{"Travel", "travel"},
+	})
+	writeTestJSON(t, filepath.Join(cfg.ThreadSentimentDir, "c1.thread.sentiment.summary.json"), migration.ThreadSentimentSummary{
+		ConversationID: "c1", DominantEmotions: []string{"Excitement"}, PresentEmotions: []string{"anxiety"}, Themes: []string{"adventure"},
+	})
+	writeTestJSON(t, filepath.Join(cfg.SummariesDir, "c1", "c1_chunk_0001.summary.json"), migration.ChunkSummary{
+		ConversationID: "c1", ChunkNumber: 1, ThreadStart: &start, Summary: "Compared routes.", Tags: []string{"rail"},
+	})
+	writeTestJSON(t, filepath.Join(cfg.SummariesDir, "c1", "c1_chunk_0001.sentiment.summary.json"), migration.ChunkSentimentSummary{
+		ConversationID: "c1", ChunkNumber: 1, DominantEmotions: []string{"curiosity"},
+	})
+	return cfg
+}
+
+func TestLoadRecords_Metadata(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+	recs, err := loadRecords(fileutils.OS, cfg)
+	if err != nil {
+		t.Fatalf("loadRecords: %v", err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("len(recs)=%d", len(recs))
+	}
+
+	th := recs[0]
+	if th.Key != "thread:c1" || !strings.Contains(th.Text, "Book trains") {
+		t.Fatalf("thread=%+v", th)
+	}
+	if got := th.Metadata["tags"].([]string); len(got) != 1 || got[0] != "travel" {
+		t.Fatalf("tags=%v", got)
+	}
+	if got := th.Metadata["emotions"].([]string); len(got) != 2 || got[0] != "excitement" {
+		t.Fatalf("emotions=%v", got)
+	}
+	if th.Metadata["thread_start"] != int64(1700000000) || th.Metadata["month"] != "2023-11" || th.Metadata["year"] != 2023 {
+		t.Fatalf("time metadata=%v", th.Metadata)
+	}
+
+	ch := recs[1]
+	if ch.Key != "chunk:c1/c1_chunk_0001.summary.json" || ch.Metadata["title"] != "Trip planning" || ch.Metadata["chunk_number"] != 1 {
+		t.Fatalf("chunk=%+v", ch)
+	}
+	if got := ch.Metadata["emotions"].([]string); len(got) != 1 || got[0] != "curiosity" {
+		t.Fatalf("chunk emotions=%v", got)
+	}
+}
+
+func TestLoadRecords_KeyPoints(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+	cfg.Kinds = "thread,key_point"
+	cfg.KeyPointsPath = filepath.Join(cfg.SummariesDir, migration.KeyPointsFileName)
+	start, at := 1700000000.0, 1700000500.0
+	rows := []migration.KeyPointRecord{
+		{ID: "c1:1:0", ConversationID: "c1", ThreadStart: &start, ChunkNumber: 1, ChunkTime: &at, Text: "Booked the 9:15 train", SummaryPath: "summaries/c1/c1_chunk_0001.summary.json"},
+		{ID: "c1:1:1", ConversationID: "c1", ChunkNumber: 1, Text: "  "},
+	}
+	var b strings.Builder
+	for _, r := range rows {
+		line, _ := json.Marshal(r)
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	if err := os.WriteFile(cfg.KeyPointsPath, []byte(b.String()), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	recs, err := loadRecords(fileutils.OS, cfg)
+	if err != nil {
+		t.Fatalf("loadRecords: %v", err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("len(recs)=%d", len(recs))
+	}
+	kp := recs[1]
+	if kp.Key != "key_point:c1:1:0" || kp.Text != "Trip planning\n\nBooked the 9:15 train" {
+		t.Fatalf("key point=%+v", kp)
+	}
+	if kp.Metadata["kind"] != kindKeyPoint || kp.Metadata["chunk_number"] != 1 || kp.Metadata["chunk_time"] != int64(1700000500) || kp.Metadata["month"] != "2023-11" {
+		t.Fatalf("metadata=%v", kp.Metadata)
+	}
+
+	// Summaries written before key_points.jsonl existed load without key points.
+	cfg.KeyPointsPath = filepath.Join(t.TempDir(), migration.KeyPointsFileName)
+	if recs, err := loadRecords(fileutils.OS, cfg); err != nil || len(recs) != 1 {
+		t.Fatalf("missing file: len=%d err=%v", len(recs), err)
+	}
+}
+
+func TestLoadRecords_FromFS(t *testing.T) {
+	t.Parallel()
+
+	file := func(v any) *fstest.MapFile {
+		b, _ := json.Marshal(v)
+		return &fstest.MapFile{Data: b}
+	}
+	fsys := fstest.MapFS{
+		"threads/thread_summaries/c1.thread.summary.json":                     file(migration.ThreadSummary{ConversationID: "c1", Title: "Trip planning", Summary: "Planned a trip."}),
+		"threads/thread_sentiment_summaries/c1.thread.sentiment.summary.json": file(migration.ThreadSentimentSummary{ConversationID: "c1", DominantEmotions: []string{"joy"}}),
+		"threads/summaries/c1/c1_chunk_0001.summary.json":                     file(migration.ChunkSummary{ConversationID: "c1", ChunkNumber: 1, Summary: "Compared routes."}),
+	}
+	cfg := defaultConfig()
+	cfg.ThreadSummariesDir = filepath.FromSlash("threads/thread_summaries")
+	cfg.ThreadSentimentDir = filepath.FromSlash("threads/thread_sentiment_summaries")
+	cfg.SummariesDir = filepath.FromSlash("./threads/summaries")
+	cfg.KeyPointsPath = filepath.FromSlash("threads/summaries/key_points.jsonl")
+
+	recs, err := loadRecords(fsys, cfg)
+	if err != nil {
+		t.Fatalf("loadRecords: %v", err)
+	}
+	if len(recs) != 2 || recs[0].Key != "thread:c1" || recs[1].Key != "chunk:c1/c1_chunk_0001.summary.json" {
+		t.Fatalf("recs=%+v", recs)
+	}
+	if got := recs[0].Metadata["emotions"].([]string); len(got) != 1 || got[0] != "joy" {
+		t.Fatalf("sentiment not joined: %v", recs[0].Metadata)
+	}
+}
+
+type fakeEmbedder struct {
+	calls int
+}
+
+func (f *fakeEmbedder) Embed(_ context.Context, texts []string) ([][]float64, error) {
+	f.calls++
+	out := make([][]float64, len(texts))
+	for i, s := range texts {
+		out[i] = []float64{float64(len(s)), 1, 0}
+	}
+	return out, nil
+}
+
+type memSink struct {
+	recs []vectorRecord
+}
+
+func (m *memSink) Upsert(_ context.Context, recs []vectorRecord) error {
+	m.recs = append(m.recs, recs...)
+	return nil
+}
+
+func (m *memSink) Close() error { return nil }
+
+func TestRun_ReusesCachedEmbeddings(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+	recs, err := loadRecords(fileutils.OS, cfg)
+	if err != nil {
+		t.Fatalf("loadRecords: %v", err)
+	}
+	cache, err := loadEmbeddingCache(cfg.EmbeddingsPath)
+	if err != nil {
+		t.Fatalf("loadEmbeddingCache: %v", err)
+	}
+	emb := &fakeEmbedder{}
+	s := &memSink{}
+	st, err := run(context.Background(), cfg, recs, cache, emb, s)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if st.Embedded != 2 || st.Cached != 0 || len(s.recs) != 2 {
+		t.Fatalf("first run stats=%+v upserted=%d", st, len(s.recs))
+	}
+
+	// Second run: nothing changed, so every vector comes from the cache and no embedder is needed.
+	recs, _ = loadRecords(fileutils.OS, cfg)
+	cache, err = loadEmbeddingCache(cfg.EmbeddingsPath)
+	if err != nil {
+		t.Fatalf("loadEmbeddingCache: %v", err)
+	}
+	if n := cache.misses(recs, cfg.EmbeddingModel); n != 0 {
+		t.Fatalf("misses=%d", n)
+	}
+	st, err = run(context.Background(), cfg, recs, cache, nil, &memSink{})
+	if err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if st.Cached != 2 || st.Embedded != 0 {
+		t.Fatalf("second run stats=%+v", st)
+	}
+
+	// A different model invalidates the cache.
+	if n := cache.misses(recs, "text-embedding-3-large"); n != 2 {
+		t.Fatalf("misses for other model=%d", n)
+	}
+}
+
+func TestQdrantSink_CreatesCollectionAndUpserts(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var calls []string
+	var upsert map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		if r.Header.Get("api-key") != "secret" {
+			t.Errorf("api-key=%q", r.Header.Get("api-key"))
+		}
+		switch {
+		case r.Method == http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case strings.HasSuffix(r.URL.Path, "/points"):
+			b, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(b, &upsert)
+		}
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer srv.Close()
+
+	s := &qdrantSink{baseURL: srv.URL, collection: "mem", apiKey: "secret", client: srv.Client()}
+	rec := vectorRecord{Key: "thread:c1", Text: "hello", Metadata: map[string]any{"kind": "thread"}, Vector: []float64{1, 2, 3}}
+	if err := s.Upsert(context.Background(), []vectorRecord{rec}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := s.Upsert(context.Background(), []vectorRecord{rec}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls[0] != "GET /collections/mem" || calls[1] != "PUT /collections/mem" {
+		t.Fatalf("calls=%v", calls)
+	}
+	if want := 2 + len(qdrantPayloadIndexes) + 2; len(calls) != want {
+		t.Fatalf("len(calls)=%d want %d: %v", len(calls), want, calls)
+	}
+	points := upsert["points"].([]any)
+	p := points[0].(map[string]any)
+	if p["id"] != rec.pointID() || p["payload"].(map[string]any)["key"] != "thread:c1" {
+		t.Fatalf("point=%v", p)
+	}
+}
+
+func TestChromaSink_FlattensMetadata(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var upsert map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/collections") {
+			_, _ = w.Write([]byte(`{"id":"abc","name":"mem"}`))
+			return
+		}
+		if r.URL.Path != "/api/v2/tenants/default_tenant/databases/default_database/collections/abc/upsert" {
+			t.Errorf("path=%q", r.URL.Path)
+		}
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &upsert)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	s := &chromaSink{baseURL: srv.URL, tenant: "default_tenant", database: "default_database", collection: "mem", client: srv.Client()}
+	rec := vectorRecord{
+		Key: "thread:c1", Text: "hello", Vector: []float64{1, 2},
+		Metadata: map[string]any{"kind": "thread", "emotions": []string{"quiet joy"}, "tags": []string{"travel", "rail"}},
+	}
+	if err := s.Upsert(context.Background(), []vectorRecord{rec}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	md := upsert["metadatas"].([]any)[0].(map[string]any)
+	if md["tags"] != "travel, rail" || md["tag_rail"] != true || md["emotion_quiet_joy"] != true {
+		t.Fatalf("metadata=%v", md)
+	}
+	if ids := upsert["ids"].([]any); ids[0] != "thread:c1" {
+		t.Fatalf("ids=%v", ids)
+	}
+}
+
+func TestPGVectorSink_WritesUpsertSQL(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "out", "mem.sql")
+	s, err := newPGVectorSink(path, "mem")
+	if err != nil {
+		t.Fatalf("newPGVectorSink: %v", err)
+	}
+	rec := vectorRecord{
+		Key: "thread:c1", Text: "it's fine", Vector: []float64{0.5, 1},
+		Metadata: map[string]any{"kind": "thread", "conversation_id": "c1", "thread_start": int64(1700000000), "emotions": []string{"calm"}},
+	}
+	if err := s.Upsert(context.Background(), []vectorRecord{rec}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	sql := string(b)
+	for _, want := range []string{
+		"embedding vector(2) NOT NULL",
+		`USING hnsw (embedding vector_cosine_ops)`,
+		"'it''s fine'",
+		"to_timestamp(1700000000)",
+		"ARRAY['calm']::text[]",
+		"'[0.5,1]'::vector",
+		"ON CONFLICT (id) DO UPDATE",
+		`CREATE INDEX IF NOT EXISTS "mem_tags_idx" ON "mem" USING gin (tags)`,
+	} {
+		if !strings.Contains(sql, want) {
+			t.Fatalf("sql missing %q:\n%s", want, sql)
+		}
+	}
+}
+
+func TestPGVectorConn_StreamsUpsertsToPSQL(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stub psql is a shell script")
+	}
+	// A stub psql records its arguments and the SQL it is sent, and fails like psql with
+	// ON_ERROR_STOP when the SQL contains FAIL.
+	dir := t.TempDir()
+	stub := `#!/bin/sh
+echo "$@" > "$(dirname "$0")/args"
+cat > "$(dirname "$0")/sql"
+if grep -q FAIL "$(dirname "$0")/sql"; then echo 'ERROR:  relation is broken' >&2; exit 3; fi
+`
+	if err := os.WriteFile(filepath.Join(dir, "psql"), []byte(stub), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	s, err := newPGVectorConn("postgres://me@localhost/mem", "mem")
+	if err != nil {
+		t.Fatalf("newPGVectorConn: %v", err)
+	}
+	rec := vectorRecord{Key: "thread:c1", Text: "hello", Vector: []float64{1, 0}, Metadata: map[string]any{"kind": "thread", "conversation_id": "c1"}}
+	if err := s.Upsert(context.Background(), []vectorRecord{rec}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	sql, _ := os.ReadFile(filepath.Join(dir, "sql"))
+	if !strings.Contains(string(args), "ON_ERROR_STOP=1 -d postgres://me@localhost/mem -f -") {
+		t.Fatalf("psql args=%q", args)
+	}
+	if !strings.Contains(string(sql), `INSERT INTO "mem"`) || !strings.Contains(string(sql), "ON CONFLICT (id) DO UPDATE") {
+		t.Fatalf("sql=%s", sql)
+	}
+
+	s, err = newPGVectorConn("postgres://me@localhost/mem", "mem")
+	if err != nil {
+		t.Fatalf("newPGVectorConn: %v", err)
+	}
+	rec.Text = "FAIL"
+	_ = s.Upsert(context.Background(), []vectorRecord{rec})
+	if err := s.Close(); err == nil || !strings.Contains(err.Error(), "relation is broken") {
+		t.Fatalf("Close err=%v, want psql's error", err)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/retrieval"
+)
+
+// maxEmbedChars keeps embedding inputs well under the model's 8k token input limit.
+const maxEmbedChars = 24000
+
+// vectorRecord is one thread, chunk, or key point ready to upsert.
+type vectorRecord struct {
+	// Key is the stable natural key ("thread:<conversation_id>", "chunk:<summary path>", or
+	// "key_point:<key point id>").
+	Key      string
+	Text     string
+	Metadata map[string]any
+	Vector   []float64
+}
+
+// pointID derives a deterministic UUID from the record key so reruns update points in place.
+func (r vectorRecord) pointID() string {
+	sum := sha1.Sum([]byte(r.Key))
+	sum[6] = (sum[6] & 0x0f) | 0x50 // version 5
+	sum[8] = (sum[8] & 0x3f) | 0x80 // RFC 4122 variant
+	h := hex.EncodeToString(sum[:16])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+func (r vectorRecord) textHash() string {
+	sum := sha256.Sum256([]byte(r.Text))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadRecords builds thread, chunk and/or key point records from the summary directories and
+// key_points.jsonl on fsys, joining sentiment artifacts for emotion metadata.
+func loadRecords(fsys fs.FS, cfg Config) ([]vectorRecord, error) {
+	kinds := cfg.kinds()
+	titles := map[string]string{}
+	var out []vectorRecord
+
+	if kinds[kindThread] {
+		paths, err := migration.ArtifactPaths(fsys, cfg.ThreadSummariesDir, layout.ThreadSummary)
+		if err != nil {
+			return nil, fmt.Errorf("walk thread summaries: %w", err)
+		}
+		for _, p := range paths {
+			var ts migration.ThreadSummary
+			if err := readJSON(fsys, p, &ts); err != nil {
+				return nil, err
+			}
+			if ts.ConversationID == "" {
+				continue
+			}
+			titles[ts.ConversationID] = ts.Title
+			var sent migration.ThreadSentimentSummary
+			if cfg.ThreadSentimentDir != "" {
+				_ = readArtifact(fsys, fileutils.JoinFS(fsys, cfg.ThreadSentimentDir, ts.ConversationID), layout.ThreadSentiment, &sent)
+			}
+			if rec, ok := threadRecord(ts, sent, p); ok {
+				out = append(out, rec)
+			}
+		}
+	}
+
+	if kinds[kindChunk] {
+		paths, err := migration.ArtifactPaths(fsys, cfg.SummariesDir, layout.ChunkSummary)
+		if err != nil {
+			return nil, fmt.Errorf("walk chunk summaries: %w", err)
+		}
+		for _, p := range paths {
+			var cs migration.ChunkSummary
+			if err := readJSON(fsys, p, &cs); err != nil {
+				return nil, err
+			}
+			if cs.ConversationID == "" {
+				continue
+			}
+			var sent migration.ChunkSentimentSummary
+			_, base, _ := layout.Detect(p)
+			_ = readArtifact(fsys, base, layout.ChunkSentiment, &sent)
+			rel, err := filepath.Rel(fileutils.FSPath(fsys, cfg.SummariesDir), p)
+			if err != nil {
+				return nil, err
+			}
+			title := titles[cs.ConversationID]
+			if title == "" {
+				title = migration.NormalizeTitle(cs.OriginalTitle)
+			}
+			if rec, ok := chunkRecord(cs, sent, filepath.ToSlash(rel), title); ok {
+				out = append(out, rec)
+			}
+		}
+	}
+
+	if kinds[kindKeyPoint] {
+		kps, err := readKeyPoints(fsys, cfg.KeyPointsPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, kp := range kps {
+			if rec, ok := keyPointRecord(kp, titles[kp.ConversationID]); ok {
+				out = append(out, rec)
+			}
+		}
+	}
+	return out, nil
+}
+
+func threadRecord(ts migration.ThreadSummary, sent migration.ThreadSentimentSummary, path string) (vectorRecord, bool) {
+	text := embedText(ts.Title, ts.Summary, ts.KeyPoints)
+	if text == "" {
+		return vectorRecord{}, false
+	}
+	md := baseMetadata(kindThread, ts.ConversationID, ts.Title, ts.Project, ts.ThreadStart)
+	setList(md, "tags", ts.Tags)
+	setList(md, "terms", ts.Terms)
+	setList(md, "emotions", append(append([]string{}, sent.DominantEmotions...), sent.PresentEmotions...))
+	setList(md, "themes", sent.Themes)
+	md["source_type"] = migration.NormalizeSourceType(ts.SourceType)
+	md["source_path"] = filepath.ToSlash(path)
+	return vectorRecord{Key: retrieval.ThreadKey(ts.ConversationID), Text: text, Metadata: md}, true
+}
+
+func chunkRecord(cs migration.ChunkSummary, sent migration.ChunkSentimentSummary, rel string, title string) (vectorRecord, bool) {
+	text := embedText(title, cs.Summary, cs.KeyPoints)
+	if text == "" {
+		return vectorRecord{}, false
+	}
+	md := baseMetadata(kindChunk, cs.ConversationID, title, cs.Project, cs.ThreadStart)
+	md["source_type"] = migration.NormalizeSourceType(cs.SourceType)
+	md["chunk_number"] = cs.ChunkNumber
+	md["turn_start"] = cs.TurnStart
+	md["turn_end"] = cs.TurnEnd
+	setList(md, "tags", cs.Tags)
+	setList(md, "terms", cs.Terms)
+	setList(md, "emotions", append(append([]string{}, sent.DominantEmotions...), sent.PresentEmotions...))
+	setList(md, "themes", sent.Themes)
+	md["source_path"] = rel
+	return vectorRecord{Key: retrieval.ChunkKey(rel), Text: text, Metadata: md}, true
+}
+
+// keyPointRecord embeds a single key point, prefixed with its thread title for context.
+func keyPointRecord(kp migration.KeyPointRecord, title string) (vectorRecord, bool) {
+	text := strings.TrimSpace(kp.Text)
+	if text == "" || kp.ID == "" {
+		return vectorRecord{}, false
+	}
+	if t := strings.TrimSpace(title); t != "" {
+		text = t + "\n\n" + text
+	}
+	md := baseMetadata(kindKeyPoint, kp.ConversationID, title, "", kp.ThreadStart)
+	md["chunk_number"] = kp.ChunkNumber
+	md["turn_start"] = kp.TurnStart
+	md["turn_end"] = kp.TurnEnd
+	if kp.ChunkTime != nil && *kp.ChunkTime > 0 {
+		md["chunk_time"] = int64(*kp.ChunkTime)
+	}
+	md["key_point"] = strings.TrimSpace(kp.Text)
+	md["source_path"] = filepath.ToSlash(kp.SummaryPath)
+	return vectorRecord{Key: kindKeyPoint + ":" + kp.ID, Text: fileutils.Truncate(text, maxEmbedChars), Metadata: md}, true
+}
+
+// baseMetadata holds the filterable fields shared by thread and chunk records. Time is stored as unix
+// seconds plus year/month labels so every target can range- or equality-filter on it.
+func baseMetadata(kind, conversationID, title, project string, start *float64) map[string]any {
+	md := map[string]any{"kind": kind, "conversation_id": conversationID}
+	if title != "" {
+		md["title"] = title
+	}
+	if project != "" {
+		md["project"] = project
+	}
+	if start != nil && *start > 0 {
+		t := time.Unix(int64(*start), 0).UTC()
+		md["thread_start"] = t.Unix()
+		md["year"] = t.Year()
+		md["month"] = t.Format("2006-01")
+	}
+	return md
+}
+
+func setList(md map[string]any, key string, values []string) {
+	seen := map[string]struct{}{}
+	var out []string
+	for _, v := range values {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "" {
+			continue
+		}
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		out = append(out, v)
+	}
+	if len(out) > 0 {
+		md[key] = out
+	}
+}
+
+func embedText(title, summary string, keyPoints []string) string {
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return ""
+	}
+	var b strings.Builder
+	if t := strings.TrimSpace(title); t != "" {
+		b.WriteString(t)
+		b.WriteString("\n\n")
+	}
+	b.WriteString(summary)
+	for _, kp := range keyPoints {
+		if kp = strings.TrimSpace(kp); kp != "" {
+			b.WriteString("\n- ")
+			b.WriteString(kp)
+		}
+	}
+	return fileutils.Truncate(b.String(), maxEmbedChars)
+}
+
+// readArtifact reads into v the first of the current and legacy names of the kind artifact with the
+// given base that fsys can read.
+func readArtifact(fsys fs.FS, base string, kind layout.Kind, v any) error {
+	var err error
+	for _, p := range layout.Candidates(base, kind) {
+		if err = readJSON(fsys, p, v); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// readKeyPoints reads key_points.jsonl. A missing file (summaries written before it existed) yields none.
+func readKeyPoints(fsys fs.FS, path string) ([]migration.KeyPointRecord, error) {
+	b, err := fs.ReadFile(fsys, fileutils.FSPath(fsys, path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []migration.KeyPointRecord
+	for n, line := range strings.Split(string(b), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var kp migration.KeyPointRecord
+		if err := json.Unmarshal([]byte(line), &kp); err != nil {
+			return nil, fmt.Errorf("unmarshal %s line %d: %w", path, n+1, err)
+		}
+		out = append(out, kp)
+	}
+	return out, nil
+}
+
+func readJSON(fsys fs.FS, path string, v any) error {
+	b, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("unmarshal %s: %w", path, err)
+	}
+	return nil
+}
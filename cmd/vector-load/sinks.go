@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// sink upserts embedded records into one vector database.
+type sink interface {
+	Upsert(ctx context.Context, recs []vectorRecord) error
+	Close() error
+}
+
+func newSink(cfg Config, client *http.Client) (sink, error) {
+	switch cfg.Target {
+	case targetQdrant:
+		return &qdrantSink{baseURL: strings.TrimRight(cfg.URL, "/"), collection: cfg.Collection, apiKey: cfg.DBAPIKey, client: client}, nil
+	case targetChroma:
+		return &chromaSink{
+			baseURL: strings.TrimRight(cfg.URL, "/"), tenant: cfg.ChromaTenant, database: cfg.ChromaDatabase,
+			collection: cfg.Collection, token: cfg.DBAPIKey, client: client,
+		}, nil
+	case targetPGVector:
+		if cfg.PGOut != "" {
+			return newPGVectorSink(cfg.PGOut, cfg.Collection)
+		}
+		return newPGVectorConn(cfg.URL, cfg.Collection)
+	}
+	return nil, fmt.Errorf("unknown target %q", cfg.Target)
+}
+
+// doJSON sends body as JSON and decodes a JSON response into out (when non-nil). It returns the status
+// code so callers can treat 404s specially.
+func doJSON(ctx context.Context, client *http.Client, method, u string, headers map[string]string, body any, out any) (int, error) {
+	var rdr io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("marshal %s %s: %w", method, u, err)
+		}
+		rdr = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, rdr)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		if v != "" {
+			req.Header.Set(k, v)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%s %s: %w", method, u, err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("%s %s: read body: %w", method, u, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return resp.StatusCode, nil
+	}
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("%s %s: status %d: %s", method, u, resp.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	if out != nil && len(raw) > 0 {
+		if err := json.Unmarshal(raw, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("%s %s: decode response: %w", method, u, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// qdrantPayloadIndexes are created with a new collection so filters on time, tags, and emotions are fast.
+var qdrantPayloadIndexes = []struct{ field, schema string }{
+	{"kind", "keyword"},
+	{"conversation_id", "keyword"},
+	{"project", "keyword"},
+	{"month", "keyword"},
+	{"thread_start", "integer"},
+	{"tags", "keyword"},
+	{"emotions", "keyword"},
+	{"themes", "keyword"},
+}
+
+// qdrantSink talks to the Qdrant REST API.
+type qdrantSink struct {
+	baseURL    string
+	collection string
+	apiKey     string
+	client     *http.Client
+	ready      bool
+}
+
+func (s *qdrantSink) headers() map[string]string { return map[string]string{"api-key": s.apiKey} }
+
+func (s *qdrantSink) ensureCollection(ctx context.Context, dim int) error {
+	base := s.baseURL + "/collections/" + url.PathEscape(s.collection)
+	status, err := doJSON(ctx, s.client, http.MethodGet, base, s.headers(), nil, nil)
+	if err != nil {
+		return fmt.Errorf("qdrant: %w", err)
+	}
+	if status != http.StatusNotFound {
+		return nil
+	}
+	create := map[string]any{"vectors": map[string]any{"size": dim, "distance": "Cosine"}}
+	if _, err := doJSON(ctx, s.client, http.MethodPut, base, s.headers(), create, nil); err != nil {
+		return fmt.Errorf("qdrant: create collection: %w", err)
+	}
+	for _, idx := range qdrantPayloadIndexes {
+		body := map[string]any{"field_name": idx.field, "field_schema": idx.schema}
+		if _, err := doJSON(ctx, s.client, http.MethodPut, base+"/index?wait=true", s.headers(), body, nil); err != nil {
+			return fmt.Errorf("qdrant: create payload index %s: %w", idx.field, err)
+		}
+	}
+	return nil
+}
+
+func (s *qdrantSink) Upsert(ctx context.Context, recs []vectorRecord) error {
+	if len(recs) == 0 {
+		return nil
+	}
+	if !s.ready {
+		if err := s.ensureCollection(ctx, len(recs[0].Vector)); err != nil {
+			return err
+		}
+		s.ready = true
+	}
+	points := make([]map[string]any, 0, len(recs))
+	for _, r := range recs {
+		payload := make(map[string]any, len(r.Metadata)+2)
+		for k, v := range r.Metadata {
+			payload[k] = v
+		}
+		payload["key"] = r.Key
+		payload["document"] = r.Text
+		points = append(points, map[string]any{"id": r.pointID(), "vector": r.Vector, "payload": payload})
+	}
+	u := s.baseURL + "/collections/" + url.PathEscape(s.collection) + "/points?wait=true"
+	if _, err := doJSON(ctx, s.client, http.MethodPut, u, s.headers(), map[string]any{"points": points}, nil); err != nil {
+		return fmt.Errorf("qdrant: upsert: %w", err)
+	}
+	return nil
+}
+
+func (s *qdrantSink) Close() error { return nil }
+
+// chromaSink talks to the Chroma v2 REST API. Chroma metadata values must be scalars, so list fields
+// are stored as comma-joined strings plus one boolean flag per value (e.g. tag_travel, emotion_joy) that
+// `where` filters can match.
+type chromaSink struct {
+	baseURL    string
+	tenant     string
+	database   string
+	collection string
+	token      string
+	client     *http.Client
+	id         string
+}
+
+func (s *chromaSink) headers() map[string]string { return map[string]string{"x-chroma-token": s.token} }
+
+func (s *chromaSink) collectionsURL() string {
+	return s.baseURL + "/api/v2/tenants/" + url.PathEscape(s.tenant) + "/databases/" + url.PathEscape(s.database) + "/collections"
+}
+
+func (s *chromaSink) Upsert(ctx context.Context, recs []vectorRecord) error {
+	if len(recs) == 0 {
+		return nil
+	}
+	if s.id == "" {
+		var created struct {
+			ID string `json:"id"`
+		}
+		body := map[string]any{"name": s.collection, "get_or_create": true, "metadata": map[string]any{"hnsw:space": "cosine"}}
+		status, err := doJSON(ctx, s.client, http.MethodPost, s.collectionsURL(), s.headers(), body, &created)
+		if err != nil {
+			return fmt.Errorf("chroma: create collection: %w", err)
+		}
+		if status == http.StatusNotFound || created.ID == "" {
+			return fmt.Errorf("chroma: create collection: no id returned (tenant %q, database %q)", s.tenant, s.database)
+		}
+		s.id = created.ID
+	}
+
+	ids := make([]string, 0, len(recs))
+	embeddings := make([][]float64, 0, len(recs))
+	metadatas := make([]map[string]any, 0, len(recs))
+	documents := make([]string, 0, len(recs))
+	for _, r := range recs {
+		ids = append(ids, r.Key)
+		embeddings = append(embeddings, r.Vector)
+		metadatas = append(metadatas, chromaMetadata(r.Metadata))
+		documents = append(documents, r.Text)
+	}
+	body := map[string]any{"ids": ids, "embeddings": embeddings, "metadatas": metadatas, "documents": documents}
+	if _, err := doJSON(ctx, s.client, http.MethodPost, s.collectionsURL()+"/"+url.PathEscape(s.id)+"/upsert", s.headers(), body, nil); err != nil {
+		return fmt.Errorf("chroma: upsert: %w", err)
+	}
+	return nil
+}
+
+func (s *chromaSink) Close() error { return nil }
+
+// chromaFlagPrefixes maps list metadata keys to the prefix of their per-value boolean flags.
+var chromaFlagPrefixes = map[string]string{"tags": "tag_", "emotions": "emotion_", "themes": "theme_"}
+
+func chromaMetadata(md map[string]any) map[string]any {
+	out := make(map[string]any, len(md))
+	for k, v := range md {
+		list, ok := v.([]string)
+		if !ok {
+			out[k] = v
+			continue
+		}
+		out[k] = strings.Join(list, ", ")
+		if prefix, ok := chromaFlagPrefixes[k]; ok {
+			for _, item := range list {
+				out[prefix+metadataSlug(item)] = true
+			}
+		}
+	}
+	return out
+}
+
+func metadataSlug(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return strings.Trim(b.String(), "_")
+}
+
+// pgvectorSink upserts records with idempotent SQL: create the table and indexes, then INSERT ...
+// ON CONFLICT DO UPDATE per record. No Postgres driver is vendored, so the statements go to a psql
+// connected to the database, which applies each batch as it is written (newPGVectorConn), or to a
+// script to apply later with psql -f (newPGVectorSink).
+type pgvectorSink struct {
+	// dest names where the SQL goes, for errors.
+	dest string
+	// name is the table name as given; table is it quoted for SQL.
+	name  string
+	table string
+	w     io.Writer
+	close func() error
+	ready bool
+}
+
+// newPGVectorSink writes the upserts to a SQL script at path.
+func newPGVectorSink(path, table string) (*pgvectorSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("pgvector: mkdir: %w", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("pgvector: %w", err)
+	}
+	return &pgvectorSink{dest: path, name: table, table: pgIdent(table), w: f, close: sync.OnceValue(f.Close)}, nil
+}
+
+// newPGVectorConn upserts into the database at connURL (a postgres:// URI or libpq connection string)
+// through psql, which must be on PATH. psql stops at the first failing statement, and Close reports
+// its error.
+func newPGVectorConn(connURL, table string) (*pgvectorSink, error) {
+	psql, err := exec.LookPath("psql")
+	if err != nil {
+		return nil, fmt.Errorf("pgvector: upserting into %s needs psql on PATH (or write a script with -pg-out): %w", connURL, err)
+	}
+	cmd := exec.Command(psql, "-X", "-q", "-v", "ON_ERROR_STOP=1", "-d", connURL, "-f", "-")
+	var stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = io.Discard, &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("pgvector: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("pgvector: start psql: %w", err)
+	}
+	closeConn := func() error {
+		cerr := stdin.Close()
+		if err := cmd.Wait(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return fmt.Errorf("pgvector: psql: %s", msg)
+			}
+			return fmt.Errorf("pgvector: psql: %w", err)
+		}
+		return cerr
+	}
+	return &pgvectorSink{dest: "psql", name: table, table: pgIdent(table), w: stdin, close: sync.OnceValue(closeConn)}, nil
+}
+
+func (s *pgvectorSink) Upsert(_ context.Context, recs []vectorRecord) error {
+	if len(recs) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	if !s.ready {
+		dim := len(recs[0].Vector)
+		b.WriteString("CREATE EXTENSION IF NOT EXISTS vector;\n")
+		fmt.Fprintf(&b, `CREATE TABLE IF NOT EXISTS %s (
+  id text PRIMARY KEY,
+  kind text NOT NULL,
+  conversation_id text NOT NULL,
+  chunk_number int,
+  title text,
+  project text,
+  thread_start timestamptz,
+  month text,
+  tags text[],
+  emotions text[],
+  themes text[],
+  metadata jsonb NOT NULL,
+  document text NOT NULL,
+  embedding vector(%d) NOT NULL
+);
+`, s.table, dim)
+		fmt.Fprintf(&b, "CREATE INDEX IF NOT EXISTS %s ON %s (thread_start);\n", pgIdent(s.name+"_thread_start_idx"), s.table)
+		fmt.Fprintf(&b, "CREATE INDEX IF NOT EXISTS %s ON %s USING gin (tags);\n", pgIdent(s.name+"_tags_idx"), s.table)
+		fmt.Fprintf(&b, "CREATE INDEX IF NOT EXISTS %s ON %s USING gin (emotions);\n", pgIdent(s.name+"_emotions_idx"), s.table)
+		fmt.Fprintf(&b, "CREATE INDEX IF NOT EXISTS %s ON %s USING hnsw (embedding vector_cosine_ops);\n", pgIdent(s.name+"_embedding_idx"), s.table)
+		s.ready = true
+	}
+	for _, r := range recs {
+		md, err := json.Marshal(r.Metadata)
+		if err != nil {
+			return fmt.Errorf("pgvector: marshal metadata: %w", err)
+		}
+		start := "NULL"
+		if ts, ok := r.Metadata["thread_start"].(int64); ok {
+			start = "to_timestamp(" + strconv.FormatInt(ts, 10) + ")"
+		}
+		chunk := "NULL"
+		if n, ok := r.Metadata["chunk_number"].(int); ok {
+			chunk = strconv.Itoa(n)
+		}
+		fmt.Fprintf(&b, "INSERT INTO %s (id, kind, conversation_id, chunk_number, title, project, thread_start, month, tags, emotions, themes, metadata, document, embedding) VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s::jsonb, %s, %s::vector)\n",
+			s.table, pgString(r.Key), pgString(metaString(r.Metadata, "kind")), pgString(metaString(r.Metadata, "conversation_id")), chunk,
+			pgNullable(metaString(r.Metadata, "title")), pgNullable(metaString(r.Metadata, "project")), start, pgNullable(metaString(r.Metadata, "month")),
+			pgArray(r.Metadata["tags"]), pgArray(r.Metadata["emotions"]), pgArray(r.Metadata["themes"]),
+			pgString(string(md)), pgString(r.Text), pgString(pgVector(r.Vector)))
+		b.WriteString("ON CONFLICT (id) DO UPDATE SET kind = EXCLUDED.kind, conversation_id = EXCLUDED.conversation_id, chunk_number = EXCLUDED.chunk_number, title = EXCLUDED.title, project = EXCLUDED.project, thread_start = EXCLUDED.thread_start, month = EXCLUDED.month, tags = EXCLUDED.tags, emotions = EXCLUDED.emotions, themes = EXCLUDED.themes, metadata = EXCLUDED.metadata, document = EXCLUDED.document, embedding = EXCLUDED.embedding;\n")
+	}
+	if _, err := io.WriteString(s.w, b.String()); err != nil {
+		if s.dest == "psql" {
+			// A psql that stopped on an error closes its input; its own message says why.
+			if cerr := s.close(); cerr != nil {
+				return cerr
+			}
+		}
+		return fmt.Errorf("pgvector: write %s: %w", s.dest, err)
+	}
+	return nil
+}
+
+func (s *pgvectorSink) Close() error { return s.close() }
+
+func metaString(md map[string]any, key string) string {
+	s, _ := md[key].(string)
+	return s
+}
+
+func pgString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func pgNullable(s string) string {
+	if s == "" {
+		return "NULL"
+	}
+	return pgString(s)
+}
+
+func pgArray(v any) string {
+	list, _ := v.([]string)
+	if len(list) == 0 {
+		return "NULL"
+	}
+	items := make([]string, 0, len(list))
+	for _, s := range list {
+		items = append(items, pgString(s))
+	}
+	return "ARRAY[" + strings.Join(items, ", ") + "]::text[]"
+}
+
+func pgVector(v []float64) string {
+	parts := make([]string, len(v))
+	for i, f := range v {
+		parts[i] = strconv.FormatFloat(f, 'g', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// pgIdent quotes a table or index name.
+func pgIdent(s string) string {
+	s = strings.Trim(s, `"`)
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
@@ -0,0 +1,212 @@
+// Package eval scores chunk summaries against golden fixtures so prompt and model changes can be
+// compared. A fixture is a chunk plus the properties a good summary of it must have: terms it must
+// mention, content it must not contain, and size limits. cmd/prompt-eval runs chunk-summarizer over the
+// fixtures and writes a Report.
+package eval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+// ReportFileName is the scored report prompt-eval writes into its work directory.
+const ReportFileName = "eval_report.json"
+
+// Case is one golden fixture.
+type Case struct {
+	// Name identifies the case; it defaults to the fixture file name and becomes the chunk file name.
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Chunk       migration.Chunk `json:"chunk"`
+	Expect      Expectation     `json:"expect"`
+}
+
+// Expectation lists the properties a summary of the case's chunk must have. Matching is
+// case-insensitive on whole text, so "Lisbon" matches "lisbon's".
+type Expectation struct {
+	// MustMention terms must appear in the semantic summary, its key points, tags, or terms.
+	MustMention []string `json:"must_mention,omitempty"`
+	// Banned phrases must not appear anywhere in the semantic or sentiment summary (leaked
+	// instructions, invented facts, secrets from the transcript).
+	Banned []string `json:"banned,omitempty"`
+	// SentimentMustMention terms must appear in the sentiment summary's text or emotion lists.
+	SentimentMustMention []string `json:"sentiment_must_mention,omitempty"`
+
+	MinKeyPoints    int `json:"min_key_points,omitempty"`
+	MaxSummaryChars int `json:"max_summary_chars,omitempty"`
+}
+
+// Check is the outcome of one expectation.
+type Check struct {
+	Name   string `json:"name"`
+	Pass   bool   `json:"pass"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// CaseResult is the scored outcome of one case. Score is the fraction of checks that passed; a case
+// whose summary is missing scores 0.
+type CaseResult struct {
+	Name   string  `json:"name"`
+	Score  float64 `json:"score"`
+	Checks []Check `json:"checks,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// Report is the scored result of one evaluation run.
+type Report struct {
+	Model          string       `json:"model"`
+	SentimentModel string       `json:"sentiment_model,omitempty"`
+	Time           string       `json:"time"`
+	Cases          []CaseResult `json:"cases"`
+
+	// Score is the mean case score; Passed and Total count individual checks.
+	Score  float64 `json:"score"`
+	Passed int     `json:"passed"`
+	Total  int     `json:"total"`
+}
+
+// LoadCases reads every *.json fixture in dir on fsys, sorted by name.
+func LoadCases(fsys fs.FS, dir string) ([]Case, error) {
+	paths, err := fs.Glob(fsys, fileutils.JoinFS(fsys, dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("LoadCases: %w", err)
+	}
+	sort.Strings(paths)
+	var out []Case
+	seen := map[string]bool{}
+	for _, p := range paths {
+		b, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, fmt.Errorf("LoadCases: %w", err)
+		}
+		var c Case
+		if err := json.Unmarshal(b, &c); err != nil {
+			return nil, fmt.Errorf("LoadCases: %s: %w", p, err)
+		}
+		if c.Name == "" {
+			base := path.Base(filepath.ToSlash(p))
+			c.Name = strings.TrimSuffix(base, path.Ext(base))
+		}
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("LoadCases: %s: %w", p, err)
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("LoadCases: %s: duplicate case name %q", p, c.Name)
+		}
+		seen[c.Name] = true
+		out = append(out, c)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("LoadCases: no *.json fixtures in %s", dir)
+	}
+	return out, nil
+}
+
+func (c Case) validate() error {
+	if c.Name != filepath.Base(c.Name) || strings.ContainsAny(c.Name, `/\`) {
+		return fmt.Errorf("invalid case name %q", c.Name)
+	}
+	if c.Chunk.ConversationID == "" {
+		return errors.New("chunk.conversation_id is empty")
+	}
+	if len(c.Chunk.Messages) == 0 {
+		return errors.New("chunk has no messages")
+	}
+	e := c.Expect
+	if len(e.MustMention)+len(e.Banned)+len(e.SentimentMustMention) == 0 && e.MinKeyPoints == 0 && e.MaxSummaryChars == 0 {
+		return errors.New("expect is empty")
+	}
+	return nil
+}
+
+// ChunkFileName is the file name a case's chunk is written under for chunk-summarizer.
+func (c Case) ChunkFileName() string { return c.Name + ".json" }
+
+// Score checks a semantic summary, and the sentiment summary when the case has sentiment expectations,
+// against the case's expectations. sent may be nil when no sentiment summary was produced.
+func Score(c Case, sum migration.ChunkSummary, sent *migration.ChunkSentimentSummary) CaseResult {
+	e := c.Expect
+	semantic := strings.ToLower(strings.Join(append(append(append([]string{sum.Summary}, sum.KeyPoints...), sum.Tags...), sum.Terms...), "\n"))
+	everything := semantic
+	var sentiment string
+	if sent != nil {
+		sentiment = strings.ToLower(strings.Join(sentimentTexts(*sent), "\n"))
+		everything += "\n" + sentiment
+	}
+
+	var checks []Check
+	for _, term := range e.MustMention {
+		checks = append(checks, Check{Name: "mentions " + term, Pass: strings.Contains(semantic, strings.ToLower(term))})
+	}
+	for _, term := range e.SentimentMustMention {
+		ck := Check{Name: "sentiment mentions " + term, Pass: sent != nil && strings.Contains(sentiment, strings.ToLower(term))}
+		if sent == nil {
+			ck.Detail = "no sentiment summary"
+		}
+		checks = append(checks, ck)
+	}
+	for _, phrase := range e.Banned {
+		checks = append(checks, Check{Name: "avoids " + phrase, Pass: !strings.Contains(everything, strings.ToLower(phrase))})
+	}
+	if e.MinKeyPoints > 0 {
+		n := 0
+		for _, kp := range sum.KeyPoints {
+			if strings.TrimSpace(kp) != "" {
+				n++
+			}
+		}
+		checks = append(checks, Check{Name: fmt.Sprintf("at least %d key points", e.MinKeyPoints), Pass: n >= e.MinKeyPoints, Detail: fmt.Sprintf("got %d", n)})
+	}
+	if e.MaxSummaryChars > 0 {
+		n := len(strings.TrimSpace(sum.Summary))
+		checks = append(checks, Check{Name: fmt.Sprintf("summary at most %d chars", e.MaxSummaryChars), Pass: n <= e.MaxSummaryChars, Detail: fmt.Sprintf("got %d", n)})
+	}
+
+	res := CaseResult{Name: c.Name, Checks: checks}
+	if len(checks) > 0 {
+		passed := 0
+		for _, ck := range checks {
+			if ck.Pass {
+				passed++
+			}
+		}
+		res.Score = float64(passed) / float64(len(checks))
+	}
+	return res
+}
+
+func sentimentTexts(s migration.ChunkSentimentSummary) []string {
+	out := []string{s.EmotionalSummary, s.RelationalShift, s.EmotionalArc, s.ResonanceNotes}
+	for _, list := range [][]string{s.DominantEmotions, s.RememberedEmotions, s.PresentEmotions, s.EmotionalTensions, s.Themes, s.SymbolsOrMetaphors, s.ToneMarkers} {
+		out = append(out, list...)
+	}
+	return out
+}
+
+// NewReport totals case results.
+func NewReport(model, sentimentModel string, results []CaseResult) Report {
+	r := Report{Model: model, SentimentModel: sentimentModel, Time: time.Now().UTC().Format(time.RFC3339), Cases: results}
+	for _, c := range results {
+		r.Score += c.Score
+		for _, ck := range c.Checks {
+			r.Total++
+			if ck.Pass {
+				r.Passed++
+			}
+		}
+	}
+	if len(results) > 0 {
+		r.Score /= float64(len(results))
+	}
+	return r
+}
@@ -0,0 +1,101 @@
+package eval
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+func TestLoadCases_Fixtures(t *testing.T) {
+	t.Parallel()
+
+	cases, err := LoadCases(fileutils.OS, "fixtures")
+	if err != nil {
+		t.Fatalf("LoadCases: %v", err)
+	}
+	if len(cases) < 3 {
+		t.Fatalf("cases=%d", len(cases))
+	}
+	for _, c := range cases {
+		if c.Name == "" || c.ChunkFileName() != c.Name+".json" {
+			t.Fatalf("case=%+v", c)
+		}
+	}
+}
+
+func TestLoadCases_RejectsEmptyExpectations(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	body := `{"chunk": {"conversation_id": "c1", "messages": [{"role": "user", "text": "hi"}]}, "expect": {}}`
+	if err := os.WriteFile(filepath.Join(dir, "empty.json"), []byte(body), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := LoadCases(fileutils.OS, dir); err == nil {
+		t.Fatalf("expected error for empty expect")
+	}
+}
+
+func TestScore_ChecksAndReport(t *testing.T) {
+	t.Parallel()
+
+	c := Case{Name: "lisbon", Expect: Expectation{
+		MustMention:          []string{"Lisbon", "NIF"},
+		Banned:               []string{"PWNED"},
+		SentimentMustMention: []string{"hope"},
+		MinKeyPoints:         2,
+		MaxSummaryChars:      40,
+	}}
+	sum := migration.ChunkSummary{Summary: "Planning the move to lisbon.", KeyPoints: []string{"Get the NIF", " "}, Tags: []string{"relocation"}}
+	res := Score(c, sum, nil)
+	if len(res.Checks) != 6 {
+		t.Fatalf("checks=%+v", res.Checks)
+	}
+	failed := map[string]bool{}
+	for _, ck := range res.Checks {
+		if !ck.Pass {
+			failed[ck.Name] = true
+		}
+	}
+	if len(failed) != 2 || !failed["sentiment mentions hope"] || !failed["at least 2 key points"] {
+		t.Fatalf("failed=%v", failed)
+	}
+
+	sent := &migration.ChunkSentimentSummary{EmotionalSummary: "Cautious hope.", Themes: []string{"pwned"}}
+	res = Score(c, sum, sent)
+	failed = map[string]bool{}
+	for _, ck := range res.Checks {
+		if !ck.Pass {
+			failed[ck.Name] = true
+		}
+	}
+	if !failed["avoids PWNED"] || failed["sentiment mentions hope"] {
+		t.Fatalf("failed=%v", failed)
+	}
+
+	r := NewReport("m", "", []CaseResult{{Name: "a", Score: 1, Checks: []Check{{Pass: true}}}, {Name: "b", Error: "missing"}})
+	if r.Score != 0.5 || r.Passed != 1 || r.Total != 1 {
+		t.Fatalf("report=%+v", r)
+	}
+}
+
+func TestLoadCases_FromFS(t *testing.T) {
+	t.Parallel()
+
+	body := `{"chunk": {"conversation_id": "c1", "messages": [{"role": "user", "text": "hi"}]}, "expect": {"must_mention": ["hi"]}}`
+	fsys := fstest.MapFS{
+		"eval/fixtures/greeting.json": &fstest.MapFile{Data: []byte(body)},
+		"eval/fixtures/notes.txt":     &fstest.MapFile{Data: []byte("ignored")},
+	}
+	cases, err := LoadCases(fsys, filepath.FromSlash("eval/fixtures"))
+	if err != nil {
+		t.Fatalf("LoadCases: %v", err)
+	}
+	if len(cases) != 1 || cases[0].Name != "greeting" {
+		t.Fatalf("cases=%+v", cases)
+	}
+}
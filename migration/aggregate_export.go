@@ -0,0 +1,272 @@
+package migration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AggregatesFileName is the file WriteAggregateExport and WriteSentimentAggregateExport write into OutDir.
+const AggregatesFileName = "aggregates.json"
+
+// DefaultAggregateMinCount is the default AggregateOptions.MinCount.
+const DefaultAggregateMinCount = 3
+
+// UndatedPeriod is the period of threads without a start or update time.
+const UndatedPeriod = "undated"
+
+// AggregateOptions controls an aggregate-only export.
+type AggregateOptions struct {
+	OutDir    string
+	Overwrite bool
+
+	// MinCount drops every count below it (after noise), so a label or month that only a thread or two
+	// carry does not single those threads out. 0 keeps every count.
+	MinCount int
+
+	// Epsilon, when > 0, adds Laplace noise of scale 1/Epsilon to every count before MinCount applies,
+	// so published counts are noised rather than exact. This is not differential privacy: the labels
+	// and periods released come from the data, so which ones appear can still reveal a thread.
+	Epsilon float64
+
+	// Rand draws the noise (nil = a randomly seeded source). Tests fix it; real runs should not.
+	Rand *rand.Rand
+}
+
+// AggregateCount is one released count.
+type AggregateCount struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// AggregatePeriod holds the label counts of one month ("2024-05") or quarter ("2024-Q2").
+type AggregatePeriod struct {
+	Period  string           `json:"period"`
+	Threads int              `json:"threads"`
+	Counts  []AggregateCount `json:"counts"`
+}
+
+// AggregateExport is the aggregate-only view of an archive: counts of model-assigned labels by period,
+// and no summaries, titles, key points, terms, or conversation IDs. Labels are tags or themes in
+// semantic mode and dominant emotions in sentiment mode, lowercased.
+type AggregateExport struct {
+	Kind        string  `json:"kind"`
+	GeneratedAt string  `json:"generated_at"`
+	MinCount    int     `json:"min_count"`
+	Epsilon     float64 `json:"epsilon,omitempty"`
+	Threads     int     `json:"threads"`
+
+	ThreadsPerMonth []AggregateCount `json:"threads_per_month"`
+	// TagFrequencies counts semantic tags, or sentiment themes, over the whole archive.
+	TagFrequencies []AggregateCount `json:"tag_frequencies"`
+	// TopicsPerQuarter counts the same labels as TagFrequencies by quarter of thread start.
+	TopicsPerQuarter []AggregatePeriod `json:"topics_per_quarter"`
+	// EmotionsPerMonth counts dominant emotions by month of thread start (sentiment mode only).
+	EmotionsPerMonth []AggregatePeriod `json:"emotions_per_month,omitempty"`
+}
+
+// aggregateDoc is the part of one rollup an aggregate export may count.
+type aggregateDoc struct {
+	start    *float64
+	topics   []string
+	emotions []string
+}
+
+// WriteAggregateExport writes AggregatesFileName for semantic rollups: threads per month, tag
+// frequencies, and tags per quarter.
+func WriteAggregateExport(threadSummaries []ThreadSummary, opts AggregateOptions) (AggregateExport, error) {
+	docs := make([]aggregateDoc, 0, len(threadSummaries))
+	for _, ts := range threadSummaries {
+		if ts.ConversationID == "" {
+			continue
+		}
+		docs = append(docs, aggregateDoc{start: aggregateTime(ts.ThreadStart, ts.ThreadUpdate), topics: ts.Tags})
+	}
+	return writeAggregateExport("semantic", docs, opts)
+}
+
+// WriteSentimentAggregateExport is WriteAggregateExport for sentiment rollups, counting themes as
+// topics and adding dominant emotions per month.
+func WriteSentimentAggregateExport(threadSummaries []ThreadSentimentSummary, opts AggregateOptions) (AggregateExport, error) {
+	docs := make([]aggregateDoc, 0, len(threadSummaries))
+	for _, ts := range threadSummaries {
+		if ts.ConversationID == "" {
+			continue
+		}
+		docs = append(docs, aggregateDoc{
+			start:    aggregateTime(ts.ThreadStart, ts.ThreadUpdate),
+			topics:   ts.Themes,
+			emotions: ts.DominantEmotions,
+		})
+	}
+	return writeAggregateExport("sentiment", docs, opts)
+}
+
+func writeAggregateExport(kind string, docs []aggregateDoc, opts AggregateOptions) (AggregateExport, error) {
+	if opts.OutDir == "" {
+		return AggregateExport{}, errors.New("WriteAggregateExport: OutDir is empty")
+	}
+	if opts.MinCount < 0 || opts.Epsilon < 0 {
+		return AggregateExport{}, errors.New("WriteAggregateExport: MinCount and Epsilon must be >= 0")
+	}
+	outPath := filepath.Join(opts.OutDir, AggregatesFileName)
+	if !opts.Overwrite {
+		if _, err := os.Stat(outPath); err == nil {
+			return AggregateExport{}, fmt.Errorf("WriteAggregateExport: file exists: %s", outPath)
+		}
+	}
+	if err := os.MkdirAll(opts.OutDir, 0o755); err != nil {
+		return AggregateExport{}, fmt.Errorf("WriteAggregateExport: mkdir OutDir: %w", err)
+	}
+
+	months := map[string]int{}
+	tags := map[string]int{}
+	quarters := map[string]map[string]int{}
+	quarterThreads := map[string]int{}
+	emotions := map[string]map[string]int{}
+	for _, d := range docs {
+		month, quarter := aggregatePeriods(d.start)
+		months[month]++
+		quarterThreads[quarter]++
+		for _, t := range aggregateLabels(d.topics) {
+			tags[t]++
+			addAggregate(quarters, quarter, t)
+		}
+		for _, e := range aggregateLabels(d.emotions) {
+			addAggregate(emotions, month, e)
+		}
+	}
+
+	r := aggregateReleaser{opts: opts, rng: opts.Rand}
+	if r.rng == nil {
+		r.rng = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	export := AggregateExport{
+		Kind:             kind,
+		GeneratedAt:      time.Now().UTC().Format(time.RFC3339),
+		MinCount:         opts.MinCount,
+		Epsilon:          opts.Epsilon,
+		Threads:          r.release(len(docs)),
+		ThreadsPerMonth:  r.counts(months, false),
+		TagFrequencies:   r.counts(tags, true),
+		TopicsPerQuarter: r.periods(quarters, quarterThreads),
+	}
+	if kind == "sentiment" {
+		export.EmotionsPerMonth = r.periods(emotions, months)
+	}
+
+	b, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return AggregateExport{}, fmt.Errorf("WriteAggregateExport: marshal: %w", err)
+	}
+	if _, err := writeFileAtomic(outPath, b, 0o644); err != nil {
+		return AggregateExport{}, fmt.Errorf("WriteAggregateExport: write: %w", err)
+	}
+	return export, nil
+}
+
+// aggregateTime is the thread start, or its update time when the start is missing.
+func aggregateTime(start, update *float64) *float64 {
+	if start != nil && *start > 0 {
+		return start
+	}
+	return update
+}
+
+// aggregatePeriods returns the month ("2024-05") and quarter ("2024-Q2") of t, or UndatedPeriod twice.
+func aggregatePeriods(t *float64) (month, quarter string) {
+	iso := threadStartISO8601(t)
+	if iso == "" {
+		return UndatedPeriod, UndatedPeriod
+	}
+	ts, err := time.Parse(time.RFC3339, iso)
+	if err != nil {
+		return UndatedPeriod, UndatedPeriod
+	}
+	return ts.Format("2006-01"), fmt.Sprintf("%d-Q%d", ts.Year(), (int(ts.Month())-1)/3+1)
+}
+
+// aggregateLabels lowercases and deduplicates labels, so one thread adds at most 1 to any count.
+func aggregateLabels(labels []string) []string {
+	seen := make(map[string]bool, len(labels))
+	out := make([]string, 0, len(labels))
+	for _, l := range labels {
+		l = strings.ToLower(strings.Join(strings.Fields(l), " "))
+		if l == "" || seen[l] {
+			continue
+		}
+		seen[l] = true
+		out = append(out, l)
+	}
+	return out
+}
+
+func addAggregate(m map[string]map[string]int, period, label string) {
+	if m[period] == nil {
+		m[period] = map[string]int{}
+	}
+	m[period][label]++
+}
+
+// aggregateReleaser applies noise and suppression to counts on their way into an export.
+type aggregateReleaser struct {
+	opts AggregateOptions
+	rng  *rand.Rand
+}
+
+// release returns the count to publish for n, or 0 when it is suppressed.
+func (r aggregateReleaser) release(n int) int {
+	if r.opts.Epsilon > 0 {
+		// Laplace(0, 1/ε) as the difference of two exponentials.
+		n = int(math.Round(float64(n) + (r.rng.ExpFloat64()-r.rng.ExpFloat64())/r.opts.Epsilon))
+	}
+	if n < 0 || n < r.opts.MinCount {
+		return 0
+	}
+	return n
+}
+
+// counts releases m, dropping suppressed entries. byCount orders by count (then label); otherwise
+// entries are ordered by label.
+func (r aggregateReleaser) counts(m map[string]int, byCount bool) []AggregateCount {
+	labels := make([]string, 0, len(m))
+	for l := range m {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	out := []AggregateCount{}
+	for _, l := range labels {
+		if n := r.release(m[l]); n > 0 {
+			out = append(out, AggregateCount{Label: l, Count: n})
+		}
+	}
+	if byCount {
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Count > out[j].Count })
+	}
+	return out
+}
+
+// periods releases per-period label counts; a period whose thread count is suppressed is dropped.
+func (r aggregateReleaser) periods(m map[string]map[string]int, threads map[string]int) []AggregatePeriod {
+	keys := make([]string, 0, len(threads))
+	for k := range threads {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := []AggregatePeriod{}
+	for _, k := range keys {
+		n := r.release(threads[k])
+		if n == 0 {
+			continue
+		}
+		out = append(out, AggregatePeriod{Period: k, Threads: n, Counts: r.counts(m[k], true)})
+	}
+	return out
+}
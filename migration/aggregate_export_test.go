@@ -0,0 +1,77 @@
+package migration
+
+import (
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteSentimentAggregateExport_CountsOnlyAndSuppressesRareLabels(t *testing.T) {
+	t.Parallel()
+
+	may, june := 1714521600.0, 1717200000.0 // 2024-05-01, 2024-06-01
+	var summaries []ThreadSentimentSummary
+	for i, start := range []float64{may, may + 3600, may + 7200, june} {
+		ts := ThreadSentimentSummary{
+			ConversationID:   "c" + string(rune('1'+i)),
+			Title:            "Private title",
+			EmotionalSummary: "Talked about Biscuit the dog.",
+			ThreadStart:      &start,
+			DominantEmotions: []string{"Joy", "joy"},
+			Themes:           []string{"Gardening"},
+		}
+		if i == 0 {
+			ts.Themes = append(ts.Themes, "Biscuit")
+		}
+		summaries = append(summaries, ts)
+	}
+
+	dir := t.TempDir()
+	export, err := WriteSentimentAggregateExport(summaries, AggregateOptions{OutDir: dir, MinCount: 2})
+	if err != nil {
+		t.Fatalf("WriteSentimentAggregateExport: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, AggregatesFileName))
+	if err != nil {
+		t.Fatalf("read export: %v", err)
+	}
+	for _, leak := range []string{"Private title", "Biscuit", "biscuit", "c1"} {
+		if strings.Contains(string(b), leak) {
+			t.Fatalf("export contains %q:\n%s", leak, b)
+		}
+	}
+	if export.Threads != 4 || len(export.TagFrequencies) != 1 || export.TagFrequencies[0] != (AggregateCount{Label: "gardening", Count: 4}) {
+		t.Fatalf("export=%+v", export)
+	}
+	// June has one thread, below MinCount, so it is dropped everywhere.
+	if len(export.ThreadsPerMonth) != 1 || export.ThreadsPerMonth[0] != (AggregateCount{Label: "2024-05", Count: 3}) {
+		t.Fatalf("ThreadsPerMonth=%+v", export.ThreadsPerMonth)
+	}
+	if len(export.EmotionsPerMonth) != 1 || export.EmotionsPerMonth[0].Counts[0] != (AggregateCount{Label: "joy", Count: 3}) {
+		t.Fatalf("EmotionsPerMonth=%+v", export.EmotionsPerMonth)
+	}
+	if len(export.TopicsPerQuarter) != 1 || export.TopicsPerQuarter[0].Period != "2024-Q2" || export.TopicsPerQuarter[0].Threads != 4 {
+		t.Fatalf("TopicsPerQuarter=%+v", export.TopicsPerQuarter)
+	}
+
+	if _, err := WriteSentimentAggregateExport(summaries, AggregateOptions{OutDir: dir}); err == nil {
+		t.Fatal("expected error for an existing export without Overwrite")
+	}
+
+	noisy, err := WriteSentimentAggregateExport(summaries, AggregateOptions{
+		OutDir: dir, Overwrite: true, Epsilon: 0.5, Rand: rand.New(rand.NewPCG(1, 2)),
+	})
+	if err != nil {
+		t.Fatalf("noisy export: %v", err)
+	}
+	for _, c := range noisy.TagFrequencies {
+		if c.Count <= 0 {
+			t.Fatalf("released non-positive count: %+v", c)
+		}
+	}
+	if noisy.Epsilon != 0.5 {
+		t.Fatalf("Epsilon=%v", noisy.Epsilon)
+	}
+}
@@ -0,0 +1,452 @@
+package migration
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArchiveManifestFileName is the integrity manifest stored as the first entry of a packed archive.
+const ArchiveManifestFileName = "archive_manifest.json"
+
+// ArchiveFormat identifies the layout of packed archives; it changes only if the layout does.
+const ArchiveFormat = "compress-o-bot-archive/1"
+
+// Archive compressions. zstd runs the zstd binary, which must be on PATH.
+const (
+	ArchiveZstd = "zstd"
+	ArchiveGzip = "gzip"
+	ArchiveNone = "none"
+)
+
+// ArchiveCompressions lists the -compression values.
+var ArchiveCompressions = []string{ArchiveZstd, ArchiveGzip, ArchiveNone}
+
+// DefaultArchiveEntries are the files and directories pack-archive bundles, relative to the threads
+// directory: the shards, the indexes, the glossary, and the pipeline report.
+var DefaultArchiveEntries = []string{
+	"memory_shards",
+	"memory_shards_sentiment",
+	"summaries/index.json",
+	"summaries/" + KeyPointsFileName,
+	"summaries/sentiment_index.json",
+	"summaries/glossary.json",
+	"thread_summaries/thread_index.json",
+	"thread_sentiment_summaries/sentiment_thread_index.json",
+	PipelineReportFileName,
+}
+
+// ParseArchiveCompression validates a -compression value.
+func ParseArchiveCompression(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, c := range ArchiveCompressions {
+		if s == c {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unknown compression %q (want %s)", s, strings.Join(ArchiveCompressions, ", "))
+}
+
+// ArchiveExt is the file extension for an archive with compression.
+func ArchiveExt(compression string) string {
+	switch compression {
+	case ArchiveZstd:
+		return ".tar.zst"
+	case ArchiveGzip:
+		return ".tar.gz"
+	}
+	return ".tar"
+}
+
+// ArchiveCompressionFor guesses an archive's compression from its file name.
+func ArchiveCompressionFor(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zst"):
+		return ArchiveZstd
+	case strings.HasSuffix(name, ".gz"), strings.HasSuffix(name, ".tgz"):
+		return ArchiveGzip
+	}
+	return ArchiveNone
+}
+
+// ArchiveFile is one file in an archive manifest. Path is slash-separated and relative to the archive
+// root.
+type ArchiveFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ArchiveManifest lists every file in a packed archive with its size and SHA-256, so a copy can be
+// checked without trusting the tool that made it.
+type ArchiveManifest struct {
+	Format      string        `json:"format"`
+	Version     string        `json:"version"`
+	CreatedAt   string        `json:"created_at"`
+	ToolVersion string        `json:"tool_version"`
+	Compression string        `json:"compression"`
+	TotalBytes  int64         `json:"total_bytes"`
+	Files       []ArchiveFile `json:"files"`
+}
+
+// ArchivePackOptions configures WriteArchivePack.
+type ArchivePackOptions struct {
+	// Root is the directory archive paths are relative to.
+	Root string
+	// Entries are files or directories under Root, slash-separated; directories are packed whole.
+	Entries []string
+	// SkipMissing skips Entries that do not exist instead of failing.
+	SkipMissing bool
+
+	Version     string
+	Compression string
+	// CreatedAt stamps the manifest and every tar header, so the same inputs pack to the same bytes.
+	CreatedAt time.Time
+}
+
+// CollectArchiveFiles lists and hashes the regular files opts selects, sorted by path. Hidden files
+// (temp files, editor droppings) are left out.
+func CollectArchiveFiles(opts ArchivePackOptions) ([]ArchiveFile, error) {
+	if opts.Root == "" {
+		return nil, errors.New("CollectArchiveFiles: Root is empty")
+	}
+	seen := make(map[string]bool)
+	var files []ArchiveFile
+	add := func(full string) error {
+		rel, err := filepath.Rel(opts.Root, full)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if seen[rel] {
+			return nil
+		}
+		seen[rel] = true
+		size, sum, err := hashFile(full)
+		if err != nil {
+			return err
+		}
+		files = append(files, ArchiveFile{Path: rel, Size: size, SHA256: sum})
+		return nil
+	}
+	for _, entry := range opts.Entries {
+		clean := path.Clean(filepath.ToSlash(strings.TrimSpace(entry)))
+		if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") || path.IsAbs(clean) {
+			return nil, fmt.Errorf("CollectArchiveFiles: entry %q is not under the archive root", entry)
+		}
+		full := filepath.Join(opts.Root, filepath.FromSlash(clean))
+		info, err := os.Stat(full)
+		if errors.Is(err, fs.ErrNotExist) && opts.SkipMissing {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("CollectArchiveFiles: %w", err)
+		}
+		if !info.IsDir() {
+			if err := add(full); err != nil {
+				return nil, fmt.Errorf("CollectArchiveFiles: %w", err)
+			}
+			continue
+		}
+		err = filepath.WalkDir(full, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(d.Name(), ".") && p != full {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			return add(p)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("CollectArchiveFiles: %w", err)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+func hashFile(p string) (int64, string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WriteArchivePack writes a tar of the files opts selects to w, compressed as opts.Compression, with
+// the manifest as its first entry. Files that change between hashing and packing fail the pack rather
+// than leave a manifest that does not match.
+func WriteArchivePack(w io.Writer, opts ArchivePackOptions) (ArchiveManifest, error) {
+	compression, err := ParseArchiveCompression(opts.Compression)
+	if err != nil {
+		return ArchiveManifest{}, err
+	}
+	if opts.Version == "" {
+		return ArchiveManifest{}, errors.New("WriteArchivePack: Version is empty")
+	}
+	files, err := CollectArchiveFiles(opts)
+	if err != nil {
+		return ArchiveManifest{}, err
+	}
+	if len(files) == 0 {
+		return ArchiveManifest{}, errors.New("WriteArchivePack: nothing to pack")
+	}
+	created := opts.CreatedAt.UTC().Truncate(time.Second)
+	m := ArchiveManifest{
+		Format:      ArchiveFormat,
+		Version:     opts.Version,
+		CreatedAt:   created.Format(time.RFC3339),
+		ToolVersion: ToolVersion(),
+		Compression: compression,
+		Files:       files,
+	}
+	for _, f := range files {
+		m.TotalBytes += f.Size
+	}
+	mb, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return ArchiveManifest{}, fmt.Errorf("WriteArchivePack: marshal manifest: %w", err)
+	}
+
+	cw, err := compressArchive(w, compression)
+	if err != nil {
+		return ArchiveManifest{}, err
+	}
+	tw := tar.NewWriter(cw)
+	header := func(name string, size int64) *tar.Header {
+		return &tar.Header{Typeflag: tar.TypeReg, Name: name, Size: size, Mode: 0o644, ModTime: created, Format: tar.FormatPAX}
+	}
+	err = func() error {
+		if err := tw.WriteHeader(header(ArchiveManifestFileName, int64(len(mb)))); err != nil {
+			return err
+		}
+		if _, err := tw.Write(mb); err != nil {
+			return err
+		}
+		for _, f := range files {
+			if err := tw.WriteHeader(header(f.Path, f.Size)); err != nil {
+				return err
+			}
+			if err := copyVerified(tw, filepath.Join(opts.Root, filepath.FromSlash(f.Path)), f); err != nil {
+				return err
+			}
+		}
+		return tw.Close()
+	}()
+	if cerr := cw.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return ArchiveManifest{}, fmt.Errorf("WriteArchivePack: %w", err)
+	}
+	return m, nil
+}
+
+// copyVerified copies the file at p to w, failing if it no longer matches f.
+func copyVerified(w io.Writer, p string, f ArchiveFile) error {
+	src, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, h), io.LimitReader(src, f.Size+1))
+	if err != nil {
+		return err
+	}
+	if n != f.Size || hex.EncodeToString(h.Sum(nil)) != f.SHA256 {
+		return fmt.Errorf("%s changed while packing", f.Path)
+	}
+	return nil
+}
+
+// VerifyArchivePack reads an archive written by WriteArchivePack from r and checks every file against
+// its manifest: each listed file must be present once with its size and hash, and nothing else may be.
+func VerifyArchivePack(r io.Reader, compression string) (ArchiveManifest, error) {
+	compression, err := ParseArchiveCompression(compression)
+	if err != nil {
+		return ArchiveManifest{}, err
+	}
+	dr, err := decompressArchive(r, compression)
+	if err != nil {
+		return ArchiveManifest{}, err
+	}
+	defer dr.Close()
+	tr := tar.NewReader(dr)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return ArchiveManifest{}, fmt.Errorf("VerifyArchivePack: read manifest: %w", err)
+	}
+	if hdr.Name != ArchiveManifestFileName {
+		return ArchiveManifest{}, fmt.Errorf("VerifyArchivePack: first entry is %q, want %s", hdr.Name, ArchiveManifestFileName)
+	}
+	var m ArchiveManifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return ArchiveManifest{}, fmt.Errorf("VerifyArchivePack: parse manifest: %w", err)
+	}
+	want := make(map[string]ArchiveFile, len(m.Files))
+	for _, f := range m.Files {
+		want[f.Path] = f
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return m, fmt.Errorf("VerifyArchivePack: %w", err)
+		}
+		f, ok := want[hdr.Name]
+		if !ok {
+			return m, fmt.Errorf("VerifyArchivePack: %s is not in the manifest", hdr.Name)
+		}
+		delete(want, hdr.Name)
+		h := sha256.New()
+		n, err := io.Copy(h, tr)
+		if err != nil {
+			return m, fmt.Errorf("VerifyArchivePack: %s: %w", hdr.Name, err)
+		}
+		if n != f.Size || hex.EncodeToString(h.Sum(nil)) != f.SHA256 {
+			return m, fmt.Errorf("VerifyArchivePack: %s does not match its manifest entry", hdr.Name)
+		}
+	}
+	if len(want) > 0 {
+		missing := make([]string, 0, len(want))
+		for p := range want {
+			missing = append(missing, p)
+		}
+		sort.Strings(missing)
+		return m, fmt.Errorf("VerifyArchivePack: missing from archive: %s", strings.Join(missing, ", "))
+	}
+	return m, nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// compressArchive wraps w in the compressor for compression. Closing the result flushes it but leaves
+// w open.
+func compressArchive(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case ArchiveGzip:
+		return gzip.NewWriter(w), nil
+	case ArchiveNone:
+		return nopWriteCloser{w}, nil
+	}
+	return startZstd(w, nil, "-q", "-c", "-T0")
+}
+
+// decompressArchive is the reader side of compressArchive.
+func decompressArchive(r io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case ArchiveGzip:
+		return gzip.NewReader(r)
+	case ArchiveNone:
+		return io.NopCloser(r), nil
+	}
+	pr, pw := io.Pipe()
+	zw, err := startZstd(pw, r, "-d", "-q", "-c")
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		pw.CloseWithError(zw.Close())
+		close(done)
+	}()
+	return &zstdReader{PipeReader: pr, done: done}, nil
+}
+
+// zstdReader reads a running zstd's output; Close stops it and waits for it to exit.
+type zstdReader struct {
+	*io.PipeReader
+	done chan struct{}
+}
+
+func (z *zstdReader) Close() error {
+	err := z.PipeReader.Close()
+	<-z.done
+	return err
+}
+
+// zstdProc is a running zstd; Close waits for it to exit.
+type zstdProc struct {
+	in     io.WriteCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func (z *zstdProc) Write(p []byte) (int, error) { return z.in.Write(p) }
+
+func (z *zstdProc) Close() error {
+	if z.in != nil {
+		_ = z.in.Close()
+	}
+	if err := z.cmd.Wait(); err != nil {
+		return fmt.Errorf("zstd: %w: %s", err, strings.TrimSpace(z.stderr.String()))
+	}
+	return nil
+}
+
+// ArchiveCompressionAvailable reports whether the tools compression needs are installed: zstd needs
+// the zstd binary on PATH, the others nothing. Callers check it up front so a long run doesn't fail
+// only when it reaches the archive.
+func ArchiveCompressionAvailable(compression string) bool {
+	if compression != ArchiveZstd {
+		return true
+	}
+	_, err := exec.LookPath("zstd")
+	return err == nil
+}
+
+// startZstd runs zstd with args, writing its output to w. With in nil, its input is fed through Write;
+// otherwise it reads in.
+func startZstd(w io.Writer, in io.Reader, args ...string) (*zstdProc, error) {
+	bin, err := exec.LookPath("zstd")
+	if err != nil {
+		return nil, errors.New("zstd compression needs the zstd binary on PATH; install it or use -compression gzip")
+	}
+	z := &zstdProc{cmd: exec.Command(bin, args...), stderr: &bytes.Buffer{}}
+	z.cmd.Stdout = w
+	z.cmd.Stderr = z.stderr
+	if in == nil {
+		if z.in, err = z.cmd.StdinPipe(); err != nil {
+			return nil, err
+		}
+	} else {
+		z.cmd.Stdin = in
+	}
+	if err := z.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start zstd: %w", err)
+	}
+	return z, nil
+}
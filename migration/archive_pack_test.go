@@ -0,0 +1,164 @@
+package migration
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeArchiveTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, body := range map[string]string{
+		"memory_shards/memory_0001.md":            "# shard one\n",
+		"memory_shards/memory_index.json":         `{"conversation_id":"c1"}` + "\n",
+		"memory_shards/.pack-tmp-123":             "partial",
+		"summaries/index.json":                    `{"summary_path":"a"}` + "\n",
+		"summaries/glossary.json":                 `{"terms":[]}`,
+		"summaries/c1/c1_chunk_0001.summary.json": `{}`,
+		PipelineReportFileName:                    `{"status":"ok"}`,
+	} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	return root
+}
+
+func TestWriteArchivePack_RoundTripsWithManifest(t *testing.T) {
+	t.Parallel()
+
+	root := writeArchiveTree(t)
+	opts := ArchivePackOptions{
+		Root:        root,
+		Entries:     DefaultArchiveEntries,
+		SkipMissing: true,
+		Version:     "2024-06",
+		Compression: ArchiveGzip,
+		CreatedAt:   time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+	}
+	var buf bytes.Buffer
+	m, err := WriteArchivePack(&buf, opts)
+	if err != nil {
+		t.Fatalf("WriteArchivePack: %v", err)
+	}
+	var paths []string
+	for _, f := range m.Files {
+		paths = append(paths, f.Path)
+	}
+	want := []string{"memory_shards/memory_0001.md", "memory_shards/memory_index.json", PipelineReportFileName, "summaries/glossary.json", "summaries/index.json"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("paths=%v want %v", paths, want)
+	}
+	if m.Format != ArchiveFormat || m.Version != "2024-06" || m.CreatedAt != "2024-06-01T12:00:00Z" || m.TotalBytes == 0 {
+		t.Fatalf("manifest=%+v", m)
+	}
+
+	// The same inputs pack to the same bytes.
+	var again bytes.Buffer
+	if _, err := WriteArchivePack(&again, opts); err != nil {
+		t.Fatalf("WriteArchivePack again: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), again.Bytes()) {
+		t.Fatal("archive is not reproducible")
+	}
+
+	got, err := VerifyArchivePack(bytes.NewReader(buf.Bytes()), ArchiveGzip)
+	if err != nil {
+		t.Fatalf("VerifyArchivePack: %v", err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Fatalf("verified manifest=%+v want %+v", got, m)
+	}
+
+	// Explicit entries must exist.
+	opts.Entries, opts.SkipMissing = []string{"summaries/index.json", "missing.json"}, false
+	if _, err := WriteArchivePack(io.Discard, opts); err == nil {
+		t.Fatal("expected error for a missing entry")
+	}
+	opts.Entries = []string{"../outside"}
+	if _, err := WriteArchivePack(io.Discard, opts); err == nil {
+		t.Fatal("expected error for an entry outside the root")
+	}
+}
+
+func TestVerifyArchivePack_DetectsTampering(t *testing.T) {
+	t.Parallel()
+
+	m := ArchiveManifest{Format: ArchiveFormat, Version: "v", Files: []ArchiveFile{
+		{Path: "a.json", Size: 2, SHA256: "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"}, // "{}"
+	}}
+	build := func(entries map[string]string, order ...string) []byte {
+		t.Helper()
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(zw)
+		for _, name := range order {
+			body := entries[name]
+			if err := tw.WriteHeader(&tar.Header{Name: name, Size: int64(len(body)), Mode: 0o644, Typeflag: tar.TypeReg}); err != nil {
+				t.Fatalf("header: %v", err)
+			}
+			if _, err := tw.Write([]byte(body)); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+		}
+		_ = tw.Close()
+		_ = zw.Close()
+		return buf.Bytes()
+	}
+	manifest := `{"format":"` + ArchiveFormat + `","version":"v","files":[{"path":"a.json","size":2,"sha256":"` + m.Files[0].SHA256 + `"}]}`
+
+	cases := map[string]struct {
+		entries map[string]string
+		order   []string
+		wantErr string
+	}{
+		"ok":          {map[string]string{ArchiveManifestFileName: manifest, "a.json": "{}"}, []string{ArchiveManifestFileName, "a.json"}, ""},
+		"changed":     {map[string]string{ArchiveManifestFileName: manifest, "a.json": "[]"}, []string{ArchiveManifestFileName, "a.json"}, "does not match"},
+		"missing":     {map[string]string{ArchiveManifestFileName: manifest}, []string{ArchiveManifestFileName}, "missing from archive: a.json"},
+		"extra":       {map[string]string{ArchiveManifestFileName: manifest, "a.json": "{}", "b.json": "{}"}, []string{ArchiveManifestFileName, "a.json", "b.json"}, "not in the manifest"},
+		"no-manifest": {map[string]string{"a.json": "{}"}, []string{"a.json"}, "first entry"},
+	}
+	for name, tc := range cases {
+		_, err := VerifyArchivePack(bytes.NewReader(build(tc.entries, tc.order...)), ArchiveGzip)
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Fatalf("%s: %v", name, err)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Fatalf("%s: err=%v want %q", name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestWriteArchivePack_Zstd(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("zstd"); err != nil {
+		t.Skip("zstd not installed")
+	}
+
+	opts := ArchivePackOptions{Root: writeArchiveTree(t), Entries: []string{"summaries"}, Version: "v", Compression: ArchiveZstd}
+	var buf bytes.Buffer
+	m, err := WriteArchivePack(&buf, opts)
+	if err != nil {
+		t.Fatalf("WriteArchivePack: %v", err)
+	}
+	got, err := VerifyArchivePack(&buf, ArchiveZstd)
+	if err != nil {
+		t.Fatalf("VerifyArchivePack: %v", err)
+	}
+	if len(got.Files) != len(m.Files) {
+		t.Fatalf("files=%d want %d", len(got.Files), len(m.Files))
+	}
+}
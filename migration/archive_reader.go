@@ -0,0 +1,160 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+)
+
+// Archive reads the summaries a pipeline run wrote, so tools built on the archive walk it without
+// knowing its directory layout or artifact file names. Each ForEach method finds its artifacts first
+// and decodes them one at a time as fn asks for them, in path order. Returning fs.SkipAll from fn
+// stops the iteration without an error.
+//
+// An empty directory field skips that kind of artifact; set the fields directly to read the outputs
+// of stages run with their own -out directories.
+type Archive struct {
+	// FS is the filesystem the archive is read from (default fileutils.OS). The directories are OS
+	// paths as the pipeline stores them; see fileutils.FSPath.
+	FS fs.FS
+
+	// SummariesDir holds chunk-summarizer's chunk summaries and chunk sentiment summaries.
+	SummariesDir string
+	// ThreadSummariesDir holds thread-rollup's semantic rollups.
+	ThreadSummariesDir string
+	// ThreadSentimentDir holds thread-rollup's sentiment rollups.
+	ThreadSentimentDir string
+}
+
+// OpenArchive opens the archive archive-pipeline wrote under dir on fsys (fileutils.OS for the host
+// filesystem), which is either its -base-dir or the threads directory inside it. It fails when dir
+// holds none of the summary directories.
+func OpenArchive(fsys fs.FS, dir string) (*Archive, error) {
+	isDir := func(p string) bool {
+		info, err := fs.Stat(fsys, fileutils.FSPath(fsys, p))
+		return err == nil && info.IsDir()
+	}
+	threads := dir
+	if p := fileutils.JoinFS(fsys, dir, "threads"); isDir(p) {
+		threads = p
+	}
+	a := &Archive{FS: fsys}
+	found := false
+	for _, d := range []struct {
+		field *string
+		name  string
+	}{
+		{&a.SummariesDir, "summaries"},
+		{&a.ThreadSummariesDir, "thread_summaries"},
+		{&a.ThreadSentimentDir, "thread_sentiment_summaries"},
+	} {
+		if p := fileutils.JoinFS(fsys, threads, d.name); isDir(p) {
+			*d.field = p
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("OpenArchive: no summaries, thread_summaries or thread_sentiment_summaries directory in %s", dir)
+	}
+	return a, nil
+}
+
+// ForEachThreadSummary calls fn with each semantic rollup and its path. Split rollup parts are
+// skipped, as are rollups without a conversation ID.
+func (a *Archive) ForEachThreadSummary(fn func(path string, s ThreadSummary) error) error {
+	return forEachArtifact(a.fsys(), a.ThreadSummariesDir, layout.ThreadSummary, func(path string, s ThreadSummary) error {
+		if s.ConversationID == "" {
+			return nil
+		}
+		return fn(path, s)
+	})
+}
+
+// ForEachSentiment calls fn with each sentiment rollup and its path, skipping parts like
+// ForEachThreadSummary.
+func (a *Archive) ForEachSentiment(fn func(path string, s ThreadSentimentSummary) error) error {
+	return forEachArtifact(a.fsys(), a.ThreadSentimentDir, layout.ThreadSentiment, func(path string, s ThreadSentimentSummary) error {
+		if s.ConversationID == "" {
+			return nil
+		}
+		return fn(path, s)
+	})
+}
+
+// ForEachChunkSummary calls fn with each chunk summary and its path, skipping summaries without a
+// conversation ID.
+func (a *Archive) ForEachChunkSummary(fn func(path string, s ChunkSummary) error) error {
+	return forEachArtifact(a.fsys(), a.SummariesDir, layout.ChunkSummary, func(path string, s ChunkSummary) error {
+		if s.ConversationID == "" {
+			return nil
+		}
+		return fn(path, s)
+	})
+}
+
+// ForEachChunkSentiment calls fn with each chunk sentiment summary and its path, skipping them like
+// ForEachChunkSummary.
+func (a *Archive) ForEachChunkSentiment(fn func(path string, s ChunkSentimentSummary) error) error {
+	return forEachArtifact(a.fsys(), a.SummariesDir, layout.ChunkSentiment, func(path string, s ChunkSentimentSummary) error {
+		if s.ConversationID == "" {
+			return nil
+		}
+		return fn(path, s)
+	})
+}
+
+func (a *Archive) fsys() fs.FS {
+	if a.FS == nil {
+		return fileutils.OS
+	}
+	return a.FS
+}
+
+// ArtifactPaths lists the kind artifacts under root on fsys, sorted. root is a stored OS path (see
+// fileutils.FSPath) and the paths returned are names on fsys. An empty or missing root has none.
+func ArtifactPaths(fsys fs.FS, root string, kind layout.Kind) ([]string, error) {
+	if root == "" {
+		return nil, nil
+	}
+	var paths []string
+	err := fs.WalkDir(fsys, fileutils.FSPath(fsys, root), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && layout.Is(path, kind) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("walk %s: %w", root, err)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// forEachArtifact decodes each kind artifact under dir on fsys into a T and hands it to fn. An empty
+// or missing dir has no artifacts.
+func forEachArtifact[T any](fsys fs.FS, dir string, kind layout.Kind, fn func(path string, v T) error) error {
+	paths, err := ArtifactPaths(fsys, dir, kind)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		var v T
+		if err := fileutils.ReadArtifactFS(fsys, p, &v); err != nil {
+			return err
+		}
+		if err := fn(p, v); err != nil {
+			if errors.Is(err, fs.SkipAll) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
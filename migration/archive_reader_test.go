@@ -0,0 +1,116 @@
+package migration
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+)
+
+func TestOpenArchive_IteratesRecordsByKind(t *testing.T) {
+	t.Parallel()
+
+	base := t.TempDir()
+	threads := filepath.Join(base, "threads")
+	write := func(rel string, v any) {
+		t.Helper()
+		if err := fileutils.WriteArtifactAtomic(filepath.Join(threads, filepath.FromSlash(rel)), v, false); err != nil {
+			t.Fatalf("write %s: %v", rel, err)
+		}
+	}
+	write("summaries/index.json", IndexRecord{ConversationID: "c1"})
+	write("summaries/c1/100_1.summary.json", ChunkSummary{ConversationID: "c1", ChunkNumber: 1})
+	write("summaries/c1/100_2.summary.json", ChunkSummary{ConversationID: "c1", ChunkNumber: 2})
+	write("summaries/c1/100_1.sentiment.summary.json", ChunkSentimentSummary{ConversationID: "c1", ChunkNumber: 1})
+	write("thread_summaries/c1.thread.summary.json", ThreadSummary{ConversationID: "c1", Title: "one"})
+	write("thread_summaries/c2.thread.summary.json", ThreadSummary{ConversationID: "c2", Title: "two"})
+	write(layout.PartName("thread_summaries/c3", layout.ThreadSummary, 1, 2), ThreadSummary{ConversationID: "c3"})
+	write("thread_summaries/empty.thread.summary.json", ThreadSummary{})
+
+	for _, dir := range []string{base, threads} {
+		a, err := OpenArchive(fileutils.OS, dir)
+		if err != nil {
+			t.Fatalf("OpenArchive(%s): %v", dir, err)
+		}
+		if a.ThreadSentimentDir != "" {
+			t.Fatalf("ThreadSentimentDir=%q for a missing directory", a.ThreadSentimentDir)
+		}
+
+		var titles []string
+		if err := a.ForEachThreadSummary(func(_ string, s ThreadSummary) error {
+			titles = append(titles, s.Title)
+			return nil
+		}); err != nil {
+			t.Fatalf("ForEachThreadSummary: %v", err)
+		}
+		if len(titles) != 2 || titles[0] != "one" || titles[1] != "two" {
+			t.Fatalf("titles=%v, want [one two]", titles)
+		}
+
+		var chunks []int
+		if err := a.ForEachChunkSummary(func(path string, s ChunkSummary) error {
+			chunks = append(chunks, s.ChunkNumber)
+			return fs.SkipAll
+		}); err != nil {
+			t.Fatalf("ForEachChunkSummary: %v", err)
+		}
+		if len(chunks) != 1 || chunks[0] != 1 {
+			t.Fatalf("chunks=%v, want [1] after SkipAll", chunks)
+		}
+
+		n := 0
+		if err := a.ForEachChunkSentiment(func(string, ChunkSentimentSummary) error { n++; return nil }); err != nil || n != 1 {
+			t.Fatalf("ForEachChunkSentiment n=%d err=%v", n, err)
+		}
+		if err := a.ForEachSentiment(func(string, ThreadSentimentSummary) error { n++; return nil }); err != nil || n != 1 {
+			t.Fatalf("ForEachSentiment n=%d err=%v", n, err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(threads, "thread_summaries", "bad.thread.summary.json"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a := &Archive{ThreadSummariesDir: filepath.Join(threads, "thread_summaries")}
+	if err := a.ForEachThreadSummary(func(string, ThreadSummary) error { return nil }); err == nil {
+		t.Fatal("expected an error for a corrupt rollup")
+	}
+	if _, err := OpenArchive(fileutils.OS, t.TempDir()); err == nil {
+		t.Fatal("expected an error for a directory without summaries")
+	}
+}
+
+func TestOpenArchive_ReadsFromFS(t *testing.T) {
+	t.Parallel()
+
+	rollup, err := json.Marshal(ThreadSummary{ConversationID: "c1", Title: "one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"archive/threads/thread_summaries/c1.thread.summary.json": {Data: rollup},
+		"archive/threads/thread_summaries/notes.txt":              {Data: []byte("not a rollup")},
+	}
+	a, err := OpenArchive(fsys, "archive")
+	if err != nil {
+		t.Fatalf("OpenArchive: %v", err)
+	}
+	var paths []string
+	if err := a.ForEachThreadSummary(func(path string, s ThreadSummary) error {
+		paths = append(paths, path+"="+s.Title)
+		return nil
+	}); err != nil {
+		t.Fatalf("ForEachThreadSummary: %v", err)
+	}
+	if want := "archive/threads/thread_summaries/c1.thread.summary.json=one"; len(paths) != 1 || paths[0] != want {
+		t.Fatalf("paths=%q, want [%s]", paths, want)
+	}
+
+	if got, err := ArtifactPaths(fsys, "archive/missing", layout.ThreadSummary); err != nil || got != nil {
+		t.Fatalf("ArtifactPaths(missing)=%q err=%v, want none", got, err)
+	}
+}
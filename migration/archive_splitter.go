@@ -2,7 +2,10 @@ package migration
 
 import (
 	"bufio"
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,18 +13,84 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
-	"unicode"
+	"unicode/utf8"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
 )
 
 // SimplifiedConversation is a summarization-friendly representation of a conversation/thread.
 // It keeps just the fields that are typically useful for building condensed summaries and RAG indexes.
 type SimplifiedConversation struct {
-	ConversationID string              `json:"conversation_id"`
-	Title          string              `json:"title,omitempty"`
-	CreateTime     *float64            `json:"create_time,omitempty"`
-	UpdateTime     *float64            `json:"update_time,omitempty"`
-	Messages       []SimplifiedMessage `json:"messages"`
+	ConversationID string   `json:"conversation_id"`
+	Title          string   `json:"title,omitempty"`
+	CreateTime     *float64 `json:"create_time,omitempty"`
+	UpdateTime     *float64 `json:"update_time,omitempty"`
+
+	// Source is the base name of the export file the thread was split from, set only when one run
+	// splits several exports.
+	Source string `json:"source,omitempty"`
+
+	// SourceType names the platform the thread came from (SourceTypeChatGPT, SourceTypeWhatsApp, ...).
+	// It flows into chunks, summaries, and index rows so later stages can filter by it; threads split
+	// before it existed read as ChatGPT (see NormalizeSourceType).
+	SourceType string `json:"source_type,omitempty"`
+
+	// Project is set when the thread was created inside a ChatGPT Project or custom GPT.
+	Project *ProjectInfo `json:"project,omitempty"`
+
+	// Participants lists the named speakers, set when messages carry speaker identities (group chats
+	// imported from other platforms, say).
+	Participants []Participant `json:"participants,omitempty"`
+
+	// CustomInstructions holds the user's custom instructions ("about you" / "how to respond") that
+	// the export stores as a hidden context message. That message is dropped from Messages.
+	CustomInstructions string `json:"custom_instructions,omitempty"`
+
+	Messages []SimplifiedMessage `json:"messages"`
+}
+
+// Source types: the platforms SimplifiedConversation.SourceType names.
+const (
+	SourceTypeChatGPT  = "chatgpt"
+	SourceTypeWhatsApp = "whatsapp"
+	SourceTypeTelegram = "telegram"
+	SourceTypeEmail    = "email"
+	SourceTypeJournal  = "journal"
+)
+
+// NormalizeSourceType lower-cases a source type, reading an empty one as SourceTypeChatGPT: the
+// archive held only ChatGPT threads before threads carried their source type.
+func NormalizeSourceType(sourceType string) string {
+	sourceType = strings.ToLower(strings.TrimSpace(sourceType))
+	if sourceType == "" {
+		return SourceTypeChatGPT
+	}
+	return sourceType
+}
+
+// ProjectInfo identifies the ChatGPT Project or custom GPT (a "gizmo" in the export) a thread belongs to.
+type ProjectInfo struct {
+	ID string `json:"id"`
+
+	// Kind is "project" for ChatGPT Projects and "gpt" for custom GPTs.
+	Kind string `json:"kind,omitempty"`
+
+	// Name is only present when the export carries it.
+	Name string `json:"name,omitempty"`
+}
+
+// Label returns the project name, falling back to its ID. It is empty for a nil ProjectInfo.
+func (p *ProjectInfo) Label() string {
+	if p == nil {
+		return ""
+	}
+	if strings.TrimSpace(p.Name) != "" {
+		return strings.TrimSpace(p.Name)
+	}
+	return p.ID
 }
 
 // SimplifiedMessage is a summarization-friendly representation of a single message.
@@ -36,8 +105,32 @@ type SimplifiedMessage struct {
 	Domain string `json:"domain,omitempty"`
 	Title  string `json:"title,omitempty"`
 	URL    string `json:"url,omitempty"`
+
+	// ToolCall is set on tool invocations and tool results when SplitOptions.PreserveToolCalls is on.
+	ToolCall *ToolCall `json:"tool_call,omitempty"`
+
+	// Speaker identifies who wrote the message when the export names its author, so conversations with
+	// several human participants keep statements attributed. Tool messages use Name for the tool instead.
+	Speaker string `json:"speaker,omitempty"`
+}
+
+// ToolCall is the structured form of a tool invocation (an assistant message addressed to a tool) or a
+// tool result (a role=tool message).
+type ToolCall struct {
+	// Name is the tool, e.g. "python", "browser", "dalle.text2im".
+	Name string `json:"name"`
+
+	// Arguments is the invocation payload (code, query, JSON args), truncated to
+	// SplitOptions.ToolArgsMaxChars. Empty on results.
+	Arguments string `json:"arguments,omitempty"`
+
+	// Status is the export's message or aggregate result status, e.g. "finished_successfully", "success".
+	Status string `json:"status,omitempty"`
 }
 
+// DefaultToolArgsMaxChars bounds ToolCall.Arguments when SplitOptions.ToolArgsMaxChars is 0.
+const DefaultToolArgsMaxChars = 500
+
 // SplitOptions controls how SplitConversationArchive writes per-thread files.
 type SplitOptions struct {
 	// ArrayField is the JSON field name that contains the conversation array,
@@ -59,14 +152,78 @@ type SplitOptions struct {
 
 	// FileMode is used when creating output files (defaults to 0o644).
 	FileMode fs.FileMode
+
+	// PreserveToolCalls records tool name, truncated arguments, and status on SimplifiedMessage.ToolCall
+	// instead of only flattening tool traffic to text/URL.
+	PreserveToolCalls bool
+
+	// ToolArgsMaxChars bounds ToolCall.Arguments (defaults to DefaultToolArgsMaxChars).
+	ToolArgsMaxChars int
+
+	// RoleMap renames author roles (keys are matched case-insensitively), e.g. {"human": "user",
+	// "bot": "assistant"} for exports from platforms with other role names.
+	RoleMap map[string]string
+
+	// StatsPath, when set, receives one ThreadStats JSONL row per written conversation.
+	StatsPath string
+
+	// MaxConversations stops the split once this many threads are written (0 = no limit), e.g. for a
+	// small pilot run before splitting the whole export.
+	MaxConversations int
+
+	// OnlyIDs, when non-nil, restricts the split to these conversation IDs (e.g. a pilot sample).
+	OnlyIDs map[string]bool
+
+	// Memories collects the memories the assistant saved about the user (model_set_context entries
+	// and "bio" tool calls) across the whole export and writes them as one more thread,
+	// MemoriesConversationID, so they reach the glossary and memory shards like conversation content.
+	Memories bool
+
+	stats *fileutils.JSONLWriter
 }
 
 // SplitResult contains basic stats from a split run.
 type SplitResult struct {
 	ThreadsWritten int
 	BytesWritten   int64
+
+	// DuplicatesSkipped counts conversations skipped because another export had a newer copy.
+	DuplicatesSkipped int
 }
 
+// CollectExports expands export paths: files are used as given, directories contribute their *.json
+// files in name order.
+func CollectExports(paths []string) ([]string, error) {
+	var out []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("stat export: %w", err)
+		}
+		if !info.IsDir() {
+			out = append(out, p)
+			continue
+		}
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, fmt.Errorf("read export dir: %w", err)
+		}
+		n := len(out)
+		for _, e := range entries {
+			if e.Type().IsRegular() && strings.EqualFold(filepath.Ext(e.Name()), ".json") && !IsBookkeepingFile(e.Name()) {
+				out = append(out, filepath.Join(p, e.Name()))
+			}
+		}
+		if len(out) == n {
+			return nil, fmt.Errorf("no .json exports in %s", p)
+		}
+	}
+	return out, nil
+}
+
+// errSplitLimit stops the export stream once SplitOptions.MaxConversations threads are written.
+var errSplitLimit = errors.New("conversation limit reached")
+
 // SplitConversationArchive reads a large OpenAI conversations export and writes one JSON file per
 // thread (conversation) into outputDir.
 //
@@ -76,12 +233,28 @@ type SplitResult struct {
 //
 // It uses a streaming decoder and never reads the full file into memory at once.
 func SplitConversationArchive(ctx context.Context, inputPath, outputDir string, opts SplitOptions) (SplitResult, error) {
+	return SplitConversationArchives(ctx, []string{inputPath}, outputDir, opts)
+}
+
+// SplitConversationArchives splits several exports (different accounts or dates) into one outputDir.
+// A conversation present in more than one export is written once, from the export with the newest
+// update_time; ties go to the export listed later. Each thread records its export in Source.
+// Repeats within a single export are kept as SplitConversationArchive keeps them.
+//
+// Exports are streamed twice: once to pick each conversation's source and find output names shared
+// by several conversations (see fileNamer), once to write.
+func SplitConversationArchives(ctx context.Context, inputPaths []string, outputDir string, opts SplitOptions) (SplitResult, error) {
 	if ctx == nil {
 		return SplitResult{}, errors.New("SplitConversationArchive: ctx is nil")
 	}
-	if inputPath == "" {
+	if len(inputPaths) == 0 {
 		return SplitResult{}, errors.New("SplitConversationArchive: inputPath is empty")
 	}
+	for _, p := range inputPaths {
+		if p == "" {
+			return SplitResult{}, errors.New("SplitConversationArchive: inputPath is empty")
+		}
+	}
 	if outputDir == "" {
 		return SplitResult{}, errors.New("SplitConversationArchive: outputDir is empty")
 	}
@@ -95,9 +268,228 @@ func SplitConversationArchive(ctx context.Context, inputPath, outputDir string,
 		return SplitResult{}, fmt.Errorf("SplitConversationArchive: mkdir outputDir: %w", err)
 	}
 
+	newest, groups, err := scanExports(ctx, inputPaths, opts.ArrayField)
+	if err != nil {
+		return SplitResult{}, err
+	}
+	if opts.Memories {
+		groups[threadNameKey(MemoriesConversationID)]++
+	}
+	names := newFileNamer(groups)
+
+	if opts.StatsPath != "" {
+		var err error
+		opts.stats, err = fileutils.CreateJSONL(opts.StatsPath)
+		if err != nil {
+			return SplitResult{}, fmt.Errorf("SplitConversationArchive: open stats: %w", err)
+		}
+		defer opts.stats.Close()
+	}
+
+	var res SplitResult
+	var memories *memoryCollector
+	if opts.Memories {
+		memories = &memoryCollector{}
+	}
+	for i, inputPath := range inputPaths {
+		if opts.MaxConversations > 0 && res.ThreadsWritten >= opts.MaxConversations {
+			break
+		}
+		err := forEachConversation(ctx, inputPath, opts.ArrayField, func(raw json.RawMessage) error {
+			if opts.MaxConversations > 0 && res.ThreadsWritten >= opts.MaxConversations {
+				return errSplitLimit
+			}
+			var conv rawConversation
+			if err := json.Unmarshal(raw, &conv); err != nil {
+				return fmt.Errorf("SplitConversationArchive: unmarshal conversation: %w", err)
+			}
+			simplified, id, err := simplifyRawConversation(conv, opts)
+			if err != nil {
+				return err
+			}
+			if memories != nil {
+				// Every copy counts: an older export may hold memories the newest one dropped.
+				memories.addConversation(conv, inputPath)
+			}
+			if newest[id] != i {
+				res.DuplicatesSkipped++
+				return nil
+			}
+			if opts.OnlyIDs != nil && !opts.OnlyIDs[id] {
+				return nil
+			}
+			if len(inputPaths) > 1 {
+				simplified.Source = filepath.Base(inputPath)
+			}
+			return writeConversation(outputDir, simplified, id, raw, opts, names, &res)
+		})
+		if err != nil && !errors.Is(err, errSplitLimit) {
+			return SplitResult{}, err
+		}
+	}
+	if memories != nil {
+		if err := writeMemoriesThread(outputDir, memories.memories(), opts, names, &res); err != nil {
+			return SplitResult{}, err
+		}
+	}
+	if opts.stats != nil {
+		if err := opts.stats.Close(); err != nil {
+			return SplitResult{}, fmt.Errorf("SplitConversationArchive: close stats: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// WriteConversations writes conversations read from other platforms' exports (see the importers
+// package) into outputDir as SplitConversationArchives writes export threads, with the same
+// OnlyIDs, MaxConversations, stats and overwrite handling. A conversation given more than once is
+// written once, from the copy with the newest update_time; ties go to the later copy.
+func WriteConversations(outputDir string, convs []SimplifiedConversation, opts SplitOptions) (SplitResult, error) {
+	if outputDir == "" {
+		return SplitResult{}, errors.New("WriteConversations: outputDir is empty")
+	}
+	if opts.DirMode == 0 {
+		opts.DirMode = 0o755
+	}
+	if opts.FileMode == 0 {
+		opts.FileMode = 0o644
+	}
+	if err := os.MkdirAll(outputDir, opts.DirMode); err != nil {
+		return SplitResult{}, fmt.Errorf("WriteConversations: mkdir outputDir: %w", err)
+	}
+	if opts.StatsPath != "" {
+		var err error
+		opts.stats, err = fileutils.CreateJSONL(opts.StatsPath)
+		if err != nil {
+			return SplitResult{}, fmt.Errorf("WriteConversations: open stats: %w", err)
+		}
+		defer opts.stats.Close()
+	}
+
+	newest := make(map[string]int, len(convs))
+	for i, c := range convs {
+		if j, ok := newest[c.ConversationID]; !ok || compareTimes(c.UpdateTime, convs[j].UpdateTime) >= 0 {
+			newest[c.ConversationID] = i
+		}
+	}
+	groups := make(map[string]int)
+	for id := range newest {
+		groups[threadNameKey(id)]++
+	}
+	names := newFileNamer(groups)
+	var res SplitResult
+	for i, c := range convs {
+		if newest[c.ConversationID] != i {
+			res.DuplicatesSkipped++
+			continue
+		}
+		if opts.MaxConversations > 0 && res.ThreadsWritten >= opts.MaxConversations {
+			break
+		}
+		if opts.OnlyIDs != nil && !opts.OnlyIDs[c.ConversationID] {
+			continue
+		}
+		if err := writeConversation(outputDir, c, c.ConversationID, nil, opts, names, &res); err != nil {
+			return SplitResult{}, err
+		}
+	}
+	if opts.stats != nil {
+		if err := opts.stats.Close(); err != nil {
+			return SplitResult{}, fmt.Errorf("WriteConversations: close stats: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// writeMemoriesThread writes the saved memories collected during a split as one more thread, subject
+// to the same MaxConversations and OnlyIDs limits as the conversations.
+func writeMemoriesThread(outputDir string, memories []AssistantMemory, opts SplitOptions, names *fileNamer, res *SplitResult) error {
+	thread, ok := MemoriesThread(memories)
+	if !ok {
+		return nil
+	}
+	if opts.MaxConversations > 0 && res.ThreadsWritten >= opts.MaxConversations {
+		return nil
+	}
+	if opts.OnlyIDs != nil && !opts.OnlyIDs[MemoriesConversationID] {
+		return nil
+	}
+	thread.Participants = MessageParticipants(thread.Messages)
+	return writeConversation(outputDir, thread, MemoriesConversationID, nil, opts, names, res)
+}
+
+// newestSources maps each conversation ID to the index of the export holding its newest copy.
+func newestSources(ctx context.Context, inputPaths []string, arrayField string) (map[string]int, error) {
+	newest, _, err := scanExports(ctx, inputPaths, arrayField)
+	return newest, err
+}
+
+// scanExports streams the exports once and returns newestSources' map along with groups, the number of
+// conversations the split will write under each output name key (see threadNameKey): every copy of an
+// ID in its newest export counts, so repeats within one export share a group.
+func scanExports(ctx context.Context, inputPaths []string, arrayField string) (newest, groups map[string]int, err error) {
+	type best struct {
+		src     int
+		updated *float64
+	}
+	type copyKey struct {
+		id  string
+		src int
+	}
+	bests := make(map[string]best)
+	copies := make(map[copyKey]int)
+	for i, inputPath := range inputPaths {
+		err := forEachConversation(ctx, inputPath, arrayField, func(raw json.RawMessage) error {
+			var head struct {
+				ConversationID string   `json:"conversation_id"`
+				ID             string   `json:"id"`
+				UpdateTime     *float64 `json:"update_time"`
+			}
+			if err := json.Unmarshal(raw, &head); err != nil {
+				return fmt.Errorf("SplitConversationArchive: unmarshal conversation: %w", err)
+			}
+			id := head.ConversationID
+			if id == "" {
+				id = head.ID
+			}
+			copies[copyKey{id, i}]++
+			b, ok := bests[id]
+			if c := compareTimes(head.UpdateTime, b.updated); !ok || c > 0 || c == 0 && i > b.src {
+				bests[id] = best{src: i, updated: head.UpdateTime}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	newest = make(map[string]int, len(bests))
+	groups = make(map[string]int, len(bests))
+	for id, b := range bests {
+		newest[id] = b.src
+		groups[threadNameKey(id)] += copies[copyKey{id, b.src}]
+	}
+	return newest, groups, nil
+}
+
+// compareTimes orders optional timestamps, a missing one before any present one.
+func compareTimes(a, b *float64) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return cmp.Compare(*a, *b)
+}
+
+// forEachConversation streams the conversation elements of one export to fn.
+func forEachConversation(ctx context.Context, inputPath, arrayField string, fn func(raw json.RawMessage) error) error {
 	f, err := os.Open(inputPath)
 	if err != nil {
-		return SplitResult{}, fmt.Errorf("SplitConversationArchive: open input: %w", err)
+		return fmt.Errorf("SplitConversationArchive: open input: %w", err)
 	}
 	defer f.Close()
 
@@ -107,55 +499,52 @@ func SplitConversationArchive(ctx context.Context, inputPath, outputDir string,
 
 	tok, err := dec.Token()
 	if err != nil {
-		return SplitResult{}, fmt.Errorf("SplitConversationArchive: read first token: %w", err)
+		return fmt.Errorf("SplitConversationArchive: read first token: %w", err)
 	}
 
 	delim, ok := tok.(json.Delim)
 	if !ok {
-		return SplitResult{}, fmt.Errorf("SplitConversationArchive: expected JSON array/object, got %T", tok)
+		return fmt.Errorf("SplitConversationArchive: expected JSON array/object, got %T", tok)
 	}
 
-	seen := make(map[string]int)
-	var res SplitResult
-
 	switch delim {
 	case '[':
-		if err := splitArrayFromOpen(ctx, dec, outputDir, opts, seen, &res); err != nil {
-			return SplitResult{}, err
+		if err := forEachArrayElement(ctx, dec, fn); err != nil {
+			return err
 		}
 		// Consume the closing ']'.
 		if tok, err := dec.Token(); err != nil {
-			return SplitResult{}, fmt.Errorf("SplitConversationArchive: read closing array token: %w", err)
+			return fmt.Errorf("SplitConversationArchive: read closing array token: %w", err)
 		} else if d, ok := tok.(json.Delim); !ok || d != ']' {
-			return SplitResult{}, fmt.Errorf("SplitConversationArchive: expected closing ']', got %v", tok)
+			return fmt.Errorf("SplitConversationArchive: expected closing ']', got %v", tok)
 		}
-		return res, nil
+		return nil
 	case '{':
 		// Scan fields until we find the conversations array.
 		foundArray := false
 		for dec.More() {
 			select {
 			case <-ctx.Done():
-				return SplitResult{}, ctx.Err()
+				return ctx.Err()
 			default:
 			}
 
 			keyTok, err := dec.Token()
 			if err != nil {
-				return SplitResult{}, fmt.Errorf("SplitConversationArchive: read object key: %w", err)
+				return fmt.Errorf("SplitConversationArchive: read object key: %w", err)
 			}
 			key, ok := keyTok.(string)
 			if !ok {
-				return SplitResult{}, fmt.Errorf("SplitConversationArchive: expected string key, got %T", keyTok)
+				return fmt.Errorf("SplitConversationArchive: expected string key, got %T", keyTok)
 			}
 
 			valTok, err := dec.Token()
 			if err != nil {
-				return SplitResult{}, fmt.Errorf("SplitConversationArchive: read value token for key %q: %w", key, err)
+				return fmt.Errorf("SplitConversationArchive: read value token for key %q: %w", key, err)
 			}
 
-			isTarget := opts.ArrayField != "" && key == opts.ArrayField
-			if !isTarget && opts.ArrayField == "" && !foundArray {
+			isTarget := arrayField != "" && key == arrayField
+			if !isTarget && arrayField == "" && !foundArray {
 				if d, ok := valTok.(json.Delim); ok && d == '[' {
 					isTarget = true
 				}
@@ -164,42 +553,42 @@ func SplitConversationArchive(ctx context.Context, inputPath, outputDir string,
 			if isTarget {
 				d, ok := valTok.(json.Delim)
 				if !ok || d != '[' {
-					return SplitResult{}, fmt.Errorf("SplitConversationArchive: key %q was chosen as array but value isn't an array", key)
+					return fmt.Errorf("SplitConversationArchive: key %q was chosen as array but value isn't an array", key)
 				}
 				foundArray = true
-				if err := splitArrayFromOpen(ctx, dec, outputDir, opts, seen, &res); err != nil {
-					return SplitResult{}, err
+				if err := forEachArrayElement(ctx, dec, fn); err != nil {
+					return err
 				}
 				// Consume the closing ']'.
 				if tok, err := dec.Token(); err != nil {
-					return SplitResult{}, fmt.Errorf("SplitConversationArchive: read closing array token: %w", err)
+					return fmt.Errorf("SplitConversationArchive: read closing array token: %w", err)
 				} else if d, ok := tok.(json.Delim); !ok || d != ']' {
-					return SplitResult{}, fmt.Errorf("SplitConversationArchive: expected closing ']', got %v", tok)
+					return fmt.Errorf("SplitConversationArchive: expected closing ']', got %v", tok)
 				}
 				continue
 			}
 
 			if err := skipValue(dec, valTok); err != nil {
-				return SplitResult{}, fmt.Errorf("SplitConversationArchive: skip key %q value: %w", key, err)
+				return fmt.Errorf("SplitConversationArchive: skip key %q value: %w", key, err)
 			}
 		}
 
 		// Consume the closing '}'.
 		if tok, err := dec.Token(); err != nil {
-			return SplitResult{}, fmt.Errorf("SplitConversationArchive: read closing object token: %w", err)
+			return fmt.Errorf("SplitConversationArchive: read closing object token: %w", err)
 		} else if d, ok := tok.(json.Delim); !ok || d != '}' {
-			return SplitResult{}, fmt.Errorf("SplitConversationArchive: expected closing '}', got %v", tok)
+			return fmt.Errorf("SplitConversationArchive: expected closing '}', got %v", tok)
 		}
 		if !foundArray {
-			return SplitResult{}, errors.New("SplitConversationArchive: no conversations array found in top-level object")
+			return errors.New("SplitConversationArchive: no conversations array found in top-level object")
 		}
-		return res, nil
+		return nil
 	default:
-		return SplitResult{}, fmt.Errorf("SplitConversationArchive: unsupported top-level delimiter %q", delim)
+		return fmt.Errorf("SplitConversationArchive: unsupported top-level delimiter %q", delim)
 	}
 }
 
-func splitArrayFromOpen(ctx context.Context, dec *json.Decoder, outputDir string, opts SplitOptions, seen map[string]int, res *SplitResult) error {
+func forEachArrayElement(ctx context.Context, dec *json.Decoder, fn func(raw json.RawMessage) error) error {
 	for dec.More() {
 		select {
 		case <-ctx.Done():
@@ -211,60 +600,101 @@ func splitArrayFromOpen(ctx context.Context, dec *json.Decoder, outputDir string
 		if err := dec.Decode(&raw); err != nil {
 			return fmt.Errorf("SplitConversationArchive: decode conversation element: %w", err)
 		}
-
-		simplified, id, err := simplifyConversation(raw)
-		if err != nil {
+		if err := fn(raw); err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		base := sanitizeFilenameComponent(id)
-		if base == "" {
-			base = "thread"
-		}
+func writeConversation(outputDir string, simplified SimplifiedConversation, id string, raw json.RawMessage, opts SplitOptions, names *fileNamer, res *SplitResult) error {
+	base := threadFileBase(id)
 
-		seenCount := seen[base]
-		seen[base] = seenCount + 1
+	compact, err := json.Marshal(simplified)
+	if err != nil {
+		return fmt.Errorf("SplitConversationArchive: marshal (id=%q): %w", id, err)
+	}
 
-		filename := base
-		if seenCount > 0 {
-			filename = fmt.Sprintf("%s-%d", base, seenCount+1)
-		}
-		filename += ".json"
+	filename := names.name(base, compact) + ".json"
 
-		outPath := filepath.Join(outputDir, filename)
-		if !opts.OverwriteExisting {
-			if _, err := os.Stat(outPath); err == nil {
-				return fmt.Errorf("SplitConversationArchive: output file already exists: %s", outPath)
-			} else if !errors.Is(err, fs.ErrNotExist) {
-				return fmt.Errorf("SplitConversationArchive: stat output file: %w", err)
-			}
+	outPath := filepath.Join(outputDir, filename)
+	if !opts.OverwriteExisting {
+		if _, err := os.Stat(outPath); err == nil {
+			return fmt.Errorf("SplitConversationArchive: output file already exists: %s", outPath)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("SplitConversationArchive: stat output file: %w", err)
 		}
+	}
 
-		var toWrite []byte
-		if opts.Pretty {
-			b, err := json.MarshalIndent(simplified, "", "  ")
-			if err != nil {
-				return fmt.Errorf("SplitConversationArchive: marshal indent (id=%q): %w", id, err)
-			}
-			toWrite = b
-		} else {
-			b, err := json.Marshal(simplified)
-			if err != nil {
-				return fmt.Errorf("SplitConversationArchive: marshal (id=%q): %w", id, err)
-			}
-			toWrite = b
+	toWrite := compact
+	if opts.Pretty || fileutils.CanonicalJSON() {
+		if toWrite, err = fileutils.MarshalJSON(simplified, opts.Pretty); err != nil {
+			return fmt.Errorf("SplitConversationArchive: marshal (id=%q): %w", id, err)
 		}
+	}
 
-		n, err := writeFileAtomic(outputDir, outPath, toWrite, opts.FileMode)
-		if err != nil {
-			return fmt.Errorf("SplitConversationArchive: write output (id=%q): %w", id, err)
+	n, err := writeFileAtomic(outPath, toWrite, opts.FileMode)
+	if err != nil {
+		return fmt.Errorf("SplitConversationArchive: write output (id=%q): %w", id, err)
+	}
+	res.ThreadsWritten++
+	res.BytesWritten += n
+	if opts.stats != nil {
+		if err := opts.stats.Write(BuildThreadStats(simplified, filename, int64(len(raw)), n)); err != nil {
+			return fmt.Errorf("SplitConversationArchive: write stats (id=%q): %w", id, err)
 		}
-		res.ThreadsWritten++
-		res.BytesWritten += n
 	}
 	return nil
 }
 
+// threadFileBase is the output filename stem for a conversation ID before duplicates are resolved.
+func threadFileBase(id string) string {
+	if base := sanitizeFilenameComponent(id); base != "" {
+		return base
+	}
+	return "thread"
+}
+
+// threadNameKey is the key fileNamer groups a conversation ID's output name under. Names are compared
+// case-insensitively so IDs differing only in case don't collide on Windows or macOS.
+func threadNameKey(id string) string {
+	return strings.ToLower(threadFileBase(id))
+}
+
+// fileNamer picks output filename stems. A base name that only one conversation in the run maps to
+// is used as-is. Every conversation in a group sharing a base name gets a short hash of its
+// simplified content instead, so re-splitting a newer export yields the same names for unchanged
+// conversations regardless of their position in the input. Byte-identical repeats fall back to an
+// ordinal after the hash.
+type fileNamer struct {
+	// groups counts the conversations sharing each name key, known before any is written.
+	groups map[string]int
+	// used counts the names handed out so far, by lowercased name.
+	used map[string]int
+}
+
+func newFileNamer(groups map[string]int) *fileNamer {
+	return &fileNamer{groups: groups, used: make(map[string]int)}
+}
+
+// name returns the filename stem for a conversation with base name base and simplified content.
+func (n *fileNamer) name(base string, content []byte) string {
+	key := strings.ToLower(base)
+	if n.groups[key] <= 1 && n.used[key] == 0 {
+		n.used[key] = 1
+		return base
+	}
+
+	sum := sha256.Sum256(content)
+	name := base + "-" + hex.EncodeToString(sum[:])[:8]
+	key = strings.ToLower(name)
+	n.used[key]++
+	if c := n.used[key]; c > 1 {
+		return fmt.Sprintf("%s-%d", name, c)
+	}
+	return name
+}
+
 type rawConversation struct {
 	ConversationID string                `json:"conversation_id"`
 	ID             string                `json:"id"`
@@ -273,6 +703,12 @@ type rawConversation struct {
 	UpdateTime     *float64              `json:"update_time"`
 	CurrentNode    string                `json:"current_node"`
 	Mapping        map[string]rawMapNode `json:"mapping"`
+
+	GizmoID                string `json:"gizmo_id"`
+	GizmoType              string `json:"gizmo_type"`
+	ConversationTemplateID string `json:"conversation_template_id"`
+	ProjectName            string `json:"project_name"`
+	GizmoName              string `json:"gizmo_name"`
 }
 
 type rawMapNode struct {
@@ -287,6 +723,8 @@ type rawMessage struct {
 	CreateTime *float64        `json:"create_time"`
 	Content    json.RawMessage `json:"content"`
 	Metadata   map[string]any  `json:"metadata"`
+	Recipient  string          `json:"recipient"`
+	Status     string          `json:"status"`
 }
 
 type rawAuthor struct {
@@ -294,12 +732,16 @@ type rawAuthor struct {
 	Name *string `json:"name"`
 }
 
-func simplifyConversation(raw json.RawMessage) (SimplifiedConversation, string, error) {
+func simplifyConversation(raw json.RawMessage, opts SplitOptions) (SimplifiedConversation, string, error) {
 	var conv rawConversation
 	if err := json.Unmarshal(raw, &conv); err != nil {
 		return SimplifiedConversation{}, "", fmt.Errorf("SplitConversationArchive: unmarshal conversation: %w", err)
 	}
+	return simplifyRawConversation(conv, opts)
+}
 
+// simplifyRawConversation is simplifyConversation for an element already unmarshaled.
+func simplifyRawConversation(conv rawConversation, opts SplitOptions) (SimplifiedConversation, string, error) {
 	id := conv.ConversationID
 	if id == "" {
 		id = conv.ID
@@ -308,21 +750,95 @@ func simplifyConversation(raw json.RawMessage) (SimplifiedConversation, string,
 		return SimplifiedConversation{}, "", errors.New("SplitConversationArchive: conversation element missing conversation_id/id")
 	}
 
-	msgs, err := linearizeMessages(conv.Mapping, conv.CurrentNode)
+	msgs, err := linearizeMessages(conv.Mapping, conv.CurrentNode, opts)
 	if err != nil {
 		return SimplifiedConversation{}, "", fmt.Errorf("SplitConversationArchive: linearize messages (id=%q): %w", id, err)
 	}
 
 	return SimplifiedConversation{
-		ConversationID: id,
-		Title:          conv.Title,
-		CreateTime:     conv.CreateTime,
-		UpdateTime:     conv.UpdateTime,
-		Messages:       msgs,
+		ConversationID:     id,
+		Title:              conv.Title,
+		CreateTime:         conv.CreateTime,
+		UpdateTime:         conv.UpdateTime,
+		SourceType:         SourceTypeChatGPT,
+		Project:            projectFromConversation(conv),
+		CustomInstructions: customInstructionsFromMapping(conv.Mapping),
+		Participants:       MessageParticipants(msgs),
+		Messages:           msgs,
 	}, id, nil
 }
 
-func linearizeMessages(mapping map[string]rawMapNode, currentNode string) ([]SimplifiedMessage, error) {
+// projectFromConversation reads the gizmo fields the export sets on threads started in a Project
+// (gizmo IDs prefixed "g-p-", gizmo_type "snorlax") or a custom GPT.
+func projectFromConversation(conv rawConversation) *ProjectInfo {
+	id := strings.TrimSpace(conv.GizmoID)
+	if id == "" {
+		id = strings.TrimSpace(conv.ConversationTemplateID)
+	}
+	if id == "" {
+		return nil
+	}
+	kind := "gpt"
+	if strings.HasPrefix(id, "g-p-") || strings.EqualFold(strings.TrimSpace(conv.GizmoType), "snorlax") {
+		kind = "project"
+	}
+	name := strings.TrimSpace(conv.ProjectName)
+	if name == "" {
+		name = strings.TrimSpace(conv.GizmoName)
+	}
+	return &ProjectInfo{ID: id, Kind: kind, Name: name}
+}
+
+// customInstructionsFromMapping returns the custom instructions carried by the thread's
+// user_editable_context message, if any. Nodes are visited in ID order so the result is stable.
+func customInstructionsFromMapping(mapping map[string]rawMapNode) string {
+	ids := make([]string, 0, len(mapping))
+	for id := range mapping {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		n := mapping[id]
+		if n.Message == nil {
+			continue
+		}
+		if s := customInstructionsFromMessage(*n.Message); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func customInstructionsFromMessage(m rawMessage) string {
+	var content struct {
+		ContentType      string `json:"content_type"`
+		UserProfile      string `json:"user_profile"`
+		UserInstructions string `json:"user_instructions"`
+	}
+	if len(m.Content) == 0 || json.Unmarshal(m.Content, &content) != nil || content.ContentType != "user_editable_context" {
+		return ""
+	}
+	profile, instructions := content.UserProfile, content.UserInstructions
+	if data, ok := m.Metadata["user_context_message_data"].(map[string]any); ok {
+		if profile == "" {
+			profile, _ = data["about_user_message"].(string)
+		}
+		if instructions == "" {
+			instructions, _ = data["about_model_message"].(string)
+		}
+	}
+
+	var parts []string
+	if s := strings.TrimSpace(profile); s != "" {
+		parts = append(parts, s)
+	}
+	if s := strings.TrimSpace(instructions); s != "" {
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func linearizeMessages(mapping map[string]rawMapNode, currentNode string, opts SplitOptions) ([]SimplifiedMessage, error) {
 	if len(mapping) == 0 {
 		return nil, nil
 	}
@@ -349,7 +865,7 @@ func linearizeMessages(mapping map[string]rawMapNode, currentNode string) ([]Sim
 		visited[start] = struct{}{}
 
 		if n.Message != nil {
-			sm, ok := simplifyMessage(*n.Message)
+			sm, ok := simplifyMessage(*n.Message, opts)
 			if ok {
 				reversed = append(reversed, sm)
 			}
@@ -391,8 +907,11 @@ func pickBestLeaf(mapping map[string]rawMapNode) string {
 	return bestID
 }
 
-func simplifyMessage(m rawMessage) (SimplifiedMessage, bool) {
+func simplifyMessage(m rawMessage, opts SplitOptions) (SimplifiedMessage, bool) {
 	role := strings.TrimSpace(m.Author.Role)
+	if mapped, ok := lookupRole(opts.RoleMap, role); ok {
+		role = mapped
+	}
 	if role == "" {
 		role = "unknown"
 	}
@@ -400,9 +919,19 @@ func simplifyMessage(m rawMessage) (SimplifiedMessage, bool) {
 	if m.Author.Name != nil {
 		name = strings.TrimSpace(*m.Author.Name)
 	}
+	speaker := ""
+	if role != "tool" {
+		speaker = name
+	}
 
 	ct, text, extra := extractContentSummary(m.Content)
 
+	// Custom instructions are kept on the conversation (see customInstructionsFromMapping), not as a
+	// turn; saved memories go to the memories thread (see SplitOptions.Memories).
+	if ct == "user_editable_context" || ct == "model_editable_context" {
+		return SimplifiedMessage{}, false
+	}
+
 	// Drop empty, hidden system nodes (very common in exports).
 	if role == "system" && strings.TrimSpace(text) == "" && isHiddenFromConversation(m.Metadata) {
 		return SimplifiedMessage{}, false
@@ -411,6 +940,7 @@ func simplifyMessage(m rawMessage) (SimplifiedMessage, bool) {
 	sm := SimplifiedMessage{
 		Role:        role,
 		Name:        name,
+		Speaker:     speaker,
 		CreateTime:  m.CreateTime,
 		ContentType: ct,
 		Text:        text,
@@ -418,6 +948,9 @@ func simplifyMessage(m rawMessage) (SimplifiedMessage, bool) {
 		Title:       extra.Title,
 		URL:         extra.URL,
 	}
+	if opts.PreserveToolCalls {
+		sm.ToolCall = toolCallFromMessage(m, role, name, text, opts.ToolArgsMaxChars)
+	}
 
 	// Drop "imagey" tool messages that carry no useful text/URL metadata.
 	// In OpenAI exports these often show up as role=tool with content_type like "image" (or similar),
@@ -437,6 +970,47 @@ func simplifyMessage(m rawMessage) (SimplifiedMessage, bool) {
 	return sm, true
 }
 
+// toolCallFromMessage returns the structured tool call for assistant messages addressed to a tool
+// (recipient other than "all") and for role=tool results; nil otherwise.
+func toolCallFromMessage(m rawMessage, role, name, text string, maxArgs int) *ToolCall {
+	if maxArgs <= 0 {
+		maxArgs = DefaultToolArgsMaxChars
+	}
+	recipient := strings.TrimSpace(m.Recipient)
+	switch {
+	case role == "tool":
+		status := strings.TrimSpace(m.Status)
+		if agg, ok := m.Metadata["aggregate_result"].(map[string]any); ok {
+			if s, ok := agg["status"].(string); ok && strings.TrimSpace(s) != "" {
+				status = strings.TrimSpace(s)
+			}
+		}
+		if name == "" {
+			name = "tool"
+		}
+		return &ToolCall{Name: name, Status: status}
+	case recipient != "" && recipient != "all":
+		return &ToolCall{
+			Name:      recipient,
+			Arguments: truncateToolArguments(text, maxArgs),
+			Status:    strings.TrimSpace(m.Status),
+		}
+	}
+	return nil
+}
+
+func truncateToolArguments(s string, max int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= max {
+		return s
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "…"
+}
+
 type contentExtra struct {
 	Domain string
 	Title  string
@@ -507,73 +1081,29 @@ func isImageLikeContentType(ct string) bool {
 	return strings.Contains(ct, "image")
 }
 
+// sanitizeFilenameComponent maps an ID to a portable file name; see layout.Component.
 func sanitizeFilenameComponent(s string) string {
-	s = strings.TrimSpace(s)
-	if s == "" {
-		return ""
-	}
-
-	var b strings.Builder
-	b.Grow(len(s))
-	for _, r := range s {
-		switch {
-		case unicode.IsLetter(r) || unicode.IsDigit(r):
-			b.WriteRune(r)
-		case r == '-' || r == '_' || r == '.':
-			b.WriteRune(r)
-		default:
-			b.WriteByte('_')
-		}
-	}
-
-	out := b.String()
-	out = strings.Trim(out, "._-")
-	out = strings.TrimPrefix(out, "..")
-	out = strings.TrimPrefix(out, ".")
-	out = strings.TrimSpace(out)
-	return out
+	return layout.Component(s)
 }
 
-func writeFileAtomic(tmpDir, finalPath string, data []byte, mode fs.FileMode) (int64, error) {
-	if err := os.MkdirAll(filepath.Dir(finalPath), 0o755); err != nil {
+func writeFileAtomic(finalPath string, data []byte, mode fs.FileMode) (int64, error) {
+	if err := fileutils.Reserve(finalPath, int64(len(data))+1); err != nil {
 		return 0, err
 	}
-
-	tmp, err := os.CreateTemp(tmpDir, "archive_split_*.json")
+	tmp, err := fileutils.CreateAtomic(layout.LongPath(finalPath), "archive_split_*.json", mode)
 	if err != nil {
 		return 0, err
 	}
-	tmpName := tmp.Name()
-	defer func() {
-		_ = os.Remove(tmpName)
-	}()
-
-	if err := tmp.Chmod(mode); err != nil {
-		_ = tmp.Close()
-		return 0, err
-	}
+	defer tmp.Abort()
 
 	n, err := tmp.Write(data)
 	if err != nil {
-		_ = tmp.Close()
 		return int64(n), err
 	}
 	if _, err := tmp.Write([]byte("\n")); err != nil {
-		_ = tmp.Close()
-		return int64(n), err
-	}
-	if err := tmp.Sync(); err != nil {
-		_ = tmp.Close()
-		return int64(n), err
-	}
-	if err := tmp.Close(); err != nil {
-		return int64(n), err
-	}
-
-	if err := os.Rename(tmpName, finalPath); err != nil {
 		return int64(n), err
 	}
-	return int64(n), nil
+	return int64(n), tmp.Commit()
 }
 
 func skipValue(dec *json.Decoder, first json.Token) error {
@@ -3,8 +3,11 @@ package migration
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -65,7 +68,7 @@ func TestSplitConversationArchive_ObjectWrappedArray(t *testing.T) {
 func TestSplitConversationArchive_DuplicateIDs(t *testing.T) {
 	t.Parallel()
 
-	in := `[{"conversation_id":"dup","id":"dup","mapping":{}},{"conversation_id":"dup","id":"dup","mapping":{}}]`
+	in := `[{"conversation_id":"dup","id":"dup","title":"a","mapping":{}},{"conversation_id":"dup","id":"dup","title":"b","mapping":{}},{"conversation_id":"dup","id":"dup","title":"b","mapping":{}}]`
 	inPath := filepath.Join(t.TempDir(), "in.json")
 	if err := os.WriteFile(inPath, []byte(in), 0o644); err != nil {
 		t.Fatalf("write input: %v", err)
@@ -76,12 +79,70 @@ func TestSplitConversationArchive_DuplicateIDs(t *testing.T) {
 	if err != nil {
 		t.Fatalf("SplitConversationArchive: %v", err)
 	}
-	if res.ThreadsWritten != 2 {
-		t.Fatalf("ThreadsWritten=%d, want 2", res.ThreadsWritten)
+	if res.ThreadsWritten != 3 {
+		t.Fatalf("ThreadsWritten=%d, want 3", res.ThreadsWritten)
+	}
+
+	// Every copy sharing the name gets a content hash; the byte-identical pair adds an ordinal.
+	entries, err := os.ReadDir(outDir)
+	if err != nil {
+		t.Fatalf("readdir: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	if len(names) != 3 {
+		t.Fatalf("entries=%v", names)
+	}
+	var hashed string
+	for _, name := range names {
+		if name == "dup" {
+			t.Fatalf("a colliding conversation kept the bare name: %v", names)
+		}
+		if strings.HasSuffix(name, "-2") {
+			hashed = strings.TrimSuffix(name, "-2")
+		}
+		assertConversationIDInFile(t, filepath.Join(outDir, name+".json"), "dup")
 	}
+	if !strings.HasPrefix(hashed, "dup-") || len(hashed) != len("dup-")+8 {
+		t.Fatalf("hashed=%q entries=%v", hashed, names)
+	}
+}
+
+func TestFileNamer_IndependentOfOrder(t *testing.T) {
+	t.Parallel()
 
-	assertConversationIDInFile(t, filepath.Join(outDir, "dup.json"), "dup")
-	assertConversationIDInFile(t, filepath.Join(outDir, "dup-2.json"), "dup")
+	contents := [][]byte{
+		[]byte(`{"conversation_id":"x"}`),
+		[]byte(`{"conversation_id":"x","title":"a"}`),
+		[]byte(`{"conversation_id":"x","title":"b"}`),
+	}
+	nameAll := func(order []int) map[int]string {
+		n := newFileNamer(map[string]int{"x": len(contents)})
+		out := make(map[int]string)
+		for _, i := range order {
+			out[i] = n.name("x", contents[i])
+		}
+		return out
+	}
+	want := nameAll([]int{0, 1, 2})
+	for _, order := range [][]int{{1, 0, 2}, {2, 1, 0}, {1, 2, 0}} {
+		if got := nameAll(order); !reflect.DeepEqual(got, want) {
+			t.Fatalf("order %v: names=%v, want %v", order, got, want)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, name := range want {
+		if name == "x" || seen[name] {
+			t.Fatalf("colliding conversations need distinct hashed names: %v", want)
+		}
+		seen[name] = true
+	}
+
+	if got := newFileNamer(map[string]int{"y": 1}).name("y", contents[0]); got != "y" {
+		t.Fatalf("a unique base name should be kept, got %q", got)
+	}
 }
 
 func TestSplitConversationArchive_DropsHiddenEmptySystemMessage(t *testing.T) {
@@ -111,6 +172,135 @@ func TestSplitConversationArchive_DropsHiddenEmptySystemMessage(t *testing.T) {
 	}
 }
 
+func TestSplitConversationArchive_ProjectAndCustomInstructions(t *testing.T) {
+	t.Parallel()
+
+	in := `[{"conversation_id":"c1","id":"c1","gizmo_id":"g-p-abc123","gizmo_type":"snorlax","project_name":"Garden","current_node":"a","mapping":{"root":{"id":"root","message":null,"parent":null,"children":["ctx"]},"ctx":{"id":"ctx","message":{"author":{"role":"user","name":null},"create_time":1,"content":{"content_type":"user_editable_context","user_profile":"I grow tomatoes.","user_instructions":"Be brief."},"metadata":{"is_visually_hidden_from_conversation":true}},"parent":"root","children":["u"]},"u":{"id":"u","message":{"author":{"role":"user","name":null},"create_time":2,"content":{"content_type":"text","parts":["q"]},"metadata":{}},"parent":"ctx","children":["a"]},"a":{"id":"a","message":{"author":{"role":"assistant","name":null},"create_time":3,"content":{"content_type":"text","parts":["a"]},"metadata":{}},"parent":"u","children":[]}}},{"conversation_id":"c2","id":"c2","gizmo_id":"g-xyz","mapping":{}}]`
+	inPath := filepath.Join(t.TempDir(), "in.json")
+	if err := os.WriteFile(inPath, []byte(in), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	if _, err := SplitConversationArchive(context.Background(), inPath, outDir, SplitOptions{}); err != nil {
+		t.Fatalf("SplitConversationArchive: %v", err)
+	}
+
+	c1 := readSimplifiedConversation(t, filepath.Join(outDir, "c1.json"))
+	if c1.Project == nil || c1.Project.ID != "g-p-abc123" || c1.Project.Kind != "project" || c1.Project.Label() != "Garden" {
+		t.Fatalf("Project=%+v", c1.Project)
+	}
+	if c1.SourceType != SourceTypeChatGPT {
+		t.Fatalf("SourceType=%q", c1.SourceType)
+	}
+	if c1.CustomInstructions != "I grow tomatoes.\n\nBe brief." {
+		t.Fatalf("CustomInstructions=%q", c1.CustomInstructions)
+	}
+	if len(c1.Messages) != 2 || c1.Messages[0].Text != "q" {
+		t.Fatalf("context message should not be a turn: %+v", c1.Messages)
+	}
+
+	c2 := readSimplifiedConversation(t, filepath.Join(outDir, "c2.json"))
+	if c2.Project == nil || c2.Project.Kind != "gpt" || c2.Project.Label() != "g-xyz" {
+		t.Fatalf("c2 Project=%+v", c2.Project)
+	}
+}
+
+func TestSplitConversationArchive_Memories(t *testing.T) {
+	t.Parallel()
+
+	in := `[{"conversation_id":"c1","id":"c1","current_node":"u","mapping":{"ctx":{"id":"ctx","message":{"author":{"role":"user","name":null},"create_time":1,"content":{"content_type":"model_editable_context","model_set_context":"1. [2024-05-01]. Grows tomatoes in a\nsmall garden.\n2. Prefers brief answers."},"metadata":{"is_visually_hidden_from_conversation":true}},"parent":null,"children":["u"]},"u":{"id":"u","message":{"author":{"role":"user","name":null},"create_time":2,"content":{"content_type":"text","parts":["q"]},"metadata":{}},"parent":"ctx","children":[]}}},{"conversation_id":"c2","id":"c2","current_node":"b","mapping":{"ctx":{"id":"ctx","message":{"author":{"role":"user","name":null},"create_time":1,"content":{"content_type":"model_editable_context","model_set_context":"1. [2024-06-01]. Grows tomatoes in a small garden."},"metadata":{}},"parent":null,"children":["b"]},"b":{"id":"b","message":{"author":{"role":"assistant","name":null},"create_time":1717300000,"content":{"content_type":"text","parts":["Has a dog named Biscuit."]},"metadata":{},"recipient":"bio"},"parent":"ctx","children":[]}}}]`
+	inPath := filepath.Join(t.TempDir(), "in.json")
+	if err := os.WriteFile(inPath, []byte(in), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+
+	plainDir := filepath.Join(t.TempDir(), "plain")
+	if _, err := SplitConversationArchive(context.Background(), inPath, plainDir, SplitOptions{}); err != nil {
+		t.Fatalf("SplitConversationArchive(plain): %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(plainDir, MemoriesConversationID+".json")); !os.IsNotExist(err) {
+		t.Fatalf("memories thread written without Memories: %v", err)
+	}
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	res, err := SplitConversationArchive(context.Background(), inPath, outDir, SplitOptions{Memories: true})
+	if err != nil {
+		t.Fatalf("SplitConversationArchive: %v", err)
+	}
+	if res.ThreadsWritten != 3 {
+		t.Fatalf("ThreadsWritten=%d, want 3", res.ThreadsWritten)
+	}
+	mem := readSimplifiedConversation(t, filepath.Join(outDir, MemoriesConversationID+".json"))
+	if mem.ConversationID != MemoriesConversationID || mem.Title != MemoriesThreadTitle {
+		t.Fatalf("memories thread=%+v", mem)
+	}
+	var texts []string
+	for _, m := range mem.Messages {
+		if m.Role != "user" || m.ContentType != MemoryContentType {
+			t.Fatalf("memory message=%+v", m)
+		}
+		texts = append(texts, m.Text)
+	}
+	// The earliest sighting of a repeated memory wins; undated memories come last.
+	want := []string{"Grows tomatoes in a small garden.", "Has a dog named Biscuit.", "Prefers brief answers."}
+	if strings.Join(texts, "|") != strings.Join(want, "|") {
+		t.Fatalf("memories=%q, want %q", texts, want)
+	}
+	if got := *mem.Messages[0].CreateTime; got != 1714521600 {
+		t.Fatalf("first memory CreateTime=%v, want 2024-05-01", got)
+	}
+	if mem.CreateTime == nil || *mem.CreateTime != 1714521600 || mem.UpdateTime == nil || *mem.UpdateTime != 1717300000 {
+		t.Fatalf("thread times=%v..%v", mem.CreateTime, mem.UpdateTime)
+	}
+	if c1 := readSimplifiedConversation(t, filepath.Join(outDir, "c1.json")); len(c1.Messages) != 1 {
+		t.Fatalf("context message should not be a turn: %+v", c1.Messages)
+	}
+}
+
+func TestSplitConversationArchive_PreserveToolCalls(t *testing.T) {
+	t.Parallel()
+
+	in := `[{"conversation_id":"c1","id":"c1","current_node":"r","mapping":{"u":{"id":"u","message":{"author":{"role":"user","name":null},"create_time":1,"content":{"content_type":"text","parts":["plot it"]},"metadata":{}},"parent":null,"children":["c"]},"c":{"id":"c","message":{"author":{"role":"assistant","name":null},"create_time":2,"content":{"content_type":"code","language":"python","text":"import matplotlib\nplt.plot([1,2,3])"},"metadata":{},"recipient":"python","status":"finished_successfully"},"parent":"u","children":["r"]},"r":{"id":"r","message":{"author":{"role":"tool","name":"python"},"create_time":3,"content":{"content_type":"execution_output","text":"<Figure>"},"metadata":{"aggregate_result":{"status":"success"}},"recipient":"all","status":"finished_successfully"},"parent":"c","children":[]}}}]`
+	inPath := filepath.Join(t.TempDir(), "in.json")
+	if err := os.WriteFile(inPath, []byte(in), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+
+	plainDir := filepath.Join(t.TempDir(), "plain")
+	if _, err := SplitConversationArchive(context.Background(), inPath, plainDir, SplitOptions{}); err != nil {
+		t.Fatalf("SplitConversationArchive(plain): %v", err)
+	}
+	for _, m := range readSimplifiedConversation(t, filepath.Join(plainDir, "c1.json")).Messages {
+		if m.ToolCall != nil {
+			t.Fatalf("tool_call set without PreserveToolCalls: %+v", m)
+		}
+	}
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	if _, err := SplitConversationArchive(context.Background(), inPath, outDir, SplitOptions{PreserveToolCalls: true, ToolArgsMaxChars: 16}); err != nil {
+		t.Fatalf("SplitConversationArchive: %v", err)
+	}
+	msgs := readSimplifiedConversation(t, filepath.Join(outDir, "c1.json")).Messages
+	if len(msgs) != 3 {
+		t.Fatalf("len(Messages)=%d, want 3", len(msgs))
+	}
+	if msgs[0].ToolCall != nil {
+		t.Fatalf("user message has tool_call: %+v", msgs[0].ToolCall)
+	}
+	call := msgs[1].ToolCall
+	if call == nil || call.Name != "python" || call.Arguments != "import matplotli…" || call.Status != "finished_successfully" {
+		t.Fatalf("invocation tool_call=%+v", call)
+	}
+	if !strings.Contains(msgs[1].Text, "plt.plot") {
+		t.Fatalf("invocation text should stay untruncated: %q", msgs[1].Text)
+	}
+	res := msgs[2].ToolCall
+	if res == nil || res.Name != "python" || res.Arguments != "" || res.Status != "success" {
+		t.Fatalf("result tool_call=%+v", res)
+	}
+}
+
 func TestSplitConversationArchive_ToolTetherQuoteKept(t *testing.T) {
 	t.Parallel()
 
@@ -177,6 +367,14 @@ func TestSanitizeFilenameComponent(t *testing.T) {
 	if got[0] == '.' {
 		t.Fatalf("expected not to start with '.', got %q", got)
 	}
+
+	// IDs that differ only in case must not share a file on case-insensitive filesystems.
+	names := newFileNamer(map[string]int{threadNameKey("Thread"): 2})
+	a := names.name("Thread", []byte("a"))
+	b := names.name("thread", []byte("b"))
+	if strings.EqualFold(a, b) || strings.EqualFold(a, "thread") {
+		t.Fatalf("a=%q b=%q", a, b)
+	}
 }
 
 func assertConversationIDInFile(t *testing.T, path, want string) {
@@ -201,3 +399,104 @@ func readSimplifiedConversation(t *testing.T, path string) SimplifiedConversatio
 	}
 	return c
 }
+
+func TestSplitConversationArchives_KeepsNewestAcrossExports(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	conv := func(id, title string, updated int) string {
+		return fmt.Sprintf(`{"title":%q,"conversation_id":%q,"id":%q,"update_time":%d,"mapping":{}}`, title, id, id, updated)
+	}
+	older := filepath.Join(dir, "2024.json")
+	newer := filepath.Join(dir, "2025.json")
+	if err := os.WriteFile(older, []byte("["+conv("c1", "c1 old", 1)+","+conv("c2", "c2 only old", 1)+","+conv("c3", "c3 newer here", 9)+"]"), 0o644); err != nil {
+		t.Fatalf("write older: %v", err)
+	}
+	if err := os.WriteFile(newer, []byte(`{"conversations":[`+conv("c1", "c1 new", 5)+","+conv("c3", "c3 stale", 2)+"]}"), 0o644); err != nil {
+		t.Fatalf("write newer: %v", err)
+	}
+
+	outDir := filepath.Join(dir, "out")
+	res, err := SplitConversationArchives(context.Background(), []string{older, newer}, outDir, SplitOptions{})
+	if err != nil {
+		t.Fatalf("SplitConversationArchives: %v", err)
+	}
+	if res.ThreadsWritten != 3 || res.DuplicatesSkipped != 2 {
+		t.Fatalf("res=%+v", res)
+	}
+	for id, want := range map[string]struct{ title, source string }{
+		"c1": {"c1 new", "2025.json"},
+		"c2": {"c2 only old", "2024.json"},
+		"c3": {"c3 newer here", "2024.json"},
+	} {
+		got := readSimplifiedConversation(t, filepath.Join(outDir, id+".json"))
+		if got.Title != want.title || got.Source != want.source {
+			t.Fatalf("%s: title=%q source=%q, want %q from %q", id, got.Title, got.Source, want.title, want.source)
+		}
+	}
+
+	// A single export leaves source unset, so one-export splits keep their old output.
+	single := filepath.Join(dir, "single")
+	if _, err := SplitConversationArchives(context.Background(), []string{newer}, single, SplitOptions{}); err != nil {
+		t.Fatalf("SplitConversationArchives single: %v", err)
+	}
+	if got := readSimplifiedConversation(t, filepath.Join(single, "c1.json")); got.Source != "" {
+		t.Fatalf("single export source=%q, want none", got.Source)
+	}
+}
+
+func TestSplitConversationArchive_MaxConversations(t *testing.T) {
+	t.Parallel()
+
+	in := `[{"title":"A","conversation_id":"c1","id":"c1","mapping":{}},{"title":"B","conversation_id":"c2","id":"c2","mapping":{}},{"title":"C","conversation_id":"c3","id":"c3","mapping":{}}]`
+	inPath := filepath.Join(t.TempDir(), "in.json")
+	if err := os.WriteFile(inPath, []byte(in), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	res, err := SplitConversationArchive(context.Background(), inPath, outDir, SplitOptions{MaxConversations: 2})
+	if err != nil {
+		t.Fatalf("SplitConversationArchive: %v", err)
+	}
+	if res.ThreadsWritten != 2 {
+		t.Fatalf("ThreadsWritten=%d, want 2", res.ThreadsWritten)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "c3.json")); !os.IsNotExist(err) {
+		t.Fatalf("c3.json should not be written: %v", err)
+	}
+}
+
+func TestCollectExports_ExpandsDirectories(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	single := filepath.Join(dir, "single.json")
+	exports := filepath.Join(dir, "exports")
+	if err := os.Mkdir(exports, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for _, p := range []string{single, filepath.Join(exports, "b.json"), filepath.Join(exports, "a.json"), filepath.Join(exports, "notes.txt"), filepath.Join(exports, "run_report.json")} {
+		if err := os.WriteFile(p, []byte("[]"), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	got, err := CollectExports([]string{single, exports})
+	if err != nil {
+		t.Fatalf("CollectExports: %v", err)
+	}
+	want := []string{single, filepath.Join(exports, "a.json"), filepath.Join(exports, "b.json")}
+	if len(got) != len(want) {
+		t.Fatalf("got=%v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got=%v, want %v", got, want)
+		}
+	}
+
+	if _, err := CollectExports([]string{t.TempDir()}); err == nil {
+		t.Fatalf("expected error for a directory without exports")
+	}
+}
@@ -0,0 +1,99 @@
+package migration
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ChunkSummaryProblems reports signs that a chunk summary was truncated or otherwise degenerate.
+// An empty result means the artifact looks healthy.
+func ChunkSummaryProblems(s ChunkSummary) []string {
+	var out []string
+	out = appendTextProblems(out, "summary", s.Summary)
+	if len(nonEmpty(s.KeyPoints)) == 0 {
+		out = append(out, "no key points")
+	}
+	out = appendDuplicateProblems(out, "tags", s.Tags)
+	return out
+}
+
+// ChunkSentimentSummaryProblems reports signs that a chunk sentiment summary is degenerate.
+func ChunkSentimentSummaryProblems(s ChunkSentimentSummary) []string {
+	var out []string
+	out = appendTextProblems(out, "emotional_summary", s.EmotionalSummary)
+	out = appendDuplicateProblems(out, "themes", s.Themes)
+	return out
+}
+
+// ThreadSummaryProblems reports signs that a thread rollup was truncated or otherwise degenerate.
+func ThreadSummaryProblems(s ThreadSummary) []string {
+	var out []string
+	out = appendTextProblems(out, "summary", s.Summary)
+	if len(nonEmpty(s.KeyPoints)) == 0 {
+		out = append(out, "no key points")
+	}
+	out = appendDuplicateProblems(out, "tags", s.Tags)
+	if strings.TrimSpace(s.Title) != "" && IsPlaceholderTitle(s.Title) {
+		out = append(out, "placeholder title")
+	}
+	return out
+}
+
+// ThreadSentimentSummaryProblems reports signs that a thread sentiment rollup is degenerate.
+func ThreadSentimentSummaryProblems(s ThreadSentimentSummary) []string {
+	var out []string
+	out = appendTextProblems(out, "emotional_summary", s.EmotionalSummary)
+	out = appendDuplicateProblems(out, "themes", s.Themes)
+	return out
+}
+
+func appendTextProblems(out []string, field, text string) []string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return append(out, field+" is empty")
+	}
+	if endsMidSentence(text) {
+		out = append(out, field+" ends mid-sentence")
+	}
+	return out
+}
+
+func appendDuplicateProblems(out []string, field string, labels []string) []string {
+	seen := make(map[string]struct{}, len(labels))
+	for _, l := range labels {
+		k := strings.ToLower(strings.TrimSpace(l))
+		if k == "" {
+			continue
+		}
+		if _, ok := seen[k]; ok {
+			return append(out, "duplicated "+field)
+		}
+		seen[k] = struct{}{}
+	}
+	return out
+}
+
+// endsMidSentence reports whether text stops without terminal punctuation, which is the usual
+// symptom of a response cut off by the output token limit. The ideographic and full-width marks
+// count too, so summaries written with -output-language ja or zh are not flagged.
+func endsMidSentence(text string) bool {
+	text = strings.TrimRightFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune("\"'”’)]*_`」』）】》〉", r)
+	})
+	if text == "" {
+		return false
+	}
+	last, _ := utf8.DecodeLastRuneInString(text)
+	return !strings.ContainsRune(".!?…:;。！？．：；", last)
+}
+
+func nonEmpty(in []string) []string {
+	var out []string
+	for _, s := range in {
+		if strings.TrimSpace(s) != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
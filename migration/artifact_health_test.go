@@ -0,0 +1,48 @@
+package migration
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChunkSummaryProblems(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		in   ChunkSummary
+		want string
+	}{
+		{name: "healthy", in: ChunkSummary{Summary: "They fixed the build.", KeyPoints: []string{"k"}, Tags: []string{"go"}}, want: ""},
+		{name: "empty", in: ChunkSummary{KeyPoints: []string{"k"}}, want: "summary is empty"},
+		{name: "truncated", in: ChunkSummary{Summary: "They fixed the build and then", KeyPoints: []string{"k"}}, want: "summary ends mid-sentence"},
+		{name: "quoted_end_ok", in: ChunkSummary{Summary: `They said "done."`, KeyPoints: []string{"k"}}, want: ""},
+		{name: "japanese_ok", in: ChunkSummary{Summary: "ビルドを修正した。", KeyPoints: []string{"k"}}, want: ""},
+		{name: "chinese_question_ok", in: ChunkSummary{Summary: "签证问题解决了吗？", KeyPoints: []string{"k"}}, want: ""},
+		{name: "cjk_quoted_end_ok", in: ChunkSummary{Summary: "彼は「終わった。」", KeyPoints: []string{"k"}}, want: ""},
+		{name: "cjk_truncated", in: ChunkSummary{Summary: "我们讨论了东京的签证", KeyPoints: []string{"k"}}, want: "summary ends mid-sentence"},
+		{name: "no_key_points", in: ChunkSummary{Summary: "Fine.", KeyPoints: []string{" "}}, want: "no key points"},
+		{name: "dup_tags", in: ChunkSummary{Summary: "Fine.", KeyPoints: []string{"k"}, Tags: []string{"Go", "go"}}, want: "duplicated tags"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got := strings.Join(ChunkSummaryProblems(tc.in), "; ")
+			if got != tc.want {
+				t.Fatalf("got=%q want=%q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestThreadSentimentSummaryProblems(t *testing.T) {
+	t.Parallel()
+
+	if got := ThreadSentimentSummaryProblems(ThreadSentimentSummary{EmotionalSummary: "Calm throughout."}); len(got) != 0 {
+		t.Fatalf("got=%v", got)
+	}
+	got := ThreadSentimentSummaryProblems(ThreadSentimentSummary{EmotionalSummary: "It started calm but", Themes: []string{"a", "A"}})
+	if len(got) != 2 {
+		t.Fatalf("got=%v", got)
+	}
+}
@@ -0,0 +1,177 @@
+package migration
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MemoriesConversationID is the conversation ID of the thread that SplitConversationArchives writes
+// saved assistant memories to (see SplitOptions.Memories).
+const MemoriesConversationID = "assistant-memories"
+
+// MemoriesThreadTitle is the title of the memories thread.
+const MemoriesThreadTitle = "Saved assistant memories"
+
+// MemoryContentType marks the messages of the memories thread, one per saved memory.
+const MemoryContentType = "memory"
+
+// memoryTool is the recipient of the assistant messages that save a memory ("to=bio").
+const memoryTool = "bio"
+
+// modelSetContextLine matches an entry of a model_set_context listing: "3. [2024-05-01]. User ...".
+// Entries without a date have no bracket.
+var modelSetContextLine = regexp.MustCompile(`^\s*\d+\.\s+(?:\[(\d{4}-\d{2}-\d{2})\]\.?\s*)?(.*)$`)
+
+// AssistantMemory is one memory the assistant saved about the user.
+type AssistantMemory struct {
+	Text string
+	// SavedAt is when the memory was first seen saved: the date of its model_set_context entry or the
+	// time of the message that saved it (nil when neither is known).
+	SavedAt *float64
+	// Source is the export the memory was first seen in.
+	Source string
+}
+
+// ParseModelSetContext splits the model_set_context text the export injects at the start of a thread
+// into its numbered entries. Lines that do not start an entry continue the previous one.
+func ParseModelSetContext(s string) []AssistantMemory {
+	var out []AssistantMemory
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		m := modelSetContextLine.FindStringSubmatch(line)
+		if m == nil {
+			if len(out) > 0 {
+				out[len(out)-1].Text += " " + line
+			}
+			continue
+		}
+		mem := AssistantMemory{Text: strings.TrimSpace(m[2])}
+		if t, err := time.Parse("2006-01-02", m[1]); err == nil {
+			sec := float64(t.Unix())
+			mem.SavedAt = &sec
+		}
+		out = append(out, mem)
+	}
+	return out
+}
+
+// memoryCollector gathers the saved memories of every conversation in a split, deduplicated by text.
+type memoryCollector struct {
+	byKey map[string]*AssistantMemory
+}
+
+// addConversation records the memories conv shows: the model_set_context snapshot the export injects
+// into the thread and any memory the assistant saved during it. Nodes are visited in ID order so the
+// first sighting of a memory is stable.
+func (c *memoryCollector) addConversation(conv rawConversation, source string) {
+	ids := make([]string, 0, len(conv.Mapping))
+	for id := range conv.Mapping {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		n := conv.Mapping[id]
+		if n.Message == nil {
+			continue
+		}
+		m := *n.Message
+		var content struct {
+			ContentType     string `json:"content_type"`
+			ModelSetContext string `json:"model_set_context"`
+		}
+		if len(m.Content) == 0 || json.Unmarshal(m.Content, &content) != nil {
+			continue
+		}
+		if content.ContentType == "model_editable_context" {
+			for _, mem := range ParseModelSetContext(content.ModelSetContext) {
+				mem.Source = source
+				c.add(mem)
+			}
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(m.Recipient), memoryTool) && m.Author.Role == "assistant" {
+			if _, text, _ := extractContentSummary(m.Content); strings.TrimSpace(text) != "" {
+				c.add(AssistantMemory{Text: text, SavedAt: m.CreateTime, Source: source})
+			}
+		}
+	}
+}
+
+// add keeps the earliest sighting of each memory.
+func (c *memoryCollector) add(mem AssistantMemory) {
+	mem.Text = strings.Join(strings.Fields(mem.Text), " ")
+	key := strings.TrimRight(strings.ToLower(mem.Text), ".! ")
+	if key == "" {
+		return
+	}
+	if c.byKey == nil {
+		c.byKey = map[string]*AssistantMemory{}
+	}
+	prev, ok := c.byKey[key]
+	if !ok {
+		c.byKey[key] = &mem
+		return
+	}
+	if prev.SavedAt == nil || mem.SavedAt != nil && *mem.SavedAt < *prev.SavedAt {
+		prev.SavedAt = mem.SavedAt
+	}
+}
+
+// memories returns the collected memories, oldest first and undated last.
+func (c *memoryCollector) memories() []AssistantMemory {
+	out := make([]AssistantMemory, 0, len(c.byKey))
+	for _, m := range c.byKey {
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].SavedAt, out[j].SavedAt
+		if (a == nil) != (b == nil) {
+			return b == nil
+		}
+		if a != nil && *a != *b {
+			return *a < *b
+		}
+		return out[i].Text < out[j].Text
+	})
+	return out
+}
+
+// MemoriesThread turns saved memories into a thread the rest of the pipeline chunks, summarizes, and
+// packs like a conversation: each memory is a user turn, so the memories feed the glossary and the
+// memory shards. ok is false when there are no memories.
+func MemoriesThread(memories []AssistantMemory) (thread SimplifiedConversation, ok bool) {
+	if len(memories) == 0 {
+		return SimplifiedConversation{}, false
+	}
+	thread = SimplifiedConversation{
+		ConversationID: MemoriesConversationID,
+		Title:          MemoriesThreadTitle,
+		Source:         memories[0].Source,
+		SourceType:     SourceTypeChatGPT,
+		Messages:       make([]SimplifiedMessage, 0, len(memories)),
+	}
+	for _, m := range memories {
+		thread.Messages = append(thread.Messages, SimplifiedMessage{
+			Role:        "user",
+			CreateTime:  m.SavedAt,
+			ContentType: MemoryContentType,
+			Text:        m.Text,
+		})
+		if m.SavedAt == nil {
+			continue
+		}
+		if thread.CreateTime == nil || *m.SavedAt < *thread.CreateTime {
+			thread.CreateTime = m.SavedAt
+		}
+		if thread.UpdateTime == nil || *m.SavedAt > *thread.UpdateTime {
+			thread.UpdateTime = m.SavedAt
+		}
+	}
+	return thread, true
+}
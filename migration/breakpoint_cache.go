@@ -0,0 +1,136 @@
+package migration
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+)
+
+// BreakpointCacheFileName is the breakpoint cache thread-chunker keeps in its output directory.
+const BreakpointCacheFileName = "breakpoint_cache.jsonl"
+
+// BreakpointCacheEntry is one line of the breakpoint cache.
+type BreakpointCacheEntry struct {
+	ConversationID string `json:"conversation_id"`
+	ContentSHA256  string `json:"content_sha256"`
+	TargetTurns    int    `json:"target_turns"`
+	Breakpoints    []int  `json:"breakpoints"`
+}
+
+func (e BreakpointCacheEntry) key() string {
+	return fmt.Sprintf("%s\x00%s\x00%d", e.ConversationID, e.ContentSHA256, e.TargetTurns)
+}
+
+// BreakpointCache remembers breakpoint decisions by conversation, thread content hash, and target turns,
+// so rechunking an unchanged thread never calls the model again. New decisions are appended to the
+// cache file as they are made; when a key repeats, the last line wins.
+type BreakpointCache struct {
+	mu      sync.Mutex
+	entries map[string][]int
+	w       *fileutils.JSONLWriter
+
+	hits, misses int
+}
+
+// OpenBreakpointCache loads the cache at path (a missing file is an empty cache) and opens it for
+// appending. Lines that do not parse, such as one torn by a crash, are ignored.
+func OpenBreakpointCache(path string) (*BreakpointCache, error) {
+	c := &BreakpointCache{entries: map[string][]int{}}
+	b, err := os.ReadFile(layout.LongPath(path))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("read breakpoint cache: %w", err)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for sc.Scan() {
+		var e BreakpointCacheEntry
+		if json.Unmarshal(sc.Bytes(), &e) != nil || e.ConversationID == "" || e.ContentSHA256 == "" {
+			continue
+		}
+		c.entries[e.key()] = e.Breakpoints
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read breakpoint cache: %w", err)
+	}
+	if c.w, err = fileutils.AppendJSONL(path); err != nil {
+		return nil, fmt.Errorf("open breakpoint cache: %w", err)
+	}
+	return c, nil
+}
+
+// Close flushes new entries to the cache file.
+func (c *BreakpointCache) Close() error {
+	return c.w.Close()
+}
+
+// Stats returns how many decisions were served from the cache and how many went to the wrapped decider.
+func (c *BreakpointCache) Stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// Decider wraps d so decisions are looked up in the cache first and recorded after a miss.
+func (c *BreakpointCache) Decider(d BreakpointDecider) BreakpointDecider {
+	return cachedBreakpointDecider{cache: c, next: d}
+}
+
+type cachedBreakpointDecider struct {
+	cache *BreakpointCache
+	next  BreakpointDecider
+}
+
+func (d cachedBreakpointDecider) DecideBreakpoints(ctx context.Context, thread SimplifiedConversation, turns []Turn, targetTurnsPerChunk int) ([]int, error) {
+	sum, err := ThreadContentHash(thread)
+	if err != nil {
+		return nil, err
+	}
+	e := BreakpointCacheEntry{ConversationID: thread.ConversationID, ContentSHA256: sum, TargetTurns: targetTurnsPerChunk}
+
+	c := d.cache
+	c.mu.Lock()
+	bps, ok := c.entries[e.key()]
+	if ok {
+		c.hits++
+	}
+	c.mu.Unlock()
+	if ok {
+		return append([]int(nil), bps...), nil
+	}
+
+	bps, err = d.next.DecideBreakpoints(ctx, thread, turns, targetTurnsPerChunk)
+	if err != nil {
+		return nil, err
+	}
+	e.Breakpoints = append([]int(nil), bps...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.misses++
+	c.entries[e.key()] = e.Breakpoints
+	if err := c.w.Write(e); err != nil {
+		return nil, fmt.Errorf("write breakpoint cache: %w", err)
+	}
+	return bps, nil
+}
+
+// ThreadContentHash is the hex SHA-256 of the thread's canonical JSON encoding, so reformatting a thread
+// file (pretty vs compact) leaves the hash unchanged while any edit to its content changes it.
+func ThreadContentHash(thread SimplifiedConversation) (string, error) {
+	b, err := json.Marshal(thread)
+	if err != nil {
+		return "", fmt.Errorf("hash thread: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,82 @@
+package migration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type countingDecider struct {
+	calls *int
+	bps   []int
+}
+
+func (d countingDecider) DecideBreakpoints(ctx context.Context, thread SimplifiedConversation, turns []Turn, targetTurnsPerChunk int) ([]int, error) {
+	*d.calls++
+	return d.bps, nil
+}
+
+func TestBreakpointCache_ReusesDecisionsAcrossRuns(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "chunks", BreakpointCacheFileName)
+	thread := SimplifiedConversation{
+		ConversationID: "c1",
+		Messages:       []SimplifiedMessage{{Role: "user", Text: "u1"}, {Role: "user", Text: "u2"}},
+	}
+	turns := BuildTurns(thread)
+	calls := 0
+	next := countingDecider{calls: &calls, bps: []int{1}}
+
+	c, err := OpenBreakpointCache(path)
+	if err != nil {
+		t.Fatalf("OpenBreakpointCache: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		bps, err := c.Decider(next).DecideBreakpoints(context.Background(), thread, turns, 20)
+		if err != nil || len(bps) != 1 || bps[0] != 1 {
+			t.Fatalf("bps=%v err=%v", bps, err)
+		}
+	}
+	if hits, misses := c.Stats(); hits != 1 || misses != 1 || calls != 1 {
+		t.Fatalf("hits=%d misses=%d calls=%d", hits, misses, calls)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// A torn trailing line from a crash is ignored.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := f.WriteString(`{"conversation_id":"c1","content_`); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	f.Close()
+
+	c, err = OpenBreakpointCache(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer c.Close()
+	if _, err := c.Decider(next).DecideBreakpoints(context.Background(), thread, turns, 20); err != nil {
+		t.Fatalf("DecideBreakpoints: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("cached decision not reused: calls=%d", calls)
+	}
+
+	// A different target or edited content is a miss.
+	if _, err := c.Decider(next).DecideBreakpoints(context.Background(), thread, turns, 10); err != nil {
+		t.Fatalf("DecideBreakpoints: %v", err)
+	}
+	thread.Messages[1].Text = "edited"
+	if _, err := c.Decider(next).DecideBreakpoints(context.Background(), thread, turns, 20); err != nil {
+		t.Fatalf("DecideBreakpoints: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("calls=%d, want 3", calls)
+	}
+}
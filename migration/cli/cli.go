@@ -0,0 +1,244 @@
+// Package cli gives the pipeline commands grouped -help output with examples, shell completion
+// scripts, and JSON config files, on top of the standard flag package.
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Help describes one command for -help and -completion.
+type Help struct {
+	// Name is the installed binary name (e.g. "thread-rollup").
+	Name string
+	// Summary is one line saying what the command does.
+	Summary string
+	// Groups lists the flags by topic, in display order. Flags in no group are shown last under
+	// "Other flags".
+	Groups []Group
+	// Examples are printed after the flags.
+	Examples []Example
+	// Values lists the accepted values of enum-like flags, for completion.
+	Values map[string][]string
+}
+
+// Group is a titled set of flags.
+type Group struct {
+	Title string
+	Flags []string
+}
+
+// Example is one sample invocation with a short comment.
+type Example struct {
+	Comment string
+	Command string
+}
+
+// Shells lists the shells -completion supports.
+var Shells = []string{"bash", "zsh", "fish"}
+
+// Setup installs h as fs's usage message and adds a -completion flag that prints a completion script
+// for the given shell and exits, the way -help does.
+func Setup(fs *flag.FlagSet, h Help) {
+	fs.Usage = func() { h.WriteUsage(fs.Output(), fs) }
+	fs.Func("completion", "Print a `shell` completion script ("+strings.Join(Shells, ", ")+") and exit", func(shell string) error {
+		if err := h.WriteCompletion(os.Stdout, shell, fs); err != nil {
+			return err
+		}
+		os.Exit(0)
+		return nil
+	})
+}
+
+// WriteUsage prints the summary, the flags by group, and the examples.
+func (h Help) WriteUsage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintf(w, "%s - %s\n\nUsage:\n  %s [flags]\n", h.Name, h.Summary, h.Name)
+	for _, g := range h.groups(fs) {
+		fmt.Fprintf(w, "\n%s:\n", g.Title)
+		for _, name := range g.Flags {
+			if f := fs.Lookup(name); f != nil {
+				writeFlag(w, f)
+			}
+		}
+	}
+	if len(h.Examples) > 0 {
+		fmt.Fprintf(w, "\nExamples:\n")
+		for i, ex := range h.Examples {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			if ex.Comment != "" {
+				fmt.Fprintf(w, "  # %s\n", ex.Comment)
+			}
+			fmt.Fprintf(w, "  %s\n", ex.Command)
+		}
+	}
+}
+
+// groups returns h.Groups restricted to flags fs defines, then "Other flags" for the rest and -completion
+// last.
+func (h Help) groups(fs *flag.FlagSet) []Group {
+	seen := map[string]bool{}
+	var out []Group
+	for _, g := range h.Groups {
+		var names []string
+		for _, name := range g.Flags {
+			if fs.Lookup(name) != nil && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		if len(names) > 0 {
+			out = append(out, Group{Title: g.Title, Flags: names})
+		}
+	}
+	var rest []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if !seen[f.Name] && f.Name != "completion" {
+			rest = append(rest, f.Name)
+		}
+	})
+	if len(rest) > 0 {
+		out = append(out, Group{Title: "Other flags", Flags: rest})
+	}
+	if fs.Lookup("completion") != nil && !seen["completion"] {
+		out = append(out, Group{Title: "Shell completion", Flags: []string{"completion"}})
+	}
+	return out
+}
+
+// writeFlag prints one flag in the layout of flag.PrintDefaults.
+func writeFlag(w io.Writer, f *flag.Flag) {
+	name, usage := flag.UnquoteUsage(f)
+	line := "  -" + f.Name
+	if name != "" {
+		line += " " + name
+	}
+	fmt.Fprintf(w, "%s\n    \t%s", line, strings.ReplaceAll(usage, "\n", "\n    \t"))
+	if def := f.DefValue; def != "" && def != "false" && def != "0" && def != "0s" {
+		if name == "string" {
+			def = strconv.Quote(def)
+		}
+		fmt.Fprintf(w, " (default %s)", def)
+	}
+	fmt.Fprintln(w)
+}
+
+// WriteCompletion prints a completion script for shell covering fs's flags.
+func (h Help) WriteCompletion(w io.Writer, shell string, fs *flag.FlagSet) error {
+	flags := completionFlags(fs, h.Values)
+	switch shell {
+	case "bash":
+		writeBash(w, h.Name, flags)
+	case "zsh":
+		writeZsh(w, h.Name, flags)
+	case "fish":
+		writeFish(w, h.Name, flags)
+	default:
+		return fmt.Errorf("unknown shell %q (want %s)", shell, strings.Join(Shells, ", "))
+	}
+	return nil
+}
+
+type completionFlag struct {
+	name   string
+	usage  string
+	isBool bool
+	values []string
+}
+
+func completionFlags(fs *flag.FlagSet, values map[string][]string) []completionFlag {
+	var out []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		_, usage := flag.UnquoteUsage(f)
+		out = append(out, completionFlag{
+			name:   f.Name,
+			usage:  firstSentence(usage),
+			isBool: ok && b.IsBoolFlag(),
+			values: values[f.Name],
+		})
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+func firstSentence(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if i := strings.Index(s, ". "); i > 0 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, " ("); i > 0 {
+		s = s[:i]
+	}
+	return strings.TrimSuffix(s, ".")
+}
+
+// funcName makes a shell function name from a command name.
+func funcName(name string) string {
+	return "_" + strings.NewReplacer("-", "_", ".", "_").Replace(name)
+}
+
+func writeBash(w io.Writer, name string, flags []completionFlag) {
+	fn := funcName(name)
+	var all []string
+	for _, f := range flags {
+		all = append(all, "-"+f.name)
+	}
+	fmt.Fprintf(w, "# bash completion for %s; load with: source <(%s -completion bash)\n", name, name)
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintf(w, "  local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	fmt.Fprintf(w, "  case \"$prev\" in\n")
+	for _, f := range flags {
+		if len(f.values) > 0 {
+			fmt.Fprintf(w, "    -%s|--%s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", f.name, f.name, strings.Join(f.values, " "))
+		}
+	}
+	fmt.Fprintf(w, "  esac\n")
+	fmt.Fprintf(w, "  if [[ \"$cur\" == -* ]]; then\n")
+	fmt.Fprintf(w, "    COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(all, " "))
+	fmt.Fprintf(w, "    return\n  fi\n")
+	fmt.Fprintf(w, "  COMPREPLY=($(compgen -f -- \"$cur\"))\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "complete -o filenames -F %s %s\n", fn, name)
+}
+
+func writeZsh(w io.Writer, name string, flags []completionFlag) {
+	esc := strings.NewReplacer("[", "(", "]", ")", "'", "", ":", " -")
+	fmt.Fprintf(w, "#compdef %s\n# zsh completion for %s; load with: source <(%s -completion zsh)\n", name, name, name)
+	fmt.Fprintf(w, "%s() {\n  _arguments \\\n", funcName(name))
+	for _, f := range flags {
+		spec := fmt.Sprintf("-%s[%s]", f.name, esc.Replace(f.usage))
+		switch {
+		case f.isBool:
+		case len(f.values) > 0:
+			spec += fmt.Sprintf(":%s:(%s)", f.name, strings.Join(f.values, " "))
+		default:
+			spec += fmt.Sprintf(":%s:_files", f.name)
+		}
+		fmt.Fprintf(w, "    '%s' \\\n", spec)
+	}
+	fmt.Fprintf(w, "    '*:file:_files'\n}\n")
+	fmt.Fprintf(w, "compdef %s %s\n", funcName(name), name)
+}
+
+func writeFish(w io.Writer, name string, flags []completionFlag) {
+	esc := strings.NewReplacer(`\`, `\\`, "'", `\'`)
+	fmt.Fprintf(w, "# fish completion for %s; load with: %s -completion fish | source\n", name, name)
+	for _, f := range flags {
+		line := fmt.Sprintf("complete -c %s -o %s -d '%s'", name, f.name, esc.Replace(f.usage))
+		switch {
+		case f.isBool:
+		case len(f.values) > 0:
+			line += fmt.Sprintf(" -x -a '%s'", strings.Join(f.values, " "))
+		default:
+			line += " -r -F"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
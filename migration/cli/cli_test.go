@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func testFlags() (*flag.FlagSet, Help) {
+	fs := flag.NewFlagSet("demo", flag.ContinueOnError)
+	fs.String("in", "threads", "Input directory")
+	fs.String("mode", "semantic", "Packing mode: semantic or sentiment. Sentiment packs emotional summaries")
+	fs.Bool("overwrite", false, "Overwrite existing files")
+	fs.Int("max-bytes", 100, "Max bytes per shard")
+	fs.String("api-key", "", "OpenAI API key")
+	h := Help{
+		Name:    "demo",
+		Summary: "pack things",
+		Groups: []Group{
+			{Title: "Input and output", Flags: []string{"in", "overwrite", "missing"}},
+			{Title: "Packing", Flags: []string{"mode", "max-bytes", "in"}},
+		},
+		Examples: []Example{{Comment: "pack everything", Command: "demo -in threads"}, {Command: "demo -mode sentiment"}},
+		Values:   map[string][]string{"mode": {"semantic", "sentiment"}},
+	}
+	return fs, h
+}
+
+func TestWriteUsage_GroupsFlagsAndExamples(t *testing.T) {
+	t.Parallel()
+
+	fs, h := testFlags()
+	var buf bytes.Buffer
+	h.WriteUsage(&buf, fs)
+	out := buf.String()
+	for _, want := range []string{
+		"demo - pack things\n\nUsage:\n  demo [flags]\n",
+		"\nInput and output:\n  -in string\n    \tInput directory (default \"threads\")\n  -overwrite\n    \tOverwrite existing files\n",
+		"\nPacking:\n  -mode string\n",
+		"  -max-bytes int\n    \tMax bytes per shard (default 100)\n",
+		"\nOther flags:\n  -api-key string\n    \tOpenAI API key\n",
+		"\nExamples:\n  # pack everything\n  demo -in threads\n\n  demo -mode sentiment\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("usage missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "  -in ") != 1 || strings.Contains(out, "missing") {
+		t.Fatalf("flags should appear once and unknown names be dropped:\n%s", out)
+	}
+}
+
+func TestWriteCompletion_Shells(t *testing.T) {
+	t.Parallel()
+
+	fs, h := testFlags()
+	cases := map[string][]string{
+		"bash": {"_demo() {", `-mode|--mode) COMPREPLY=($(compgen -W "semantic sentiment"`, `"-api-key -in -max-bytes -mode -overwrite"`, "complete -o filenames -F _demo demo"},
+		"zsh":  {"#compdef demo", "'-mode[Packing mode - semantic or sentiment]:mode:(semantic sentiment)'", "'-overwrite[Overwrite existing files]' \\", "'-in[Input directory]:in:_files'"},
+		"fish": {"complete -c demo -o mode -d 'Packing mode: semantic or sentiment' -x -a 'semantic sentiment'", "complete -c demo -o overwrite -d 'Overwrite existing files'\n", "complete -c demo -o in -d 'Input directory' -r -F"},
+	}
+	for shell, wants := range cases {
+		var buf bytes.Buffer
+		if err := h.WriteCompletion(&buf, shell, fs); err != nil {
+			t.Fatalf("%s: %v", shell, err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(buf.String(), want) {
+				t.Fatalf("%s completion missing %q:\n%s", shell, want, buf.String())
+			}
+		}
+	}
+	if err := h.WriteCompletion(&bytes.Buffer{}, "powershell", fs); err == nil {
+		t.Fatalf("expected error for unknown shell")
+	}
+}
+
+func TestSetup_InstallsUsageAndCompletionFlag(t *testing.T) {
+	t.Parallel()
+
+	fs, h := testFlags()
+	var buf bytes.Buffer
+	fs.SetOutput(&buf)
+	Setup(fs, h)
+	if fs.Lookup("completion") == nil {
+		t.Fatalf("missing -completion flag")
+	}
+	if err := fs.Parse([]string{"-help"}); err != flag.ErrHelp {
+		t.Fatalf("err=%v want ErrHelp", err)
+	}
+	if !strings.HasSuffix(buf.String(), "Shell completion:\n  -completion shell\n    \tPrint a shell completion script (bash, zsh, fish) and exit\n\nExamples:\n  # pack everything\n  demo -in threads\n\n  demo -mode sentiment\n") {
+		t.Fatalf("usage=%s", buf.String())
+	}
+}
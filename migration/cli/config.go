@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// LoadConfigFile sets fs's flags from a JSON object keyed by flag name, e.g.
+// {"model": "gpt-5-mini", "max-usd": 5, "pretty": true}. Call it after fs.Parse: flags given on the
+// command line are left alone, so they override the file. An array sets a repeatable flag once per
+// element. Unknown names are an error so a typo doesn't silently fall back to a default.
+func LoadConfigFile(fs *flag.FlagSet, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var values map[string]any
+	if err := dec.Decode(&values); err != nil {
+		return fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("config %s: unknown flag -%s", path, name)
+		}
+		if set[name] {
+			continue
+		}
+		items, ok := values[name].([]any)
+		if !ok {
+			items = []any{values[name]}
+		}
+		for _, v := range items {
+			s, err := configString(v)
+			if err != nil {
+				return fmt.Errorf("config %s: -%s: %w", path, name, err)
+			}
+			if err := fs.Set(name, s); err != nil {
+				return fmt.Errorf("config %s: -%s: %w", path, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func configString(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		if v {
+			return "true", nil
+		}
+		return "false", nil
+	default:
+		return "", fmt.Errorf("value must be a string, number, or bool, got %T", v)
+	}
+}
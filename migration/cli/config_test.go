@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigFile_CommandLineWins(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"model": "gpt-5", "max-usd": 2.5, "pretty": true, "hook": ["a", "b"], "in": "file"}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	fs := flag.NewFlagSet("demo", flag.ContinueOnError)
+	model := fs.String("model", "gpt-5-mini", "")
+	maxUSD := fs.Float64("max-usd", 0, "")
+	pretty := fs.Bool("pretty", false, "")
+	in := fs.String("in", "", "")
+	var hooks []string
+	fs.Func("hook", "", func(v string) error { hooks = append(hooks, v); return nil })
+	if err := fs.Parse([]string{"-in", "cli"}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := LoadConfigFile(fs, path); err != nil {
+		t.Fatalf("LoadConfigFile: %v", err)
+	}
+	if *model != "gpt-5" || *maxUSD != 2.5 || !*pretty || *in != "cli" || strings.Join(hooks, ",") != "a,b" {
+		t.Fatalf("model=%s max-usd=%v pretty=%v in=%s hooks=%v", *model, *maxUSD, *pretty, *in, hooks)
+	}
+}
+
+func TestLoadConfigFile_Errors(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"unknown flag":  `{"modle": "x"}`,
+		"bad value":     `{"max-usd": "lots"}`,
+		"nested object": `{"model": {"name": "x"}}`,
+		"not an object": `["model"]`,
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "_")+".json")
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		fs := flag.NewFlagSet("demo", flag.ContinueOnError)
+		fs.String("model", "", "")
+		fs.Float64("max-usd", 0, "")
+		if err := LoadConfigFile(fs, path); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+	if err := LoadConfigFile(flag.NewFlagSet("demo", flag.ContinueOnError), filepath.Join(dir, "missing.json")); err == nil {
+		t.Fatalf("expected error for missing file")
+	}
+}
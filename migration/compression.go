@@ -0,0 +1,41 @@
+package migration
+
+import "math"
+
+// ChunkSourceTokens estimates the model tokens in a chunk's transcript text, the input its summary
+// compresses.
+func ChunkSourceTokens(c Chunk) int {
+	n := 0
+	for _, m := range c.Messages {
+		n += len(m.Text)
+	}
+	return approxTokens(n)
+}
+
+// SummaryTokens estimates the model tokens in a thread rollup's retrievable text: the summary and its
+// key points.
+func SummaryTokens(ts ThreadSummary) int {
+	n := len(ts.Summary)
+	for _, kp := range ts.KeyPoints {
+		n += len(kp)
+	}
+	return approxTokens(n)
+}
+
+// CompressionRatio is source tokens per summary token, rounded to two decimals, or 0 when either
+// count is unknown.
+func CompressionRatio(sourceTokens, summaryTokens int64) float64 {
+	if sourceTokens <= 0 || summaryTokens <= 0 {
+		return 0
+	}
+	return math.Round(float64(sourceTokens)/float64(summaryTokens)*100) / 100
+}
+
+// OversizedSummary reports whether a summary of summaryTokens is more than maxFraction of its
+// source. Unknown source sizes and maxFraction <= 0 never report.
+func OversizedSummary(sourceTokens, summaryTokens int, maxFraction float64) bool {
+	if maxFraction <= 0 || sourceTokens <= 0 {
+		return false
+	}
+	return float64(summaryTokens) > maxFraction*float64(sourceTokens)
+}
@@ -0,0 +1,50 @@
+package migration
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChunkSourceTokens_CountsMessageText(t *testing.T) {
+	t.Parallel()
+
+	c := Chunk{Messages: []SimplifiedMessage{{Role: "user", Text: strings.Repeat("a", 40)}, {Role: "assistant", Text: strings.Repeat("b", 41)}}}
+	if got := ChunkSourceTokens(c); got != 21 {
+		t.Fatalf("tokens=%d want 21", got)
+	}
+}
+
+func TestBuildThreadIndexRecord_CompressionRatio(t *testing.T) {
+	t.Parallel()
+
+	ts := ThreadSummary{ConversationID: "a", Summary: strings.Repeat("s", 300), KeyPoints: []string{strings.Repeat("k", 100)}, SourceTokens: 2000}
+	rec := BuildThreadIndexRecord(ts, "a.thread.summary.json")
+	if rec.SourceTokens != 2000 || rec.SummaryTokens != 100 || rec.CompressionRatio != 20 {
+		t.Fatalf("source=%d summary=%d ratio=%v", rec.SourceTokens, rec.SummaryTokens, rec.CompressionRatio)
+	}
+
+	ts.SourceTokens = 0
+	if rec := BuildThreadIndexRecord(ts, "a.thread.summary.json"); rec.CompressionRatio != 0 {
+		t.Fatalf("ratio=%v want 0 for unknown source", rec.CompressionRatio)
+	}
+}
+
+func TestOversizedSummary(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		source, summary int
+		max             float64
+		want            bool
+	}{
+		{1000, 400, 0.5, false},
+		{1000, 600, 0.5, true},
+		{1000, 600, 0, false},
+		{0, 600, 0.5, false},
+	}
+	for _, c := range cases {
+		if got := OversizedSummary(c.source, c.summary, c.max); got != c.want {
+			t.Fatalf("OversizedSummary(%d, %d, %v)=%v want %v", c.source, c.summary, c.max, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package migration
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+)
+
+// ContentFlagsFileName is the sensitive-content review file thread-flags writes next to thread_index.json.
+// It is never read by memory-pack, so flags stay out of shards.
+const ContentFlagsFileName = "flags.jsonl"
+
+// Content flag labels. They are deliberately coarse: the file is a review aid, not a classifier.
+const (
+	FlagCrisis   = "crisis"
+	FlagHealth   = "health"
+	FlagConflict = "conflict"
+)
+
+// ContentFlagLabels lists the known labels in display order.
+var ContentFlagLabels = []string{FlagCrisis, FlagHealth, FlagConflict}
+
+// ContentFlag is one label applied to a thread.
+type ContentFlag struct {
+	Label string `json:"label"`
+	// Confidence is the model's confidence in [0, 1].
+	Confidence float64 `json:"confidence"`
+	// Note briefly says what in the thread prompted the label.
+	Note string `json:"note,omitempty"`
+}
+
+// ThreadFlags is one row of flags.jsonl. Threads that were checked and raised nothing get a row with no
+// flags, so later runs know they were reviewed.
+type ThreadFlags struct {
+	ConversationID    string        `json:"conversation_id"`
+	Title             string        `json:"title,omitempty"`
+	Project           string        `json:"project,omitempty"`
+	ThreadStart       *float64      `json:"thread_start_time,omitempty"`
+	Flags             []ContentFlag `json:"flags"`
+	ThreadSummaryPath string        `json:"thread_summary_path"`
+
+	// SourceSHA256 hashes the rollup text the flags were derived from; a changed rollup is flagged again.
+	SourceSHA256 string `json:"source_sha256"`
+	Model        string `json:"model,omitempty"`
+	FlaggedAt    string `json:"flagged_at"`
+}
+
+// IsContentFlagLabel reports whether s is a known label.
+func IsContentFlagLabel(s string) bool {
+	for _, l := range ContentFlagLabels {
+		if s == l {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeContentFlags lowercases labels, drops unknown ones and those under minConfidence, clamps
+// confidence to [0, 1] (two decimals), keeps the most confident flag per label, and orders them by label.
+func NormalizeContentFlags(in []ContentFlag, minConfidence float64) []ContentFlag {
+	best := map[string]ContentFlag{}
+	for _, f := range in {
+		f.Label = strings.ToLower(strings.TrimSpace(f.Label))
+		f.Note = strings.TrimSpace(f.Note)
+		f.Confidence = math.Round(math.Max(0, math.Min(1, f.Confidence))*100) / 100
+		if !IsContentFlagLabel(f.Label) || f.Confidence < minConfidence {
+			continue
+		}
+		if prev, ok := best[f.Label]; !ok || f.Confidence > prev.Confidence {
+			best[f.Label] = f
+		}
+	}
+	out := []ContentFlag{}
+	for _, l := range ContentFlagLabels {
+		if f, ok := best[l]; ok {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// FlagSourceText is the rollup text the flagging pass reads for a thread: the semantic summary and key
+// points, plus the sentiment rollup's emotional summary when one exists.
+func FlagSourceText(ts ThreadSummary, sentiment *ThreadSentimentSummary) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "title=%s\n", ts.Title)
+	fmt.Fprintf(&b, "summary:\n%s\n", strings.TrimSpace(ts.Summary))
+	if len(ts.KeyPoints) > 0 {
+		b.WriteString("key_points:\n")
+		for _, kp := range ts.KeyPoints {
+			fmt.Fprintf(&b, "- %s\n", strings.TrimSpace(kp))
+		}
+	}
+	if sentiment != nil && strings.TrimSpace(sentiment.EmotionalSummary) != "" {
+		fmt.Fprintf(&b, "emotional_summary:\n%s\n", strings.TrimSpace(sentiment.EmotionalSummary))
+	}
+	return b.String()
+}
+
+// FlagSourceHash is the hex SHA-256 of FlagSourceText.
+func FlagSourceHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadThreadFlags reads flags.jsonl into conversation_id -> latest row. A missing file yields none;
+// torn lines are skipped.
+func LoadThreadFlags(path string) (map[string]ThreadFlags, error) {
+	out := map[string]ThreadFlags{}
+	b, err := os.ReadFile(layout.LongPath(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return out, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read flags %s: %w", path, err)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(make([]byte, 0, 1<<20), 64<<20)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var row ThreadFlags
+		if err := json.Unmarshal(line, &row); err != nil || row.ConversationID == "" {
+			continue
+		}
+		out[row.ConversationID] = row
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read flags %s: %w", path, err)
+	}
+	return out, nil
+}
+
+// FlaggedThreads returns the rows that carry at least one flag, most confident first, then by
+// conversation ID.
+func FlaggedThreads(rows map[string]ThreadFlags) []ThreadFlags {
+	var out []ThreadFlags
+	for _, r := range rows {
+		if len(r.Flags) > 0 {
+			out = append(out, r)
+		}
+	}
+	top := func(r ThreadFlags) float64 {
+		m := 0.0
+		for _, f := range r.Flags {
+			m = math.Max(m, f.Confidence)
+		}
+		return m
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if ti, tj := top(out[i]), top(out[j]); ti != tj {
+			return ti > tj
+		}
+		return out[i].ConversationID < out[j].ConversationID
+	})
+	return out
+}
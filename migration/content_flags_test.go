@@ -0,0 +1,79 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeContentFlags(t *testing.T) {
+	t.Parallel()
+
+	got := NormalizeContentFlags([]ContentFlag{
+		{Label: "Conflict", Confidence: 0.7, Note: " argument with landlord "},
+		{Label: "health", Confidence: 0.4},
+		{Label: "conflict", Confidence: 0.9},
+		{Label: "politics", Confidence: 0.99},
+		{Label: "crisis", Confidence: 1.5},
+	}, 0.5)
+	if len(got) != 2 {
+		t.Fatalf("flags=%+v", got)
+	}
+	if got[0].Label != FlagCrisis || got[0].Confidence != 1 {
+		t.Fatalf("first=%+v", got[0])
+	}
+	if got[1].Label != FlagConflict || got[1].Confidence != 0.9 {
+		t.Fatalf("second=%+v", got[1])
+	}
+	if empty := NormalizeContentFlags(nil, 0.5); empty == nil || len(empty) != 0 {
+		t.Fatalf("empty=%#v want non-nil empty slice", empty)
+	}
+}
+
+func TestFlagSourceText_IncludesSentimentWhenPresent(t *testing.T) {
+	t.Parallel()
+
+	ts := ThreadSummary{Title: "Hospital visit", Summary: "They went to the ER.", KeyPoints: []string{"broken wrist"}}
+	plain := FlagSourceText(ts, nil)
+	with := FlagSourceText(ts, &ThreadSentimentSummary{EmotionalSummary: "Scared, then relieved."})
+	if !strings.Contains(plain, "broken wrist") || strings.Contains(plain, "emotional_summary") {
+		t.Fatalf("plain=%q", plain)
+	}
+	if !strings.Contains(with, "Scared, then relieved.") || FlagSourceHash(plain) == FlagSourceHash(with) {
+		t.Fatalf("with=%q", with)
+	}
+}
+
+func TestLoadThreadFlags_LastRowWinsAndFlaggedOrder(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), ContentFlagsFileName)
+	data := `{"conversation_id":"a","flags":[{"label":"health","confidence":0.6}],"source_sha256":"1"}
+{"conversation_id":"b","flags":[],"source_sha256":"2"}
+{"conversation_id":"c","flags":[{"label":"crisis","confidence":0.95}],"source_sha256":"3"}
+{"conversation_id":"b","flags":[{"label":"conflict","confidence":0.8}],"source_sha256":"4"}
+{"conversation_id":"d","fl`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	rows, err := LoadThreadFlags(path)
+	if err != nil {
+		t.Fatalf("LoadThreadFlags: %v", err)
+	}
+	if len(rows) != 3 || rows["b"].SourceSHA256 != "4" {
+		t.Fatalf("rows=%+v", rows)
+	}
+	flagged := FlaggedThreads(rows)
+	var ids []string
+	for _, r := range flagged {
+		ids = append(ids, r.ConversationID)
+	}
+	if strings.Join(ids, ",") != "c,b,a" {
+		t.Fatalf("order=%v", ids)
+	}
+
+	if rows, err := LoadThreadFlags(filepath.Join(t.TempDir(), "missing.jsonl")); err != nil || len(rows) != 0 {
+		t.Fatalf("missing file: rows=%v err=%v", rows, err)
+	}
+}
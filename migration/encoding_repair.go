@@ -0,0 +1,167 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxRepairPasses bounds how many layers of double encoding RepairEncoding peels off ("â€¦" is one
+// layer over "…"; "Ã¢â‚¬Â¦" is two).
+const maxRepairPasses = 3
+
+// maxRepairExamples is how many distinct before/after samples an EncodingRepair keeps.
+const maxRepairExamples = 5
+
+// EncodingRepair describes what RepairEncoding changed in one text.
+type EncodingRepair struct {
+	// InvalidBytes counts bytes that were not valid UTF-8; each was decoded as Windows-1252.
+	InvalidBytes int `json:"invalid_bytes,omitempty"`
+
+	// Mojibake counts double-encoded sequences (UTF-8 read as Windows-1252 and encoded again, e.g. "â€¦")
+	// collapsed back to the character they spelled.
+	Mojibake int `json:"mojibake,omitempty"`
+
+	// Examples holds up to maxRepairExamples distinct "before → after" samples.
+	Examples []string `json:"examples,omitempty"`
+}
+
+// Changed reports whether the repair altered the text.
+func (r EncodingRepair) Changed() bool {
+	return r.InvalidBytes > 0 || r.Mojibake > 0
+}
+
+func (r *EncodingRepair) example(before, after string) {
+	if len(r.Examples) >= maxRepairExamples {
+		return
+	}
+	ex := before + " → " + after
+	for _, e := range r.Examples {
+		if e == ex {
+			return
+		}
+	}
+	r.Examples = append(r.Examples, ex)
+}
+
+// RepairEncoding returns s as valid UTF-8 with mojibake undone. Only sequences whose Windows-1252 bytes
+// form a complete multi-byte UTF-8 character are rewritten, so ordinary accented text is left alone.
+func RepairEncoding(s string) (string, EncodingRepair) {
+	var rep EncodingRepair
+	if !utf8.ValidString(s) {
+		s = decodeInvalidBytes(s, &rep)
+	}
+	for pass := 0; pass < maxRepairPasses; pass++ {
+		fixed, n := undoDoubleEncoding(s, &rep)
+		if n == 0 {
+			break
+		}
+		rep.Mojibake += n
+		s = fixed
+	}
+	return s, rep
+}
+
+// decodeInvalidBytes keeps valid UTF-8 as is and decodes every other byte as Windows-1252.
+func decodeInvalidBytes(s string, rep *EncodingRepair) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			r = cp1252Rune(s[i])
+			rep.InvalidBytes++
+			rep.example(fmt.Sprintf(`\x%02X`, s[i]), string(r))
+		}
+		b.WriteRune(r)
+		i += size
+	}
+	return b.String()
+}
+
+// undoDoubleEncoding makes one pass over s, replacing each run of runes whose Windows-1252 bytes form a
+// single multi-byte UTF-8 character with that character. It returns the number of replacements.
+func undoDoubleEncoding(s string, rep *EncodingRepair) (string, int) {
+	runes := []rune(s)
+	var b strings.Builder
+	b.Grow(len(s))
+	n := 0
+	for i := 0; i < len(runes); i++ {
+		if r, width, ok := doubleEncodedAt(runes, i); ok {
+			rep.example(string(runes[i:i+width]), string(r))
+			b.WriteRune(r)
+			i += width - 1
+			n++
+			continue
+		}
+		b.WriteRune(runes[i])
+	}
+	if n == 0 {
+		return s, 0
+	}
+	return b.String(), n
+}
+
+// doubleEncodedAt reports whether runes[i:] starts with a UTF-8 lead byte followed by the right number
+// of continuation bytes, all spelled as Windows-1252 characters, and returns the decoded character.
+func doubleEncodedAt(runes []rune, i int) (rune, int, bool) {
+	lead, ok := cp1252Byte(runes[i])
+	if !ok || lead < 0xC2 || lead > 0xF4 {
+		return 0, 0, false
+	}
+	width := 2
+	switch {
+	case lead >= 0xF0:
+		width = 4
+	case lead >= 0xE0:
+		width = 3
+	}
+	if i+width > len(runes) {
+		return 0, 0, false
+	}
+	buf := make([]byte, 0, width)
+	buf = append(buf, lead)
+	for _, r := range runes[i+1 : i+width] {
+		c, ok := cp1252Byte(r)
+		if !ok || c < 0x80 || c > 0xBF {
+			return 0, 0, false
+		}
+		buf = append(buf, c)
+	}
+	r, size := utf8.DecodeRune(buf)
+	if r == utf8.RuneError || size != width {
+		return 0, 0, false
+	}
+	return r, width, true
+}
+
+// cp1252High maps Windows-1252 bytes 0x80-0x9F to Unicode. Zero entries are the five undefined bytes,
+// which decoders commonly pass through as the C1 control of the same value.
+var cp1252High = [32]rune{
+	0x20AC, 0, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021, 0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017D, 0,
+	0, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014, 0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0, 0x017E, 0x0178,
+}
+
+func cp1252Rune(c byte) rune {
+	if c >= 0x80 && c <= 0x9F && cp1252High[c-0x80] != 0 {
+		return cp1252High[c-0x80]
+	}
+	return rune(c)
+}
+
+// cp1252Byte is the inverse of cp1252Rune for non-ASCII bytes.
+func cp1252Byte(r rune) (byte, bool) {
+	if r >= 0xA0 && r <= 0xFF {
+		return byte(r), true
+	}
+	if r >= 0x80 && r <= 0x9F {
+		// C1 controls come from the undefined bytes, or from text that was decoded as Latin-1 instead.
+		return byte(r), true
+	}
+	for i, v := range cp1252High {
+		if v != 0 && v == r {
+			return byte(0x80 + i), true
+		}
+	}
+	return 0, false
+}
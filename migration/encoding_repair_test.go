@@ -0,0 +1,49 @@
+package migration
+
+import "testing"
+
+func TestRepairEncoding_UndoesDoubleEncoding(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in, want string
+		mojibake int
+	}{
+		{"waitâ€¦ itâ€™s fine", "wait… it’s fine", 2},
+		{"cafÃ© ðŸ˜€", "café 😀", 2},
+		{"Ã¢â‚¬Â¦", "…", 4},
+		{"waitâ\u0080¦", "wait…", 1},
+	}
+	for _, c := range cases {
+		got, rep := RepairEncoding(c.in)
+		if got != c.want || rep.Mojibake != c.mojibake || rep.InvalidBytes != 0 {
+			t.Fatalf("RepairEncoding(%q)=%q rep=%+v, want %q mojibake=%d", c.in, got, rep, c.want, c.mojibake)
+		}
+		if len(rep.Examples) == 0 {
+			t.Fatalf("no examples for %q", c.in)
+		}
+	}
+}
+
+func TestRepairEncoding_LeavesCleanTextAlone(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range []string{"plain ascii", "café São Paulo — naïve résumé…", "Ã la carte", "{\"a\":\"Â\"}"} {
+		got, rep := RepairEncoding(s)
+		if got != s || rep.Changed() {
+			t.Fatalf("RepairEncoding(%q)=%q rep=%+v, want unchanged", s, got, rep)
+		}
+	}
+}
+
+func TestRepairEncoding_DecodesInvalidBytesAsWindows1252(t *testing.T) {
+	t.Parallel()
+
+	got, rep := RepairEncoding("caf\xe9 \x93hi\x94")
+	if got != "café “hi”" || rep.InvalidBytes != 3 || rep.Mojibake != 0 {
+		t.Fatalf("got=%q rep=%+v", got, rep)
+	}
+	if rep.Examples[0] != `\xE9 → é` {
+		t.Fatalf("examples=%v", rep.Examples)
+	}
+}
@@ -0,0 +1,228 @@
+package migration
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+)
+
+// EventsFileName is the dated-event timeline event-extract writes next to thread_index.json.
+const EventsFileName = "events.jsonl"
+
+// EventCacheFileName keeps event-extract's per-chunk results, including chunks that mentioned no dated
+// events, so unchanged chunks are never sent to the model again.
+const EventCacheFileName = "events_cache.jsonl"
+
+// Event date precisions.
+const (
+	EventPrecisionDay   = "day"
+	EventPrecisionMonth = "month"
+	EventPrecisionYear  = "year"
+)
+
+// ExtractedEvent is one dated event as the model reports it.
+type ExtractedEvent struct {
+	// Date is the calendar date the event happened: YYYY-MM-DD, YYYY-MM, or YYYY.
+	Date string `json:"date"`
+	// DateText is the date as written in the conversation ("May 3rd").
+	DateText    string  `json:"date_text"`
+	Description string  `json:"description"`
+	Message     int     `json:"message"`
+	Confidence  float64 `json:"confidence"`
+}
+
+// DatedEvent is one row of events.jsonl: an event the conversation says happened on a given date, with a
+// reference back to the message that mentions it. Date is when the event happened, not when the
+// conversation took place (MentionedAt).
+type DatedEvent struct {
+	// ID is "<conversation_id>:<chunk_number>:<n>", n being the event's position in the chunk's result.
+	ID          string  `json:"id"`
+	Date        string  `json:"date"`
+	Precision   string  `json:"precision"`
+	DateText    string  `json:"date_text,omitempty"`
+	Description string  `json:"description"`
+	Confidence  float64 `json:"confidence"`
+
+	ConversationID string `json:"conversation_id"`
+	Title          string `json:"title,omitempty"`
+	Project        string `json:"project,omitempty"`
+	ChunkNumber    int    `json:"chunk_number"`
+	// Message is the index of the mentioning message within the chunk.
+	Message int `json:"message"`
+	// MentionedAt is the mentioning message's create_time (unix seconds).
+	MentionedAt *float64 `json:"mentioned_at,omitempty"`
+	ChunkPath   string   `json:"chunk_path"`
+}
+
+// EventExtraction is one row of the event cache: the events found in one chunk.
+type EventExtraction struct {
+	ChunkPath string       `json:"chunk_path"`
+	Events    []DatedEvent `json:"events"`
+
+	// SourceSHA256 hashes EventSourceText; a changed chunk is extracted again.
+	SourceSHA256 string `json:"source_sha256"`
+	Model        string `json:"model,omitempty"`
+	ExtractedAt  string `json:"extracted_at"`
+}
+
+// NormalizeEventDate checks that s is a YYYY-MM-DD, YYYY-MM, or YYYY calendar date and returns it with its
+// precision.
+func NormalizeEventDate(s string) (date, precision string, ok bool) {
+	s = strings.TrimSpace(s)
+	for _, f := range []struct{ layout, precision string }{
+		{"2006-01-02", EventPrecisionDay},
+		{"2006-01", EventPrecisionMonth},
+		{"2006", EventPrecisionYear},
+	} {
+		if len(s) != len(f.layout) {
+			continue
+		}
+		if _, err := time.Parse(f.layout, s); err == nil {
+			return s, f.precision, true
+		}
+	}
+	return "", "", false
+}
+
+// EventSourceText is the transcript the extraction pass reads for a chunk: each message with text,
+// numbered by its index in the chunk and prefixed with the date it was written, so the model can resolve
+// dates that leave out the year.
+func EventSourceText(c Chunk) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "title=%s\n", c.Title)
+	for i, m := range c.Messages {
+		text := strings.TrimSpace(m.Text)
+		if text == "" {
+			continue
+		}
+		written := "unknown date"
+		if m.CreateTime != nil && *m.CreateTime > 0 {
+			written = time.Unix(int64(*m.CreateTime), 0).UTC().Format("2006-01-02")
+		}
+		fmt.Fprintf(&b, "\n[%d] %s (%s):\n%s\n", i, m.Role, written, text)
+	}
+	return b.String()
+}
+
+// EventSourceHash is the hex SHA-256 of EventSourceText.
+func EventSourceHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// BuildDatedEvents turns the model's events for a chunk into timeline rows. Events with an invalid date,
+// no description, a message index outside the chunk, or confidence under minConfidence are dropped, as
+// are repeats of the same date and description.
+func BuildDatedEvents(c Chunk, chunkPath string, in []ExtractedEvent, minConfidence float64) []DatedEvent {
+	out := []DatedEvent{}
+	seen := map[string]bool{}
+	for _, e := range in {
+		date, precision, ok := NormalizeEventDate(e.Date)
+		desc := strings.TrimSpace(e.Description)
+		conf := math.Round(math.Max(0, math.Min(1, e.Confidence))*100) / 100
+		if !ok || desc == "" || e.Message < 0 || e.Message >= len(c.Messages) || conf < minConfidence {
+			continue
+		}
+		key := date + "\x00" + strings.ToLower(desc)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, DatedEvent{
+			ID:             fmt.Sprintf("%s:%d:%d", c.ConversationID, c.ChunkNumber, len(out)),
+			Date:           date,
+			Precision:      precision,
+			DateText:       strings.TrimSpace(e.DateText),
+			Description:    desc,
+			Confidence:     conf,
+			ConversationID: c.ConversationID,
+			Title:          c.Title,
+			Project:        c.Project,
+			ChunkNumber:    c.ChunkNumber,
+			Message:        e.Message,
+			MentionedAt:    c.Messages[e.Message].CreateTime,
+			ChunkPath:      chunkPath,
+		})
+	}
+	return out
+}
+
+// SortEvents orders events chronologically. A month or year sorts before the days within it; ties go by
+// conversation, chunk, and message.
+func SortEvents(events []DatedEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.ConversationID != b.ConversationID {
+			return a.ConversationID < b.ConversationID
+		}
+		if a.ChunkNumber != b.ChunkNumber {
+			return a.ChunkNumber < b.ChunkNumber
+		}
+		return a.Message < b.Message
+	})
+}
+
+// LoadEventCache reads the event cache into chunk_path -> latest row. A missing file yields none; torn
+// lines are skipped.
+func LoadEventCache(path string) (map[string]EventExtraction, error) {
+	out := map[string]EventExtraction{}
+	err := scanJSONLFile(path, func(line []byte) {
+		var row EventExtraction
+		if json.Unmarshal(line, &row) == nil && row.ChunkPath != "" {
+			out[row.ChunkPath] = row
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read event cache %s: %w", path, err)
+	}
+	return out, nil
+}
+
+// ReadEvents reads an events.jsonl timeline. A missing file yields none; torn lines are skipped.
+func ReadEvents(path string) ([]DatedEvent, error) {
+	var out []DatedEvent
+	err := scanJSONLFile(path, func(line []byte) {
+		var row DatedEvent
+		if json.Unmarshal(line, &row) == nil && row.Date != "" {
+			out = append(out, row)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read events %s: %w", path, err)
+	}
+	return out, nil
+}
+
+// scanJSONLFile calls fn with each non-blank line of path; a missing file has no lines.
+func scanJSONLFile(path string, fn func(line []byte)) error {
+	b, err := os.ReadFile(layout.LongPath(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(make([]byte, 0, 1<<20), 64<<20)
+	for sc.Scan() {
+		if line := bytes.TrimSpace(sc.Bytes()); len(line) > 0 {
+			fn(line)
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,115 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeEventDate(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in, date, precision string
+		ok                  bool
+	}{
+		{"2024-05-03", "2024-05-03", EventPrecisionDay, true},
+		{" 2024-05 ", "2024-05", EventPrecisionMonth, true},
+		{"2019", "2019", EventPrecisionYear, true},
+		{"2024-02-30", "", "", false},
+		{"May 3rd", "", "", false},
+		{"2024-5-3", "", "", false},
+	}
+	for _, c := range cases {
+		date, precision, ok := NormalizeEventDate(c.in)
+		if date != c.date || precision != c.precision || ok != c.ok {
+			t.Fatalf("NormalizeEventDate(%q)=%q,%q,%v", c.in, date, precision, ok)
+		}
+	}
+}
+
+func TestBuildDatedEvents_FiltersAndReferencesSource(t *testing.T) {
+	t.Parallel()
+
+	at := 1717000000.0
+	c := Chunk{ConversationID: "c1", Title: "Launch retro", ChunkNumber: 2, Messages: []SimplifiedMessage{
+		{Role: "user", Text: "On May 3rd we launched the beta.", CreateTime: &at},
+		{Role: "assistant", Text: "Congrats!"},
+	}}
+	got := BuildDatedEvents(c, "chunks/c1/2.json", []ExtractedEvent{
+		{Date: "2024-05-03", DateText: "May 3rd", Description: " Launched the beta ", Message: 0, Confidence: 0.9},
+		{Date: "2024-05-03", Description: "launched the beta", Message: 0, Confidence: 0.8},
+		{Date: "someday", Description: "Vacation", Message: 0, Confidence: 0.9},
+		{Date: "2024-06", Description: "Planned follow-up", Message: 5, Confidence: 0.9},
+		{Date: "2024", Description: "Maybe moved", Message: 1, Confidence: 0.2},
+	}, 0.5)
+	if len(got) != 1 {
+		t.Fatalf("events=%+v", got)
+	}
+	e := got[0]
+	if e.ID != "c1:2:0" || e.Description != "Launched the beta" || e.Precision != EventPrecisionDay || e.Title != "Launch retro" {
+		t.Fatalf("event=%+v", e)
+	}
+	if e.MentionedAt == nil || *e.MentionedAt != at || e.ChunkPath != "chunks/c1/2.json" {
+		t.Fatalf("source=%+v", e)
+	}
+	if empty := BuildDatedEvents(c, "x", nil, 0.5); empty == nil || len(empty) != 0 {
+		t.Fatalf("empty=%#v want non-nil empty slice", empty)
+	}
+}
+
+func TestEventSourceText_NumbersMessagesWithDates(t *testing.T) {
+	t.Parallel()
+
+	at := 1717000000.0
+	text := EventSourceText(Chunk{Title: "t", Messages: []SimplifiedMessage{
+		{Role: "system", Text: ""},
+		{Role: "user", Text: "hello", CreateTime: &at},
+		{Role: "assistant", Text: "hi"},
+	}})
+	if !strings.Contains(text, "[1] user (2024-05-29):\nhello") || !strings.Contains(text, "[2] assistant (unknown date):\nhi") || strings.Contains(text, "[0]") {
+		t.Fatalf("text=%q", text)
+	}
+}
+
+func TestSortEvents_Chronological(t *testing.T) {
+	t.Parallel()
+
+	events := []DatedEvent{
+		{Date: "2024-05-03", ConversationID: "b"},
+		{Date: "2024-05", ConversationID: "z"},
+		{Date: "2023", ConversationID: "a"},
+		{Date: "2024-05-03", ConversationID: "a"},
+	}
+	SortEvents(events)
+	var got []string
+	for _, e := range events {
+		got = append(got, e.Date+"/"+e.ConversationID)
+	}
+	if strings.Join(got, ",") != "2023/a,2024-05/z,2024-05-03/a,2024-05-03/b" {
+		t.Fatalf("order=%v", got)
+	}
+}
+
+func TestLoadEventCache_LastRowWins(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), EventCacheFileName)
+	data := `{"chunk_path":"a.json","events":[],"source_sha256":"1"}
+{"chunk_path":"a.json","events":[{"id":"a:0:0","date":"2024"}],"source_sha256":"2"}
+{"chunk_path":"b.js`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	rows, err := LoadEventCache(path)
+	if err != nil {
+		t.Fatalf("LoadEventCache: %v", err)
+	}
+	if len(rows) != 1 || rows["a.json"].SourceSHA256 != "2" || len(rows["a.json"].Events) != 1 {
+		t.Fatalf("rows=%+v", rows)
+	}
+	if rows, err := LoadEventCache(filepath.Join(t.TempDir(), "missing.jsonl")); err != nil || len(rows) != 0 {
+		t.Fatalf("missing file: rows=%v err=%v", rows, err)
+	}
+}
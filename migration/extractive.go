@@ -0,0 +1,264 @@
+package migration
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ExtractiveModel is the model recorded on summaries built by ExtractiveSummarize. A later run with an
+// LLM model and -refresh-model-mismatch treats them as stale and replaces them.
+const ExtractiveModel = "extractive"
+
+// ExtractiveOptions bounds an extractive summary; zero fields take the defaults noted.
+type ExtractiveOptions struct {
+	// LeadSentences is how many opening sentences form the summary (default 3).
+	LeadSentences int
+	// KeyPoints is how many high-scoring sentences become key points (default 5).
+	KeyPoints int
+	// Tags is how many frequent terms become tags (default 6).
+	Tags int
+}
+
+func (o ExtractiveOptions) withDefaults() ExtractiveOptions {
+	if o.LeadSentences <= 0 {
+		o.LeadSentences = 3
+	}
+	if o.KeyPoints <= 0 {
+		o.KeyPoints = 5
+	}
+	if o.Tags <= 0 {
+		o.Tags = 6
+	}
+	return o
+}
+
+// ExtractiveSummary is a rough chunk summary assembled from the chunk's own sentences.
+type ExtractiveSummary struct {
+	Summary   string
+	KeyPoints []string
+	Tags      []string
+}
+
+// maxExtractiveSentenceChars caps a quoted sentence so one pasted blob cannot dominate a summary.
+const maxExtractiveSentenceChars = 300
+
+type extractiveSentence struct {
+	text  string
+	role  string
+	msg   int
+	terms []string
+}
+
+// ExtractiveSummarize summarizes a chunk without a model. The summary is the first sentence of each
+// opening message (up to LeadSentences), labelled by speaker; key points are the sentences with the
+// highest TF-IDF weight, treating each message as a document, in chunk order; tags are the most
+// frequent content terms. The result is deterministic.
+func ExtractiveSummarize(c Chunk, opt ExtractiveOptions) ExtractiveSummary {
+	opt = opt.withDefaults()
+
+	var sentences []extractiveSentence
+	docs := 0
+	df := map[string]int{}
+	tf := map[string]int{}
+	for _, m := range c.Messages {
+		if m.Role != "user" && m.Role != "assistant" {
+			continue
+		}
+		split := splitSentences(m.Text)
+		if len(split) == 0 {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, s := range split {
+			terms := extractiveTerms(s)
+			sentences = append(sentences, extractiveSentence{text: s, role: m.Role, msg: docs, terms: terms})
+			for _, t := range terms {
+				tf[t]++
+				if !seen[t] {
+					seen[t] = true
+					df[t]++
+				}
+			}
+		}
+		docs++
+	}
+	if len(sentences) == 0 {
+		return ExtractiveSummary{KeyPoints: []string{}, Tags: []string{}}
+	}
+
+	// Lead: the first sentence of each of the opening messages.
+	var lead []string
+	used := map[int]bool{}
+	lastMsg := -1
+	for i, s := range sentences {
+		if len(lead) >= opt.LeadSentences {
+			break
+		}
+		if s.msg == lastMsg {
+			continue
+		}
+		lastMsg = s.msg
+		used[i] = true
+		lead = append(lead, speakerLabel(s.role)+": "+s.text)
+	}
+
+	// Key points: sentences ranked by the TF-IDF weight of their distinct terms, normalized by
+	// sqrt(term count) so long sentences do not win on length alone.
+	type scored struct {
+		i     int
+		score float64
+	}
+	var ranked []scored
+	for i, s := range sentences {
+		if used[i] || len(s.terms) < 3 {
+			continue
+		}
+		distinct := map[string]bool{}
+		score := 0.0
+		for _, t := range s.terms {
+			if distinct[t] {
+				continue
+			}
+			distinct[t] = true
+			score += float64(tf[t]) * math.Log(1+float64(docs)/float64(df[t]))
+		}
+		ranked = append(ranked, scored{i: i, score: score / math.Sqrt(float64(len(s.terms)))})
+	}
+	sort.SliceStable(ranked, func(a, b int) bool { return ranked[a].score > ranked[b].score })
+	var picked []int
+	dup := map[string]bool{}
+	for _, r := range ranked {
+		if len(picked) >= opt.KeyPoints {
+			break
+		}
+		key := strings.ToLower(sentences[r.i].text)
+		if dup[key] {
+			continue
+		}
+		dup[key] = true
+		picked = append(picked, r.i)
+	}
+	sort.Ints(picked)
+	keyPoints := make([]string, 0, len(picked))
+	for _, i := range picked {
+		keyPoints = append(keyPoints, sentences[i].text)
+	}
+
+	// Tags: terms used at least twice, most frequent first, then alphabetically.
+	var terms []string
+	for t, n := range tf {
+		if n >= 2 && !isDigits(t) {
+			terms = append(terms, t)
+		}
+	}
+	sort.Slice(terms, func(a, b int) bool {
+		if tf[terms[a]] != tf[terms[b]] {
+			return tf[terms[a]] > tf[terms[b]]
+		}
+		return terms[a] < terms[b]
+	})
+	if len(terms) > opt.Tags {
+		terms = terms[:opt.Tags]
+	}
+	if terms == nil {
+		terms = []string{}
+	}
+
+	return ExtractiveSummary{Summary: strings.Join(lead, " "), KeyPoints: keyPoints, Tags: terms}
+}
+
+func speakerLabel(role string) string {
+	if role == "user" {
+		return "User"
+	}
+	return "Assistant"
+}
+
+// splitSentences breaks text into trimmed sentences at line breaks and at ., ! or ? followed by a
+// space. Code fences are skipped and list or heading markers are stripped.
+func splitSentences(text string) []string {
+	var out []string
+	inFence := false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence || line == "" {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimLeft(line, "#>*-+ \t"))
+		start := 0
+		runes := []rune(line)
+		for i, r := range runes {
+			if (r == '.' || r == '!' || r == '?') && (i+1 == len(runes) || unicode.IsSpace(runes[i+1])) {
+				out = appendSentence(out, string(runes[start:i+1]))
+				start = i + 1
+			}
+		}
+		out = appendSentence(out, string(runes[start:]))
+	}
+	return out
+}
+
+func appendSentence(out []string, s string) []string {
+	s = strings.TrimSpace(s)
+	if len(strings.Fields(s)) < 2 {
+		return out
+	}
+	if r := []rune(s); len(r) > maxExtractiveSentenceChars {
+		s = strings.TrimSpace(string(r[:maxExtractiveSentenceChars])) + "…"
+	}
+	return append(out, s)
+}
+
+// extractiveTerms lowercases s into letter/digit runs of at least three characters, dropping stopwords.
+func extractiveTerms(s string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	out := fields[:0]
+	for _, f := range fields {
+		if len([]rune(f)) < 3 {
+			continue
+		}
+		if _, ok := extractiveStopwords[f]; ok {
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// extractiveStopwords are common words that carry no topic. Words under three letters are dropped
+// before this list is consulted.
+var extractiveStopwords = wordSet(`
+	about above after again against all also and any are aren because been before being below between
+	both but can cannot could did didn does doesn doing don down during each even ever every few for
+	from further get gets getting got had has have having her here hers herself him himself his how
+	into isn its itself just let like make made many may maybe might more most much must myself need
+	not now off once one only other our ours out over own really right same say said see should
+	since some something still such sure than that thats the their theirs them then there these they
+	thing things think this those though through too under until use used using very want was way
+	well were what whatever when where whether which while who whom why will with within without
+	would yes yet you your yours yourself okay thanks thank please`)
+
+func wordSet(words string) map[string]struct{} {
+	out := map[string]struct{}{}
+	for _, w := range strings.Fields(words) {
+		out[w] = struct{}{}
+	}
+	return out
+}
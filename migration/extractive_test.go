@@ -0,0 +1,63 @@
+package migration
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractiveSummarize_LeadKeyPointsTags(t *testing.T) {
+	t.Parallel()
+
+	c := Chunk{Messages: []SimplifiedMessage{
+		{Role: "system", Text: "You are a helpful assistant."},
+		{Role: "user", Text: "How do I rotate the backup keys for the garden sensor server? The old keys expire Friday."},
+		{Role: "assistant", Text: "Rotate the backup keys in three steps.\n- Generate new backup keys on the sensor server.\n- Upload the backup keys to the vault.\n```\nkeytool -rotate\n```\nThen restart the sensor server."},
+		{Role: "user", Text: "Great, the sensor server restarted with the new backup keys!"},
+	}}
+	got := ExtractiveSummarize(c, ExtractiveOptions{KeyPoints: 2, Tags: 3})
+
+	wantSummary := "User: How do I rotate the backup keys for the garden sensor server? " +
+		"Assistant: Rotate the backup keys in three steps. " +
+		"User: Great, the sensor server restarted with the new backup keys!"
+	if got.Summary != wantSummary {
+		t.Fatalf("summary=%q", got.Summary)
+	}
+	if len(got.KeyPoints) != 2 {
+		t.Fatalf("key points=%q", got.KeyPoints)
+	}
+	for _, kp := range got.KeyPoints {
+		if strings.Contains(got.Summary, kp) || strings.Contains(kp, "keytool") {
+			t.Fatalf("key point %q repeats the lead or quotes code", kp)
+		}
+	}
+	if want := []string{"keys", "backup", "sensor"}; !reflect.DeepEqual(got.Tags, want) {
+		t.Fatalf("tags=%q want %q", got.Tags, want)
+	}
+
+	if again := ExtractiveSummarize(c, ExtractiveOptions{KeyPoints: 2, Tags: 3}); !reflect.DeepEqual(again, got) {
+		t.Fatalf("not deterministic: %+v vs %+v", again, got)
+	}
+}
+
+func TestExtractiveSummarize_EmptyChunk(t *testing.T) {
+	t.Parallel()
+
+	got := ExtractiveSummarize(Chunk{Messages: []SimplifiedMessage{{Role: "tool", Text: "ok then"}}}, ExtractiveOptions{})
+	if got.Summary != "" || got.KeyPoints == nil || len(got.KeyPoints) != 0 || got.Tags == nil || len(got.Tags) != 0 {
+		t.Fatalf("got=%+v", got)
+	}
+}
+
+func TestSplitSentences_TruncatesLongSentences(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("word ", 100)
+	got := splitSentences("# Heading here\n" + long)
+	if len(got) != 2 || got[0] != "Heading here" {
+		t.Fatalf("sentences=%q", got)
+	}
+	if !strings.HasSuffix(got[1], "…") || len([]rune(got[1])) > maxExtractiveSentenceChars+1 {
+		t.Fatalf("long sentence not capped: %d runes", len([]rune(got[1])))
+	}
+}
@@ -0,0 +1,65 @@
+package migration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FailureRecord describes one input item a stage could not process.
+type FailureRecord struct {
+	Stage string `json:"stage"`
+	Path  string `json:"path"`
+	Error string `json:"error"`
+	Time  string `json:"time,omitempty"`
+}
+
+// NewFailureRecord builds a FailureRecord stamped with the current UTC time.
+func NewFailureRecord(stage, path string, err error) FailureRecord {
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	return FailureRecord{
+		Stage: stage,
+		Path:  path,
+		Error: msg,
+		Time:  time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// WriteFailureReport writes failure records as JSONL. When records is empty, any existing report at
+// path is removed so the file always reflects the most recent run.
+func WriteFailureReport(path string, records []FailureRecord) error {
+	if path == "" {
+		return errors.New("WriteFailureReport: path is empty")
+	}
+	if len(records) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("WriteFailureReport: remove stale report: %w", err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("WriteFailureReport: mkdir: %w", err)
+	}
+
+	var b strings.Builder
+	for _, r := range records {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("WriteFailureReport: marshal: %w", err)
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	if _, err := writeFileAtomic(path, []byte(strings.TrimSuffix(b.String(), "\n")), 0o644); err != nil {
+		return fmt.Errorf("WriteFailureReport: write: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package migration
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFailureReport_WritesJSONLAndClearsWhenEmpty(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "failures.jsonl")
+	recs := []FailureRecord{
+		NewFailureRecord("chunk-summarizer", "a.json", errors.New("bad json")),
+		NewFailureRecord("chunk-summarizer", "b.json", errors.New("empty")),
+	}
+	if err := WriteFailureReport(path, recs); err != nil {
+		t.Fatalf("WriteFailureReport: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines=%d:\n%s", len(lines), string(b))
+	}
+	var got FailureRecord
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got.Path != "a.json" || got.Error != "bad json" || got.Stage != "chunk-summarizer" || got.Time == "" {
+		t.Fatalf("got=%+v", got)
+	}
+
+	if err := WriteFailureReport(path, nil); err != nil {
+		t.Fatalf("WriteFailureReport(empty): %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected stale report removed, stat err=%v", err)
+	}
+}
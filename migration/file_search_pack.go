@@ -0,0 +1,342 @@
+package migration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FileSearchManifestFileName is the manifest WriteFileSearchPack writes into OutDir.
+const FileSearchManifestFileName = "file_search_manifest.json"
+
+// File-search packing limits. FileSearchMaxFileBytes is the vector store's per-file upload limit;
+// DefaultFileSearchFileBytes keeps files far below it so each one chunks and re-uploads quickly.
+const (
+	FileSearchMaxFileBytes     = 512 << 20
+	DefaultFileSearchFileBytes = 2 << 20
+
+	// fileSearchMaxAttrChar is the longest string value vector store file attributes accept.
+	fileSearchMaxAttrChar = 512
+)
+
+// File-search grouping modes.
+const (
+	FileSearchGroupThread = "thread"
+	FileSearchGroupMonth  = "month"
+)
+
+// FileSearchPackOptions controls WriteFileSearchPack and WriteSentimentFileSearchPack.
+type FileSearchPackOptions struct {
+	OutDir string
+
+	// GroupBy is FileSearchGroupThread (one file per thread) or FileSearchGroupMonth (one file per
+	// calendar month of thread start, split into parts when it exceeds MaxBytes).
+	GroupBy string
+
+	// MaxBytes caps each file (default DefaultFileSearchFileBytes, at most FileSearchMaxFileBytes).
+	MaxBytes  int
+	Overwrite bool
+
+	IncludeKeyPoints bool
+	IncludeTags      bool
+
+	// Templates, when set, render thread sections in place of the built-in layout.
+	Templates *ShardTemplates
+}
+
+// FileSearchManifest lists the files written for vector store upload. Each entry's Attributes are
+// shaped for the vector store file attributes field (at most 16 keys; string, number, or bool values).
+type FileSearchManifest struct {
+	Profile     string                    `json:"profile"`
+	Purpose     string                    `json:"purpose"`
+	Kind        string                    `json:"kind"`
+	GroupBy     string                    `json:"group_by"`
+	GeneratedAt string                    `json:"generated_at"`
+	Files       []FileSearchManifestEntry `json:"files"`
+}
+
+// FileSearchManifestEntry describes one uploadable file.
+type FileSearchManifestEntry struct {
+	File            string         `json:"file"`
+	Bytes           int            `json:"bytes"`
+	ApproxTokens    int            `json:"approx_tokens"`
+	ConversationIDs []string       `json:"conversation_ids"`
+	Attributes      map[string]any `json:"attributes"`
+}
+
+// fileSearchDoc is one thread prepared for file-search packing, independent of summary kind.
+type fileSearchDoc struct {
+	id      string
+	title   string
+	project string
+	start   *float64
+	tags    []string
+	section string
+}
+
+// WriteFileSearchPack writes semantic thread summaries as markdown files sized for vector store
+// ingestion, plus FileSearchManifestFileName. It returns the manifest.
+func WriteFileSearchPack(threadSummaries []ThreadSummary, opts FileSearchPackOptions) (FileSearchManifest, error) {
+	docs := make([]fileSearchDoc, 0, len(threadSummaries))
+	anchors, labels := newAnchorRegistry(nil), opts.Templates.labels()
+	for _, ts := range threadSummaries {
+		if ts.ConversationID == "" {
+			continue
+		}
+		section, err := opts.Templates.renderThread(ts, anchors.assign(ts.ConversationID), labels, opts.IncludeKeyPoints, opts.IncludeTags)
+		if err != nil {
+			return FileSearchManifest{}, fmt.Errorf("WriteFileSearchPack: %w", err)
+		}
+		docs = append(docs, fileSearchDoc{
+			id: ts.ConversationID, title: ts.Title, project: ts.Project, start: ts.ThreadStart,
+			tags: dedupeStrings(ts.Tags), section: section,
+		})
+	}
+	return writeFileSearchPack("semantic", docs, opts)
+}
+
+// WriteSentimentFileSearchPack is WriteFileSearchPack for sentiment thread summaries.
+func WriteSentimentFileSearchPack(threadSummaries []ThreadSentimentSummary, opts FileSearchPackOptions) (FileSearchManifest, error) {
+	docs := make([]fileSearchDoc, 0, len(threadSummaries))
+	anchors, labels := newAnchorRegistry(nil), opts.Templates.labels()
+	for _, ts := range threadSummaries {
+		if ts.ConversationID == "" {
+			continue
+		}
+		section, err := opts.Templates.renderSentimentThread(ts, anchors.assign(ts.ConversationID), labels)
+		if err != nil {
+			return FileSearchManifest{}, fmt.Errorf("WriteFileSearchPack: %w", err)
+		}
+		docs = append(docs, fileSearchDoc{
+			id: ts.ConversationID, title: ts.Title, project: ts.Project, start: ts.ThreadStart,
+			tags: dedupeStrings(ts.Themes), section: section,
+		})
+	}
+	return writeFileSearchPack("sentiment", docs, opts)
+}
+
+func writeFileSearchPack(kind string, docs []fileSearchDoc, opts FileSearchPackOptions) (FileSearchManifest, error) {
+	if opts.OutDir == "" {
+		return FileSearchManifest{}, errors.New("WriteFileSearchPack: OutDir is empty")
+	}
+	if opts.GroupBy == "" {
+		opts.GroupBy = FileSearchGroupThread
+	}
+	if opts.GroupBy != FileSearchGroupThread && opts.GroupBy != FileSearchGroupMonth {
+		return FileSearchManifest{}, fmt.Errorf("WriteFileSearchPack: unknown group %q", opts.GroupBy)
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultFileSearchFileBytes
+	}
+	if opts.MaxBytes > FileSearchMaxFileBytes {
+		return FileSearchManifest{}, fmt.Errorf("WriteFileSearchPack: MaxBytes %d exceeds the %d byte upload limit", opts.MaxBytes, FileSearchMaxFileBytes)
+	}
+	if err := os.MkdirAll(opts.OutDir, 0o755); err != nil {
+		return FileSearchManifest{}, fmt.Errorf("WriteFileSearchPack: mkdir OutDir: %w", err)
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		ti, tj := startOrZero(docs[i].start), startOrZero(docs[j].start)
+		if ti != tj {
+			return ti < tj
+		}
+		return docs[i].id < docs[j].id
+	})
+
+	// Group in stable order; each group becomes one or more files.
+	var groupKeys []string
+	groups := make(map[string][]fileSearchDoc)
+	for _, d := range docs {
+		key := fileSearchGroupKey(opts.GroupBy, d)
+		if _, ok := groups[key]; !ok {
+			groupKeys = append(groupKeys, key)
+		}
+		groups[key] = append(groups[key], d)
+	}
+
+	manifest := FileSearchManifest{
+		Profile:     "file-search",
+		Purpose:     "assistants",
+		Kind:        kind,
+		GroupBy:     opts.GroupBy,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Files:       []FileSearchManifestEntry{},
+	}
+	for _, key := range groupKeys {
+		parts := splitFileSearchGroup(groups[key], opts.MaxBytes)
+		for i, part := range parts {
+			name := key
+			if len(parts) > 1 {
+				name = fmt.Sprintf("%s_part%02d", key, i+1)
+			}
+			name = kind + "_" + name + ".md"
+			entry, body := renderFileSearchFile(kind, opts.GroupBy, name, part)
+			outPath := filepath.Join(opts.OutDir, name)
+			if !opts.Overwrite {
+				if _, err := os.Stat(outPath); err == nil {
+					return FileSearchManifest{}, fmt.Errorf("WriteFileSearchPack: file exists: %s", outPath)
+				}
+			}
+			if _, err := writeFileAtomic(outPath, []byte(body), 0o644); err != nil {
+				return FileSearchManifest{}, fmt.Errorf("WriteFileSearchPack: write: %w", err)
+			}
+			manifest.Files = append(manifest.Files, entry)
+		}
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return FileSearchManifest{}, fmt.Errorf("WriteFileSearchPack: marshal manifest: %w", err)
+	}
+	manifestPath := filepath.Join(opts.OutDir, FileSearchManifestFileName)
+	if _, err := writeFileAtomic(manifestPath, b, 0o644); err != nil {
+		return FileSearchManifest{}, fmt.Errorf("WriteFileSearchPack: write manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+func startOrZero(start *float64) float64 {
+	if start == nil {
+		return 0
+	}
+	return *start
+}
+
+func fileSearchGroupKey(groupBy string, d fileSearchDoc) string {
+	if groupBy == FileSearchGroupMonth {
+		if iso := threadStartISO8601(d.start); iso != "" {
+			return iso[:7]
+		}
+		return "undated"
+	}
+	name := sanitizeFilenameComponent(d.id)
+	if name == "" {
+		name = "thread"
+	}
+	return name
+}
+
+// splitFileSearchGroup packs docs into consecutive parts of at most maxBytes of section text. A single
+// thread larger than maxBytes still gets its own file.
+func splitFileSearchGroup(docs []fileSearchDoc, maxBytes int) [][]fileSearchDoc {
+	var parts [][]fileSearchDoc
+	var cur []fileSearchDoc
+	size := 0
+	for _, d := range docs {
+		if len(cur) > 0 && size+len(d.section) > maxBytes {
+			parts = append(parts, cur)
+			cur, size = nil, 0
+		}
+		cur = append(cur, d)
+		size += len(d.section)
+	}
+	if len(cur) > 0 {
+		parts = append(parts, cur)
+	}
+	return parts
+}
+
+// renderFileSearchFile renders one file with a YAML metadata header and returns its manifest entry.
+func renderFileSearchFile(kind, groupBy, name string, docs []fileSearchDoc) (FileSearchManifestEntry, string) {
+	var body strings.Builder
+	ids := make([]string, 0, len(docs))
+	var minStart, maxStart float64
+	for _, d := range docs {
+		ids = append(ids, d.id)
+		body.WriteString(d.section)
+		if s := startOrZero(d.start); s > 0 {
+			if minStart == 0 || s < minStart {
+				minStart = s
+			}
+			if s > maxStart {
+				maxStart = s
+			}
+		}
+	}
+
+	attrs := map[string]any{
+		"kind":         kind,
+		"group_by":     groupBy,
+		"thread_count": len(docs),
+	}
+	if minStart > 0 {
+		attrs["time_start"] = int64(minStart)
+		attrs["time_end"] = int64(maxStart)
+		attrs["month"] = threadStartISO8601(&minStart)[:7]
+	}
+	if project := sharedProject(docs); project != "" {
+		attrs["project"] = project
+	}
+	if len(docs) == 1 {
+		attrs["conversation_id"] = docs[0].id
+		if t := strings.TrimSpace(docs[0].title); t != "" {
+			attrs["title"] = truncateRunes(t, fileSearchMaxAttrChar)
+		}
+		if len(docs[0].tags) > 0 {
+			attrs["tags"] = truncateRunes(strings.Join(docs[0].tags, ", "), fileSearchMaxAttrChar)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "kind: %s\n", kind)
+	fmt.Fprintf(&b, "group_by: %s\n", groupBy)
+	fmt.Fprintf(&b, "thread_count: %d\n", len(docs))
+	if minStart > 0 {
+		fmt.Fprintf(&b, "time_start: %q\n", threadStartISO8601(&minStart))
+		fmt.Fprintf(&b, "time_end: %q\n", threadStartISO8601(&maxStart))
+	}
+	if p, ok := attrs["project"].(string); ok {
+		fmt.Fprintf(&b, "project: %q\n", p)
+	}
+	if len(docs) == 1 {
+		fmt.Fprintf(&b, "conversation_id: %q\n", docs[0].id)
+		if t, ok := attrs["title"].(string); ok {
+			fmt.Fprintf(&b, "title: %q\n", t)
+		}
+	} else {
+		b.WriteString("conversation_ids:\n")
+		for _, id := range ids {
+			fmt.Fprintf(&b, "  - %q\n", id)
+		}
+	}
+	b.WriteString("---\n\n")
+	b.WriteString(body.String())
+
+	// writeFileAtomic appends the final newline, so it is counted here rather than rendered.
+	out := strings.TrimRight(b.String(), "\n")
+	return FileSearchManifestEntry{
+		File:            name,
+		Bytes:           len(out) + 1,
+		ApproxTokens:    approxTokens(len(out) + 1),
+		ConversationIDs: ids,
+		Attributes:      attrs,
+	}, out
+}
+
+// sharedProject returns the project label when every doc in the file belongs to the same one.
+func sharedProject(docs []fileSearchDoc) string {
+	if len(docs) == 0 {
+		return ""
+	}
+	p := docs[0].project
+	for _, d := range docs[1:] {
+		if d.project != p {
+			return ""
+		}
+	}
+	return p
+}
+
+func truncateRunes(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-1]) + "…"
+}
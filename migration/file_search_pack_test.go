@@ -0,0 +1,89 @@
+package migration
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileSearchPack_PerThread(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	start := 1714564800.0 // 2024-05-01
+	summaries := []ThreadSummary{
+		{ConversationID: "b", Title: "Second", Summary: "B.", Project: "Garden", ThreadStart: &start, Tags: []string{"x", "y"}},
+		{ConversationID: "a", Title: "First", Summary: "A."},
+		{Title: "no id"},
+	}
+	m, err := WriteFileSearchPack(summaries, FileSearchPackOptions{OutDir: dir, GroupBy: FileSearchGroupThread})
+	if err != nil {
+		t.Fatalf("WriteFileSearchPack: %v", err)
+	}
+	if len(m.Files) != 2 || m.Kind != "semantic" || m.Profile != "file-search" {
+		t.Fatalf("manifest=%+v", m)
+	}
+	// Undated threads sort first.
+	if m.Files[0].File != "semantic_a.md" || m.Files[1].File != "semantic_b.md" {
+		t.Fatalf("files=%s,%s", m.Files[0].File, m.Files[1].File)
+	}
+	attrs := m.Files[1].Attributes
+	if attrs["conversation_id"] != "b" || attrs["title"] != "Second" || attrs["project"] != "Garden" || attrs["month"] != "2024-05" || attrs["tags"] != "x, y" {
+		t.Fatalf("attrs=%v", attrs)
+	}
+
+	body, err := os.ReadFile(filepath.Join(dir, "semantic_b.md"))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !strings.HasPrefix(string(body), "---\nkind: semantic\n") || !strings.Contains(string(body), "conversation_id: \"b\"") || len(body) != m.Files[1].Bytes {
+		t.Fatalf("bytes=%d manifest=%d body=%q", len(body), m.Files[1].Bytes, body)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, FileSearchManifestFileName))
+	if err != nil {
+		t.Fatalf("read manifest: %v", err)
+	}
+	var got FileSearchManifest
+	if err := json.Unmarshal(raw, &got); err != nil || len(got.Files) != 2 {
+		t.Fatalf("manifest=%s err=%v", raw, err)
+	}
+
+	if _, err := WriteFileSearchPack(summaries, FileSearchPackOptions{OutDir: dir}); err == nil {
+		t.Fatalf("expected error for existing files without Overwrite")
+	}
+}
+
+func TestWriteSentimentFileSearchPack_ByMonthSplitsParts(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	may1, may2, jun := 1714564800.0, 1714651200.0, 1717243200.0
+	long := strings.Repeat("feeling ", 40)
+	summaries := []ThreadSentimentSummary{
+		{ConversationID: "m1", EmotionalSummary: long, ThreadStart: &may1},
+		{ConversationID: "m2", EmotionalSummary: long, ThreadStart: &may2},
+		{ConversationID: "j1", EmotionalSummary: "Calm.", ThreadStart: &jun},
+	}
+	m, err := WriteSentimentFileSearchPack(summaries, FileSearchPackOptions{OutDir: dir, GroupBy: FileSearchGroupMonth, MaxBytes: 400})
+	if err != nil {
+		t.Fatalf("WriteSentimentFileSearchPack: %v", err)
+	}
+	var names []string
+	for _, f := range m.Files {
+		names = append(names, f.File)
+	}
+	want := "sentiment_2024-05_part01.md,sentiment_2024-05_part02.md,sentiment_2024-06.md"
+	if strings.Join(names, ",") != want {
+		t.Fatalf("files=%v", names)
+	}
+	if ids := m.Files[0].ConversationIDs; len(ids) != 1 || ids[0] != "m1" {
+		t.Fatalf("part01 ids=%v", ids)
+	}
+
+	if _, err := WriteSentimentFileSearchPack(summaries, FileSearchPackOptions{OutDir: t.TempDir(), MaxBytes: FileSearchMaxFileBytes + 1}); err == nil {
+		t.Fatalf("expected error above upload limit")
+	}
+}
@@ -0,0 +1,199 @@
+package fileutils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Atomic write modes for the -atomic-write flag.
+const (
+	// AtomicRename writes a temp file beside the target and renames it over the target: readers see
+	// the old file or the new one, never a partial one.
+	AtomicRename = "rename"
+	// AtomicCopy writes and syncs a temp file beside the target, then copies it over the target in
+	// place. For network shares and mounts that refuse rename-over. Not atomic: a crash during the
+	// copy can leave a partial target, but the complete temp file is only removed after the copy.
+	AtomicCopy = "copy"
+	// AtomicStaged writes the temp file in the system temp directory (TMPDIR), so sync clients
+	// watching the output folder never see it, then moves it into place: a rename when both are on one
+	// filesystem, otherwise a copy as in AtomicCopy.
+	AtomicStaged = "staged"
+)
+
+// AtomicWriteModes lists the -atomic-write values, safest first.
+var AtomicWriteModes = []string{AtomicRename, AtomicStaged, AtomicCopy}
+
+// ErrAtomicReplace is wrapped by the errors writers in this package return when the target
+// filesystem refused to replace a file.
+var ErrAtomicReplace = errors.New("atomic replace failed")
+
+// renameAttempts and renameBackoff retry a refused rename, which on Windows is most often a sync
+// client or virus scanner briefly holding the target open.
+const (
+	renameAttempts = 5
+	renameBackoff  = 50 * time.Millisecond
+)
+
+var atomicWrite = struct {
+	sync.Mutex
+	mode string
+}{mode: AtomicRename}
+
+// ParseAtomicWrite validates an -atomic-write value. Empty means AtomicRename.
+func ParseAtomicWrite(s string) (string, error) {
+	switch s {
+	case "":
+		return AtomicRename, nil
+	case AtomicRename, AtomicCopy, AtomicStaged:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid -atomic-write %q (want rename, staged, or copy)", s)
+}
+
+// SetAtomicWrite sets the process-wide strategy AtomicFile uses to put finished files in place.
+func SetAtomicWrite(mode string) error {
+	mode, err := ParseAtomicWrite(mode)
+	if err != nil {
+		return err
+	}
+	atomicWrite.Lock()
+	atomicWrite.mode = mode
+	atomicWrite.Unlock()
+	return nil
+}
+
+// AtomicWrite returns the current atomic write mode.
+func AtomicWrite() string {
+	atomicWrite.Lock()
+	defer atomicWrite.Unlock()
+	return atomicWrite.mode
+}
+
+// AtomicFile is a temp file that becomes path on Commit, following the -atomic-write mode. Callers
+// write to the embedded file, then Commit, and defer Abort to clean up after errors.
+type AtomicFile struct {
+	*os.File
+	path string
+	mode fs.FileMode
+	// how is the atomic write mode at creation.
+	how  string
+	done bool
+}
+
+// CreateAtomic creates the temp file for path (named by pattern, as for os.CreateTemp) and the
+// target's directory. mode, when nonzero, is applied to the temp file and to a target written in place.
+func CreateAtomic(path, pattern string, mode fs.FileMode) (*AtomicFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	how := AtomicWrite()
+	dir := filepath.Dir(path)
+	if how == AtomicStaged {
+		dir = os.TempDir()
+	}
+	tmp, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	f := &AtomicFile{File: tmp, path: path, mode: mode, how: how}
+	if mode != 0 {
+		if err := tmp.Chmod(mode); err != nil {
+			f.Abort()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Abort closes and removes the temp file. It is a no-op after Commit.
+func (f *AtomicFile) Abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+	_ = f.File.Close()
+	_ = os.Remove(f.Name())
+}
+
+// Commit syncs and closes the temp file and puts it in place at path.
+func (f *AtomicFile) Commit() error {
+	if f.done {
+		return errors.New("AtomicFile: already committed or aborted")
+	}
+	if err := SyncFile(f.File); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.File.Close(); err != nil {
+		f.Abort()
+		return err
+	}
+	f.done = true
+	tmpName := f.Name()
+	defer func() { _ = os.Remove(tmpName) }()
+
+	var err error
+	switch f.how {
+	case AtomicCopy:
+		err = copyOver(tmpName, f.path, f.mode)
+	case AtomicStaged:
+		if err = os.Rename(tmpName, f.path); err != nil {
+			// Usually a different filesystem from TMPDIR.
+			err = copyOver(tmpName, f.path, f.mode)
+		}
+	default:
+		err = renameOver(tmpName, f.path)
+	}
+	if err != nil {
+		return err
+	}
+	return Written(f.path)
+}
+
+// renameOver renames tmp over path, retrying while the target is held open, and explains a final
+// refusal.
+func renameOver(tmp, path string) error {
+	var err error
+	for attempt := 0; attempt < renameAttempts; attempt++ {
+		if err = os.Rename(tmp, path); err == nil {
+			return nil
+		}
+		if !errors.Is(err, fs.ErrPermission) {
+			break
+		}
+		time.Sleep(renameBackoff * time.Duration(attempt+1))
+	}
+	return fmt.Errorf("%w: %s: %v (the filesystem or a sync client may not allow replacing files by rename; try -atomic-write staged or copy)",
+		ErrAtomicReplace, path, err)
+}
+
+// copyOver copies tmp over path in place and syncs it according to the durability mode.
+func copyOver(tmp, path string, mode fs.FileMode) error {
+	if mode == 0 {
+		mode = 0o644
+	}
+	src, err := os.Open(tmp)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrAtomicReplace, path, err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return fmt.Errorf("%w: %s: copy: %v (the target may be partial)", ErrAtomicReplace, path, err)
+	}
+	if err := SyncFile(dst); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,52 @@
+package fileutils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Not parallel: the atomic write mode is process-wide.
+func TestAtomicWrite_Modes(t *testing.T) {
+	if _, err := ParseAtomicWrite("hardlink"); err == nil {
+		t.Fatal("expected error for unknown mode")
+	}
+	if mode, err := ParseAtomicWrite(""); err != nil || mode != AtomicRename {
+		t.Fatalf("empty mode=%q err=%v", mode, err)
+	}
+	defer func() { _ = SetAtomicWrite(AtomicRename) }()
+
+	for _, mode := range AtomicWriteModes {
+		if err := SetAtomicWrite(mode); err != nil {
+			t.Fatalf("SetAtomicWrite(%s): %v", mode, err)
+		}
+		dir := t.TempDir()
+		path := filepath.Join(dir, "a.json")
+		for _, body := range []string{`{"n":1}`, `{"n":22}`} {
+			if err := WriteFileAtomicSameDir(path, []byte(body), 0o644); err != nil {
+				t.Fatalf("%s: write: %v", mode, err)
+			}
+			if b, err := os.ReadFile(path); err != nil || string(b) != body+"\n" {
+				t.Fatalf("%s: read %q err=%v", mode, b, err)
+			}
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("%s: temp files left behind: %v err=%v", mode, entries, err)
+		}
+	}
+
+	// A target the filesystem will not replace names the strategies to try instead.
+	if err := SetAtomicWrite(AtomicRename); err != nil {
+		t.Fatal(err)
+	}
+	blocked := filepath.Join(t.TempDir(), "blocked")
+	if err := os.MkdirAll(filepath.Join(blocked, "child"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	err := WriteFileAtomicSameDir(blocked, []byte("{}"), 0o644)
+	if !errors.Is(err, ErrAtomicReplace) {
+		t.Fatalf("err=%v, want ErrAtomicReplace", err)
+	}
+}
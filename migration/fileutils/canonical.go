@@ -0,0 +1,109 @@
+package fileutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var canonicalJSON = struct {
+	sync.Mutex
+	on bool
+}{}
+
+// SetCanonicalJSON sets whether MarshalJSON, and so WriteArtifactAtomic, WriteJSONFileAtomic and
+// JSONLWriter, write canonical JSON (see Canonicalize) for the rest of the process.
+func SetCanonicalJSON(on bool) {
+	canonicalJSON.Lock()
+	canonicalJSON.on = on
+	canonicalJSON.Unlock()
+}
+
+// CanonicalJSON reports whether canonical JSON output is on.
+func CanonicalJSON() bool {
+	canonicalJSON.Lock()
+	defer canonicalJSON.Unlock()
+	return canonicalJSON.on
+}
+
+// Canonicalize re-encodes the JSON value b so equal content always has the same bytes: object keys
+// are sorted at every level and non-integer numbers are written in their shortest decimal form
+// without an exponent. pretty indents with two spaces like MarshalIndent; otherwise the result is
+// compact.
+func Canonicalize(b []byte, pretty bool) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	v, err := canonicalNumbers(v)
+	if err != nil {
+		return nil, err
+	}
+	// Maps marshal with sorted keys.
+	if pretty {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
+
+// MarshalJSON marshals v for writing to a file: indented with two spaces when pretty, and canonical
+// when CanonicalJSON is on. Writers that stamp or name files from the bytes themselves use it so
+// -canonical-json reaches their output too.
+func MarshalJSON(v any, pretty bool) ([]byte, error) {
+	var b []byte
+	var err error
+	if pretty {
+		b, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		b, err = json.Marshal(v)
+	}
+	if err != nil || !CanonicalJSON() {
+		return b, err
+	}
+	return Canonicalize(b, pretty)
+}
+
+// canonicalNumbers rewrites the json.Numbers in v: integers are kept, other numbers are formatted
+// with strconv's shortest 'f' form, and negative zero becomes 0.
+func canonicalNumbers(v any) (any, error) {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, e := range t {
+			c, err := canonicalNumbers(e)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = c
+		}
+	case []any:
+		for i, e := range t {
+			c, err := canonicalNumbers(e)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = c
+		}
+	case json.Number:
+		s := t.String()
+		if !strings.ContainsAny(s, ".eE") {
+			if s == "-0" {
+				return json.Number("0"), nil
+			}
+			return t, nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("canonical number %s: %w", s, err)
+		}
+		if f == 0 {
+			f = 0 // drops the sign of -0
+		}
+		return json.Number(strconv.FormatFloat(f, 'f', -1, 64)), nil
+	}
+	return v, nil
+}
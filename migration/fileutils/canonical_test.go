@@ -0,0 +1,50 @@
+package fileutils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalize_SortsKeysAndFormatsNumbers(t *testing.T) {
+	t.Parallel()
+
+	got, err := Canonicalize([]byte(`{"b":{"z":1,"a":[{"y":2.50,"x":-0.0}]},"a":1.7172e9,"c":-0,"d":12345678901234567890,"e":1e-7}`), false)
+	if err != nil {
+		t.Fatalf("Canonicalize: %v", err)
+	}
+	want := `{"a":1717200000,"b":{"a":[{"x":0,"y":2.5}],"z":1},"c":0,"d":12345678901234567890,"e":0.0000001}`
+	if string(got) != want {
+		t.Fatalf("Canonicalize=%s, want %s", got, want)
+	}
+	if _, err := Canonicalize([]byte(`{"a":`), false); err == nil {
+		t.Fatal("expected an error for truncated JSON")
+	}
+}
+
+func TestWriteArtifactAtomic_CanonicalJSON(t *testing.T) {
+	SetCanonicalJSON(true)
+	defer SetCanonicalJSON(false)
+
+	type rec struct {
+		Zeta  string  `json:"zeta"`
+		Alpha float64 `json:"alpha"`
+	}
+	path := filepath.Join(t.TempDir(), "a.json")
+	if err := WriteArtifactAtomic(path, rec{Zeta: "z", Alpha: 0.5}, true); err != nil {
+		t.Fatalf("WriteArtifactAtomic: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The checksum stays first; the rest is sorted.
+	if !strings.HasPrefix(string(b), "{\n  \"sha256\": \"") || !strings.HasSuffix(string(b), "\"alpha\": 0.5,\n  \"zeta\": \"z\"\n}\n") {
+		t.Fatalf("artifact:\n%s", b)
+	}
+	var got rec
+	if err := ReadArtifact(path, &got); err != nil || got.Zeta != "z" {
+		t.Fatalf("ReadArtifact=%+v err=%v", got, err)
+	}
+}
@@ -0,0 +1,131 @@
+package fileutils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// ChecksumField is the top-level key WriteArtifactAtomic stamps into artifacts.
+const ChecksumField = "sha256"
+
+// ErrCorruptArtifact marks an artifact that is truncated, unparseable or fails its checksum.
+var ErrCorruptArtifact = errors.New("corrupt artifact")
+
+// ContentChecksum returns the hex sha256 of a JSON object's canonical form: the object without
+// ChecksumField, re-encoded compactly with sorted keys, so indentation does not change the sum.
+func ContentChecksum(b []byte) (string, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return "", err
+	}
+	delete(m, ChecksumField)
+	canon, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canon)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// StampChecksum inserts ChecksumField as the first key of the JSON object b, keeping its layout.
+func StampChecksum(b []byte, pretty bool) ([]byte, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	if _, ok := m[ChecksumField]; ok {
+		return nil, fmt.Errorf("object already has a %q field", ChecksumField)
+	}
+	if len(m) == 0 {
+		return b, nil
+	}
+	sum, err := ContentChecksum(b)
+	if err != nil {
+		return nil, err
+	}
+	i := bytes.IndexByte(b, '{')
+	field := fmt.Sprintf("%q:%q,", ChecksumField, sum)
+	if pretty {
+		field = fmt.Sprintf("\n  %q: %q,", ChecksumField, sum)
+	}
+	out := make([]byte, 0, len(b)+len(field))
+	out = append(out, b[:i+1]...)
+	out = append(out, field...)
+	return append(out, b[i+1:]...), nil
+}
+
+// WriteArtifactAtomic is WriteJSONFileAtomic for pipeline artifacts: the written object carries a
+// ChecksumField that ReadArtifact verifies. v must encode as a JSON object. In canonical mode the
+// checksum still comes first, ahead of the sorted keys.
+func WriteArtifactAtomic(path string, v any, pretty bool) error {
+	b, err := MarshalJSON(v, pretty)
+	if err != nil {
+		return fmt.Errorf("marshal json: %w", err)
+	}
+	if b, err = StampChecksum(b, pretty); err != nil {
+		return fmt.Errorf("checksum json: %w", err)
+	}
+	if err := WriteFileAtomicSameDir(path, b, 0o644); err != nil {
+		return fmt.Errorf("write json: %w", err)
+	}
+	return nil
+}
+
+// VerifyArtifact checks that b is a complete JSON object whose ChecksumField, if present, matches
+// its content. Artifacts written before checksums existed carry no field and are accepted.
+// Failures wrap ErrCorruptArtifact and name path.
+func VerifyArtifact(path string, b []byte) error {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return fmt.Errorf("%w %s: file is empty (partially synced?)", ErrCorruptArtifact, path)
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		var syn *json.SyntaxError
+		if errors.As(err, &syn) {
+			return fmt.Errorf("%w %s: invalid or truncated JSON (partially synced?): %v", ErrCorruptArtifact, path, err)
+		}
+		return fmt.Errorf("%w %s: not a JSON object: %v", ErrCorruptArtifact, path, err)
+	}
+	raw, ok := m[ChecksumField]
+	if !ok {
+		return nil
+	}
+	var want string
+	if err := json.Unmarshal(raw, &want); err != nil {
+		return fmt.Errorf("%w %s: malformed %s field", ErrCorruptArtifact, path, ChecksumField)
+	}
+	got, err := ContentChecksum(b)
+	if err != nil {
+		return fmt.Errorf("%w %s: %v", ErrCorruptArtifact, path, err)
+	}
+	if got != want {
+		return fmt.Errorf("%w %s: checksum mismatch (have %s, want %s); the file was damaged or edited by hand — regenerate it, or delete the %q field to accept the edit",
+			ErrCorruptArtifact, path, got, want, ChecksumField)
+	}
+	return nil
+}
+
+// ReadArtifact reads path, verifies it with VerifyArtifact and unmarshals it into v.
+func ReadArtifact(path string, v any) error {
+	return ReadArtifactFS(OS, path, v)
+}
+
+// ReadArtifactFS is ReadArtifact for a stored path read from fsys (see FSPath).
+func ReadArtifactFS(fsys fs.FS, path string, v any) error {
+	b, err := fs.ReadFile(fsys, FSPath(fsys, path))
+	if err != nil {
+		return err
+	}
+	if err := VerifyArtifact(path, b); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("unmarshal %s: %w", path, err)
+	}
+	return nil
+}
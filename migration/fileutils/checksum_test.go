@@ -0,0 +1,91 @@
+package fileutils
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type checksumDoc struct {
+	ID    string   `json:"id"`
+	Notes []string `json:"notes"`
+}
+
+func TestWriteArtifactAtomic_RoundTripsAndIgnoresFormatting(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	in := checksumDoc{ID: "c1", Notes: []string{"a <b>", "ü"}}
+	for _, pretty := range []bool{true, false} {
+		path := filepath.Join(dir, "doc.json")
+		if err := WriteArtifactAtomic(path, in, pretty); err != nil {
+			t.Fatalf("WriteArtifactAtomic(pretty=%v): %v", pretty, err)
+		}
+		b, _ := os.ReadFile(path)
+		if !bytes.Contains(b, []byte(`"sha256"`)) {
+			t.Fatalf("pretty=%v: no checksum in %s", pretty, b)
+		}
+		var out checksumDoc
+		if err := ReadArtifact(path, &out); err != nil {
+			t.Fatalf("ReadArtifact(pretty=%v): %v", pretty, err)
+		}
+		if out.ID != "c1" || len(out.Notes) != 2 {
+			t.Fatalf("pretty=%v: out=%+v", pretty, out)
+		}
+	}
+}
+
+func TestReadArtifact_DetectsCorruption(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.json")
+	if err := WriteArtifactAtomic(good, checksumDoc{ID: "c1", Notes: []string{"x"}}, true); err != nil {
+		t.Fatalf("WriteArtifactAtomic: %v", err)
+	}
+	b, _ := os.ReadFile(good)
+
+	cases := map[string][]byte{
+		"flipped":   bytes.Replace(b, []byte(`"x"`), []byte(`"y"`), 1),
+		"truncated": b[:len(b)/2],
+		"empty":     nil,
+	}
+	for name, data := range cases {
+		path := filepath.Join(dir, name+".json")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		var out checksumDoc
+		err := ReadArtifact(path, &out)
+		if !errors.Is(err, ErrCorruptArtifact) {
+			t.Fatalf("%s: err=%v want ErrCorruptArtifact", name, err)
+		}
+		if !strings.Contains(err.Error(), path) {
+			t.Fatalf("%s: error %q does not name the file", name, err)
+		}
+	}
+}
+
+func TestReadArtifact_AcceptsUnstampedFiles(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "old.json")
+	if err := WriteJSONFileAtomic(path, checksumDoc{ID: "c1"}, true); err != nil {
+		t.Fatalf("WriteJSONFileAtomic: %v", err)
+	}
+	var out checksumDoc
+	if err := ReadArtifact(path, &out); err != nil || out.ID != "c1" {
+		t.Fatalf("ReadArtifact: out=%+v err=%v", out, err)
+	}
+}
+
+func TestStampChecksum_RejectsExistingField(t *testing.T) {
+	t.Parallel()
+
+	if _, err := StampChecksum([]byte(`{"sha256":"x","id":"c1"}`), false); err == nil {
+		t.Fatalf("expected error for an object that already has a checksum")
+	}
+}
@@ -0,0 +1,190 @@
+package fileutils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Durability modes for the -durability flag.
+const (
+	// DurabilityNone never fsyncs; the OS flushes in its own time. Fastest, and a crash can lose
+	// recently written artifacts.
+	DurabilityNone = "none"
+	// DurabilityGroup defers fsyncs and syncs written files and their directories together, every
+	// GroupCommitFiles files and whenever Flush is called.
+	DurabilityGroup = "group"
+	// DurabilityFull fsyncs each file before it is renamed into place and its directory after.
+	DurabilityFull = "full"
+)
+
+// DurabilityModes lists the -durability values, fastest first.
+var DurabilityModes = []string{DurabilityNone, DurabilityGroup, DurabilityFull}
+
+// GroupCommitFiles is how many written files DurabilityGroup accumulates before syncing them in one pass.
+const GroupCommitFiles = 512
+
+var durability = struct {
+	sync.Mutex
+	mode    string
+	pending map[string]struct{}
+}{mode: DurabilityFull}
+
+// ParseDurability validates a -durability value. Empty means DurabilityFull.
+func ParseDurability(s string) (string, error) {
+	switch s {
+	case "":
+		return DurabilityFull, nil
+	case DurabilityNone, DurabilityGroup, DurabilityFull:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid -durability %q (want none, group, or full)", s)
+}
+
+// SetDurability sets the process-wide durability mode used by the atomic writers in this package and
+// by callers that use SyncFile and Written. Pending group writes are flushed first.
+func SetDurability(mode string) error {
+	mode, err := ParseDurability(mode)
+	if err != nil {
+		return err
+	}
+	if err := Flush(); err != nil {
+		return err
+	}
+	durability.Lock()
+	durability.mode = mode
+	durability.Unlock()
+	return nil
+}
+
+// Durability returns the current durability mode.
+func Durability() string {
+	durability.Lock()
+	defer durability.Unlock()
+	return durability.mode
+}
+
+// SyncFile syncs an open file before it is closed or renamed into place. Only DurabilityFull syncs here;
+// group mode syncs the final path later via Written.
+func SyncFile(f *os.File) error {
+	if Durability() != DurabilityFull {
+		return nil
+	}
+	return f.Sync()
+}
+
+// Written records that path now holds complete data. DurabilityFull syncs its directory so a rename
+// survives a crash; DurabilityGroup queues it for the next group commit.
+func Written(path string) error {
+	durability.Lock()
+	mode := durability.mode
+	if mode == DurabilityGroup {
+		if durability.pending == nil {
+			durability.pending = map[string]struct{}{}
+		}
+		durability.pending[path] = struct{}{}
+		full := len(durability.pending) >= GroupCommitFiles
+		durability.Unlock()
+		if full {
+			return Flush()
+		}
+		return nil
+	}
+	durability.Unlock()
+
+	if mode == DurabilityFull {
+		return syncDir(filepath.Dir(path))
+	}
+	return nil
+}
+
+// Flush syncs every file queued by DurabilityGroup, then each of their directories once. Stages call it at
+// checkpoints (end of a batch, end of the run); it is a no-op in the other modes.
+func Flush() error {
+	durability.Lock()
+	pending := durability.pending
+	durability.pending = nil
+	durability.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	paths := make([]string, 0, len(pending))
+	for p := range pending {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	dirs := map[string]bool{}
+	var errs []error
+	for _, p := range paths {
+		if err := syncPath(p); err != nil {
+			errs = append(errs, err)
+		}
+		dirs[filepath.Dir(p)] = true
+	}
+	for d := range dirs {
+		if err := syncDir(d); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("flush writes: %w", err)
+	}
+	return nil
+}
+
+// CloseSynced closes a file written in place (an index rebuilt with O_TRUNC, say), syncing it first
+// according to the durability mode.
+func CloseSynced(f *os.File) error {
+	if err := SyncFile(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return Written(f.Name())
+}
+
+// syncPath fsyncs the file at path. fsync needs no write access, so it is opened read-only and
+// read-only artifacts sync too; Windows' FlushFileBuffers does need a writable handle.
+func syncPath(path string) error {
+	flag := os.O_RDONLY
+	if runtime.GOOS == "windows" {
+		flag = os.O_RDWR
+	}
+	f, err := os.OpenFile(path, flag, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		// Replaced or removed since it was written; whatever replaced it was queued too.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// syncDir makes renames and creates in dir durable. Windows cannot open directories for syncing, and
+// NTFS journals renames itself, so it is skipped there.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+package fileutils
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// Not parallel: durability is process-wide.
+func TestDurability_GroupCommit(t *testing.T) {
+	if _, err := ParseDurability("fast"); err == nil {
+		t.Fatalf("expected error for unknown mode")
+	}
+	if mode, err := ParseDurability(""); err != nil || mode != DurabilityFull {
+		t.Fatalf("empty mode=%q err=%v", mode, err)
+	}
+
+	if err := SetDurability(DurabilityGroup); err != nil {
+		t.Fatalf("SetDurability: %v", err)
+	}
+	defer func() { _ = SetDurability(DurabilityFull) }()
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.json", "b.json"} {
+		if err := WriteJSONFileAtomic(filepath.Join(dir, name), map[string]int{"n": 1}, false); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	durability.Lock()
+	pending := len(durability.pending)
+	durability.Unlock()
+	if pending != 2 {
+		t.Fatalf("pending=%d", pending)
+	}
+
+	// A queued file removed before the flush is not an error.
+	if err := os.Remove(filepath.Join(dir, "b.json")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	durability.Lock()
+	pending = len(durability.pending)
+	durability.Unlock()
+	if pending != 0 {
+		t.Fatalf("pending after flush=%d", pending)
+	}
+}
+
+func TestSyncPath_ReadOnlyFile(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows needs a writable handle to flush")
+	}
+	path := filepath.Join(t.TempDir(), "a.json")
+	if err := os.WriteFile(path, []byte("{}"), 0o444); err != nil {
+		t.Fatal(err)
+	}
+	if err := syncPath(path); err != nil {
+		t.Fatalf("syncPath on a read-only file: %v", err)
+	}
+}
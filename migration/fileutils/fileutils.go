@@ -1,13 +1,13 @@
 package fileutils
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
-	"path/filepath"
 	"strings"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
 )
 
 func FileExists(path string) bool {
@@ -50,47 +50,26 @@ func CopyFileIfExists(srcPath, dstPath string, overwrite bool) (bool, error) {
 		}
 	}
 
-	b, err := os.ReadFile(srcPath)
+	b, err := os.ReadFile(layout.LongPath(srcPath))
 	if err != nil {
 		return false, err
 	}
-
-	if err := os.MkdirAll(filepath.Dir(dstPath), 0o755); err != nil {
+	if err := Reserve(dstPath, int64(len(b))); err != nil {
 		return false, err
 	}
-
-	tmp, err := os.CreateTemp(filepath.Dir(dstPath), ".tmp_copy_*")
+	tmp, err := CreateAtomic(layout.LongPath(dstPath), ".tmp_copy_*", 0)
 	if err != nil {
 		return false, err
 	}
-	tmpName := tmp.Name()
-	defer func() { _ = os.Remove(tmpName) }()
-
+	defer tmp.Abort()
 	if _, err := tmp.Write(b); err != nil {
-		_ = tmp.Close()
-		return false, err
-	}
-	if err := tmp.Sync(); err != nil {
-		_ = tmp.Close()
 		return false, err
 	}
-	if err := tmp.Close(); err != nil {
-		return false, err
-	}
-	if err := os.Rename(tmpName, dstPath); err != nil {
-		return false, err
-	}
-	return true, nil
+	return true, tmp.Commit()
 }
 
 func WriteJSONFileAtomic(path string, v any, pretty bool) error {
-	var b []byte
-	var err error
-	if pretty {
-		b, err = json.MarshalIndent(v, "", "  ")
-	} else {
-		b, err = json.Marshal(v)
-	}
+	b, err := MarshalJSON(v, pretty)
 	if err != nil {
 		return fmt.Errorf("marshal json: %w", err)
 	}
@@ -101,40 +80,19 @@ func WriteJSONFileAtomic(path string, v any, pretty bool) error {
 }
 
 func WriteFileAtomicSameDir(path string, data []byte, mode fs.FileMode) error {
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
+	if err := Reserve(path, int64(len(data))+1); err != nil {
 		return err
 	}
-
-	tmp, err := os.CreateTemp(dir, ".tmp_summary_*.json")
+	tmp, err := CreateAtomic(layout.LongPath(path), ".tmp_summary_*.json", mode)
 	if err != nil {
 		return err
 	}
-	tmpName := tmp.Name()
-	defer func() {
-		_ = os.Remove(tmpName)
-	}()
-
-	if err := tmp.Chmod(mode); err != nil {
-		_ = tmp.Close()
-		return err
-	}
-
+	defer tmp.Abort()
 	if _, err := tmp.Write(data); err != nil {
-		_ = tmp.Close()
 		return err
 	}
 	if _, err := tmp.Write([]byte("\n")); err != nil {
-		_ = tmp.Close()
 		return err
 	}
-	if err := tmp.Sync(); err != nil {
-		_ = tmp.Close()
-		return err
-	}
-	if err := tmp.Close(); err != nil {
-		return err
-	}
-
-	return os.Rename(tmpName, path)
+	return tmp.Commit()
 }
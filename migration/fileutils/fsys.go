@@ -0,0 +1,52 @@
+package fileutils
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+)
+
+// OS is a read-only fs.FS over the host filesystem that takes names exactly as the pipeline stores them
+// in flags and index rows: absolute, relative to the working directory, or with the platform separator.
+// Unlike os.DirFS it has no root, so readers handed OS behave as they did with plain paths. Other
+// filesystems (fstest.MapFS, embed.FS, zip.Reader, object storage) want names passed through FSPath.
+var OS fs.FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) { return os.Open(layout.LongPath(name)) }
+
+func (osFS) ReadFile(name string) ([]byte, error) { return os.ReadFile(layout.LongPath(name)) }
+
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(layout.LongPath(name)) }
+
+func (osFS) Stat(name string) (fs.FileInfo, error) { return os.Stat(layout.LongPath(name)) }
+
+func (osFS) Glob(pattern string) ([]string, error) { return filepath.Glob(pattern) }
+
+// FSPath converts a stored OS path to a name fsys accepts. For OS the path is returned unchanged; for any
+// other filesystem it becomes slash-separated and relative to the filesystem root ("." for the root).
+func FSPath(fsys fs.FS, name string) string {
+	if _, ok := fsys.(osFS); ok {
+		return name
+	}
+	name = path.Clean(filepath.ToSlash(name))
+	name = strings.TrimLeft(name, "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// JoinFS joins elem onto dir the way fsys expects: with the platform separator for OS and with slashes
+// for every other filesystem.
+func JoinFS(fsys fs.FS, dir string, elem ...string) string {
+	if _, ok := fsys.(osFS); ok {
+		return filepath.Join(append([]string{dir}, elem...)...)
+	}
+	return path.Join(append([]string{FSPath(fsys, dir)}, elem...)...)
+}
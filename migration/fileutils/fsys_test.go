@@ -0,0 +1,63 @@
+package fileutils
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFSPath(t *testing.T) {
+	t.Parallel()
+
+	mapFS := fstest.MapFS{}
+	for in, want := range map[string]string{
+		filepath.FromSlash("threads/index.json"):    "threads/index.json",
+		filepath.FromSlash("./threads/../a.json"):   "a.json",
+		filepath.FromSlash("/archive/threads/x.md"): "archive/threads/x.md",
+		".": ".",
+		"":  ".",
+	} {
+		if got := FSPath(mapFS, in); got != want {
+			t.Fatalf("FSPath(%q)=%q, want %q", in, got, want)
+		}
+	}
+	if got := FSPath(OS, filepath.FromSlash("./threads/x.json")); got != filepath.FromSlash("./threads/x.json") {
+		t.Fatalf("OS path rewritten: %q", got)
+	}
+	if got := JoinFS(mapFS, filepath.FromSlash("./shards"), "t/c1.md"); got != "shards/t/c1.md" {
+		t.Fatalf("JoinFS=%q", got)
+	}
+}
+
+func TestOS_ReadsHostPaths(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub", "a.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(`{}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	// Absolute paths are not valid fs.FS names, but OS takes them as stored.
+	b, err := fs.ReadFile(OS, path)
+	if err != nil || string(b) != `{}` {
+		t.Fatalf("ReadFile=%q err=%v", b, err)
+	}
+	matches, err := fs.Glob(OS, JoinFS(OS, dir, "sub", "*.json"))
+	if err != nil || len(matches) != 1 || matches[0] != path {
+		t.Fatalf("Glob=%v err=%v", matches, err)
+	}
+	var walked []string
+	if err := fs.WalkDir(OS, dir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			walked = append(walked, p)
+		}
+		return err
+	}); err != nil || len(walked) != 1 || filepath.Clean(walked[0]) != path {
+		t.Fatalf("WalkDir=%v err=%v", walked, err)
+	}
+}
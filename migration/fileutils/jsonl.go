@@ -0,0 +1,199 @@
+package fileutils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+)
+
+// JSONLWriter streams records to a JSONL file, one JSON value per line.
+type JSONLWriter struct {
+	path   string
+	f      *os.File
+	w      *bufio.Writer
+	closed bool
+}
+
+// CreateJSONL truncates path and opens it for writing.
+func CreateJSONL(path string) (*JSONLWriter, error) {
+	return openJSONL(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
+}
+
+// AppendJSONL opens path for appending, creating it if needed. If a crash left a torn final line, it is
+// terminated first so the next record starts on a line of its own; readers that key records skip it.
+func AppendJSONL(path string) (*JSONLWriter, error) {
+	w, err := openJSONL(path, os.O_CREATE|os.O_RDWR|os.O_APPEND)
+	if err != nil {
+		return nil, err
+	}
+	info, err := w.f.Stat()
+	if err != nil {
+		_ = w.f.Close()
+		return nil, err
+	}
+	if info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := w.f.ReadAt(last, info.Size()-1); err != nil {
+			_ = w.f.Close()
+			return nil, err
+		}
+		if last[0] != '\n' {
+			if err := w.w.WriteByte('\n'); err != nil {
+				_ = w.f.Close()
+				return nil, err
+			}
+		}
+	}
+	return w, nil
+}
+
+func openJSONL(path string, flag int) (*JSONLWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := Reserve(path, 0); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(layout.LongPath(path), flag, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLWriter{path: path, f: f, w: bufio.NewWriterSize(f, 1<<20)}, nil
+}
+
+// Write marshals v as one line.
+func (w *JSONLWriter) Write(v any) error {
+	line, err := MarshalJSON(v, false)
+	if err != nil {
+		return fmt.Errorf("marshal jsonl record: %w", err)
+	}
+	if err := reserveBytes(w.path, int64(len(line))+1); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Close flushes buffered records and closes the file, syncing it according to the durability mode.
+// Closing an already closed writer is a no-op, so callers can defer Close and still check the error of an
+// explicit one.
+func (w *JSONLWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if err := w.w.Flush(); err != nil {
+		_ = w.f.Close()
+		return err
+	}
+	return CloseSynced(w.f)
+}
+
+// JSONLKeyFunc returns the dedup key of one JSONL record and its id within that key. Single-row keys use
+// the key as the id; a key written as a group of rows (every key point of a chunk, say) gives each row its
+// own id. ok=false marks a record that cannot be keyed (a torn line, say); compaction drops it.
+type JSONLKeyFunc func(line []byte) (key, id string, ok bool)
+
+// JSONLFieldKey keys records by the top-level string field keyField, with ids from idField (empty: the
+// key itself).
+func JSONLFieldKey(keyField, idField string) JSONLKeyFunc {
+	return func(line []byte) (string, string, bool) {
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(line, &m); err != nil {
+			return "", "", false
+		}
+		field := func(name string) string {
+			var s string
+			_ = json.Unmarshal(m[name], &s)
+			return s
+		}
+		key := field(keyField)
+		if key == "" {
+			return "", "", false
+		}
+		if idField == "" {
+			return key, key, true
+		}
+		id := field(idField)
+		return key, id, id != ""
+	}
+}
+
+// CompactStats describes one CompactJSONL run.
+type CompactStats struct {
+	Kept    int `json:"kept"`
+	Dropped int `json:"dropped"`
+}
+
+// CompactJSONL rewrites an append-mode JSONL file so each key keeps only its last run of records. A run
+// is consecutive lines with the same key and distinct ids, so a group written again replaces the old
+// group as a whole even when the two end up adjacent. Keys stay in the order they first appeared. Lines
+// that cannot be keyed are dropped. The rewrite is atomic.
+func CompactJSONL(path string, key JSONLKeyFunc) (CompactStats, error) {
+	var stats CompactStats
+	f, err := os.Open(layout.LongPath(path))
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close()
+
+	var order []string
+	runs := map[string][][]byte{}
+	prev := ""
+	runIDs := map[string]bool{}
+	total := 0
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 1<<20), 64<<20)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		total++
+		k, id, ok := key(line)
+		if !ok {
+			prev = ""
+			continue
+		}
+		if _, seen := runs[k]; !seen {
+			order = append(order, k)
+		}
+		if k != prev || runIDs[id] {
+			// A new run replaces whatever this key had before.
+			runs[k] = nil
+			runIDs = map[string]bool{}
+		}
+		runs[k] = append(runs[k], append([]byte(nil), line...))
+		runIDs[id] = true
+		prev = k
+	}
+	if err := sc.Err(); err != nil {
+		return stats, fmt.Errorf("compact %s: %w", path, err)
+	}
+
+	var out bytes.Buffer
+	for _, k := range order {
+		for _, line := range runs[k] {
+			out.Write(line)
+			out.WriteByte('\n')
+			stats.Kept++
+		}
+	}
+	stats.Dropped = total - stats.Kept
+	info, err := f.Stat()
+	if err != nil {
+		return stats, err
+	}
+	// WriteFileAtomicSameDir appends the trailing newline itself.
+	if err := WriteFileAtomicSameDir(path, bytes.TrimSuffix(out.Bytes(), []byte("\n")), info.Mode().Perm()); err != nil {
+		return stats, fmt.Errorf("compact %s: %w", path, err)
+	}
+	return stats, nil
+}
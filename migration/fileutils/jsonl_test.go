@@ -0,0 +1,64 @@
+package fileutils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAppendJSONL_TerminatesTornLine(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "index.json")
+	if err := os.WriteFile(path, []byte("{\"k\":\"a\"}\n{\"k\":\"b\",\"v"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	w, err := AppendJSONL(path)
+	if err != nil {
+		t.Fatalf("AppendJSONL: %v", err)
+	}
+	if err := w.Write(map[string]string{"k": "c"}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+	b, _ := os.ReadFile(path)
+	if want := "{\"k\":\"a\"}\n{\"k\":\"b\",\"v\n{\"k\":\"c\"}\n"; string(b) != want {
+		t.Fatalf("file=%q want %q", b, want)
+	}
+}
+
+func TestCompactJSONL_LastRunPerKeyWins(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "key_points.jsonl")
+	// a is written as a group twice, the second time right after the first; b is replaced by a single row.
+	in := `{"p":"a","n":"1"}
+{"p":"a","n":"2"}
+{"p":"a","n":"1"}
+{"p":"b","n":"1"}
+{"p":"c"
+{"p":"b","n":"4"}
+`
+	if err := os.WriteFile(path, []byte(in), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	stats, err := CompactJSONL(path, JSONLFieldKey("p", "n"))
+	if err != nil {
+		t.Fatalf("CompactJSONL: %v", err)
+	}
+	if stats.Kept != 2 || stats.Dropped != 4 {
+		t.Fatalf("stats=%+v", stats)
+	}
+	b, _ := os.ReadFile(path)
+	if want := "{\"p\":\"a\",\"n\":\"1\"}\n{\"p\":\"b\",\"n\":\"4\"}\n"; string(b) != want {
+		t.Fatalf("file=%q want %q", b, want)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Fatalf("mode=%v", info.Mode())
+	}
+}
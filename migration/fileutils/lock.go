@@ -0,0 +1,46 @@
+package fileutils
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+const (
+	// LockTimeout is how long LockPath waits for another process to release a lock.
+	LockTimeout = 2 * time.Minute
+	// lockStaleAfter is the age at which a lock file is assumed to belong to a crashed process. Locks
+	// are only held for a read-merge-write cycle, so anything this old is abandoned.
+	lockStaleAfter = 5 * time.Minute
+	lockPollEvery  = 50 * time.Millisecond
+)
+
+// LockPath takes an advisory lock on path by creating path+".lock" exclusively, so cooperating
+// processes (two summarizer runs sharing a glossary, say) serialize their read-merge-write cycles. It
+// works the same on every OS and filesystem that supports O_EXCL. The returned func releases the lock.
+func LockPath(path string) (func(), error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(LockTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, _ = fmt.Fprintf(f, "pid=%d time=%s\n", os.Getpid(), time.Now().UTC().Format(time.RFC3339))
+			_ = f.Close()
+			return func() { _ = os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+		if fi, err := os.Stat(lockPath); err == nil && time.Since(fi.ModTime()) > lockStaleAfter {
+			// Abandoned by a crashed run; the next attempt races fairly with anyone else removing it.
+			_ = os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("lock %s: still held by another process after %s (remove %s if no other run is active)", path, LockTimeout, lockPath)
+		}
+		time.Sleep(lockPollEvery)
+	}
+}
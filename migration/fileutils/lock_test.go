@@ -0,0 +1,51 @@
+package fileutils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockPath_WaitsForRelease(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "glossary.json")
+	unlock, err := LockPath(path)
+	if err != nil {
+		t.Fatalf("LockPath: %v", err)
+	}
+	released := make(chan time.Time, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		released <- time.Now()
+		unlock()
+	}()
+
+	unlock2, err := LockPath(path)
+	if err != nil {
+		t.Fatalf("second LockPath: %v", err)
+	}
+	acquired := time.Now()
+	if at := <-released; acquired.Before(at) {
+		t.Fatalf("second lock acquired before the first was released")
+	}
+	unlock2()
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Fatalf("lock file left behind: %v", err)
+	}
+
+	// A lock left by a crashed process is taken over once stale.
+	if err := os.WriteFile(path+".lock", []byte("pid=1\n"), 0o644); err != nil {
+		t.Fatalf("write stale lock: %v", err)
+	}
+	old := time.Now().Add(-2 * lockStaleAfter)
+	if err := os.Chtimes(path+".lock", old, old); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	unlock3, err := LockPath(path)
+	if err != nil {
+		t.Fatalf("stale LockPath: %v", err)
+	}
+	unlock3()
+}
@@ -0,0 +1,126 @@
+package fileutils
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ParallelOrdered calls fn on every item using up to workers goroutines and passes each result to emit
+// in input order, from the calling goroutine, so emit can stream into a single writer. At most a few
+// results per worker are held waiting for a slower earlier item. The first error in input order, from fn
+// or emit, stops the run and is returned.
+func ParallelOrdered[T, R any](items []T, workers int, fn func(T) (R, error), emit func(R) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	type result struct {
+		i   int
+		r   R
+		err error
+	}
+	window := make(chan struct{}, 4*workers)
+	jobs := make(chan int)
+	results := make(chan result, 4*workers)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(jobs)
+		for i := range items {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				r, err := fn(items[i])
+				select {
+				case results <- result{i: i, r: r, err: err}:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	pending := map[int]result{}
+	next := 0
+	for res := range results {
+		pending[res.i] = res
+		for {
+			p, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			<-window
+			if p.err != nil {
+				return p.err
+			}
+			if err := emit(p.r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WalkShards returns the sorted paths of files under root for which match is true. Each top-level
+// subdirectory (one per thread in the pipeline's output trees) is walked by its own worker, up to
+// workers at once, which keeps directory reads from serializing on slow or network filesystems.
+func WalkShards(root string, workers int, match func(path string) bool) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	var out, dirs []string
+	for _, e := range entries {
+		p := filepath.Join(root, e.Name())
+		if e.IsDir() {
+			dirs = append(dirs, p)
+		} else if match(p) {
+			out = append(out, p)
+		}
+	}
+	err = ParallelOrdered(dirs, workers, func(dir string) ([]string, error) {
+		var found []string
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && match(path) {
+				found = append(found, path)
+			}
+			return nil
+		})
+		return found, err
+	}, func(found []string) error {
+		out = append(out, found...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(out)
+	return out, nil
+}
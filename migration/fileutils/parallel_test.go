@@ -0,0 +1,85 @@
+package fileutils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParallelOrdered_EmitsInInputOrder(t *testing.T) {
+	t.Parallel()
+
+	items := make([]int, 100)
+	for i := range items {
+		items[i] = i
+	}
+	var got []int
+	err := ParallelOrdered(items, 8, func(i int) (int, error) {
+		// Early items finish last, so results arrive out of order.
+		time.Sleep(time.Duration(100-i) * 10 * time.Microsecond)
+		return i * i, nil
+	}, func(r int) error {
+		got = append(got, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ParallelOrdered: %v", err)
+	}
+	if len(got) != len(items) {
+		t.Fatalf("len=%d", len(got))
+	}
+	for i, r := range got {
+		if r != i*i {
+			t.Fatalf("got[%d]=%d", i, r)
+		}
+	}
+}
+
+func TestParallelOrdered_StopsAtFirstError(t *testing.T) {
+	t.Parallel()
+
+	boom := errors.New("boom")
+	emitted := 0
+	err := ParallelOrdered([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 3, func(i int) (int, error) {
+		if i == 4 {
+			return 0, boom
+		}
+		return i, nil
+	}, func(int) error {
+		emitted++
+		return nil
+	})
+	if !errors.Is(err, boom) || emitted != 4 {
+		t.Fatalf("err=%v emitted=%d", err, emitted)
+	}
+}
+
+func TestWalkShards(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for _, p := range []string{"index.json", "a/1.summary.json", "a/1.json", "b/x/2.summary.json", "c/3.summary.json"} {
+		full := filepath.Join(root, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(full, []byte("{}"), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	got, err := WalkShards(root, 2, func(p string) bool { return strings.HasSuffix(p, ".summary.json") })
+	if err != nil {
+		t.Fatalf("WalkShards: %v", err)
+	}
+	var rel []string
+	for _, p := range got {
+		r, _ := filepath.Rel(root, p)
+		rel = append(rel, filepath.ToSlash(r))
+	}
+	if strings.Join(rel, ",") != "a/1.summary.json,b/x/2.summary.json,c/3.summary.json" {
+		t.Fatalf("got=%v", rel)
+	}
+}
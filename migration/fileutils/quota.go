@@ -0,0 +1,117 @@
+package fileutils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+)
+
+// DefaultMaxFilesPerDir is the -max-files-per-dir default: far more than any real archive puts in one
+// directory, and far less than a malformed input can make a stage write.
+const DefaultMaxFilesPerDir = 100_000
+
+// ErrQuotaExceeded is wrapped by the errors writers in this package return once a write would break the
+// process-wide Quota.
+var ErrQuotaExceeded = errors.New("output quota exceeded")
+
+// Quota caps what one stage run writes, so a runaway stage stops with an error instead of filling the
+// disk. Zero fields are unlimited.
+type Quota struct {
+	// MaxFilesPerDir caps the files in any directory the stage writes to, counting files already there.
+	MaxFilesPerDir int
+	// MaxBytes caps the bytes the stage writes in total.
+	MaxBytes int64
+}
+
+var quota = struct {
+	sync.Mutex
+	q     Quota
+	bytes int64
+	// dirs counts the files in each directory written to so far; a directory is listed once, on its
+	// first new file.
+	dirs map[string]int
+}{}
+
+// SetQuota sets the process-wide quota enforced by the writers in this package and by callers that use
+// Reserve, and resets the counts against it.
+func SetQuota(q Quota) error {
+	if q.MaxFilesPerDir < 0 || q.MaxBytes < 0 {
+		return errors.New("-max-files-per-dir and -max-output-bytes must be >= 0")
+	}
+	quota.Lock()
+	defer quota.Unlock()
+	quota.q, quota.bytes, quota.dirs = q, 0, nil
+	return nil
+}
+
+// Reserve accounts for writing n bytes to path, creating it if it does not exist yet, and returns an
+// error wrapping ErrQuotaExceeded instead when that would break the quota. Writers call it before
+// writing anything.
+func Reserve(path string, n int64) error {
+	quota.Lock()
+	defer quota.Unlock()
+	if err := reserveBytesLocked(path, n); err != nil {
+		return err
+	}
+	if quota.q.MaxFilesPerDir <= 0 {
+		quota.bytes += n
+		return nil
+	}
+	if _, err := os.Stat(layout.LongPath(path)); err == nil {
+		quota.bytes += n
+		return nil
+	}
+	dir := filepath.Dir(path)
+	count, ok := quota.dirs[dir]
+	if !ok {
+		count = countFiles(dir)
+	}
+	if count >= quota.q.MaxFilesPerDir {
+		return fmt.Errorf("%w: %s already holds %d files (-max-files-per-dir %d); writing %s stopped",
+			ErrQuotaExceeded, dir, count, quota.q.MaxFilesPerDir, filepath.Base(path))
+	}
+	if quota.dirs == nil {
+		quota.dirs = map[string]int{}
+	}
+	quota.dirs[dir] = count + 1
+	quota.bytes += n
+	return nil
+}
+
+// reserveBytes is Reserve for appends to a file that already exists.
+func reserveBytes(path string, n int64) error {
+	quota.Lock()
+	defer quota.Unlock()
+	if err := reserveBytesLocked(path, n); err != nil {
+		return err
+	}
+	quota.bytes += n
+	return nil
+}
+
+func reserveBytesLocked(path string, n int64) error {
+	if quota.q.MaxBytes > 0 && quota.bytes+n > quota.q.MaxBytes {
+		return fmt.Errorf("%w: writing %s would take this run past %d bytes (-max-output-bytes)",
+			ErrQuotaExceeded, path, quota.q.MaxBytes)
+	}
+	return nil
+}
+
+// countFiles returns how many non-directory entries dir holds; a missing dir holds none.
+func countFiles(dir string) int {
+	entries, err := os.ReadDir(layout.LongPath(dir))
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, e := range entries {
+		if !e.IsDir() {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,60 @@
+package fileutils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Not parallel: the quota is process-wide.
+func TestQuota_FilesPerDirAndBytes(t *testing.T) {
+	if err := SetQuota(Quota{MaxFilesPerDir: -1}); err == nil {
+		t.Fatal("expected error for a negative quota")
+	}
+	defer func() { _ = SetQuota(Quota{}) }()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "old.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetQuota(Quota{MaxFilesPerDir: 3}); err != nil {
+		t.Fatalf("SetQuota: %v", err)
+	}
+	for _, name := range []string{"a.json", "b.json"} {
+		if err := WriteJSONFileAtomic(filepath.Join(dir, name), map[string]int{"n": 1}, false); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	// Files already in the directory count; rewriting one does not add a file.
+	if err := WriteJSONFileAtomic(filepath.Join(dir, "a.json"), map[string]int{"n": 2}, false); err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	err := WriteJSONFileAtomic(filepath.Join(dir, "c.json"), map[string]int{"n": 1}, false)
+	if !errors.Is(err, ErrQuotaExceeded) || !strings.Contains(err.Error(), "-max-files-per-dir") {
+		t.Fatalf("fourth file err=%v", err)
+	}
+	if FileExists(filepath.Join(dir, "c.json")) {
+		t.Fatal("file written past the quota")
+	}
+	// Another directory has its own count.
+	if err := WriteJSONFileAtomic(filepath.Join(dir, "sub", "c.json"), map[string]int{"n": 1}, false); err != nil {
+		t.Fatalf("other dir: %v", err)
+	}
+
+	if err := SetQuota(Quota{MaxBytes: 30}); err != nil {
+		t.Fatalf("SetQuota: %v", err)
+	}
+	w, err := CreateJSONL(filepath.Join(dir, "index.jsonl"))
+	if err != nil {
+		t.Fatalf("CreateJSONL: %v", err)
+	}
+	defer w.Close()
+	if err := w.Write(map[string]string{"id": "0123456789"}); err != nil {
+		t.Fatalf("first row: %v", err)
+	}
+	if err := w.Write(map[string]string{"id": "0123456789"}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("second row err=%v", err)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
 )
 
 // GlossaryAddition is a model-proposed term to add/update in the glossary.
@@ -18,20 +20,82 @@ type GlossaryAddition struct {
 }
 
 // LoadGlossary reads a glossary JSON file. If the file doesn't exist, it returns an empty glossary.
+// The file is read under the same lock SaveGlossary takes, and the loaded counts are remembered so a
+// later SaveGlossary merges instead of overwriting.
 func LoadGlossary(path string) (Glossary, error) {
 	if path == "" {
 		return Glossary{}, errors.New("LoadGlossary: path is empty")
 	}
+	unlock, err := fileutils.LockPath(path)
+	if err != nil {
+		return Glossary{}, fmt.Errorf("LoadGlossary: %w", err)
+	}
+	defer unlock()
+
+	g, err := readGlossary(path)
+	if err != nil {
+		return Glossary{}, fmt.Errorf("LoadGlossary: %w", err)
+	}
+	g.base = glossaryCounts(g.Entries)
+	return g, nil
+}
+
+// SaveGlossary merges g into the glossary file atomically. Under a lock on path it re-reads the file,
+// applies the count increments g gained since it was loaded (or last saved), keeps entries other runs
+// added, and drops entries g removed (for example with CullGlossary). Concurrent runs sharing a
+// glossary therefore cooperate instead of overwriting each other. A Glossary not obtained from
+// LoadGlossary is merged as if all of its entries were new.
+func SaveGlossary(path string, g Glossary) error {
+	if path == "" {
+		return errors.New("SaveGlossary: path is empty")
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("SaveGlossary: mkdir dir: %w", err)
+	}
+	unlock, err := fileutils.LockPath(path)
+	if err != nil {
+		return fmt.Errorf("SaveGlossary: %w", err)
+	}
+	defer unlock()
+
+	onDisk, err := readGlossary(path)
+	if err != nil {
+		return fmt.Errorf("SaveGlossary: %w", err)
+	}
+	merged := mergeGlossaryFile(onDisk, g)
+
+	b, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return fmt.Errorf("SaveGlossary: marshal: %w", err)
+	}
+	_, err = writeFileAtomic(path, b, 0o644)
+	if err != nil {
+		return fmt.Errorf("SaveGlossary: write: %w", err)
+	}
+
+	// g's entries are now on disk; only increments made after this point are new. base is a map, so
+	// this updates the caller's copy too.
+	if g.base != nil {
+		clear(g.base)
+		for k, n := range glossaryCounts(g.Entries) {
+			g.base[k] = n
+		}
+	}
+	return nil
+}
+
+func readGlossary(path string) (Glossary, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			return Glossary{Version: 1, Entries: []GlossaryEntry{}}, nil
 		}
-		return Glossary{}, fmt.Errorf("LoadGlossary: read file: %w", err)
+		return Glossary{}, fmt.Errorf("read file: %w", err)
 	}
 	var g Glossary
 	if err := json.Unmarshal(b, &g); err != nil {
-		return Glossary{}, fmt.Errorf("LoadGlossary: unmarshal: %w", err)
+		return Glossary{}, fmt.Errorf("unmarshal: %w", err)
 	}
 	if g.Version == 0 {
 		g.Version = 1
@@ -42,24 +106,86 @@ func LoadGlossary(path string) (Glossary, error) {
 	return g, nil
 }
 
-// SaveGlossary writes the glossary JSON file atomically.
-func SaveGlossary(path string, g Glossary) error {
-	if path == "" {
-		return errors.New("SaveGlossary: path is empty")
+func glossaryCounts(entries []GlossaryEntry) map[string]int {
+	counts := make(map[string]int, len(entries))
+	for _, e := range entries {
+		if key := normalizeGlossaryKey(e.Term); key != "" {
+			counts[key] = e.Count
+		}
 	}
-	b, err := json.MarshalIndent(g, "", "  ")
-	if err != nil {
-		return fmt.Errorf("SaveGlossary: marshal: %w", err)
+	return counts
+}
+
+// mergeGlossaryFile applies local's changes since local.base to onDisk and returns the result.
+func mergeGlossaryFile(onDisk, local Glossary) Glossary {
+	out := onDisk
+	out.Version = max(onDisk.Version, local.Version, 1)
+	if len(local.Meta) > 0 {
+		out.Meta = make(map[string]any, len(onDisk.Meta)+len(local.Meta))
+		for k, v := range onDisk.Meta {
+			out.Meta[k] = v
+		}
+		for k, v := range local.Meta {
+			out.Meta[k] = v
+		}
 	}
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return fmt.Errorf("SaveGlossary: mkdir dir: %w", err)
+
+	index := make(map[string]int, len(out.Entries))
+	for i := range out.Entries {
+		if key := normalizeGlossaryKey(out.Entries[i].Term); key != "" {
+			index[key] = i
+		}
 	}
-	_, err = writeFileAtomic(dir, path, b, 0o644)
-	if err != nil {
-		return fmt.Errorf("SaveGlossary: write: %w", err)
+	kept := make(map[string]bool, len(local.Entries))
+	for _, e := range local.Entries {
+		key := normalizeGlossaryKey(e.Term)
+		if key == "" {
+			continue
+		}
+		kept[key] = true
+		i, ok := index[key]
+		if !ok {
+			out.Entries = append(out.Entries, e)
+			index[key] = len(out.Entries) - 1
+			continue
+		}
+		d := &out.Entries[i]
+		if delta := e.Count - local.base[key]; delta > 0 {
+			d.Count += delta
+		}
+		d.FirstSeenAt = earliest(d.FirstSeenAt, e.FirstSeenAt)
+		d.LastSeenAt = latest(d.LastSeenAt, e.LastSeenAt)
+		if def := strings.TrimSpace(e.Definition); len(def) > len(strings.TrimSpace(d.Definition)) {
+			d.Definition = def
+		}
 	}
-	return nil
+
+	// Terms this process had and then removed (culled) are removed from the file too.
+	entries := out.Entries[:0:0]
+	for _, e := range out.Entries {
+		key := normalizeGlossaryKey(e.Term)
+		if _, had := local.base[key]; had && !kept[key] {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	out.Entries = entries
+	sortGlossary(out.Entries)
+	return out
+}
+
+func earliest(a, b *float64) *float64 {
+	if a == nil || (b != nil && *b < *a) {
+		return b
+	}
+	return a
+}
+
+func latest(a, b *float64) *float64 {
+	if a == nil || (b != nil && *b > *a) {
+		return b
+	}
+	return a
 }
 
 // MergeGlossary applies additions, bumps occurrence counts, and returns the list of terms that were touched.
@@ -119,13 +245,7 @@ func MergeGlossary(g *Glossary, additions []GlossaryAddition, seenAt *float64) [
 		index[key] = len(g.Entries) - 1
 	}
 
-	// Keep stable ordering: highest count first, then term.
-	sort.SliceStable(g.Entries, func(i, j int) bool {
-		if g.Entries[i].Count != g.Entries[j].Count {
-			return g.Entries[i].Count > g.Entries[j].Count
-		}
-		return strings.ToLower(g.Entries[i].Term) < strings.ToLower(g.Entries[j].Term)
-	})
+	sortGlossary(g.Entries)
 
 	terms := make([]string, 0, len(seenKeys))
 	for key := range seenKeys {
@@ -149,6 +269,16 @@ func CullGlossary(g *Glossary, minCount int) {
 	g.Entries = out
 }
 
+// sortGlossary keeps a stable ordering: highest count first, then term.
+func sortGlossary(entries []GlossaryEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return strings.ToLower(entries[i].Term) < strings.ToLower(entries[j].Term)
+	})
+}
+
 func normalizeGlossaryKey(term string) string {
 	term = strings.TrimSpace(term)
 	if term == "" {
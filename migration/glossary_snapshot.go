@@ -0,0 +1,63 @@
+package migration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+// GlossarySnapshotsDirName is the directory, next to the glossary's summaries, holding the glossary
+// snapshots their prompts saw.
+const GlossarySnapshotsDirName = "glossary_snapshots"
+
+// GlossarySnapshot is the glossary as a batch of summary prompts saw it: the excerpt injected into the
+// prompts, the terms it listed, and the full glossary it was cut from.
+type GlossarySnapshot struct {
+	ExcerptSHA256 string   `json:"excerpt_sha256"`
+	Terms         []string `json:"terms"`
+	Excerpt       string   `json:"excerpt"`
+	TakenAt       string   `json:"taken_at"`
+	Glossary      Glossary `json:"glossary"`
+}
+
+// GlossaryExcerptSHA256 returns the hex SHA-256 of a prompt's glossary excerpt, the key summaries and
+// snapshots share.
+func GlossaryExcerptSHA256(excerpt string) string {
+	sum := sha256.Sum256([]byte(excerpt))
+	return hex.EncodeToString(sum[:])
+}
+
+// GlossarySnapshotName returns the file name of the snapshot for an excerpt hash.
+func GlossarySnapshotName(excerptSHA256 string) string {
+	return excerptSHA256[:min(len(excerptSHA256), 16)] + ".json"
+}
+
+// WriteGlossarySnapshot archives g and the excerpt cut from it in dir, named by the excerpt's hash, and
+// returns the snapshot path. Snapshots are content-addressed: when a snapshot of the same excerpt
+// already exists it is kept, so it records when that glossary version was first used.
+func WriteGlossarySnapshot(dir string, g Glossary, excerpt string, terms []string) (string, error) {
+	if dir == "" {
+		return "", errors.New("WriteGlossarySnapshot: dir is empty")
+	}
+	hash := GlossaryExcerptSHA256(excerpt)
+	path := filepath.Join(dir, GlossarySnapshotName(hash))
+	if fileutils.FileExists(path) {
+		return path, nil
+	}
+	snap := GlossarySnapshot{
+		ExcerptSHA256: hash,
+		Terms:         append([]string{}, terms...),
+		Excerpt:       excerpt,
+		TakenAt:       time.Now().UTC().Format(time.RFC3339),
+		Glossary:      g,
+	}
+	if err := fileutils.WriteJSONFileAtomic(path, snap, true); err != nil {
+		return "", fmt.Errorf("WriteGlossarySnapshot: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,51 @@
+package migration
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteGlossarySnapshot_ContentAddressed(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), GlossarySnapshotsDirName)
+	g := Glossary{Version: 1, Entries: []GlossaryEntry{{Term: "Vix", Definition: "companion agent", Count: 2}}}
+	excerpt := "- Vix: companion agent\n"
+
+	path, err := WriteGlossarySnapshot(dir, g, excerpt, []string{"Vix"})
+	if err != nil {
+		t.Fatalf("WriteGlossarySnapshot: %v", err)
+	}
+	hash := GlossaryExcerptSHA256(excerpt)
+	if filepath.Base(path) != GlossarySnapshotName(hash) || len(filepath.Base(path)) != len("0123456789abcdef.json") {
+		t.Fatalf("path=%s, want name from hash %s", path, hash)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read snapshot: %v", err)
+	}
+	var snap GlossarySnapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		t.Fatalf("unmarshal snapshot: %v", err)
+	}
+	if snap.ExcerptSHA256 != hash || snap.Excerpt != excerpt || len(snap.Terms) != 1 || len(snap.Glossary.Entries) != 1 || snap.TakenAt == "" {
+		t.Fatalf("snapshot=%+v", snap)
+	}
+
+	// The same excerpt keeps the first snapshot even when the counts behind it moved on.
+	g.Entries[0].Count = 9
+	again, err := WriteGlossarySnapshot(dir, g, excerpt, []string{"Vix"})
+	if err != nil || again != path {
+		t.Fatalf("rewrite path=%s err=%v", again, err)
+	}
+	if b2, _ := os.ReadFile(path); string(b2) != string(b) {
+		t.Fatalf("snapshot rewritten:\n%s", b2)
+	}
+
+	other, err := WriteGlossarySnapshot(dir, g, "- Vix: something else\n", []string{"Vix"})
+	if err != nil || other == path {
+		t.Fatalf("other excerpt path=%s err=%v", other, err)
+	}
+}
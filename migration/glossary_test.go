@@ -1,6 +1,7 @@
 package migration
 
 import (
+	"path/filepath"
 	"testing"
 )
 
@@ -68,3 +69,71 @@ func TestCullGlossary_RemovesInfrequent(t *testing.T) {
 		t.Fatalf("entries=%v, want only B", g.Entries)
 	}
 }
+
+func TestSaveGlossary_MergesConcurrentRuns(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "glossary.json")
+	seed, err := LoadGlossary(path)
+	if err != nil {
+		t.Fatalf("LoadGlossary: %v", err)
+	}
+	MergeGlossary(&seed, []GlossaryAddition{{Term: "Vix"}, {Term: "Sparky"}}, nil)
+	if err := SaveGlossary(path, seed); err != nil {
+		t.Fatalf("SaveGlossary: %v", err)
+	}
+
+	// Two runs load the same file and summarize different chunks.
+	a, _ := LoadGlossary(path)
+	b, _ := LoadGlossary(path)
+	MergeGlossary(&a, []GlossaryAddition{{Term: "vix", Definition: "the assistant persona"}, {Term: "Lisbon"}}, nil)
+	MergeGlossary(&b, []GlossaryAddition{{Term: "Vix"}, {Term: "Sourdough"}}, nil)
+	MergeGlossary(&b, []GlossaryAddition{{Term: "Vix"}}, nil)
+	if err := SaveGlossary(path, a); err != nil {
+		t.Fatalf("save a: %v", err)
+	}
+	if err := SaveGlossary(path, b); err != nil {
+		t.Fatalf("save b: %v", err)
+	}
+	// Saving again without new increments must not double count.
+	if err := SaveGlossary(path, a); err != nil {
+		t.Fatalf("save a again: %v", err)
+	}
+
+	got, err := LoadGlossary(path)
+	if err != nil {
+		t.Fatalf("LoadGlossary: %v", err)
+	}
+	counts := map[string]int{}
+	for _, e := range got.Entries {
+		counts[e.Term] = e.Count
+	}
+	want := map[string]int{"Vix": 4, "Sparky": 1, "Lisbon": 1, "Sourdough": 1}
+	if len(counts) != len(want) {
+		t.Fatalf("counts=%v", counts)
+	}
+	for term, n := range want {
+		if counts[term] != n {
+			t.Fatalf("counts=%v want %v", counts, want)
+		}
+	}
+	if got.Entries[0].Term != "Vix" || got.Entries[0].Definition != "the assistant persona" {
+		t.Fatalf("first entry=%+v", got.Entries[0])
+	}
+
+	// Culling removes terms from the file without touching terms only other runs have seen.
+	MergeGlossary(&got, []GlossaryAddition{{Term: "Vix"}}, nil)
+	CullGlossary(&got, 2)
+	other, _ := LoadGlossary(path)
+	MergeGlossary(&other, []GlossaryAddition{{Term: "Porto"}}, nil)
+	if err := SaveGlossary(path, other); err != nil {
+		t.Fatalf("save other: %v", err)
+	}
+	if err := SaveGlossary(path, got); err != nil {
+		t.Fatalf("save culled: %v", err)
+	}
+	final, _ := LoadGlossary(path)
+	if len(final.Entries) != 2 || final.Entries[0].Term != "Vix" || final.Entries[0].Count != 5 || final.Entries[1].Term != "Porto" {
+		t.Fatalf("final=%+v", final.Entries)
+	}
+}
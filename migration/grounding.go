@@ -0,0 +1,195 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// -verify-terms modes: what thread-rollup does with rollup tags and terms its source chunk summaries
+// never mention.
+const (
+	// VerifyTermsDrop removes them from Tags/Terms and records them in Unverified*.
+	VerifyTermsDrop = "drop"
+	// VerifyTermsFlag keeps them and records them in Unverified*.
+	VerifyTermsFlag = "flag"
+	// VerifyTermsOff skips the check.
+	VerifyTermsOff = "off"
+)
+
+// VerifyTermsModes lists the -verify-terms values.
+var VerifyTermsModes = []string{VerifyTermsDrop, VerifyTermsFlag, VerifyTermsOff}
+
+// ParseVerifyTerms validates a -verify-terms value. Empty means VerifyTermsDrop.
+func ParseVerifyTerms(s string) (string, error) {
+	switch s {
+	case "":
+		return VerifyTermsDrop, nil
+	case VerifyTermsDrop, VerifyTermsFlag, VerifyTermsOff:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid -verify-terms %q (want drop, flag or off)", s)
+}
+
+// Grounding is the text a rollup was written from, for checking that the tags and terms a model
+// returned were not made up. Matching ignores case, punctuation and Latin accents, and a word matches
+// any word that starts with most of it, so "visas" is supported by "visa", "home-automation" by
+// "home automation" and "cafe" by "Café". Words in scripts written without spaces (Chinese, Japanese,
+// Thai, ...) match anywhere in the text, since the source has no word boundaries to anchor them.
+type Grounding struct {
+	text string
+}
+
+// groundingMinPrefix is the shortest word prefix a fuzzy word match compares.
+const groundingMinPrefix = 4
+
+// NewGrounding indexes texts as one source.
+func NewGrounding(texts ...string) Grounding {
+	var b strings.Builder
+	b.WriteByte(' ')
+	for _, t := range texts {
+		if n := normalizeGroundingText(t); n != "" {
+			b.WriteString(n)
+			b.WriteByte(' ')
+		}
+	}
+	return Grounding{text: b.String()}
+}
+
+// ChunkGrounding is the Grounding of a thread's chunk summaries: titles, summaries, key points, tags
+// and terms.
+func ChunkGrounding(chunks []ChunkSummary) Grounding {
+	var texts []string
+	for _, c := range chunks {
+		texts = append(texts, c.OriginalTitle, c.Summary)
+		texts = append(texts, c.KeyPoints...)
+		texts = append(texts, c.Tags...)
+		texts = append(texts, c.Terms...)
+	}
+	return NewGrounding(texts...)
+}
+
+// ThreadGrounding is ChunkGrounding for rollups, used for sagas.
+func ThreadGrounding(threads []ThreadSummary) Grounding {
+	var texts []string
+	for _, t := range threads {
+		texts = append(texts, t.Title, t.OriginalTitle, t.Summary)
+		texts = append(texts, t.KeyPoints...)
+		texts = append(texts, t.Tags...)
+		texts = append(texts, t.Terms...)
+	}
+	return NewGrounding(texts...)
+}
+
+// Supports reports whether s appears in the source: the whole phrase, or each of its words of three
+// or more letters. Values without letters or digits are always supported.
+func (g Grounding) Supports(s string) bool {
+	n := normalizeGroundingText(s)
+	if n == "" || strings.Contains(g.text, " "+n+" ") {
+		return true
+	}
+	words := strings.Fields(n)
+	checked := 0
+	for _, w := range words {
+		if unspacedScript(w) {
+			checked++
+			if !strings.Contains(g.text, w) {
+				return false
+			}
+			continue
+		}
+		if len(w) < 3 {
+			continue
+		}
+		checked++
+		if !strings.Contains(g.text, " "+groundingPrefix(w)) {
+			return false
+		}
+	}
+	// A phrase of only short words ("ai", "d7") has to appear whole.
+	return checked > 0
+}
+
+// Filter splits values into those the source supports and those it doesn't, keeping their order.
+func (g Grounding) Filter(values []string) (supported, unsupported []string) {
+	for _, v := range values {
+		if g.Supports(v) {
+			supported = append(supported, v)
+		} else {
+			unsupported = append(unsupported, v)
+		}
+	}
+	return supported, unsupported
+}
+
+// VerifyTerms checks ts.Tags and ts.Terms against g under mode (empty means VerifyTermsDrop),
+// recording the unsupported ones in ts.UnverifiedTags/UnverifiedTerms and, unless mode is
+// VerifyTermsFlag, removing them.
+func VerifyTerms(ts *ThreadSummary, g Grounding, mode string) {
+	if mode == VerifyTermsOff {
+		return
+	}
+	tags, badTags := g.Filter(ts.Tags)
+	terms, badTerms := g.Filter(ts.Terms)
+	ts.UnverifiedTags, ts.UnverifiedTerms = badTags, badTerms
+	if mode != VerifyTermsFlag {
+		ts.Tags, ts.Terms = tags, terms
+	}
+}
+
+// groundingPrefix is the part of w a source word has to start with: all of a short word, and about
+// three quarters of a longer one so plurals and other endings still match.
+func groundingPrefix(w string) string {
+	r := []rune(w)
+	n := max(len(r)*3/4, groundingMinPrefix)
+	if n >= len(r) {
+		return w
+	}
+	return string(r[:n])
+}
+
+// normalizeGroundingText lowercases s, folds Latin accents (see foldAccents), and turns every run of
+// characters other than letters and digits into one space.
+func normalizeGroundingText(s string) string {
+	return strings.Join(strings.FieldsFunc(foldAccents(strings.ToLower(s)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
+
+// unspacedScript reports whether w contains letters of a script written without spaces between
+// words, where a term can only be found as a substring of the text around it.
+func unspacedScript(w string) bool {
+	return strings.ContainsFunc(w, func(r rune) bool {
+		return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai, unicode.Lao, unicode.Khmer, unicode.Myanmar)
+	})
+}
+
+// accentFolds maps lowercase precomposed Latin letters to their base letters, rune for rune.
+var accentFolds = func() map[rune]string {
+	const from = "àáâãäåāăąçćĉċčďđèéêëēĕėęěĝğġģĥħìíîïĩīĭįıĵķĺļľŀłñńņňòóôõöøōŏőŕŗřśŝşšșţťŧțùúûüũūŭůűųŵýÿŷźżž"
+	const to = "aaaaaaaaacccccddeeeeeeeeegggghhiiiiiiiiijklllllnnnnooooooooorrrsssssttttuuuuuuuuuuwyyyzzz"
+	m := map[rune]string{'ß': "ss", 'æ': "ae", 'œ': "oe", 'þ': "th", 'ð': "d"}
+	base := []rune(to)
+	for i, r := range []rune(from) {
+		m[r] = string(base[i])
+	}
+	return m
+}()
+
+// foldAccents strips diacritics from lowercase Latin text: precomposed letters become their base
+// letters and combining marks are dropped, so "résumé" and "resume" compare equal.
+func foldAccents(s string) string {
+	if !strings.ContainsFunc(s, func(r rune) bool { return r >= 0x80 }) {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		if f, ok := accentFolds[r]; ok {
+			b.WriteString(f)
+		} else if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
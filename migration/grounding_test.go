@@ -0,0 +1,82 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVerifyTerms_DropsTagsAndTermsNotInChunks(t *testing.T) {
+	t.Parallel()
+
+	g := ChunkGrounding([]ChunkSummary{
+		{Summary: "They compared Arroios and Alvalade for a one-bedroom.", Tags: []string{"home_automation"}},
+		{KeyPoints: []string{"Get the NIF remotely first"}, Terms: []string{"D7 visa"}},
+	})
+	for s, want := range map[string]bool{
+		"Arroios":            true,
+		"one-bedroom":        true,
+		"Home Automation":    true,
+		"visas":              true,
+		"d7":                 true,
+		"nif":                true,
+		"bedrooms":           true,
+		"Lisbon":             false,
+		"fig":                false,
+		"arroios nightlife":  false,
+		"ai":                 false,
+		"???":                true,
+		"alvalade, arroios!": true,
+	} {
+		if got := g.Supports(s); got != want {
+			t.Fatalf("Supports(%q)=%v, want %v", s, got, want)
+		}
+	}
+
+	ts := ThreadSummary{Tags: []string{"housing", "visa", "lisbon"}, Terms: []string{"NIF", "Golden visa program"}}
+	flagged := ts
+	VerifyTerms(&flagged, g, VerifyTermsFlag)
+	if !reflect.DeepEqual(flagged.Tags, ts.Tags) || !reflect.DeepEqual(flagged.UnverifiedTags, []string{"housing", "lisbon"}) {
+		t.Fatalf("flag: tags=%v unverified=%v", flagged.Tags, flagged.UnverifiedTags)
+	}
+	VerifyTerms(&ts, g, "")
+	if !reflect.DeepEqual(ts.Tags, []string{"visa"}) || !reflect.DeepEqual(ts.Terms, []string{"NIF"}) ||
+		!reflect.DeepEqual(ts.UnverifiedTerms, []string{"Golden visa program"}) {
+		t.Fatalf("drop: %+v", ts)
+	}
+	if _, err := ParseVerifyTerms("strict"); err == nil {
+		t.Fatal("expected an error for an unknown mode")
+	}
+}
+
+func TestGrounding_UnspacedScriptsAndAccents(t *testing.T) {
+	t.Parallel()
+
+	g := NewGrounding("我们讨论了东京的签证问题。", "Met at the Café to go over my résumé, then lunch at a crêperie.", "東京で会議")
+	for s, want := range map[string]bool{
+		"东京":        true,
+		"签证":        true,
+		"东京 签证":     true,
+		"大阪":        false,
+		"会議":        true,
+		"cafe":      true,
+		"Resume":    true,
+		"crepe":     true,
+		"résumé":    true,
+		"Café 东京":   true,
+		"Cafe 大阪":   false,
+		"naïve":     false,
+		"Straße":    false,
+		"Lisbon 签证": false,
+	} {
+		if got := g.Supports(s); got != want {
+			t.Fatalf("Supports(%q)=%v, want %v", s, got, want)
+		}
+	}
+
+	if got, want := normalizeGroundingText("Straße Œuvre naïve"), "strasse oeuvre naive"; got != want {
+		t.Fatalf("normalize=%q, want %q", got, want)
+	}
+	if got, want := normalizeGroundingText("Café"), "cafe"; got != want {
+		t.Fatalf("normalize combining=%q, want %q", got, want)
+	}
+}
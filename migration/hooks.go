@@ -0,0 +1,33 @@
+package migration
+
+import "context"
+
+// Hook timing.
+const (
+	HookPre  = "pre"
+	HookPost = "post"
+)
+
+// HookEvent describes one pipeline stage invocation to an archive-pipeline -hook. Command hooks
+// receive it as JSON on stdin; plugin hooks receive it as an argument.
+type HookEvent struct {
+	Stage   string `json:"stage"`
+	When    string `json:"when"`
+	BaseDir string `json:"base_dir,omitempty"`
+	InPath  string `json:"in_path,omitempty"`
+	OutDir  string `json:"out_dir,omitempty"`
+
+	// Items lists files under OutDir created or modified by the stage (post hooks only), so a hook
+	// can post-process just the new artifacts.
+	Items []string `json:"items,omitempty"`
+
+	// Status and Error report the stage outcome (post hooks only).
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	Time string `json:"time"`
+}
+
+// HookFunc is the signature of a plugin hook. A Go plugin exports it as a function, built with
+// `go build -buildmode=plugin` against the same version of this module.
+type HookFunc = func(ctx context.Context, ev HookEvent) error
@@ -0,0 +1,157 @@
+// Package importers turns chat histories and notes exported from other platforms into the
+// SimplifiedConversation threads archive-splitter writes for ChatGPT exports, so they join the same
+// memory archive. Every human in an imported chat gets role "user" and is told apart by Speaker.
+package importers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+)
+
+// Import formats.
+const (
+	FormatWhatsApp = "whatsapp"
+	FormatTelegram = "telegram"
+	FormatMbox     = "mbox"
+	FormatMarkdown = "markdown"
+)
+
+// Formats lists the formats Import reads.
+var Formats = []string{FormatWhatsApp, FormatTelegram, FormatMbox, FormatMarkdown}
+
+// MediaOmittedContentType marks messages that stood for a photo, voice note, or other attachment
+// the thread does not carry; their Text names what was omitted.
+const MediaOmittedContentType = "media_omitted"
+
+// Options control how exports are read.
+type Options struct {
+	// Location is the time zone of timestamps the export writes without one (default time.Local).
+	Location *time.Location
+
+	// DateOrder is "dmy", "mdy" or "ymd" for exports whose numeric dates are ambiguous; empty detects
+	// it from the dates in the file.
+	DateOrder string
+}
+
+func (o Options) location() *time.Location {
+	if o.Location == nil {
+		return time.Local
+	}
+	return o.Location
+}
+
+// Import reads one export file in format into conversations.
+func Import(format, path string, opts Options) ([]migration.SimplifiedConversation, error) {
+	if _, ok := extensions[format]; !ok {
+		return nil, fmt.Errorf("unknown import format %q (want one of %s)", format, strings.Join(Formats, ", "))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("import %s: %w", format, err)
+	}
+	defer f.Close()
+	var convs []migration.SimplifiedConversation
+	switch format {
+	case FormatWhatsApp:
+		var conv migration.SimplifiedConversation
+		conv, err = ParseWhatsApp(f, path, opts)
+		convs = []migration.SimplifiedConversation{conv}
+	case FormatTelegram:
+		convs, err = ParseTelegram(f, path, opts)
+	case FormatMbox:
+		convs, err = ParseMbox(f, path, opts)
+	case FormatMarkdown:
+		convs, err = ParseMarkdownNote(f, path, opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("import %s %s: %w", format, path, err)
+	}
+	return convs, nil
+}
+
+// extensions are the file extensions Collect picks out of directories, by format.
+var extensions = map[string][]string{
+	FormatWhatsApp: {".txt"},
+	FormatTelegram: {".json"},
+	FormatMbox:     {".mbox", ".mbx", ".eml"},
+	FormatMarkdown: {".md", ".markdown"},
+}
+
+// recursive are the formats whose directories Collect searches through subdirectories, skipping
+// hidden ones (an Obsidian vault's .obsidian and .trash).
+var recursive = map[string]bool{FormatMarkdown: true}
+
+// Collect expands paths into the export files of format: files are kept as given, and directories
+// contribute their files with the format's extensions, sorted by path.
+func Collect(format string, paths []string) ([]string, error) {
+	exts, ok := extensions[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown import format %q (want one of %s)", format, strings.Join(Formats, ", "))
+	}
+	var out []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("stat export: %w", err)
+		}
+		if !info.IsDir() {
+			out = append(out, p)
+			continue
+		}
+		var found []string
+		err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != p && (!recursive[format] || strings.HasPrefix(d.Name(), ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			for _, ext := range exts {
+				if strings.EqualFold(filepath.Ext(d.Name()), ext) {
+					found = append(found, path)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("read export dir: %w", err)
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("no %s exports in %s", format, p)
+		}
+		sort.Strings(found)
+		out = append(out, found...)
+	}
+	return out, nil
+}
+
+// conversationID derives a stable ID from the format, the chat's name and its first message, so
+// re-importing a newer export of the same chat yields the same thread.
+func conversationID(format, title, first string) string {
+	sum := sha256.Sum256([]byte(title + "\n" + first))
+	return format + "-" + hex.EncodeToString(sum[:6])
+}
+
+// finish fills in the conversation fields every importer derives from its messages.
+func finish(conv *migration.SimplifiedConversation) {
+	if n := len(conv.Messages); n > 0 {
+		conv.CreateTime = conv.Messages[0].CreateTime
+		conv.UpdateTime = conv.Messages[n-1].CreateTime
+	}
+	conv.Participants = migration.MessageParticipants(conv.Messages)
+}
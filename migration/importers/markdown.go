@@ -0,0 +1,140 @@
+package importers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+)
+
+// NoteContentType marks the single message of a conversation imported from a markdown note.
+const NoteContentType = "note"
+
+// noteDateKeys are the front-matter keys read as a note's date, in order of preference.
+var noteDateKeys = []string{"date", "created", "creationdate", "created_at"}
+
+// noteDateLayouts are the front-matter date formats ParseMarkdownNote reads; those without a zone are
+// in Options.Location.
+var noteDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// noteFileDate matches a date in a note's file name: "2024-01-05", "2024_01_05", or "20240105".
+var noteFileDate = regexp.MustCompile(`(?:^|\D)((?:19|20)\d{2})[-_.]?(\d{2})[-_.]?(\d{2})(?:\D|$)`)
+
+// noteHeading matches a markdown heading line.
+var noteHeading = regexp.MustCompile(`^#{1,6}\s+(.+?)\s*#*\s*$`)
+
+// ParseMarkdownNote reads one markdown note (an Obsidian daily note, a Day One entry exported as
+// markdown) into a conversation with a single role "user" message holding the note's text. Notes
+// without text yield none.
+//
+// The note is dated by its front-matter (date, created, creationDate or created_at), else by a date
+// in its file name. Its title is the front-matter title, else its first heading, else its file name.
+// Its ID hashes the note's folder and file name, so re-importing an edited note replaces its thread.
+func ParseMarkdownNote(r io.Reader, name string, opts Options) ([]migration.SimplifiedConversation, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read note: %w", err)
+	}
+	meta, body := splitFrontMatter(strings.ReplaceAll(strings.TrimPrefix(string(b), "\ufeff"), "\r\n", "\n"))
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, nil
+	}
+
+	base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	created, err := noteDate(meta, base, opts.location())
+	if err != nil {
+		return nil, fmt.Errorf("note %s: %w", name, err)
+	}
+	title := strings.Trim(meta["title"], `"'`)
+	if title == "" {
+		title = firstHeading(body)
+	}
+	if title == "" {
+		title = base
+	}
+	conv := migration.SimplifiedConversation{
+		ConversationID: conversationID(FormatMarkdown, filepath.Base(filepath.Dir(name))+"/"+base, ""),
+		Title:          title,
+		Source:         name,
+		SourceType:     migration.SourceTypeJournal,
+		Messages:       []migration.SimplifiedMessage{{Role: "user", ContentType: NoteContentType, Text: body, CreateTime: created}},
+	}
+	finish(&conv)
+	return []migration.SimplifiedConversation{conv}, nil
+}
+
+// splitFrontMatter separates a leading "---" front-matter block from the note, reading its top-level
+// "key: value" lines (keys lowercased); nested values and lists are not needed and skipped.
+func splitFrontMatter(text string) (map[string]string, string) {
+	meta := map[string]string{}
+	if !strings.HasPrefix(text, "---\n") {
+		return meta, text
+	}
+	sc := bufio.NewScanner(strings.NewReader(text[len("---\n"):]))
+	offset := len("---\n")
+	for sc.Scan() {
+		line := sc.Text()
+		offset += len(line) + 1
+		if line == "---" || line == "..." {
+			if offset > len(text) {
+				offset = len(text)
+			}
+			return meta, text[offset:]
+		}
+		if line == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '-' || line[0] == '#' {
+			continue
+		}
+		if k, v, ok := strings.Cut(line, ":"); ok {
+			meta[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+		}
+	}
+	// No closing line: not front-matter after all.
+	return map[string]string{}, text
+}
+
+// noteDate is the note's time from its front-matter or, failing that, its file name; nil without one.
+func noteDate(meta map[string]string, base string, loc *time.Location) (*float64, error) {
+	for _, k := range noteDateKeys {
+		v := strings.Trim(meta[k], `"'`)
+		if v == "" {
+			continue
+		}
+		for _, layout := range noteDateLayouts {
+			if t, err := time.ParseInLocation(layout, v, loc); err == nil {
+				ts := float64(t.Unix())
+				return &ts, nil
+			}
+		}
+		return nil, fmt.Errorf("front-matter %s %q is not a date", k, v)
+	}
+	if m := noteFileDate.FindStringSubmatch(base); m != nil {
+		if t, err := time.ParseInLocation("2006-01-02", m[1]+"-"+m[2]+"-"+m[3], loc); err == nil {
+			ts := float64(t.Unix())
+			return &ts, nil
+		}
+	}
+	return nil, nil
+}
+
+// firstHeading is the text of the note's first markdown heading, or "".
+func firstHeading(body string) string {
+	for _, line := range strings.Split(body, "\n") {
+		if m := noteHeading.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package importers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMarkdownNote_DatesAndTitles(t *testing.T) {
+	t.Parallel()
+
+	vault := t.TempDir()
+	files := map[string]string{
+		"Daily/2024-01-05.md":       "# Friday\n\nLong walk, then wrote.\n",
+		"Ideas/garden.md":           "---\ntitle: \"Garden plan\"\ncreated: 2023-04-02T18:30\ntags:\n  - home\n---\n\nTomatoes by the fence.\n",
+		"Ideas/empty.md":            "---\ndate: 2023-01-01\n---\n\n",
+		".obsidian/workspace.md":    "not a note",
+		"Ideas/attachments/img.png": "png",
+	}
+	for name, body := range files {
+		p := filepath.Join(vault, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, err := Collect(FormatMarkdown, []string{vault})
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if len(paths) != 3 {
+		t.Fatalf("paths=%q", paths)
+	}
+	var titles []string
+	for _, p := range paths {
+		convs, err := Import(FormatMarkdown, p, Options{Location: time.UTC})
+		if err != nil {
+			t.Fatalf("Import %s: %v", p, err)
+		}
+		for _, c := range convs {
+			titles = append(titles, c.Title)
+			m := c.Messages[0]
+			switch c.Title {
+			case "Friday":
+				if *m.CreateTime != float64(time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC).Unix()) || m.Text != "# Friday\n\nLong walk, then wrote." {
+					t.Fatalf("daily note=%+v", m)
+				}
+			case "Garden plan":
+				if *c.CreateTime != float64(time.Date(2023, 4, 2, 18, 30, 0, 0, time.UTC).Unix()) || m.Text != "Tomatoes by the fence." || m.ContentType != NoteContentType {
+					t.Fatalf("front-matter note=%+v", m)
+				}
+			}
+			if !strings.HasPrefix(c.ConversationID, "markdown-") {
+				t.Fatalf("id=%q", c.ConversationID)
+			}
+		}
+	}
+	if strings.Join(titles, ",") != "Friday,Garden plan" {
+		t.Fatalf("titles=%q", titles)
+	}
+
+	if _, err := ParseMarkdownNote(strings.NewReader("---\ndate: someday\n---\ntext\n"), "x.md", Options{}); err == nil {
+		t.Fatalf("expected an error for an unparseable date")
+	}
+	convs, err := ParseMarkdownNote(strings.NewReader("---\nno closing line\n"), "Untitled.md", Options{})
+	if err != nil || convs[0].Title != "Untitled" || convs[0].CreateTime != nil {
+		t.Fatalf("convs=%+v err=%v", convs, err)
+	}
+}
@@ -0,0 +1,401 @@
+package importers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+)
+
+// mboxFromLine starts each message in an mbox file ("From sender@example.com Mon Jan  1 00:00:00 2024").
+var mboxFromLine = []byte("From ")
+
+// mboxMessage is one parsed email, before threading.
+type mboxMessage struct {
+	id      string
+	parents []string // In-Reply-To and References, nearest last
+	from    string
+	subject string
+	date    *time.Time
+	text    string
+}
+
+// ParseMbox reads an mbox archive into one conversation per email thread. Messages are threaded by
+// their References and In-Reply-To headers; a message naming none starts its own thread. Each
+// thread is titled with its first subject (without Re:/Fwd: prefixes) and ordered by Date.
+//
+// Bodies are reduced to what the sender wrote: the text/plain part (or text/html with tags removed),
+// without quoted lines, the "On … wrote:" line above them, forwarded or "Original Message" tails,
+// and signatures after the "-- " delimiter. Attachments are named in brackets. Every sender is a
+// role "user" speaker, named by display name or address.
+func ParseMbox(r io.Reader, name string, opts Options) ([]migration.SimplifiedConversation, error) {
+	raw, err := splitMbox(r)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []*mboxMessage
+	for i, b := range raw {
+		m, err := parseMboxMessage(b, opts.location())
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", i+1, err)
+		}
+		if m.id == "" {
+			m.id = fmt.Sprintf("%s#%d", name, i+1)
+		}
+		msgs = append(msgs, m)
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("no messages found; is this an mbox file?")
+	}
+
+	threads := threadMbox(msgs)
+	out := make([]migration.SimplifiedConversation, 0, len(threads))
+	for _, thread := range threads {
+		conv := migration.SimplifiedConversation{
+			ConversationID: conversationID(FormatMbox, thread[0].id, ""),
+			Title:          mboxSubject(thread),
+			Source:         name,
+			SourceType:     migration.SourceTypeEmail,
+		}
+		for _, m := range thread {
+			sm := migration.SimplifiedMessage{Role: "user", Speaker: m.from, Text: m.text}
+			if m.date != nil {
+				created := float64(m.date.Unix())
+				sm.CreateTime = &created
+			}
+			if sm.Text != "" {
+				conv.Messages = append(conv.Messages, sm)
+			}
+		}
+		if len(conv.Messages) == 0 {
+			continue
+		}
+		finish(&conv)
+		out = append(out, conv)
+	}
+	return out, nil
+}
+
+// splitMbox splits an mbox file into its messages, undoing the ">From " quoting of body lines. A file
+// that does not start with a "From " line is read as a single message, as an .eml file is.
+func splitMbox(r io.Reader) ([][]byte, error) {
+	var (
+		msgs []*bytes.Buffer
+		prev = true // the file start counts as a blank line
+		br   = bufio.NewReader(r)
+	)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			blank := len(bytes.TrimRight(line, "\r\n")) == 0
+			switch {
+			case prev && bytes.HasPrefix(line, mboxFromLine):
+				msgs = append(msgs, &bytes.Buffer{})
+			case len(msgs) == 0 && blank:
+			default:
+				if len(msgs) == 0 {
+					msgs = append(msgs, &bytes.Buffer{})
+				}
+				if unquoted := bytes.TrimLeft(line, ">"); len(unquoted) < len(line) && bytes.HasPrefix(unquoted, mboxFromLine) {
+					line = line[1:]
+				}
+				msgs[len(msgs)-1].Write(line)
+			}
+			prev = blank
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read mbox: %w", err)
+		}
+	}
+	out := make([][]byte, len(msgs))
+	for i, m := range msgs {
+		out[i] = m.Bytes()
+	}
+	return out, nil
+}
+
+func parseMboxMessage(b []byte, loc *time.Location) (*mboxMessage, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	var dec mime.WordDecoder
+	decode := func(h string) string {
+		v := msg.Header.Get(h)
+		if d, err := dec.DecodeHeader(v); err == nil {
+			v = d
+		}
+		return strings.TrimSpace(v)
+	}
+	m := &mboxMessage{
+		id:      messageID(msg.Header.Get("Message-Id")),
+		subject: decode("Subject"),
+		from:    decode("From"),
+	}
+	if addr, err := mail.ParseAddress(m.from); err == nil {
+		m.from = addr.Name
+		if m.from == "" {
+			m.from = addr.Address
+		}
+	}
+	for _, id := range strings.Fields(msg.Header.Get("References")) {
+		m.parents = append(m.parents, messageID(id))
+	}
+	if id := messageID(msg.Header.Get("In-Reply-To")); id != "" {
+		m.parents = append(m.parents, id)
+	}
+	if t, err := mail.ParseDate(msg.Header.Get("Date")); err == nil {
+		t = t.In(loc)
+		m.date = &t
+	}
+	text, attachments, err := mailBody(msg.Header, msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.text = strings.Join(nonEmpty(stripReply(text), strings.Join(attachments, "\n")), "\n")
+	return m, nil
+}
+
+// mimeHeader is what mailBody reads of a message's or a part's header.
+type mimeHeader interface{ Get(string) string }
+
+// mailBody returns the text of a message or part and the bracketed names of its attachments. A
+// multipart/alternative body prefers text/plain; other multiparts concatenate their text parts.
+func mailBody(h mimeHeader, body io.Reader) (string, []string, error) {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	if name := attachmentName(h, params); name != "" {
+		return "", []string{"[attachment: " + name + "]"}, nil
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		var texts, htmls, attachments []string
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", nil, fmt.Errorf("read multipart: %w", err)
+			}
+			text, att, err := mailBody(p.Header, p)
+			if err != nil {
+				return "", nil, err
+			}
+			attachments = append(attachments, att...)
+			switch ct, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type")); {
+			case text == "":
+			case ct == "text/html":
+				htmls = append(htmls, text)
+			default:
+				texts = append(texts, text)
+			}
+		}
+		if len(texts) == 0 {
+			texts = htmls
+		}
+		if mediaType == "multipart/alternative" && len(texts) > 1 {
+			texts = texts[:1]
+		}
+		return strings.Join(texts, "\n\n"), attachments, nil
+	}
+	if !strings.HasPrefix(mediaType, "text/") {
+		return "", []string{"[attachment: " + mediaType + "]"}, nil
+	}
+
+	switch strings.ToLower(h.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, base64Reader{body})
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return "", nil, fmt.Errorf("read body: %w", err)
+	}
+	text := decodeCharset(b, params["charset"])
+	if mediaType == "text/html" {
+		text = htmlText(text)
+	}
+	return strings.ReplaceAll(text, "\r\n", "\n"), nil, nil
+}
+
+// attachmentName is the file name of a part sent as an attachment, or "".
+func attachmentName(h mimeHeader, params map[string]string) string {
+	disposition, dparams, err := mime.ParseMediaType(h.Get("Content-Disposition"))
+	if err != nil || disposition != "attachment" {
+		return ""
+	}
+	for _, name := range []string{dparams["filename"], params["name"]} {
+		if name != "" {
+			return name
+		}
+	}
+	return "unnamed"
+}
+
+// base64Reader drops the line breaks of a base64 body, which base64.NewDecoder does not skip.
+type base64Reader struct{ r io.Reader }
+
+func (b base64Reader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	out := p[:0]
+	for _, c := range p[:n] {
+		if c != '\r' && c != '\n' && c != ' ' {
+			out = append(out, c)
+		}
+	}
+	return len(out), err
+}
+
+// decodeCharset converts Latin-1 bodies to UTF-8; UTF-8 and ASCII bodies are kept as they are.
+func decodeCharset(b []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252":
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		return string(r)
+	}
+	return string(b)
+}
+
+var (
+	htmlBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>`)
+	htmlTags   = regexp.MustCompile(`(?s)<style.*?</style>|<script.*?</script>|<[^>]+>`)
+	blankRuns  = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlText reduces an HTML body to its text, keeping paragraph breaks.
+func htmlText(s string) string {
+	s = htmlBreaks.ReplaceAllString(s, "\n")
+	s = htmlTags.ReplaceAllString(s, "")
+	return blankRuns.ReplaceAllString(html.UnescapeString(s), "\n\n")
+}
+
+var (
+	// replyAttribution is the line mail clients put above a quoted message: "On Mon, 1 Jan 2024,
+	// Alice <a@example.com> wrote:" and its translations ("Am … schrieb …:", "Le … a écrit :").
+	replyAttribution = regexp.MustCompile(`(?i)^(on|am|le|el|il|op)\s.*(wrote|schrieb|a écrit|escribió|ha scritto|schreef)\s*:\s*$`)
+	// forwardedTail starts the copy of an earlier message that Outlook-style replies and forwards append.
+	forwardedTail = regexp.MustCompile(`(?i)^\s*-{2,}\s*(original message|forwarded message|ursprüngliche nachricht|message d'origine)\s*-{2,}\s*$`)
+)
+
+// stripReply keeps the text a sender wrote: quoted lines, the attribution above them, an appended
+// earlier message, and the signature are dropped.
+func stripReply(text string) string {
+	lines := strings.Split(text, "\n")
+	var kept []string
+	for _, line := range lines {
+		trimmed := strings.TrimRight(line, " \t\r")
+		if trimmed == "--" || forwardedTail.MatchString(trimmed) {
+			break
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), ">") {
+			if n := len(kept); n > 0 && replyAttribution.MatchString(strings.TrimSpace(kept[n-1])) {
+				kept = kept[:n-1]
+			}
+			continue
+		}
+		kept = append(kept, trimmed)
+	}
+	out := strings.TrimSpace(strings.Join(kept, "\n"))
+	if lines := strings.Split(out, "\n"); len(lines) > 0 && replyAttribution.MatchString(strings.TrimSpace(lines[len(lines)-1])) {
+		out = strings.TrimSpace(strings.Join(lines[:len(lines)-1], "\n"))
+	}
+	return blankRuns.ReplaceAllString(out, "\n\n")
+}
+
+// threadMbox groups messages into threads linked by their Message-IDs, each ordered by date and
+// the threads by their first message.
+func threadMbox(msgs []*mboxMessage) [][]*mboxMessage {
+	parent := make(map[string]string)
+	var find func(string) string
+	find = func(id string) string {
+		for parent[id] != "" && parent[id] != id {
+			id = parent[id]
+		}
+		return id
+	}
+	union := func(a, b string) {
+		if ra, rb := find(a), find(b); ra != rb {
+			parent[rb] = ra
+		}
+	}
+	for _, m := range msgs {
+		for _, p := range m.parents {
+			union(p, m.id)
+		}
+	}
+	byRoot := make(map[string][]*mboxMessage)
+	var roots []string
+	for _, m := range msgs {
+		root := find(m.id)
+		if _, ok := byRoot[root]; !ok {
+			roots = append(roots, root)
+		}
+		byRoot[root] = append(byRoot[root], m)
+	}
+	out := make([][]*mboxMessage, 0, len(roots))
+	for _, root := range roots {
+		thread := byRoot[root]
+		sort.SliceStable(thread, func(i, j int) bool { return mboxBefore(thread[i], thread[j]) })
+		out = append(out, thread)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return mboxBefore(out[i][0], out[j][0]) })
+	return out
+}
+
+// mboxBefore orders messages by date, undated ones first.
+func mboxBefore(a, b *mboxMessage) bool {
+	switch {
+	case a.date == nil:
+		return b.date != nil
+	case b.date == nil:
+		return false
+	}
+	return a.date.Before(*b.date)
+}
+
+// subjectPrefix matches the reply and forward markers clients stack on a subject.
+var subjectPrefix = regexp.MustCompile(`(?i)^\s*((re|fwd?|aw|wg|tr|sv)(\[\d+\])?\s*:\s*)+`)
+
+// mboxSubject is the thread's first subject without reply and forward prefixes.
+func mboxSubject(thread []*mboxMessage) string {
+	for _, m := range thread {
+		if s := strings.TrimSpace(subjectPrefix.ReplaceAllString(m.subject, "")); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// messageID normalizes a Message-ID header value to the ID between its angle brackets.
+func messageID(v string) string {
+	v = strings.TrimSpace(v)
+	if i := strings.Index(v, "<"); i >= 0 {
+		if j := strings.Index(v[i:], ">"); j > 0 {
+			return v[i+1 : i+j]
+		}
+	}
+	return v
+}
@@ -0,0 +1,103 @@
+package importers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+)
+
+func TestParseMbox_ThreadsAndStripsReplies(t *testing.T) {
+	t.Parallel()
+
+	mbox := strings.Join([]string{
+		"From alice@example.com Mon Jan  4 09:00:00 2021",
+		"Message-ID: <1@example.com>",
+		"From: Alice <alice@example.com>",
+		"Subject: Trip plans",
+		"Date: Mon, 4 Jan 2021 09:00:00 +0000",
+		"",
+		"Shall we go in May?",
+		">From the guide: May is quiet.",
+		"",
+		"-- ",
+		"Alice",
+		"",
+		"From bob@example.com Mon Jan  4 10:00:00 2021",
+		"Message-ID: <2@example.com>",
+		"In-Reply-To: <1@example.com>",
+		"References: <1@example.com>",
+		"From: =?UTF-8?Q?Bj=C3=B6rn?= <bob@example.com>",
+		"Subject: Re: Trip plans",
+		"Date: Mon, 4 Jan 2021 10:00:00 +0000",
+		"Content-Type: multipart/mixed; boundary=XX",
+		"",
+		"--XX",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: quoted-printable",
+		"",
+		"May works. Caf=C3=A9 first?",
+		"",
+		"On Mon, 4 Jan 2021, Alice <alice@example.com> wrote:",
+		"> Shall we go in May?",
+		"--XX",
+		"Content-Type: application/pdf",
+		"Content-Disposition: attachment; filename=\"map.pdf\"",
+		"Content-Transfer-Encoding: base64",
+		"",
+		"JVBERi0=",
+		"--XX--",
+		"",
+		"From carol@example.com Tue Jan  5 08:00:00 2021",
+		"Message-ID: <3@example.com>",
+		"From: carol@example.com",
+		"Subject: Invoice",
+		"Date: Tue, 5 Jan 2021 08:00:00 +0000",
+		"Content-Type: text/html",
+		"",
+		"<p>Paid &amp; done</p>",
+		"-----Original Message-----",
+		"<p>Please pay</p>",
+		"",
+	}, "\n")
+	convs, err := ParseMbox(strings.NewReader(mbox), "mail.mbox", Options{Location: time.UTC})
+	if err != nil {
+		t.Fatalf("ParseMbox: %v", err)
+	}
+	if len(convs) != 2 {
+		t.Fatalf("threads=%+v", convs)
+	}
+	trip := convs[0]
+	if trip.Title != "Trip plans" || !strings.HasPrefix(trip.ConversationID, "mbox-") || trip.SourceType != migration.SourceTypeEmail || len(trip.Messages) != 2 {
+		t.Fatalf("trip=%+v", trip)
+	}
+	if m := trip.Messages[0]; m.Speaker != "Alice" || m.Text != "Shall we go in May?\nFrom the guide: May is quiet." {
+		t.Fatalf("first=%+v", m)
+	}
+	if m := trip.Messages[1]; m.Speaker != "Björn" || m.Text != "May works. Café first?\n[attachment: map.pdf]" {
+		t.Fatalf("reply=%q", m.Text)
+	}
+	if *trip.UpdateTime != float64(time.Date(2021, 1, 4, 10, 0, 0, 0, time.UTC).Unix()) {
+		t.Fatalf("update=%v", *trip.UpdateTime)
+	}
+	if m := convs[1].Messages[0]; m.Speaker != "carol@example.com" || m.Text != "Paid & done" {
+		t.Fatalf("html=%+v", m)
+	}
+}
+
+func TestParseMbox_SingleMessageAndSubjects(t *testing.T) {
+	t.Parallel()
+
+	eml := "From: Dan <dan@example.com>\nSubject: AW: Re: Fwd: Notes\n\nHello\n"
+	convs, err := ParseMbox(strings.NewReader(eml), "note.eml", Options{})
+	if err != nil {
+		t.Fatalf("ParseMbox: %v", err)
+	}
+	if len(convs) != 1 || convs[0].Title != "Notes" || convs[0].Messages[0].Text != "Hello" {
+		t.Fatalf("convs=%+v", convs)
+	}
+	if _, err := ParseMbox(strings.NewReader("\n\n"), "empty.mbox", Options{}); err == nil {
+		t.Fatalf("expected an error for an empty mbox")
+	}
+}
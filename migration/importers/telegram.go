@@ -0,0 +1,259 @@
+package importers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+)
+
+// TelegramServiceContentType marks Telegram service messages (members joining, calls, pinned
+// messages), imported as role "system" messages attributed to their actor.
+const TelegramServiceContentType = "service"
+
+// telegramReplyExcerptChars bounds the quoted text of the message a reply answers.
+const telegramReplyExcerptChars = 80
+
+// telegramExport is Telegram Desktop's result.json: either a full export with every chat under
+// chats.list (and left_chats.list), or a single chat's export.
+type telegramExport struct {
+	PersonalInformation struct {
+		UserID json.Number `json:"user_id"`
+	} `json:"personal_information"`
+	Chats     telegramChatList `json:"chats"`
+	LeftChats telegramChatList `json:"left_chats"`
+
+	telegramChat
+}
+
+type telegramChatList struct {
+	List []telegramChat `json:"list"`
+}
+
+type telegramChat struct {
+	ID       json.Number       `json:"id"`
+	Name     string            `json:"name"`
+	Type     string            `json:"type"`
+	Messages []telegramMessage `json:"messages"`
+}
+
+type telegramMessage struct {
+	ID            json.Number     `json:"id"`
+	Type          string          `json:"type"`
+	Date          string          `json:"date"`
+	DateUnix      string          `json:"date_unixtime"`
+	From          string          `json:"from"`
+	FromID        string          `json:"from_id"`
+	Actor         string          `json:"actor"`
+	ActorID       string          `json:"actor_id"`
+	Action        string          `json:"action"`
+	Text          json.RawMessage `json:"text"`
+	ReplyTo       json.Number     `json:"reply_to_message_id"`
+	ForwardedFrom string          `json:"forwarded_from"`
+	Photo         string          `json:"photo"`
+	File          string          `json:"file"`
+	MediaType     string          `json:"media_type"`
+	StickerEmoji  string          `json:"sticker_emoji"`
+	Title         string          `json:"title"`
+	Members       []string        `json:"members"`
+	Duration      int             `json:"duration_seconds"`
+}
+
+// ParseTelegram reads a Telegram Desktop JSON export (result.json) into one conversation per chat,
+// skipping chats without messages. Conversation IDs are telegram-<chat id>, so re-importing a newer
+// export replaces each chat's thread.
+//
+// Messages become role "user" messages attributed to their sender; in chats with a bot, the bot's
+// messages are role "assistant". Replies start with a short quote of the message they answer,
+// forwarded messages name their origin, and media is described in brackets ("[photo]", "[voice
+// message]"). Service messages become role "system" messages with TelegramServiceContentType.
+func ParseTelegram(r io.Reader, name string, opts Options) ([]migration.SimplifiedConversation, error) {
+	var export telegramExport
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&export); err != nil {
+		return nil, fmt.Errorf("decode telegram export: %w", err)
+	}
+	chats := append(export.Chats.List, export.LeftChats.List...)
+	if len(chats) == 0 && export.Messages != nil {
+		chats = []telegramChat{export.telegramChat}
+	}
+	if len(chats) == 0 {
+		return nil, errors.New("no chats found; is this a Telegram result.json?")
+	}
+	self := "user" + export.PersonalInformation.UserID.String()
+
+	var out []migration.SimplifiedConversation
+	for _, chat := range chats {
+		conv, err := telegramConversation(chat, self, name, opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(conv.Messages) > 0 {
+			out = append(out, conv)
+		}
+	}
+	return out, nil
+}
+
+func telegramConversation(chat telegramChat, self, name string, opts Options) (migration.SimplifiedConversation, error) {
+	conv := migration.SimplifiedConversation{
+		ConversationID: FormatTelegram + "-" + chat.ID.String(),
+		Title:          chat.Name,
+		Source:         name,
+		SourceType:     migration.SourceTypeTelegram,
+	}
+	if chat.ID == "" {
+		conv.ConversationID = conversationID(FormatTelegram, chat.Name, chat.Type)
+	}
+	if conv.Title == "" && chat.Type == "saved_messages" {
+		conv.Title = "Saved Messages"
+	}
+	type quoted struct{ speaker, text string }
+	byID := make(map[string]quoted, len(chat.Messages))
+	for _, m := range chat.Messages {
+		created, err := m.time(opts.location())
+		if err != nil {
+			return conv, fmt.Errorf("chat %s message %s: %w", chat.ID, m.ID, err)
+		}
+		var sm migration.SimplifiedMessage
+		if m.Type == "service" {
+			sm = migration.SimplifiedMessage{Role: "system", Speaker: m.Actor, ContentType: TelegramServiceContentType, Text: m.serviceText()}
+		} else {
+			sm = migration.SimplifiedMessage{Role: "user", Speaker: m.From}
+			if sm.Speaker == "" {
+				sm.Speaker = m.FromID
+			}
+			if chat.Type == "bot_chat" && m.FromID != self {
+				sm.Role = "assistant"
+			}
+			text := telegramText(m.Text)
+			byID[m.ID.String()] = quoted{sm.Speaker, text}
+			var prefix []string
+			if q, ok := byID[m.ReplyTo.String()]; m.ReplyTo != "" && ok {
+				prefix = append(prefix, fmt.Sprintf("[reply to %s: %q]", q.speaker, excerpt(q.text, telegramReplyExcerptChars)))
+			}
+			if m.ForwardedFrom != "" {
+				prefix = append(prefix, "[forwarded from "+m.ForwardedFrom+"]")
+			}
+			media := m.mediaText()
+			if text == "" && media != "" {
+				sm.ContentType = MediaOmittedContentType
+			}
+			sm.Text = strings.Join(append(prefix, nonEmpty(media, text)...), "\n")
+		}
+		if strings.TrimSpace(sm.Text) == "" {
+			continue
+		}
+		sm.CreateTime = &created
+		conv.Messages = append(conv.Messages, sm)
+	}
+	finish(&conv)
+	return conv, nil
+}
+
+// time is the message's Unix time: date_unixtime when the export has it, else its local date.
+func (m telegramMessage) time(loc *time.Location) (float64, error) {
+	if m.DateUnix != "" {
+		n, err := strconv.ParseInt(m.DateUnix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("date_unixtime %q: %w", m.DateUnix, err)
+		}
+		return float64(n), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02T15:04:05", m.Date, loc)
+	if err != nil {
+		return 0, fmt.Errorf("date %q: %w", m.Date, err)
+	}
+	return float64(t.Unix()), nil
+}
+
+// serviceText describes a service message: its action, then whatever the export gives it to act on.
+func (m telegramMessage) serviceText() string {
+	parts := []string{strings.ReplaceAll(m.Action, "_", " ")}
+	if m.Title != "" {
+		parts = append(parts, fmt.Sprintf("%q", m.Title))
+	}
+	if len(m.Members) > 0 {
+		parts = append(parts, strings.Join(m.Members, ", "))
+	}
+	if m.Duration > 0 {
+		parts = append(parts, fmt.Sprintf("(%ds)", m.Duration))
+	}
+	if text := telegramText(m.Text); text != "" {
+		parts = append(parts, text)
+	}
+	return strings.TrimSpace(strings.Join(parts, " "))
+}
+
+// mediaText describes a message's attachment in brackets, or is "" without one.
+func (m telegramMessage) mediaText() string {
+	switch {
+	case m.MediaType == "sticker" && m.StickerEmoji != "":
+		return "[sticker " + m.StickerEmoji + "]"
+	case m.MediaType != "":
+		return "[" + strings.ReplaceAll(m.MediaType, "_", " ") + "]"
+	case m.Photo != "":
+		return "[photo]"
+	case m.File != "":
+		return "[file]"
+	}
+	return ""
+}
+
+// telegramText flattens a message's text, which the export writes as a string or as a list of strings
+// and formatted entities; links keep their target.
+func telegramText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return strings.TrimSpace(s)
+	}
+	var parts []json.RawMessage
+	if json.Unmarshal(raw, &parts) != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, p := range parts {
+		var entity struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+			Href string `json:"href"`
+		}
+		if json.Unmarshal(p, &s) == nil {
+			b.WriteString(s)
+		} else if json.Unmarshal(p, &entity) == nil {
+			b.WriteString(entity.Text)
+			if entity.Href != "" && entity.Href != entity.Text {
+				b.WriteString(" (" + entity.Href + ")")
+			}
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// excerpt is text on one line, cut to at most n runes.
+func excerpt(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if r := []rune(text); len(r) > n {
+		return strings.TrimSpace(string(r[:n])) + "…"
+	}
+	return text
+}
+
+func nonEmpty(values ...string) []string {
+	var out []string
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package importers
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTelegram_FullExport(t *testing.T) {
+	t.Parallel()
+
+	export := `{
+  "personal_information": {"user_id": 42, "first_name": "Me"},
+  "chats": {"list": [
+    {"name": "Book club", "type": "private_group", "id": 7, "messages": [
+      {"id": 1, "type": "service", "date": "2021-05-01T10:00:00", "date_unixtime": "1619863200", "actor": "Ann", "actor_id": "user1", "action": "invite_members", "members": ["Me"], "text": ""},
+      {"id": 2, "type": "message", "date": "2021-05-01T10:01:00", "date_unixtime": "1619863260", "from": "Ann", "from_id": "user1", "text": ["Read ", {"type": "bold", "text": "this"}, " ", {"type": "text_link", "text": "review", "href": "https://example.com/r"}]},
+      {"id": 3, "type": "message", "date": "2021-05-01T10:02:00", "date_unixtime": "1619863320", "from": "Me", "from_id": "user42", "reply_to_message_id": 2, "text": "Will do"},
+      {"id": 4, "type": "message", "date": "2021-05-01T10:03:00", "date_unixtime": "1619863380", "from": "Ann", "from_id": "user1", "forwarded_from": "Bob", "photo": "photos/photo_1.jpg", "text": ""}
+    ]},
+    {"name": "HelperBot", "type": "bot_chat", "id": 9, "messages": [
+      {"id": 1, "type": "message", "date": "2021-06-01T08:00:00", "from": "Me", "from_id": "user42", "text": "/start"},
+      {"id": 2, "type": "message", "date": "2021-06-01T08:00:05", "from": "HelperBot", "from_id": "user9", "media_type": "voice_message", "text": ""}
+    ]},
+    {"name": "Empty", "type": "personal_chat", "id": 10, "messages": []}
+  ]}
+}`
+	convs, err := ParseTelegram(strings.NewReader(export), "result.json", Options{Location: time.UTC})
+	if err != nil {
+		t.Fatalf("ParseTelegram: %v", err)
+	}
+	if len(convs) != 2 || convs[0].ConversationID != "telegram-7" || convs[0].Title != "Book club" {
+		t.Fatalf("convs=%+v", convs)
+	}
+	msgs := convs[0].Messages
+	if len(msgs) != 4 {
+		t.Fatalf("messages=%+v", msgs)
+	}
+	if m := msgs[0]; m.Role != "system" || m.ContentType != TelegramServiceContentType || m.Speaker != "Ann" || m.Text != "invite members Me" {
+		t.Fatalf("service=%+v", m)
+	}
+	if m := msgs[1]; m.Text != "Read this review (https://example.com/r)" || *m.CreateTime != 1619863260 {
+		t.Fatalf("entities=%+v", m)
+	}
+	if m := msgs[2]; m.Text != "[reply to Ann: \"Read this review (https://example.com/r)\"]\nWill do" {
+		t.Fatalf("reply=%q", m.Text)
+	}
+	if m := msgs[3]; m.Text != "[forwarded from Bob]\n[photo]" || m.ContentType != MediaOmittedContentType {
+		t.Fatalf("forward=%+v", m)
+	}
+
+	bot := convs[1].Messages
+	if bot[0].Role != "user" || bot[1].Role != "assistant" || bot[1].Text != "[voice message]" {
+		t.Fatalf("bot chat=%+v", bot)
+	}
+	if *bot[0].CreateTime != float64(time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC).Unix()) {
+		t.Fatalf("local date=%v", *bot[0].CreateTime)
+	}
+}
+
+func TestParseTelegram_SingleChatExport(t *testing.T) {
+	t.Parallel()
+
+	convs, err := ParseTelegram(strings.NewReader(`{"name": "Ann", "type": "personal_chat", "id": 5, "messages": [
+  {"id": 1, "type": "message", "date": "2021-05-01T10:01:00", "date_unixtime": "1619863260", "from": "Ann", "from_id": "user1", "text": "hi"}
+]}`), "result.json", Options{})
+	if err != nil {
+		t.Fatalf("ParseTelegram: %v", err)
+	}
+	if len(convs) != 1 || convs[0].ConversationID != "telegram-5" || len(convs[0].Participants) != 1 {
+		t.Fatalf("convs=%+v", convs)
+	}
+	if _, err := ParseTelegram(strings.NewReader(`{"about": "x"}`), "result.json", Options{}); err == nil {
+		t.Fatalf("expected an error for an export without chats")
+	}
+}
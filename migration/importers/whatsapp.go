@@ -0,0 +1,237 @@
+package importers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+)
+
+// whatsAppLine matches the start of a message in a WhatsApp .txt export, in the layouts the apps
+// write across locales:
+//
+//	12/31/20, 9:41 PM - Alice: text          (Android, US)
+//	31.12.20, 21:41 - Alice: text            (Android, German)
+//	[31/12/2020, 21:41:05] Alice: text       (iOS)
+//	[2020-12-31, 9:41:05 p. m.] Alice: text  (iOS, ISO dates, Spanish day periods)
+//
+// Lines that do not match continue the previous message.
+var whatsAppLine = regexp.MustCompile(`^\[?(\d{1,4})[./-](\d{1,2})[./-](\d{1,4}),?\s+(\d{1,2})[:.](\d{2})(?:[:.](\d{2}))?(?:\s*([AaPp])\.?\s?[Mm]\.?)?\]?(?:\s+-)?\s+(.*)$`)
+
+// whatsAppMediaOmitted are the whole-message placeholders exports write for left-out media, per locale.
+var whatsAppMediaOmitted = map[string]bool{
+	"<media omitted>":         true,
+	"<medien ausgeschlossen>": true,
+	"<multimedia omitido>":    true,
+	"<médias omis>":           true,
+	"<media omessi>":          true,
+	"<mídia oculta>":          true,
+	"<media weggelaten>":      true,
+}
+
+// whatsAppOmitted matches iOS placeholders such as "image omitted" or "report.pdf • 3 pages document omitted".
+var whatsAppOmitted = regexp.MustCompile(`(?i)^(?:.*\s)?(image|video|audio|sticker|gif|document|contact card) omitted$`)
+
+// whatsAppAttached matches iOS placeholders for attachments kept beside the export: "<attached: 00000012-PHOTO.jpg>".
+var whatsAppAttached = regexp.MustCompile(`^<attached: ([^<>]+)>$`)
+
+// whatsAppEdited is the marker exports append to edited messages.
+const whatsAppEdited = "<This message was edited>"
+
+type whatsAppMessage struct {
+	date    [3]int
+	clock   [3]int
+	period  string // "a", "p", or "" for a 24-hour clock
+	speaker string
+	text    []string
+}
+
+// ParseWhatsApp reads a WhatsApp "Export chat" .txt file (without media) into one conversation. name
+// is the export's file name, which gives the chat its title ("WhatsApp Chat with Alice.txt"; iOS
+// exports name the file _chat.txt inside a folder named after the chat).
+//
+// Numeric dates are read in opts.DateOrder, or in the order the file's dates allow: a first field
+// above 12 means day first, a second field above 12 month first, and otherwise 12-hour times suggest
+// month first. System notices (encryption banners, members joining) are dropped.
+func ParseWhatsApp(r io.Reader, name string, opts Options) (migration.SimplifiedConversation, error) {
+	var (
+		msgs []*whatsAppMessage
+		sc   = bufio.NewScanner(r)
+	)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for first := true; sc.Scan(); first = false {
+		line := normalizeWhatsAppLine(sc.Text(), first)
+		m := whatsAppLine.FindStringSubmatch(line)
+		if m == nil {
+			if len(msgs) > 0 {
+				last := msgs[len(msgs)-1]
+				last.text = append(last.text, line)
+			}
+			continue
+		}
+		speaker, text, ok := strings.Cut(m[8], ": ")
+		if !ok || strings.TrimSpace(speaker) == "" {
+			// A notice without a sender; a continuation line of it must not join the previous message.
+			msgs = append(msgs, &whatsAppMessage{})
+			continue
+		}
+		msg := &whatsAppMessage{speaker: strings.TrimSpace(speaker), text: []string{text}, period: strings.ToLower(m[7])}
+		for i := 0; i < 3; i++ {
+			msg.date[i] = atoi(m[1+i])
+			msg.clock[i] = atoi(m[4+i])
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := sc.Err(); err != nil {
+		return migration.SimplifiedConversation{}, fmt.Errorf("read whatsapp export: %w", err)
+	}
+
+	order, err := whatsAppDateOrder(msgs, opts.DateOrder)
+	if err != nil {
+		return migration.SimplifiedConversation{}, err
+	}
+	title := whatsAppTitle(name)
+	conv := migration.SimplifiedConversation{Title: title, Source: name, SourceType: migration.SourceTypeWhatsApp}
+	var firstKey string
+	for _, msg := range msgs {
+		if msg.speaker == "" {
+			continue
+		}
+		ts, err := msg.time(order, opts.location())
+		if err != nil {
+			return migration.SimplifiedConversation{}, err
+		}
+		if firstKey == "" {
+			firstKey = fmt.Sprintf("%d %s", ts, msg.speaker)
+		}
+		created := float64(ts)
+		sm := migration.SimplifiedMessage{Role: "user", Speaker: msg.speaker, CreateTime: &created}
+		sm.ContentType, sm.Text = whatsAppText(msg.text)
+		conv.Messages = append(conv.Messages, sm)
+	}
+	if len(conv.Messages) == 0 {
+		return migration.SimplifiedConversation{}, errors.New("no messages found; is this a WhatsApp chat export?")
+	}
+	conv.ConversationID = conversationID(FormatWhatsApp, title, firstKey)
+	finish(&conv)
+	return conv, nil
+}
+
+// normalizeWhatsAppLine drops the byte order mark and direction marks exports sprinkle through lines,
+// and turns the narrow no-break spaces some locales put before AM/PM into plain spaces.
+func normalizeWhatsAppLine(line string, first bool) string {
+	if first {
+		line = strings.TrimPrefix(line, "\ufeff")
+	}
+	return strings.NewReplacer("\u200e", "", "\u200f", "", "\u202f", " ", "\u00a0", " ").Replace(line)
+}
+
+// whatsAppText is a message's content type and text: media placeholders become MediaOmittedContentType
+// with a bracketed description, and the edited marker is dropped.
+func whatsAppText(lines []string) (string, string) {
+	text := strings.TrimSpace(strings.Join(lines, "\n"))
+	text = strings.TrimSpace(strings.TrimSuffix(text, whatsAppEdited))
+	if strings.Contains(text, "\n") {
+		return "", text
+	}
+	switch {
+	case whatsAppMediaOmitted[strings.ToLower(text)]:
+		return MediaOmittedContentType, "[media omitted]"
+	case whatsAppOmitted.MatchString(text):
+		return MediaOmittedContentType, "[" + strings.ToLower(whatsAppOmitted.FindStringSubmatch(text)[1]) + " omitted]"
+	case whatsAppAttached.MatchString(text):
+		return MediaOmittedContentType, "[attached: " + whatsAppAttached.FindStringSubmatch(text)[1] + "]"
+	}
+	return "", text
+}
+
+// whatsAppDateOrder returns the order of the numeric date fields: order when it is set, else the
+// order the dates allow.
+func whatsAppDateOrder(msgs []*whatsAppMessage, order string) (string, error) {
+	switch order {
+	case "dmy", "mdy", "ymd":
+		return order, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown date order %q (want dmy, mdy or ymd)", order)
+	}
+	var dayFirst, monthFirst, twelveHour bool
+	for _, m := range msgs {
+		if m.speaker == "" {
+			continue
+		}
+		if m.date[0] > 31 {
+			return "ymd", nil
+		}
+		dayFirst = dayFirst || m.date[0] > 12
+		monthFirst = monthFirst || m.date[1] > 12
+		twelveHour = twelveHour || m.period != ""
+	}
+	switch {
+	case dayFirst && monthFirst:
+		return "", errors.New("dates are neither consistently day-first nor month-first; set the date order")
+	case dayFirst:
+		return "dmy", nil
+	case monthFirst, twelveHour:
+		return "mdy", nil
+	}
+	return "dmy", nil
+}
+
+// time is the message's Unix time, reading its date in order and its clock in loc.
+func (m *whatsAppMessage) time(order string, loc *time.Location) (int64, error) {
+	var y, mo, d int
+	switch order {
+	case "dmy":
+		d, mo, y = m.date[0], m.date[1], m.date[2]
+	case "mdy":
+		mo, d, y = m.date[0], m.date[1], m.date[2]
+	case "ymd":
+		y, mo, d = m.date[0], m.date[1], m.date[2]
+	}
+	if y < 100 {
+		y += 2000
+	}
+	h := m.clock[0]
+	switch m.period {
+	case "a":
+		if h == 12 {
+			h = 0
+		}
+	case "p":
+		if h < 12 {
+			h += 12
+		}
+	}
+	if mo < 1 || mo > 12 || d < 1 || d > 31 || h > 23 || m.clock[1] > 59 || m.clock[2] > 59 {
+		return 0, fmt.Errorf("invalid %s timestamp %02d/%02d/%02d %02d:%02d", order, m.date[0], m.date[1], m.date[2], m.clock[0], m.clock[1])
+	}
+	return time.Date(y, time.Month(mo), d, h, m.clock[1], m.clock[2], 0, loc).Unix(), nil
+}
+
+// whatsAppTitle names a chat after its export file: "WhatsApp Chat with Alice.txt" is "Alice", and an
+// iOS _chat.txt takes its folder's name ("WhatsApp Chat - Alice").
+func whatsAppTitle(name string) string {
+	base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	if strings.EqualFold(base, "_chat") {
+		base = filepath.Base(filepath.Dir(name))
+	}
+	for _, prefix := range []string{"WhatsApp Chat with ", "WhatsApp Chat - ", "WhatsApp Chat mit ", "Chat de WhatsApp con "} {
+		if len(base) > len(prefix) && strings.EqualFold(base[:len(prefix)], prefix) {
+			return strings.TrimSpace(base[len(prefix):])
+		}
+	}
+	return base
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
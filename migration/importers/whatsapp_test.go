@@ -0,0 +1,125 @@
+package importers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+)
+
+func TestParseWhatsApp_AndroidUS(t *testing.T) {
+	t.Parallel()
+
+	export := "\ufeff12/31/20, 9:41 PM - Messages and calls are end-to-end encrypted. No one outside of this chat can read them.\n" +
+		"12/31/20, 9:41 PM - Alice: Happy new year\n" +
+		"see you\n" +
+		"12/31/20, 11:05 PM - Bob: <Media omitted>\n" +
+		"1/1/21, 12:10 AM - Bob: Fixed the typo <This message was edited>\n" +
+		"1/1/21, 12:12 AM - Alice added Carol\n"
+	conv, err := ParseWhatsApp(strings.NewReader(export), "WhatsApp Chat with Alice.txt", Options{Location: time.UTC})
+	if err != nil {
+		t.Fatalf("ParseWhatsApp: %v", err)
+	}
+	if conv.Title != "Alice" || !strings.HasPrefix(conv.ConversationID, "whatsapp-") || conv.SourceType != migration.SourceTypeWhatsApp {
+		t.Fatalf("title=%q id=%q source_type=%q", conv.Title, conv.ConversationID, conv.SourceType)
+	}
+	if len(conv.Messages) != 3 {
+		t.Fatalf("messages=%+v", conv.Messages)
+	}
+	first := conv.Messages[0]
+	if first.Role != "user" || first.Speaker != "Alice" || first.Text != "Happy new year\nsee you" {
+		t.Fatalf("first=%+v", first)
+	}
+	if got := time.Unix(int64(*first.CreateTime), 0).UTC(); !got.Equal(time.Date(2020, 12, 31, 21, 41, 0, 0, time.UTC)) {
+		t.Fatalf("first time=%s", got)
+	}
+	if m := conv.Messages[1]; m.ContentType != MediaOmittedContentType || m.Text != "[media omitted]" {
+		t.Fatalf("media=%+v", m)
+	}
+	if m := conv.Messages[2]; m.Text != "Fixed the typo" || time.Unix(int64(*m.CreateTime), 0).UTC().Hour() != 0 {
+		t.Fatalf("edited=%+v", m)
+	}
+	if len(conv.Participants) != 2 || *conv.UpdateTime != *conv.Messages[2].CreateTime {
+		t.Fatalf("participants=%+v update=%v", conv.Participants, conv.UpdateTime)
+	}
+}
+
+func TestParseWhatsApp_LocaleFormats(t *testing.T) {
+	t.Parallel()
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no tz database")
+	}
+	cases := []struct {
+		name, export string
+		want         time.Time
+		text         string
+	}{
+		{"german", "31.12.20, 21:41 - Anna: Hallo\n", time.Date(2020, 12, 31, 21, 41, 0, 0, berlin), "Hallo"},
+		{"ios", "[05/02/2021, 08:15:30] Anna: \u200eimage omitted\n[13/02/2021, 08:16:00] Ben: ok\n", time.Date(2021, 2, 5, 8, 15, 30, 0, berlin), "[image omitted]"},
+		{"iso", "[2021-03-04, 9:05:01 p. m.] Anna: <attached: 00000012-PHOTO.jpg>\n", time.Date(2021, 3, 4, 21, 5, 1, 0, berlin), "[attached: 00000012-PHOTO.jpg]"},
+	}
+	for _, tc := range cases {
+		conv, err := ParseWhatsApp(strings.NewReader(tc.export), filepath.Join("WhatsApp Chat - Anna", "_chat.txt"), Options{Location: berlin})
+		if err != nil {
+			t.Fatalf("%s: ParseWhatsApp: %v", tc.name, err)
+		}
+		m := conv.Messages[0]
+		if got := time.Unix(int64(*m.CreateTime), 0); !got.Equal(tc.want) || m.Text != tc.text || conv.Title != "Anna" {
+			t.Fatalf("%s: time=%s text=%q title=%q", tc.name, got.In(berlin), m.Text, conv.Title)
+		}
+	}
+
+	if _, err := ParseWhatsApp(strings.NewReader("01/02/21, 10:00 - A: x\n"), "chat.txt", Options{DateOrder: "dym"}); err == nil {
+		t.Fatalf("expected an error for an unknown date order")
+	}
+	if _, err := ParseWhatsApp(strings.NewReader("just some notes\n"), "notes.txt", Options{}); err == nil {
+		t.Fatalf("expected an error for a file without messages")
+	}
+}
+
+func TestWriteConversations_KeepsNewestImport(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	older := "12/31/20, 9:41 PM - Alice: hi\n"
+	newer := older + "12/31/20, 9:50 PM - Bob: hello\n"
+	for name, body := range map[string]string{"a.txt": newer, "b.txt": older} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := Collect(FormatWhatsApp, []string{dir})
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	var convs []migration.SimplifiedConversation
+	for _, f := range files {
+		c, err := Import(FormatWhatsApp, f, Options{Location: time.UTC})
+		if err != nil {
+			t.Fatalf("Import: %v", err)
+		}
+		// Both files are the same chat once named alike.
+		c[0].ConversationID = conversationID(FormatWhatsApp, "Alice", "first")
+		convs = append(convs, c...)
+	}
+	out := t.TempDir()
+	res, err := migration.WriteConversations(out, convs, migration.SplitOptions{})
+	if err != nil {
+		t.Fatalf("WriteConversations: %v", err)
+	}
+	if res.ThreadsWritten != 1 || res.DuplicatesSkipped != 1 {
+		t.Fatalf("res=%+v", res)
+	}
+	b, err := os.ReadFile(filepath.Join(out, convs[0].ConversationID+".json"))
+	if err != nil {
+		t.Fatalf("read thread: %v", err)
+	}
+	if !strings.Contains(string(b), `"speaker":"Bob"`) {
+		t.Fatalf("older copy written: %s", b)
+	}
+}
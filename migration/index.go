@@ -1,9 +1,30 @@
 package migration
 
 import (
+	"fmt"
+	"path/filepath"
 	"strings"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
 )
 
+// IndexKey returns how records are keyed in one of the pipeline's JSONL index files, chosen by file
+// name, for deduping append-mode indices. Key point rows are grouped by their chunk's summary_path, so a
+// re-summarized chunk replaces all of its key points at once.
+func IndexKey(path string) (fileutils.JSONLKeyFunc, bool) {
+	switch strings.ToLower(filepath.Base(path)) {
+	case "index.json":
+		return fileutils.JSONLFieldKey("summary_path", ""), true
+	case KeyPointsFileName:
+		return fileutils.JSONLFieldKey("summary_path", "id"), true
+	case "sentiment_index.json":
+		return fileutils.JSONLFieldKey("sentiment_summary_path", ""), true
+	case "thread_index.json", "sentiment_thread_index.json":
+		return fileutils.JSONLFieldKey("conversation_id", ""), true
+	}
+	return nil, false
+}
+
 // BuildIndexRecord creates a stable index row for a chunk + its summary.
 func BuildIndexRecord(chunk Chunk, chunkPath string, summary ChunkSummary, summaryPath string) IndexRecord {
 	return IndexRecord{
@@ -12,12 +33,43 @@ func BuildIndexRecord(chunk Chunk, chunkPath string, summary ChunkSummary, summa
 		ChunkNumber:    chunk.ChunkNumber,
 		TurnStart:      chunk.TurnStart,
 		TurnEnd:        chunk.TurnEnd,
+		SourceType:     chunk.SourceType,
 		ChunkPath:      chunkPath,
 		SummaryPath:    summaryPath,
 		Summary:        strings.TrimSpace(summary.Summary),
-		Tags:           dedupeStrings(summary.Tags),
-		Terms:          dedupeStrings(summary.Terms),
+		Tags:           NormalizeTags(summary.Tags, false),
+		Terms:          NormalizeTags(summary.Terms, false),
+	}
+}
+
+// BuildKeyPointRecords creates one key_points.jsonl row per non-empty key point of a chunk summary.
+func BuildKeyPointRecords(chunk Chunk, summary ChunkSummary, summaryPath string) []KeyPointRecord {
+	var chunkTime *float64
+	for _, m := range chunk.Messages {
+		if m.CreateTime != nil && *m.CreateTime > 0 {
+			chunkTime = m.CreateTime
+			break
+		}
+	}
+	var out []KeyPointRecord
+	for i, kp := range summary.KeyPoints {
+		kp = strings.TrimSpace(kp)
+		if kp == "" {
+			continue
+		}
+		out = append(out, KeyPointRecord{
+			ID:             fmt.Sprintf("%s:%d:%d", chunk.ConversationID, chunk.ChunkNumber, i),
+			ConversationID: chunk.ConversationID,
+			ThreadStart:    chunk.ThreadStart,
+			ChunkNumber:    chunk.ChunkNumber,
+			TurnStart:      chunk.TurnStart,
+			TurnEnd:        chunk.TurnEnd,
+			ChunkTime:      chunkTime,
+			Text:           kp,
+			SummaryPath:    summaryPath,
+		})
 	}
+	return out
 }
 
 func dedupeStrings(in []string) []string {
@@ -0,0 +1,114 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+)
+
+// ThreadIndexCheck is what CheckThreadIndex found comparing a thread index with the rollups on disk.
+type ThreadIndexCheck struct {
+	IndexPath string
+	// IndexMissing is set when there is no index to compare against.
+	IndexMissing bool
+	// Unindexed are rollups on disk without an index row; Missing are rows whose rollup is gone.
+	Unindexed []string
+	Missing   []string
+	// Newer are rollups modified after the index was written.
+	Newer []string
+	// RunStatus is the status of the thread-rollup run report beside the index, when that run did
+	// not finish ok.
+	RunStatus string
+}
+
+// Stale reports whether packing from this index would leave out or misdescribe rollups. A missing
+// index is not stale by itself: there is nothing to disagree with.
+func (c ThreadIndexCheck) Stale() bool {
+	return len(c.Unindexed) > 0 || len(c.Missing) > 0 || len(c.Newer) > 0 || c.RunStatus != ""
+}
+
+// Problems describes each disagreement on one line, naming up to three files.
+func (c ThreadIndexCheck) Problems() []string {
+	var out []string
+	add := func(paths []string, what string) {
+		if len(paths) == 0 {
+			return
+		}
+		shown := paths
+		if len(shown) > 3 {
+			shown = shown[:3]
+		}
+		line := fmt.Sprintf("%d %s (%s", len(paths), what, strings.Join(shown, ", "))
+		if len(paths) > len(shown) {
+			line += ", ..."
+		}
+		out = append(out, line+")")
+	}
+	add(c.Unindexed, "rollup(s) on disk missing from "+filepath.Base(c.IndexPath))
+	add(c.Missing, "index row(s) whose rollup no longer exists")
+	add(c.Newer, "rollup(s) modified after "+filepath.Base(c.IndexPath)+" was written")
+	if c.RunStatus != "" {
+		out = append(out, fmt.Sprintf("the last thread-rollup run ended %s, so %s may be incomplete", c.RunStatus, filepath.Base(c.IndexPath)))
+	}
+	return out
+}
+
+// CheckThreadIndex compares the thread index at indexPath, whose rows point at indexed, with the
+// rollups found on disk. Paths are compared as absolute paths, so relative and absolute spellings of
+// the same file match.
+func CheckThreadIndex(indexPath string, onDisk, indexed []string) (ThreadIndexCheck, error) {
+	c := ThreadIndexCheck{IndexPath: indexPath}
+	info, err := os.Stat(layout.LongPath(indexPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		c.IndexMissing = true
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("check thread index: %w", err)
+	}
+	indexTime := info.ModTime()
+
+	abs := func(p string) string {
+		if a, err := filepath.Abs(p); err == nil {
+			return a
+		}
+		return filepath.Clean(p)
+	}
+	rows := make(map[string]bool, len(indexed))
+	for _, p := range indexed {
+		rows[abs(p)] = true
+	}
+	disk := make(map[string]bool, len(onDisk))
+	for _, p := range onDisk {
+		a := abs(p)
+		disk[a] = true
+		if !rows[a] {
+			c.Unindexed = append(c.Unindexed, p)
+			continue
+		}
+		if fi, err := os.Stat(layout.LongPath(p)); err == nil && fi.ModTime().After(indexTime) {
+			c.Newer = append(c.Newer, p)
+		}
+	}
+	seen := make(map[string]bool, len(indexed))
+	for _, p := range indexed {
+		a := abs(p)
+		if disk[a] || seen[a] {
+			continue
+		}
+		seen[a] = true
+		if _, err := os.Stat(layout.LongPath(p)); errors.Is(err, fs.ErrNotExist) {
+			c.Missing = append(c.Missing, p)
+		}
+	}
+
+	if r, err := ReadRunReport(filepath.Join(filepath.Dir(indexPath), RunReportFileName)); err == nil && r.Stage == "thread-rollup" && r.Status != RunStatusOK {
+		c.RunStatus = r.Status
+	}
+	return c, nil
+}
@@ -0,0 +1,67 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckThreadIndex_FindsStaleRows(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	write := func(name string, mtime time.Time) string {
+		t.Helper()
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte("{}"), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatalf("chtimes: %v", err)
+		}
+		return p
+	}
+	then := time.Now().Add(-time.Hour)
+	a := write("a.thread.summary.json", then)
+	b := write("b.thread.summary.json", then.Add(30*time.Minute))
+	c := write("c.thread.summary.json", then)
+	indexPath := write("thread_index.json", then.Add(10*time.Minute))
+
+	check, err := CheckThreadIndex(indexPath, []string{a, b, c}, []string{a, b, filepath.Join(dir, "gone.thread.summary.json")})
+	if err != nil {
+		t.Fatalf("CheckThreadIndex: %v", err)
+	}
+	if !check.Stale() || len(check.Unindexed) != 1 || check.Unindexed[0] != c || len(check.Newer) != 1 || check.Newer[0] != b || len(check.Missing) != 1 {
+		t.Fatalf("check=%+v", check)
+	}
+	if problems := check.Problems(); len(problems) != 3 || !strings.Contains(problems[0], "missing from thread_index.json") {
+		t.Fatalf("problems=%q", problems)
+	}
+
+	// Relative and absolute spellings of the same rollup match.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	relA, err := filepath.Rel(wd, a)
+	if err != nil {
+		t.Fatalf("rel: %v", err)
+	}
+	if check, err = CheckThreadIndex(indexPath, []string{a}, []string{relA}); err != nil || check.Stale() {
+		t.Fatalf("check=%+v err=%v", check, err)
+	}
+
+	// An unfinished rollup run makes the index suspect even when the rows agree.
+	if err := WriteRunReport(filepath.Join(dir, RunReportFileName), &RunReport{Stage: "thread-rollup", Status: RunStatusFailed}); err != nil {
+		t.Fatalf("WriteRunReport: %v", err)
+	}
+	if check, err = CheckThreadIndex(indexPath, []string{a}, []string{a}); err != nil || check.RunStatus != RunStatusFailed || !check.Stale() {
+		t.Fatalf("check=%+v err=%v", check, err)
+	}
+
+	if check, err = CheckThreadIndex(filepath.Join(dir, "none.json"), []string{a}, nil); err != nil || !check.IndexMissing || check.Stale() {
+		t.Fatalf("missing index: check=%+v err=%v", check, err)
+	}
+}
@@ -27,3 +27,53 @@ func TestBuildIndexRecord_Dedupes(t *testing.T) {
 		t.Fatalf("Terms=%v, want 1", rec.Terms)
 	}
 }
+
+func TestBuildKeyPointRecords_OneRowPerKeyPoint(t *testing.T) {
+	t.Parallel()
+
+	start, first := 1700000000.0, 1700000500.0
+	chunk := Chunk{
+		ConversationID: "c1",
+		ThreadStart:    &start,
+		ChunkNumber:    3,
+		TurnStart:      40,
+		TurnEnd:        60,
+		Messages:       []SimplifiedMessage{{Role: "system"}, {Role: "user", CreateTime: &first}},
+	}
+	sum := ChunkSummary{KeyPoints: []string{" Booked the 9:15 train ", "", "Hotel is near the station"}}
+	recs := BuildKeyPointRecords(chunk, sum, "s.json")
+	if len(recs) != 2 {
+		t.Fatalf("recs=%+v", recs)
+	}
+	if recs[0].ID != "c1:3:0" || recs[0].Text != "Booked the 9:15 train" || recs[1].ID != "c1:3:2" {
+		t.Fatalf("recs=%+v", recs)
+	}
+	if recs[1].ChunkTime == nil || *recs[1].ChunkTime != first || *recs[1].ThreadStart != start || recs[1].TurnStart != 40 || recs[1].SummaryPath != "s.json" {
+		t.Fatalf("rec=%+v", recs[1])
+	}
+}
+
+func TestIndexKey(t *testing.T) {
+	t.Parallel()
+
+	line := []byte(`{"id":"c1:1:0","conversation_id":"c1","summary_path":"s/1.summary.json","sentiment_summary_path":"s/1.sentiment.summary.json"}`)
+	cases := map[string][2]string{
+		"out/index.json":                  {"s/1.summary.json", "s/1.summary.json"},
+		"out/key_points.jsonl":            {"s/1.summary.json", "c1:1:0"},
+		"out/sentiment_index.json":        {"s/1.sentiment.summary.json", "s/1.sentiment.summary.json"},
+		"out/thread_index.json":           {"c1", "c1"},
+		"out/sentiment_thread_index.json": {"c1", "c1"},
+	}
+	for path, want := range cases {
+		key, ok := IndexKey(path)
+		if !ok {
+			t.Fatalf("IndexKey(%q) not found", path)
+		}
+		if k, id, ok := key(line); !ok || k != want[0] || id != want[1] {
+			t.Fatalf("IndexKey(%q)=%q,%q,%v want %v", path, k, id, ok, want)
+		}
+	}
+	if _, ok := IndexKey("out/memory_index.json"); ok {
+		t.Fatalf("expected no key for memory_index.json")
+	}
+}
@@ -0,0 +1,215 @@
+package migration
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// JournalFileName is the write journal kept in a stage's output directory.
+const JournalFileName = "write_journal.jsonl"
+
+// Journal operations.
+const (
+	JournalBegin   = "begin"
+	JournalCommit  = "commit"
+	JournalApplied = "applied"
+)
+
+// JournalEntry is one line of the write journal. A begin entry lists the artifacts an item is about to
+// write; the matching commit entry records that they were all written, along with any side effect
+// (glossary additions, for example) that still has to reach a shared file. An applied entry marks every
+// earlier commit's side effect as saved.
+type JournalEntry struct {
+	Op     string          `json:"op"`
+	Item   string          `json:"item"`
+	Writes []string        `json:"writes,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Time   string          `json:"time,omitempty"`
+}
+
+// JournalRecovery is what OpenJournal found left over from an interrupted run.
+type JournalRecovery struct {
+	// RolledBack lists items that began but never committed. Their artifacts were removed so a resumed
+	// run regenerates them from scratch.
+	RolledBack []string
+	// Unapplied lists commit entries after the last applied marker. Their artifacts are complete but
+	// their side effects never reached the shared files; the caller replays them and calls Applied.
+	Unapplied []JournalEntry
+	// Stale is true when any item committed since the last checkpoint, so indexes built from the
+	// artifacts may be missing it. The caller rebuilds them and calls Checkpoint.
+	Stale bool
+}
+
+// Journal is a small write-ahead log that keeps per-item artifacts and the shared files built from
+// them (indexes, glossary) consistent across crashes. Each item is bracketed by Begin and Commit.
+// After saving side effects such as the glossary the caller calls Applied, and after rebuilding indexes
+// it calls Checkpoint, which empties the journal. It is safe for concurrent use.
+type Journal struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// OpenJournal recovers the journal at path and opens it for appending. Items left uncommitted by a
+// previous run are rolled back before it returns; committed items are reported for the caller to replay.
+func OpenJournal(path string) (*Journal, JournalRecovery, error) {
+	var rec JournalRecovery
+	entries, err := readJournal(path)
+	if err != nil {
+		return nil, rec, err
+	}
+
+	begun := map[string]JournalEntry{}
+	var order []string
+	for _, e := range entries {
+		switch e.Op {
+		case JournalBegin:
+			if _, ok := begun[e.Item]; !ok {
+				order = append(order, e.Item)
+			}
+			begun[e.Item] = e
+		case JournalCommit:
+			delete(begun, e.Item)
+			rec.Unapplied = append(rec.Unapplied, e)
+			rec.Stale = true
+		case JournalApplied:
+			rec.Unapplied = nil
+		}
+	}
+	for _, item := range order {
+		e, ok := begun[item]
+		if !ok {
+			continue
+		}
+		for _, w := range e.Writes {
+			if err := os.Remove(w); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, rec, fmt.Errorf("OpenJournal: roll back %s: %w", w, err)
+			}
+		}
+		rec.RolledBack = append(rec.RolledBack, item)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, rec, fmt.Errorf("OpenJournal: mkdir: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, rec, fmt.Errorf("OpenJournal: %w", err)
+	}
+	j := &Journal{path: path, f: f}
+	// Rolled-back items are settled; keep only what the caller still has to replay.
+	if len(rec.RolledBack) > 0 && !rec.Stale {
+		if err := j.Checkpoint(); err != nil {
+			_ = f.Close()
+			return nil, rec, err
+		}
+	}
+	return j, rec, nil
+}
+
+// readJournal parses the journal, ignoring a torn final line from a crash mid-append.
+func readJournal(path string) ([]JournalEntry, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	var entries []JournalEntry
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var e JournalEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// Begin records that item is about to write the given artifact paths.
+func (j *Journal) Begin(item string, writes []string) error {
+	return j.append(JournalEntry{Op: JournalBegin, Item: item, Writes: writes})
+}
+
+// Commit records that every artifact listed by Begin was written. data, if non-nil, is marshaled into
+// the entry so the side effect can be replayed after a crash.
+func (j *Journal) Commit(item string, data any) error {
+	e := JournalEntry{Op: JournalCommit, Item: item}
+	if data != nil {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("journal commit %s: %w", item, err)
+		}
+		e.Data = b
+	}
+	return j.append(e)
+}
+
+func (j *Journal) append(e JournalEntry) error {
+	e.Time = time.Now().UTC().Format(time.RFC3339)
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("journal %s %s: %w", e.Op, e.Item, err)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("journal %s %s: %w", e.Op, e.Item, err)
+	}
+	if err := j.f.Sync(); err != nil {
+		return fmt.Errorf("journal %s %s: %w", e.Op, e.Item, err)
+	}
+	return nil
+}
+
+// Applied records that the side effects of every item committed so far have been saved. A crash
+// between that save and Applied replays those items once more, which may count their glossary terms
+// twice but never loses one.
+func (j *Journal) Applied() error {
+	return j.append(JournalEntry{Op: JournalApplied})
+}
+
+// Checkpoint empties the journal. Call it once indexes have been rebuilt from the committed artifacts.
+func (j *Journal) Checkpoint() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.f.Truncate(0); err != nil {
+		return fmt.Errorf("journal checkpoint: %w", err)
+	}
+	if err := j.f.Sync(); err != nil {
+		return fmt.Errorf("journal checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Close releases the journal file and removes it when empty. Entries left in it are recovered by the
+// next OpenJournal.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fi, statErr := j.f.Stat()
+	if err := j.f.Close(); err != nil {
+		return err
+	}
+	if statErr == nil && fi.Size() == 0 {
+		if err := os.Remove(j.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournal_RecoversInterruptedRun(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, JournalFileName)
+	done := filepath.Join(dir, "a.summary.json")
+	partial := filepath.Join(dir, "b.summary.json")
+
+	j, rec, err := OpenJournal(path)
+	if err != nil || rec.Stale || len(rec.RolledBack) != 0 {
+		t.Fatalf("fresh journal rec=%+v err=%v", rec, err)
+	}
+	// a commits and its side effect is saved; c commits after that; b is interrupted mid-write.
+	if err := j.Begin("a", []string{done}); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if err := os.WriteFile(done, []byte("{}"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := j.Commit("a", map[string]string{"term": "alpha"}); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if err := j.Applied(); err != nil {
+		t.Fatalf("Applied: %v", err)
+	}
+	if err := j.Begin("c", nil); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if err := j.Commit("c", map[string]string{"term": "gamma"}); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if err := j.Begin("b", []string{partial}); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if err := os.WriteFile(partial, []byte("{}"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	// Simulate a crash: the file is never closed cleanly, and the last append is torn.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	_, _ = f.WriteString(`{"op":"commit","item":"b"`)
+	_ = f.Close()
+
+	j2, rec, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal: %v", err)
+	}
+	if len(rec.RolledBack) != 1 || rec.RolledBack[0] != "b" || !rec.Stale {
+		t.Fatalf("rec=%+v", rec)
+	}
+	if len(rec.Unapplied) != 1 || rec.Unapplied[0].Item != "c" || string(rec.Unapplied[0].Data) != `{"term":"gamma"}` {
+		t.Fatalf("unapplied=%+v", rec.Unapplied)
+	}
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Fatalf("partial artifact not rolled back: %v", err)
+	}
+	if _, err := os.Stat(done); err != nil {
+		t.Fatalf("committed artifact removed: %v", err)
+	}
+
+	if err := j2.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+	if err := j2.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("empty journal not removed: %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+package layout
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Kind is a pipeline artifact type, identified on disk by its file-name suffix.
+type Kind string
+
+const (
+	ChunkSummary    Kind = "chunk_summary"
+	ChunkSentiment  Kind = "chunk_sentiment"
+	ThreadSummary   Kind = "thread_summary"
+	ThreadSentiment Kind = "thread_sentiment"
+)
+
+// Kinds lists every artifact kind.
+var Kinds = []Kind{ChunkSummary, ChunkSentiment, ThreadSummary, ThreadSentiment}
+
+// ConventionsEnv names an optional JSON file of Conventions that replaces the default suffixes.
+const ConventionsEnv = "COMPRESS_O_BOT_LAYOUT"
+
+// Conventions are the artifact file-name suffixes: Suffixes are written, and Legacy suffixes are still
+// recognized when reading. The default suffixes stay readable after they are replaced, so outputs of
+// earlier runs are found without listing them.
+type Conventions struct {
+	Suffixes map[Kind]string   `json:"suffixes,omitempty"`
+	Legacy   map[Kind][]string `json:"legacy,omitempty"`
+}
+
+// DefaultConventions returns the suffixes the pipeline uses unless configured otherwise.
+func DefaultConventions() Conventions {
+	return Conventions{Suffixes: map[Kind]string{
+		ChunkSummary:    ".summary.json",
+		ChunkSentiment:  ".sentiment.summary.json",
+		ThreadSummary:   ".thread.summary.json",
+		ThreadSentiment: ".thread.sentiment.summary.json",
+	}}
+}
+
+// registry is the resolved form of Conventions used for lookups.
+type registry struct {
+	write map[Kind]string
+	// read lists every recognized suffix, longest first, so a name matches its most specific kind
+	// (".thread.summary.json" before ".summary.json").
+	read []suffixKind
+}
+
+type suffixKind struct {
+	suffix string
+	kind   Kind
+}
+
+var (
+	mu      sync.RWMutex
+	current = mustRegistry(DefaultConventions())
+)
+
+func mustRegistry(c Conventions) *registry {
+	r, err := newRegistry(c)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func newRegistry(c Conventions) (*registry, error) {
+	def := DefaultConventions()
+	r := &registry{write: make(map[Kind]string, len(Kinds))}
+	owner := make(map[string]Kind)
+	add := func(k Kind, suffix string) error {
+		suffix = strings.ToLower(strings.TrimSpace(suffix))
+		if !strings.HasSuffix(suffix, ".json") || len(suffix) <= len(".json") {
+			return fmt.Errorf("layout: %s suffix %q must end in .json and name something before it", k, suffix)
+		}
+		if strings.HasSuffix(suffix, MetaSuffix) {
+			return fmt.Errorf("layout: %s suffix %q collides with metadata sidecars (%s)", k, suffix, MetaSuffix)
+		}
+		if prev, ok := owner[suffix]; ok {
+			if prev != k {
+				return fmt.Errorf("layout: suffix %q is used by both %s and %s", suffix, prev, k)
+			}
+			return nil
+		}
+		owner[suffix] = k
+		r.read = append(r.read, suffixKind{suffix: suffix, kind: k})
+		return nil
+	}
+	for _, k := range Kinds {
+		s := def.Suffixes[k]
+		if custom, ok := c.Suffixes[k]; ok {
+			s = custom
+		}
+		if err := add(k, s); err != nil {
+			return nil, err
+		}
+		r.write[k] = strings.ToLower(strings.TrimSpace(s))
+	}
+	for k := range c.Suffixes {
+		if _, ok := r.write[k]; !ok {
+			return nil, fmt.Errorf("layout: unknown artifact kind %q", k)
+		}
+	}
+	for _, k := range Kinds {
+		for _, s := range c.Legacy[k] {
+			if err := add(k, s); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// Defaults come last so a custom suffix may take over a default name for another kind.
+	for _, k := range Kinds {
+		if _, taken := owner[def.Suffixes[k]]; !taken {
+			_ = add(k, def.Suffixes[k])
+		}
+	}
+	sort.SliceStable(r.read, func(i, j int) bool { return len(r.read[i].suffix) > len(r.read[j].suffix) })
+	return r, nil
+}
+
+// SetConventions validates c and makes it the process-wide naming scheme. Kinds missing from
+// c.Suffixes keep their default suffix.
+func SetConventions(c Conventions) error {
+	r, err := newRegistry(c)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	current = r
+	mu.Unlock()
+	return nil
+}
+
+// LoadConventions reads a Conventions JSON file and applies it with SetConventions.
+func LoadConventions(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("layout: %w", err)
+	}
+	var c Conventions
+	if err := json.Unmarshal(b, &c); err != nil {
+		return fmt.Errorf("layout: parse %s: %w", path, err)
+	}
+	return SetConventions(c)
+}
+
+// LoadConventionsFromEnv applies the file named by ConventionsEnv, if set. Commands call it at
+// startup, before naming or walking artifacts.
+func LoadConventionsFromEnv() error {
+	path := strings.TrimSpace(os.Getenv(ConventionsEnv))
+	if path == "" {
+		return nil
+	}
+	return LoadConventions(path)
+}
+
+func reg() *registry {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Suffix returns the suffix new artifacts of kind k are written with.
+func Suffix(k Kind) string {
+	return reg().write[k]
+}
+
+// Name returns the file name for an artifact of kind k with the given base (a thread ID or a chunk
+// file name without ".json").
+func Name(base string, k Kind) string {
+	return base + Suffix(k)
+}
+
+// PartName returns the file name of part n of total of a split thread rollup of kind k.
+func PartName(base string, k Kind, n, total int) string {
+	return fmt.Sprintf("%s%s.part%02dof%02d.json", base, strings.TrimSuffix(Suffix(k), ".json"), n, total)
+}
+
+// partPattern matches the ".partNNofMM.json" ending PartName gives the parts of a split rollup.
+var (
+	partPattern     = regexp.MustCompile(`(?i)\.part\d+of\d+\.json$`)
+	partNamePattern = regexp.MustCompile(`(?i)^\.part\d+of\d+\.json$`)
+)
+
+// IsPart reports whether path names an intermediate part of a split thread rollup (see PartName).
+// Parts are not artifacts: Detect never matches them, so walkers skip them even when a configured
+// suffix would.
+func IsPart(path string) bool {
+	return partPattern.MatchString(path)
+}
+
+// Parts returns the part files on disk of the split rollup of kind k with the given base (which may
+// include a directory), whatever number of parts it was split into, sorted by name.
+func Parts(base string, k Kind) ([]string, error) {
+	dir, name := filepath.Split(base)
+	if dir == "" {
+		dir = "."
+	}
+	prefix := strings.ToLower(name + strings.TrimSuffix(Suffix(k), ".json"))
+	entries, err := os.ReadDir(LongPath(dir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []string
+	for _, e := range entries {
+		n := e.Name()
+		if !e.IsDir() && strings.HasPrefix(strings.ToLower(n), prefix) && partNamePattern.MatchString(n[len(prefix):]) {
+			out = append(out, filepath.Join(dir, n))
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// MetaSuffix ends the sidecar files that record how an artifact was generated.
+const MetaSuffix = ".meta.json"
+
+// MetaName returns the sidecar path for the artifact at path: "x.thread.summary.json" becomes
+// "x.thread.summary.meta.json". Sidecars never match an artifact suffix.
+func MetaName(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + MetaSuffix
+}
+
+// Detect returns the kind of artifact path names, matching current and legacy suffixes
+// case-insensitively, and the name with that suffix removed. Rollup parts (see IsPart) never match.
+func Detect(path string) (kind Kind, base string, ok bool) {
+	if IsPart(path) {
+		return "", path, false
+	}
+	lower := strings.ToLower(path)
+	for _, sk := range reg().read {
+		if strings.HasSuffix(lower, sk.suffix) {
+			return sk.kind, path[:len(path)-len(sk.suffix)], true
+		}
+	}
+	return "", path, false
+}
+
+// Is reports whether path names an artifact of kind k.
+func Is(path string, k Kind) bool {
+	got, _, ok := Detect(path)
+	return ok && got == k
+}
+
+// Candidates returns the names an artifact of kind k with the given base may have on disk: the
+// current name first, then legacy names.
+func Candidates(base string, k Kind) []string {
+	r := reg()
+	out := []string{base + r.write[k]}
+	for _, sk := range r.read {
+		if sk.kind == k && sk.suffix != r.write[k] {
+			out = append(out, base+sk.suffix)
+		}
+	}
+	return out
+}
+
+// Find returns the first of Candidates(base, k) that exists, or the current name when none does.
+// base may include a directory.
+func Find(base string, k Kind) string {
+	names := Candidates(base, k)
+	for _, n := range names {
+		if _, err := os.Stat(LongPath(n)); err == nil {
+			return n
+		}
+	}
+	return names[0]
+}
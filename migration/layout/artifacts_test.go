@@ -0,0 +1,145 @@
+package layout
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetect_DefaultSuffixesMatchMostSpecificKind(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]Kind{
+		"t1/chunk_0001.summary.json":               ChunkSummary,
+		"t1/chunk_0001.Sentiment.Summary.json":     ChunkSentiment,
+		"abc.thread.summary.json":                  ThreadSummary,
+		"abc.thread.sentiment.summary.json":        ThreadSentiment,
+		"abc.thread.summary.part01of02.json":       "",
+		"t1/chunk_0001.json":                       "",
+		"abc.thread.sentiment.summary.json.tmp123": "",
+	}
+	for name, want := range cases {
+		got, _, ok := Detect(name)
+		if ok != (want != "") || got != want {
+			t.Fatalf("Detect(%q)=%q,%v want %q", name, got, ok, want)
+		}
+	}
+	if _, base, _ := Detect("x/abc.thread.summary.json"); base != "x/abc" {
+		t.Fatalf("base=%q", base)
+	}
+	if got := PartName("abc", ThreadSentiment, 1, 2); got != "abc.thread.sentiment.summary.part01of02.json" {
+		t.Fatalf("PartName=%q", got)
+	}
+}
+
+func TestSetConventions_WritesNewSuffixAndReadsOldOnes(t *testing.T) {
+	// Not parallel: conventions are process-wide.
+	t.Cleanup(func() { _ = SetConventions(DefaultConventions()) })
+
+	err := SetConventions(Conventions{
+		Suffixes: map[Kind]string{ChunkSummary: ".sem.json"},
+		Legacy:   map[Kind][]string{ChunkSummary: {".chunk-summary.json"}},
+	})
+	if err != nil {
+		t.Fatalf("SetConventions: %v", err)
+	}
+	if got := Name("c1", ChunkSummary); got != "c1.sem.json" {
+		t.Fatalf("Name=%q", got)
+	}
+	for _, name := range []string{"c1.sem.json", "c1.chunk-summary.json", "c1.summary.json"} {
+		if !Is(name, ChunkSummary) {
+			t.Fatalf("%q not detected as a chunk summary", name)
+		}
+	}
+	if !Is("c1.thread.summary.json", ThreadSummary) {
+		t.Fatalf("thread summaries should keep their default suffix")
+	}
+
+	dir := t.TempDir()
+	base := filepath.Join(dir, "c1")
+	if got := Find(base, ChunkSummary); got != base+".sem.json" {
+		t.Fatalf("Find with nothing on disk=%q", got)
+	}
+	if err := os.WriteFile(base+".summary.json", []byte("{}"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if got := Find(base, ChunkSummary); got != base+".summary.json" {
+		t.Fatalf("Find legacy=%q", got)
+	}
+}
+
+func TestSetConventions_RejectsInvalid(t *testing.T) {
+	t.Parallel()
+
+	bad := []Conventions{
+		{Suffixes: map[Kind]string{ChunkSummary: ".summary.txt"}},
+		{Suffixes: map[Kind]string{ChunkSummary: ".json"}},
+		{Suffixes: map[Kind]string{ChunkSummary: ".x.json", ThreadSummary: ".x.json"}},
+		{Suffixes: map[Kind]string{"rollup": ".r.json"}},
+		{Legacy: map[Kind][]string{ChunkSummary: {".thread.summary.json"}}},
+		{Suffixes: map[Kind]string{ChunkSummary: ".summary.meta.json"}},
+	}
+	for _, c := range bad {
+		if _, err := newRegistry(c); err == nil {
+			t.Fatalf("newRegistry(%+v) succeeded", c)
+		}
+	}
+}
+
+func TestMetaName_NeverDetectedAsArtifact(t *testing.T) {
+	t.Parallel()
+
+	meta := MetaName(filepath.Join("out", "t1.thread.summary.json"))
+	if meta != filepath.Join("out", "t1.thread.summary.meta.json") {
+		t.Fatalf("MetaName=%q", meta)
+	}
+	if k, _, ok := Detect(meta); ok {
+		t.Fatalf("Detect(%q)=%s", meta, k)
+	}
+}
+
+func TestParts_FindsSplitRollupPartsOnly(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		PartName("t1", ThreadSummary, 1, 2),
+		PartName("t1", ThreadSummary, 2, 2),
+		PartName("t1", ThreadSummary, 1, 3), // left over from an earlier split
+		PartName("t1", ThreadSentiment, 1, 2),
+		PartName("t10", ThreadSummary, 1, 2),
+		Name("t1", ThreadSummary),
+		MetaName(PartName("t1", ThreadSummary, 1, 2)),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := Parts(filepath.Join(dir, "t1"), ThreadSummary)
+	if err != nil {
+		t.Fatalf("Parts: %v", err)
+	}
+	want := []string{
+		filepath.Join(dir, "t1.thread.summary.part01of02.json"),
+		filepath.Join(dir, "t1.thread.summary.part01of03.json"),
+		filepath.Join(dir, "t1.thread.summary.part02of02.json"),
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("Parts=%v, want %v", got, want)
+	}
+	if got, err := Parts(filepath.Join(dir, "missing", "t1"), ThreadSummary); err != nil || len(got) != 0 {
+		t.Fatalf("missing dir: %v %v", got, err)
+	}
+
+	for _, p := range want {
+		if !IsPart(p) {
+			t.Fatalf("IsPart(%q)=false", p)
+		}
+		if k, _, ok := Detect(p); ok {
+			t.Fatalf("Detect(%q)=%s, parts are not artifacts", p, k)
+		}
+	}
+	if IsPart(Name("t1", ThreadSummary)) {
+		t.Fatal("final rollup reported as a part")
+	}
+}
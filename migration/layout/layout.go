@@ -0,0 +1,118 @@
+// Package layout keeps pipeline output paths portable. Thread IDs become directory and file names
+// several levels deep with long suffixes appended, so names are sanitized once here: Windows reserved
+// device names are avoided and overlong names are shortened with a stable hash. Long absolute paths
+// are given the Windows extended-length prefix when written.
+package layout
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxComponentLen is the longest sanitized name Component returns, in bytes. It leaves room for
+	// the longest suffix the pipeline appends (".thread.sentiment.summary.partNNofNN.json") within the
+	// 255-byte component limit, and keeps the deepest default output paths under 260 characters.
+	MaxComponentLen = 96
+
+	// hashLen is the number of hex characters appended when a name is shortened.
+	hashLen = 8
+
+	// windowsMaxPath is MAX_PATH; paths at or over this length need the extended-length prefix.
+	windowsMaxPath = 260
+)
+
+// reservedNames are the Windows device names that cannot be used as a file name, with or without an
+// extension, in any case.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true, "CONIN$": true, "CONOUT$": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// Component turns s into a file name component that is safe on every platform: letters, digits, '-',
+// '_' and '.' are kept, everything else becomes '_', and leading or trailing dots, dashes and
+// underscores are trimmed. Windows reserved names get a trailing '_', and names longer than
+// MaxComponentLen are truncated and suffixed with a hash of s so distinct long IDs stay distinct.
+// It returns "" when nothing usable remains.
+func Component(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		case r == '-' || r == '_' || r == '.':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+
+	out := strings.Trim(b.String(), "._-")
+	if out == "" {
+		return ""
+	}
+	if IsReserved(out) {
+		out += "_"
+	}
+	if len(out) > MaxComponentLen {
+		out = shorten(out, s, MaxComponentLen)
+	}
+	return out
+}
+
+// IsReserved reports whether name is a Windows reserved device name. The part before the first dot
+// is what counts, so "nul.json" and "Com1.thread.summary.json" are reserved too.
+func IsReserved(name string) bool {
+	stem, _, _ := strings.Cut(name, ".")
+	return reservedNames[strings.ToUpper(strings.TrimRight(stem, " "))]
+}
+
+// shorten truncates name on a rune boundary so that name, a dash, and a hash of original fit in max bytes.
+func shorten(name, original string, max int) string {
+	sum := sha256.Sum256([]byte(original))
+	suffix := "-" + hex.EncodeToString(sum[:])[:hashLen]
+	keep := max - len(suffix)
+	for keep > 0 && !utf8.RuneStart(name[keep]) {
+		keep--
+	}
+	return strings.TrimRight(name[:keep], "._-") + suffix
+}
+
+// LongPath returns path in a form the OS can open regardless of its length. On Windows, absolute
+// paths of MAX_PATH characters or more get the \\?\ extended-length prefix; elsewhere, and for
+// short paths, path is returned unchanged.
+func LongPath(path string) string {
+	if runtime.GOOS != "windows" {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil || len(abs) < windowsMaxPath {
+		return path
+	}
+	return extendedLengthPath(abs)
+}
+
+// extendedLengthPath prefixes an absolute Windows path with \\?\ (or \\?\UNC\ for shares). The
+// prefix disables path normalization, so forward slashes are converted first.
+func extendedLengthPath(abs string) string {
+	if strings.HasPrefix(abs, `\\?\`) {
+		return abs
+	}
+	abs = strings.ReplaceAll(abs, "/", `\`)
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + strings.TrimPrefix(abs, `\\`)
+	}
+	return `\\?\` + abs
+}
@@ -0,0 +1,52 @@
+package layout
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComponent(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"  ../weird id: 123  ": "weird_id__123",
+		"CON":                  "CON_",
+		"nul.json":             "nul.json_",
+		"com1":                 "com1_",
+		"CONSOLE":              "CONSOLE",
+		"...":                  "",
+	}
+	for in, want := range cases {
+		if got := Component(in); got != want {
+			t.Fatalf("Component(%q)=%q want %q", in, got, want)
+		}
+	}
+
+	long := strings.Repeat("é", 80) + "a"
+	got := Component(long)
+	if len(got) > MaxComponentLen || !strings.HasPrefix(got, "éé") {
+		t.Fatalf("long component=%q (%d bytes)", got, len(got))
+	}
+	if other := Component(strings.Repeat("é", 80) + "b"); other == got {
+		t.Fatalf("distinct long names collide: %q", got)
+	}
+	if again := Component(long); again != got {
+		t.Fatalf("shortening is not stable: %q vs %q", again, got)
+	}
+}
+
+func TestExtendedLengthPath(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		`C:\archive\threads\a.json`:    `\\?\C:\archive\threads\a.json`,
+		`C:/archive/threads/a.json`:    `\\?\C:\archive\threads\a.json`,
+		`\\server\share\a.json`:        `\\?\UNC\server\share\a.json`,
+		`\\?\C:\already\prefixed.json`: `\\?\C:\already\prefixed.json`,
+	}
+	for in, want := range cases {
+		if got := extendedLengthPath(in); got != want {
+			t.Fatalf("extendedLengthPath(%q)=%q want %q", in, got, want)
+		}
+	}
+}
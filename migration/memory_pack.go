@@ -1,6 +1,8 @@
 package migration
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -21,18 +23,100 @@ type MemoryPackOptions struct {
 
 	// IncludeTags adds Tags/Terms lines under each thread (useful for human inspection).
 	IncludeTags bool
+
+	// ThreadFiles additionally writes each rendered section to <OutDir>/threads_md/<conversation_id>.md
+	// so a single thread can be opened or linked without loading a whole shard. IDs that sanitize to
+	// the same name are told apart as anchors are (see threadFileRegistry).
+	ThreadFiles bool
+
+	// JSONShards also writes each shard's sections as a JSON array beside it (memories_0001.json next
+	// to memories_0001.md), with the fields each section was rendered from, its anchor, and its markdown.
+	JSONShards bool
+
+	// Templates, when set, render thread sections in place of the built-in layout.
+	Templates *ShardTemplates
+
+	// Sources, by conversation ID, are appended to each thread's section as links to its chunks (see
+	// ReadSourceLinks) and recorded in its index row.
+	Sources map[string][]SourceLink
+
+	// Footer, when set, ends each shard written with a generation block: the tool version, the models
+	// and prompt versions of its threads, and the generation time.
+	Footer *ShardFooter
+
+	// Packed lists the threads an earlier pack wrote to OutDir, by conversation ID. When it is non-nil
+	// packing is incremental: a thread whose rendered section is unchanged keeps its shard and row,
+	// existing shards are left untouched, and only new or changed threads are written, into shards
+	// numbered after the last one in OutDir.
+	Packed map[string]PackedThread
+}
+
+// PackedThread is where an earlier pack put one thread.
+type PackedThread struct {
+	ShardFile   string
+	ThreadFile  string
+	Anchor      string
+	SectionHash string
+}
+
+// keep returns where an earlier pack put a thread whose section hashes to hash, if it can stay there.
+func (o MemoryPackOptions) keep(conversationID, hash string) (PackedThread, bool) {
+	p, ok := o.Packed[conversationID]
+	if !ok || p.SectionHash != hash || p.ShardFile == "" || (o.ThreadFiles && p.ThreadFile == "") {
+		return PackedThread{}, false
+	}
+	return p, true
+}
+
+// firstShard is the number of the first shard to write: 1, or after the last shard in OutDir when
+// packing incrementally.
+func (o MemoryPackOptions) firstShard(name func(int) string) (int, error) {
+	if o.Packed == nil {
+		return 1, nil
+	}
+	entries, err := os.ReadDir(o.OutDir)
+	if err != nil {
+		return 0, err
+	}
+	pattern := strings.Replace(name(0), "0000", "%d", 1)
+	last := 0
+	for _, e := range entries {
+		var n int
+		if _, err := fmt.Sscanf(e.Name(), pattern, &n); err == nil && name(n) == e.Name() && n > last {
+			last = n
+		}
+	}
+	return last + 1, nil
+}
+
+// sectionHash identifies a rendered thread section, so incremental packing can tell changed threads.
+func sectionHash(section string) string {
+	sum := sha256.Sum256([]byte(section))
+	return hex.EncodeToString(sum[:8])
 }
 
+// ThreadFilesDirName is the subdirectory of OutDir that holds standalone per-thread markdown files.
+const ThreadFilesDirName = "threads_md"
+
 // MemoryShardIndexRecord maps one thread to a markdown shard file and anchor.
 type MemoryShardIndexRecord struct {
 	ConversationID string   `json:"conversation_id"`
 	ThreadStart    *float64 `json:"thread_start_time,omitempty"`
 	ThreadStartISO string   `json:"thread_start_time_iso8601,omitempty"`
 	Title          string   `json:"title,omitempty"`
+	Project        string   `json:"project,omitempty"`
+	SourceType     string   `json:"source_type,omitempty"`
 
 	ShardFile string `json:"shard_file"`
 	Anchor    string `json:"anchor"`
 
+	// ThreadFile is the standalone markdown file (relative to OutDir) when MemoryPackOptions.ThreadFiles is set.
+	ThreadFile string `json:"thread_file,omitempty"`
+	// SectionHash identifies the rendered section, for incremental packing.
+	SectionHash string `json:"section_hash,omitempty"`
+	// Sources link the thread's chunks when MemoryPackOptions.Sources is set.
+	Sources []SourceLink `json:"sources,omitempty"`
+
 	// Summary is duplicated (shortened) here for quick scanning.
 	Summary string   `json:"summary"`
 	Tags    []string `json:"tags,omitempty"`
@@ -42,6 +126,23 @@ type MemoryShardIndexRecord struct {
 // WriteMemoryShards writes markdown shard files and an index.json that maps threads -> shard files.
 // Thread summaries are packed sequentially into shard files of roughly MaxBytes (UTF-8 bytes).
 func WriteMemoryShards(threadSummaries []ThreadSummary, opts MemoryPackOptions) ([]MemoryShardIndexRecord, error) {
+	// Stable ordering: start time (if present), then conversation_id.
+	summaries := append([]ThreadSummary(nil), threadSummaries...)
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return threadOrderLess(summaries[i].ThreadStart, summaries[i].ConversationID, summaries[j].ThreadStart, summaries[j].ConversationID)
+	})
+	return writeMemoryShards(opts, func(add func(ThreadSummary) error) error {
+		for _, ts := range summaries {
+			if err := add(ts); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// writeMemoryShards packs the summaries each passes to add, in that order.
+func writeMemoryShards(opts MemoryPackOptions, each func(add func(ThreadSummary) error) error) ([]MemoryShardIndexRecord, error) {
 	if opts.OutDir == "" {
 		return nil, errors.New("WriteMemoryShards: OutDir is empty")
 	}
@@ -52,102 +153,303 @@ func WriteMemoryShards(threadSummaries []ThreadSummary, opts MemoryPackOptions)
 		return nil, fmt.Errorf("WriteMemoryShards: mkdir OutDir: %w", err)
 	}
 
-	// Stable ordering: start time (if present), then conversation_id.
-	summaries := append([]ThreadSummary(nil), threadSummaries...)
-	sort.SliceStable(summaries, func(i, j int) bool {
-		ti := float64(0)
-		tj := float64(0)
-		if summaries[i].ThreadStart != nil {
-			ti = *summaries[i].ThreadStart
-		}
-		if summaries[j].ThreadStart != nil {
-			tj = *summaries[j].ThreadStart
-		}
-		if ti != tj {
-			return ti < tj
-		}
-		return summaries[i].ConversationID < summaries[j].ConversationID
-	})
-
+	first, err := opts.firstShard(shardName)
+	if err != nil {
+		return nil, fmt.Errorf("WriteMemoryShards: %w", err)
+	}
 	var (
-		shardNum     = 1
-		curr         strings.Builder
-		currBytes    = 0
-		currFilename = ""
-		index        []MemoryShardIndexRecord
+		labels  = opts.Templates.labels()
+		shard   = newShardBuffer("semantic", labels.MemoryShard, labels.Contents, first).withFooter(opts.Footer, labels)
+		index   []MemoryShardIndexRecord
+		anchors = newAnchorRegistry(opts.Packed)
+		files   = newThreadFileRegistry(opts.Packed)
 	)
 
 	flush := func() error {
-		if currBytes == 0 {
+		if shard.threads == 0 {
 			return nil
 		}
-		if currFilename == "" {
-			currFilename = shardName(shardNum)
-		}
-		outPath := filepath.Join(opts.OutDir, currFilename)
+		outPath := filepath.Join(opts.OutDir, shardName(shard.num))
 		if !opts.Overwrite {
 			if _, err := os.Stat(outPath); err == nil {
 				return fmt.Errorf("WriteMemoryShards: shard exists: %s", outPath)
 			}
 		}
-		if _, err := writeFileAtomic(opts.OutDir, outPath, []byte(curr.String()), 0o644); err != nil {
+		if _, err := writeFileAtomic(outPath, []byte(shard.render()), 0o644); err != nil {
 			return fmt.Errorf("WriteMemoryShards: write shard: %w", err)
 		}
-		shardNum++
-		curr.Reset()
-		currBytes = 0
-		currFilename = ""
+		if opts.JSONShards {
+			if err := shard.writeJSON(outPath, opts.Overwrite); err != nil {
+				return fmt.Errorf("WriteMemoryShards: %w", err)
+			}
+		}
+		shard = shard.next()
 		return nil
 	}
 
-	for _, ts := range summaries {
+	add := func(ts ThreadSummary) error {
 		if ts.ConversationID == "" {
-			continue
+			return nil
+		}
+		anchor := anchors.assign(ts.ConversationID)
+		section, err := opts.Templates.renderThread(ts, anchor, labels, opts.IncludeKeyPoints, opts.IncludeTags)
+		if err != nil {
+			return fmt.Errorf("WriteMemoryShards: %w", err)
+		}
+		sources := opts.Sources[ts.ConversationID]
+		section = withSourceLinks(section, sources, labels)
+		rec := MemoryShardIndexRecord{
+			ConversationID: ts.ConversationID,
+			ThreadStart:    ts.ThreadStart,
+			ThreadStartISO: threadStartISO8601(ts.ThreadStart),
+			Title:          ts.Title,
+			Project:        ts.Project,
+			SourceType:     ts.SourceType,
+			Anchor:         anchor,
+			SectionHash:    sectionHash(section),
+			Sources:        sources,
+			Summary:        IndexSummary(ts, 400),
+			Tags:           NormalizeTags(ts.Tags, false),
+			Terms:          NormalizeTags(ts.Terms, false),
+		}
+		if p, ok := opts.keep(ts.ConversationID, rec.SectionHash); ok {
+			rec.ShardFile, rec.ThreadFile = p.ShardFile, p.ThreadFile
+			index = append(index, rec)
+			return nil
 		}
-		section, anchor := renderThreadMarkdown(ts, opts.IncludeKeyPoints, opts.IncludeTags)
-		sectionBytes := len([]byte(section))
 
-		if currBytes > 0 && currBytes+sectionBytes > opts.MaxBytes {
+		if shard.threads > 0 && shard.size()+shard.entrySize(section, anchor, ts.Title, ts.MicroSummary) > opts.MaxBytes {
 			if err := flush(); err != nil {
-				return nil, err
+				return err
 			}
 		}
+		shard.add(section, anchor, ts.Title, ts.MicroSummary, ts.ThreadStart)
+		shard.stamp(ts.Model, ts.PromptVersion)
+		rec.ShardFile = shardName(shard.num)
 
-		if currBytes == 0 {
-			currFilename = shardName(shardNum)
-			header := fmt.Sprintf("# Memory Shard %04d\n\n", shardNum)
-			curr.WriteString(header)
-			currBytes += len([]byte(header))
+		if opts.ThreadFiles {
+			var err error
+			// A changed thread replaces its own thread file when packing incrementally.
+			rec.ThreadFile, err = writeThreadFile(opts.OutDir, files.assign(ts.ConversationID), section, opts.Overwrite || opts.Packed != nil)
+			if err != nil {
+				return fmt.Errorf("WriteMemoryShards: %w", err)
+			}
 		}
 
-		curr.WriteString(section)
-		currBytes += sectionBytes
-
-		index = append(index, MemoryShardIndexRecord{
-			ConversationID: ts.ConversationID,
-			ThreadStart:    ts.ThreadStart,
-			ThreadStartISO: threadStartISO8601(ts.ThreadStart),
-			Title:          ts.Title,
-			ShardFile:      currFilename,
-			Anchor:         anchor,
-			Summary:        truncateForIndex(ts.Summary, 400),
-			Tags:           dedupeStrings(ts.Tags),
-			Terms:          dedupeStrings(ts.Terms),
-		})
+		if opts.JSONShards {
+			js := memoryShardSection{
+				MemoryShardIndexRecord: rec,
+				Summary:                strings.TrimSpace(ts.Summary),
+				MicroSummary:           strings.TrimSpace(ts.MicroSummary),
+				Markdown:               strings.TrimSuffix(section, sectionSeparator),
+			}
+			if opts.IncludeKeyPoints {
+				js.KeyPoints, js.KeyPointSources = ts.KeyPoints, ts.KeyPointSources
+			}
+			if !opts.IncludeTags {
+				js.Tags, js.Terms = nil, nil
+			}
+			shard.sections = append(shard.sections, js)
+		}
+		index = append(index, rec)
+		return nil
 	}
 
+	if err := each(add); err != nil {
+		return nil, err
+	}
 	if err := flush(); err != nil {
 		return nil, err
 	}
 	return index, nil
 }
 
+// memoryShardSection is one section of a JSON shard: its index row with the untruncated text it was
+// rendered from, and the markdown as it appears in the .md shard.
+type memoryShardSection struct {
+	MemoryShardIndexRecord
+	Summary         string   `json:"summary"`
+	MicroSummary    string   `json:"micro_summary,omitempty"`
+	KeyPoints       []string `json:"key_points,omitempty"`
+	KeyPointSources [][]int  `json:"key_point_sources,omitempty"`
+	Markdown        string   `json:"markdown"`
+}
+
+// threadOrderLess orders threads by start time (missing counts as 0), then conversation ID.
+func threadOrderLess(startA *float64, idA string, startB *float64, idB string) bool {
+	ta, tb := float64(0), float64(0)
+	if startA != nil {
+		ta = *startA
+	}
+	if startB != nil {
+		tb = *startB
+	}
+	if ta != tb {
+		return ta < tb
+	}
+	return idA < idB
+}
+
+// writeThreadFile writes one rendered thread section as a standalone markdown file at rel, a
+// slash-separated path relative to outDir from threadFileRegistry, and returns rel.
+func writeThreadFile(outDir, rel, section string, overwrite bool) (string, error) {
+	outPath := filepath.Join(outDir, filepath.FromSlash(rel))
+	if !overwrite {
+		if _, err := os.Stat(outPath); err == nil {
+			return "", fmt.Errorf("thread file exists: %s", outPath)
+		}
+	}
+	body := strings.TrimSuffix(section, sectionSeparator)
+	if _, err := writeFileAtomic(outPath, []byte(body), 0o644); err != nil {
+		return "", fmt.Errorf("write thread file: %w", err)
+	}
+	return rel, nil
+}
+
+// shardBuffer accumulates rendered thread sections for one shard along with the metadata needed
+// for its YAML front-matter and table of contents.
+type shardBuffer struct {
+	kind     string
+	heading  string
+	contents string
+	num      int
+
+	body     strings.Builder
+	toc      strings.Builder
+	threads  int
+	minStart float64
+	maxStart float64
+
+	// sections are the JSON shard entries, in shard order (MemoryPackOptions.JSONShards).
+	sections []any
+
+	// footer, with the labels to render it and the models and prompt versions stamped by the shard's
+	// threads, is MemoryPackOptions.Footer.
+	footer  *ShardFooter
+	labels  ShardLabels
+	models  []string
+	prompts []string
+}
+
+func newShardBuffer(kind, heading, contents string, num int) *shardBuffer {
+	return &shardBuffer{kind: kind, heading: heading, contents: contents, num: num}
+}
+
+// next starts the following shard.
+func (s *shardBuffer) next() *shardBuffer {
+	return newShardBuffer(s.kind, s.heading, s.contents, s.num+1).withFooter(s.footer, s.labels)
+}
+
+// size approximates the rendered shard size; front-matter is small and fixed, so only the
+// header, TOC and sections are counted against MaxBytes.
+func (s *shardBuffer) size() int {
+	return len(s.heading) + len(s.contents) + 16 + s.toc.Len() + s.body.Len()
+}
+
+func (s *shardBuffer) entrySize(section, anchor, title, blurb string) int {
+	return len(section) + len(tocLine(anchor, title, blurb))
+}
+
+func (s *shardBuffer) add(section, anchor, title, blurb string, start *float64) {
+	s.toc.WriteString(tocLine(anchor, title, blurb))
+	s.body.WriteString(section)
+	s.threads++
+	if start != nil && *start > 0 {
+		if s.minStart == 0 || *start < s.minStart {
+			s.minStart = *start
+		}
+		if *start > s.maxStart {
+			s.maxStart = *start
+		}
+	}
+}
+
+func (s *shardBuffer) render() string {
+	var content strings.Builder
+	fmt.Fprintf(&content, "# %s %04d\n\n", s.heading, s.num)
+	fmt.Fprintf(&content, "## %s\n\n", s.contents)
+	content.WriteString(s.toc.String())
+	content.WriteString("\n")
+	content.WriteString(s.body.String())
+	content.WriteString(s.renderFooter())
+
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "shard: %d\n", s.num)
+	fmt.Fprintf(&b, "kind: %s\n", s.kind)
+	fmt.Fprintf(&b, "thread_count: %d\n", s.threads)
+	if s.minStart > 0 {
+		fmt.Fprintf(&b, "time_start: %q\n", threadStartISO8601(&s.minStart))
+		fmt.Fprintf(&b, "time_end: %q\n", threadStartISO8601(&s.maxStart))
+	}
+	fmt.Fprintf(&b, "content_bytes: %d\n", content.Len())
+	fmt.Fprintf(&b, "approx_tokens: %d\n", approxTokens(content.Len()))
+	b.WriteString("---\n\n")
+	b.WriteString(content.String())
+	return b.String()
+}
+
+// JSONShardName is the JSON shard written beside the markdown shard mdName.
+func JSONShardName(mdName string) string {
+	return strings.TrimSuffix(mdName, filepath.Ext(mdName)) + ".json"
+}
+
+// writeJSON writes the buffered sections beside the markdown shard at mdPath.
+func (s *shardBuffer) writeJSON(mdPath string, overwrite bool) error {
+	outPath := JSONShardName(mdPath)
+	if !overwrite {
+		if _, err := os.Stat(outPath); err == nil {
+			return fmt.Errorf("shard exists: %s", outPath)
+		}
+	}
+	b, err := json.MarshalIndent(s.sections, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal JSON shard: %w", err)
+	}
+	if _, err := writeFileAtomic(outPath, b, 0o644); err != nil {
+		return fmt.Errorf("write JSON shard: %w", err)
+	}
+	return nil
+}
+
+// tocLine renders one table of contents entry, followed by the thread's micro summary when it has one.
+func tocLine(anchor, title, blurb string) string {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = strings.TrimPrefix(anchor, "thread-")
+	}
+	title = strings.NewReplacer("[", "\\[", "]", "\\]").Replace(escapeMarkdownInline(title))
+	if blurb = strings.TrimSpace(blurb); blurb != "" {
+		return fmt.Sprintf("- [%s](#%s) — %s\n", title, anchor, escapeMarkdownInline(blurb))
+	}
+	return fmt.Sprintf("- [%s](#%s)\n", title, anchor)
+}
+
+// approxTokens estimates model tokens from UTF-8 byte length (~4 bytes per token for English prose).
+func approxTokens(bytes int) int {
+	return (bytes + 3) / 4
+}
+
 func shardName(n int) string {
 	return fmt.Sprintf("memories_%04d.md", n)
 }
 
-func renderThreadMarkdown(ts ThreadSummary, includeKeyPoints bool, includeTags bool) (section string, anchor string) {
-	anchor = "thread-" + sanitizeAnchor(ts.ConversationID)
+// writeSectionHeader writes the conversation ID and start time lines under a section heading.
+func writeSectionHeader(b *strings.Builder, conversationID string, start *float64, labels ShardLabels) {
+	fmt.Fprintf(b, "- %s: `%s`\n", labels.ConversationID, conversationID)
+	if start != nil {
+		if iso := threadStartISO8601(start); iso != "" {
+			fmt.Fprintf(b, "- %s: `%.3f` (`%s`)\n", labels.ThreadStart, *start, iso)
+		} else {
+			fmt.Fprintf(b, "- %s: `%.3f`\n", labels.ThreadStart, *start)
+		}
+	}
+}
+
+// sectionSeparator ends every rendered thread section.
+const sectionSeparator = "\n---\n\n"
+
+func renderThreadMarkdown(ts ThreadSummary, anchor string, labels ShardLabels, includeKeyPoints bool, includeTags bool) string {
 	title := strings.TrimSpace(ts.Title)
 	if title == "" {
 		title = ts.ConversationID
@@ -156,15 +458,7 @@ func renderThreadMarkdown(ts ThreadSummary, includeKeyPoints bool, includeTags b
 	var b strings.Builder
 	fmt.Fprintf(&b, "<a id=\"%s\"></a>\n", anchor)
 	fmt.Fprintf(&b, "## %s\n\n", escapeMarkdownInline(title))
-	fmt.Fprintf(&b, "- conversation_id: `%s`\n", ts.ConversationID)
-	if ts.ThreadStart != nil {
-		iso := threadStartISO8601(ts.ThreadStart)
-		if iso != "" {
-			fmt.Fprintf(&b, "- thread_start_time: `%.3f` (`%s`)\n", *ts.ThreadStart, iso)
-		} else {
-			fmt.Fprintf(&b, "- thread_start_time: `%.3f`\n", *ts.ThreadStart)
-		}
-	}
+	writeSectionHeader(&b, ts.ConversationID, ts.ThreadStart, labels)
 	b.WriteString("\n")
 
 	sum := strings.TrimSpace(ts.Summary)
@@ -174,7 +468,7 @@ func renderThreadMarkdown(ts ThreadSummary, includeKeyPoints bool, includeTags b
 	}
 
 	if includeKeyPoints && len(ts.KeyPoints) > 0 {
-		b.WriteString("### Key points\n")
+		fmt.Fprintf(&b, "### %s\n", labels.KeyPoints)
 		for _, kp := range ts.KeyPoints {
 			kp = strings.TrimSpace(kp)
 			if kp == "" {
@@ -187,15 +481,91 @@ func renderThreadMarkdown(ts ThreadSummary, includeKeyPoints bool, includeTags b
 
 	if includeTags {
 		if len(ts.Tags) > 0 {
-			fmt.Fprintf(&b, "**tags**: %s\n\n", escapeMarkdownInline(strings.Join(dedupeStrings(ts.Tags), ", ")))
+			fmt.Fprintf(&b, "**%s**: %s\n\n", labels.Tags, escapeMarkdownInline(strings.Join(dedupeStrings(ts.Tags), ", ")))
 		}
 		if len(ts.Terms) > 0 {
-			fmt.Fprintf(&b, "**terms**: %s\n\n", escapeMarkdownInline(strings.Join(dedupeStrings(ts.Terms), ", ")))
+			fmt.Fprintf(&b, "**%s**: %s\n\n", labels.Terms, escapeMarkdownInline(strings.Join(dedupeStrings(ts.Terms), ", ")))
 		}
 	}
 
-	b.WriteString("\n---\n\n")
-	return b.String(), anchor
+	b.WriteString(sectionSeparator)
+	return b.String()
+}
+
+// anchorRegistry hands out section anchors, mapping each anchor to the conversation that holds it.
+// Distinct conversation IDs can sanitize to the same anchor ("A/B" and "a-b"); the first to claim
+// it keeps "thread-<id>" and later ones get a short hash of their ID appended, so every anchor in a
+// pack, and so every index row, names one thread.
+type anchorRegistry map[string]string
+
+// newAnchorRegistry reserves the anchors an earlier pack gave out, so an incremental pack never hands
+// a kept thread's anchor to another one.
+func newAnchorRegistry(packed map[string]PackedThread) anchorRegistry {
+	r := make(anchorRegistry, len(packed))
+	for id, p := range packed {
+		if p.Anchor != "" {
+			r[p.Anchor] = id
+		}
+	}
+	return r
+}
+
+// assign returns the anchor for conversationID, the same one each time it is asked.
+func (r anchorRegistry) assign(conversationID string) string {
+	base := "thread-" + sanitizeAnchor(conversationID)
+	anchor := base
+	for n := 1; ; n++ {
+		if owner, ok := r[anchor]; !ok || owner == conversationID {
+			r[anchor] = conversationID
+			return anchor
+		}
+		sum := sha256.Sum256([]byte(conversationID))
+		anchor = base + "-" + hex.EncodeToString(sum[:4])
+		if n > 1 {
+			anchor += fmt.Sprintf("-%d", n)
+		}
+	}
+}
+
+// threadFileRegistry hands out thread file paths (relative to OutDir) the way anchorRegistry hands
+// out anchors: distinct conversation IDs can sanitize to the same file name ("a/b" and "a_b"), so the
+// first keeps threads_md/<name>.md and later ones get a short hash of their ID appended. Paths are
+// compared case-insensitively, since the archive may sit on a case-insensitive filesystem.
+type threadFileRegistry map[string]string
+
+// newThreadFileRegistry reserves the thread files an earlier pack wrote, so an incremental pack never
+// writes another thread over a kept one.
+func newThreadFileRegistry(packed map[string]PackedThread) threadFileRegistry {
+	r := make(threadFileRegistry, len(packed))
+	for id, p := range packed {
+		if p.ThreadFile != "" {
+			r[strings.ToLower(p.ThreadFile)] = id
+		}
+	}
+	return r
+}
+
+// assign returns the thread file path for conversationID, the same one each time it is asked.
+func (r threadFileRegistry) assign(conversationID string) string {
+	name := sanitizeFilenameComponent(conversationID)
+	if name == "" {
+		name = "thread"
+	}
+	base := ThreadFilesDirName + "/" + name
+	rel := base + ".md"
+	for n := 1; ; n++ {
+		key := strings.ToLower(rel)
+		if owner, ok := r[key]; !ok || owner == conversationID {
+			r[key] = conversationID
+			return rel
+		}
+		sum := sha256.Sum256([]byte(conversationID))
+		rel = base + "-" + hex.EncodeToString(sum[:4])
+		if n > 1 {
+			rel += fmt.Sprintf("-%d", n)
+		}
+		rel += ".md"
+	}
 }
 
 func sanitizeAnchor(s string) string {
@@ -254,7 +624,7 @@ func WriteMemoryIndex(path string, records []MemoryShardIndexRecord, overwrite b
 		b.Write(line)
 		b.WriteByte('\n')
 	}
-	_, err := writeFileAtomic(filepath.Dir(path), path, []byte(b.String()), 0o644)
+	_, err := writeFileAtomic(path, []byte(b.String()), 0o644)
 	return err
 }
 
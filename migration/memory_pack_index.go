@@ -0,0 +1,149 @@
+package migration
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+)
+
+// ReadThreadIndex reads thread-rollup's thread_index.json (JSONL). Unlike the append-only logs, the
+// index is required: a missing file is an error. Rows without a conversation_id are skipped.
+func ReadThreadIndex(path string) ([]ThreadIndexRecord, error) {
+	var rows []ThreadIndexRecord
+	if err := readIndexRows(path, func(line []byte) error {
+		var r ThreadIndexRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			return err
+		}
+		if r.ConversationID != "" {
+			rows = append(rows, r)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("read thread index %s: %w", path, err)
+	}
+	return rows, nil
+}
+
+// ReadThreadSentimentIndex is ReadThreadIndex for sentiment_thread_index.json.
+func ReadThreadSentimentIndex(path string) ([]ThreadSentimentIndexRecord, error) {
+	var rows []ThreadSentimentIndexRecord
+	if err := readIndexRows(path, func(line []byte) error {
+		var r ThreadSentimentIndexRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			return err
+		}
+		if r.ConversationID != "" {
+			rows = append(rows, r)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("read thread sentiment index %s: %w", path, err)
+	}
+	return rows, nil
+}
+
+// ReadPackedThreads reads the memory_index.json (or sentiment_memory_index.json) an earlier pack wrote,
+// for MemoryPackOptions.Packed. Both index kinds carry the fields it needs. A missing index returns an
+// empty map: nothing is packed yet.
+func ReadPackedThreads(path string) (map[string]PackedThread, error) {
+	packed := make(map[string]PackedThread)
+	if _, err := os.Stat(layout.LongPath(path)); os.IsNotExist(err) {
+		return packed, nil
+	}
+	if err := readIndexRows(path, func(line []byte) error {
+		var r MemoryShardIndexRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			return err
+		}
+		if r.ConversationID != "" {
+			packed[r.ConversationID] = PackedThread{ShardFile: r.ShardFile, ThreadFile: r.ThreadFile, Anchor: r.Anchor, SectionHash: r.SectionHash}
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("read memory index %s: %w", path, err)
+	}
+	return packed, nil
+}
+
+func readIndexRows(path string, fn func(line []byte) error) error {
+	if _, err := os.Stat(layout.LongPath(path)); err != nil {
+		return err
+	}
+	n := 0
+	var rowErr error
+	err := scanJSONLFile(path, func(line []byte) {
+		n++
+		if rowErr == nil {
+			if err := fn(line); err != nil {
+				rowErr = fmt.Errorf("line %d: %w", n, err)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return rowErr
+}
+
+// WriteMemoryShardsFromIndex is WriteMemoryShards driven by thread index rows instead of loaded
+// summaries. The index decides which threads are packed and in what order; load reads each row's full
+// rollup only when it is about to be rendered, with up to workers loads in flight, so the archive is
+// never walked and never held in memory at once. The row's title, project, and start time replace the
+// loaded rollup's, since the index already carries any overrides.
+func WriteMemoryShardsFromIndex(rows []ThreadIndexRecord, workers int, load func(ThreadIndexRecord) (ThreadSummary, error), opts MemoryPackOptions) ([]MemoryShardIndexRecord, error) {
+	rows = append([]ThreadIndexRecord(nil), rows...)
+	sort.SliceStable(rows, func(i, j int) bool {
+		return threadOrderLess(rows[i].ThreadStart, rows[i].ConversationID, rows[j].ThreadStart, rows[j].ConversationID)
+	})
+	return writeMemoryShards(opts, func(add func(ThreadSummary) error) error {
+		return fileutils.ParallelOrdered(rows, workers, func(r ThreadIndexRecord) (ThreadSummary, error) {
+			ts, err := load(r)
+			if err != nil {
+				return ThreadSummary{}, err
+			}
+			ts.ConversationID, ts.ThreadStart = r.ConversationID, r.ThreadStart
+			if r.Title != "" {
+				ts.Title = r.Title
+			}
+			if r.Project != "" {
+				ts.Project = r.Project
+			}
+			if r.SourceType != "" {
+				ts.SourceType = r.SourceType
+			}
+			return ts, nil
+		}, add)
+	})
+}
+
+// WriteSentimentMemoryShardsFromIndex is WriteMemoryShardsFromIndex for sentiment rollups.
+func WriteSentimentMemoryShardsFromIndex(rows []ThreadSentimentIndexRecord, workers int, load func(ThreadSentimentIndexRecord) (ThreadSentimentSummary, error), opts MemoryPackOptions) ([]SentimentMemoryShardIndexRecord, error) {
+	rows = append([]ThreadSentimentIndexRecord(nil), rows...)
+	sort.SliceStable(rows, func(i, j int) bool {
+		return threadOrderLess(rows[i].ThreadStart, rows[i].ConversationID, rows[j].ThreadStart, rows[j].ConversationID)
+	})
+	return writeSentimentMemoryShards(opts, func(add func(ThreadSentimentSummary) error) error {
+		return fileutils.ParallelOrdered(rows, workers, func(r ThreadSentimentIndexRecord) (ThreadSentimentSummary, error) {
+			ts, err := load(r)
+			if err != nil {
+				return ThreadSentimentSummary{}, err
+			}
+			ts.ConversationID, ts.ThreadStart = r.ConversationID, r.ThreadStart
+			if r.Title != "" {
+				ts.Title = r.Title
+			}
+			if r.Project != "" {
+				ts.Project = r.Project
+			}
+			if r.SourceType != "" {
+				ts.SourceType = r.SourceType
+			}
+			return ts, nil
+		}, add)
+	})
+}
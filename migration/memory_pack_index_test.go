@@ -0,0 +1,85 @@
+package migration
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadThreadIndex_RequiresFileAndSkipsRowsWithoutID(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "thread_index.json")
+	data := `{"conversation_id":"a","thread_summary_path":"a.thread.summary.json"}
+
+{"thread_summary_path":"orphan.json"}
+{"conversation_id":"b","thread_summary_path":"b.thread.summary.json"}
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	rows, err := ReadThreadIndex(path)
+	if err != nil {
+		t.Fatalf("ReadThreadIndex: %v", err)
+	}
+	if len(rows) != 2 || rows[1].ThreadSummaryPath != "b.thread.summary.json" {
+		t.Fatalf("rows=%+v", rows)
+	}
+	if _, err := ReadThreadIndex(filepath.Join(dir, "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("missing index err=%v", err)
+	}
+	if err := os.WriteFile(path, []byte("{\"conversation_id\":\"a\"}\n{broken\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := ReadThreadIndex(path); err == nil {
+		t.Fatalf("expected error for malformed row")
+	}
+}
+
+func TestWriteMemoryShardsFromIndex_MatchesWriteMemoryShards(t *testing.T) {
+	t.Parallel()
+
+	t1, t2 := 200.0, 100.0
+	summaries := map[string]ThreadSummary{
+		"a.json": {ConversationID: "a", Title: "Old title", ThreadStart: &t1, Summary: "First.", KeyPoints: []string{"kp"}},
+		"b.json": {ConversationID: "b", Title: "B", ThreadStart: &t2, Summary: "Second."},
+	}
+	rows := []ThreadIndexRecord{
+		{ConversationID: "a", Title: "Corrected title", ThreadStart: &t1, ThreadSummaryPath: "a.json"},
+		{ConversationID: "b", Title: "B", ThreadStart: &t2, ThreadSummaryPath: "b.json"},
+	}
+	loaded := 0
+	load := func(r ThreadIndexRecord) (ThreadSummary, error) {
+		loaded++
+		return summaries[r.ThreadSummaryPath], nil
+	}
+
+	streamDir, sliceDir := t.TempDir(), t.TempDir()
+	got, err := WriteMemoryShardsFromIndex(rows, 2, load, MemoryPackOptions{OutDir: streamDir, IncludeKeyPoints: true})
+	if err != nil {
+		t.Fatalf("WriteMemoryShardsFromIndex: %v", err)
+	}
+	want := summaries["a.json"]
+	want.Title = "Corrected title"
+	expect, err := WriteMemoryShards([]ThreadSummary{want, summaries["b.json"]}, MemoryPackOptions{OutDir: sliceDir, IncludeKeyPoints: true})
+	if err != nil {
+		t.Fatalf("WriteMemoryShards: %v", err)
+	}
+	if loaded != 2 || !reflect.DeepEqual(got, expect) || got[0].ConversationID != "b" {
+		t.Fatalf("index=%+v want %+v (loaded=%d)", got, expect, loaded)
+	}
+	a, _ := os.ReadFile(filepath.Join(streamDir, shardName(1)))
+	b, _ := os.ReadFile(filepath.Join(sliceDir, shardName(1)))
+	if len(a) == 0 || string(a) != string(b) {
+		t.Fatalf("shards differ:\n%s\n---\n%s", a, b)
+	}
+
+	boom := errors.New("boom")
+	_, err = WriteMemoryShardsFromIndex(rows, 1, func(ThreadIndexRecord) (ThreadSummary, error) { return ThreadSummary{}, boom }, MemoryPackOptions{OutDir: t.TempDir()})
+	if !errors.Is(err, boom) {
+		t.Fatalf("err=%v want boom", err)
+	}
+}
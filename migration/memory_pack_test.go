@@ -1,6 +1,7 @@
 package migration
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
@@ -40,3 +41,274 @@ func TestWriteMemoryShards_IncludesThreadStartISO8601(t *testing.T) {
 }
 
 
+
+func TestWriteMemoryShards_ThreadFiles(t *testing.T) {
+	t.Parallel()
+
+	outDir := t.TempDir()
+	index, err := WriteMemoryShards([]ThreadSummary{
+		{ConversationID: "c/1", Title: "T1", Summary: "hello"},
+	}, MemoryPackOptions{
+		OutDir:      outDir,
+		MaxBytes:    100 * 1024,
+		ThreadFiles: true,
+	})
+	if err != nil {
+		t.Fatalf("WriteMemoryShards: %v", err)
+	}
+	if len(index) != 1 || index[0].ThreadFile != "threads_md/c_1.md" {
+		t.Fatalf("index=%+v", index)
+	}
+	if index[0].ShardFile == "" || index[0].Anchor == "" {
+		t.Fatalf("expected shard anchor alongside thread file: %+v", index[0])
+	}
+
+	b, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(index[0].ThreadFile)))
+	if err != nil {
+		t.Fatalf("read thread file: %v", err)
+	}
+	if !strings.Contains(string(b), "## T1") || !strings.Contains(string(b), "hello") {
+		t.Fatalf("thread file:\n%s", string(b))
+	}
+}
+
+func TestWriteMemoryShards_FrontMatterAndTOC(t *testing.T) {
+	t.Parallel()
+
+	outDir := t.TempDir()
+	a := 1735689600.0 // 2025-01-01T00:00:00Z
+	b := 1735776000.0 // 2025-01-02T00:00:00Z
+	index, err := WriteMemoryShards([]ThreadSummary{
+		{ConversationID: "c1", Title: "First [draft]", ThreadStart: &a, Summary: "one"},
+		{ConversationID: "c2", Title: "Second", ThreadStart: &b, Summary: "two", MicroSummary: "Two things happened."},
+	}, MemoryPackOptions{OutDir: outDir, MaxBytes: 100 * 1024})
+	if err != nil {
+		t.Fatalf("WriteMemoryShards: %v", err)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(outDir, index[0].ShardFile))
+	if err != nil {
+		t.Fatalf("read shard: %v", err)
+	}
+	got := string(raw)
+	for _, want := range []string{
+		"---\nshard: 1\nkind: semantic\nthread_count: 2\n",
+		"time_start: \"2025-01-01T00:00:00Z\"\n",
+		"time_end: \"2025-01-02T00:00:00Z\"\n",
+		"approx_tokens: ",
+		"# Memory Shard 0001\n\n## Contents\n\n",
+		"- [First \\[draft\\]](#thread-c1)\n",
+		"- [Second](#thread-c2) — Two things happened.\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %q in shard:\n%s", want, got)
+		}
+	}
+	if !strings.HasPrefix(got, "---\n") {
+		t.Fatalf("shard should start with front-matter:\n%s", got)
+	}
+}
+
+func TestWriteMemoryShards_IncrementalKeepsExistingShards(t *testing.T) {
+	t.Parallel()
+
+	outDir := t.TempDir()
+	indexPath := filepath.Join(outDir, "memory_index.json")
+	first, err := WriteMemoryShards([]ThreadSummary{
+		{ConversationID: "c1", Title: "T1", Summary: "one"},
+		{ConversationID: "c2", Title: "T2", Summary: "two"},
+	}, MemoryPackOptions{OutDir: outDir, MaxBytes: 100 * 1024})
+	if err != nil {
+		t.Fatalf("WriteMemoryShards: %v", err)
+	}
+	if err := WriteMemoryIndex(indexPath, first, false); err != nil {
+		t.Fatalf("WriteMemoryIndex: %v", err)
+	}
+	before, err := os.ReadFile(filepath.Join(outDir, first[0].ShardFile))
+	if err != nil {
+		t.Fatalf("read shard: %v", err)
+	}
+
+	packed, err := ReadPackedThreads(indexPath)
+	if err != nil {
+		t.Fatalf("ReadPackedThreads: %v", err)
+	}
+	second, err := WriteMemoryShards([]ThreadSummary{
+		{ConversationID: "c1", Title: "T1", Summary: "one"},
+		{ConversationID: "c2", Title: "T2", Summary: "two, revised"},
+		{ConversationID: "c3", Title: "T3", Summary: "three"},
+	}, MemoryPackOptions{OutDir: outDir, MaxBytes: 100 * 1024, Packed: packed})
+	if err != nil {
+		t.Fatalf("incremental WriteMemoryShards: %v", err)
+	}
+	if len(second) != 3 {
+		t.Fatalf("len(index)=%d", len(second))
+	}
+	if second[0].ShardFile != first[0].ShardFile || second[0].SectionHash != first[0].SectionHash {
+		t.Fatalf("unchanged thread was repacked: %+v", second[0])
+	}
+	if second[1].ShardFile == first[1].ShardFile || second[1].ShardFile != second[2].ShardFile {
+		t.Fatalf("changed and new threads should share a new shard: %+v", second)
+	}
+	after, err := os.ReadFile(filepath.Join(outDir, first[0].ShardFile))
+	if err != nil {
+		t.Fatalf("read shard: %v", err)
+	}
+	if string(after) != string(before) {
+		t.Fatalf("existing shard was rewritten")
+	}
+	b, err := os.ReadFile(filepath.Join(outDir, second[2].ShardFile))
+	if err != nil {
+		t.Fatalf("read new shard: %v", err)
+	}
+	if !strings.Contains(string(b), "two, revised") || !strings.Contains(string(b), "three") || strings.Contains(string(b), "## T1") {
+		t.Fatalf("new shard:\n%s", b)
+	}
+}
+
+func TestWriteMemoryShards_JSONShards(t *testing.T) {
+	t.Parallel()
+
+	outDir := t.TempDir()
+	index, err := WriteMemoryShards([]ThreadSummary{
+		{ConversationID: "c1", Title: "T1", Summary: "hello", KeyPoints: []string{"kp"}},
+	}, MemoryPackOptions{OutDir: outDir, MaxBytes: 100 * 1024, IncludeKeyPoints: true, JSONShards: true})
+	if err != nil {
+		t.Fatalf("WriteMemoryShards: %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(outDir, JSONShardName(index[0].ShardFile)))
+	if err != nil {
+		t.Fatalf("read JSON shard: %v", err)
+	}
+	var sections []struct {
+		ConversationID string   `json:"conversation_id"`
+		Anchor         string   `json:"anchor"`
+		ShardFile      string   `json:"shard_file"`
+		Summary        string   `json:"summary"`
+		KeyPoints      []string `json:"key_points"`
+		Markdown       string   `json:"markdown"`
+	}
+	if err := json.Unmarshal(b, &sections); err != nil {
+		t.Fatalf("unmarshal JSON shard: %v\n%s", err, b)
+	}
+	if len(sections) != 1 {
+		t.Fatalf("sections=%+v", sections)
+	}
+	got := sections[0]
+	if got.ConversationID != "c1" || got.Anchor != index[0].Anchor || got.ShardFile != index[0].ShardFile || got.Summary != "hello" || len(got.KeyPoints) != 1 {
+		t.Fatalf("section=%+v", got)
+	}
+	md, err := os.ReadFile(filepath.Join(outDir, index[0].ShardFile))
+	if err != nil {
+		t.Fatalf("read shard: %v", err)
+	}
+	if !strings.Contains(string(md), got.Markdown) || !strings.Contains(got.Markdown, `<a id="`+got.Anchor+`"></a>`) {
+		t.Fatalf("markdown does not match the .md shard:\n%s", got.Markdown)
+	}
+}
+
+func TestWriteMemoryShards_UniqueThreadFiles(t *testing.T) {
+	t.Parallel()
+
+	outDir := t.TempDir()
+	threads := []ThreadSummary{
+		{ConversationID: "a/b", Title: "T1", Summary: "one"},
+		{ConversationID: "a_b", Title: "T2", Summary: "two"},
+	}
+	opts := MemoryPackOptions{OutDir: outDir, MaxBytes: 100 * 1024, ThreadFiles: true}
+	index, err := WriteMemoryShards(threads, opts)
+	if err != nil {
+		t.Fatalf("WriteMemoryShards: %v", err)
+	}
+	if len(index) != 2 || index[0].ThreadFile == index[1].ThreadFile {
+		t.Fatalf("thread files=%+v, want one per thread", index)
+	}
+	for _, rec := range index {
+		b, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(rec.ThreadFile)))
+		if err != nil {
+			t.Fatalf("read %s: %v", rec.ThreadFile, err)
+		}
+		title := map[string]string{"a/b": "T1", "a_b": "T2"}[rec.ConversationID]
+		if !strings.Contains(string(b), "## "+title) {
+			t.Fatalf("%s holds another thread:\n%s", rec.ThreadFile, b)
+		}
+	}
+
+	// An incremental pack keeps both files, and a new colliding thread gets a third.
+	packed := make(map[string]PackedThread)
+	for _, rec := range index {
+		packed[rec.ConversationID] = PackedThread{ShardFile: rec.ShardFile, ThreadFile: rec.ThreadFile, Anchor: rec.Anchor, SectionHash: rec.SectionHash}
+	}
+	opts.Packed = packed
+	next, err := WriteMemoryShards(append([]ThreadSummary{{ConversationID: "a:b", Title: "T0", Summary: "zero"}}, threads...), opts)
+	if err != nil {
+		t.Fatalf("incremental WriteMemoryShards: %v", err)
+	}
+	seen := make(map[string]string)
+	for _, rec := range next {
+		if prev, ok := seen[rec.ThreadFile]; ok {
+			t.Fatalf("thread file %q shared by %q and %q", rec.ThreadFile, prev, rec.ConversationID)
+		}
+		seen[rec.ThreadFile] = rec.ConversationID
+		if p, ok := packed[rec.ConversationID]; ok && p.ThreadFile != rec.ThreadFile {
+			t.Fatalf("kept thread %q moved from %q to %q", rec.ConversationID, p.ThreadFile, rec.ThreadFile)
+		}
+	}
+}
+
+func TestWriteMemoryShards_UniqueAnchors(t *testing.T) {
+	t.Parallel()
+
+	outDir := t.TempDir()
+	threads := []ThreadSummary{
+		{ConversationID: "a-b", Title: "T1", Summary: "one"},
+		{ConversationID: "A/B", Title: "T2", Summary: "two"},
+		{ConversationID: "a b", Title: "T3", Summary: "three"},
+	}
+	index, err := WriteMemoryShards(threads, MemoryPackOptions{OutDir: outDir, MaxBytes: 100 * 1024})
+	if err != nil {
+		t.Fatalf("WriteMemoryShards: %v", err)
+	}
+	seen := make(map[string]string)
+	for _, rec := range index {
+		if prev, ok := seen[rec.Anchor]; ok {
+			t.Fatalf("anchor %q shared by %q and %q", rec.Anchor, prev, rec.ConversationID)
+		}
+		seen[rec.Anchor] = rec.ConversationID
+	}
+	// Threads pack in conversation ID order, so "A/B" claims the plain anchor.
+	if index[0].ConversationID != "A/B" || index[0].Anchor != "thread-a-b" || !strings.HasPrefix(index[2].Anchor, "thread-a-b-") {
+		t.Fatalf("index=%+v", index)
+	}
+	b, err := os.ReadFile(filepath.Join(outDir, index[2].ShardFile))
+	if err != nil {
+		t.Fatalf("read shard: %v", err)
+	}
+	if !strings.Contains(string(b), `<a id="`+index[2].Anchor+`"></a>`+"\n## T1") || !strings.Contains(string(b), "[T1](#"+index[2].Anchor+")") {
+		t.Fatalf("shard does not use the suffixed anchor:\n%s", b)
+	}
+
+	// Repacking gives the same anchors, and an incremental pack does not hand a kept anchor to a new
+	// thread that sorts first.
+	again, err := WriteMemoryShards(threads, MemoryPackOptions{OutDir: t.TempDir(), MaxBytes: 100 * 1024})
+	if err != nil {
+		t.Fatalf("WriteMemoryShards: %v", err)
+	}
+	for i := range index {
+		if again[i].Anchor != index[i].Anchor {
+			t.Fatalf("anchor %d changed: %q -> %q", i, index[i].Anchor, again[i].Anchor)
+		}
+	}
+	packed := make(map[string]PackedThread)
+	for _, rec := range index {
+		packed[rec.ConversationID] = PackedThread{ShardFile: rec.ShardFile, Anchor: rec.Anchor, SectionHash: rec.SectionHash}
+	}
+	next, err := WriteMemoryShards(append([]ThreadSummary{{ConversationID: "A B", Title: "T0", Summary: "zero"}}, threads...), MemoryPackOptions{OutDir: outDir, MaxBytes: 100 * 1024, Packed: packed})
+	if err != nil {
+		t.Fatalf("incremental WriteMemoryShards: %v", err)
+	}
+	if next[0].ConversationID != "A B" || next[0].Anchor == "thread-a-b" || next[1].Anchor != "thread-a-b" {
+		t.Fatalf("incremental anchors=%+v", next)
+	}
+}
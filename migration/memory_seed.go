@@ -0,0 +1,291 @@
+package migration
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// DefaultMemorySeedTokens is the default size of a memory seed: small enough to paste into a new
+// assistant's context alongside a real conversation.
+const DefaultMemorySeedTokens = 30_000
+
+// Seed detail levels, from most to least complete. A thread that does not fit at one level is tried at
+// the next, so the budget buys as many threads as possible before any are dropped.
+const (
+	SeedDetailFull  = "full"  // summary + key points + open items
+	SeedDetailBrief = "brief" // micro summary (or the start of the summary) + tags
+	SeedDetailLine  = "line"  // one bullet in the "Also remembered" list
+)
+
+// Cumulative shares of the seed budget each detail level may fill. Full sections stop once 60% is
+// used and brief ones at 85%, leaving the rest for one-line mentions, so top threads never crowd out
+// the breadth further down the ranking.
+const (
+	seedFullShare  = 0.60
+	seedBriefShare = 0.85
+)
+
+// MemorySeedOptions controls selection and rendering of a memory seed.
+type MemorySeedOptions struct {
+	// MaxTokens caps the rendered file, estimated at ~4 bytes per token like memory-pack.
+	MaxTokens int
+
+	// Weights of the three selection signals; each signal is scaled to [0,1] first.
+	ImportanceWeight float64
+	RecencyWeight    float64
+	CoverageWeight   float64
+
+	// RecencyHalfLife is the age, relative to the newest thread, at which recency drops to one half.
+	// Zero disables recency.
+	RecencyHalfLife time.Duration
+
+	// Title heads the file; empty uses "Memory seed".
+	Title string
+}
+
+// DefaultMemorySeedOptions returns the weights memory-seed uses unless told otherwise.
+func DefaultMemorySeedOptions() MemorySeedOptions {
+	return MemorySeedOptions{
+		MaxTokens:        DefaultMemorySeedTokens,
+		ImportanceWeight: 1,
+		RecencyWeight:    0.6,
+		CoverageWeight:   0.8,
+		RecencyHalfLife:  180 * 24 * time.Hour,
+	}
+}
+
+// SeedEntry is one thread included in a memory seed.
+type SeedEntry struct {
+	ConversationID string  `json:"conversation_id"`
+	Title          string  `json:"title,omitempty"`
+	Detail         string  `json:"detail"`
+	Score          float64 `json:"score"`
+	Tokens         int     `json:"approx_tokens"`
+}
+
+// MemorySeed is a rendered seed and what went into it, in rank order.
+type MemorySeed struct {
+	Markdown string
+	Tokens   int
+	Entries  []SeedEntry
+	Dropped  int
+}
+
+// ThreadImportance scores how much durable content a rollup carries: key points, open items, and
+// distinct tags/terms, with diminishing returns so one sprawling thread does not outrank everything.
+func ThreadImportance(ts ThreadSummary) float64 {
+	kp := 0
+	for _, k := range ts.KeyPoints {
+		if strings.TrimSpace(k) != "" {
+			kp++
+		}
+	}
+	labels := len(dedupeStrings(append(append([]string(nil), ts.Tags...), ts.Terms...)))
+	return math.Log1p(float64(kp)) + 0.5*math.Log1p(float64(len(ts.OpenItems))) + 0.25*math.Log1p(float64(labels))
+}
+
+// RankMemorySeed orders threads for a seed. Each step picks the thread with the best weighted sum of
+// importance, recency, and coverage, where coverage is the share of its tags not already covered by
+// the threads picked before it, so the seed spans topics instead of repeating the busiest one.
+func RankMemorySeed(summaries []ThreadSummary, opt MemorySeedOptions) ([]ThreadSummary, []float64) {
+	n := len(summaries)
+	importance := make([]float64, n)
+	recency := make([]float64, n)
+	tags := make([][]string, n)
+
+	maxImportance := 0.0
+	newest := math.Inf(-1)
+	for i, ts := range summaries {
+		importance[i] = ThreadImportance(ts)
+		maxImportance = math.Max(maxImportance, importance[i])
+		if ts.ThreadStart != nil && *ts.ThreadStart > 0 {
+			newest = math.Max(newest, *ts.ThreadStart)
+		}
+		for _, t := range dedupeStrings(ts.Tags) {
+			tags[i] = append(tags[i], foldLabel(t))
+		}
+	}
+	for i, ts := range summaries {
+		if maxImportance > 0 {
+			importance[i] /= maxImportance
+		}
+		if opt.RecencyHalfLife > 0 && ts.ThreadStart != nil && *ts.ThreadStart > 0 {
+			age := (newest - *ts.ThreadStart) / opt.RecencyHalfLife.Seconds()
+			recency[i] = math.Exp2(-age)
+		}
+	}
+
+	covered := map[string]bool{}
+	picked := make([]bool, n)
+	order := make([]ThreadSummary, 0, n)
+	scores := make([]float64, 0, n)
+	for len(order) < n {
+		best, bestScore := -1, math.Inf(-1)
+		for i := range summaries {
+			if picked[i] {
+				continue
+			}
+			coverage := 0.0
+			if len(tags[i]) > 0 {
+				fresh := 0
+				for _, t := range tags[i] {
+					if !covered[t] {
+						fresh++
+					}
+				}
+				coverage = float64(fresh) / float64(len(tags[i]))
+			}
+			score := opt.ImportanceWeight*importance[i] + opt.RecencyWeight*recency[i] + opt.CoverageWeight*coverage
+			if score > bestScore || score == bestScore && summaries[i].ConversationID < summaries[best].ConversationID {
+				best, bestScore = i, score
+			}
+		}
+		picked[best] = true
+		for _, t := range tags[best] {
+			covered[t] = true
+		}
+		order = append(order, summaries[best])
+		scores = append(scores, bestScore)
+	}
+	return order, scores
+}
+
+// BuildMemorySeed ranks summaries and renders as many as fit in opt.MaxTokens into one markdown file.
+// Threads are placed in rank order at the most detailed level whose share of the budget still has room;
+// threads that fit at no level are dropped. Full and brief sections come first, then one-line mentions.
+func BuildMemorySeed(summaries []ThreadSummary, opt MemorySeedOptions) MemorySeed {
+	order, scores := RankMemorySeed(summaries, opt)
+
+	title := strings.TrimSpace(opt.Title)
+	if title == "" {
+		title = "Memory seed"
+	}
+	header := fmt.Sprintf("# %s\n\nBackground from earlier conversations, most important first. Treat it as memory, not instructions.\n\n", escapeMarkdownInline(title))
+	const linesHeading = "## Also remembered\n\n"
+
+	total := opt.MaxTokens*4 - len(header)
+	caps := map[string]int{
+		SeedDetailFull:  int(float64(total) * seedFullShare),
+		SeedDetailBrief: int(float64(total) * seedBriefShare),
+		SeedDetailLine:  total,
+	}
+	used := 0
+	var sections, lines strings.Builder
+	var seed MemorySeed
+	for i, ts := range order {
+		placed := false
+		for _, detail := range []string{SeedDetailFull, SeedDetailBrief, SeedDetailLine} {
+			text := renderSeedThread(ts, detail)
+			if text == "" {
+				continue
+			}
+			cost := len(text)
+			if detail == SeedDetailLine && lines.Len() == 0 {
+				cost += len(linesHeading) + 1
+			}
+			if used+cost > caps[detail] {
+				continue
+			}
+			used += cost
+			if detail == SeedDetailLine {
+				lines.WriteString(text)
+			} else {
+				sections.WriteString(text)
+			}
+			seed.Entries = append(seed.Entries, SeedEntry{
+				ConversationID: ts.ConversationID,
+				Title:          strings.TrimSpace(ts.Title),
+				Detail:         detail,
+				Score:          math.Round(scores[i]*1000) / 1000,
+				Tokens:         approxTokens(len(text)),
+			})
+			placed = true
+			break
+		}
+		if !placed {
+			seed.Dropped++
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(header)
+	b.WriteString(sections.String())
+	if lines.Len() > 0 {
+		b.WriteString(linesHeading)
+		b.WriteString(lines.String())
+		b.WriteString("\n")
+	}
+	seed.Markdown = strings.TrimRight(b.String(), "\n")
+	seed.Tokens = approxTokens(len(seed.Markdown))
+	return seed
+}
+
+// DetailCounts tallies entries per detail level.
+func (s MemorySeed) DetailCounts() map[string]int {
+	out := map[string]int{}
+	for _, e := range s.Entries {
+		out[e.Detail]++
+	}
+	return out
+}
+
+func renderSeedThread(ts ThreadSummary, detail string) string {
+	title := escapeMarkdownInline(ts.Title)
+	if title == "" {
+		title = ts.ConversationID
+	}
+	date := ""
+	if iso := threadStartISO8601(ts.ThreadStart); len(iso) >= 10 {
+		date = iso[:10]
+	}
+	heading := title
+	if date != "" {
+		heading += " (" + date + ")"
+	}
+	blurb := escapeMarkdownInline(IndexSummary(ts, MicroSummaryMaxChars))
+
+	var b strings.Builder
+	switch detail {
+	case SeedDetailFull:
+		sum := strings.TrimSpace(ts.Summary)
+		if sum == "" {
+			return ""
+		}
+		fmt.Fprintf(&b, "## %s\n\n%s\n\n", heading, sum)
+		if kps := nonEmpty(ts.KeyPoints); len(kps) > 0 {
+			for _, kp := range kps {
+				fmt.Fprintf(&b, "- %s\n", escapeMarkdownInline(kp))
+			}
+			b.WriteString("\n")
+		}
+		if len(ts.OpenItems) > 0 {
+			b.WriteString("Open:\n")
+			for _, it := range ts.OpenItems {
+				if text := escapeMarkdownInline(it.Text); text != "" {
+					fmt.Fprintf(&b, "- (%s) %s\n", it.Kind, text)
+				}
+			}
+			b.WriteString("\n")
+		}
+		if tags := dedupeStrings(ts.Tags); len(tags) > 0 {
+			fmt.Fprintf(&b, "Tags: %s\n\n", escapeMarkdownInline(strings.Join(tags, ", ")))
+		}
+	case SeedDetailBrief:
+		if blurb == "" {
+			return ""
+		}
+		fmt.Fprintf(&b, "## %s\n\n%s\n\n", heading, blurb)
+		if tags := dedupeStrings(ts.Tags); len(tags) > 0 {
+			fmt.Fprintf(&b, "Tags: %s\n\n", escapeMarkdownInline(strings.Join(tags, ", ")))
+		}
+	case SeedDetailLine:
+		if blurb == "" {
+			fmt.Fprintf(&b, "- %s\n", heading)
+		} else {
+			fmt.Fprintf(&b, "- %s: %s\n", heading, blurb)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,97 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func seedThread(id string, start float64, tags []string, keyPoints int) ThreadSummary {
+	ts := ThreadSummary{
+		ConversationID: id,
+		Title:          "Thread " + id,
+		ThreadStart:    &start,
+		Summary:        strings.Repeat("Summary of "+id+". ", 20),
+		MicroSummary:   "Micro " + id + ".",
+		Tags:           tags,
+	}
+	for i := 0; i < keyPoints; i++ {
+		ts.KeyPoints = append(ts.KeyPoints, fmt.Sprintf("point %d of %s", i, id))
+	}
+	return ts
+}
+
+func TestRankMemorySeed_PrefersImportanceThenCoverage(t *testing.T) {
+	t.Parallel()
+
+	opt := MemorySeedOptions{ImportanceWeight: 1, CoverageWeight: 1}
+	order, _ := RankMemorySeed([]ThreadSummary{
+		seedThread("a", 1, []string{"go", "pipeline"}, 2),
+		seedThread("b", 1, []string{"go", "pipeline"}, 6),
+		seedThread("c", 1, []string{"gardening"}, 2),
+	}, opt)
+	var got []string
+	for _, ts := range order {
+		got = append(got, ts.ConversationID)
+	}
+	// b has the most key points; c then wins over a because a's tags are already covered.
+	if strings.Join(got, ",") != "b,c,a" {
+		t.Fatalf("order=%v", got)
+	}
+}
+
+func TestRankMemorySeed_Recency(t *testing.T) {
+	t.Parallel()
+
+	day := (24 * time.Hour).Seconds()
+	opt := MemorySeedOptions{RecencyWeight: 1, RecencyHalfLife: 30 * 24 * time.Hour}
+	order, scores := RankMemorySeed([]ThreadSummary{
+		seedThread("old", 1_700_000_000, nil, 1),
+		seedThread("new", 1_700_000_000+60*day, nil, 1),
+	}, opt)
+	if order[0].ConversationID != "new" {
+		t.Fatalf("first=%s", order[0].ConversationID)
+	}
+	if scores[0] != 1 || scores[1] != 0.25 {
+		t.Fatalf("scores=%v", scores)
+	}
+}
+
+func TestBuildMemorySeed_StaysUnderBudgetAndDegrades(t *testing.T) {
+	t.Parallel()
+
+	var threads []ThreadSummary
+	for i := 0; i < 120; i++ {
+		threads = append(threads, seedThread(fmt.Sprintf("t%03d", i), float64(1_700_000_000+i), []string{fmt.Sprintf("tag%d", i)}, 3))
+	}
+	opt := DefaultMemorySeedOptions()
+	opt.MaxTokens = 1500
+	seed := BuildMemorySeed(threads, opt)
+
+	if seed.Tokens > opt.MaxTokens {
+		t.Fatalf("tokens=%d > %d", seed.Tokens, opt.MaxTokens)
+	}
+	counts := seed.DetailCounts()
+	if counts[SeedDetailFull] == 0 || counts[SeedDetailLine] == 0 {
+		t.Fatalf("counts=%v", counts)
+	}
+	if len(seed.Entries)+seed.Dropped != len(threads) {
+		t.Fatalf("entries=%d dropped=%d", len(seed.Entries), seed.Dropped)
+	}
+	if !strings.HasPrefix(seed.Markdown, "# Memory seed\n") || !strings.Contains(seed.Markdown, "## Also remembered") {
+		t.Fatalf("markdown=%q", seed.Markdown)
+	}
+	if seed.Entries[0].Detail != SeedDetailFull {
+		t.Fatalf("first entry detail=%s", seed.Entries[0].Detail)
+	}
+}
+
+func TestBuildMemorySeed_Empty(t *testing.T) {
+	t.Parallel()
+
+	seed := BuildMemorySeed(nil, DefaultMemorySeedOptions())
+	if len(seed.Entries) != 0 || seed.Dropped != 0 || !strings.HasPrefix(seed.Markdown, "# Memory seed") {
+		t.Fatalf("seed=%+v", seed)
+	}
+}
@@ -0,0 +1,119 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultCompressChars is how much of a compressed message's text MessageFilter keeps by default.
+const DefaultCompressChars = 200
+
+// MessageMatch selects messages by role and content type, matched case-insensitively; an empty field
+// matches anything.
+type MessageMatch struct {
+	Role        string
+	ContentType string
+}
+
+func (m MessageMatch) matches(msg SimplifiedMessage) bool {
+	return (m.Role == "" || strings.EqualFold(m.Role, msg.Role)) &&
+		(m.ContentType == "" || strings.EqualFold(m.ContentType, msg.ContentType))
+}
+
+func (m MessageMatch) String() string {
+	switch {
+	case m.ContentType == "":
+		return m.Role
+	case m.Role == "":
+		return "*/" + m.ContentType
+	}
+	return m.Role + "/" + m.ContentType
+}
+
+// ParseMessageMatches parses comma-separated role[/content_type] entries, with * for any role (e.g.
+// "tool,assistant/thoughts,*/reasoning_recap").
+func ParseMessageMatches(s string) ([]MessageMatch, error) {
+	var out []MessageMatch
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		role, ct, hasCT := strings.Cut(entry, "/")
+		role, ct = strings.ToLower(strings.TrimSpace(role)), strings.ToLower(strings.TrimSpace(ct))
+		if role == "*" {
+			role = ""
+		}
+		if (hasCT && ct == "") || (role == "" && ct == "") {
+			return nil, fmt.Errorf("message match %q: want role, role/content_type, or */content_type", entry)
+		}
+		out = append(out, MessageMatch{Role: role, ContentType: ct})
+	}
+	return out, nil
+}
+
+// MessageFilter drops or shortens messages by role and content type as chunks are built, so tool
+// output or reasoning traces stop costing summarizer tokens without editing the split threads.
+type MessageFilter struct {
+	// Drop removes matching messages.
+	Drop []MessageMatch
+	// Compress cuts the text of matching messages (not dropped) to CompressChars runes.
+	Compress []MessageMatch
+	// CompressChars defaults to DefaultCompressChars.
+	CompressChars int
+}
+
+// Validate rejects dropping user messages. They lead turns, so dropping them would change a thread's
+// turn count and break resume and cached breakpoints; Apply keeps them even when a */content_type
+// entry matches.
+func (f MessageFilter) Validate() error {
+	for _, m := range f.Drop {
+		if strings.EqualFold(m.Role, "user") {
+			return fmt.Errorf("cannot drop %s: user messages lead turns (compress them instead)", m)
+		}
+	}
+	if f.CompressChars < 0 {
+		return errors.New("compress-chars must be >= 0")
+	}
+	return nil
+}
+
+// Empty reports whether the filter leaves every message alone.
+func (f MessageFilter) Empty() bool { return len(f.Drop) == 0 && len(f.Compress) == 0 }
+
+// Apply returns msgs with matching messages dropped or compressed, and how many of each. msgs is not
+// modified.
+func (f MessageFilter) Apply(msgs []SimplifiedMessage) (out []SimplifiedMessage, dropped, compressed int) {
+	if f.Empty() {
+		return msgs, 0, 0
+	}
+	limit := f.CompressChars
+	if limit <= 0 {
+		limit = DefaultCompressChars
+	}
+	out = make([]SimplifiedMessage, 0, len(msgs))
+	for _, m := range msgs {
+		if m.Role != "user" && anyMatch(f.Drop, m) {
+			dropped++
+			continue
+		}
+		if anyMatch(f.Compress, m) {
+			if r := []rune(strings.TrimSpace(m.Text)); len(r) > limit {
+				m.Text = fmt.Sprintf("%s… [%d more chars]", string(r[:limit]), len(r)-limit)
+				compressed++
+			}
+		}
+		out = append(out, m)
+	}
+	return out, dropped, compressed
+}
+
+func anyMatch(ms []MessageMatch, msg SimplifiedMessage) bool {
+	for _, m := range ms {
+		if m.matches(msg) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+func TestParseMessageMatches(t *testing.T) {
+	t.Parallel()
+
+	ms, err := ParseMessageMatches(" Tool, assistant/Thoughts ,*/reasoning_recap,")
+	if err != nil {
+		t.Fatalf("ParseMessageMatches: %v", err)
+	}
+	want := []MessageMatch{{Role: "tool"}, {Role: "assistant", ContentType: "thoughts"}, {ContentType: "reasoning_recap"}}
+	if len(ms) != len(want) {
+		t.Fatalf("matches=%+v", ms)
+	}
+	for i := range want {
+		if ms[i] != want[i] {
+			t.Fatalf("matches[%d]=%+v, want %+v", i, ms[i], want[i])
+		}
+	}
+	for _, bad := range []string{"*", "tool/", "/", "*/"} {
+		if _, err := ParseMessageMatches(bad); err == nil {
+			t.Fatalf("ParseMessageMatches(%q): expected error", bad)
+		}
+	}
+	if err := (MessageFilter{Drop: []MessageMatch{{Role: "User"}}}).Validate(); err == nil {
+		t.Fatalf("expected error for dropping user messages")
+	}
+}
+
+func TestChunkThread_FiltersMessages(t *testing.T) {
+	t.Parallel()
+
+	thread := SimplifiedConversation{
+		ConversationID: "c1",
+		Messages: []SimplifiedMessage{
+			{Role: "user", Text: "plot it"},
+			{Role: "assistant", ContentType: "thoughts", Text: "thinking"},
+			{Role: "tool", Name: "python", ContentType: "execution_output", Text: strings.Repeat("x", 50)},
+			{Role: "assistant", Text: "done"},
+			{Role: "user", ContentType: "thoughts", Text: "kept"},
+			{Role: "tool", Name: "python", ContentType: "execution_output", Text: "short"},
+		},
+	}
+	b, err := json.Marshal(thread)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	inPath := filepath.Join(t.TempDir(), "thread.json")
+	if err := os.WriteFile(inPath, b, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	outDir := filepath.Join(t.TempDir(), "chunks")
+	written, err := ChunkThread(context.Background(), inPath, fakeDecider{}, 20, ChunkOptions{
+		OutputDir: outDir,
+		Filter: MessageFilter{
+			Drop:          []MessageMatch{{ContentType: "thoughts"}},
+			Compress:      []MessageMatch{{Role: "tool", ContentType: "execution_output"}},
+			CompressChars: 10,
+		},
+	})
+	if err != nil {
+		t.Fatalf("ChunkThread: %v", err)
+	}
+	if len(written) != 1 {
+		t.Fatalf("written=%v", written)
+	}
+	var ch Chunk
+	if err := fileutils.ReadArtifact(written[0], &ch); err != nil {
+		t.Fatalf("read chunk: %v", err)
+	}
+	var got []string
+	for _, m := range ch.Messages {
+		got = append(got, m.Role+":"+m.Text)
+	}
+	want := "user:plot it|tool:xxxxxxxxxx… [40 more chars]|assistant:done|user:kept|tool:short"
+	if strings.Join(got, "|") != want || ch.TurnEnd != 2 {
+		t.Fatalf("messages=%q turn_end=%d, want %q and 2", strings.Join(got, "|"), ch.TurnEnd, want)
+	}
+
+	// The source thread is untouched, and resume still sees it fully chunked.
+	if done, err := ThreadChunked(inPath, outDir); err != nil || !done {
+		t.Fatalf("ThreadChunked=%v err=%v, want true", done, err)
+	}
+}
@@ -0,0 +1,210 @@
+package migration
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+// OpenThreadsFileName is the open-items tracker thread-rollup writes next to thread_index.json.
+const OpenThreadsFileName = "open_threads.jsonl"
+
+// Open item kinds.
+const (
+	OpenItemQuestion = "question"
+	OpenItemTodo     = "todo"
+)
+
+// Open item statuses. Rollups only ever produce OpenThreadOpen; the others are set by hand (with the
+// open-threads command) and survive later rebuilds.
+const (
+	OpenThreadOpen    = "open"
+	OpenThreadDone    = "done"
+	OpenThreadDropped = "dropped"
+)
+
+// OpenThread is one row of open_threads.jsonl: an open item from a thread rollup plus its tracking state.
+type OpenThread struct {
+	// ID is stable across rebuilds for the same thread and item text; see OpenThreadID.
+	ID             string   `json:"id"`
+	ConversationID string   `json:"conversation_id"`
+	Title          string   `json:"title,omitempty"`
+	Project        string   `json:"project,omitempty"`
+	ThreadStart    *float64 `json:"thread_start_time,omitempty"`
+
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+
+	Status string `json:"status"`
+	// FirstSeen is when the item was first extracted; StatusAt is when its status last changed by hand.
+	FirstSeen string `json:"first_seen"`
+	StatusAt  string `json:"status_at,omitempty"`
+	Note      string `json:"note,omitempty"`
+
+	ThreadSummaryPath string `json:"thread_summary_path"`
+}
+
+// IsOpenThreadStatus reports whether s is a known open item status.
+func IsOpenThreadStatus(s string) bool {
+	switch s {
+	case OpenThreadOpen, OpenThreadDone, OpenThreadDropped:
+		return true
+	}
+	return false
+}
+
+// OpenThreadID derives an item's ID from its thread and its text, ignoring case and spacing, so a
+// regenerated rollup that restates the same item keeps its status.
+func OpenThreadID(conversationID, text string) string {
+	norm := strings.ToLower(strings.Join(strings.Fields(text), " "))
+	sum := sha256.Sum256([]byte(conversationID + "\x00" + norm))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// BuildOpenThreads returns the tracker rows for one thread rollup, in rollup order, with status open.
+func BuildOpenThreads(ts ThreadSummary, threadSummaryPath string) []OpenThread {
+	var out []OpenThread
+	seen := map[string]bool{}
+	for _, it := range ts.OpenItems {
+		text := strings.TrimSpace(it.Text)
+		if text == "" {
+			continue
+		}
+		id := OpenThreadID(ts.ConversationID, text)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		kind := it.Kind
+		if kind != OpenItemQuestion {
+			kind = OpenItemTodo
+		}
+		out = append(out, OpenThread{
+			ID:                id,
+			ConversationID:    ts.ConversationID,
+			Title:             ts.Title,
+			Project:           ts.Project,
+			ThreadStart:       ts.ThreadStart,
+			Kind:              kind,
+			Text:              text,
+			Status:            OpenThreadOpen,
+			ThreadSummaryPath: threadSummaryPath,
+		})
+	}
+	return out
+}
+
+// MergeOpenThreads carries status, notes and first-seen times from the previous tracker onto freshly
+// built rows. Items no longer present in any rollup are dropped. New items are stamped with now.
+func MergeOpenThreads(prev, current []OpenThread, now time.Time) []OpenThread {
+	byID := make(map[string]OpenThread, len(prev))
+	for _, p := range prev {
+		byID[p.ID] = p
+	}
+	stamp := now.UTC().Format(time.RFC3339)
+	out := make([]OpenThread, 0, len(current))
+	for _, c := range current {
+		if p, ok := byID[c.ID]; ok {
+			c.FirstSeen = p.FirstSeen
+			if IsOpenThreadStatus(p.Status) {
+				c.Status = p.Status
+			}
+			c.StatusAt, c.Note = p.StatusAt, p.Note
+		}
+		if c.FirstSeen == "" {
+			c.FirstSeen = stamp
+		}
+		out = append(out, c)
+	}
+	sortOpenThreads(out)
+	return out
+}
+
+// sortOpenThreads orders rows by thread start (undated last), then thread, keeping rollup order within a thread.
+func sortOpenThreads(rows []OpenThread) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if (a.ThreadStart == nil) != (b.ThreadStart == nil) {
+			return a.ThreadStart != nil
+		}
+		if a.ThreadStart != nil && *a.ThreadStart != *b.ThreadStart {
+			return *a.ThreadStart < *b.ThreadStart
+		}
+		return a.ConversationID < b.ConversationID
+	})
+}
+
+// ReadOpenThreads reads open_threads.jsonl from fsys. A missing file yields no rows.
+func ReadOpenThreads(fsys fs.FS, path string) ([]OpenThread, error) {
+	b, err := fs.ReadFile(fsys, fileutils.FSPath(fsys, path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read open threads: %w", err)
+	}
+	var out []OpenThread
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var row OpenThread
+		if err := json.Unmarshal(line, &row); err != nil {
+			return nil, fmt.Errorf("read open threads: %s line %d: %w", path, n, err)
+		}
+		out = append(out, row)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read open threads: %w", err)
+	}
+	return out, nil
+}
+
+// WriteOpenThreads atomically replaces open_threads.jsonl with rows.
+func WriteOpenThreads(path string, rows []OpenThread) error {
+	var b bytes.Buffer
+	for _, row := range rows {
+		line, err := json.Marshal(row)
+		if err != nil {
+			return fmt.Errorf("write open threads: %w", err)
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	if err := fileutils.WriteFileAtomicSameDir(path, b.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write open threads: %w", err)
+	}
+	return nil
+}
+
+// UpdateOpenThreads applies fn to the tracker at path under a lock, so a status change made with the
+// open-threads command is not lost to a concurrent thread-rollup rebuild.
+func UpdateOpenThreads(path string, fn func([]OpenThread) ([]OpenThread, error)) error {
+	unlock, err := fileutils.LockPath(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	rows, err := ReadOpenThreads(fileutils.OS, path)
+	if err != nil {
+		return err
+	}
+	rows, err = fn(rows)
+	if err != nil {
+		return err
+	}
+	return WriteOpenThreads(path, rows)
+}
@@ -0,0 +1,84 @@
+package migration
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+func TestBuildOpenThreads_StableIDsAndKinds(t *testing.T) {
+	t.Parallel()
+
+	start := 1700000000.0
+	ts := ThreadSummary{
+		ConversationID: "c1",
+		Title:          "Garden plans",
+		ThreadStart:    &start,
+		OpenItems: []OpenItem{
+			{Kind: "question", Text: "Which tomatoes survive frost?"},
+			{Kind: "someday", Text: " Build a  cold frame "},
+			{Kind: "todo", Text: "build a cold frame"},
+			{Kind: "todo", Text: "  "},
+		},
+	}
+	rows := BuildOpenThreads(ts, "c1.thread.summary.json")
+	if len(rows) != 2 {
+		t.Fatalf("rows=%+v", rows)
+	}
+	if rows[0].Kind != OpenItemQuestion || rows[1].Kind != OpenItemTodo || rows[1].Text != "Build a  cold frame" {
+		t.Fatalf("rows=%+v", rows)
+	}
+	if rows[1].ID != OpenThreadID("c1", "build a cold frame") || rows[1].ID == OpenThreadID("c2", "build a cold frame") {
+		t.Fatalf("ID=%q not stable per thread", rows[1].ID)
+	}
+	if rows[0].Status != OpenThreadOpen || rows[0].Title != "Garden plans" {
+		t.Fatalf("row=%+v", rows[0])
+	}
+}
+
+func TestMergeOpenThreads_KeepsHandSetStatus(t *testing.T) {
+	t.Parallel()
+
+	early, late := 100.0, 200.0
+	prev := []OpenThread{
+		{ID: "keep", Status: OpenThreadDone, FirstSeen: "2024-01-01T00:00:00Z", StatusAt: "2024-02-01T00:00:00Z", Note: "shipped"},
+		{ID: "gone", Status: OpenThreadOpen, FirstSeen: "2024-01-01T00:00:00Z"},
+	}
+	current := []OpenThread{
+		{ID: "new", ConversationID: "b", ThreadStart: &late, Status: OpenThreadOpen},
+		{ID: "keep", ConversationID: "a", ThreadStart: &early, Status: OpenThreadOpen},
+		{ID: "undated", ConversationID: "c", Status: OpenThreadOpen},
+	}
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	got := MergeOpenThreads(prev, current, now)
+	if len(got) != 3 || got[0].ID != "keep" || got[1].ID != "new" || got[2].ID != "undated" {
+		t.Fatalf("got=%+v", got)
+	}
+	if got[0].Status != OpenThreadDone || got[0].Note != "shipped" || got[0].FirstSeen != "2024-01-01T00:00:00Z" {
+		t.Fatalf("kept=%+v", got[0])
+	}
+	if got[1].Status != OpenThreadOpen || got[1].FirstSeen != "2024-03-01T00:00:00Z" {
+		t.Fatalf("new=%+v", got[1])
+	}
+}
+
+func TestUpdateOpenThreads_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), OpenThreadsFileName)
+	rows, err := ReadOpenThreads(fileutils.OS, path)
+	if err != nil || len(rows) != 0 {
+		t.Fatalf("missing file: rows=%v err=%v", rows, err)
+	}
+	if err := UpdateOpenThreads(path, func(rows []OpenThread) ([]OpenThread, error) {
+		return append(rows, OpenThread{ID: "x", ConversationID: "c", Kind: OpenItemTodo, Text: "call the plumber", Status: OpenThreadOpen}), nil
+	}); err != nil {
+		t.Fatalf("UpdateOpenThreads: %v", err)
+	}
+	rows, err = ReadOpenThreads(fileutils.OS, path)
+	if err != nil || len(rows) != 1 || rows[0].Text != "call the plumber" {
+		t.Fatalf("rows=%+v err=%v", rows, err)
+	}
+}
@@ -0,0 +1,134 @@
+package migration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+// OverridesDirName is the conventional directory (under the threads dir) for hand-written corrections.
+const OverridesDirName = "overrides"
+
+// Overrides holds hand-written partial JSON corrections keyed by conversation_id. They are deep-merged
+// over generated thread rollups when indices and memory packs are built, so corrections survive
+// regeneration of the underlying artifacts.
+//
+// In the overrides directory, <conversation_id>.json patches the semantic ThreadSummary and
+// <conversation_id>.sentiment.json patches the ThreadSentimentSummary. A nil *Overrides applies nothing.
+type Overrides struct {
+	Semantic  map[string]map[string]any
+	Sentiment map[string]map[string]any
+}
+
+// LoadOverrides reads every override file in dir on fsys. A missing directory yields empty overrides.
+func LoadOverrides(fsys fs.FS, dir string) (*Overrides, error) {
+	o := &Overrides{Semantic: map[string]map[string]any{}, Sentiment: map[string]map[string]any{}}
+	if dir == "" {
+		return o, nil
+	}
+	entries, err := fs.ReadDir(fsys, fileutils.FSPath(fsys, dir))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return o, nil
+		}
+		return nil, fmt.Errorf("LoadOverrides: %w", err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(strings.ToLower(e.Name()), ".json") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := fileutils.JoinFS(fsys, dir, name)
+		b, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return nil, fmt.Errorf("LoadOverrides: %w", err)
+		}
+		var patch map[string]any
+		if err := json.Unmarshal(b, &patch); err != nil {
+			return nil, fmt.Errorf("LoadOverrides: parse %s: %w", path, err)
+		}
+		stem := name[:len(name)-len(".json")]
+		if id, ok := strings.CutSuffix(stem, ".sentiment"); ok {
+			o.Sentiment[id] = patch
+		} else {
+			o.Semantic[stem] = patch
+		}
+	}
+	return o, nil
+}
+
+// Len returns the number of loaded override files.
+func (o *Overrides) Len() int {
+	if o == nil {
+		return 0
+	}
+	return len(o.Semantic) + len(o.Sentiment)
+}
+
+// ApplySemantic merges the override for ts.ConversationID (if any) into ts.
+func (o *Overrides) ApplySemantic(ts *ThreadSummary) error {
+	if o == nil || ts == nil {
+		return nil
+	}
+	return applyOverride(o.Semantic[ts.ConversationID], ts)
+}
+
+// ApplySentiment merges the sentiment override for ts.ConversationID (if any) into ts.
+func (o *Overrides) ApplySentiment(ts *ThreadSentimentSummary) error {
+	if o == nil || ts == nil {
+		return nil
+	}
+	return applyOverride(o.Sentiment[ts.ConversationID], ts)
+}
+
+func applyOverride(patch map[string]any, v any) error {
+	if len(patch) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("applyOverride: marshal: %w", err)
+	}
+	var base map[string]any
+	if err := json.Unmarshal(b, &base); err != nil {
+		return fmt.Errorf("applyOverride: decode: %w", err)
+	}
+	merged, err := json.Marshal(DeepMerge(base, patch))
+	if err != nil {
+		return fmt.Errorf("applyOverride: marshal merged: %w", err)
+	}
+	if err := json.Unmarshal(merged, v); err != nil {
+		return fmt.Errorf("applyOverride: %w", err)
+	}
+	return nil
+}
+
+// DeepMerge merges patch into dst and returns dst. Nested objects merge recursively, a null in patch
+// deletes the key, and any other value (including arrays) replaces the destination value.
+func DeepMerge(dst, patch map[string]any) map[string]any {
+	if dst == nil {
+		dst = map[string]any{}
+	}
+	for k, pv := range patch {
+		if pv == nil {
+			delete(dst, k)
+			continue
+		}
+		if pm, ok := pv.(map[string]any); ok {
+			if dm, ok := dst[k].(map[string]any); ok {
+				dst[k] = DeepMerge(dm, pm)
+				continue
+			}
+		}
+		dst[k] = pv
+	}
+	return dst
+}
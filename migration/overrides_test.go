@@ -0,0 +1,84 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+func TestDeepMerge(t *testing.T) {
+	t.Parallel()
+
+	dst := map[string]any{
+		"summary": "old",
+		"tags":    []any{"a", "b"},
+		"meta":    map[string]any{"keep": 1.0, "replace": "x"},
+		"drop":    "me",
+	}
+	patch := map[string]any{
+		"tags": []any{"c"},
+		"meta": map[string]any{"replace": "y", "add": true},
+		"drop": nil,
+	}
+	got := DeepMerge(dst, patch)
+	want := map[string]any{
+		"summary": "old",
+		"tags":    []any{"c"},
+		"meta":    map[string]any{"keep": 1.0, "replace": "y", "add": true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got=%v", got)
+	}
+}
+
+func TestLoadOverrides_AppliesBySuffix(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "c1.json"), []byte(`{"title":"Fixed","key_points":["only this"]}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "c1.sentiment.json"), []byte(`{"emotional_arc":"calmer"}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	o, err := LoadOverrides(fileutils.OS, dir)
+	if err != nil {
+		t.Fatalf("LoadOverrides: %v", err)
+	}
+	if o.Len() != 2 {
+		t.Fatalf("Len=%d", o.Len())
+	}
+
+	ts := ThreadSummary{ConversationID: "c1", Title: "Generated", Summary: "s", KeyPoints: []string{"a", "b"}}
+	if err := o.ApplySemantic(&ts); err != nil {
+		t.Fatalf("ApplySemantic: %v", err)
+	}
+	if ts.Title != "Fixed" || ts.Summary != "s" || !reflect.DeepEqual(ts.KeyPoints, []string{"only this"}) {
+		t.Fatalf("ts=%+v", ts)
+	}
+
+	ss := ThreadSentimentSummary{ConversationID: "c1", EmotionalArc: "tense", EmotionalSummary: "e"}
+	if err := o.ApplySentiment(&ss); err != nil {
+		t.Fatalf("ApplySentiment: %v", err)
+	}
+	if ss.EmotionalArc != "calmer" || ss.EmotionalSummary != "e" {
+		t.Fatalf("ss=%+v", ss)
+	}
+
+	other := ThreadSummary{ConversationID: "c2", Title: "Untouched"}
+	if err := o.ApplySemantic(&other); err != nil || other.Title != "Untouched" {
+		t.Fatalf("other=%+v err=%v", other, err)
+	}
+
+	var none *Overrides
+	if err := none.ApplySemantic(&ts); err != nil {
+		t.Fatalf("nil overrides: %v", err)
+	}
+	if o, err := LoadOverrides(fileutils.OS, filepath.Join(dir, "missing")); err != nil || o.Len() != 0 {
+		t.Fatalf("missing dir: o=%v err=%v", o, err)
+	}
+}
@@ -0,0 +1,72 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Participant is one named speaker in a conversation.
+type Participant struct {
+	Speaker  string `json:"speaker"`
+	Role     string `json:"role"`
+	Messages int    `json:"messages"`
+}
+
+// MessageParticipants lists the distinct (speaker, role) pairs among msgs in order of first
+// appearance, with message counts. It is nil when no message names its speaker, which is the case
+// for ordinary one-user exports.
+func MessageParticipants(msgs []SimplifiedMessage) []Participant {
+	var out []Participant
+	idx := map[[2]string]int{}
+	for _, m := range msgs {
+		if m.Speaker == "" {
+			continue
+		}
+		k := [2]string{m.Speaker, m.Role}
+		i, ok := idx[k]
+		if !ok {
+			i = len(out)
+			idx[k] = i
+			out = append(out, Participant{Speaker: m.Speaker, Role: m.Role})
+		}
+		out[i].Messages++
+	}
+	return out
+}
+
+// ParticipantsLine renders participants for a prompt header: "Alice (user), Bob (user), Helper
+// (assistant)". Empty when there are none.
+func ParticipantsLine(ps []Participant) string {
+	parts := make([]string, 0, len(ps))
+	for _, p := range ps {
+		parts = append(parts, p.Speaker+" ("+p.Role+")")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ParseRoleMap parses "from=to" pairs separated by commas (e.g. "human=user,bot=assistant") into a
+// role map for SplitOptions.RoleMap.
+func ParseRoleMap(s string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(pair, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("role map entry %q: want from=to", pair)
+		}
+		out[strings.ToLower(from)] = to
+	}
+	return out, nil
+}
+
+func lookupRole(roleMap map[string]string, role string) (string, bool) {
+	if len(roleMap) == 0 {
+		return "", false
+	}
+	mapped, ok := roleMap[strings.ToLower(role)]
+	return mapped, ok
+}
@@ -0,0 +1,76 @@
+package migration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMessageParticipants(t *testing.T) {
+	t.Parallel()
+
+	msgs := []SimplifiedMessage{
+		{Role: "user", Speaker: "Alice"},
+		{Role: "assistant"},
+		{Role: "user", Speaker: "Bob"},
+		{Role: "user", Speaker: "Alice"},
+		{Role: "tool", Name: "browser"},
+	}
+	got := MessageParticipants(msgs)
+	if len(got) != 2 || got[0] != (Participant{Speaker: "Alice", Role: "user", Messages: 2}) || got[1].Speaker != "Bob" {
+		t.Fatalf("got=%+v", got)
+	}
+	if line := ParticipantsLine(got); line != "Alice (user), Bob (user)" {
+		t.Fatalf("line=%q", line)
+	}
+	if got := MessageParticipants([]SimplifiedMessage{{Role: "user"}, {Role: "assistant"}}); got != nil {
+		t.Fatalf("unnamed speakers: got=%+v", got)
+	}
+}
+
+func TestParseRoleMap(t *testing.T) {
+	t.Parallel()
+
+	m, err := ParseRoleMap(" Human=user, bot = assistant ,")
+	if err != nil {
+		t.Fatalf("ParseRoleMap: %v", err)
+	}
+	if len(m) != 2 || m["human"] != "user" || m["bot"] != "assistant" {
+		t.Fatalf("m=%v", m)
+	}
+	for _, bad := range []string{"human", "=user", "human="} {
+		if _, err := ParseRoleMap(bad); err == nil {
+			t.Fatalf("%q: expected error", bad)
+		}
+	}
+}
+
+func TestSplitConversationArchive_GroupChatSpeakers(t *testing.T) {
+	t.Parallel()
+
+	in := `[{"title":"G","conversation_id":"g1","current_node":"m3","mapping":{` +
+		`"m1":{"id":"m1","message":{"author":{"role":"human","name":"Alice"},"create_time":1,"content":{"content_type":"text","parts":["lunch?"]}},"parent":null,"children":["m2"]},` +
+		`"m2":{"id":"m2","message":{"author":{"role":"Human","name":"Bob"},"create_time":2,"content":{"content_type":"text","parts":["yes"]}},"parent":"m1","children":["m3"]},` +
+		`"m3":{"id":"m3","message":{"author":{"role":"bot","name":null},"create_time":3,"content":{"content_type":"text","parts":["booked"]}},"parent":"m2","children":[]}}}]`
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "in.json")
+	if err := os.WriteFile(inPath, []byte(in), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	outDir := filepath.Join(dir, "out")
+	if _, err := SplitConversationArchive(context.Background(), inPath, outDir, SplitOptions{RoleMap: map[string]string{"human": "user", "bot": "assistant"}}); err != nil {
+		t.Fatalf("SplitConversationArchive: %v", err)
+	}
+
+	got := readSimplifiedConversation(t, filepath.Join(outDir, "g1.json"))
+	if len(got.Messages) != 3 || got.Messages[0].Role != "user" || got.Messages[0].Speaker != "Alice" || got.Messages[1].Speaker != "Bob" || got.Messages[2].Role != "assistant" {
+		t.Fatalf("messages=%+v", got.Messages)
+	}
+	if len(got.Participants) != 2 || got.Participants[1].Speaker != "Bob" {
+		t.Fatalf("participants=%+v", got.Participants)
+	}
+	if turns := BuildTurns(got); len(turns) != 2 {
+		t.Fatalf("turns=%d, want one per human message", len(turns))
+	}
+}
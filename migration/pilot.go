@@ -0,0 +1,227 @@
+package migration
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+const (
+	// PilotIDsFileName lists the conversations a pilot run splits, one ID per line.
+	PilotIDsFileName = "pilot_ids.txt"
+	// PilotProjectionFileName holds the pilot's measured usage and the whole-archive projection.
+	PilotProjectionFileName = "pilot_projection.json"
+)
+
+// PilotCandidate is what pilot sampling knows about one conversation in the export.
+type PilotCandidate struct {
+	ConversationID string
+	// Year is the conversation's creation year (0 when the export has no create_time).
+	Year int
+	// TextBytes is the message text that would be carried into the thread file.
+	TextBytes int64
+}
+
+// ProfileArchive streams the exports once and returns one candidate per conversation that
+// SplitConversationArchives would write, in export order. Like the split, a conversation present in
+// several exports is counted once.
+func ProfileArchive(ctx context.Context, inputPaths []string, opts SplitOptions) ([]PilotCandidate, error) {
+	var newest map[string]int
+	if len(inputPaths) > 1 {
+		var err error
+		if newest, err = newestSources(ctx, inputPaths, opts.ArrayField); err != nil {
+			return nil, err
+		}
+	}
+	var out []PilotCandidate
+	for i, inputPath := range inputPaths {
+		err := forEachConversation(ctx, inputPath, opts.ArrayField, func(raw json.RawMessage) error {
+			conv, id, err := simplifyConversation(raw, opts)
+			if err != nil {
+				return err
+			}
+			if newest != nil && newest[id] != i {
+				return nil
+			}
+			c := PilotCandidate{ConversationID: id}
+			if conv.CreateTime != nil {
+				c.Year = time.Unix(int64(*conv.CreateTime), 0).UTC().Year()
+			}
+			for _, m := range conv.Messages {
+				c.TextBytes += int64(len(m.Text))
+			}
+			out = append(out, c)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// SamplePilot picks n conversation IDs that represent the archive: candidates are grouped by year and
+// by length tercile (short, medium, long text), each group gets a share of n proportional to its size
+// (largest remainders first), and within a group the picks are spread evenly across its length range.
+// The choice is deterministic. All IDs are returned when n covers the archive.
+func SamplePilot(cands []PilotCandidate, n int) []string {
+	if n <= 0 || len(cands) == 0 {
+		return nil
+	}
+	sorted := append([]PilotCandidate(nil), cands...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].TextBytes != sorted[j].TextBytes {
+			return sorted[i].TextBytes < sorted[j].TextBytes
+		}
+		return sorted[i].ConversationID < sorted[j].ConversationID
+	})
+	if n >= len(sorted) {
+		ids := make([]string, len(sorted))
+		for i, c := range sorted {
+			ids[i] = c.ConversationID
+		}
+		return ids
+	}
+
+	// Strata in (year, tercile) order; members stay sorted by length.
+	type stratum struct {
+		year, tercile int
+		members       []PilotCandidate
+		quota         int
+		remainder     float64
+	}
+	index := map[[2]int]*stratum{}
+	var strata []*stratum
+	for rank, c := range sorted {
+		key := [2]int{c.Year, rank * 3 / len(sorted)}
+		s := index[key]
+		if s == nil {
+			s = &stratum{year: key[0], tercile: key[1]}
+			index[key] = s
+			strata = append(strata, s)
+		}
+		s.members = append(s.members, c)
+	}
+	sort.Slice(strata, func(i, j int) bool {
+		if strata[i].year != strata[j].year {
+			return strata[i].year < strata[j].year
+		}
+		return strata[i].tercile < strata[j].tercile
+	})
+
+	left := n
+	for _, s := range strata {
+		share := float64(n) * float64(len(s.members)) / float64(len(sorted))
+		s.quota = int(math.Floor(share))
+		s.remainder = share - float64(s.quota)
+		left -= s.quota
+	}
+	byRemainder := append([]*stratum(nil), strata...)
+	sort.SliceStable(byRemainder, func(i, j int) bool { return byRemainder[i].remainder > byRemainder[j].remainder })
+	for _, s := range byRemainder {
+		if left == 0 {
+			break
+		}
+		if s.quota < len(s.members) {
+			s.quota++
+			left--
+		}
+	}
+
+	var ids []string
+	for _, s := range strata {
+		for k := 0; k < s.quota; k++ {
+			// The midpoint of the k-th of quota equal slices of the group.
+			ids = append(ids, s.members[(2*k+1)*len(s.members)/(2*s.quota)].ConversationID)
+		}
+	}
+	return ids
+}
+
+// PilotProjection scales a pilot run's measured usage to the whole archive by message text size,
+// which is what drives token counts.
+type PilotProjection struct {
+	SampleConversations  int   `json:"sample_conversations"`
+	ArchiveConversations int   `json:"archive_conversations"`
+	SampleTextBytes      int64 `json:"sample_text_bytes"`
+	ArchiveTextBytes     int64 `json:"archive_text_bytes"`
+
+	// Scale is ArchiveTextBytes / SampleTextBytes.
+	Scale float64 `json:"scale"`
+
+	MeasuredTokens  int64   `json:"measured_tokens"`
+	MeasuredUSD     float64 `json:"measured_usd"`
+	MeasuredSeconds float64 `json:"measured_seconds"`
+
+	ProjectedTokens  int64   `json:"projected_tokens"`
+	ProjectedUSD     float64 `json:"projected_usd"`
+	ProjectedSeconds float64 `json:"projected_seconds"`
+}
+
+// ProjectPilot builds the projection for the sampled IDs from the pilot's pipeline report. Time is
+// scaled the same way as cost, so it assumes the full run uses the pilot's concurrency settings.
+func ProjectPilot(cands []PilotCandidate, sample []string, report *PipelineReport) PilotProjection {
+	inSample := make(map[string]bool, len(sample))
+	for _, id := range sample {
+		inSample[id] = true
+	}
+	p := PilotProjection{ArchiveConversations: len(cands)}
+	for _, c := range cands {
+		p.ArchiveTextBytes += c.TextBytes
+		if inSample[c.ConversationID] {
+			p.SampleConversations++
+			p.SampleTextBytes += c.TextBytes
+		}
+	}
+	if report != nil {
+		p.MeasuredTokens = report.InputTokens + report.OutputTokens
+		p.MeasuredUSD = report.EstimatedUSD
+		p.MeasuredSeconds = report.DurationSec
+	}
+	if p.SampleTextBytes > 0 {
+		p.Scale = float64(p.ArchiveTextBytes) / float64(p.SampleTextBytes)
+	}
+	p.ProjectedTokens = int64(math.Round(float64(p.MeasuredTokens) * p.Scale))
+	p.ProjectedUSD = p.MeasuredUSD * p.Scale
+	p.ProjectedSeconds = p.MeasuredSeconds * p.Scale
+	return p
+}
+
+// WriteIDFile writes ids one per line.
+func WriteIDFile(path string, ids []string) error {
+	var b strings.Builder
+	for _, id := range ids {
+		b.WriteString(id)
+		b.WriteByte('\n')
+	}
+	return fileutils.WriteFileAtomicSameDir(path, []byte(b.String()), 0o644)
+}
+
+// ReadIDFile reads a file of IDs, one per line; blank lines and lines starting with # are ignored.
+func ReadIDFile(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read ids: %w", err)
+	}
+	defer f.Close()
+	ids := map[string]bool{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			ids[line] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read ids %s: %w", path, err)
+	}
+	return ids, nil
+}
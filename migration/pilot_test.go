@@ -0,0 +1,113 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProfileArchive_YearAndTextBytes(t *testing.T) {
+	t.Parallel()
+
+	in := `[{"title":"A","conversation_id":"c1","id":"c1","create_time":1704067200,"current_node":"m1","mapping":{"m1":{"id":"m1","message":{"author":{"role":"user"},"create_time":1,"content":{"content_type":"text","parts":["hello"]},"metadata":{}},"parent":null,"children":[]}}},{"title":"B","conversation_id":"c2","id":"c2","mapping":{}}]`
+	inPath := filepath.Join(t.TempDir(), "in.json")
+	if err := os.WriteFile(inPath, []byte(in), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	got, err := ProfileArchive(context.Background(), []string{inPath}, SplitOptions{})
+	if err != nil {
+		t.Fatalf("ProfileArchive: %v", err)
+	}
+	want := []PilotCandidate{{ConversationID: "c1", Year: 2024, TextBytes: 5}, {ConversationID: "c2"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got=%+v want %+v", got, want)
+	}
+}
+
+func TestSamplePilot_StratifiedAndDeterministic(t *testing.T) {
+	t.Parallel()
+
+	// 30 conversations in 2023 and 10 in 2024, lengths 1..N within each year.
+	var cands []PilotCandidate
+	for i := 1; i <= 30; i++ {
+		cands = append(cands, PilotCandidate{ConversationID: fmt.Sprintf("a%02d", i), Year: 2023, TextBytes: int64(i * 100)})
+	}
+	for i := 1; i <= 10; i++ {
+		cands = append(cands, PilotCandidate{ConversationID: fmt.Sprintf("b%02d", i), Year: 2024, TextBytes: int64(i * 310)})
+	}
+
+	// 6 of 8 picks come from 2023 and 2 from 2024, spread from short to long within each year.
+	ids := SamplePilot(cands, 8)
+	want := []string{"a03", "a09", "a14", "a19", "a24", "a28", "b02", "b09"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Fatalf("ids=%v want %v", ids, want)
+	}
+	if again := SamplePilot(cands, 8); !reflect.DeepEqual(again, ids) {
+		t.Fatalf("not deterministic: %v vs %v", again, ids)
+	}
+	if all := SamplePilot(cands, 100); len(all) != len(cands) {
+		t.Fatalf("len(all)=%d", len(all))
+	}
+	if SamplePilot(cands, 0) != nil || SamplePilot(nil, 3) != nil {
+		t.Fatalf("expected nil for empty sample")
+	}
+}
+
+func TestProjectPilot_ScalesByTextBytes(t *testing.T) {
+	t.Parallel()
+
+	cands := []PilotCandidate{{ConversationID: "a", TextBytes: 100}, {ConversationID: "b", TextBytes: 300}, {ConversationID: "c", TextBytes: 600}}
+	p := ProjectPilot(cands, []string{"a", "b"}, &PipelineReport{InputTokens: 800, OutputTokens: 200, EstimatedUSD: 0.5, DurationSec: 30})
+	if p.SampleConversations != 2 || p.ArchiveConversations != 3 || p.Scale != 2.5 {
+		t.Fatalf("p=%+v", p)
+	}
+	if p.ProjectedTokens != 2500 || p.ProjectedUSD != 1.25 || p.ProjectedSeconds != 75 {
+		t.Fatalf("p=%+v", p)
+	}
+}
+
+func TestIDFile_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "sub", PilotIDsFileName)
+	if err := WriteIDFile(path, []string{"c1", "c2"}); err != nil {
+		t.Fatalf("WriteIDFile: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	fmt.Fprint(f, "\n# comment\n c3 \n")
+	f.Close()
+	ids, err := ReadIDFile(path)
+	if err != nil {
+		t.Fatalf("ReadIDFile: %v", err)
+	}
+	if !reflect.DeepEqual(ids, map[string]bool{"c1": true, "c2": true, "c3": true}) {
+		t.Fatalf("ids=%v", ids)
+	}
+	if _, err := ReadIDFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Fatalf("expected error for missing file")
+	}
+}
+
+func TestSplitConversationArchive_OnlyIDs(t *testing.T) {
+	t.Parallel()
+
+	in := `[{"title":"A","conversation_id":"c1","id":"c1","mapping":{}},{"title":"B","conversation_id":"c2","id":"c2","mapping":{}}]`
+	inPath := filepath.Join(t.TempDir(), "in.json")
+	if err := os.WriteFile(inPath, []byte(in), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	outDir := filepath.Join(t.TempDir(), "out")
+	res, err := SplitConversationArchive(context.Background(), inPath, outDir, SplitOptions{OnlyIDs: map[string]bool{"c2": true}})
+	if err != nil || res.ThreadsWritten != 1 {
+		t.Fatalf("res=%+v err=%v", res, err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "c2.json")); err != nil {
+		t.Fatalf("c2.json: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/openai/openai-go/responses"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+// ExitBudgetExhausted is the exit code stages use after draining in-flight work because a spend cap
+// was reached, so orchestrators can stop instead of treating it as a crash.
+const ExitBudgetExhausted = 3
+
+// ModelPrice is the list price in USD per million tokens.
+type ModelPrice struct {
+	InputPerMTok  float64
+	OutputPerMTok float64
+}
+
+// ModelPrices holds standard-tier list prices keyed by model name prefix; the longest matching
+// prefix wins. Flex-tier requests are billed below these, so estimates err on the high side.
+var ModelPrices = map[string]ModelPrice{
+	"gpt-5":        {InputPerMTok: 1.25, OutputPerMTok: 10},
+	"gpt-5-mini":   {InputPerMTok: 0.25, OutputPerMTok: 2},
+	"gpt-5-nano":   {InputPerMTok: 0.05, OutputPerMTok: 0.40},
+	"gpt-4.1":      {InputPerMTok: 2, OutputPerMTok: 8},
+	"gpt-4.1-mini": {InputPerMTok: 0.40, OutputPerMTok: 1.60},
+	"gpt-4.1-nano": {InputPerMTok: 0.10, OutputPerMTok: 0.40},
+	"gpt-4o":       {InputPerMTok: 2.50, OutputPerMTok: 10},
+	"gpt-4o-mini":  {InputPerMTok: 0.15, OutputPerMTok: 0.60},
+	"o4-mini":      {InputPerMTok: 1.10, OutputPerMTok: 4.40},
+}
+
+// PriceFor returns the price for model, falling back to the most expensive known price so unknown
+// models never under-count spend.
+func PriceFor(model string) ModelPrice {
+	if p, ok := lookupPrefix(ModelPrices, model); ok {
+		return p
+	}
+	var worst ModelPrice
+	for _, p := range ModelPrices {
+		if p.InputPerMTok+p.OutputPerMTok > worst.InputPerMTok+worst.OutputPerMTok {
+			worst = p
+		}
+	}
+	return worst
+}
+
+// Spend is cumulative token usage and estimated cost.
+type Spend struct {
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	USD          float64 `json:"estimated_usd"`
+}
+
+// TotalTokens returns input plus output tokens.
+func (s Spend) TotalTokens() int64 {
+	return s.InputTokens + s.OutputTokens
+}
+
+// Budget tracks estimated spend against optional caps. A nil *Budget records nothing and is never
+// exceeded, so callers can use it unconditionally.
+//
+// When a ledger path is set, prior spend is loaded from it and Save persists the running total, which
+// lets separate stage processes share one cap.
+type Budget struct {
+	maxUSD    float64
+	maxTokens int64
+	ledger    string
+
+	mu    sync.Mutex
+	spend Spend
+	prior Spend
+}
+
+// NewBudget returns a Budget with the given caps (0 disables a cap) and optional ledger file.
+func NewBudget(maxUSD float64, maxTokens int64, ledgerPath string) (*Budget, error) {
+	if maxUSD < 0 || maxTokens < 0 {
+		return nil, errors.New("NewBudget: caps must be >= 0")
+	}
+	b := &Budget{maxUSD: maxUSD, maxTokens: maxTokens, ledger: ledgerPath}
+	if ledgerPath != "" {
+		raw, err := os.ReadFile(ledgerPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("NewBudget: read ledger: %w", err)
+		}
+		if err == nil && len(strings.TrimSpace(string(raw))) > 0 {
+			if err := json.Unmarshal(raw, &b.spend); err != nil {
+				return nil, fmt.Errorf("NewBudget: parse ledger: %w", err)
+			}
+			b.prior = b.spend
+		}
+	}
+	return b, nil
+}
+
+// Record adds one response's usage, priced for model.
+func (b *Budget) Record(model string, usage responses.ResponseUsage) {
+	if b == nil {
+		return
+	}
+	p := PriceFor(model)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.spend.InputTokens += usage.InputTokens
+	b.spend.OutputTokens += usage.OutputTokens
+	b.spend.USD += float64(usage.InputTokens)/1e6*p.InputPerMTok + float64(usage.OutputTokens)/1e6*p.OutputPerMTok
+}
+
+// Exceeded reports whether any configured cap has been reached.
+func (b *Budget) Exceeded() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.maxUSD > 0 && b.spend.USD >= b.maxUSD {
+		return true
+	}
+	return b.maxTokens > 0 && b.spend.TotalTokens() >= b.maxTokens
+}
+
+// Spend returns the running total.
+func (b *Budget) Spend() Spend {
+	if b == nil {
+		return Spend{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.spend
+}
+
+// SessionSpend returns spend recorded by this process, excluding anything loaded from the ledger.
+func (b *Budget) SessionSpend() Spend {
+	if b == nil {
+		return Spend{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return Spend{
+		InputTokens:  b.spend.InputTokens - b.prior.InputTokens,
+		OutputTokens: b.spend.OutputTokens - b.prior.OutputTokens,
+		USD:          b.spend.USD - b.prior.USD,
+	}
+}
+
+// Save writes the running total to the ledger file, if one is configured.
+func (b *Budget) Save() error {
+	if b == nil || b.ledger == "" {
+		return nil
+	}
+	if err := fileutils.WriteJSONFileAtomic(b.ledger, b.Spend(), true); err != nil {
+		return fmt.Errorf("Budget.Save: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package provider
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/openai/openai-go/responses"
+)
+
+func TestPriceFor_LongestPrefixAndFallback(t *testing.T) {
+	t.Parallel()
+
+	if got := PriceFor("gpt-5-mini-2025-08-07"); got != ModelPrices["gpt-5-mini"] {
+		t.Fatalf("gpt-5-mini price=%+v", got)
+	}
+	if got := PriceFor("gpt-5"); got != ModelPrices["gpt-5"] {
+		t.Fatalf("gpt-5 price=%+v", got)
+	}
+	unknown := PriceFor("some-future-model")
+	for _, p := range ModelPrices {
+		if p.InputPerMTok+p.OutputPerMTok > unknown.InputPerMTok+unknown.OutputPerMTok {
+			t.Fatalf("unknown model priced below a known model: %+v", unknown)
+		}
+	}
+}
+
+func TestBudget_CapsAndLedger(t *testing.T) {
+	t.Parallel()
+
+	ledger := filepath.Join(t.TempDir(), "spend.json")
+	b, err := NewBudget(0, 1500, ledger)
+	if err != nil {
+		t.Fatalf("NewBudget: %v", err)
+	}
+	b.Record("gpt-5-mini", responses.ResponseUsage{InputTokens: 1000, OutputTokens: 200})
+	if b.Exceeded() {
+		t.Fatalf("exceeded too early: %+v", b.Spend())
+	}
+	if err := b.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// A second process picks up the ledger and crosses the shared cap.
+	b2, err := NewBudget(0, 1500, ledger)
+	if err != nil {
+		t.Fatalf("NewBudget(reload): %v", err)
+	}
+	if got := b2.Spend().TotalTokens(); got != 1200 {
+		t.Fatalf("reloaded tokens=%d", got)
+	}
+	b2.Record("gpt-5-mini", responses.ResponseUsage{InputTokens: 300})
+	if !b2.Exceeded() {
+		t.Fatalf("expected token cap exceeded: %+v", b2.Spend())
+	}
+	if got := b2.SessionSpend().TotalTokens(); got != 300 {
+		t.Fatalf("session tokens=%d", got)
+	}
+
+	usd, err := NewBudget(0.001, 0, "")
+	if err != nil {
+		t.Fatalf("NewBudget(usd): %v", err)
+	}
+	usd.Record("gpt-5-mini", responses.ResponseUsage{OutputTokens: 1000}) // $0.002
+	if !usd.Exceeded() {
+		t.Fatalf("expected usd cap exceeded: %+v", usd.Spend())
+	}
+
+	var nilBudget *Budget
+	nilBudget.Record("gpt-5", responses.ResponseUsage{InputTokens: 1})
+	if nilBudget.Exceeded() {
+		t.Fatalf("nil budget should never be exceeded")
+	}
+}
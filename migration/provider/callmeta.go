@@ -0,0 +1,124 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go/responses"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+)
+
+// CallRecord describes one model response. Stages persist the records behind an artifact in its
+// .meta.json sidecar, so the exact model snapshot that produced it can be traced later.
+type CallRecord struct {
+	ResponseID string `json:"response_id"`
+	// RequestedModel is the model the stage asked for; Model is the snapshot the API reports using.
+	RequestedModel string `json:"requested_model"`
+	Model          string `json:"model"`
+	Status         string `json:"status,omitempty"`
+	// FinishReason is the incomplete reason ("max_output_tokens", "content_filter") when the response
+	// was cut short, otherwise its status.
+	FinishReason string `json:"finish_reason,omitempty"`
+	LatencyMS    int64  `json:"latency_ms"`
+	// Attempts counts requests made, including those retried after rate-limit or server errors.
+	Attempts     int    `json:"attempts"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+	CompletedAt  string `json:"completed_at"`
+}
+
+// CallLog collects the CallRecords of the model calls made with a context from WithCallLog. It is
+// safe for concurrent use.
+type CallLog struct {
+	mu      sync.Mutex
+	records []CallRecord
+}
+
+// Records returns a copy of the calls logged so far, in completion order.
+func (l *CallLog) Records() []CallRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]CallRecord(nil), l.records...)
+}
+
+func (l *CallLog) add(r CallRecord) {
+	l.mu.Lock()
+	l.records = append(l.records, r)
+	l.mu.Unlock()
+}
+
+type callLogKey struct{}
+
+// WithCallLog returns a context whose model calls (through CallWithRetry) are recorded in l.
+func WithCallLog(ctx context.Context, l *CallLog) context.Context {
+	return context.WithValue(ctx, callLogKey{}, l)
+}
+
+// recordCall logs a successful response on ctx's CallLog, if any.
+func recordCall(ctx context.Context, requested string, resp *responses.Response, latency time.Duration, attempts int) {
+	l, _ := ctx.Value(callLogKey{}).(*CallLog)
+	if l == nil || resp == nil {
+		return
+	}
+	l.add(NewCallRecord(requested, resp, latency, attempts))
+}
+
+// NewCallRecord builds the record for resp.
+func NewCallRecord(requested string, resp *responses.Response, latency time.Duration, attempts int) CallRecord {
+	finish := resp.IncompleteDetails.Reason
+	if finish == "" {
+		finish = string(resp.Status)
+	}
+	return CallRecord{
+		ResponseID:     resp.ID,
+		RequestedModel: requested,
+		Model:          string(resp.Model),
+		Status:         string(resp.Status),
+		FinishReason:   finish,
+		LatencyMS:      latency.Milliseconds(),
+		Attempts:       attempts,
+		InputTokens:    resp.Usage.InputTokens,
+		OutputTokens:   resp.Usage.OutputTokens,
+		CompletedAt:    time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// ArtifactMeta is the content of an artifact's .meta.json sidecar.
+type ArtifactMeta struct {
+	Artifact string       `json:"artifact"`
+	Calls    []CallRecord `json:"calls"`
+	// Glossary identifies the glossary excerpt the prompts carried (nil when they carried none).
+	Glossary *PromptGlossary `json:"glossary,omitempty"`
+}
+
+// PromptGlossary identifies the glossary version an artifact's prompts saw.
+type PromptGlossary struct {
+	// SHA256 is the hash of the excerpt text (see migration.GlossaryExcerptSHA256).
+	SHA256 string   `json:"sha256"`
+	Terms  []string `json:"terms"`
+	// Snapshot is the archived glossary the excerpt was cut from, relative to the stage's output
+	// directory.
+	Snapshot string `json:"snapshot,omitempty"`
+}
+
+// WriteMeta writes the sidecar for the artifact at artifactPath (see layout.MetaName) listing calls.
+// Nothing is written when calls is empty, e.g. for an artifact assembled without a model call.
+func WriteMeta(artifactPath string, calls []CallRecord) error {
+	return WriteMetaWithGlossary(artifactPath, calls, nil)
+}
+
+// WriteMetaWithGlossary is WriteMeta that also records the glossary excerpt the prompts carried.
+func WriteMetaWithGlossary(artifactPath string, calls []CallRecord, glossary *PromptGlossary) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	meta := ArtifactMeta{Artifact: filepath.Base(artifactPath), Calls: calls, Glossary: glossary}
+	if err := fileutils.WriteJSONFileAtomic(layout.MetaName(artifactPath), meta, true); err != nil {
+		return fmt.Errorf("write meta for %s: %w", artifactPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go/responses"
+)
+
+func TestNewCallRecord_FinishReason(t *testing.T) {
+	t.Parallel()
+
+	resp := &responses.Response{ID: "resp_1", Model: "gpt-5-mini-2025-08-07", Status: responses.ResponseStatusCompleted}
+	resp.Usage.InputTokens = 100
+	resp.Usage.OutputTokens = 20
+	r := NewCallRecord("gpt-5-mini", resp, 1500*time.Millisecond, 2)
+	if r.ResponseID != "resp_1" || r.Model != "gpt-5-mini-2025-08-07" || r.RequestedModel != "gpt-5-mini" {
+		t.Fatalf("record=%+v", r)
+	}
+	if r.FinishReason != "completed" || r.LatencyMS != 1500 || r.Attempts != 2 || r.InputTokens != 100 || r.OutputTokens != 20 {
+		t.Fatalf("record=%+v", r)
+	}
+
+	resp.Status = responses.ResponseStatusIncomplete
+	resp.IncompleteDetails.Reason = "max_output_tokens"
+	if r := NewCallRecord("gpt-5-mini", resp, 0, 1); r.FinishReason != "max_output_tokens" || r.Status != "incomplete" {
+		t.Fatalf("incomplete record=%+v", r)
+	}
+}
+
+func TestCallLog_RecordsOnlyWithLog(t *testing.T) {
+	t.Parallel()
+
+	resp := &responses.Response{ID: "resp_1"}
+	recordCall(context.Background(), "m", resp, 0, 1) // no log: ignored
+
+	var log CallLog
+	ctx := WithCallLog(context.Background(), &log)
+	recordCall(ctx, "m", resp, 0, 1)
+	recordCall(ctx, "m", &responses.Response{ID: "resp_2"}, 0, 1)
+	got := log.Records()
+	if len(got) != 2 || got[0].ResponseID != "resp_1" || got[1].ResponseID != "resp_2" {
+		t.Fatalf("records=%+v", got)
+	}
+}
+
+func TestWriteMeta_SidecarNextToArtifact(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	artifact := filepath.Join(dir, "t1.thread.summary.json")
+	if err := WriteMeta(artifact, nil); err != nil {
+		t.Fatalf("WriteMeta(nil): %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("expected no sidecar without calls, got %d files", len(entries))
+	}
+
+	if err := WriteMeta(artifact, []CallRecord{{ResponseID: "resp_1", Model: "gpt-5-2025-08-07"}}); err != nil {
+		t.Fatalf("WriteMeta: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "t1.thread.summary.meta.json"))
+	if err != nil {
+		t.Fatalf("read sidecar: %v", err)
+	}
+	var meta ArtifactMeta
+	if err := json.Unmarshal(b, &meta); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if meta.Artifact != "t1.thread.summary.json" || len(meta.Calls) != 1 || meta.Calls[0].Model != "gpt-5-2025-08-07" {
+		t.Fatalf("meta=%+v", meta)
+	}
+}
@@ -0,0 +1,204 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+// Cassette records OpenAI API exchanges to a JSON file and replays them, so integration tests of the
+// model stages run in CI without an API key or network. In replay mode each request is answered with
+// the recorded response whose method, path, and JSON body match it; a request that was not recorded
+// fails with an error naming the cassette. In record mode requests go to the real API and successful
+// exchanges are saved by Close. Only the request body and the response status, content type, and body
+// are stored, so cassettes never contain the API key.
+type Cassette struct {
+	path      string
+	recording bool
+	transport http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// Interaction is one recorded request and its response.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the part of a request replay matches on.
+type RecordedRequest struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// RecordedResponse is what replay returns.
+type RecordedResponse struct {
+	Status      int             `json:"status"`
+	ContentType string          `json:"content_type,omitempty"`
+	Body        json.RawMessage `json:"body"`
+}
+
+type cassetteFile struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// OpenCassette loads the cassette at path for replay, or starts an empty one that Close writes to path
+// when record is set.
+func OpenCassette(path string, record bool) (*Cassette, error) {
+	c := &Cassette{path: path, recording: record, transport: http.DefaultTransport}
+	if record {
+		return c, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read cassette: %w (record it with -record and OPENAI_API_KEY set)", err)
+	}
+	var f cassetteFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("parse cassette %s: %w", path, err)
+	}
+	for i := range f.Interactions {
+		// The file is indented for review; match against the compact form RoundTrip builds.
+		if f.Interactions[i].Request.Body, err = canonicalJSON(f.Interactions[i].Request.Body); err != nil {
+			return nil, fmt.Errorf("parse cassette %s: interaction %d: %w", path, i, err)
+		}
+	}
+	c.interactions = f.Interactions
+	c.used = make([]bool, len(f.Interactions))
+	return c, nil
+}
+
+// Recording reports whether c talks to the real API.
+func (c *Cassette) Recording() bool { return c.recording }
+
+// Client returns an OpenAI client that goes through c. When recording it uses OPENAI_API_KEY; when
+// replaying it needs no key and the SDK does not retry, so a missing interaction fails at once.
+func (c *Cassette) Client() openai.Client {
+	opts := []option.RequestOption{option.WithHTTPClient(&http.Client{Transport: c})}
+	if !c.recording {
+		opts = append(opts, option.WithAPIKey("replay"), option.WithMaxRetries(0))
+	}
+	return openai.NewClient(opts...)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	key, err := canonicalJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("cassette %s: request body: %w", c.path, err)
+	}
+	if c.recording {
+		return c.record(req, key)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// The first unplayed match wins, so identical requests replay their responses in order; once all
+	// are played the last one is reused.
+	found := -1
+	for i, in := range c.interactions {
+		if in.Request.Method != req.Method || in.Request.Path != req.URL.Path || !bytes.Equal(in.Request.Body, key) {
+			continue
+		}
+		found = i
+		if !c.used[i] {
+			break
+		}
+	}
+	if found < 0 {
+		return nil, fmt.Errorf("cassette %s: no recorded response for %s %s; the request changed, re-record with -record", c.path, req.Method, req.URL.Path)
+	}
+	c.used[found] = true
+	resp := c.interactions[found].Response
+	h := http.Header{}
+	if resp.ContentType != "" {
+		h.Set("Content-Type", resp.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", resp.Status, http.StatusText(resp.Status)),
+		StatusCode:    resp.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(resp.Body)),
+		ContentLength: int64(len(resp.Body)),
+		Request:       req,
+	}, nil
+}
+
+func (c *Cassette) record(req *http.Request, key json.RawMessage) (*http.Response, error) {
+	resp, err := c.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	// Failed attempts are retried by the SDK or CallWithRetry; replaying them would only add waits.
+	if resp.StatusCode >= 300 {
+		return resp, nil
+	}
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("cassette %s: %s %s returned a non-JSON body", c.path, req.Method, req.URL.Path)
+	}
+	c.mu.Lock()
+	c.interactions = append(c.interactions, Interaction{
+		Request:  RecordedRequest{Method: req.Method, Path: req.URL.Path, Body: key},
+		Response: RecordedResponse{Status: resp.StatusCode, ContentType: resp.Header.Get("Content-Type"), Body: body},
+	})
+	c.mu.Unlock()
+	return resp, nil
+}
+
+// Close writes the recorded interactions when recording; it does nothing when replaying.
+func (c *Cassette) Close() error {
+	if !c.recording {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.interactions) == 0 {
+		return errors.New("cassette " + c.path + ": nothing recorded")
+	}
+	return fileutils.WriteJSONFileAtomic(c.path, cassetteFile{Interactions: c.interactions}, true)
+}
+
+// canonicalJSON re-encodes body with sorted object keys so matching ignores key order and whitespace.
+func canonicalJSON(body []byte) (json.RawMessage, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
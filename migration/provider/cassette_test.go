@@ -0,0 +1,101 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+func TestCassette_RecordThenReplay(t *testing.T) {
+	t.Parallel()
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.Header.Get("Authorization") != "Bearer sk-test" {
+			t.Errorf("Authorization=%q", r.Header.Get("Authorization"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(chaosTestResponse))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "summarize.cassette.json")
+	rec, err := OpenCassette(path, true)
+	if err != nil {
+		t.Fatalf("OpenCassette(record): %v", err)
+	}
+	client := rec.Client()
+	if _, err := client.Responses.New(context.Background(), chaosTestParams(), option.WithAPIKey("sk-test"), option.WithBaseURL(srv.URL+"/v1/")); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	play, err := OpenCassette(path, false)
+	if err != nil {
+		t.Fatalf("OpenCassette(replay): %v", err)
+	}
+	client = play.Client()
+	for i := 0; i < 2; i++ {
+		resp, err := CallWithRetry(context.Background(), &client, chaosTestParams())
+		if err != nil {
+			t.Fatalf("replay %d: %v", i, err)
+		}
+		if resp.ID != "resp_1" || !strings.Contains(resp.OutputText(), "a long enough summary") {
+			t.Fatalf("replay %d: resp=%s text=%q", i, resp.ID, resp.OutputText())
+		}
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("server hits=%d, want 1", hits.Load())
+	}
+
+	changed := chaosTestParams()
+	changed.Model = "gpt-5"
+	if _, err := client.Responses.New(context.Background(), changed); err == nil || !strings.Contains(err.Error(), "re-record") {
+		t.Fatalf("expected missing-interaction error, got %v", err)
+	}
+}
+
+func TestCassette_SkipsFailedAttempts(t *testing.T) {
+	t.Parallel()
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if hits.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"error":{"message":"boom","type":"server_error"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(chaosTestResponse))
+	}))
+	defer srv.Close()
+
+	rec, _ := OpenCassette(filepath.Join(t.TempDir(), "c.json"), true)
+	client := openai.NewClient(option.WithHTTPClient(&http.Client{Transport: rec}), option.WithAPIKey("sk-test"), option.WithBaseURL(srv.URL+"/v1/"), option.WithMaxRetries(0))
+	var waits atomic.Int32
+	if _, err := CallWithRetry(noRetryWait(&waits), &client, chaosTestParams()); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if len(rec.interactions) != 1 || rec.interactions[0].Response.Status != http.StatusOK {
+		t.Fatalf("interactions=%+v", rec.interactions)
+	}
+}
+
+func TestOpenCassette_Missing(t *testing.T) {
+	t.Parallel()
+
+	_, err := OpenCassette(filepath.Join(t.TempDir(), "none.json"), false)
+	if err == nil || !strings.Contains(err.Error(), "-record") {
+		t.Fatalf("expected hint to record, got %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// Failure kinds Chaos injects.
+const (
+	ChaosRateLimit   = "rate-limit"
+	ChaosServerError = "server-error"
+	ChaosTruncate    = "truncate"
+	ChaosGarbage     = "garbage"
+)
+
+var chaosKinds = []string{ChaosRateLimit, ChaosServerError, ChaosTruncate, ChaosGarbage}
+
+// Chaos injects provider failures into API calls so the retry, fallback, and resume paths run against
+// the failures real archives hit. Each request draws once: with the configured probabilities it gets
+// a 429 or a 500 without reaching the API, or its real response is cut short (status incomplete,
+// reason max_output_tokens, half the output text) or has its output text replaced with non-JSON.
+// Truncation and garbage apply only to Responses API calls. Injected errors tell the SDK not to retry
+// them, so CallWithRetry's own handling is what runs.
+type Chaos struct {
+	rates map[string]float64
+	// max stops injecting after this many failures (0 = no limit).
+	max int
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	injected map[string]int
+}
+
+// ParseChaos parses a -chaos spec such as "rate-limit=0.05,server-error=0.05,truncate=0.02,garbage=0.02".
+// Rates are per-request probabilities whose sum must not exceed 1. "seed=N" fixes the random sequence
+// (default 1) and "max=N" caps the number of injected failures. An empty spec returns nil, which
+// injects nothing.
+func ParseChaos(spec string) (*Chaos, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	c := &Chaos{rates: map[string]float64{}, injected: map[string]int{}}
+	seed := int64(1)
+	total := 0.0
+	for _, part := range strings.Split(spec, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid -chaos entry %q (want name=value)", part)
+		}
+		switch key {
+		case "seed":
+			n, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -chaos seed %q", val)
+			}
+			seed = n
+		case "max":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid -chaos max %q", val)
+			}
+			c.max = n
+		case ChaosRateLimit, ChaosServerError, ChaosTruncate, ChaosGarbage:
+			f, err := strconv.ParseFloat(val, 64)
+			if err != nil || f < 0 || f > 1 {
+				return nil, fmt.Errorf("invalid -chaos rate %s=%q (want 0-1)", key, val)
+			}
+			c.rates[key] = f
+			total += f
+		default:
+			return nil, fmt.Errorf("unknown -chaos failure %q (want %s, seed, or max)", key, strings.Join(chaosKinds, ", "))
+		}
+	}
+	if total > 1 {
+		return nil, fmt.Errorf("-chaos rates add up to %.2f (must be <= 1)", total)
+	}
+	c.rng = rand.New(rand.NewSource(seed))
+	return c, nil
+}
+
+// NewClient returns an OpenAI client for apiKey, injecting chaos's failures when chaos is non-nil.
+func NewClient(apiKey string, chaos *Chaos) openai.Client {
+	opts := []option.RequestOption{option.WithAPIKey(apiKey)}
+	if chaos != nil {
+		opts = append(opts, chaos.Option())
+	}
+	return openai.NewClient(opts...)
+}
+
+// Option installs c as client middleware.
+func (c *Chaos) Option() option.RequestOption {
+	return option.WithMiddleware(c.middleware)
+}
+
+// Injected returns how many failures of each kind were injected so far.
+func (c *Chaos) Injected() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]int, len(chaosKinds))
+	for _, k := range chaosKinds {
+		out[k] = c.injected[k]
+	}
+	return out
+}
+
+// String summarizes the injected failures, e.g. "rate-limit=2 server-error=1 truncate=0 garbage=1".
+func (c *Chaos) String() string {
+	n := c.Injected()
+	parts := make([]string, len(chaosKinds))
+	for i, k := range chaosKinds {
+		parts[i] = fmt.Sprintf("%s=%d", k, n[k])
+	}
+	return strings.Join(parts, " ")
+}
+
+// draw picks the failure for one request ("" for none). rewritable says whether the request's response
+// can be truncated or garbled.
+func (c *Chaos) draw(rewritable bool) (kind string, variant int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := c.rng.Float64()
+	variant = c.rng.Intn(len(garbageOutputs))
+	if c.max > 0 {
+		total := 0
+		for _, n := range c.injected {
+			total += n
+		}
+		if total >= c.max {
+			return "", 0
+		}
+	}
+	for _, k := range chaosKinds {
+		if r < c.rates[k] {
+			if (k == ChaosTruncate || k == ChaosGarbage) && !rewritable {
+				return "", 0
+			}
+			return k, variant
+		}
+		r -= c.rates[k]
+	}
+	return "", 0
+}
+
+func (c *Chaos) count(kind string) {
+	c.mu.Lock()
+	c.injected[kind]++
+	c.mu.Unlock()
+}
+
+func (c *Chaos) middleware(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+	kind, variant := c.draw(strings.HasSuffix(req.URL.Path, "/responses"))
+	switch kind {
+	case "":
+		return next(req)
+	case ChaosRateLimit:
+		c.count(kind)
+		return injectedError(req, http.StatusTooManyRequests, "rate_limit_exceeded", "Rate limit reached (injected by -chaos)"), nil
+	case ChaosServerError:
+		c.count(kind)
+		return injectedError(req, http.StatusInternalServerError, "server_error", "The server had an error while processing your request (injected by -chaos)"), nil
+	}
+
+	resp, err := next(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if out, ok := rewriteResponse(body, kind, variant); ok {
+		c.count(kind)
+		body = out
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+func injectedError(req *http.Request, status int, code, message string) *http.Response {
+	body, _ := json.Marshal(map[string]any{"error": map[string]any{"message": message, "type": code, "code": code}})
+	h := http.Header{}
+	h.Set("Content-Type", "application/json")
+	h.Set("x-should-retry", "false")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// garbageOutputs are the kinds of unusable text models return instead of the requested JSON.
+var garbageOutputs = []string{
+	"I'm sorry, but I can't help with that.",
+	`{"summary": "The conversation covered`,
+	"```json\n{\n```",
+	`{"summary": 42, "key_points": "none"}`,
+}
+
+// rewriteResponse truncates or garbles the output text of a Responses API body. ok is false when the
+// body has no output text to rewrite.
+func rewriteResponse(body []byte, kind string, variant int) ([]byte, bool) {
+	var m map[string]any
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, false
+	}
+	changed := false
+	output, _ := m["output"].([]any)
+	for _, item := range output {
+		msg, _ := item.(map[string]any)
+		content, _ := msg["content"].([]any)
+		for _, part := range content {
+			p, _ := part.(map[string]any)
+			text, ok := p["text"].(string)
+			if !ok || p["type"] != "output_text" {
+				continue
+			}
+			if kind == ChaosTruncate {
+				cut := len(text) / 2
+				for cut > 0 && !utf8.RuneStart(text[cut]) {
+					cut--
+				}
+				p["text"] = text[:cut]
+			} else {
+				p["text"] = garbageOutputs[variant]
+			}
+			changed = true
+		}
+	}
+	if !changed {
+		return nil, false
+	}
+	if kind == ChaosTruncate {
+		m["status"] = "incomplete"
+		m["incomplete_details"] = map[string]any{"reason": "max_output_tokens"}
+	}
+	out, err := json.Marshal(m)
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
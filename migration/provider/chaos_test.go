@@ -0,0 +1,162 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/responses"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+const chaosTestResponse = `{"id":"resp_1","object":"response","created_at":1,"model":"gpt-5-mini-2025-08-07","status":"completed",
+"output":[{"type":"message","id":"msg_1","role":"assistant","status":"completed",
+"content":[{"type":"output_text","text":"{\"summary\":\"a long enough summary\"}","annotations":[]}]}],
+"usage":{"input_tokens":10,"output_tokens":5,"total_tokens":15}}`
+
+// chaosTestClient returns a client for a fake Responses API that counts the requests reaching it.
+func chaosTestClient(t *testing.T, c *Chaos) (*openai.Client, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(chaosTestResponse))
+	}))
+	t.Cleanup(srv.Close)
+	client := openai.NewClient(option.WithAPIKey("test"), option.WithBaseURL(srv.URL), option.WithMaxRetries(0), c.Option())
+	return &client, &hits
+}
+
+// noRetryWait makes CallWithRetry skip its backoff and counts the waits.
+func noRetryWait(waits *atomic.Int32) context.Context {
+	return context.WithValue(context.Background(), retryWaitKey{}, func(time.Duration) { waits.Add(1) })
+}
+
+func chaosTestParams() responses.ResponseNewParams {
+	return responses.ResponseNewParams{
+		Model: "gpt-5-mini",
+		Input: responses.ResponseNewParamsInputUnion{OfString: openai.String("hi")},
+	}
+}
+
+func TestParseChaos(t *testing.T) {
+	t.Parallel()
+
+	c, err := ParseChaos("")
+	if err != nil || c != nil {
+		t.Fatalf("empty spec: c=%v err=%v", c, err)
+	}
+	c, err = ParseChaos("rate-limit=0.1, server-error=0.05,truncate=0.05,garbage=0.05,seed=7,max=3")
+	if err != nil {
+		t.Fatalf("ParseChaos: %v", err)
+	}
+	if c.rates[ChaosRateLimit] != 0.1 || c.rates[ChaosGarbage] != 0.05 || c.max != 3 {
+		t.Fatalf("chaos=%+v", c)
+	}
+	if got := c.String(); got != "rate-limit=0 server-error=0 truncate=0 garbage=0" {
+		t.Fatalf("String()=%q", got)
+	}
+
+	for _, spec := range []string{"rate-limit", "rate-limit=2", "timeout=0.1", "seed=x", "max=-1", "rate-limit=0.6,garbage=0.6"} {
+		if _, err := ParseChaos(spec); err == nil {
+			t.Fatalf("ParseChaos(%q): expected error", spec)
+		}
+	}
+}
+
+func TestChaos_RateLimitExhaustsRetries(t *testing.T) {
+	t.Parallel()
+
+	c, _ := ParseChaos("rate-limit=1")
+	client, hits := chaosTestClient(t, c)
+	var waits atomic.Int32
+	_, err := CallWithRetry(noRetryWait(&waits), client, chaosTestParams())
+	if err == nil || !isRateLimitError(err) {
+		t.Fatalf("expected rate limit error, got %v", err)
+	}
+	if waits.Load() != 2 || hits.Load() != 0 || c.Injected()[ChaosRateLimit] != 3 {
+		t.Fatalf("waits=%d hits=%d injected=%v", waits.Load(), hits.Load(), c.Injected())
+	}
+}
+
+func TestChaos_ServerErrorRecovers(t *testing.T) {
+	t.Parallel()
+
+	c, _ := ParseChaos("server-error=1,max=1")
+	client, hits := chaosTestClient(t, c)
+	var waits atomic.Int32
+	var log CallLog
+	resp, err := CallWithRetry(WithCallLog(noRetryWait(&waits), &log), client, chaosTestParams())
+	if err != nil {
+		t.Fatalf("CallWithRetry: %v", err)
+	}
+	if resp.ID != "resp_1" || waits.Load() != 1 || hits.Load() != 1 {
+		t.Fatalf("resp=%s waits=%d hits=%d", resp.ID, waits.Load(), hits.Load())
+	}
+	if recs := log.Records(); len(recs) != 1 || recs[0].Attempts != 2 {
+		t.Fatalf("records=%+v", recs)
+	}
+}
+
+func TestChaos_Truncate(t *testing.T) {
+	t.Parallel()
+
+	c, _ := ParseChaos("truncate=1")
+	client, _ := chaosTestClient(t, c)
+	resp, err := client.Responses.New(context.Background(), chaosTestParams())
+	if err != nil {
+		t.Fatalf("Responses.New: %v", err)
+	}
+	if resp.Status != responses.ResponseStatusIncomplete || resp.IncompleteDetails.Reason != "max_output_tokens" {
+		t.Fatalf("status=%s reason=%s", resp.Status, resp.IncompleteDetails.Reason)
+	}
+	if text := resp.OutputText(); text != `{"summary":"a lon` {
+		t.Fatalf("text=%q", text)
+	}
+	if r := NewCallRecord("gpt-5-mini", resp, 0, 1); r.FinishReason != "max_output_tokens" {
+		t.Fatalf("record=%+v", r)
+	}
+}
+
+func TestChaos_GarbageFailsDecode(t *testing.T) {
+	t.Parallel()
+
+	c, _ := ParseChaos("garbage=1,seed=3")
+	client, _ := chaosTestClient(t, c)
+	for i := 0; i < 8; i++ {
+		resp, err := client.Responses.New(context.Background(), chaosTestParams())
+		if err != nil {
+			t.Fatalf("Responses.New: %v", err)
+		}
+		var out struct {
+			Summary string `json:"summary"`
+		}
+		if err := fileutils.DecodeModelJSON(resp.OutputText(), &out); err == nil {
+			t.Fatalf("garbage %q decoded as %+v", resp.OutputText(), out)
+		}
+	}
+	if got := c.Injected()[ChaosGarbage]; got != 8 {
+		t.Fatalf("injected=%d", got)
+	}
+}
+
+func TestChaos_OnlyResponsesAreRewritten(t *testing.T) {
+	t.Parallel()
+
+	c, _ := ParseChaos("truncate=1")
+	client, _ := chaosTestClient(t, c)
+	var out map[string]any
+	if err := client.Get(context.Background(), "models", nil, &out); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if out["status"] != "completed" || !strings.Contains(c.String(), "truncate=0") {
+		t.Fatalf("status=%v injected=%s", out["status"], c)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -12,32 +13,71 @@ import (
 	"github.com/openai/openai-go/responses"
 )
 
+// CallWithRetry sends params, retrying rate-limit and server errors with backoff. Each attempt
+// waits its turn under SetQPS. A json_schema request is sent as a tool call under StructuredTool, with
+// the call's arguments returned as the output text. A successful response is recorded on ctx's
+// CallLog (see WithCallLog).
 func CallWithRetry(ctx context.Context, client *openai.Client, params responses.ResponseNewParams) (*responses.Response, error) {
+	var toolName string
+	if StructuredOutput() == StructuredTool {
+		params, toolName = asToolCall(params)
+	}
 	const maxRetries = 3
 	rateLimitWaitTimes := []time.Duration{65 * time.Second, 100 * time.Second, 135 * time.Second}
 	serverErrorWaitTimes := []time.Duration{5 * time.Second, 30 * time.Second, 60 * time.Second}
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
+		if err := waitTurn(ctx); err != nil {
+			return nil, err
+		}
+		start := time.Now()
 		resp, err := client.Responses.New(ctx, params)
 		if err != nil {
 			if isRateLimitError(err) {
 				if attempt < maxRetries-1 {
-					time.Sleep(rateLimitWaitTimes[attempt])
+					if err := retryWait(ctx, rateLimitWaitTimes[attempt]); err != nil {
+						return nil, err
+					}
 					continue
 				}
 			} else if isServerError(err) {
 				if attempt < maxRetries-1 {
-					time.Sleep(serverErrorWaitTimes[attempt])
+					if err := retryWait(ctx, serverErrorWaitTimes[attempt]); err != nil {
+						return nil, err
+					}
 					continue
 				}
 			}
 			return nil, err
 		}
+		if toolName != "" {
+			fromToolCall(resp, toolName)
+		}
+		recordCall(ctx, string(params.Model), resp, time.Since(start), attempt+1)
 		return resp, nil
 	}
 	return nil, fmt.Errorf("failed after %d attempts due to OpenAI API issues", maxRetries)
 }
 
+type retryWaitKey struct{}
+
+// retryWait sleeps for d between attempts, returning early when ctx is done. Tests swap the sleep
+// through ctx so the retry path runs without the real backoff.
+func retryWait(ctx context.Context, d time.Duration) error {
+	if f, ok := ctx.Value(retryWaitKey{}).(func(time.Duration)); ok {
+		f(d)
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
 func isRateLimitError(err error) bool {
 	if err == nil {
 		return false
@@ -74,6 +114,31 @@ func GenerateSchema[T any]() map[string]interface{} {
 	return schemaObj
 }
 
+// MergeSchemas returns a copy of the object schema base with extra's properties added, all required,
+// for asking a model for optional fields without changing base.
+func MergeSchemas(base, extra map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(base))
+	for k, v := range base {
+		out[k] = v
+	}
+	props := make(map[string]interface{})
+	for _, s := range []map[string]interface{}{base, extra} {
+		if p, ok := s[propertiesKey].(map[string]interface{}); ok {
+			for k, v := range p {
+				props[k] = v
+			}
+		}
+	}
+	required := make([]string, 0, len(props))
+	for k := range props {
+		required = append(required, k)
+	}
+	sort.Strings(required)
+	out[propertiesKey] = props
+	out[requiredKey] = required
+	return out
+}
+
 func schemaToMap(schema *jsonschema.Schema) (map[string]interface{}, error) {
 	b, err := schema.MarshalJSON()
 	if err != nil {
@@ -103,6 +168,8 @@ func ensureOpenAICompliance(schema map[string]interface{}) {
 			for propName := range properties {
 				requiredFields = append(requiredFields, propName)
 			}
+			// Map order is random; sort so identical schemas serialize identically across runs.
+			sort.Strings(requiredFields)
 			if len(requiredFields) > 0 {
 				schema[requiredKey] = requiredFields
 			}
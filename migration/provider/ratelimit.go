@@ -0,0 +1,56 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimit spaces request starts at least interval apart across the whole process, so a stage's
+// concurrent workers together stay under a provider's requests-per-second limit.
+var rateLimit = struct {
+	sync.Mutex
+	interval time.Duration
+	next     time.Time
+}{}
+
+// SetQPS limits CallWithRetry to qps request attempts per second across the process (retries
+// included); qps <= 0 removes the limit.
+func SetQPS(qps float64) {
+	rateLimit.Lock()
+	defer rateLimit.Unlock()
+	rateLimit.interval = 0
+	if qps > 0 {
+		rateLimit.interval = time.Duration(float64(time.Second) / qps)
+	}
+	rateLimit.next = time.Time{}
+}
+
+// waitTurn blocks until the next request slot under SetQPS, returning early when ctx is done.
+func waitTurn(ctx context.Context) error {
+	rateLimit.Lock()
+	if rateLimit.interval <= 0 {
+		rateLimit.Unlock()
+		return nil
+	}
+	now := time.Now()
+	slot := rateLimit.next
+	if slot.Before(now) {
+		slot = now
+	}
+	rateLimit.next = slot.Add(rateLimit.interval)
+	rateLimit.Unlock()
+
+	d := time.Until(slot)
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Not parallel: the rate limit is process-wide.
+func TestSetQPS_SpacesRequests(t *testing.T) {
+	defer SetQPS(0)
+
+	SetQPS(20)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := waitTurn(context.Background()); err != nil {
+			t.Fatalf("waitTurn: %v", err)
+		}
+	}
+	// The first request goes at once and the next three wait 50ms each.
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond {
+		t.Fatalf("4 requests at 20 qps took %v", elapsed)
+	}
+
+	SetQPS(0.1)
+	_ = waitTurn(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := waitTurn(ctx); err == nil {
+		t.Fatal("expected a canceled wait to return the context error")
+	}
+
+	SetQPS(0)
+	start = time.Now()
+	for i := 0; i < 100; i++ {
+		_ = waitTurn(context.Background())
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("unlimited waits took %v", elapsed)
+	}
+}
@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/responses"
+)
+
+// Structured output mechanisms for the -structured-output flag.
+const (
+	// StructuredJSONSchema asks for output matching the schema through the json_schema response
+	// format.
+	StructuredJSONSchema = "json-schema"
+	// StructuredTool is for models and providers that support function calling but not the
+	// json_schema response format: the schema becomes the parameters of a single function the model
+	// is required to call, and the call's arguments are returned as the response's output text.
+	StructuredTool = "tool"
+)
+
+// StructuredOutputModes lists the -structured-output values.
+var StructuredOutputModes = []string{StructuredJSONSchema, StructuredTool}
+
+var structuredOutput = struct {
+	sync.Mutex
+	mode string
+}{mode: StructuredJSONSchema}
+
+// ParseStructuredOutput validates a -structured-output value. Empty means StructuredJSONSchema.
+func ParseStructuredOutput(s string) (string, error) {
+	switch s {
+	case "":
+		return StructuredJSONSchema, nil
+	case StructuredJSONSchema, StructuredTool:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid -structured-output %q (want json-schema or tool)", s)
+}
+
+// SetStructuredOutput sets the process-wide mechanism CallWithRetry uses for requests that carry a
+// json_schema response format.
+func SetStructuredOutput(mode string) error {
+	mode, err := ParseStructuredOutput(mode)
+	if err != nil {
+		return err
+	}
+	structuredOutput.Lock()
+	structuredOutput.mode = mode
+	structuredOutput.Unlock()
+	return nil
+}
+
+// StructuredOutput returns the current structured output mechanism.
+func StructuredOutput() string {
+	structuredOutput.Lock()
+	defer structuredOutput.Unlock()
+	return structuredOutput.mode
+}
+
+// asToolCall rewrites a json_schema request as a required call to a function taking the schema,
+// returning the function name ("" when params has no json_schema format and is sent unchanged).
+func asToolCall(params responses.ResponseNewParams) (responses.ResponseNewParams, string) {
+	format := params.Text.Format.OfJSONSchema
+	if format == nil {
+		return params, ""
+	}
+	fn := responses.FunctionToolParam{
+		Name:       format.Name,
+		Parameters: format.Schema,
+		Strict:     openai.Bool(format.Strict.Or(true)),
+	}
+	if format.Description.Valid() {
+		fn.Description = format.Description
+	} else {
+		fn.Description = openai.String("Return the result. The arguments are the complete answer.")
+	}
+	params.Text.Format = responses.ResponseFormatTextConfigUnionParam{}
+	params.Tools = append(append([]responses.ToolUnionParam(nil), params.Tools...), responses.ToolUnionParam{OfFunction: &fn})
+	params.ToolChoice = responses.ResponseNewParamsToolChoiceUnion{
+		OfFunctionTool: &responses.ToolChoiceFunctionParam{Name: fn.Name},
+	}
+	return params, fn.Name
+}
+
+// fromToolCall moves the arguments of the call to fn into resp's output text, so callers read the
+// result with resp.OutputText() whichever mechanism produced it. A response without the call is left
+// as is (its text, if any, is decoded as usual).
+func fromToolCall(resp *responses.Response, fn string) {
+	for i, item := range resp.Output {
+		if item.Type != "function_call" || item.Name != fn {
+			continue
+		}
+		resp.Output[i].Content = append(resp.Output[i].Content, responses.ResponseOutputMessageContentUnion{
+			Type: "output_text",
+			Text: item.Arguments,
+		})
+		return
+	}
+}
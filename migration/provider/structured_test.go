@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/responses"
+)
+
+const toolCallTestResponse = `{"id":"resp_1","object":"response","created_at":1,"model":"some-model","status":"completed",
+"output":[{"type":"function_call","id":"fc_1","call_id":"call_1","name":"summary","status":"completed",
+"arguments":"{\"summary\":\"from the tool call\"}"}],
+"usage":{"input_tokens":10,"output_tokens":5,"total_tokens":15}}`
+
+// Not parallel: the structured output mode is process-wide.
+func TestStructuredTool_SchemaSentAsRequiredToolCall(t *testing.T) {
+	if _, err := ParseStructuredOutput("functions"); err == nil {
+		t.Fatal("expected error for unknown mode")
+	}
+	if err := SetStructuredOutput(StructuredTool); err != nil {
+		t.Fatalf("SetStructuredOutput: %v", err)
+	}
+	defer func() { _ = SetStructuredOutput(StructuredJSONSchema) }()
+
+	var sent map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &sent)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(toolCallTestResponse))
+	}))
+	defer srv.Close()
+	client := openai.NewClient(option.WithAPIKey("test"), option.WithBaseURL(srv.URL), option.WithMaxRetries(0))
+
+	params := chaosTestParams()
+	params.Text = responses.ResponseTextConfigParam{
+		Format: responses.ResponseFormatTextConfigUnionParam{
+			OfJSONSchema: &responses.ResponseFormatTextJSONSchemaConfigParam{
+				Name:   "summary",
+				Schema: map[string]any{"type": "object", "properties": map[string]any{"summary": map[string]any{"type": "string"}}},
+				Strict: openai.Bool(true),
+			},
+		},
+	}
+	resp, err := CallWithRetry(t.Context(), &client, params)
+	if err != nil {
+		t.Fatalf("CallWithRetry: %v", err)
+	}
+	if got := resp.OutputText(); got != `{"summary":"from the tool call"}` {
+		t.Fatalf("OutputText=%q", got)
+	}
+
+	if text, ok := sent["text"].(map[string]any); ok && text["format"] != nil {
+		t.Fatalf("json_schema format still sent: %v", text)
+	}
+	tools, _ := sent["tools"].([]any)
+	if len(tools) != 1 {
+		t.Fatalf("tools=%v", sent["tools"])
+	}
+	tool := tools[0].(map[string]any)
+	if tool["type"] != "function" || tool["name"] != "summary" || tool["strict"] != true || tool["parameters"] == nil {
+		t.Fatalf("tool=%v", tool)
+	}
+	choice, _ := sent["tool_choice"].(map[string]any)
+	if choice["type"] != "function" || choice["name"] != "summary" {
+		t.Fatalf("tool_choice=%v", sent["tool_choice"])
+	}
+
+	// Requests without a schema go out unchanged.
+	plain, name := asToolCall(chaosTestParams())
+	if name != "" || len(plain.Tools) != 0 {
+		t.Fatalf("plain request rewritten: name=%q tools=%v", name, plain.Tools)
+	}
+}
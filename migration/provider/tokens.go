@@ -0,0 +1,177 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultInputTokens caps the variable part of a prompt (a transcript or the summaries being rolled
+// up) for models without a -prompt-budget entry. It is about the 80,000 characters of English the
+// stages allowed before budgets were counted in tokens.
+const DefaultInputTokens = 20_000
+
+// contextMarginTokens is kept free in the context window on top of the reserved output, covering
+// message framing and CountTokens' estimation error.
+const contextMarginTokens = 1_000
+
+// ContextWindows holds context window sizes in tokens keyed by model name prefix; the longest
+// matching prefix wins.
+var ContextWindows = map[string]int{
+	"gpt-5":   400_000,
+	"gpt-4.1": 1_047_576,
+	"gpt-4o":  128_000,
+	"o4-mini": 200_000,
+}
+
+// ContextWindowFor returns the context window for model, falling back to the smallest known window so
+// unknown models are never overfilled.
+func ContextWindowFor(model string) int {
+	if n, ok := lookupPrefix(ContextWindows, model); ok {
+		return n
+	}
+	smallest := 0
+	for _, n := range ContextWindows {
+		if smallest == 0 || n < smallest {
+			smallest = n
+		}
+	}
+	return smallest
+}
+
+// CountTokens estimates how many tokens s encodes to with OpenAI's o200k tokenizer, without loading a
+// vocabulary. An ASCII word and the space before it cost one token per five letters (rounded up),
+// digit runs one per three digits, other ASCII symbols and whitespace runs one each, and every
+// non-ASCII rune one. English prose comes out slightly high, which leaves budgets some headroom.
+func CountTokens(s string) int {
+	n := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case isASCIILetter(c):
+			j := i + 1
+			for j < len(s) && isASCIILetter(s[j]) {
+				j++
+			}
+			n += (j - i + 4) / 5
+			i = j
+		case c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			n += (j - i + 2) / 3
+			i = j
+		case c == ' ' && i+1 < len(s) && isASCIILetter(s[i+1]):
+			// Folded into the word that follows.
+			i++
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			j := i + 1
+			for j < len(s) && (s[j] == ' ' || s[j] == '\t' || s[j] == '\n' || s[j] == '\r') {
+				j++
+			}
+			n++
+			i = j
+		case c < utf8.RuneSelf:
+			n++
+			i++
+		default:
+			_, size := utf8.DecodeRuneInString(s[i:])
+			n++
+			i += size
+		}
+	}
+	return n
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// PromptBudget caps the variable input of prompts per model. The zero value allows
+// DefaultInputTokens for every model.
+type PromptBudget struct {
+	// limits maps model name prefixes to input tokens; "" is the default for other models.
+	limits map[string]int
+}
+
+// ParsePromptBudget parses a -prompt-budget spec: a token count for every model ("30000"),
+// model=tokens entries ("gpt-5-mini=60000,gpt-4o-mini=12000"), or both. Model names match by
+// prefix, longest first. An empty spec returns the zero PromptBudget.
+func ParsePromptBudget(spec string) (PromptBudget, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return PromptBudget{}, nil
+	}
+	b := PromptBudget{limits: map[string]int{}}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		model, val, ok := strings.Cut(part, "=")
+		if !ok {
+			model, val = "", part
+		}
+		model = strings.ToLower(strings.TrimSpace(model))
+		if ok && model == "" {
+			return PromptBudget{}, fmt.Errorf("invalid -prompt-budget entry %q (want model=tokens)", part)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(val))
+		if err != nil || n <= 0 {
+			return PromptBudget{}, fmt.Errorf("invalid -prompt-budget tokens %q (want a positive integer)", val)
+		}
+		if _, dup := b.limits[model]; dup {
+			return PromptBudget{}, fmt.Errorf("-prompt-budget sets %q twice", part)
+		}
+		b.limits[model] = n
+	}
+	return b, nil
+}
+
+// Limit returns the configured input cap for model.
+func (b PromptBudget) Limit(model string) int {
+	if n, ok := lookupPrefix(b.limits, model); ok {
+		return n
+	}
+	if n, ok := b.limits[""]; ok {
+		return n
+	}
+	return DefaultInputTokens
+}
+
+// InputTokens returns how many tokens of input a request to model may carry: the configured cap,
+// lowered when the context window left after instructions, the output schema, maxOutput, and a
+// safety margin is smaller. It never returns less than zero.
+func (b PromptBudget) InputTokens(model, instructions string, schema any, maxOutput int64) int {
+	fixed := CountTokens(instructions) + int(maxOutput) + contextMarginTokens
+	if schema != nil {
+		// The schema rides along as JSON; marshal errors would also fail the request, so ignore them.
+		raw, _ := json.Marshal(schema)
+		fixed += CountTokens(string(raw))
+	}
+	n := b.Limit(model)
+	if room := ContextWindowFor(model) - fixed; room < n {
+		n = room
+	}
+	return max(n, 0)
+}
+
+// lookupPrefix returns the value of the longest non-empty key that prefixes model.
+func lookupPrefix[V any](m map[string]V, model string) (V, bool) {
+	model = strings.ToLower(strings.TrimSpace(model))
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	for _, k := range keys {
+		if strings.HasPrefix(model, k) {
+			return m[k], true
+		}
+	}
+	var zero V
+	return zero, false
+}
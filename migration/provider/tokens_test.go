@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCountTokens(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"hello world", 2},
+		{"Hello, world!", 4},
+		{"internationalization", 4},
+		{"2025", 2},
+		{"a\n\nb", 3},
+		{"日本語", 3},
+	}
+	for _, c := range cases {
+		if got := CountTokens(c.in); got != c.want {
+			t.Errorf("CountTokens(%q)=%d, want %d", c.in, got, c.want)
+		}
+	}
+
+	// Plain English should land near the usual four characters per token, erring high.
+	prose := strings.Repeat("The user planned a move to Lisbon and asked about visas, flats, and budgets. ", 50)
+	got := CountTokens(prose)
+	if approx := len(prose) / 4; got < approx || got > approx*3/2 {
+		t.Fatalf("prose tokens=%d, bytes/4=%d", got, approx)
+	}
+}
+
+func TestParsePromptBudget(t *testing.T) {
+	t.Parallel()
+
+	zero, err := ParsePromptBudget("")
+	if err != nil || zero.Limit("gpt-5-mini") != DefaultInputTokens {
+		t.Fatalf("empty spec: limit=%d err=%v", zero.Limit("gpt-5-mini"), err)
+	}
+
+	b, err := ParsePromptBudget("30000, gpt-5=50000, gpt-5-mini=60000")
+	if err != nil {
+		t.Fatalf("ParsePromptBudget: %v", err)
+	}
+	for model, want := range map[string]int{"gpt-5-mini-2025-08-07": 60000, "gpt-5": 50000, "GPT-5-nano": 50000, "gpt-4o": 30000} {
+		if got := b.Limit(model); got != want {
+			t.Errorf("Limit(%s)=%d, want %d", model, got, want)
+		}
+	}
+
+	for _, bad := range []string{"gpt-5=", "=100", "gpt-5=-1", "gpt-5=lots", "gpt-5=1,gpt-5=2", "10,20"} {
+		if _, err := ParsePromptBudget(bad); err == nil {
+			t.Errorf("ParsePromptBudget(%q): expected error", bad)
+		}
+	}
+}
+
+func TestPromptBudget_InputTokensReservesContext(t *testing.T) {
+	t.Parallel()
+
+	b, _ := ParsePromptBudget("gpt-4o=500000")
+	instructions := strings.Repeat("word ", 1000)
+	schema := map[string]any{"type": "object", "properties": map[string]any{"summary": map[string]any{"type": "string"}}}
+	got := b.InputTokens("gpt-4o-mini", instructions, schema, 4000)
+	want := ContextWindows["gpt-4o"] - CountTokens(instructions) - 4000 - contextMarginTokens
+	if got >= want || got < want-50 {
+		t.Fatalf("InputTokens=%d, want just under %d (schema reserved)", got, want)
+	}
+
+	// The configured cap applies when it is the tighter limit.
+	if got := (PromptBudget{}).InputTokens("gpt-5-mini", instructions, schema, 4000); got != DefaultInputTokens {
+		t.Fatalf("default InputTokens=%d", got)
+	}
+	// Unknown models get the smallest known window.
+	if got := ContextWindowFor("mystery-model"); got != ContextWindows["gpt-4o"] {
+		t.Fatalf("unknown window=%d", got)
+	}
+	if got := b.InputTokens("gpt-4o", instructions, nil, 1_000_000); got != 0 {
+		t.Fatalf("overfull InputTokens=%d, want 0", got)
+	}
+}
@@ -0,0 +1,69 @@
+package migration
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RefreshPolicy selects existing artifacts for regeneration based on age or the model that produced
+// them, as a targeted alternative to overwriting everything.
+type RefreshPolicy struct {
+	// OlderThan refreshes artifacts whose file modification time is older than this (0 disables).
+	OlderThan time.Duration
+
+	// ModelMismatch refreshes artifacts produced by a different model than the current one.
+	// Artifacts that do not record a model are treated as mismatched.
+	ModelMismatch bool
+}
+
+// Enabled reports whether the policy can select anything.
+func (p RefreshPolicy) Enabled() bool {
+	return p.OlderThan > 0 || p.ModelMismatch
+}
+
+// Reason returns why the artifact at path should be refreshed, or "" if it should be kept.
+func (p RefreshPolicy) Reason(path, artifactModel, currentModel string, now time.Time) string {
+	if p.ModelMismatch && strings.TrimSpace(artifactModel) != strings.TrimSpace(currentModel) {
+		if artifactModel == "" {
+			return "model not recorded"
+		}
+		return fmt.Sprintf("model %s != %s", artifactModel, currentModel)
+	}
+	if p.OlderThan > 0 {
+		fi, err := os.Stat(path)
+		if err == nil && now.Sub(fi.ModTime()) > p.OlderThan {
+			return fmt.Sprintf("older than %s", p.OlderThan)
+		}
+	}
+	return ""
+}
+
+// ParseAge parses an age such as "90d", "2w", or any time.ParseDuration value ("36h").
+func ParseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	if unit > 0 {
+		n, err := strconv.ParseFloat(strings.TrimSpace(s[:len(s)-1]), 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("ParseAge: invalid age %q", s)
+		}
+		return time.Duration(n * float64(unit)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("ParseAge: invalid age %q", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,61 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]time.Duration{
+		"":    0,
+		"90d": 90 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"36h": 36 * time.Hour,
+	}
+	for in, want := range cases {
+		got, err := ParseAge(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseAge(%q)=%v,%v want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseAge("ninety days"); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestRefreshPolicyReason(t *testing.T) {
+	t.Parallel()
+
+	p := filepath.Join(t.TempDir(), "a.summary.json")
+	if err := os.WriteFile(p, []byte(`{}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	old := time.Now().Add(-100 * 24 * time.Hour)
+	if err := os.Chtimes(p, old, old); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	now := time.Now()
+
+	if r := (RefreshPolicy{}).Reason(p, "", "m", now); r != "" {
+		t.Fatalf("disabled policy reason=%q", r)
+	}
+	if r := (RefreshPolicy{OlderThan: 90 * 24 * time.Hour}).Reason(p, "m", "m", now); r == "" {
+		t.Fatalf("expected age-based refresh")
+	}
+	if r := (RefreshPolicy{OlderThan: 200 * 24 * time.Hour}).Reason(p, "m", "m", now); r != "" {
+		t.Fatalf("unexpected refresh: %q", r)
+	}
+	if r := (RefreshPolicy{ModelMismatch: true}).Reason(p, "old", "new", now); r == "" {
+		t.Fatalf("expected model mismatch refresh")
+	}
+	if r := (RefreshPolicy{ModelMismatch: true}).Reason(p, "", "new", now); r == "" {
+		t.Fatalf("expected refresh when model is unrecorded")
+	}
+	if r := (RefreshPolicy{ModelMismatch: true}).Reason(p, "new", "new", now); r != "" {
+		t.Fatalf("unexpected refresh: %q", r)
+	}
+}
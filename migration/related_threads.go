@@ -0,0 +1,148 @@
+package migration
+
+import (
+	"sort"
+	"strings"
+)
+
+// RelatedThread is a thread rolled up earlier, offered to a new rollup as background so the new summary
+// reuses its names for the same people, projects, and ideas.
+type RelatedThread struct {
+	ConversationID string
+	Title          string
+	Project        string
+	MicroSummary   string
+	Tags           []string
+	Terms          []string
+}
+
+// RelatedThreads finds earlier rollups that share a project or top tags/terms with a thread.
+type RelatedThreads struct {
+	threads []RelatedThread
+}
+
+// NewRelatedThreads indexes prior rollups. Rollups without a micro summary fall back to the start of the
+// full summary.
+func NewRelatedThreads(prior []ThreadSummary) *RelatedThreads {
+	r := &RelatedThreads{threads: make([]RelatedThread, 0, len(prior))}
+	for _, ts := range prior {
+		if ts.ConversationID == "" {
+			continue
+		}
+		micro := strings.TrimSpace(ts.MicroSummary)
+		if micro == "" {
+			micro = IndexSummary(ts, MicroSummaryMaxChars)
+		}
+		if micro == "" {
+			continue
+		}
+		r.threads = append(r.threads, RelatedThread{
+			ConversationID: ts.ConversationID,
+			Title:          ts.Title,
+			Project:        ts.Project,
+			MicroSummary:   micro,
+			Tags:           dedupeStrings(ts.Tags),
+			Terms:          dedupeStrings(ts.Terms),
+		})
+	}
+	return r
+}
+
+// Len reports how many prior threads are indexed.
+func (r *RelatedThreads) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.threads)
+}
+
+// Find returns up to n prior threads other than conversationID, best match first. Each shared tag or term
+// (case-insensitive) scores one point and a shared project two; threads scoring zero are never returned.
+func (r *RelatedThreads) Find(conversationID, project string, tags, terms []string, n int) []RelatedThread {
+	if r == nil || n <= 0 {
+		return nil
+	}
+	want := make(map[string]bool, len(tags)+len(terms))
+	for _, s := range append(append([]string(nil), tags...), terms...) {
+		if k := foldLabel(s); k != "" {
+			want[k] = true
+		}
+	}
+	project = foldLabel(project)
+
+	type scored struct {
+		t     RelatedThread
+		score int
+	}
+	var hits []scored
+	for _, t := range r.threads {
+		if t.ConversationID == conversationID {
+			continue
+		}
+		score := 0
+		seen := map[string]bool{}
+		for _, s := range append(append([]string(nil), t.Tags...), t.Terms...) {
+			k := foldLabel(s)
+			if want[k] && !seen[k] {
+				seen[k] = true
+				score++
+			}
+		}
+		if project != "" && foldLabel(t.Project) == project {
+			score += 2
+		}
+		if score > 0 {
+			hits = append(hits, scored{t: t, score: score})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].t.ConversationID < hits[j].t.ConversationID
+	})
+	if len(hits) > n {
+		hits = hits[:n]
+	}
+	out := make([]RelatedThread, 0, len(hits))
+	for _, h := range hits {
+		out = append(out, h.t)
+	}
+	return out
+}
+
+// TopLabels returns the k labels (case-insensitive) that appear in the most lists, most frequent first
+// and ties in first-seen order, keeping each label's first spelling. k <= 0 means no limit.
+func TopLabels(lists [][]string, k int) []string {
+	counts := map[string]int{}
+	first := map[string]string{}
+	var order []string
+	for _, list := range lists {
+		seen := map[string]bool{}
+		for _, s := range list {
+			key := foldLabel(s)
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			if _, ok := first[key]; !ok {
+				first[key] = strings.TrimSpace(s)
+				order = append(order, key)
+			}
+			counts[key]++
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return counts[order[i]] > counts[order[j]] })
+	if k > 0 && len(order) > k {
+		order = order[:k]
+	}
+	out := make([]string, 0, len(order))
+	for _, key := range order {
+		out = append(out, first[key])
+	}
+	return out
+}
+
+func foldLabel(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
@@ -0,0 +1,55 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRelatedThreads_FindScoresSharedLabelsAndProject(t *testing.T) {
+	t.Parallel()
+
+	r := NewRelatedThreads([]ThreadSummary{
+		{ConversationID: "self", MicroSummary: "This thread.", Tags: []string{"garden"}},
+		{ConversationID: "a", MicroSummary: "Tomato trellis.", Tags: []string{"Garden", "tomatoes"}},
+		{ConversationID: "b", MicroSummary: "Compost bins.", Project: "Backyard", Terms: []string{"compost"}},
+		{ConversationID: "c", MicroSummary: "Tax forms.", Tags: []string{"taxes"}},
+		{ConversationID: "d", Summary: "No micro summary here.", Tags: []string{"garden"}},
+		{ConversationID: "e", Tags: []string{"garden"}},
+	})
+	if r.Len() != 5 {
+		t.Fatalf("Len=%d, want 5 (e has no summary text)", r.Len())
+	}
+
+	got := r.Find("self", "backyard", []string{"garden", "Tomatoes"}, []string{"compost"}, 3)
+	var ids []string
+	for _, th := range got {
+		ids = append(ids, th.ConversationID)
+	}
+	if want := []string{"b", "a", "d"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("ids=%v, want %v", ids, want)
+	}
+	if got[2].MicroSummary != "No micro summary here." {
+		t.Fatalf("fallback micro=%q", got[2].MicroSummary)
+	}
+
+	if got := r.Find("self", "", []string{"knitting"}, nil, 3); len(got) != 0 {
+		t.Fatalf("unrelated labels matched %v", got)
+	}
+	var nilIndex *RelatedThreads
+	if got := nilIndex.Find("self", "", []string{"garden"}, nil, 3); got != nil {
+		t.Fatalf("nil index returned %v", got)
+	}
+}
+
+func TestTopLabels_CountsListsCaseInsensitively(t *testing.T) {
+	t.Parallel()
+
+	got := TopLabels([][]string{
+		{"Garden", "garden", "soil"},
+		{"soil", "GARDEN"},
+		{"soil", "rain"},
+	}, 2)
+	if want := []string{"soil", "Garden"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got=%v, want %v", got, want)
+	}
+}
@@ -0,0 +1,224 @@
+package retrieval
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+// Sources names the pipeline artifacts Load reads. Every path is optional, but at least one of the
+// thread and chunk indexes is needed for anything to be searchable.
+type Sources struct {
+	// FS is the filesystem the indexes and the summaries they point at are read from (default
+	// fileutils.OS). Paths are the OS paths stored by the pipeline; see fileutils.FSPath.
+	FS fs.FS
+
+	// ThreadIndexPath is thread-rollup's thread_index.json.
+	ThreadIndexPath string
+	// ChunkIndexPath is chunk-summarizer's index.json. Chunk keys are relative to its directory.
+	ChunkIndexPath string
+	// MemoryIndexPath is memory-pack's memory_index.json, used for shard anchors (skipped when missing).
+	MemoryIndexPath string
+	// EmbeddingsPath is vector-load's embeddings JSONL; rows attach vectors to documents by key (skipped
+	// when missing).
+	EmbeddingsPath string
+	// EmbeddingModel, when set, ignores embedding rows produced by a different model.
+	EmbeddingModel string
+}
+
+// Load reads the index rows named by src and builds an engine over them.
+func Load(src Sources) (*Engine, error) {
+	fsys := src.FS
+	if fsys == nil {
+		fsys = fileutils.OS
+	}
+	var docs []Doc
+	// Append-mode indices may hold several rows per key until compacted; the last one wins, in the
+	// position of the first.
+	pos := map[string]int{}
+	add := func(d Doc) {
+		if i, ok := pos[d.Key]; ok {
+			docs[i] = d
+			return
+		}
+		pos[d.Key] = len(docs)
+		docs = append(docs, d)
+	}
+
+	if src.ThreadIndexPath != "" {
+		err := readJSONL(fsys, src.ThreadIndexPath, func(b []byte) error {
+			var rec migration.ThreadIndexRecord
+			if err := json.Unmarshal(b, &rec); err != nil {
+				return err
+			}
+			if rec.ConversationID == "" {
+				return nil
+			}
+			add(Doc{
+				Kind: KindThread, Key: ThreadKey(rec.ConversationID), ConversationID: rec.ConversationID,
+				Title: rec.Title, Project: rec.Project, SourceType: rec.SourceType, ThreadStart: rec.ThreadStart,
+				SummaryPath: rec.ThreadSummaryPath, Summary: rec.Summary, Tags: rec.Tags, Terms: rec.Terms,
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("retrieval.Load: thread index: %w", err)
+		}
+	}
+
+	titles := make(map[string]string, len(docs))
+	projects := make(map[string]string, len(docs))
+	sourceTypes := make(map[string]string, len(docs))
+	for _, d := range docs {
+		titles[d.ConversationID] = d.Title
+		projects[d.ConversationID] = d.Project
+		sourceTypes[d.ConversationID] = d.SourceType
+	}
+
+	if src.ChunkIndexPath != "" {
+		base := filepath.Dir(src.ChunkIndexPath)
+		err := readJSONL(fsys, src.ChunkIndexPath, func(b []byte) error {
+			var rec migration.IndexRecord
+			if err := json.Unmarshal(b, &rec); err != nil {
+				return err
+			}
+			if rec.ConversationID == "" || rec.SummaryPath == "" {
+				return nil
+			}
+			rel, err := filepath.Rel(base, rec.SummaryPath)
+			if err != nil {
+				rel = rec.SummaryPath
+			}
+			sourceType := rec.SourceType
+			if sourceType == "" {
+				sourceType = sourceTypes[rec.ConversationID]
+			}
+			add(Doc{
+				Kind: KindChunk, Key: ChunkKey(rel), ConversationID: rec.ConversationID,
+				Title: titles[rec.ConversationID], Project: projects[rec.ConversationID], SourceType: sourceType, ThreadStart: rec.ThreadStart,
+				ChunkNumber: rec.ChunkNumber, TurnStart: rec.TurnStart, TurnEnd: rec.TurnEnd,
+				SummaryPath: rec.SummaryPath, Summary: rec.Summary, Tags: rec.Tags, Terms: rec.Terms,
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("retrieval.Load: chunk index: %w", err)
+		}
+	}
+
+	if src.MemoryIndexPath != "" {
+		shards := make(map[string]migration.MemoryShardIndexRecord)
+		err := readJSONL(fsys, src.MemoryIndexPath, func(b []byte) error {
+			var rec migration.MemoryShardIndexRecord
+			if err := json.Unmarshal(b, &rec); err != nil {
+				return err
+			}
+			shards[rec.ConversationID] = rec
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("retrieval.Load: memory index: %w", err)
+		}
+		for i := range docs {
+			if rec, ok := shards[docs[i].ConversationID]; ok {
+				docs[i].ShardFile, docs[i].Anchor, docs[i].ThreadFile = rec.ShardFile, rec.Anchor, rec.ThreadFile
+			}
+		}
+	}
+
+	if src.EmbeddingsPath != "" {
+		byKey := make(map[string]int, len(docs))
+		for i, d := range docs {
+			byKey[d.Key] = i
+		}
+		err := readJSONL(fsys, src.EmbeddingsPath, func(b []byte) error {
+			var row struct {
+				Key       string    `json:"key"`
+				Model     string    `json:"model"`
+				Embedding []float64 `json:"embedding"`
+			}
+			if err := json.Unmarshal(b, &row); err != nil {
+				return err
+			}
+			if src.EmbeddingModel != "" && row.Model != src.EmbeddingModel {
+				return nil
+			}
+			if i, ok := byKey[row.Key]; ok {
+				docs[i].Vector = row.Embedding
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("retrieval.Load: embeddings: %w", err)
+		}
+	}
+
+	e := New(docs)
+	e.fsys = fsys
+	return e, nil
+}
+
+func readJSONL(fsys fs.FS, path string, fn func([]byte) error) error {
+	f, err := fsys.Open(fileutils.FSPath(fsys, path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 1<<20), 64<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		b := bytes.TrimSpace(sc.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		if err := fn(b); err != nil {
+			return fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+	}
+	return sc.Err()
+}
+
+// resolve fills the hit's full summary from fsys, falling back to the index row.
+func resolve(fsys fs.FS, h *Hit) {
+	d := h.Doc
+	switch d.Kind {
+	case KindThread:
+		var ts migration.ThreadSummary
+		if !readSummary(fsys, d.SummaryPath, &ts) || ts.ConversationID == "" {
+			ts = migration.ThreadSummary{
+				ConversationID: d.ConversationID, Title: d.Title, Project: d.Project, SourceType: d.SourceType, ThreadStart: d.ThreadStart,
+				Summary: d.Summary, Tags: d.Tags, Terms: d.Terms,
+			}
+		}
+		h.Thread = &ts
+	case KindChunk:
+		var cs migration.ChunkSummary
+		if !readSummary(fsys, d.SummaryPath, &cs) || cs.ConversationID == "" {
+			cs = migration.ChunkSummary{
+				ConversationID: d.ConversationID, ThreadStart: d.ThreadStart, ChunkNumber: d.ChunkNumber,
+				TurnStart: d.TurnStart, TurnEnd: d.TurnEnd, Project: d.Project, SourceType: d.SourceType, Summary: d.Summary, Tags: d.Tags, Terms: d.Terms,
+			}
+		}
+		h.Chunk = &cs
+	}
+}
+
+func readSummary(fsys fs.FS, path string, v any) bool {
+	if path == "" {
+		return false
+	}
+	b, err := fs.ReadFile(fsys, fileutils.FSPath(fsys, path))
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(b, v) == nil
+}
@@ -0,0 +1,351 @@
+// Package retrieval ranks thread and chunk summaries for a query. It combines BM25 keyword scoring over
+// the pipeline's index rows with optional vector similarity, and resolves hits to their full summaries
+// and memory shard anchors. Search front ends should share this engine rather than re-implementing it.
+package retrieval
+
+import (
+	"io/fs"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+// Record kinds.
+const (
+	KindThread = "thread"
+	KindChunk  = "chunk"
+)
+
+// BM25 parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+
+	// fieldBoost repeats title, tag, and term tokens so matches there outrank incidental summary mentions.
+	fieldBoost = 2
+
+	defaultLimit        = 10
+	defaultVectorWeight = 0.5
+)
+
+// ThreadKey and ChunkKey are the record keys shared with vector-load's embeddings file.
+func ThreadKey(conversationID string) string { return KindThread + ":" + conversationID }
+
+// ChunkKey takes the chunk summary path relative to the summaries directory.
+func ChunkKey(relSummaryPath string) string {
+	return KindChunk + ":" + filepath.ToSlash(relSummaryPath)
+}
+
+// Doc is one searchable index row.
+type Doc struct {
+	Kind           string
+	Key            string
+	ConversationID string
+	Title          string
+	Project        string
+	SourceType     string
+	ThreadStart    *float64
+	ChunkNumber    int
+	TurnStart      int
+	TurnEnd        int
+	SummaryPath    string
+	Summary        string
+	Tags           []string
+	Terms          []string
+
+	// ShardFile and Anchor locate the thread in the memory shards (empty when no memory index was loaded).
+	ShardFile  string
+	Anchor     string
+	ThreadFile string
+
+	Vector []float64
+}
+
+// Query describes one search. Text drives keyword scoring and Vector (already embedded with the same
+// model as the documents) drives similarity; either may be empty.
+type Query struct {
+	Text   string
+	Vector []float64
+
+	// Kinds restricts results to KindThread and/or KindChunk (empty means both).
+	Kinds   []string
+	Project string
+	// SourceType keeps documents from one platform (see migration.NormalizeSourceType).
+	SourceType string
+	// Tags keeps documents carrying at least one of these tags or terms (case-insensitive).
+	Tags []string
+	// Since and Until bound thread start time; zero values are unbounded.
+	Since time.Time
+	Until time.Time
+
+	// Limit caps the number of hits (default 10).
+	Limit int
+	// VectorWeight is the share of the final score taken by vector similarity when Vector is set
+	// (default 0.5; 1 is pure vector search).
+	VectorWeight float64
+}
+
+// Hit is one ranked result. Exactly one of Thread and Chunk is set, loaded from the summary file or,
+// when that cannot be read, rebuilt from the index row.
+type Hit struct {
+	Doc          *Doc
+	Score        float64
+	KeywordScore float64
+	VectorScore  float64
+
+	Thread *migration.ThreadSummary
+	Chunk  *migration.ChunkSummary
+}
+
+type posting struct {
+	doc int
+	tf  int
+}
+
+// Engine is an in-memory index over Docs. It is safe for concurrent searches once built.
+type Engine struct {
+	// fsys is where hit summaries are read from; nil means fileutils.OS.
+	fsys     fs.FS
+	docs     []Doc
+	postings map[string][]posting
+	docLen   []int
+	avgLen   float64
+}
+
+// New builds an engine over docs.
+func New(docs []Doc) *Engine {
+	e := &Engine{docs: docs, postings: make(map[string][]posting), docLen: make([]int, len(docs))}
+	total := 0
+	for i, d := range docs {
+		tf := make(map[string]int)
+		n := 0
+		add := func(s string, weight int) {
+			for _, tok := range Tokenize(s) {
+				tf[tok] += weight
+				n += weight
+			}
+		}
+		add(d.Title, fieldBoost)
+		add(d.Summary, 1)
+		for _, t := range d.Tags {
+			add(t, fieldBoost)
+		}
+		for _, t := range d.Terms {
+			add(t, fieldBoost)
+		}
+		for tok, c := range tf {
+			e.postings[tok] = append(e.postings[tok], posting{doc: i, tf: c})
+		}
+		e.docLen[i] = n
+		total += n
+	}
+	if len(docs) > 0 {
+		e.avgLen = float64(total) / float64(len(docs))
+	}
+	return e
+}
+
+// FS returns the filesystem hit summaries are read from, so callers can read shards from the same place.
+func (e *Engine) FS() fs.FS {
+	if e.fsys == nil {
+		return fileutils.OS
+	}
+	return e.fsys
+}
+
+// Len reports the number of indexed documents.
+func (e *Engine) Len() int { return len(e.docs) }
+
+// HasVectors reports whether any document has an embedding, i.e. whether embedding the query is useful.
+func (e *Engine) HasVectors() bool {
+	for i := range e.docs {
+		if len(e.docs[i].Vector) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Search ranks documents for q. Without a query vector only keyword matches are returned; with one,
+// every document that has a vector is a candidate.
+func (e *Engine) Search(q Query) []Hit {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	weight := q.VectorWeight
+	if weight <= 0 || weight > 1 {
+		weight = defaultVectorWeight
+	}
+	if len(q.Vector) == 0 {
+		weight = 0
+	}
+
+	keyword := e.keywordScores(Tokenize(q.Text))
+	if len(q.Vector) > 0 && len(keyword) == 0 {
+		weight = 1
+	}
+	maxKeyword := 0.0
+	for _, s := range keyword {
+		maxKeyword = math.Max(maxKeyword, s)
+	}
+
+	var hits []Hit
+	for i := range e.docs {
+		d := &e.docs[i]
+		kw, hasKeyword := keyword[i]
+		vec := 0.0
+		hasVector := len(q.Vector) > 0 && len(d.Vector) == len(q.Vector)
+		if hasVector {
+			vec = math.Max(0, cosine(q.Vector, d.Vector))
+		}
+		if !hasKeyword && !hasVector {
+			continue
+		}
+		if !matches(d, q) {
+			continue
+		}
+		norm := 0.0
+		if maxKeyword > 0 {
+			norm = kw / maxKeyword
+		}
+		hits = append(hits, Hit{Doc: d, Score: (1-weight)*norm + weight*vec, KeywordScore: kw, VectorScore: vec})
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].Doc.Kind != hits[j].Doc.Kind {
+			return hits[i].Doc.Kind == KindThread
+		}
+		return hits[i].Doc.Key < hits[j].Doc.Key
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	for i := range hits {
+		resolve(e.FS(), &hits[i])
+	}
+	return hits
+}
+
+func (e *Engine) keywordScores(tokens []string) map[int]float64 {
+	scores := make(map[int]float64)
+	if len(tokens) == 0 || len(e.docs) == 0 {
+		return scores
+	}
+	n := float64(len(e.docs))
+	seen := make(map[string]bool, len(tokens))
+	for _, tok := range tokens {
+		if seen[tok] {
+			continue
+		}
+		seen[tok] = true
+		plist := e.postings[tok]
+		if len(plist) == 0 {
+			continue
+		}
+		df := float64(len(plist))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for _, p := range plist {
+			tf := float64(p.tf)
+			norm := 1 - bm25B + bm25B*float64(e.docLen[p.doc])/e.avgLen
+			scores[p.doc] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+	return scores
+}
+
+func matches(d *Doc, q Query) bool {
+	if len(q.Kinds) > 0 {
+		ok := false
+		for _, k := range q.Kinds {
+			if strings.EqualFold(k, d.Kind) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if q.Project != "" && !strings.EqualFold(q.Project, d.Project) {
+		return false
+	}
+	if q.SourceType != "" && migration.NormalizeSourceType(q.SourceType) != migration.NormalizeSourceType(d.SourceType) {
+		return false
+	}
+	if !q.Since.IsZero() || !q.Until.IsZero() {
+		if d.ThreadStart == nil || *d.ThreadStart <= 0 {
+			return false
+		}
+		start := time.Unix(int64(*d.ThreadStart), 0)
+		if !q.Since.IsZero() && start.Before(q.Since) {
+			return false
+		}
+		if !q.Until.IsZero() && !start.Before(q.Until) {
+			return false
+		}
+	}
+	if len(q.Tags) > 0 {
+		ok := false
+		for _, want := range q.Tags {
+			for _, have := range append(append([]string{}, d.Tags...), d.Terms...) {
+				if strings.EqualFold(strings.TrimSpace(want), strings.TrimSpace(have)) {
+					ok = true
+				}
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func cosine(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// stopwords are dropped from documents and queries.
+var stopwords = map[string]struct{}{
+	"a": {}, "an": {}, "and": {}, "are": {}, "as": {}, "at": {}, "be": {}, "but": {}, "by": {}, "for": {},
+	"from": {}, "had": {}, "has": {}, "have": {}, "he": {}, "her": {}, "his": {}, "i": {}, "in": {}, "is": {},
+	"it": {}, "its": {}, "of": {}, "on": {}, "or": {}, "she": {}, "that": {}, "the": {}, "their": {}, "them": {},
+	"they": {}, "this": {}, "to": {}, "was": {}, "we": {}, "were": {}, "what": {}, "when": {}, "which": {},
+	"who": {}, "will": {}, "with": {}, "you": {}, "your": {},
+}
+
+// Tokenize lowercases s and splits it into letter/digit runs, dropping stopwords and single letters.
+func Tokenize(s string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	out := fields[:0]
+	for _, f := range fields {
+		if len([]rune(f)) < 2 && !unicode.IsDigit([]rune(f)[0]) {
+			continue
+		}
+		if _, ok := stopwords[f]; ok {
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
@@ -0,0 +1,294 @@
+package retrieval
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+func f64(v float64) *float64 { return &v }
+
+func TestTokenize(t *testing.T) {
+	t.Parallel()
+
+	got := strings.Join(Tokenize("The Lisbon visa, 2 forms & a café!"), " ")
+	if got != "lisbon visa 2 forms café" {
+		t.Fatalf("Tokenize=%q", got)
+	}
+}
+
+func TestSearch_KeywordRankingAndFilters(t *testing.T) {
+	t.Parallel()
+
+	e := New([]Doc{
+		{Kind: KindThread, Key: ThreadKey("c1"), ConversationID: "c1", Title: "Moving to Lisbon", Summary: "Visa paperwork and apartments.", Tags: []string{"relocation"}, ThreadStart: f64(1700000000)},
+		{Kind: KindThread, Key: ThreadKey("c2"), ConversationID: "c2", SourceType: migration.SourceTypeWhatsApp, Title: "Sourdough", Summary: "Starter feeding; a friend mentioned Lisbon bakeries.", ThreadStart: f64(1600000000)},
+		{Kind: KindChunk, Key: ChunkKey("c1/c1_chunk_0001.summary.json"), ConversationID: "c1", Title: "Moving to Lisbon", Summary: "Compared visa types.", ThreadStart: f64(1700000000)},
+	})
+
+	hits := e.Search(Query{Text: "lisbon visa"})
+	if len(hits) != 3 {
+		t.Fatalf("len(hits)=%d", len(hits))
+	}
+	if hits[0].Doc.ConversationID != "c1" || hits[1].Doc.ConversationID != "c1" {
+		t.Fatalf("top hits=%+v %+v", hits[0].Doc, hits[1].Doc)
+	}
+	for _, h := range hits {
+		if (h.Doc.Kind == KindThread) != (h.Thread != nil) || (h.Doc.Kind == KindChunk) != (h.Chunk != nil) {
+			t.Fatalf("hit not resolved to its summary type: %+v", h)
+		}
+	}
+	if hits[len(hits)-1].Doc.ConversationID != "c2" {
+		t.Fatalf("weakest hit=%+v", hits[len(hits)-1].Doc)
+	}
+
+	hits = e.Search(Query{Text: "lisbon", Kinds: []string{KindChunk}})
+	if len(hits) != 1 || hits[0].Chunk == nil || hits[0].Chunk.Summary != "Compared visa types." {
+		t.Fatalf("chunk-only hits=%+v", hits)
+	}
+
+	hits = e.Search(Query{Text: "lisbon", Since: time.Unix(1650000000, 0)})
+	for _, h := range hits {
+		if h.Doc.ConversationID == "c2" {
+			t.Fatalf("Since did not exclude older thread")
+		}
+	}
+
+	hits = e.Search(Query{Text: "lisbon", Tags: []string{"Relocation"}})
+	if len(hits) != 1 || hits[0].Doc.Key != "thread:c1" {
+		t.Fatalf("tag-filtered hits=%+v", hits)
+	}
+
+	hits = e.Search(Query{Text: "lisbon", SourceType: migration.SourceTypeWhatsApp})
+	if len(hits) != 1 || hits[0].Doc.ConversationID != "c2" {
+		t.Fatalf("whatsapp hits=%+v", hits)
+	}
+	// Docs without a source type predate it and count as ChatGPT.
+	hits = e.Search(Query{Text: "lisbon", SourceType: "ChatGPT"})
+	if len(hits) != 2 || hits[0].Doc.ConversationID != "c1" || hits[1].Doc.ConversationID != "c1" {
+		t.Fatalf("chatgpt hits=%+v", hits)
+	}
+
+	if hits := e.Search(Query{Text: "the and"}); len(hits) != 0 {
+		t.Fatalf("stopword-only query returned %d hits", len(hits))
+	}
+}
+
+func TestSearch_HybridVector(t *testing.T) {
+	t.Parallel()
+
+	e := New([]Doc{
+		{Kind: KindThread, Key: "thread:a", ConversationID: "a", Summary: "garden tomatoes", Vector: []float64{1, 0}},
+		{Kind: KindThread, Key: "thread:b", ConversationID: "b", Summary: "tax return deadlines", Vector: []float64{0, 1}},
+	})
+
+	// Pure vector: no keyword overlap, ranking comes from similarity.
+	hits := e.Search(Query{Text: "vegetables", Vector: []float64{0.9, 0.1}})
+	if len(hits) != 2 || hits[0].Doc.Key != "thread:a" || hits[0].KeywordScore != 0 {
+		t.Fatalf("vector hits=%+v", hits)
+	}
+
+	// Hybrid: a strong keyword match can outrank a closer vector.
+	hits = e.Search(Query{Text: "tax deadlines", Vector: []float64{0.8, 0.2}, VectorWeight: 0.3})
+	if hits[0].Doc.Key != "thread:b" {
+		t.Fatalf("hybrid top=%s", hits[0].Doc.Key)
+	}
+}
+
+func writeJSONL(t *testing.T, path string, rows ...any) {
+	t.Helper()
+	var b strings.Builder
+	for _, r := range rows {
+		line, err := json.Marshal(r)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestLoad_JoinsIndexesAnchorsAndEmbeddings(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	summaries := filepath.Join(root, "summaries")
+	threads := filepath.Join(root, "thread_summaries")
+
+	threadPath := filepath.Join(threads, "c1.thread.summary.json")
+	b, _ := json.Marshal(migration.ThreadSummary{ConversationID: "c1", Title: "Moving to Lisbon", Summary: "Full rollup text.", KeyPoints: []string{"Apply by March"}})
+	if err := os.MkdirAll(threads, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(threadPath, b, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	writeJSONL(t, filepath.Join(threads, "thread_index.json"),
+		migration.ThreadIndexRecord{ConversationID: "c1", Title: "Moving to Lisbon", ThreadSummaryPath: threadPath, Summary: "Visa paperwork."})
+	writeJSONL(t, filepath.Join(summaries, "index.json"),
+		migration.IndexRecord{ConversationID: "c1", ChunkNumber: 1, SummaryPath: filepath.Join(summaries, "c1", "c1_chunk_0001.summary.json"), Summary: "Compared visa types."})
+	writeJSONL(t, filepath.Join(root, "memory_shards", "memory_index.json"),
+		migration.MemoryShardIndexRecord{ConversationID: "c1", ShardFile: "memory_shard_0001.md", Anchor: "thread-c1"})
+	writeJSONL(t, filepath.Join(root, "embeddings.jsonl"),
+		map[string]any{"key": "chunk:c1/c1_chunk_0001.summary.json", "model": "m", "embedding": []float64{1, 0}},
+		map[string]any{"key": "thread:c1", "model": "other", "embedding": []float64{0, 1}})
+
+	e, err := Load(Sources{
+		ThreadIndexPath: filepath.Join(threads, "thread_index.json"),
+		ChunkIndexPath:  filepath.Join(summaries, "index.json"),
+		MemoryIndexPath: filepath.Join(root, "memory_shards", "memory_index.json"),
+		EmbeddingsPath:  filepath.Join(root, "embeddings.jsonl"),
+		EmbeddingModel:  "m",
+	})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if e.Len() != 2 {
+		t.Fatalf("Len=%d", e.Len())
+	}
+
+	hits := e.Search(Query{Text: "visa"})
+	if len(hits) != 2 {
+		t.Fatalf("len(hits)=%d", len(hits))
+	}
+	for _, h := range hits {
+		if h.Doc.ShardFile != "memory_shard_0001.md" || h.Doc.Anchor != "thread-c1" {
+			t.Fatalf("anchor missing on %s: %+v", h.Doc.Key, h.Doc)
+		}
+		switch h.Doc.Kind {
+		case KindThread:
+			if h.Thread.Summary != "Full rollup text." {
+				t.Fatalf("thread summary not loaded from disk: %+v", h.Thread)
+			}
+			if h.Doc.Vector != nil {
+				t.Fatalf("vector from another model attached")
+			}
+		case KindChunk:
+			// The summary file is missing, so the hit falls back to the index row.
+			if h.Chunk.Summary != "Compared visa types." || h.Doc.Title != "Moving to Lisbon" {
+				t.Fatalf("chunk hit=%+v", h)
+			}
+			if len(h.Doc.Vector) != 2 {
+				t.Fatalf("chunk vector not attached")
+			}
+		}
+	}
+
+	if _, err := Load(Sources{MemoryIndexPath: filepath.Join(root, "missing.json")}); err != nil {
+		t.Fatalf("missing memory index should be skipped: %v", err)
+	}
+	if _, err := Load(Sources{ThreadIndexPath: filepath.Join(root, "missing.json")}); err == nil {
+		t.Fatalf("expected error for missing thread index")
+	}
+}
+
+func TestShardSection(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if _, err := migration.WriteMemoryShards([]migration.ThreadSummary{
+		{ConversationID: "c1", Title: "First", Summary: "One."},
+		{ConversationID: "c2", Title: "Second", Summary: "Two."},
+	}, migration.MemoryPackOptions{OutDir: dir}); err != nil {
+		t.Fatalf("WriteMemoryShards: %v", err)
+	}
+
+	got, err := ShardSection(fileutils.OS, dir, &Doc{ShardFile: "memories_0001.md", Anchor: "thread-c1"})
+	if err != nil {
+		t.Fatalf("ShardSection: %v", err)
+	}
+	if !strings.HasPrefix(got, `<a id="thread-c1"></a>`) || !strings.Contains(got, "One.") || strings.Contains(got, "Two.") || strings.HasSuffix(got, "---") {
+		t.Fatalf("section=%q", got)
+	}
+
+	if got, err := ShardSection(fileutils.OS, dir, &Doc{}); err != nil || got != "" {
+		t.Fatalf("unpacked doc: %q %v", got, err)
+	}
+	if _, err := ShardSection(fileutils.OS, dir, &Doc{ShardFile: "memories_0001.md", Anchor: "thread-missing"}); err == nil {
+		t.Fatalf("expected error for missing anchor")
+	}
+}
+
+func TestLoad_ReadsFromFS(t *testing.T) {
+	t.Parallel()
+
+	jsonl := func(rows ...any) *fstest.MapFile {
+		var b strings.Builder
+		for _, r := range rows {
+			line, _ := json.Marshal(r)
+			b.Write(line)
+			b.WriteByte('\n')
+		}
+		return &fstest.MapFile{Data: []byte(b.String())}
+	}
+	summary, _ := json.Marshal(migration.ThreadSummary{ConversationID: "c1", Title: "Moving to Lisbon", Summary: "Full rollup text."})
+	fsys := fstest.MapFS{
+		"threads/thread_summaries/thread_index.json": jsonl(migration.ThreadIndexRecord{
+			ConversationID: "c1", Title: "Moving to Lisbon", Summary: "Visa paperwork.",
+			// Index rows store OS paths; a leading "./" or "/" still resolves inside the FS.
+			ThreadSummaryPath: "./threads/thread_summaries/c1.thread.summary.json",
+		}),
+		"threads/thread_summaries/c1.thread.summary.json": &fstest.MapFile{Data: summary},
+		"threads/memory_shards/memory_index.json":         jsonl(migration.MemoryShardIndexRecord{ConversationID: "c1", ShardFile: "memories_0001.md", Anchor: "thread-c1"}),
+		"threads/memory_shards/memories_0001.md":          &fstest.MapFile{Data: []byte("<a id=\"thread-c1\"></a>\n## Moving to Lisbon\nVisa.\n\n---\n")},
+	}
+
+	e, err := Load(Sources{
+		FS:              fsys,
+		ThreadIndexPath: filepath.FromSlash("threads/thread_summaries/thread_index.json"),
+		MemoryIndexPath: "/threads/memory_shards/memory_index.json",
+	})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	hits := e.Search(Query{Text: "visa"})
+	if len(hits) != 1 || hits[0].Thread.Summary != "Full rollup text." {
+		t.Fatalf("hits=%+v", hits)
+	}
+	got, err := ShardSection(fsys, "threads/memory_shards", hits[0].Doc)
+	if err != nil || got != "<a id=\"thread-c1\"></a>\n## Moving to Lisbon\nVisa." {
+		t.Fatalf("section=%q err=%v", got, err)
+	}
+}
+
+func TestLoad_LastIndexRowWins(t *testing.T) {
+	t.Parallel()
+
+	var b strings.Builder
+	for _, rec := range []migration.IndexRecord{
+		{ConversationID: "c1", ChunkNumber: 1, SummaryPath: "summaries/c1/1.summary.json", Summary: "stale lisbon notes"},
+		{ConversationID: "c1", ChunkNumber: 2, SummaryPath: "summaries/c1/2.summary.json", Summary: "porto trip"},
+		{ConversationID: "c1", ChunkNumber: 1, SummaryPath: "summaries/c1/1.summary.json", Summary: "fresh lisbon notes"},
+	} {
+		line, _ := json.Marshal(rec)
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	fsys := fstest.MapFS{"summaries/index.json": &fstest.MapFile{Data: []byte(b.String())}}
+
+	e, err := Load(Sources{FS: fsys, ChunkIndexPath: "summaries/index.json"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if e.Len() != 2 {
+		t.Fatalf("Len=%d", e.Len())
+	}
+	hits := e.Search(Query{Text: "lisbon"})
+	if len(hits) != 1 || hits[0].Chunk.Summary != "fresh lisbon notes" {
+		t.Fatalf("hits=%+v", hits)
+	}
+}
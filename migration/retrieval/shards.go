@@ -0,0 +1,44 @@
+package retrieval
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+// ShardSection returns the markdown section for d from the memory shards in shardsDir on fsys: the
+// standalone thread file when memory-pack wrote one, otherwise the text between d's anchor and the next
+// one in its shard. It returns "" when d has no shard location.
+func ShardSection(fsys fs.FS, shardsDir string, d *Doc) (string, error) {
+	if d.ThreadFile != "" {
+		b, err := fs.ReadFile(fsys, fileutils.JoinFS(fsys, shardsDir, d.ThreadFile))
+		if err == nil {
+			return trimSection(string(b)), nil
+		}
+	}
+	if d.ShardFile == "" || d.Anchor == "" {
+		return "", nil
+	}
+	b, err := fs.ReadFile(fsys, fileutils.JoinFS(fsys, shardsDir, d.ShardFile))
+	if err != nil {
+		return "", fmt.Errorf("retrieval.ShardSection: %w", err)
+	}
+	s := string(b)
+	marker := fmt.Sprintf("<a id=%q></a>", d.Anchor)
+	i := strings.Index(s, marker)
+	if i < 0 {
+		return "", fmt.Errorf("retrieval.ShardSection: anchor %q not found in %s", d.Anchor, d.ShardFile)
+	}
+	s = s[i:]
+	if j := strings.Index(s[len(marker):], "<a id=\""); j >= 0 {
+		s = s[:len(marker)+j]
+	}
+	return trimSection(s), nil
+}
+
+func trimSection(s string) string {
+	s = strings.TrimSpace(s)
+	return strings.TrimSpace(strings.TrimSuffix(s, "---"))
+}
@@ -0,0 +1,22 @@
+package migration
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// IsHumanEdited reports whether the JSON artifact at path carries `"edited_by_human": true`. Missing or
+// unreadable files are not considered edited.
+func IsHumanEdited(path string) bool {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var probe struct {
+		EditedByHuman bool `json:"edited_by_human"`
+	}
+	if err := json.Unmarshal(b, &probe); err != nil {
+		return false
+	}
+	return probe.EditedByHuman
+}
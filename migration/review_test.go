@@ -0,0 +1,34 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsHumanEdited(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	edited := filepath.Join(dir, "edited.summary.json")
+	if err := os.WriteFile(edited, []byte(`{"summary":"x","edited_by_human":true}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	generated := filepath.Join(dir, "generated.summary.json")
+	if err := os.WriteFile(generated, []byte(`{"summary":"x"}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	broken := filepath.Join(dir, "broken.summary.json")
+	if err := os.WriteFile(broken, []byte(`{`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	if !IsHumanEdited(edited) {
+		t.Fatalf("edited artifact not detected")
+	}
+	for _, p := range []string{generated, broken, filepath.Join(dir, "missing.json")} {
+		if IsHumanEdited(p) {
+			t.Fatalf("IsHumanEdited(%s)=true", p)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package migration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// RunReportFileName is the file each stage writes into its output directory at the end of a run.
+const RunReportFileName = "run_report.json"
+
+// PipelineReportFileName is the report archive-pipeline writes into the threads directory.
+const PipelineReportFileName = "pipeline_report.json"
+
+// Run report statuses.
+const (
+	RunStatusOK              = "ok"
+	RunStatusBudgetExhausted = "budget_exhausted"
+	RunStatusFailed          = "failed"
+)
+
+// RunReport records what a single stage run did. Stages fill in the counters they track and leave the
+// rest zero.
+type RunReport struct {
+	Stage       string  `json:"stage"`
+	Status      string  `json:"status"`
+	ToolVersion string  `json:"tool_version"`
+	StartedAt   string  `json:"started_at"`
+	FinishedAt  string  `json:"finished_at"`
+	DurationSec float64 `json:"duration_seconds"`
+
+	Total     int64 `json:"total"`
+	Processed int64 `json:"processed"`
+	Skipped   int64 `json:"skipped"`
+	Failed    int64 `json:"failed"`
+
+	InputTokens  int64   `json:"input_tokens,omitempty"`
+	OutputTokens int64   `json:"output_tokens,omitempty"`
+	EstimatedUSD float64 `json:"estimated_usd,omitempty"`
+
+	// SourceTokens, SummaryTokens and CompressionRatio total the transcript and rollup sizes for
+	// stages that report how much they compressed.
+	SourceTokens     int64   `json:"source_tokens,omitempty"`
+	SummaryTokens    int64   `json:"summary_tokens,omitempty"`
+	CompressionRatio float64 `json:"compression_ratio,omitempty"`
+
+	Outputs  map[string]string `json:"outputs,omitempty"`
+	Warnings []string          `json:"warnings,omitempty"`
+	Config   any               `json:"config,omitempty"`
+
+	started time.Time
+}
+
+// NewRunReport starts a report for stage. cfg is stored as the config snapshot, so callers should pass
+// a copy with secrets (API keys) cleared.
+func NewRunReport(stage string, cfg any) *RunReport {
+	now := time.Now().UTC()
+	return &RunReport{
+		Stage:       stage,
+		Status:      RunStatusOK,
+		ToolVersion: ToolVersion(),
+		StartedAt:   now.Format(time.RFC3339),
+		Config:      cfg,
+		started:     now,
+	}
+}
+
+// Finish stamps the end time and duration.
+func (r *RunReport) Finish() {
+	now := time.Now().UTC()
+	r.FinishedAt = now.Format(time.RFC3339)
+	if !r.started.IsZero() {
+		r.DurationSec = now.Sub(r.started).Round(time.Millisecond).Seconds()
+	}
+}
+
+// WriteRunReport stamps r as finished and writes it as pretty JSON to path.
+func WriteRunReport(path string, r *RunReport) error {
+	if path == "" {
+		return errors.New("WriteRunReport: path is empty")
+	}
+	if r == nil {
+		return errors.New("WriteRunReport: report is nil")
+	}
+	r.Finish()
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("WriteRunReport: marshal: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("WriteRunReport: mkdir: %w", err)
+	}
+	if _, err := writeFileAtomic(path, b, 0o644); err != nil {
+		return fmt.Errorf("WriteRunReport: write: %w", err)
+	}
+	return nil
+}
+
+// ReadRunReport loads a report written by WriteRunReport.
+func ReadRunReport(path string) (RunReport, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return RunReport{}, fmt.Errorf("ReadRunReport: %w", err)
+	}
+	var r RunReport
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return RunReport{}, fmt.Errorf("ReadRunReport: parse %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// ToolVersion describes the running binary from its embedded build info: the module version plus the
+// VCS revision when the build recorded one. Binaries started via `go run` usually report "(devel)".
+func ToolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version := info.Main.Version
+	if version == "" {
+		version = "(devel)"
+	}
+	var rev, modified string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value
+		case "vcs.modified":
+			modified = s.Value
+		}
+	}
+	if rev != "" {
+		if len(rev) > 12 {
+			rev = rev[:12]
+		}
+		version += " " + rev
+		if modified == "true" {
+			version += "-dirty"
+		}
+	}
+	return version
+}
+
+// PromptVersion identifies the instructions a model call was given: a short hash of the prompt as sent
+// (style and language included), so artifacts written by different prompt revisions can be told apart.
+func PromptVersion(instructions string) string {
+	sum := sha256.Sum256([]byte(instructions))
+	return hex.EncodeToString(sum[:6])
+}
+
+// IsBookkeepingFile reports whether name is a pipeline bookkeeping file (run reports, spend ledger)
+// rather than a stage artifact, so directory scanners can skip it.
+func IsBookkeepingFile(name string) bool {
+	switch strings.ToLower(filepath.Base(name)) {
+	case RunReportFileName, PipelineReportFileName, "spend_ledger.json":
+		return true
+	}
+	return false
+}
+
+// PipelineReport concatenates the stage reports from one archive-pipeline run.
+type PipelineReport struct {
+	Status      string  `json:"status"`
+	ToolVersion string  `json:"tool_version"`
+	GitRevision string  `json:"git_revision,omitempty"`
+	StartedAt   string  `json:"started_at"`
+	FinishedAt  string  `json:"finished_at"`
+	DurationSec float64 `json:"duration_seconds"`
+
+	InputTokens  int64   `json:"input_tokens,omitempty"`
+	OutputTokens int64   `json:"output_tokens,omitempty"`
+	EstimatedUSD float64 `json:"estimated_usd,omitempty"`
+
+	Warnings []string    `json:"warnings,omitempty"`
+	Stages   []RunReport `json:"stages"`
+
+	started time.Time
+}
+
+// NewPipelineReport starts an empty pipeline report.
+func NewPipelineReport() *PipelineReport {
+	now := time.Now().UTC()
+	return &PipelineReport{
+		Status:      RunStatusOK,
+		ToolVersion: ToolVersion(),
+		StartedAt:   now.Format(time.RFC3339),
+		Stages:      []RunReport{},
+		started:     now,
+	}
+}
+
+// AddStage appends a stage report and folds its token usage into the pipeline totals.
+func (p *PipelineReport) AddStage(r RunReport) {
+	p.Stages = append(p.Stages, r)
+	p.InputTokens += r.InputTokens
+	p.OutputTokens += r.OutputTokens
+	p.EstimatedUSD += r.EstimatedUSD
+}
+
+// WritePipelineReport stamps p as finished and writes it as pretty JSON to path.
+func WritePipelineReport(path string, p *PipelineReport) error {
+	if path == "" {
+		return errors.New("WritePipelineReport: path is empty")
+	}
+	if p == nil {
+		return errors.New("WritePipelineReport: report is nil")
+	}
+	now := time.Now().UTC()
+	p.FinishedAt = now.Format(time.RFC3339)
+	if !p.started.IsZero() {
+		p.DurationSec = now.Sub(p.started).Round(time.Millisecond).Seconds()
+	}
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("WritePipelineReport: marshal: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("WritePipelineReport: mkdir: %w", err)
+	}
+	if _, err := writeFileAtomic(path, b, 0o644); err != nil {
+		return fmt.Errorf("WritePipelineReport: write: %w", err)
+	}
+	return nil
+}
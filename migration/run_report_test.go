@@ -0,0 +1,52 @@
+package migration
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteRunReport_RoundTripAndPipelineTotals(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "summaries", RunReportFileName)
+	r := NewRunReport("chunk-summarizer", map[string]any{"model": "gpt-5-mini"})
+	r.Total, r.Processed, r.Skipped, r.Failed = 10, 7, 2, 1
+	r.InputTokens, r.OutputTokens, r.EstimatedUSD = 1000, 200, 0.01
+	if err := WriteRunReport(path, r); err != nil {
+		t.Fatalf("WriteRunReport: %v", err)
+	}
+
+	got, err := ReadRunReport(path)
+	if err != nil {
+		t.Fatalf("ReadRunReport: %v", err)
+	}
+	if got.Stage != "chunk-summarizer" || got.Status != RunStatusOK || got.FinishedAt == "" || got.ToolVersion == "" {
+		t.Fatalf("report=%+v", got)
+	}
+	if got.Processed != 7 || got.Skipped != 2 || got.Failed != 1 {
+		t.Fatalf("counts=%d/%d/%d", got.Processed, got.Skipped, got.Failed)
+	}
+
+	p := NewPipelineReport()
+	p.AddStage(got)
+	p.AddStage(RunReport{Stage: "thread-rollup", InputTokens: 50, OutputTokens: 5})
+	if p.InputTokens != 1050 || p.OutputTokens != 205 || len(p.Stages) != 2 {
+		t.Fatalf("pipeline totals=%d/%d stages=%d", p.InputTokens, p.OutputTokens, len(p.Stages))
+	}
+	if err := WritePipelineReport(filepath.Join(filepath.Dir(path), PipelineReportFileName), p); err != nil {
+		t.Fatalf("WritePipelineReport: %v", err)
+	}
+}
+
+func TestIsBookkeepingFile(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"run_report.json", "threads/pipeline_report.json", "Spend_Ledger.json"} {
+		if !IsBookkeepingFile(name) {
+			t.Fatalf("IsBookkeepingFile(%q)=false", name)
+		}
+	}
+	if IsBookkeepingFile("2024-01-01_abc.json") {
+		t.Fatalf("thread file treated as bookkeeping")
+	}
+}
@@ -0,0 +1,194 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+// SegmentationReportFileName is the review of a run's chunk boundaries thread-chunker writes to its
+// output directory, to check segmentation before paying for summaries.
+const SegmentationReportFileName = "segmentation_report.md"
+
+// segmentationLineChars bounds the first user line quoted for each chunk.
+const segmentationLineChars = 120
+
+// SegmentationFlags sets which chunks the segmentation report flags as suspicious. Zero disables a check.
+type SegmentationFlags struct {
+	// ShortTurns flags chunks of at most this many turns, unless the chunk is the whole thread.
+	ShortTurns int
+	// LongTurns flags chunks of at least this many turns.
+	LongTurns int
+}
+
+// DefaultSegmentationFlags flags single-turn chunks and chunks of 80 turns or more.
+var DefaultSegmentationFlags = SegmentationFlags{ShortTurns: 1, LongTurns: 80}
+
+// SegmentedThread is one thread's chunks as the segmentation report lists them.
+type SegmentedThread struct {
+	ConversationID string
+	Title          string
+	Chunks         []SegmentedChunk
+}
+
+// SegmentedChunk is one chunk's boundaries and the first line its user wrote.
+type SegmentedChunk struct {
+	File          string
+	ChunkNumber   int
+	TurnStart     int
+	TurnEnd       int // exclusive
+	FirstUserLine string
+}
+
+// Turns is the chunk's length in turns.
+func (c SegmentedChunk) Turns() int { return c.TurnEnd - c.TurnStart }
+
+// flag names what is suspicious about the chunk, or is "" when nothing is.
+func (f SegmentationFlags) flag(c SegmentedChunk, chunks int) string {
+	switch {
+	case f.ShortTurns > 0 && chunks > 1 && c.Turns() <= f.ShortTurns:
+		return "short"
+	case f.LongTurns > 0 && c.Turns() >= f.LongTurns:
+		return "long"
+	}
+	return ""
+}
+
+// ReadSegmentedThread reads the chunk files in chunkDir (one thread's chunk directory), in turn order.
+// A directory without chunks gives a thread without chunks.
+func ReadSegmentedThread(chunkDir string) (SegmentedThread, error) {
+	files, err := ChunkFiles(chunkDir)
+	if err != nil {
+		return SegmentedThread{}, err
+	}
+	var st SegmentedThread
+	for _, p := range files {
+		var ch Chunk
+		if err := fileutils.ReadArtifact(p, &ch); err != nil {
+			return SegmentedThread{}, fmt.Errorf("ReadSegmentedThread: %w", err)
+		}
+		if st.ConversationID == "" {
+			st.ConversationID, st.Title = ch.ConversationID, ch.Title
+		}
+		st.Chunks = append(st.Chunks, SegmentedChunk{
+			File:          p,
+			ChunkNumber:   ch.ChunkNumber,
+			TurnStart:     ch.TurnStart,
+			TurnEnd:       ch.TurnEnd,
+			FirstUserLine: firstUserLine(ch.Messages),
+		})
+	}
+	sort.SliceStable(st.Chunks, func(i, j int) bool { return st.Chunks[i].TurnStart < st.Chunks[j].TurnStart })
+	return st, nil
+}
+
+// firstUserLine is the first non-empty line of the first user message with text, cut to
+// segmentationLineChars runes.
+func firstUserLine(msgs []SimplifiedMessage) string {
+	for _, m := range msgs {
+		if m.Role != "user" {
+			continue
+		}
+		for _, line := range strings.Split(m.Text, "\n") {
+			if line = strings.Join(strings.Fields(line), " "); line != "" {
+				if r := []rune(line); len(r) > segmentationLineChars {
+					return string(r[:segmentationLineChars]) + "…"
+				}
+				return line
+			}
+		}
+	}
+	return ""
+}
+
+// WriteSegmentationReport writes the segmentation report for threads to path: a summary with every
+// flagged chunk, then each thread's chunks with their turn ranges and first user lines. Chunk files
+// are linked relative to the report.
+func WriteSegmentationReport(path string, threads []SegmentedThread, flags SegmentationFlags) (flagged int, err error) {
+	if path == "" {
+		return 0, errors.New("WriteSegmentationReport: path is empty")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, fmt.Errorf("WriteSegmentationReport: mkdir: %w", err)
+	}
+	body, flagged := renderSegmentationReport(filepath.Dir(path), threads, flags)
+	if _, err := writeFileAtomic(path, []byte(body), 0o644); err != nil {
+		return 0, fmt.Errorf("WriteSegmentationReport: write: %w", err)
+	}
+	return flagged, nil
+}
+
+func renderSegmentationReport(dir string, threads []SegmentedThread, flags SegmentationFlags) (string, int) {
+	var (
+		b, flaggedLines strings.Builder
+		chunks, flagged int
+	)
+	anchors := newAnchorRegistry(nil)
+	sections := make([]string, len(threads))
+	for i, t := range threads {
+		anchor := anchors.assign(t.ConversationID)
+		var s strings.Builder
+		fmt.Fprintf(&s, "<a id=\"%s\"></a>\n## %s\n\n", anchor, threadTitle(t.Title, t.ConversationID))
+		turns := 0
+		if n := len(t.Chunks); n > 0 {
+			turns = t.Chunks[n-1].TurnEnd
+		}
+		fmt.Fprintf(&s, "`%s` · %s · %s\n\n", t.ConversationID, plural(turns, "turn"), plural(len(t.Chunks), "chunk"))
+		for _, c := range t.Chunks {
+			chunks++
+			line := fmt.Sprintf("chunk %d: turns %d–%d (%s)", c.ChunkNumber, c.TurnStart, c.TurnEnd-1, plural(c.Turns(), "turn"))
+			if rel, err := filepath.Rel(dir, c.File); err == nil {
+				line = fmt.Sprintf("[chunk %d](%s): turns %d–%d (%s)", c.ChunkNumber, filepath.ToSlash(rel), c.TurnStart, c.TurnEnd-1, plural(c.Turns(), "turn"))
+			}
+			if f := flags.flag(c, len(t.Chunks)); f != "" {
+				flagged++
+				line += " **" + f + "**"
+				fmt.Fprintf(&flaggedLines, "- [%s](#%s) chunk %d: %s, %s\n", inlineMarkdown(threadTitle(t.Title, t.ConversationID)), anchor, c.ChunkNumber, f, plural(c.Turns(), "turn"))
+			}
+			first := "(no user message)"
+			if c.FirstUserLine != "" {
+				first = "“" + inlineMarkdown(c.FirstUserLine) + "”"
+			}
+			fmt.Fprintf(&s, "- %s — %s\n", line, first)
+		}
+		sections[i] = s.String()
+	}
+
+	b.WriteString("# Segmentation report\n\n")
+	fmt.Fprintf(&b, "%s, %s, %s flagged", plural(len(threads), "thread"), plural(chunks, "chunk"), plural(flagged, "chunk"))
+	var rules []string
+	if flags.ShortTurns > 0 {
+		rules = append(rules, fmt.Sprintf("short: at most %s in a thread of several chunks", plural(flags.ShortTurns, "turn")))
+	}
+	if flags.LongTurns > 0 {
+		rules = append(rules, fmt.Sprintf("long: %s or more", plural(flags.LongTurns, "turn")))
+	}
+	if len(rules) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(rules, "; "))
+	}
+	b.WriteString(".\n\n")
+	if flaggedLines.Len() > 0 {
+		b.WriteString("## Flagged chunks\n\n")
+		b.WriteString(flaggedLines.String())
+		b.WriteString("\n")
+	}
+	b.WriteString(strings.Join(sections, "\n"))
+	return strings.TrimSuffix(b.String(), "\n"), flagged
+}
+
+// inlineMarkdown keeps text from opening links or emphasis inside a list item.
+func inlineMarkdown(s string) string {
+	return strings.NewReplacer("[", `\[`, "]", `\]`, "*", `\*`, "_", `\_`, "`", "\\`", "<", "&lt;").Replace(s)
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
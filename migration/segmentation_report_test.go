@@ -0,0 +1,75 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+)
+
+func TestWriteSegmentationReport_FlagsShortAndLongChunks(t *testing.T) {
+	t.Parallel()
+
+	out := t.TempDir()
+	writeChunks := func(id string, chunks ...Chunk) SegmentedThread {
+		dir := filepath.Join(out, id)
+		for i, ch := range chunks {
+			ch.ConversationID, ch.ChunkNumber = id, i
+			if err := fileutils.WriteArtifactAtomic(filepath.Join(dir, id+"_chunk_"+string(rune('a'+i))+".json"), ch, false); err != nil {
+				t.Fatalf("write chunk: %v", err)
+			}
+		}
+		st, err := ReadSegmentedThread(dir)
+		if err != nil {
+			t.Fatalf("ReadSegmentedThread: %v", err)
+		}
+		return st
+	}
+	user := func(text string) []SimplifiedMessage {
+		return []SimplifiedMessage{{Role: "assistant", Text: "hi"}, {Role: "user", Text: text}}
+	}
+	threads := []SegmentedThread{
+		writeChunks("c1",
+			Chunk{Title: "Moving", TurnStart: 0, TurnEnd: 20, Messages: user("\n  Lisbon   visa *paperwork*\nsecond line")},
+			Chunk{Title: "Moving", TurnStart: 20, TurnEnd: 21, Messages: user("ok")},
+			Chunk{Title: "Moving", TurnStart: 21, TurnEnd: 101, Messages: []SimplifiedMessage{{Role: "assistant", Text: "long answer"}}},
+		),
+		// A single-turn thread is one short chunk, which is not suspicious.
+		writeChunks("c2", Chunk{TurnStart: 0, TurnEnd: 1, Messages: user(strings.Repeat("é", 200))}),
+	}
+	if len(threads[0].Chunks) != 3 || threads[0].Chunks[0].FirstUserLine != "Lisbon visa *paperwork*" {
+		t.Fatalf("c1=%+v", threads[0])
+	}
+
+	path := filepath.Join(out, SegmentationReportFileName)
+	flagged, err := WriteSegmentationReport(path, threads, DefaultSegmentationFlags)
+	if err != nil {
+		t.Fatalf("WriteSegmentationReport: %v", err)
+	}
+	if flagged != 2 {
+		t.Fatalf("flagged=%d, want 2", flagged)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+	report := string(b)
+	for _, want := range []string{
+		"2 threads, 4 chunks, 2 chunks flagged",
+		"## Flagged chunks\n\n- [Moving](#thread-c1) chunk 1: short, 1 turn\n- [Moving](#thread-c1) chunk 2: long, 80 turns\n",
+		"`c1` · 101 turns · 3 chunks",
+		"- [chunk 0](c1/c1_chunk_a.json): turns 0–19 (20 turns) — “Lisbon visa \\*paperwork\\*”\n",
+		"- [chunk 2](c1/c1_chunk_c.json): turns 21–100 (80 turns) **long** — (no user message)\n",
+		"## c2\n",
+		"(1 turn) — “" + strings.Repeat("é", segmentationLineChars) + "…”",
+	} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("report missing %q:\n%s", want, report)
+		}
+	}
+	if strings.Contains(report, "c2_chunk_a.json): turns 0–0 (1 turn) **") {
+		t.Fatalf("single-chunk thread flagged:\n%s", report)
+	}
+}
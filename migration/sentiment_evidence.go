@@ -0,0 +1,78 @@
+package migration
+
+import "strings"
+
+// EmotionConfidence is the model's confidence, from 0 to 1, that an emotion it listed is present.
+type EmotionConfidence struct {
+	Emotion    string  `json:"emotion"`
+	Confidence float64 `json:"confidence"`
+}
+
+// TensionEvidence is the turn range [TurnStart, TurnEnd) that evidences one emotional tension.
+type TensionEvidence struct {
+	Tension   string `json:"tension"`
+	TurnStart int    `json:"turn_start"`
+	TurnEnd   int    `json:"turn_end"`
+}
+
+// SentimentEvidence is the optional confidence and evidence that -sentiment-evidence adds to chunk
+// and thread sentiment artifacts.
+type SentimentEvidence struct {
+	// EmotionConfidence scores the listed dominant, remembered, and present emotions.
+	EmotionConfidence []EmotionConfidence `json:"emotion_confidence,omitempty"`
+	// TensionEvidence points each emotional tension at the turns that support it.
+	TensionEvidence []TensionEvidence `json:"tension_evidence,omitempty"`
+}
+
+// Normalize trims names, clamps confidences to [0, 1], and keeps the first entry per emotion and
+// tension. Evidence ranges are clamped to [turnStart, turnEnd) and dropped when they fall outside it;
+// turnEnd <= turnStart leaves ranges unclamped. An empty range is widened to its first turn.
+func (e *SentimentEvidence) Normalize(turnStart, turnEnd int) {
+	seen := make(map[string]bool)
+	conf := e.EmotionConfidence[:0]
+	for _, c := range e.EmotionConfidence {
+		c.Emotion = strings.TrimSpace(c.Emotion)
+		key := strings.ToLower(c.Emotion)
+		if c.Emotion == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		c.Confidence = min(max(c.Confidence, 0), 1)
+		conf = append(conf, c)
+	}
+	e.EmotionConfidence = conf
+
+	clear(seen)
+	ev := e.TensionEvidence[:0]
+	for _, t := range e.TensionEvidence {
+		t.Tension = strings.TrimSpace(t.Tension)
+		key := strings.ToLower(t.Tension)
+		if t.Tension == "" || seen[key] {
+			continue
+		}
+		if t.TurnEnd <= t.TurnStart {
+			t.TurnEnd = t.TurnStart + 1
+		}
+		if turnEnd > turnStart {
+			if t.TurnEnd <= turnStart || t.TurnStart >= turnEnd {
+				continue
+			}
+			t.TurnStart = max(t.TurnStart, turnStart)
+			t.TurnEnd = min(t.TurnEnd, turnEnd)
+		}
+		seen[key] = true
+		ev = append(ev, t)
+	}
+	e.TensionEvidence = ev
+}
+
+// Confidence returns the confidence recorded for emotion (matched case-insensitively), or 1 and false
+// when none was, so callers weighting affect treat unscored emotions as certain.
+func (e SentimentEvidence) Confidence(emotion string) (float64, bool) {
+	for _, c := range e.EmotionConfidence {
+		if strings.EqualFold(c.Emotion, strings.TrimSpace(emotion)) {
+			return c.Confidence, true
+		}
+	}
+	return 1, false
+}
@@ -0,0 +1,56 @@
+package migration
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSentimentEvidence_Normalize(t *testing.T) {
+	t.Parallel()
+
+	e := SentimentEvidence{
+		EmotionConfidence: []EmotionConfidence{
+			{Emotion: " Joy ", Confidence: 1.4},
+			{Emotion: "joy", Confidence: 0.2},
+			{Emotion: "unease", Confidence: -0.5},
+			{Emotion: " "},
+		},
+		TensionEvidence: []TensionEvidence{
+			{Tension: "hope vs fear", TurnStart: 8, TurnEnd: 14},
+			{Tension: "pride vs doubt", TurnStart: 11, TurnEnd: 11},
+			{Tension: "calm vs urgency", TurnStart: 20, TurnEnd: 22},
+		},
+	}
+	e.Normalize(10, 15)
+
+	if len(e.EmotionConfidence) != 2 || e.EmotionConfidence[0] != (EmotionConfidence{Emotion: "Joy", Confidence: 1}) || e.EmotionConfidence[1].Confidence != 0 {
+		t.Fatalf("EmotionConfidence=%+v", e.EmotionConfidence)
+	}
+	want := []TensionEvidence{
+		{Tension: "hope vs fear", TurnStart: 10, TurnEnd: 14},
+		{Tension: "pride vs doubt", TurnStart: 11, TurnEnd: 12},
+	}
+	if len(e.TensionEvidence) != len(want) || e.TensionEvidence[0] != want[0] || e.TensionEvidence[1] != want[1] {
+		t.Fatalf("TensionEvidence=%+v", e.TensionEvidence)
+	}
+
+	if c, ok := e.Confidence("JOY"); !ok || c != 1 {
+		t.Fatalf("Confidence(JOY)=%v,%v", c, ok)
+	}
+	if c, ok := e.Confidence("grief"); ok || c != 1 {
+		t.Fatalf("Confidence(grief)=%v,%v", c, ok)
+	}
+}
+
+func TestSentimentEvidence_OmittedWhenEmpty(t *testing.T) {
+	t.Parallel()
+
+	b, err := json.Marshal(ChunkSentimentSummary{ConversationID: "c1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "emotion_confidence") || strings.Contains(string(b), "tension_evidence") {
+		t.Fatalf("empty evidence serialized: %s", b)
+	}
+}
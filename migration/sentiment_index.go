@@ -1,21 +1,131 @@
 package migration
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
+
+// SentimentIndexFieldNames lists the optional SentimentIndexFields by JSON name, in row order.
+// emotional_summary is always included.
+var SentimentIndexFieldNames = []string{
+	"dominant_emotions",
+	"remembered_emotions",
+	"present_emotions",
+	"emotional_tensions",
+	"relational_shift",
+	"emotional_arc",
+	"themes",
+	"symbols_or_metaphors",
+	"resonance_notes",
+	"tone_markers",
+}
+
+// SentimentIndexFieldSet is the set of optional fields sentiment index rows keep; nil keeps all.
+type SentimentIndexFieldSet map[string]bool
+
+// ParseSentimentIndexFields parses a -sentiment-index-fields value: a comma-separated list of
+// SentimentIndexFieldNames. Empty or "all" keeps every field.
+func ParseSentimentIndexFields(spec string) (SentimentIndexFieldSet, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "all" {
+		return nil, nil
+	}
+	known := make(map[string]bool, len(SentimentIndexFieldNames))
+	for _, n := range SentimentIndexFieldNames {
+		known[n] = true
+	}
+	set := SentimentIndexFieldSet{}
+	for _, f := range strings.Split(spec, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" || f == "emotional_summary" {
+			continue
+		}
+		if !known[f] {
+			return nil, fmt.Errorf("invalid -sentiment-index-fields: unknown field %q (want %s)", f, strings.Join(SentimentIndexFieldNames, ", "))
+		}
+		set[f] = true
+	}
+	return set, nil
+}
+
+// Select clears the fields set does not keep.
+func (f *SentimentIndexFields) Select(set SentimentIndexFieldSet) {
+	if set == nil {
+		return
+	}
+	if !set["dominant_emotions"] {
+		f.DominantEmotions = nil
+	}
+	if !set["remembered_emotions"] {
+		f.RememberedEmotions = nil
+	}
+	if !set["present_emotions"] {
+		f.PresentEmotions = nil
+	}
+	if !set["emotional_tensions"] {
+		f.EmotionalTensions = nil
+	}
+	if !set["relational_shift"] {
+		f.RelationalShift = ""
+	}
+	if !set["emotional_arc"] {
+		f.EmotionalArc = ""
+	}
+	if !set["themes"] {
+		f.Themes = nil
+	}
+	if !set["symbols_or_metaphors"] {
+		f.SymbolsOrMetaphors = nil
+	}
+	if !set["resonance_notes"] {
+		f.ResonanceNotes = ""
+	}
+	if !set["tone_markers"] {
+		f.ToneMarkers = nil
+	}
+}
+
+// BuildChunkSentimentIndexFields creates the sentiment payload of a chunk index row, trimmed and
+// deduplicated the same way as thread rows.
+func BuildChunkSentimentIndexFields(cs ChunkSentimentSummary) SentimentIndexFields {
+	return SentimentIndexFields{
+		EmotionalSummary:   strings.TrimSpace(cs.EmotionalSummary),
+		DominantEmotions:   dedupeStrings(cs.DominantEmotions),
+		RememberedEmotions: dedupeStrings(cs.RememberedEmotions),
+		PresentEmotions:    dedupeStrings(cs.PresentEmotions),
+		EmotionalTensions:  dedupeStrings(cs.EmotionalTensions),
+		RelationalShift:    strings.TrimSpace(cs.RelationalShift),
+		EmotionalArc:       strings.TrimSpace(cs.EmotionalArc),
+		Themes:             dedupeStrings(cs.Themes),
+		SymbolsOrMetaphors: dedupeStrings(cs.SymbolsOrMetaphors),
+		ResonanceNotes:     strings.TrimSpace(cs.ResonanceNotes),
+		ToneMarkers:        dedupeStrings(cs.ToneMarkers),
+	}
+}
 
 // BuildThreadSentimentIndexRecord creates an index row for a thread sentiment summary.
 func BuildThreadSentimentIndexRecord(ts ThreadSentimentSummary, path string) ThreadSentimentIndexRecord {
 	return ThreadSentimentIndexRecord{
 		ConversationID:             ts.ConversationID,
 		ThreadStart:                ts.ThreadStart,
+		ThreadUpdate:               ts.ThreadUpdate,
 		Title:                      ts.Title,
+		OriginalTitle:              ts.OriginalTitle,
+		Project:                    ts.Project,
+		SourceType:                 ts.SourceType,
 		ThreadSentimentSummaryPath: path,
-		EmotionalSummary:           strings.TrimSpace(ts.EmotionalSummary),
-		DominantEmotions:           dedupeStrings(ts.DominantEmotions),
-		RememberedEmotions:         dedupeStrings(ts.RememberedEmotions),
-		PresentEmotions:            dedupeStrings(ts.PresentEmotions),
-		EmotionalTensions:          dedupeStrings(ts.EmotionalTensions),
-		RelationalShift:            strings.TrimSpace(ts.RelationalShift),
-		EmotionalArc:               strings.TrimSpace(ts.EmotionalArc),
-		Themes:                     dedupeStrings(ts.Themes),
+		SentimentIndexFields: SentimentIndexFields{
+			EmotionalSummary:   strings.TrimSpace(ts.EmotionalSummary),
+			DominantEmotions:   dedupeStrings(ts.DominantEmotions),
+			RememberedEmotions: dedupeStrings(ts.RememberedEmotions),
+			PresentEmotions:    dedupeStrings(ts.PresentEmotions),
+			EmotionalTensions:  dedupeStrings(ts.EmotionalTensions),
+			RelationalShift:    strings.TrimSpace(ts.RelationalShift),
+			EmotionalArc:       strings.TrimSpace(ts.EmotionalArc),
+			Themes:             dedupeStrings(ts.Themes),
+			SymbolsOrMetaphors: dedupeStrings(ts.SymbolsOrMetaphors),
+			ResonanceNotes:     strings.TrimSpace(ts.ResonanceNotes),
+			ToneMarkers:        dedupeStrings(ts.ToneMarkers),
+		},
 	}
 }
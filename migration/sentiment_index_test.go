@@ -25,3 +25,40 @@ func TestBuildThreadSentimentIndexRecord_TrimsAndDedupes(t *testing.T) {
 		t.Fatalf("Themes=%v", rec.Themes)
 	}
 }
+
+func TestSentimentIndexFields_ChunkAndThreadAgreeAndSelect(t *testing.T) {
+	t.Parallel()
+
+	chunk := BuildChunkSentimentIndexFields(ChunkSentimentSummary{
+		EmotionalSummary: "warm",
+		ResonanceNotes:   " lingers ",
+		ToneMarkers:      []string{"gentle", "Gentle"},
+	})
+	thread := BuildThreadSentimentIndexRecord(ThreadSentimentSummary{
+		ConversationID:   "c1",
+		EmotionalSummary: "warm",
+		ResonanceNotes:   " lingers ",
+		ToneMarkers:      []string{"gentle", "Gentle"},
+	}, "x.json")
+	if chunk.ResonanceNotes != "lingers" || thread.ResonanceNotes != "lingers" {
+		t.Fatalf("ResonanceNotes chunk=%q thread=%q", chunk.ResonanceNotes, thread.ResonanceNotes)
+	}
+	if len(chunk.ToneMarkers) != 1 || len(thread.ToneMarkers) != 1 {
+		t.Fatalf("ToneMarkers chunk=%v thread=%v", chunk.ToneMarkers, thread.ToneMarkers)
+	}
+
+	if _, err := ParseSentimentIndexFields("themes,vibes"); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+	set, err := ParseSentimentIndexFields("tone_markers, emotional_summary")
+	if err != nil {
+		t.Fatalf("ParseSentimentIndexFields: %v", err)
+	}
+	chunk.Select(set)
+	if chunk.EmotionalSummary != "warm" || chunk.ResonanceNotes != "" || len(chunk.ToneMarkers) != 1 {
+		t.Fatalf("selected=%+v", chunk)
+	}
+	if all, err := ParseSentimentIndexFields("all"); err != nil || all != nil {
+		t.Fatalf("all=%v err=%v", all, err)
+	}
+}
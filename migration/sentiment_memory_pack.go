@@ -16,9 +16,14 @@ type SentimentMemoryShardIndexRecord struct {
 	ThreadStart    *float64 `json:"thread_start_time,omitempty"`
 	ThreadStartISO string   `json:"thread_start_time_iso8601,omitempty"`
 	Title          string   `json:"title,omitempty"`
+	Project        string   `json:"project,omitempty"`
+	SourceType     string   `json:"source_type,omitempty"`
 
-	ShardFile string `json:"shard_file"`
-	Anchor    string `json:"anchor"`
+	ShardFile   string       `json:"shard_file"`
+	Anchor      string       `json:"anchor"`
+	ThreadFile  string       `json:"thread_file,omitempty"`
+	SectionHash string       `json:"section_hash,omitempty"`
+	Sources     []SourceLink `json:"sources,omitempty"`
 
 	EmotionalSummary   string   `json:"emotional_summary"`
 	DominantEmotions   []string `json:"dominant_emotions,omitempty"`
@@ -32,6 +37,22 @@ type SentimentMemoryShardIndexRecord struct {
 
 // WriteSentimentMemoryShards writes markdown shard files for sentiment thread summaries.
 func WriteSentimentMemoryShards(threadSummaries []ThreadSentimentSummary, opts MemoryPackOptions) ([]SentimentMemoryShardIndexRecord, error) {
+	summaries := append([]ThreadSentimentSummary(nil), threadSummaries...)
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return threadOrderLess(summaries[i].ThreadStart, summaries[i].ConversationID, summaries[j].ThreadStart, summaries[j].ConversationID)
+	})
+	return writeSentimentMemoryShards(opts, func(add func(ThreadSentimentSummary) error) error {
+		for _, ts := range summaries {
+			if err := add(ts); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// writeSentimentMemoryShards packs the sentiment summaries each passes to add, in that order.
+func writeSentimentMemoryShards(opts MemoryPackOptions, each func(add func(ThreadSentimentSummary) error) error) ([]SentimentMemoryShardIndexRecord, error) {
 	if opts.OutDir == "" {
 		return nil, errors.New("WriteSentimentMemoryShards: OutDir is empty")
 	}
@@ -42,83 +63,60 @@ func WriteSentimentMemoryShards(threadSummaries []ThreadSentimentSummary, opts M
 		return nil, fmt.Errorf("WriteSentimentMemoryShards: mkdir OutDir: %w", err)
 	}
 
-	summaries := append([]ThreadSentimentSummary(nil), threadSummaries...)
-	sort.SliceStable(summaries, func(i, j int) bool {
-		ti := float64(0)
-		tj := float64(0)
-		if summaries[i].ThreadStart != nil {
-			ti = *summaries[i].ThreadStart
-		}
-		if summaries[j].ThreadStart != nil {
-			tj = *summaries[j].ThreadStart
-		}
-		if ti != tj {
-			return ti < tj
-		}
-		return summaries[i].ConversationID < summaries[j].ConversationID
-	})
-
+	first, err := opts.firstShard(sentimentShardName)
+	if err != nil {
+		return nil, fmt.Errorf("WriteSentimentMemoryShards: %w", err)
+	}
 	var (
-		shardNum     = 1
-		curr         strings.Builder
-		currBytes    = 0
-		currFilename = ""
-		index        []SentimentMemoryShardIndexRecord
+		labels  = opts.Templates.labels()
+		shard   = newShardBuffer("sentiment", labels.SentimentMemoryShard, labels.Contents, first).withFooter(opts.Footer, labels)
+		index   []SentimentMemoryShardIndexRecord
+		anchors = newAnchorRegistry(opts.Packed)
 	)
 
 	flush := func() error {
-		if currBytes == 0 {
+		if shard.threads == 0 {
 			return nil
 		}
-		if currFilename == "" {
-			currFilename = sentimentShardName(shardNum)
-		}
-		outPath := filepath.Join(opts.OutDir, currFilename)
+		outPath := filepath.Join(opts.OutDir, sentimentShardName(shard.num))
 		if !opts.Overwrite {
 			if _, err := os.Stat(outPath); err == nil {
 				return fmt.Errorf("WriteSentimentMemoryShards: shard exists: %s", outPath)
 			}
 		}
-		if _, err := writeFileAtomic(opts.OutDir, outPath, []byte(curr.String()), 0o644); err != nil {
+		if _, err := writeFileAtomic(outPath, []byte(shard.render()), 0o644); err != nil {
 			return fmt.Errorf("WriteSentimentMemoryShards: write shard: %w", err)
 		}
-		shardNum++
-		curr.Reset()
-		currBytes = 0
-		currFilename = ""
+		if opts.JSONShards {
+			if err := shard.writeJSON(outPath, opts.Overwrite); err != nil {
+				return fmt.Errorf("WriteSentimentMemoryShards: %w", err)
+			}
+		}
+		shard = shard.next()
 		return nil
 	}
 
-	for _, ts := range summaries {
+	add := func(ts ThreadSentimentSummary) error {
 		if ts.ConversationID == "" {
-			continue
-		}
-		section, anchor := renderThreadSentimentMarkdown(ts)
-		sectionBytes := len([]byte(section))
-
-		if currBytes > 0 && currBytes+sectionBytes > opts.MaxBytes {
-			if err := flush(); err != nil {
-				return nil, err
-			}
+			return nil
 		}
-
-		if currBytes == 0 {
-			currFilename = sentimentShardName(shardNum)
-			header := fmt.Sprintf("# Sentiment Memory Shard %04d\n\n", shardNum)
-			curr.WriteString(header)
-			currBytes += len([]byte(header))
+		anchor := anchors.assign(ts.ConversationID)
+		section, err := opts.Templates.renderSentimentThread(ts, anchor, labels)
+		if err != nil {
+			return fmt.Errorf("WriteSentimentMemoryShards: %w", err)
 		}
-
-		curr.WriteString(section)
-		currBytes += sectionBytes
-
-		index = append(index, SentimentMemoryShardIndexRecord{
+		sources := opts.Sources[ts.ConversationID]
+		section = withSourceLinks(section, sources, labels)
+		rec := SentimentMemoryShardIndexRecord{
 			ConversationID:     ts.ConversationID,
 			ThreadStart:        ts.ThreadStart,
 			ThreadStartISO:     threadStartISO8601(ts.ThreadStart),
 			Title:              ts.Title,
-			ShardFile:          currFilename,
+			Project:            ts.Project,
+			SourceType:         ts.SourceType,
 			Anchor:             anchor,
+			SectionHash:        sectionHash(section),
+			Sources:            sources,
 			EmotionalSummary:   truncateForIndex(ts.EmotionalSummary, 400),
 			DominantEmotions:   dedupeStrings(ts.DominantEmotions),
 			RememberedEmotions: dedupeStrings(ts.RememberedEmotions),
@@ -127,21 +125,59 @@ func WriteSentimentMemoryShards(threadSummaries []ThreadSentimentSummary, opts M
 			RelationalShift:    strings.TrimSpace(ts.RelationalShift),
 			EmotionalArc:       strings.TrimSpace(ts.EmotionalArc),
 			Themes:             dedupeStrings(ts.Themes),
-		})
+		}
+		if p, ok := opts.keep(ts.ConversationID, rec.SectionHash); ok {
+			rec.ShardFile, rec.ThreadFile = p.ShardFile, p.ThreadFile
+			index = append(index, rec)
+			return nil
+		}
+
+		if shard.threads > 0 && shard.size()+shard.entrySize(section, anchor, ts.Title, "") > opts.MaxBytes {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		shard.add(section, anchor, ts.Title, "", ts.ThreadStart)
+		shard.stamp(ts.Model, ts.PromptVersion)
+		rec.ShardFile = sentimentShardName(shard.num)
+
+		if opts.ThreadFiles {
+			var err error
+			rec.ThreadFile, err = writeThreadFile(opts.OutDir, ts.ConversationID, section, opts.Overwrite || opts.Packed != nil)
+			if err != nil {
+				return fmt.Errorf("WriteSentimentMemoryShards: %w", err)
+			}
+		}
+
+		if opts.JSONShards {
+			js := sentimentShardSection{SentimentMemoryShardIndexRecord: rec, Markdown: strings.TrimSuffix(section, sectionSeparator)}
+			js.EmotionalSummary = strings.TrimSpace(ts.EmotionalSummary)
+			shard.sections = append(shard.sections, js)
+		}
+		index = append(index, rec)
+		return nil
 	}
 
+	if err := each(add); err != nil {
+		return nil, err
+	}
 	if err := flush(); err != nil {
 		return nil, err
 	}
 	return index, nil
 }
 
+// sentimentShardSection is one section of a sentiment JSON shard, with the emotional summary untruncated.
+type sentimentShardSection struct {
+	SentimentMemoryShardIndexRecord
+	Markdown string `json:"markdown"`
+}
+
 func sentimentShardName(n int) string {
 	return fmt.Sprintf("sentiment_memories_%04d.md", n)
 }
 
-func renderThreadSentimentMarkdown(ts ThreadSentimentSummary) (section string, anchor string) {
-	anchor = "thread-" + sanitizeAnchor(ts.ConversationID)
+func renderThreadSentimentMarkdown(ts ThreadSentimentSummary, anchor string, labels ShardLabels) string {
 	title := strings.TrimSpace(ts.Title)
 	if title == "" {
 		title = ts.ConversationID
@@ -150,15 +186,7 @@ func renderThreadSentimentMarkdown(ts ThreadSentimentSummary) (section string, a
 	var b strings.Builder
 	fmt.Fprintf(&b, "<a id=\"%s\"></a>\n", anchor)
 	fmt.Fprintf(&b, "## %s\n\n", escapeMarkdownInline(title))
-	fmt.Fprintf(&b, "- conversation_id: `%s`\n", ts.ConversationID)
-	if ts.ThreadStart != nil {
-		iso := threadStartISO8601(ts.ThreadStart)
-		if iso != "" {
-			fmt.Fprintf(&b, "- thread_start_time: `%.3f` (`%s`)\n", *ts.ThreadStart, iso)
-		} else {
-			fmt.Fprintf(&b, "- thread_start_time: `%.3f`\n", *ts.ThreadStart)
-		}
-	}
+	writeSectionHeader(&b, ts.ConversationID, ts.ThreadStart, labels)
 	b.WriteString("\n")
 
 	if s := strings.TrimSpace(ts.EmotionalSummary); s != "" {
@@ -174,20 +202,20 @@ func renderThreadSentimentMarkdown(ts ThreadSentimentSummary) (section string, a
 		fmt.Fprintf(&b, "**%s**: %s\n\n", label, escapeMarkdownInline(strings.Join(items, ", ")))
 	}
 
-	writeList("dominant_emotions", ts.DominantEmotions)
-	writeList("remembered_emotions", ts.RememberedEmotions)
-	writeList("present_emotions", ts.PresentEmotions)
-	writeList("emotional_tensions", ts.EmotionalTensions)
-	writeList("themes", ts.Themes)
+	writeList(labels.DominantEmotions, ts.DominantEmotions)
+	writeList(labels.RememberedEmotions, ts.RememberedEmotions)
+	writeList(labels.PresentEmotions, ts.PresentEmotions)
+	writeList(labels.EmotionalTensions, ts.EmotionalTensions)
+	writeList(labels.Themes, ts.Themes)
 	if strings.TrimSpace(ts.RelationalShift) != "" {
-		fmt.Fprintf(&b, "**relational_shift**: %s\n\n", escapeMarkdownInline(strings.TrimSpace(ts.RelationalShift)))
+		fmt.Fprintf(&b, "**%s**: %s\n\n", labels.RelationalShift, escapeMarkdownInline(strings.TrimSpace(ts.RelationalShift)))
 	}
 	if strings.TrimSpace(ts.EmotionalArc) != "" {
-		fmt.Fprintf(&b, "**emotional_arc**: %s\n\n", escapeMarkdownInline(strings.TrimSpace(ts.EmotionalArc)))
+		fmt.Fprintf(&b, "**%s**: %s\n\n", labels.EmotionalArc, escapeMarkdownInline(strings.TrimSpace(ts.EmotionalArc)))
 	}
 
-	b.WriteString("\n---\n\n")
-	return b.String(), anchor
+	b.WriteString(sectionSeparator)
+	return b.String()
 }
 
 // WriteSentimentMemoryIndex writes sentiment shard index records as JSONL.
@@ -213,6 +241,6 @@ func WriteSentimentMemoryIndex(path string, records []SentimentMemoryShardIndexR
 		b.Write(line)
 		b.WriteByte('\n')
 	}
-	_, err := writeFileAtomic(filepath.Dir(path), path, []byte(b.String()), 0o644)
+	_, err := writeFileAtomic(path, []byte(b.String()), 0o644)
 	return err
 }
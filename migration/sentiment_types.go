@@ -5,9 +5,13 @@ package migration
 type ChunkSentimentSummary struct {
 	ConversationID string   `json:"conversation_id"`
 	ThreadStart    *float64 `json:"thread_start_time,omitempty"`
+	ThreadUpdate   *float64 `json:"thread_update_time,omitempty"`
 	ChunkNumber    int      `json:"chunk_number"`
 	TurnStart      int      `json:"turn_start"`
 	TurnEnd        int      `json:"turn_end"`
+	Project        string   `json:"project,omitempty"`
+	SourceType     string   `json:"source_type,omitempty"`
+	OriginalTitle  string   `json:"original_title,omitempty"`
 
 	EmotionalSummary string `json:"emotional_summary"`
 
@@ -24,13 +28,34 @@ type ChunkSentimentSummary struct {
 
 	ResonanceNotes string   `json:"resonance_notes,omitempty"`
 	ToneMarkers    []string `json:"tone_markers,omitempty"`
+
+	SentimentEvidence
+
+	// TurnSentiment summarizes the chunk's *.turns.sentiment.json under -turn-sentiment.
+	TurnSentiment *TurnSentimentAggregate `json:"turn_sentiment,omitempty"`
+
+	// Tiny is carried from Chunk.Tiny (see ChunkSummary.Tiny).
+	Tiny bool `json:"tiny,omitempty"`
+
+	Model string `json:"model,omitempty"`
+
+	// Style is the -style profile the artifact was written with (nil without one).
+	Style *StyleProfile `json:"style,omitempty"`
+
+	// EditedByHuman marks artifacts a person edited or approved in review-ui; stages never overwrite them.
+	EditedByHuman bool   `json:"edited_by_human,omitempty"`
+	ReviewedAt    string `json:"reviewed_at,omitempty"`
 }
 
 // ThreadSentimentSummary is the model-produced sentiment artifact for an entire thread, aggregated from chunk sentiment summaries.
 type ThreadSentimentSummary struct {
 	ConversationID string   `json:"conversation_id"`
 	Title          string   `json:"title,omitempty"`
+	OriginalTitle  string   `json:"original_title,omitempty"`
+	Project        string   `json:"project,omitempty"`
+	SourceType     string   `json:"source_type,omitempty"`
 	ThreadStart    *float64 `json:"thread_start_time,omitempty"`
+	ThreadUpdate   *float64 `json:"thread_update_time,omitempty"`
 
 	EmotionalSummary string `json:"emotional_summary"`
 
@@ -47,16 +72,30 @@ type ThreadSentimentSummary struct {
 
 	ResonanceNotes string   `json:"resonance_notes,omitempty"`
 	ToneMarkers    []string `json:"tone_markers,omitempty"`
-}
 
-// ThreadSentimentIndexRecord is a row mapping a thread to its sentiment rollup file.
-type ThreadSentimentIndexRecord struct {
-	ConversationID string   `json:"conversation_id"`
-	ThreadStart    *float64 `json:"thread_start_time,omitempty"`
-	Title          string   `json:"title,omitempty"`
+	SentimentEvidence
 
-	ThreadSentimentSummaryPath string `json:"thread_sentiment_summary_path"`
+	Model string `json:"model,omitempty"`
+
+	// Style is the -style profile the artifact was written with (nil without one).
+	Style *StyleProfile `json:"style,omitempty"`
 
+	// PromptVersion identifies the instructions the rollup was written with (see PromptVersion); empty
+	// for passthrough rollups and rollups written before it was recorded.
+	PromptVersion string `json:"prompt_version,omitempty"`
+
+	// Passthrough marks rollups copied from a single-chunk thread's chunk summary without a model call.
+	Passthrough bool `json:"passthrough,omitempty"`
+
+	// EditedByHuman marks artifacts a person edited or approved in review-ui; stages never overwrite them.
+	EditedByHuman bool   `json:"edited_by_human,omitempty"`
+	ReviewedAt    string `json:"reviewed_at,omitempty"`
+}
+
+// SentimentIndexFields is the sentiment payload of an index row. Chunk rows (chunk-summarizer's
+// sentiment_index.json) and thread rows (sentiment_thread_index.json) embed it so both indices have
+// one shape. Fields left out with -sentiment-index-fields are omitted.
+type SentimentIndexFields struct {
 	EmotionalSummary   string   `json:"emotional_summary"`
 	DominantEmotions   []string `json:"dominant_emotions,omitempty"`
 	RememberedEmotions []string `json:"remembered_emotions,omitempty"`
@@ -65,4 +104,22 @@ type ThreadSentimentIndexRecord struct {
 	RelationalShift    string   `json:"relational_shift,omitempty"`
 	EmotionalArc       string   `json:"emotional_arc,omitempty"`
 	Themes             []string `json:"themes,omitempty"`
+	SymbolsOrMetaphors []string `json:"symbols_or_metaphors,omitempty"`
+	ResonanceNotes     string   `json:"resonance_notes,omitempty"`
+	ToneMarkers        []string `json:"tone_markers,omitempty"`
+}
+
+// ThreadSentimentIndexRecord is a row mapping a thread to its sentiment rollup file.
+type ThreadSentimentIndexRecord struct {
+	ConversationID string   `json:"conversation_id"`
+	ThreadStart    *float64 `json:"thread_start_time,omitempty"`
+	ThreadUpdate   *float64 `json:"thread_update_time,omitempty"`
+	Title          string   `json:"title,omitempty"`
+	OriginalTitle  string   `json:"original_title,omitempty"`
+	Project        string   `json:"project,omitempty"`
+	SourceType     string   `json:"source_type,omitempty"`
+
+	ThreadSentimentSummaryPath string `json:"thread_sentiment_summary_path"`
+
+	SentimentIndexFields
 }
@@ -0,0 +1,59 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ShardFooter stamps the end of each shard with how and when it was produced, so a shard copied out
+// of its archive still says where it came from. The models and prompt versions are those recorded in
+// the shard's threads.
+type ShardFooter struct {
+	ToolVersion string
+	GeneratedAt time.Time
+}
+
+// withFooter has the shard (and the ones after it) end with footer, when it is non-nil.
+func (s *shardBuffer) withFooter(footer *ShardFooter, labels ShardLabels) *shardBuffer {
+	s.footer, s.labels = footer, labels
+	return s
+}
+
+// stamp records the model and prompt version a thread in the shard was written with.
+func (s *shardBuffer) stamp(model, promptVersion string) {
+	if s.footer == nil {
+		return
+	}
+	s.models = append(s.models, model)
+	s.prompts = append(s.prompts, promptVersion)
+}
+
+// renderFooter is the generation block after the last section, or "" without a footer.
+func (s *shardBuffer) renderFooter() string {
+	if s.footer == nil {
+		return ""
+	}
+	code := func(values []string) string {
+		values = dedupeStrings(values)
+		for i, v := range values {
+			values[i] = "`" + v + "`"
+		}
+		return strings.Join(values, ", ")
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s\n\n", s.labels.Generation)
+	if v := strings.TrimSpace(s.footer.ToolVersion); v != "" {
+		fmt.Fprintf(&b, "- %s: `%s`\n", s.labels.ToolVersion, v)
+	}
+	if models := code(s.models); models != "" {
+		fmt.Fprintf(&b, "- %s: %s\n", s.labels.Models, models)
+	}
+	if prompts := code(s.prompts); prompts != "" {
+		fmt.Fprintf(&b, "- %s: %s\n", s.labels.PromptVersions, prompts)
+	}
+	if !s.footer.GeneratedAt.IsZero() {
+		fmt.Fprintf(&b, "- %s: `%s`\n", s.labels.GeneratedAt, s.footer.GeneratedAt.UTC().Format(time.RFC3339))
+	}
+	return b.String()
+}
@@ -0,0 +1,40 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMemoryShards_Footer(t *testing.T) {
+	t.Parallel()
+
+	outDir := t.TempDir()
+	footer := &ShardFooter{ToolVersion: "v1.2.3", GeneratedAt: time.Date(2026, 10, 16, 9, 30, 0, 0, time.FixedZone("CEST", 2*3600))}
+	index, err := WriteMemoryShards([]ThreadSummary{
+		{ConversationID: "c1", Title: "T1", Summary: "one", Model: "m1", PromptVersion: "aaaa"},
+		{ConversationID: "c2", Title: "T2", Summary: "two", Model: "m2", PromptVersion: "aaaa"},
+		{ConversationID: "c3", Title: "T3", Summary: "three", Model: "m1"},
+	}, MemoryPackOptions{OutDir: outDir, Footer: footer})
+	if err != nil {
+		t.Fatalf("WriteMemoryShards: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(outDir, index[0].ShardFile))
+	if err != nil {
+		t.Fatalf("read shard: %v", err)
+	}
+	want := "\n---\n\n## Generation\n\n- tool_version: `v1.2.3`\n- models: `m1`, `m2`\n- prompt_versions: `aaaa`\n- generated_at: `2026-10-16T07:30:00Z`\n"
+	if !strings.Contains(string(b), want) {
+		t.Fatalf("shard footer:\n%s", b)
+	}
+
+	plain, err := WriteMemoryShards([]ThreadSummary{{ConversationID: "c1", Title: "T1", Summary: "one"}}, MemoryPackOptions{OutDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("WriteMemoryShards: %v", err)
+	}
+	if plain[0].SectionHash != index[0].SectionHash {
+		t.Fatalf("footer changed the section hash")
+	}
+}
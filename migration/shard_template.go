@@ -0,0 +1,277 @@
+package migration
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Files looked up in a template directory: thread section templates, and label overrides.
+const (
+	ThreadTemplateFileName          = "thread.md.tmpl"
+	SentimentThreadTemplateFileName = "sentiment_thread.md.tmpl"
+	ShardLabelsFileName             = "labels.json"
+)
+
+// ShardTemplates replace the built-in thread section rendering. A nil template (or a nil
+// *ShardTemplates) keeps the built-in rendering for that kind.
+type ShardTemplates struct {
+	Thread          *template.Template
+	SentimentThread *template.Template
+	// Labels are the headings and field names the built-in rendering and shard headers use.
+	Labels ShardLabels
+}
+
+// ShardLabels are the fixed words in shards, so an archive can be rendered in another language.
+// The JSON names are the keys of ShardLabelsFileName.
+type ShardLabels struct {
+	MemoryShard          string `json:"memory_shard"`
+	SentimentMemoryShard string `json:"sentiment_memory_shard"`
+	Contents             string `json:"contents"`
+	ConversationID       string `json:"conversation_id"`
+	ThreadStart          string `json:"thread_start_time"`
+	KeyPoints            string `json:"key_points"`
+	Tags                 string `json:"tags"`
+	Terms                string `json:"terms"`
+	DominantEmotions     string `json:"dominant_emotions"`
+	RememberedEmotions   string `json:"remembered_emotions"`
+	PresentEmotions      string `json:"present_emotions"`
+	EmotionalTensions    string `json:"emotional_tensions"`
+	Themes               string `json:"themes"`
+	RelationalShift      string `json:"relational_shift"`
+	EmotionalArc         string `json:"emotional_arc"`
+	Sources              string `json:"sources"`
+	Chunk                string `json:"chunk"`
+	Summary              string `json:"summary"`
+	Generation           string `json:"generation"`
+	ToolVersion          string `json:"tool_version"`
+	Models               string `json:"models"`
+	PromptVersions       string `json:"prompt_versions"`
+	GeneratedAt          string `json:"generated_at"`
+}
+
+// DefaultShardLabels returns the labels shards use unless a labels file replaces them.
+func DefaultShardLabels() ShardLabels {
+	return ShardLabels{
+		MemoryShard:          "Memory Shard",
+		SentimentMemoryShard: "Sentiment Memory Shard",
+		Contents:             "Contents",
+		ConversationID:       "conversation_id",
+		ThreadStart:          "thread_start_time",
+		KeyPoints:            "Key points",
+		Tags:                 "tags",
+		Terms:                "terms",
+		DominantEmotions:     "dominant_emotions",
+		RememberedEmotions:   "remembered_emotions",
+		PresentEmotions:      "present_emotions",
+		EmotionalTensions:    "emotional_tensions",
+		Themes:               "themes",
+		RelationalShift:      "relational_shift",
+		EmotionalArc:         "emotional_arc",
+		Sources:              "Sources",
+		Chunk:                "chunk",
+		Summary:              "summary",
+		Generation:           "Generation",
+		ToolVersion:          "tool_version",
+		Models:               "models",
+		PromptVersions:       "prompt_versions",
+		GeneratedAt:          "generated_at",
+	}
+}
+
+// labels returns the labels to render with: DefaultShardLabels without templates.
+func (t *ShardTemplates) labels() ShardLabels {
+	if t == nil {
+		return DefaultShardLabels()
+	}
+	return t.Labels
+}
+
+// ThreadTemplateData is what ThreadTemplateFileName renders. KeyPoints, Tags and Terms are empty when
+// the pack options leave them out, and are deduplicated.
+type ThreadTemplateData struct {
+	Labels         ShardLabels
+	Anchor         string
+	ConversationID string
+	Title          string
+	Project        string
+	SourceType     string
+	ThreadStart    *float64
+	ThreadStartISO string
+	Summary        string
+	MicroSummary   string
+	KeyPoints      []string
+	Tags           []string
+	Terms          []string
+}
+
+// SentimentThreadTemplateData is what SentimentThreadTemplateFileName renders.
+type SentimentThreadTemplateData struct {
+	Labels             ShardLabels
+	Anchor             string
+	ConversationID     string
+	Title              string
+	Project            string
+	SourceType         string
+	ThreadStart        *float64
+	ThreadStartISO     string
+	EmotionalSummary   string
+	DominantEmotions   []string
+	RememberedEmotions []string
+	PresentEmotions    []string
+	EmotionalTensions  []string
+	Themes             []string
+	RelationalShift    string
+	EmotionalArc       string
+}
+
+// shardTemplateFuncs are available to thread templates besides the text/template builtins.
+var shardTemplateFuncs = template.FuncMap{
+	"join":   strings.Join,
+	"trim":   strings.TrimSpace,
+	"inline": escapeMarkdownInline,
+	"time": func(start *float64) string {
+		if start == nil {
+			return ""
+		}
+		return fmt.Sprintf("%.3f", *start)
+	},
+}
+
+// LoadShardTemplates parses ThreadTemplateFileName and SentimentThreadTemplateFileName from dir, and
+// reads ShardLabelsFileName over DefaultShardLabels. Any of them may be missing, but not all: a
+// directory with none is most likely the wrong one.
+func LoadShardTemplates(dir string) (*ShardTemplates, error) {
+	load := func(name string) (*template.Template, error) {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read template: %w", err)
+		}
+		t, err := template.New(name).Funcs(shardTemplateFuncs).Option("missingkey=error").Parse(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("parse template: %w", err)
+		}
+		return t, nil
+	}
+	var (
+		out = ShardTemplates{Labels: DefaultShardLabels()}
+		err error
+	)
+	if out.Thread, err = load(ThreadTemplateFileName); err != nil {
+		return nil, err
+	}
+	if out.SentimentThread, err = load(SentimentThreadTemplateFileName); err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(filepath.Join(dir, ShardLabelsFileName))
+	switch {
+	case err == nil:
+		if err := decodeShardLabels(b, &out.Labels); err != nil {
+			return nil, fmt.Errorf("read %s: %w", ShardLabelsFileName, err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("read labels: %w", err)
+	case out.Thread == nil && out.SentimentThread == nil:
+		return nil, fmt.Errorf("template dir %s has none of %s, %s, %s", dir, ThreadTemplateFileName, SentimentThreadTemplateFileName, ShardLabelsFileName)
+	}
+	return &out, nil
+}
+
+// decodeShardLabels sets the labels b names, keeping the rest. Unknown keys are an error so a
+// misspelled label is not silently ignored.
+func decodeShardLabels(b []byte, labels *ShardLabels) error {
+	var set map[string]string
+	if err := json.Unmarshal(b, &set); err != nil {
+		return err
+	}
+	for k, v := range set {
+		if strings.TrimSpace(v) == "" {
+			delete(set, k)
+		}
+	}
+	merged, err := json.Marshal(set)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(merged))
+	dec.DisallowUnknownFields()
+	return dec.Decode(labels)
+}
+
+// renderThread renders a semantic thread section with the Thread template, or the built-in layout.
+func (t *ShardTemplates) renderThread(ts ThreadSummary, anchor string, labels ShardLabels, includeKeyPoints, includeTags bool) (string, error) {
+	if t == nil || t.Thread == nil {
+		return renderThreadMarkdown(ts, anchor, labels, includeKeyPoints, includeTags), nil
+	}
+	data := ThreadTemplateData{
+		Labels:         labels,
+		Anchor:         anchor,
+		ConversationID: ts.ConversationID,
+		Title:          threadTitle(ts.Title, ts.ConversationID),
+		Project:        ts.Project,
+		SourceType:     ts.SourceType,
+		ThreadStart:    ts.ThreadStart,
+		ThreadStartISO: threadStartISO8601(ts.ThreadStart),
+		Summary:        strings.TrimSpace(ts.Summary),
+		MicroSummary:   strings.TrimSpace(ts.MicroSummary),
+	}
+	if includeKeyPoints {
+		data.KeyPoints = dedupeStrings(ts.KeyPoints)
+	}
+	if includeTags {
+		data.Tags, data.Terms = dedupeStrings(ts.Tags), dedupeStrings(ts.Terms)
+	}
+	return executeSectionTemplate(t.Thread, data)
+}
+
+// renderSentimentThread is renderThread for sentiment thread summaries.
+func (t *ShardTemplates) renderSentimentThread(ts ThreadSentimentSummary, anchor string, labels ShardLabels) (string, error) {
+	if t == nil || t.SentimentThread == nil {
+		return renderThreadSentimentMarkdown(ts, anchor, labels), nil
+	}
+	data := SentimentThreadTemplateData{
+		Labels:             labels,
+		Anchor:             anchor,
+		ConversationID:     ts.ConversationID,
+		Title:              threadTitle(ts.Title, ts.ConversationID),
+		Project:            ts.Project,
+		SourceType:         ts.SourceType,
+		ThreadStart:        ts.ThreadStart,
+		ThreadStartISO:     threadStartISO8601(ts.ThreadStart),
+		EmotionalSummary:   strings.TrimSpace(ts.EmotionalSummary),
+		DominantEmotions:   dedupeStrings(ts.DominantEmotions),
+		RememberedEmotions: dedupeStrings(ts.RememberedEmotions),
+		PresentEmotions:    dedupeStrings(ts.PresentEmotions),
+		EmotionalTensions:  dedupeStrings(ts.EmotionalTensions),
+		Themes:             dedupeStrings(ts.Themes),
+		RelationalShift:    strings.TrimSpace(ts.RelationalShift),
+		EmotionalArc:       strings.TrimSpace(ts.EmotionalArc),
+	}
+	return executeSectionTemplate(t.SentimentThread, data)
+}
+
+// executeSectionTemplate renders one section and ends it with sectionSeparator, as the built-in
+// sections are, so shard sizing, thread files and JSON shards treat both alike.
+func executeSectionTemplate(t *template.Template, data any) (string, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("render %s: %w", t.Name(), err)
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n" + sectionSeparator, nil
+}
+
+// threadTitle is the section heading: the title, or the conversation ID for an untitled thread.
+func threadTitle(title, conversationID string) string {
+	if title = strings.TrimSpace(title); title != "" {
+		return title
+	}
+	return conversationID
+}
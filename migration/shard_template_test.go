@@ -0,0 +1,112 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadShardTemplates_RendersThreadSections(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	tmpl := `<a id="{{.Anchor}}"></a>
+### Fil : {{inline .Title}}
+{{.Summary}}
+{{if .Tags}}étiquettes : {{join .Tags ", "}}{{end}}
+`
+	if err := os.WriteFile(filepath.Join(dir, ThreadTemplateFileName), []byte(tmpl), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	templates, err := LoadShardTemplates(dir)
+	if err != nil {
+		t.Fatalf("LoadShardTemplates: %v", err)
+	}
+	if templates.SentimentThread != nil {
+		t.Fatalf("sentiment template should fall back to the built-in layout")
+	}
+
+	outDir := t.TempDir()
+	index, err := WriteMemoryShards([]ThreadSummary{
+		{ConversationID: "c1", Title: "T1", Summary: "hello", Tags: []string{"a", "b", "a"}},
+	}, MemoryPackOptions{OutDir: outDir, MaxBytes: 100 * 1024, IncludeTags: true, Templates: templates})
+	if err != nil {
+		t.Fatalf("WriteMemoryShards: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(outDir, index[0].ShardFile))
+	if err != nil {
+		t.Fatalf("read shard: %v", err)
+	}
+	got := string(b)
+	for _, want := range []string{"- [T1](#thread-c1)", `<a id="thread-c1"></a>`, "### Fil : T1\nhello\nétiquettes : a, b\n\n---\n"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("shard missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "conversation_id:") {
+		t.Fatalf("built-in layout used:\n%s", got)
+	}
+}
+
+func TestLoadShardTemplates_Errors(t *testing.T) {
+	t.Parallel()
+
+	if _, err := LoadShardTemplates(t.TempDir()); err == nil {
+		t.Fatalf("expected an error for a directory without templates")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, SentimentThreadTemplateFileName), []byte("{{.Nope}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	templates, err := LoadShardTemplates(dir)
+	if err != nil {
+		t.Fatalf("LoadShardTemplates: %v", err)
+	}
+	_, err = WriteSentimentMemoryShards([]ThreadSentimentSummary{{ConversationID: "c1"}}, MemoryPackOptions{OutDir: t.TempDir(), Templates: templates})
+	if err == nil || !strings.Contains(err.Error(), SentimentThreadTemplateFileName) {
+		t.Fatalf("err=%v, want a render error naming the template", err)
+	}
+}
+
+func TestLoadShardTemplates_Labels(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	labels := `{"memory_shard":"Erinnerungs-Shard","contents":"Inhalt","key_points":"Kernpunkte","tags":"Schlagwörter","conversation_id":""}`
+	if err := os.WriteFile(filepath.Join(dir, ShardLabelsFileName), []byte(labels), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	templates, err := LoadShardTemplates(dir)
+	if err != nil {
+		t.Fatalf("LoadShardTemplates: %v", err)
+	}
+	if templates.Labels.ConversationID != "conversation_id" || templates.Labels.Terms != "terms" {
+		t.Fatalf("unset labels should keep their defaults: %+v", templates.Labels)
+	}
+
+	outDir := t.TempDir()
+	index, err := WriteMemoryShards([]ThreadSummary{
+		{ConversationID: "c1", Title: "T1", Summary: "hallo", KeyPoints: []string{"eins"}, Tags: []string{"a"}},
+	}, MemoryPackOptions{OutDir: outDir, MaxBytes: 100 * 1024, IncludeKeyPoints: true, IncludeTags: true, Templates: templates})
+	if err != nil {
+		t.Fatalf("WriteMemoryShards: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(outDir, index[0].ShardFile))
+	if err != nil {
+		t.Fatalf("read shard: %v", err)
+	}
+	for _, want := range []string{"# Erinnerungs-Shard 0001", "## Inhalt", "### Kernpunkte", "**Schlagwörter**: a", "- conversation_id: `c1`"} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("shard missing %q:\n%s", want, b)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, ShardLabelsFileName), []byte(`{"key_point":"x"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadShardTemplates(dir); err == nil {
+		t.Fatalf("expected an error for an unknown label")
+	}
+}
@@ -0,0 +1,400 @@
+package migration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ShareSafeNamesFileName is the default pseudonym mapping file. It holds real names, so it lives next to
+// the private archive and is never written into share-safe output.
+const ShareSafeNamesFileName = "share_safe_names.json"
+
+// QuoteRemoved replaces quoted passages in share-safe output.
+const QuoteRemoved = "[quote removed]"
+
+const pseudonymPrefix = "Name "
+
+// ShareSafeNames maps real names to stable pseudonyms ("Name 1", "Name 2", ...). An entry whose
+// pseudonym equals the name marks a word that looks like a name but should be kept (e.g. "Python").
+type ShareSafeNames struct {
+	Version int               `json:"version"`
+	Names   map[string]string `json:"names"`
+}
+
+// LoadShareSafeNames reads a mapping file; a missing file yields an empty mapping.
+func LoadShareSafeNames(path string) (*ShareSafeNames, error) {
+	n := &ShareSafeNames{Version: 1, Names: map[string]string{}}
+	if path == "" {
+		return n, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return n, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("LoadShareSafeNames: %w", err)
+	}
+	if err := json.Unmarshal(b, n); err != nil {
+		return nil, fmt.Errorf("LoadShareSafeNames: unmarshal %s: %w", path, err)
+	}
+	if n.Names == nil {
+		n.Names = map[string]string{}
+	}
+	return n, nil
+}
+
+// Save writes the mapping atomically.
+func (n *ShareSafeNames) Save(path string) error {
+	b, err := json.MarshalIndent(n, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ShareSafeNames.Save: marshal: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("ShareSafeNames.Save: mkdir: %w", err)
+	}
+	if _, err := writeFileAtomic(path, b, 0o600); err != nil {
+		return fmt.Errorf("ShareSafeNames.Save: %w", err)
+	}
+	return nil
+}
+
+// pseudonym returns name's pseudonym, assigning the next free one for new names.
+func (n *ShareSafeNames) pseudonym(name string) string {
+	for k, v := range n.Names {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	next := 1
+	for _, v := range n.Names {
+		if i, err := strconv.Atoi(strings.TrimPrefix(v, pseudonymPrefix)); err == nil && strings.HasPrefix(v, pseudonymPrefix) && i >= next {
+			next = i + 1
+		}
+	}
+	p := pseudonymPrefix + strconv.Itoa(next)
+	n.Names[name] = p
+	return p
+}
+
+// Anonymizer rewrites thread summaries for sharing: names become stable pseudonyms, dates are coarsened
+// to month precision, and quoted passages are removed. Call LearnThread or LearnSentiment on every
+// summary first so a name is recognized everywhere it appears, not only after its first mid-sentence
+// mention.
+type Anonymizer struct {
+	names  *ShareSafeNames
+	detect bool
+
+	// lowerWords are words seen in lowercase in prose; a capitalized candidate that also appears
+	// lowercase (e.g. "Python"/"python") is an ordinary word, not a name.
+	lowerWords map[string]bool
+	candidates []string
+	matcher    *regexp.Regexp
+}
+
+// NewAnonymizer returns an anonymizer that uses names (updated in place with new pseudonyms) plus
+// knownNames; detect additionally treats capitalized mid-sentence words as names.
+func NewAnonymizer(names *ShareSafeNames, knownNames []string, detect bool) *Anonymizer {
+	if names == nil {
+		names = &ShareSafeNames{Version: 1, Names: map[string]string{}}
+	}
+	a := &Anonymizer{names: names, detect: detect, lowerWords: map[string]bool{}}
+	for _, name := range knownNames {
+		if name = strings.TrimSpace(name); name != "" {
+			names.pseudonym(name)
+		}
+	}
+	return a
+}
+
+// LearnThread collects name candidates from a semantic thread summary.
+func (a *Anonymizer) LearnThread(ts ThreadSummary) {
+	a.learn(ts.Title, ts.Summary, ts.Project)
+	a.learn(ts.KeyPoints...)
+	for _, it := range ts.OpenItems {
+		a.learn(it.Text)
+	}
+}
+
+// LearnSentiment collects name candidates from a sentiment thread summary.
+func (a *Anonymizer) LearnSentiment(ts ThreadSentimentSummary) {
+	a.learn(ts.Title, ts.Project, ts.EmotionalSummary, ts.RelationalShift, ts.EmotionalArc, ts.ResonanceNotes)
+}
+
+func (a *Anonymizer) learn(texts ...string) {
+	a.matcher = nil
+	for _, s := range texts {
+		if !a.detect || s == "" {
+			continue
+		}
+		for _, w := range strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) }) {
+			if first, _ := utf8.DecodeRuneInString(w); unicode.IsLower(first) {
+				a.lowerWords[w] = true
+			}
+		}
+		a.candidates = append(a.candidates, detectNames(s)...)
+	}
+}
+
+// capitalizedRun matches runs of capitalized words ("Alice", "Maria Lopez").
+var capitalizedRun = regexp.MustCompile(`\p{Lu}\p{Ll}+(?:[ \t]+\p{Lu}\p{Ll}+)*`)
+
+// detectNames returns capitalized runs that are not sentence-initial single words and not common words.
+func detectNames(s string) []string {
+	var out []string
+	for _, loc := range capitalizedRun.FindAllStringIndex(s, -1) {
+		start, end := loc[0], loc[1]
+		if r, _ := utf8.DecodeLastRuneInString(s[:start]); start > 0 && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			continue
+		}
+		words := strings.Fields(s[start:end])
+		dropped := 0
+		for len(words) > 0 && isCommonCapitalized(words[0]) {
+			words = words[1:]
+			dropped++
+		}
+		for len(words) > 0 && isCommonCapitalized(words[len(words)-1]) {
+			words = words[:len(words)-1]
+		}
+		if len(words) == 0 {
+			continue
+		}
+		if dropped == 0 && len(words) == 1 && atSentenceStart(s[:start]) {
+			continue
+		}
+		out = append(out, strings.Join(words, " "))
+	}
+	return out
+}
+
+func atSentenceStart(before string) bool {
+	before = strings.TrimRight(before, " \t")
+	if before == "" {
+		return true
+	}
+	r, _ := utf8.DecodeLastRuneInString(before)
+	return strings.ContainsRune(".!?:;\n\"“(*-#>", r)
+}
+
+func isCommonCapitalized(w string) bool {
+	_, ok := commonCapitalized[strings.ToLower(w)]
+	return ok
+}
+
+// commonCapitalized are words that are routinely capitalized without being names.
+var commonCapitalized = func() map[string]struct{} {
+	words := strings.Fields(`
+		a an the this that these those there here then than so but and or nor yet for of in on at to by with from
+		i me my we our us you your he him his she her they them their it its who whom whose what which when where why how
+		is are was were be been being do does did have has had will would can could should may might must shall
+		if as also after before during while since until because although though however therefore thus
+		user assistant chatgpt ai model thread conversation chat summary key points note notes
+		yes no ok okay not all any some each every both either neither none one two three first second next last
+		new old other another many much more most few less least own same such very just only even still again
+		monday tuesday wednesday thursday friday saturday sunday
+		january february march april may june july august september october november december
+		mr mrs ms dr prof st
+		english spanish french german american british european
+		today tomorrow yesterday tonight morning evening`)
+	m := make(map[string]struct{}, len(words))
+	for _, w := range words {
+		m[w] = struct{}{}
+	}
+	return m
+}()
+
+// finalize assigns pseudonyms to learned candidates and compiles the name matcher.
+func (a *Anonymizer) finalize() {
+	if a.matcher != nil {
+		return
+	}
+	for _, c := range a.candidates {
+		if !strings.Contains(c, " ") && a.lowerWords[strings.ToLower(c)] {
+			continue
+		}
+		a.names.pseudonym(c)
+	}
+	a.candidates = nil
+
+	var alts []string
+	for name, p := range a.names.Names {
+		if name == p || strings.TrimSpace(name) == "" {
+			continue
+		}
+		alts = append(alts, regexp.QuoteMeta(name))
+	}
+	// Longest first so "Maria Lopez" wins over "Maria".
+	sort.Slice(alts, func(i, j int) bool {
+		if len(alts[i]) != len(alts[j]) {
+			return len(alts[i]) > len(alts[j])
+		}
+		return alts[i] < alts[j]
+	})
+	if len(alts) == 0 {
+		a.matcher = regexp.MustCompile(`$^`)
+		return
+	}
+	a.matcher = regexp.MustCompile(`(?i)(?:` + strings.Join(alts, "|") + `)`)
+}
+
+// Text anonymizes one string.
+func (a *Anonymizer) Text(s string) string {
+	if s == "" {
+		return s
+	}
+	s = removeQuotes(s)
+	s = CoarsenDates(s)
+	return a.replaceNames(s)
+}
+
+func (a *Anonymizer) replaceNames(s string) string {
+	a.finalize()
+	var b strings.Builder
+	last := 0
+	for _, loc := range a.matcher.FindAllStringIndex(s, -1) {
+		start, end := loc[0], loc[1]
+		if r, _ := utf8.DecodeLastRuneInString(s[:start]); start > 0 && isWordRune(r) {
+			continue
+		}
+		if r, _ := utf8.DecodeRuneInString(s[end:]); end < len(s) && isWordRune(r) {
+			continue
+		}
+		p := a.names.pseudonym(s[start:end])
+		if s[start:end] == strings.ToLower(s[start:end]) {
+			p = strings.ToLower(p)
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(p)
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func (a *Anonymizer) texts(in []string) []string {
+	if len(in) == 0 {
+		return in
+	}
+	out := make([]string, 0, len(in))
+	for _, s := range in {
+		if s = strings.TrimSpace(a.Text(s)); s != "" && s != QuoteRemoved {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Thread returns an anonymized copy of ts. The export title, review metadata and the unverified
+// tags and terms (raw model output kept only for review) are dropped.
+func (a *Anonymizer) Thread(ts ThreadSummary) ThreadSummary {
+	ts.Title = a.Text(ts.Title)
+	ts.OriginalTitle = ""
+	ts.Project = a.Text(ts.Project)
+	ts.ThreadStart = CoarsenTimestamp(ts.ThreadStart)
+	ts.ThreadUpdate = CoarsenTimestamp(ts.ThreadUpdate)
+	ts.Summary = a.Text(ts.Summary)
+	ts.MicroSummary = a.Text(ts.MicroSummary)
+	ts.KeyPoints = a.texts(ts.KeyPoints)
+	ts.Tags = a.texts(ts.Tags)
+	ts.Terms = a.texts(ts.Terms)
+	ts.UnverifiedTags = nil
+	ts.UnverifiedTerms = nil
+	if len(ts.OpenItems) > 0 {
+		items := make([]OpenItem, len(ts.OpenItems))
+		for i, it := range ts.OpenItems {
+			items[i] = OpenItem{Kind: it.Kind, Text: a.Text(it.Text)}
+		}
+		ts.OpenItems = items
+	}
+	ts.EditedByHuman = false
+	ts.ReviewedAt = ""
+	return ts
+}
+
+// Sentiment returns an anonymized copy of ts.
+func (a *Anonymizer) Sentiment(ts ThreadSentimentSummary) ThreadSentimentSummary {
+	ts.Title = a.Text(ts.Title)
+	ts.OriginalTitle = ""
+	ts.Project = a.Text(ts.Project)
+	ts.ThreadStart = CoarsenTimestamp(ts.ThreadStart)
+	ts.ThreadUpdate = CoarsenTimestamp(ts.ThreadUpdate)
+	ts.EmotionalSummary = a.Text(ts.EmotionalSummary)
+	ts.DominantEmotions = a.texts(ts.DominantEmotions)
+	ts.RememberedEmotions = a.texts(ts.RememberedEmotions)
+	ts.PresentEmotions = a.texts(ts.PresentEmotions)
+	ts.EmotionalTensions = a.texts(ts.EmotionalTensions)
+	ts.RelationalShift = a.Text(ts.RelationalShift)
+	ts.EmotionalArc = a.Text(ts.EmotionalArc)
+	ts.Themes = a.texts(ts.Themes)
+	ts.SymbolsOrMetaphors = a.texts(ts.SymbolsOrMetaphors)
+	ts.ResonanceNotes = a.Text(ts.ResonanceNotes)
+	ts.ToneMarkers = a.texts(ts.ToneMarkers)
+	ts.EditedByHuman = false
+	ts.ReviewedAt = ""
+	return ts
+}
+
+// CoarsenTimestamp truncates a unix timestamp to the first instant of its UTC month.
+func CoarsenTimestamp(ts *float64) *float64 {
+	if ts == nil || *ts <= 0 {
+		return ts
+	}
+	t := time.Unix(int64(*ts), 0).UTC()
+	v := float64(time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC).Unix())
+	return &v
+}
+
+const monthNames = `January|February|March|April|May|June|July|August|September|October|November|December|Jan|Feb|Mar|Apr|Jun|Jul|Aug|Sep|Sept|Oct|Nov|Dec`
+
+var (
+	isoDate       = regexp.MustCompile(`\b(\d{4})-(\d{2})-\d{2}(?:[T ]\d{2}:\d{2}(?::\d{2}(?:\.\d+)?)?(?:Z|[+-]\d{2}:?\d{2})?)?\b`)
+	monthDayYear  = regexp.MustCompile(`\b(` + monthNames + `)\.? \d{1,2}(?:st|nd|rd|th)?(?:,?( \d{4}))?\b`)
+	dayMonthYear  = regexp.MustCompile(`\b\d{1,2}(?:st|nd|rd|th)? (?:of )?(` + monthNames + `)\b`)
+	slashDate     = regexp.MustCompile(`\b\d{1,2}/\d{1,2}/(\d{4}|\d{2})\b`)
+	clockTime     = regexp.MustCompile(`(?i)\b(?:at )?\d{1,2}:\d{2}(?::\d{2})?(?: ?[ap]\.?m\.?)?\b`)
+	curlyQuote    = regexp.MustCompile(`“[^”]*”`)
+	straightQuote = regexp.MustCompile(`"[^"\n]*"`)
+	blockQuote    = regexp.MustCompile(`(?m)^[ \t]*>.*$`)
+
+	spaceRun         = regexp.MustCompile(`[ \t]{2,}`)
+	spaceBeforePunct = regexp.MustCompile(`[ \t]+([.,;:!?])`)
+)
+
+// CoarsenDates rewrites dates in s to month precision and drops clock times.
+func CoarsenDates(s string) string {
+	s = isoDate.ReplaceAllString(s, "$1-$2")
+	s = monthDayYear.ReplaceAllString(s, "$1$2")
+	s = dayMonthYear.ReplaceAllString(s, "$1")
+	s = slashDate.ReplaceAllString(s, "$1")
+	s = clockTime.ReplaceAllString(s, "")
+	s = spaceBeforePunct.ReplaceAllString(s, "$1")
+	return spaceRun.ReplaceAllString(s, " ")
+}
+
+// removeQuotes replaces quoted passages of three or more words, and markdown blockquotes, with
+// QuoteRemoved. Short quoted labels ("New chat") are kept.
+func removeQuotes(s string) string {
+	replace := func(m string) string {
+		if len(strings.Fields(m)) < 3 {
+			return m
+		}
+		return QuoteRemoved
+	}
+	s = blockQuote.ReplaceAllString(s, QuoteRemoved)
+	s = curlyQuote.ReplaceAllStringFunc(s, replace)
+	return straightQuote.ReplaceAllStringFunc(s, replace)
+}
@@ -0,0 +1,136 @@
+package migration
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCoarsenDates(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"Signed on 2024-03-15T10:22:00Z.":      "Signed on 2024-03.",
+		"Met on March 15th, 2024 at 3:30 pm.":  "Met on March 2024.",
+		"Due 15 March and again on 4/2/2023.":  "Due March and again on 2023.",
+		"Trip in May 2022 was fine.":           "Trip in May 2022 was fine.",
+		"Line one.\n\nLine two on 2021-01-09.": "Line one.\n\nLine two on 2021-01.",
+	}
+	for in, want := range cases {
+		if got := CoarsenDates(in); got != want {
+			t.Fatalf("CoarsenDates(%q)=%q want %q", in, got, want)
+		}
+	}
+
+	// 2024-03-15 -> 2024-03-01.
+	ts := 1710499200.0
+	if got := *CoarsenTimestamp(&ts); got != 1709251200 {
+		t.Fatalf("CoarsenTimestamp=%v", got)
+	}
+}
+
+func TestAnonymizer_StablePseudonymsAcrossThreadsAndRuns(t *testing.T) {
+	t.Parallel()
+
+	threads := []ThreadSummary{
+		{ConversationID: "c1", Title: "Planning with Maria Lopez", Summary: "Maria wrote \"we should move before the winter starts\" and the user agreed. Used python scripts.",
+			Tags: []string{"maria", "relocation"}, OriginalTitle: "Maria chat", ReviewedAt: "2024-01-01T00:00:00Z"},
+		{ConversationID: "c2", Summary: "The user told Jonas about Maria. Python was mentioned.", KeyPoints: []string{"> I never said that", "Jonas agreed"},
+			OpenItems: []OpenItem{{Kind: OpenItemTodo, Text: "Check the lease with Jonas"}}},
+	}
+
+	names := &ShareSafeNames{Version: 1, Names: map[string]string{}}
+	anon := NewAnonymizer(names, []string{"Maria"}, true)
+	for _, ts := range threads {
+		anon.LearnThread(ts)
+	}
+	a := anon.Thread(threads[0])
+	b := anon.Thread(threads[1])
+
+	if names.Names["Maria"] != "Name 1" {
+		t.Fatalf("names=%v", names.Names)
+	}
+	if a.Title != "Planning with "+names.Names["Maria Lopez"] || a.OriginalTitle != "" || a.ReviewedAt != "" {
+		t.Fatalf("thread a=%+v", a)
+	}
+	if strings.Contains(a.Summary, "winter") || !strings.Contains(a.Summary, QuoteRemoved) || !strings.Contains(a.Summary, "Name 1 wrote") {
+		t.Fatalf("summary a=%q", a.Summary)
+	}
+	if a.Tags[0] != "name 1" {
+		t.Fatalf("tags=%v", a.Tags)
+	}
+	// "Jonas" appears only mid-sentence in c2 but is learned before anything is rewritten.
+	jonas := names.Names["Jonas"]
+	if jonas == "" || !strings.Contains(b.Summary, "told "+jonas+" about Name 1") {
+		t.Fatalf("summary b=%q names=%v", b.Summary, names.Names)
+	}
+	if len(b.KeyPoints) != 1 || b.KeyPoints[0] != jonas+" agreed" {
+		t.Fatalf("key points=%v", b.KeyPoints)
+	}
+	if len(b.OpenItems) != 1 || b.OpenItems[0].Text != "Check the lease with "+jonas || threads[1].OpenItems[0].Text != "Check the lease with Jonas" {
+		t.Fatalf("open items=%v", b.OpenItems)
+	}
+	// "Python" also appears lowercase, so it is treated as an ordinary word.
+	if _, ok := names.Names["Python"]; ok || !strings.Contains(b.Summary, "Python was mentioned") {
+		t.Fatalf("Python was pseudonymized: %q", b.Summary)
+	}
+
+	path := filepath.Join(t.TempDir(), ShareSafeNamesFileName)
+	if err := names.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, err := LoadShareSafeNames(path)
+	if err != nil {
+		t.Fatalf("LoadShareSafeNames: %v", err)
+	}
+	// Keeping a word: map it to itself.
+	loaded.Names["Jonas"] = "Jonas"
+	again := NewAnonymizer(loaded, nil, false).Thread(ThreadSummary{Summary: "Maria and Jonas met."})
+	if again.Summary != "Name 1 and Jonas met." {
+		t.Fatalf("reloaded summary=%q", again.Summary)
+	}
+}
+
+func TestAnonymizer_CoarsensThreadTimes(t *testing.T) {
+	t.Parallel()
+
+	// 2024-06-02 13:02:13 UTC -> 2024-06-01.
+	start, update := 1717333333.0, 1717333333.0
+	const month = 1717200000.0
+	anon := NewAnonymizer(&ShareSafeNames{Version: 1, Names: map[string]string{}}, nil, false)
+
+	ts := anon.Thread(ThreadSummary{ThreadStart: &start, ThreadUpdate: &update})
+	if *ts.ThreadStart != month || *ts.ThreadUpdate != month {
+		t.Fatalf("thread start=%v update=%v, want %v", *ts.ThreadStart, *ts.ThreadUpdate, month)
+	}
+	ss := anon.Sentiment(ThreadSentimentSummary{ThreadStart: &start, ThreadUpdate: &update})
+	if *ss.ThreadStart != month || *ss.ThreadUpdate != month {
+		t.Fatalf("sentiment start=%v update=%v, want %v", *ss.ThreadStart, *ss.ThreadUpdate, month)
+	}
+	if update != 1717333333 {
+		t.Fatalf("input timestamp was modified: %v", update)
+	}
+}
+
+func TestAnonymizer_DropsUnverifiedTagsAndTerms(t *testing.T) {
+	t.Parallel()
+
+	names := &ShareSafeNames{Version: 1, Names: map[string]string{}}
+	anon := NewAnonymizer(names, []string{"Maria"}, true)
+	ts := anon.Thread(ThreadSummary{
+		Tags:            []string{"maria"},
+		UnverifiedTags:  []string{"Maria's birthday"},
+		UnverifiedTerms: []string{"Maria Lopez"},
+	})
+	if ts.UnverifiedTags != nil || ts.UnverifiedTerms != nil {
+		t.Fatalf("unverified tags=%q terms=%q, want none", ts.UnverifiedTags, ts.UnverifiedTerms)
+	}
+	b, err := json.Marshal(ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "Maria") || strings.Contains(string(b), "unverified") {
+		t.Fatalf("share-safe thread leaks unverified entries: %s", b)
+	}
+}
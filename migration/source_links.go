@@ -0,0 +1,97 @@
+package migration
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SourceLink points from a packed thread back to one of its chunks: the chunk file and its summary,
+// as slash-separated paths relative to the root given to ReadSourceLinks.
+type SourceLink struct {
+	ChunkNumber int    `json:"chunk_number"`
+	ChunkPath   string `json:"chunk_path"`
+	SummaryPath string `json:"summary_path,omitempty"`
+}
+
+// ReadSourceLinks reads chunk-summarizer's index.json (or sentiment_index.json, whose rows carry
+// sentiment_summary_path instead) into each thread's chunks, ordered by chunk number. Paths are
+// made relative to root, so links resolve from wherever root is. A chunk listed more than once keeps
+// its last row, as append-mode indices are read.
+func ReadSourceLinks(indexPath, root string) (map[string][]SourceLink, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("read source links: %w", err)
+	}
+	rel := func(p string) string {
+		if p == "" {
+			return ""
+		}
+		if a, err := filepath.Abs(p); err == nil {
+			if r, err := filepath.Rel(absRoot, a); err == nil {
+				return filepath.ToSlash(r)
+			}
+		}
+		return filepath.ToSlash(p)
+	}
+
+	byChunk := make(map[string]map[int]SourceLink)
+	if err := readIndexRows(indexPath, func(line []byte) error {
+		var r struct {
+			ConversationID       string `json:"conversation_id"`
+			ChunkNumber          int    `json:"chunk_number"`
+			ChunkPath            string `json:"chunk_path"`
+			SummaryPath          string `json:"summary_path"`
+			SentimentSummaryPath string `json:"sentiment_summary_path"`
+		}
+		if err := json.Unmarshal(line, &r); err != nil {
+			return err
+		}
+		if r.ConversationID == "" || r.ChunkPath == "" {
+			return nil
+		}
+		if r.SummaryPath == "" {
+			r.SummaryPath = r.SentimentSummaryPath
+		}
+		if byChunk[r.ConversationID] == nil {
+			byChunk[r.ConversationID] = make(map[int]SourceLink)
+		}
+		byChunk[r.ConversationID][r.ChunkNumber] = SourceLink{ChunkNumber: r.ChunkNumber, ChunkPath: rel(r.ChunkPath), SummaryPath: rel(r.SummaryPath)}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("read source links %s: %w", indexPath, err)
+	}
+
+	out := make(map[string][]SourceLink, len(byChunk))
+	for id, chunks := range byChunk {
+		links := make([]SourceLink, 0, len(chunks))
+		for _, l := range chunks {
+			links = append(links, l)
+		}
+		sort.Slice(links, func(i, j int) bool { return links[i].ChunkNumber < links[j].ChunkNumber })
+		out[id] = links
+	}
+	return out, nil
+}
+
+// withSourceLinks appends a "Sources" list of links to section, before its closing separator.
+func withSourceLinks(section string, links []SourceLink, labels ShardLabels) string {
+	if len(links) == 0 {
+		return section
+	}
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(strings.TrimSuffix(section, sectionSeparator), "\n"))
+	fmt.Fprintf(&b, "\n\n### %s\n", labels.Sources)
+	for _, l := range links {
+		fmt.Fprintf(&b, "- %s %d: [%s](<%s>)", labels.Chunk, l.ChunkNumber, labels.Chunk, l.ChunkPath)
+		if l.SummaryPath != "" {
+			fmt.Fprintf(&b, " · [%s](<%s>)", labels.Summary, l.SummaryPath)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(sectionSeparator)
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReadSourceLinks_LinksChunksFromShards(t *testing.T) {
+	t.Parallel()
+
+	threads := t.TempDir()
+	indexPath := filepath.Join(threads, "summaries", "index.json")
+	if err := os.MkdirAll(filepath.Dir(indexPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	chunk := func(n string) string { return filepath.Join(threads, "chunks", "c1", "c1_"+n+".json") }
+	summary := func(n string) string { return filepath.Join(threads, "summaries", "c1", "c1_"+n+".summary.json") }
+	rows := strings.Join([]string{
+		`{"conversation_id":"c1","chunk_number":2,"chunk_path":` + strconv.Quote(chunk("0002")) + `,"summary_path":"stale"}`,
+		`{"conversation_id":"c1","chunk_number":1,"chunk_path":` + strconv.Quote(chunk("0001")) + `,"summary_path":` + strconv.Quote(summary("0001")) + `}`,
+		`{"conversation_id":"c1","chunk_number":2,"chunk_path":` + strconv.Quote(chunk("0002")) + `,"summary_path":` + strconv.Quote(summary("0002")) + `}`,
+	}, "\n") + "\n"
+	if err := os.WriteFile(indexPath, []byte(rows), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	outDir := filepath.Join(threads, "memory_shards")
+	sources, err := ReadSourceLinks(indexPath, outDir)
+	if err != nil {
+		t.Fatalf("ReadSourceLinks: %v", err)
+	}
+	links := sources["c1"]
+	if len(links) != 2 || links[0].ChunkNumber != 1 || links[1].SummaryPath != "../summaries/c1/c1_0002.summary.json" {
+		t.Fatalf("links=%+v", links)
+	}
+
+	index, err := WriteMemoryShards([]ThreadSummary{{ConversationID: "c1", Title: "T1", Summary: "hello"}}, MemoryPackOptions{OutDir: outDir, Sources: sources})
+	if err != nil {
+		t.Fatalf("WriteMemoryShards: %v", err)
+	}
+	if len(index[0].Sources) != 2 {
+		t.Fatalf("index sources=%+v", index[0].Sources)
+	}
+	b, err := os.ReadFile(filepath.Join(outDir, index[0].ShardFile))
+	if err != nil {
+		t.Fatalf("read shard: %v", err)
+	}
+	want := "hello\n\n### Sources\n- chunk 1: [chunk](<../chunks/c1/c1_0001.json>) · [summary](<../summaries/c1/c1_0001.summary.json>)\n"
+	if !strings.Contains(string(b), want) {
+		t.Fatalf("shard missing sources:\n%s", b)
+	}
+}
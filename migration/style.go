@@ -0,0 +1,155 @@
+package migration
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Style profile values.
+const (
+	BulletsSparse = "sparse"
+	BulletsDense  = "dense"
+
+	FormalityCasual  = "casual"
+	FormalityNeutral = "neutral"
+	FormalityFormal  = "formal"
+
+	PersonFirst = "first"
+	PersonThird = "third"
+)
+
+// StyleProfile is the voice summaries and rollups are written in, read from a small JSON file
+// (-style) so a regenerated archive can match an earlier one. Empty fields leave the prompt's own
+// guidance in place. Artifacts written with a profile record it.
+type StyleProfile struct {
+	// Name labels the profile in artifacts, e.g. "journal".
+	Name string `json:"name,omitempty"`
+	// Bullets is BulletsSparse (lists at the low end of each range) or BulletsDense (the high end).
+	Bullets string `json:"bullets,omitempty"`
+	// MaxParagraphs caps the paragraphs of the prose summary fields.
+	MaxParagraphs int `json:"max_paragraphs,omitempty"`
+	// Formality is FormalityCasual, FormalityNeutral, or FormalityFormal.
+	Formality string `json:"formality,omitempty"`
+	// Person is PersonFirst (the user is "I") or PersonThird (the user is "the user").
+	Person string `json:"person,omitempty"`
+	// Notes is free-form guidance appended as written, e.g. "Use British spelling."
+	Notes string `json:"notes,omitempty"`
+	// Language is the language prose and list fields are written in, e.g. "German" (-output-language).
+	Language string `json:"language,omitempty"`
+}
+
+// LoadStyleProfile reads a style profile; an empty path yields nil, which leaves prompts unchanged.
+// Unknown fields are an error so a misspelled setting is not silently ignored.
+func LoadStyleProfile(path string) (*StyleProfile, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("LoadStyleProfile: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var p StyleProfile
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("LoadStyleProfile: unmarshal %s: %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("LoadStyleProfile: %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// WithLanguage returns the profile with Language set, starting from an empty profile when p is nil.
+// An empty language returns p as is.
+func (p *StyleProfile) WithLanguage(language string) *StyleProfile {
+	language = strings.TrimSpace(language)
+	if language == "" {
+		return p
+	}
+	var out StyleProfile
+	if p != nil {
+		out = *p
+	}
+	out.Language = language
+	return &out
+}
+
+// Validate rejects unknown setting values.
+func (p StyleProfile) Validate() error {
+	if p.Bullets != "" && p.Bullets != BulletsSparse && p.Bullets != BulletsDense {
+		return fmt.Errorf("bullets must be %s or %s", BulletsSparse, BulletsDense)
+	}
+	if p.MaxParagraphs < 0 {
+		return errors.New("max_paragraphs must be >= 0")
+	}
+	switch p.Formality {
+	case "", FormalityCasual, FormalityNeutral, FormalityFormal:
+	default:
+		return fmt.Errorf("formality must be %s, %s, or %s", FormalityCasual, FormalityNeutral, FormalityFormal)
+	}
+	if p.Person != "" && p.Person != PersonFirst && p.Person != PersonThird {
+		return fmt.Errorf("person must be %s or %s", PersonFirst, PersonThird)
+	}
+	return nil
+}
+
+// Instructions appends the profile's OUTPUT STYLE section to a prompt. A nil or empty profile
+// returns the prompt unchanged.
+func (p *StyleProfile) Instructions(prompt string) string {
+	if p == nil {
+		return prompt
+	}
+	var lines []string
+	switch p.Bullets {
+	case BulletsSparse:
+		lines = append(lines, "- Lists (key points, tags, themes, emotions): stay at the low end of each allowed range; keep only the strongest items.")
+	case BulletsDense:
+		lines = append(lines, "- Lists (key points, tags, themes, emotions): use the high end of each allowed range when the content supports it.")
+	}
+	if p.MaxParagraphs > 0 {
+		lines = append(lines, fmt.Sprintf("- Prose summary fields: at most %d paragraph(s).", p.MaxParagraphs))
+	}
+	switch p.Formality {
+	case FormalityCasual:
+		lines = append(lines, "- Register: casual and plain-spoken, as in a personal journal; contractions are fine.")
+	case FormalityNeutral:
+		lines = append(lines, "- Register: neutral and matter-of-fact.")
+	case FormalityFormal:
+		lines = append(lines, "- Register: formal, complete sentences, no contractions or slang.")
+	}
+	switch p.Person {
+	case PersonFirst:
+		lines = append(lines, `- Person: write from the user's point of view. Refer to the user as "I"/"me"/"my" and to the assistant by role or name (e.g. "I asked the assistant ...").`)
+	case PersonThird:
+		lines = append(lines, `- Person: refer to the user as "the user", never "I" or "you".`)
+	}
+	if notes := strings.TrimSpace(p.Notes); notes != "" {
+		lines = append(lines, "- "+notes)
+	}
+	if lang := strings.TrimSpace(p.Language); lang != "" {
+		lines = append(lines, "- "+languageRule(lang))
+	}
+	if len(lines) == 0 {
+		return prompt
+	}
+	return prompt + "\n\nOUTPUT STYLE (applies to the prose and list fields; the schema and all rules above still hold):\n" + strings.Join(lines, "\n")
+}
+
+// LanguageInstructions appends an OUTPUT LANGUAGE section to a prompt, for stages that take
+// -output-language without a style profile. An empty language returns the prompt unchanged.
+func LanguageInstructions(prompt, language string) string {
+	language = strings.TrimSpace(language)
+	if language == "" {
+		return prompt
+	}
+	return prompt + "\n\nOUTPUT LANGUAGE (the schema and all rules above still hold):\n- " + languageRule(language)
+}
+
+func languageRule(language string) string {
+	return fmt.Sprintf("Language: write every prose and list field in %s, whatever language the conversation is in. Keep names, quoted text, JSON keys, and fixed enum values as they are.", language)
+}
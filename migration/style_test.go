@@ -0,0 +1,76 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadStyleProfile_InstructionsAndValidation(t *testing.T) {
+	t.Parallel()
+
+	if p, err := LoadStyleProfile(""); p != nil || err != nil {
+		t.Fatalf("empty path: p=%v err=%v", p, err)
+	}
+	var none *StyleProfile
+	if got := none.Instructions("PROMPT"); got != "PROMPT" {
+		t.Fatalf("nil profile changed the prompt: %q", got)
+	}
+
+	dir := t.TempDir()
+	write := func(name, body string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	p, err := LoadStyleProfile(write("journal.json", `{"name":"journal","bullets":"sparse","max_paragraphs":2,"formality":"casual","person":"first","notes":"Use British spelling."}`))
+	if err != nil {
+		t.Fatalf("LoadStyleProfile: %v", err)
+	}
+	got := p.Instructions("PROMPT")
+	for _, want := range []string{"PROMPT\n\nOUTPUT STYLE", "low end", "at most 2 paragraph(s)", "casual", `"I"`, "British spelling"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("instructions missing %q:\n%s", want, got)
+		}
+	}
+	if (&StyleProfile{Name: "plain"}).Instructions("PROMPT") != "PROMPT" {
+		t.Fatal("a profile with no settings changed the prompt")
+	}
+
+	for name, body := range map[string]string{
+		"typo.json":   `{"formalty":"formal"}`,
+		"person.json": `{"person":"second"}`,
+		"paras.json":  `{"max_paragraphs":-1}`,
+	} {
+		if _, err := LoadStyleProfile(write(name, body)); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+func TestStyleProfile_WithLanguage(t *testing.T) {
+	t.Parallel()
+
+	var none *StyleProfile
+	if none.WithLanguage("") != nil {
+		t.Fatalf("empty language should keep a nil profile")
+	}
+	base := &StyleProfile{Name: "journal", Language: "French"}
+	p := base.WithLanguage("German")
+	if p.Name != "journal" || p.Language != "German" || base.Language != "French" {
+		t.Fatalf("WithLanguage: p=%+v base=%+v", p, base)
+	}
+	if got := none.WithLanguage("German").Instructions("PROMPT"); !strings.Contains(got, "OUTPUT STYLE") || !strings.Contains(got, "in German, whatever language") {
+		t.Fatalf("instructions:\n%s", got)
+	}
+	if got := LanguageInstructions("PROMPT", "German"); !strings.HasPrefix(got, "PROMPT\n\nOUTPUT LANGUAGE") || !strings.Contains(got, "in German") {
+		t.Fatalf("LanguageInstructions:\n%s", got)
+	}
+	if LanguageInstructions("PROMPT", " ") != "PROMPT" {
+		t.Fatalf("empty language changed the prompt")
+	}
+}
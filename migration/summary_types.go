@@ -5,6 +5,10 @@ type Glossary struct {
 	Version int             `json:"version"`
 	Entries []GlossaryEntry `json:"entries"`
 	Meta    map[string]any  `json:"meta,omitempty"`
+
+	// base holds each term's count as of the last LoadGlossary/SaveGlossary, so SaveGlossary can apply
+	// just this process's increments on top of whatever other runs saved meanwhile.
+	base map[string]int
 }
 
 // GlossaryEntry is one term in the glossary.
@@ -20,9 +24,13 @@ type GlossaryEntry struct {
 type ChunkSummary struct {
 	ConversationID string   `json:"conversation_id"`
 	ThreadStart    *float64 `json:"thread_start_time,omitempty"`
+	ThreadUpdate   *float64 `json:"thread_update_time,omitempty"`
 	ChunkNumber    int      `json:"chunk_number"`
 	TurnStart      int      `json:"turn_start"`
 	TurnEnd        int      `json:"turn_end"`
+	Project        string   `json:"project,omitempty"`
+	SourceType     string   `json:"source_type,omitempty"`
+	OriginalTitle  string   `json:"original_title,omitempty"`
 
 	// Summary is a tight prose summary (1-3 short paragraphs).
 	Summary string `json:"summary"`
@@ -35,38 +43,118 @@ type ChunkSummary struct {
 
 	// Terms are glossary terms referenced/added by this chunk (for index joins).
 	Terms []string `json:"terms,omitempty"`
+
+	// SourceTokens estimates the tokens of the chunk transcript this summary compresses (0 for
+	// summaries written before it was recorded).
+	SourceTokens int `json:"source_tokens,omitempty"`
+
+	// Tiny is carried from Chunk.Tiny: thread-rollup copies the summary into the rollup.
+	Tiny bool `json:"tiny,omitempty"`
+
+	// Model is the model that produced this artifact (empty for artifacts written before it was recorded).
+	Model string `json:"model,omitempty"`
+
+	// Style is the -style profile the artifact was written with (nil without one).
+	Style *StyleProfile `json:"style,omitempty"`
+
+	// EditedByHuman marks artifacts a person edited or approved in review-ui; stages never overwrite them.
+	EditedByHuman bool   `json:"edited_by_human,omitempty"`
+	ReviewedAt    string `json:"reviewed_at,omitempty"`
 }
 
 // ThreadSummary is the model-produced summary artifact for an entire thread, aggregated from chunk summaries.
 type ThreadSummary struct {
 	ConversationID string   `json:"conversation_id"`
 	Title          string   `json:"title,omitempty"`
+	OriginalTitle  string   `json:"original_title,omitempty"`
+	Project        string   `json:"project,omitempty"`
+	SourceType     string   `json:"source_type,omitempty"`
 	ThreadStart    *float64 `json:"thread_start_time,omitempty"`
 
+	// ThreadUpdate is the export's update_time for the thread, kept alongside OriginalTitle so the
+	// original metadata survives into rollups.
+	ThreadUpdate *float64 `json:"thread_update_time,omitempty"`
+
 	// Summary is a tight prose summary (2-6 short paragraphs) describing the whole thread.
 	Summary string `json:"summary"`
 
+	// MicroSummary is a one- or two-sentence summary of at most MicroSummaryMaxChars, written in the same
+	// call as Summary. Index rows and shard tables of contents use it instead of cutting Summary short.
+	MicroSummary string `json:"micro_summary,omitempty"`
+
 	// KeyPoints are retrievable facts/decisions/claims spanning the thread.
 	KeyPoints []string `json:"key_points,omitempty"`
 
+	// KeyPointSources parallels KeyPoints: entry i lists the chunk numbers whose chunk summaries
+	// support KeyPoints[i]. Nil for saga rollups and rollups written before it was recorded.
+	KeyPointSources [][]int `json:"key_point_sources,omitempty"`
+
 	// Tags are high-level topics/entities for indexing/filtering.
 	Tags []string `json:"tags,omitempty"`
 
 	// Terms are glossary terms referenced/added by this thread.
 	Terms []string `json:"terms,omitempty"`
+
+	// UnverifiedTags and UnverifiedTerms are the tags and terms the model returned that the source
+	// chunk summaries never mention (see VerifyTerms). Under -verify-terms drop they were removed from
+	// Tags and Terms; under flag they are still there.
+	UnverifiedTags  []string `json:"unverified_tags,omitempty"`
+	UnverifiedTerms []string `json:"unverified_terms,omitempty"`
+
+	// OpenItems are questions left unanswered and plans deferred ("we should do X later") in the thread.
+	OpenItems []OpenItem `json:"open_items,omitempty"`
+
+	// SourceTokens is the total SourceTokens of the chunk summaries rolled up here, or 0 when any of
+	// them predates the field.
+	SourceTokens int `json:"source_tokens,omitempty"`
+
+	// Model is the model that produced this artifact (empty for artifacts written before it was recorded).
+	Model string `json:"model,omitempty"`
+
+	// Style is the -style profile the artifact was written with (nil without one).
+	Style *StyleProfile `json:"style,omitempty"`
+
+	// PromptVersion identifies the instructions the rollup was written with (see PromptVersion); empty
+	// for passthrough rollups and rollups written before it was recorded.
+	PromptVersion string `json:"prompt_version,omitempty"`
+
+	// Passthrough marks rollups copied from a single-chunk thread's chunk summary without a model call;
+	// Model is then the chunk summary's model.
+	Passthrough bool `json:"passthrough,omitempty"`
+
+	// EditedByHuman marks artifacts a person edited or approved in review-ui; stages never overwrite them.
+	EditedByHuman bool   `json:"edited_by_human,omitempty"`
+	ReviewedAt    string `json:"reviewed_at,omitempty"`
+}
+
+// OpenItem is one unresolved question or deferred plan noted in a thread rollup.
+type OpenItem struct {
+	// Kind is OpenItemQuestion or OpenItemTodo.
+	Kind string `json:"kind"`
+	Text string `json:"text"`
 }
 
 // ThreadIndexRecord is a row in thread_index. mapping a thread to its rollup file.
 type ThreadIndexRecord struct {
 	ConversationID string   `json:"conversation_id"`
 	ThreadStart    *float64 `json:"thread_start_time,omitempty"`
+	ThreadUpdate   *float64 `json:"thread_update_time,omitempty"`
 	Title          string   `json:"title,omitempty"`
+	OriginalTitle  string   `json:"original_title,omitempty"`
+	Project        string   `json:"project,omitempty"`
+	SourceType     string   `json:"source_type,omitempty"`
 
 	ThreadSummaryPath string `json:"thread_summary_path"`
 
 	Summary string   `json:"summary"`
 	Tags    []string `json:"tags,omitempty"`
 	Terms   []string `json:"terms,omitempty"`
+
+	// SourceTokens and SummaryTokens estimate the thread transcript and rollup sizes;
+	// CompressionRatio is their quotient (omitted when the source size is unknown).
+	SourceTokens     int     `json:"source_tokens,omitempty"`
+	SummaryTokens    int     `json:"summary_tokens,omitempty"`
+	CompressionRatio float64 `json:"compression_ratio,omitempty"`
 }
 
 // IndexRecord is a single row in index..
@@ -76,6 +164,7 @@ type IndexRecord struct {
 	ChunkNumber    int      `json:"chunk_number"`
 	TurnStart      int      `json:"turn_start"`
 	TurnEnd        int      `json:"turn_end"`
+	SourceType     string   `json:"source_type,omitempty"`
 
 	ChunkPath   string `json:"chunk_path"`
 	SummaryPath string `json:"summary_path"`
@@ -86,3 +175,24 @@ type IndexRecord struct {
 	Tags  []string `json:"tags,omitempty"`
 	Terms []string `json:"terms,omitempty"`
 }
+
+// KeyPointsFileName is the per-key-point index chunk-summarizer writes next to index.json.
+const KeyPointsFileName = "key_points.jsonl"
+
+// KeyPointRecord is a row in key_points.jsonl: one chunk key point, so individual facts can be embedded
+// and retrieved without their surrounding summary.
+type KeyPointRecord struct {
+	// ID is "<conversation_id>:<chunk_number>:<n>", n being the key point's position in the chunk summary.
+	ID             string   `json:"id"`
+	ConversationID string   `json:"conversation_id"`
+	ThreadStart    *float64 `json:"thread_start_time,omitempty"`
+	ChunkNumber    int      `json:"chunk_number"`
+	TurnStart      int      `json:"turn_start"`
+	TurnEnd        int      `json:"turn_end"`
+
+	// ChunkTime is the create_time of the chunk's first timestamped message (unix seconds).
+	ChunkTime *float64 `json:"chunk_time,omitempty"`
+
+	Text        string `json:"text"`
+	SummaryPath string `json:"summary_path"`
+}
@@ -0,0 +1,46 @@
+package migration
+
+import (
+	"sort"
+	"strings"
+)
+
+// NormalizeTags cleans a tag or term list for writing: each entry is trimmed with inner whitespace
+// collapsed and, when lower is set, lowercased, and empty entries and case-insensitive duplicates
+// (after the first spelling) are dropped. The rest keep their order, which is the model's order of
+// salience, so capping the list afterwards keeps the most salient entries; index builders sort with
+// SortTags once the cap is applied. It returns nil for an empty result.
+func NormalizeTags(in []string, lower bool) []string {
+	out := make([]string, 0, len(in))
+	for _, s := range in {
+		s = strings.Join(strings.Fields(s), " ")
+		if lower {
+			s = strings.ToLower(s)
+		}
+		out = append(out, s)
+	}
+	out = dedupeStrings(out)
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// SortTags sorts a NormalizeTags result case-insensitively in place and returns it, so index rows
+// list the same labels the same way and diffs between runs show only real changes.
+func SortTags(tags []string) []string {
+	// NormalizeTags dropped case-insensitive duplicates, so the order is total.
+	sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i]) < strings.ToLower(tags[j]) })
+	return tags
+}
+
+// NormalizeTags applies NormalizeTags to the summary's tags, lowercased when lowerTags is set, and its
+// terms, which keep their case.
+func (s *ChunkSummary) NormalizeTags(lowerTags bool) {
+	s.Tags, s.Terms = NormalizeTags(s.Tags, lowerTags), NormalizeTags(s.Terms, false)
+}
+
+// NormalizeTags is ChunkSummary.NormalizeTags for rollups.
+func (s *ThreadSummary) NormalizeTags(lowerTags bool) {
+	s.Tags, s.Terms = NormalizeTags(s.Tags, lowerTags), NormalizeTags(s.Terms, false)
+}
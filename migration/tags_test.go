@@ -0,0 +1,40 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeTags_DedupesInOrder(t *testing.T) {
+	t.Parallel()
+
+	in := []string{" Visa ", "relocation", "visa", "", "Home  Automation", "NIF", "home automation", "nif"}
+	if got, want := NormalizeTags(in, false), []string{"Visa", "relocation", "Home Automation", "NIF"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("NormalizeTags=%q, want %q", got, want)
+	}
+	if got, want := NormalizeTags(in, true), []string{"visa", "relocation", "home automation", "nif"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("NormalizeTags lower=%q, want %q", got, want)
+	}
+	if got := NormalizeTags([]string{" ", ""}, true); got != nil {
+		t.Fatalf("NormalizeTags of blanks=%q, want nil", got)
+	}
+
+	ts := ThreadSummary{Tags: []string{"Visa", "housing"}, Terms: []string{"NIF", "D7 visa", "NIF"}}
+	ts.NormalizeTags(true)
+	if !reflect.DeepEqual(ts.Tags, []string{"visa", "housing"}) || !reflect.DeepEqual(ts.Terms, []string{"NIF", "D7 visa"}) {
+		t.Fatalf("ThreadSummary.NormalizeTags: tags=%q terms=%q", ts.Tags, ts.Terms)
+	}
+	if rec := BuildThreadIndexRecord(ThreadSummary{Tags: []string{"b", "A", "a"}}, "p"); !reflect.DeepEqual(rec.Tags, []string{"b", "A"}) {
+		t.Fatalf("thread index tags=%q", rec.Tags)
+	}
+}
+
+func TestSortTags_AfterCapKeepsMostSalient(t *testing.T) {
+	t.Parallel()
+
+	// The model lists tags most salient first; capping to two must keep those, not "alpha"/"beta".
+	tags := NormalizeTags([]string{"zoning", "Visa", "alpha", "beta"}, false)
+	if got, want := SortTags(tags[:2]), []string{"Visa", "zoning"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("SortTags(capped)=%q, want %q", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package migration
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+)
+
+// ThreadBundleSuffix ends the per-thread bundle file: <conversation_id>.bundle.json.
+const ThreadBundleSuffix = ".bundle.json"
+
+// ThreadBundle is everything the pipeline has for one conversation in a single file, so downstream
+// consumers can fetch it with one read. Parts the run has not produced are left empty.
+type ThreadBundle struct {
+	ConversationID string `json:"conversation_id"`
+
+	// Thread is the simplified thread archive-splitter wrote.
+	Thread *SimplifiedConversation `json:"thread,omitempty"`
+
+	// ChunkSummaries and ChunkSentimentSummaries are in chunk order.
+	ChunkSummaries          []ChunkSummary          `json:"chunk_summaries"`
+	ChunkSentimentSummaries []ChunkSentimentSummary `json:"chunk_sentiment_summaries"`
+
+	ThreadSummary          *ThreadSummary          `json:"thread_summary,omitempty"`
+	ThreadSentimentSummary *ThreadSentimentSummary `json:"thread_sentiment_summary,omitempty"`
+}
+
+// ThreadBundlePath is the bundle path for conversationID under dir.
+func ThreadBundlePath(dir, conversationID string) string {
+	return filepath.Join(dir, conversationID+ThreadBundleSuffix)
+}
+
+// WriteThreadBundle writes b to ThreadBundlePath(dir, b.ConversationID), replacing any earlier
+// bundle, and returns the path.
+func WriteThreadBundle(dir string, b ThreadBundle, pretty bool) (string, error) {
+	if b.ChunkSummaries == nil {
+		b.ChunkSummaries = []ChunkSummary{}
+	}
+	if b.ChunkSentimentSummaries == nil {
+		b.ChunkSentimentSummaries = []ChunkSentimentSummary{}
+	}
+	var out []byte
+	var err error
+	if pretty {
+		out, err = json.MarshalIndent(b, "", "  ")
+	} else {
+		out, err = json.Marshal(b)
+	}
+	if err != nil {
+		return "", fmt.Errorf("marshal thread bundle %s: %w", b.ConversationID, err)
+	}
+	path := ThreadBundlePath(dir, b.ConversationID)
+	if err := os.MkdirAll(layout.LongPath(dir), 0o755); err != nil {
+		return "", fmt.Errorf("mkdir bundle dir: %w", err)
+	}
+	if err := fileutils.WriteFileAtomicSameDir(path, out, 0o644); err != nil {
+		return "", fmt.Errorf("write thread bundle: %w", err)
+	}
+	return path, nil
+}
@@ -11,6 +11,8 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
 )
 
 // Turn represents a user-led segment of the conversation: a user message plus any following assistant/tool/system
@@ -30,11 +32,19 @@ type Turn struct {
 type Chunk struct {
 	ConversationID string              `json:"conversation_id"`
 	Title          string              `json:"title,omitempty"`
+	Project        string              `json:"project,omitempty"`
+	SourceType     string              `json:"source_type,omitempty"`
 	ThreadStart    *float64            `json:"thread_start_time,omitempty"`
+	ThreadUpdate   *float64            `json:"thread_update_time,omitempty"`
 	ChunkNumber    int                 `json:"chunk_number"`
 	TurnStart      int                 `json:"turn_start"`
 	TurnEnd        int                 `json:"turn_end"` // exclusive
+	Participants   []Participant       `json:"participants,omitempty"`
 	Messages       []SimplifiedMessage `json:"messages"`
+
+	// Tiny marks the single chunk of a thread under ChunkOptions.MinTurns or MinMessages; its summary
+	// stands in for the thread's rollup.
+	Tiny bool `json:"tiny,omitempty"`
 }
 
 // ChunkOptions controls how thread chunks are written.
@@ -53,6 +63,97 @@ type ChunkOptions struct {
 
 	// FileMode is used when creating output files (defaults to 0o644).
 	FileMode fs.FileMode
+
+	// Limits bounds the chunking a decider may produce; zero fields take DefaultBreakpointLimits values.
+	Limits BreakpointLimits
+
+	// Filter drops or compresses messages before turns are built, so breakpoint requests and chunks
+	// both go without them. A thread whose every message would be dropped is chunked unfiltered.
+	Filter MessageFilter
+
+	// MinTurns and MinMessages mark tiny threads: a thread with fewer turns or fewer messages (after
+	// Filter) is written as one chunk without asking the decider, so it costs one chunk summary and
+	// a passthrough rollup. 0 disables a check.
+	MinTurns    int
+	MinMessages int
+
+	// MaxTinyTokens, when > 0, keeps threads whose messages are estimated at more tokens from being
+	// tiny, so a thread too long for one summary prompt is still chunked.
+	MaxTinyTokens int
+
+	// OnTiny, when set, is called for each thread taken as tiny.
+	OnTiny func(conversationID string)
+
+	// Warn, when set, receives a message each time the decider's breakpoints are rejected in favor of
+	// heuristic ones.
+	Warn func(msg string)
+}
+
+// BreakpointLimits are sanity bounds on decided breakpoints. Breakpoints that break them are treated as a
+// bad model answer rather than a chunking to follow.
+type BreakpointLimits struct {
+	// MinChunkTurns is the smallest size allowed for every chunk but the last.
+	MinChunkTurns int
+	// MaxChunkTurns is the largest size allowed for any chunk.
+	MaxChunkTurns int
+	// MaxChunks caps the number of chunks per thread.
+	MaxChunks int
+}
+
+// DefaultBreakpointLimits allows chunks from a quarter of the target size (or of the thread, if shorter)
+// to three times the target size, and at most about twice as many chunks as the target implies.
+func DefaultBreakpointLimits(totalTurns, targetTurnsPerChunk int) BreakpointLimits {
+	target := max(targetTurnsPerChunk, 1)
+	return BreakpointLimits{
+		MinChunkTurns: max(min(target, totalTurns)/4, 1),
+		MaxChunkTurns: 3 * target,
+		MaxChunks:     2*((totalTurns+target-1)/target) + 1,
+	}
+}
+
+func (l BreakpointLimits) withDefaults(totalTurns, targetTurnsPerChunk int) BreakpointLimits {
+	def := DefaultBreakpointLimits(totalTurns, targetTurnsPerChunk)
+	if l.MinChunkTurns <= 0 {
+		l.MinChunkTurns = def.MinChunkTurns
+	}
+	if l.MaxChunkTurns <= 0 {
+		l.MaxChunkTurns = def.MaxChunkTurns
+	}
+	if l.MaxChunks <= 0 {
+		l.MaxChunks = def.MaxChunks
+	}
+	return l
+}
+
+// CheckBreakpoints reports why breakpoints are not a sane chunking of totalTurns turns: a value outside
+// [0,totalTurns], or chunks that break the limits. Duplicates and the 0/totalTurns boundaries are
+// harmless and ignored, as ApplyTurnBreakpoints does.
+func CheckBreakpoints(breakpoints []int, totalTurns int, lim BreakpointLimits) error {
+	for _, b := range breakpoints {
+		if b < 0 || b > totalTurns {
+			return fmt.Errorf("breakpoint %d out of range [0,%d]", b, totalTurns)
+		}
+	}
+	bps, err := normalizeBreakpoints(breakpoints, totalTurns)
+	if err != nil {
+		return err
+	}
+	if n := len(bps) + 1; lim.MaxChunks > 0 && n > lim.MaxChunks {
+		return fmt.Errorf("%d chunks exceeds max %d", n, lim.MaxChunks)
+	}
+	start := 0
+	for i, end := range append(bps, totalTurns) {
+		size := end - start
+		last := i == len(bps)
+		if !last && size < lim.MinChunkTurns {
+			return fmt.Errorf("chunk at turn %d has %d turns, below min %d", start, size, lim.MinChunkTurns)
+		}
+		if lim.MaxChunkTurns > 0 && size > lim.MaxChunkTurns {
+			return fmt.Errorf("chunk at turn %d has %d turns, above max %d", start, size, lim.MaxChunkTurns)
+		}
+		start = end
+	}
+	return nil
 }
 
 // BreakpointDecider decides where to split a thread into chunks.
@@ -164,18 +265,34 @@ func ChunkThread(ctx context.Context, threadPath string, decider BreakpointDecid
 	if err := json.Unmarshal(b, &thread); err != nil {
 		return nil, fmt.Errorf("ChunkThread: unmarshal thread: %w", err)
 	}
+	if msgs, _, _ := opts.Filter.Apply(thread.Messages); len(msgs) > 0 {
+		thread.Messages = msgs
+	}
 
 	turns := BuildTurns(thread)
 	if len(turns) == 0 {
 		return nil, errors.New("ChunkThread: thread has no messages/turns")
 	}
 
-	breakpoints, err := decider.DecideBreakpoints(ctx, thread, turns, targetTurnsPerChunk)
-	if err != nil {
-		return nil, fmt.Errorf("ChunkThread: decide breakpoints: %w", err)
-	}
-	if len(breakpoints) == 0 {
-		breakpoints = fallbackBreakpoints(len(turns), targetTurnsPerChunk)
+	var breakpoints []int
+	tiny := opts.tiny(len(turns), thread.Messages)
+	if tiny {
+		if opts.OnTiny != nil {
+			opts.OnTiny(thread.ConversationID)
+		}
+	} else {
+		breakpoints, err = decider.DecideBreakpoints(ctx, thread, turns, targetTurnsPerChunk)
+		if err != nil {
+			return nil, fmt.Errorf("ChunkThread: decide breakpoints: %w", err)
+		}
+		if len(breakpoints) == 0 {
+			breakpoints = fallbackBreakpoints(len(turns), targetTurnsPerChunk)
+		} else if err := CheckBreakpoints(breakpoints, len(turns), opts.Limits.withDefaults(len(turns), targetTurnsPerChunk)); err != nil {
+			if opts.Warn != nil {
+				opts.Warn(fmt.Sprintf("%s: rejected %d decided breakpoints (%s); using heuristic breakpoints", thread.ConversationID, len(breakpoints), err.Error()))
+			}
+			breakpoints = fallbackBreakpoints(len(turns), targetTurnsPerChunk)
+		}
 	}
 
 	chunks, err := ApplyTurnBreakpoints(thread, turns, breakpoints)
@@ -192,7 +309,9 @@ func ChunkThread(ctx context.Context, threadPath string, decider BreakpointDecid
 	var written []string
 	for i, ch := range chunks {
 		ch.ChunkNumber = i + 1
+		ch.Tiny = tiny
 		ch.ThreadStart = threadStart
+		ch.ThreadUpdate = thread.UpdateTime
 
 		filename := fmt.Sprintf("%s_%d.json", startStamp, ch.ChunkNumber)
 		outPath := filepath.Join(opts.OutputDir, filename)
@@ -204,17 +323,12 @@ func ChunkThread(ctx context.Context, threadPath string, decider BreakpointDecid
 			}
 		}
 
-		var out []byte
-		if opts.Pretty {
-			out, err = json.MarshalIndent(ch, "", "  ")
-		} else {
-			out, err = json.Marshal(ch)
-		}
+		out, err := fileutils.MarshalJSON(ch, opts.Pretty)
 		if err != nil {
 			return nil, fmt.Errorf("ChunkThread: marshal chunk: %w", err)
 		}
 
-		if _, err := writeFileAtomic(opts.OutputDir, outPath, out, opts.FileMode); err != nil {
+		if _, err := writeFileAtomic(outPath, out, opts.FileMode); err != nil {
 			return nil, fmt.Errorf("ChunkThread: write chunk file: %w", err)
 		}
 		written = append(written, outPath)
@@ -223,6 +337,92 @@ func ChunkThread(ctx context.Context, threadPath string, decider BreakpointDecid
 	return written, nil
 }
 
+func (o ChunkOptions) tiny(turns int, messages []SimplifiedMessage) bool {
+	if !(o.MinTurns > 0 && turns < o.MinTurns) && !(o.MinMessages > 0 && len(messages) < o.MinMessages) {
+		return false
+	}
+	if o.MaxTinyTokens <= 0 {
+		return true
+	}
+	n := 0
+	for _, m := range messages {
+		n += len(m.Text)
+	}
+	return approxTokens(n) <= o.MaxTinyTokens
+}
+
+// ThreadChunked reports whether chunkDir holds a complete chunking of the thread at threadPath: chunk
+// files for that conversation whose turn ranges cover every turn of the thread exactly once. A run that
+// crashed partway through a thread's chunks, or a thread that has grown since it was chunked, reports
+// false.
+func ThreadChunked(threadPath, chunkDir string) (bool, error) {
+	b, err := os.ReadFile(threadPath)
+	if err != nil {
+		return false, fmt.Errorf("ThreadChunked: read thread: %w", err)
+	}
+	var thread SimplifiedConversation
+	if err := json.Unmarshal(b, &thread); err != nil {
+		return false, fmt.Errorf("ThreadChunked: unmarshal thread: %w", err)
+	}
+	totalTurns := len(BuildTurns(thread))
+	if totalTurns == 0 {
+		return false, nil
+	}
+
+	files, err := ChunkFiles(chunkDir)
+	if err != nil {
+		return false, err
+	}
+	covered := make([]bool, totalTurns)
+	n := 0
+	for _, p := range files {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return false, fmt.Errorf("ThreadChunked: read chunk: %w", err)
+		}
+		var ch struct {
+			ConversationID string `json:"conversation_id"`
+			TurnStart      int    `json:"turn_start"`
+			TurnEnd        int    `json:"turn_end"`
+		}
+		if err := json.Unmarshal(b, &ch); err != nil || ch.ConversationID != thread.ConversationID {
+			return false, nil
+		}
+		if ch.TurnStart < 0 || ch.TurnEnd > totalTurns || ch.TurnStart >= ch.TurnEnd {
+			return false, nil
+		}
+		for t := ch.TurnStart; t < ch.TurnEnd; t++ {
+			if covered[t] {
+				return false, nil
+			}
+			covered[t] = true
+			n++
+		}
+	}
+	return n == totalTurns, nil
+}
+
+// ChunkFiles returns the chunk JSON files directly in a thread's chunk directory, skipping bookkeeping
+// files. A missing directory has none.
+func ChunkFiles(chunkDir string) ([]string, error) {
+	ents, err := os.ReadDir(chunkDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read chunk dir: %w", err)
+	}
+	var out []string
+	for _, e := range ents {
+		name := e.Name()
+		if e.IsDir() || !strings.EqualFold(filepath.Ext(name), ".json") || IsBookkeepingFile(name) {
+			continue
+		}
+		out = append(out, filepath.Join(chunkDir, name))
+	}
+	return out, nil
+}
+
 func threadStartTime(thread SimplifiedConversation) *float64 {
 	if thread.CreateTime != nil {
 		return thread.CreateTime
@@ -275,12 +475,16 @@ func ApplyTurnBreakpoints(thread SimplifiedConversation, turns []Turn, breakpoin
 			return nil, fmt.Errorf("ApplyTurnBreakpoints: invalid message range for turns [%d,%d): %d..%d", ts, te, ms, me)
 		}
 
+		msgs := append([]SimplifiedMessage(nil), thread.Messages[ms:me+1]...)
 		chunks = append(chunks, Chunk{
 			ConversationID: thread.ConversationID,
 			Title:          thread.Title,
+			Project:        thread.Project.Label(),
+			SourceType:     NormalizeSourceType(thread.SourceType),
 			TurnStart:      ts,
 			TurnEnd:        te,
-			Messages:       append([]SimplifiedMessage(nil), thread.Messages[ms:me+1]...),
+			Participants:   MessageParticipants(msgs),
+			Messages:       msgs,
 		})
 	}
 
@@ -3,9 +3,13 @@ package migration
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/fileutils"
 )
 
 type fakeDecider struct {
@@ -84,10 +88,12 @@ func TestChunkThread_WritesFilesWithTimestampPrefix(t *testing.T) {
 	t.Parallel()
 
 	ct := 1707142860.0
+	ut := 1707229260.0
 	thread := SimplifiedConversation{
 		ConversationID: "c1",
 		Title:          "t",
 		CreateTime:     &ct,
+		UpdateTime:     &ut,
 		Messages: []SimplifiedMessage{
 			{Role: "user", Text: "u1"},
 			{Role: "assistant", Text: "a1"},
@@ -117,10 +123,204 @@ func TestChunkThread_WritesFilesWithTimestampPrefix(t *testing.T) {
 		t.Fatalf("len(written)=%d, want 2", len(written))
 	}
 
-	// Ensure files exist.
+	// Ensure files exist and carry the thread's export metadata.
 	for _, p := range written {
-		if _, err := os.Stat(p); err != nil {
-			t.Fatalf("stat %s: %v", p, err)
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("read %s: %v", p, err)
+		}
+		var ch Chunk
+		if err := json.Unmarshal(b, &ch); err != nil {
+			t.Fatalf("unmarshal %s: %v", p, err)
+		}
+		if ch.Title != "t" || ch.ThreadUpdate == nil || *ch.ThreadUpdate != ut {
+			t.Fatalf("chunk title=%q thread_update_time=%v", ch.Title, ch.ThreadUpdate)
+		}
+	}
+}
+
+func TestThreadChunked_DetectsPartialAndGrownThreads(t *testing.T) {
+	t.Parallel()
+
+	ct := 1707142860.0
+	thread := SimplifiedConversation{
+		ConversationID: "c1",
+		CreateTime:     &ct,
+		Messages: []SimplifiedMessage{
+			{Role: "user", Text: "u1"},
+			{Role: "assistant", Text: "a1"},
+			{Role: "user", Text: "u2"},
+			{Role: "assistant", Text: "a2"},
+			{Role: "user", Text: "u3"},
+		},
+	}
+	writeThread := func(path string) {
+		t.Helper()
+		b, err := json.Marshal(thread)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	inPath := filepath.Join(t.TempDir(), "thread.json")
+	writeThread(inPath)
+	outDir := filepath.Join(t.TempDir(), "chunks")
+
+	if ok, err := ThreadChunked(inPath, outDir); err != nil || ok {
+		t.Fatalf("missing dir: ok=%v err=%v", ok, err)
+	}
+
+	written, err := ChunkThread(context.Background(), inPath, fakeDecider{breakpoints: []int{1, 2}}, 20, ChunkOptions{OutputDir: outDir})
+	if err != nil {
+		t.Fatalf("ChunkThread: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(outDir, RunReportFileName), []byte(`{}`), 0o644); err != nil {
+		t.Fatalf("write report: %v", err)
+	}
+	if ok, err := ThreadChunked(inPath, outDir); err != nil || !ok {
+		t.Fatalf("complete: ok=%v err=%v", ok, err)
+	}
+
+	// A crash after the first chunk leaves turns uncovered.
+	if err := os.Remove(written[len(written)-1]); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if ok, err := ThreadChunked(inPath, outDir); err != nil || ok {
+		t.Fatalf("partial: ok=%v err=%v", ok, err)
+	}
+
+	// Rechunk, then grow the thread by one turn.
+	if _, err := ChunkThread(context.Background(), inPath, fakeDecider{breakpoints: []int{1, 2}}, 20, ChunkOptions{OutputDir: outDir, OverwriteExisting: true}); err != nil {
+		t.Fatalf("ChunkThread: %v", err)
+	}
+	thread.Messages = append(thread.Messages, SimplifiedMessage{Role: "user", Text: "u4"})
+	writeThread(inPath)
+	if ok, err := ThreadChunked(inPath, outDir); err != nil || ok {
+		t.Fatalf("grown: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestCheckBreakpoints(t *testing.T) {
+	t.Parallel()
+
+	lim := DefaultBreakpointLimits(100, 20)
+	perTurn := make([]int, 0, 99)
+	for i := 1; i < 100; i++ {
+		perTurn = append(perTurn, i)
+	}
+	cases := []struct {
+		name string
+		bps  []int
+		ok   bool
+	}{
+		{"target sized", []int{20, 40, 60, 80}, true},
+		{"boundaries and duplicates", []int{0, 30, 30, 60, 100}, true},
+		{"short last chunk", []int{20, 40, 60, 80, 99}, true},
+		{"out of range", []int{20, 140}, false},
+		{"negative", []int{-1, 50}, false},
+		{"one per turn", perTurn, false},
+		{"tiny middle chunk", []int{20, 22, 60}, false},
+		{"oversized chunk", []int{90}, false},
+	}
+	for _, tc := range cases {
+		if err := CheckBreakpoints(tc.bps, 100, lim); (err == nil) != tc.ok {
+			t.Fatalf("%s: err=%v", tc.name, err)
 		}
 	}
 }
+
+func TestChunkThread_FallsBackOnPathologicalBreakpoints(t *testing.T) {
+	t.Parallel()
+
+	var msgs []SimplifiedMessage
+	var perTurn []int
+	for i := 0; i < 12; i++ {
+		msgs = append(msgs, SimplifiedMessage{Role: "user", Text: "u"}, SimplifiedMessage{Role: "assistant", Text: "a"})
+		if i > 0 {
+			perTurn = append(perTurn, i)
+		}
+	}
+	b, err := json.Marshal(SimplifiedConversation{ConversationID: "c1", Messages: msgs})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	inPath := filepath.Join(t.TempDir(), "thread.json")
+	if err := os.WriteFile(inPath, b, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var warnings []string
+	written, err := ChunkThread(context.Background(), inPath, fakeDecider{breakpoints: perTurn}, 4, ChunkOptions{
+		OutputDir: filepath.Join(t.TempDir(), "chunks"),
+		Warn:      func(msg string) { warnings = append(warnings, msg) },
+	})
+	if err != nil {
+		t.Fatalf("ChunkThread: %v", err)
+	}
+	if len(written) != 3 || len(warnings) != 1 {
+		t.Fatalf("written=%d warnings=%v", len(written), warnings)
+	}
+}
+
+type failingDecider struct{}
+
+func (failingDecider) DecideBreakpoints(context.Context, SimplifiedConversation, []Turn, int) ([]int, error) {
+	return nil, errors.New("decider called")
+}
+
+func TestChunkThread_TinyThreadSkipsDecider(t *testing.T) {
+	t.Parallel()
+
+	b, err := json.Marshal(SimplifiedConversation{ConversationID: "c1", Messages: []SimplifiedMessage{
+		{Role: "user", Text: "u1"},
+		{Role: "assistant", Text: "a1"},
+		{Role: "user", Text: "u2"},
+		{Role: "assistant", Text: "a2"},
+	}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	inPath := filepath.Join(t.TempDir(), "thread.json")
+	if err := os.WriteFile(inPath, b, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var tiny []string
+	written, err := ChunkThread(context.Background(), inPath, failingDecider{}, 1, ChunkOptions{
+		OutputDir: filepath.Join(t.TempDir(), "chunks"),
+		MinTurns:  3,
+		OnTiny:    func(id string) { tiny = append(tiny, id) },
+	})
+	if err != nil {
+		t.Fatalf("ChunkThread: %v", err)
+	}
+	if len(written) != 1 || len(tiny) != 1 || tiny[0] != "c1" {
+		t.Fatalf("written=%v tiny=%v, want one chunk of tiny c1", written, tiny)
+	}
+	var ch Chunk
+	if err := fileutils.ReadArtifact(written[0], &ch); err != nil || !ch.Tiny || ch.TurnEnd != 2 {
+		t.Fatalf("chunk=%+v err=%v, want a tiny chunk of both turns", ch, err)
+	}
+
+	// Reaching every threshold goes back to the decider.
+	_, err = ChunkThread(context.Background(), inPath, failingDecider{}, 1, ChunkOptions{
+		OutputDir:   filepath.Join(t.TempDir(), "chunks"),
+		MinTurns:    2,
+		MinMessages: 4,
+	})
+	if err == nil || !strings.Contains(err.Error(), "decider called") {
+		t.Fatalf("err=%v, want the decider's error", err)
+	}
+
+	// So does a thread over MaxTinyTokens, however few its turns.
+	_, err = ChunkThread(context.Background(), inPath, failingDecider{}, 1, ChunkOptions{
+		OutputDir:     filepath.Join(t.TempDir(), "chunks"),
+		MinTurns:      3,
+		MaxTinyTokens: 1,
+	})
+	if err == nil || !strings.Contains(err.Error(), "decider called") {
+		t.Fatalf("err=%v, want the decider's error for a thread over MaxTinyTokens", err)
+	}
+}
@@ -1,16 +1,62 @@
 package migration
 
-import "strings"
+import (
+	"strings"
+	"unicode"
+)
+
+// MicroSummaryMaxChars is the longest ThreadSummary.MicroSummary, in bytes.
+const MicroSummaryMaxChars = 240
 
 // BuildThreadIndexRecord creates a stable index row for a thread summary file.
 func BuildThreadIndexRecord(ts ThreadSummary, threadSummaryPath string) ThreadIndexRecord {
 	return ThreadIndexRecord{
 		ConversationID:    ts.ConversationID,
 		ThreadStart:       ts.ThreadStart,
+		ThreadUpdate:      ts.ThreadUpdate,
 		Title:             ts.Title,
+		OriginalTitle:     ts.OriginalTitle,
+		Project:           ts.Project,
+		SourceType:        ts.SourceType,
 		ThreadSummaryPath: threadSummaryPath,
 		Summary:           strings.TrimSpace(ts.Summary),
-		Tags:              dedupeStrings(ts.Tags),
-		Terms:             dedupeStrings(ts.Terms),
+		Tags:              NormalizeTags(ts.Tags, false),
+		Terms:             NormalizeTags(ts.Terms, false),
+		SourceTokens:      ts.SourceTokens,
+		SummaryTokens:     SummaryTokens(ts),
+		CompressionRatio:  CompressionRatio(int64(ts.SourceTokens), int64(SummaryTokens(ts))),
+	}
+}
+
+// IndexSummary returns the summary text for an index row limited to max bytes: the full summary when
+// it fits, otherwise the micro summary, so rows read as whole sentences. Rollups written before micro
+// summaries existed fall back to the truncated full summary. max <= 0 means no limit.
+func IndexSummary(ts ThreadSummary, max int) string {
+	full := strings.TrimSpace(ts.Summary)
+	if max <= 0 || len(full) <= max {
+		return full
+	}
+	if micro := strings.TrimSpace(ts.MicroSummary); micro != "" && len(micro) <= max {
+		return micro
+	}
+	return truncateForIndex(full, max)
+}
+
+// ClampMicroSummary trims s to MicroSummaryMaxChars, cutting at the last sentence end that fits, or
+// failing that the last word boundary, so an overlong model answer still ends cleanly.
+func ClampMicroSummary(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) <= MicroSummaryMaxChars {
+		return s
+	}
+	cut := s[:MicroSummaryMaxChars]
+	if i := strings.LastIndexAny(cut, ".!?"); i >= MicroSummaryMaxChars/2 {
+		return cut[:i+1]
+	}
+	// Leave room for the ellipsis (3 bytes).
+	cut = s[:MicroSummaryMaxChars-3]
+	if i := strings.LastIndexFunc(cut, unicode.IsSpace); i > 0 {
+		cut = cut[:i]
 	}
+	return strings.TrimRightFunc(cut, func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSpace(r) }) + "…"
 }
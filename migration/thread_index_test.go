@@ -1,17 +1,24 @@
 package migration
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestBuildThreadIndexRecord_Dedupes(t *testing.T) {
 	t.Parallel()
 
 	ts := ThreadSummary{
 		ConversationID: "c1",
+		Project:        "Garden",
 		Summary:        " hi ",
 		Tags:           []string{"Foo", "foo", "Bar"},
 		Terms:          []string{"Vix", "vix"},
 	}
 	rec := BuildThreadIndexRecord(ts, "t.summary.json")
+	if rec.Project != "Garden" {
+		t.Fatalf("Project=%q, want Garden", rec.Project)
+	}
 	if rec.Summary != "hi" {
 		t.Fatalf("Summary=%q, want hi", rec.Summary)
 	}
@@ -22,3 +29,41 @@ func TestBuildThreadIndexRecord_Dedupes(t *testing.T) {
 		t.Fatalf("Terms=%v, want 1", rec.Terms)
 	}
 }
+
+func TestIndexSummary_PrefersMicroOverTruncation(t *testing.T) {
+	t.Parallel()
+
+	ts := ThreadSummary{Summary: "The user planned a garden. They picked tomatoes and built a frame.", MicroSummary: "Garden planning."}
+	if got := IndexSummary(ts, 0); got != ts.Summary {
+		t.Fatalf("unlimited=%q", got)
+	}
+	if got := IndexSummary(ts, 200); got != ts.Summary {
+		t.Fatalf("fits=%q", got)
+	}
+	if got := IndexSummary(ts, 30); got != "Garden planning." {
+		t.Fatalf("micro=%q", got)
+	}
+	ts.MicroSummary = ""
+	if got := IndexSummary(ts, 10); got != "The user p…" {
+		t.Fatalf("fallback=%q", got)
+	}
+}
+
+func TestClampMicroSummary(t *testing.T) {
+	t.Parallel()
+
+	if got := ClampMicroSummary("  Short\n summary. "); got != "Short summary." {
+		t.Fatalf("short=%q", got)
+	}
+
+	sentence := strings.Repeat("word ", 30) + "end. "
+	got := ClampMicroSummary(sentence + strings.Repeat("more ", 40))
+	if got != strings.TrimSpace(sentence) {
+		t.Fatalf("sentence cut=%q", got)
+	}
+
+	got = ClampMicroSummary(strings.Repeat("word ", 80))
+	if len(got) > MicroSummaryMaxChars || !strings.HasSuffix(got, "word…") {
+		t.Fatalf("word cut=%q (%d bytes)", got, len(got))
+	}
+}
@@ -0,0 +1,308 @@
+package migration
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/theimaginaryfoundation/compress-o-bot/migration/layout"
+)
+
+// ThreadLinksFileName is the continuation-link file thread-link writes next to thread_index.json.
+const ThreadLinksFileName = "thread_links.jsonl"
+
+// SagaSuffix names combined saga rollups ("saga-<id>.saga.json"). It matches no artifact suffix, so
+// sagas are never mistaken for thread rollups.
+const SagaSuffix = ".saga.json"
+
+// ThreadLink is one row of thread_links.jsonl: the verdict on whether the later thread To continues
+// the earlier thread From. Rejected candidates are kept too, so later runs do not ask again.
+type ThreadLink struct {
+	// ID is ThreadLinkID(From, To).
+	ID        string `json:"id"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	FromTitle string `json:"from_title,omitempty"`
+	ToTitle   string `json:"to_title,omitempty"`
+
+	TitleSimilarity float64 `json:"title_similarity"`
+	// GapHours is the time from From's last update to To's start (0 when they overlap).
+	GapHours float64 `json:"gap_hours"`
+
+	Continuation bool    `json:"continuation"`
+	Confidence   float64 `json:"confidence"`
+	Reason       string  `json:"reason,omitempty"`
+
+	// SourceSHA256 hashes both rollups' text; a changed rollup is checked again.
+	SourceSHA256 string `json:"source_sha256"`
+	Model        string `json:"model,omitempty"`
+	LinkedAt     string `json:"linked_at"`
+}
+
+// ThreadLinkID is the key of the link from one conversation to a later one.
+func ThreadLinkID(from, to string) string {
+	return from + ">" + to
+}
+
+// SagaSummary is a rollup across conversations linked as continuations of one another. Its
+// ConversationID is the saga ID ("saga-" plus the earliest member's ID).
+type SagaSummary struct {
+	ThreadSummary
+	// ConversationIDs lists the member threads, earliest first.
+	ConversationIDs []string `json:"conversation_ids"`
+	// SourceSHA256 hashes the member rollups; a saga whose members changed is rolled up again.
+	SourceSHA256 string `json:"source_sha256"`
+}
+
+// SagaID names the saga whose members, earliest first, are ids.
+func SagaID(ids []string) string {
+	if len(ids) == 0 {
+		return ""
+	}
+	return "saga-" + ids[0]
+}
+
+// LinkCandidate is a pair of threads whose titles and timing suggest the later continues the earlier.
+type LinkCandidate struct {
+	From, To        ThreadSummary
+	TitleSimilarity float64
+	Gap             time.Duration
+}
+
+// LinkCandidateOptions bounds LinkCandidates.
+type LinkCandidateOptions struct {
+	// MaxGap is the longest time from the earlier thread's last update to the later thread's start.
+	MaxGap time.Duration
+	// MinTitleSimilarity is the least TitleSimilarity a pair needs.
+	MinTitleSimilarity float64
+	// MaxPerThread keeps only the best earlier candidates for each thread (0 keeps all).
+	MaxPerThread int
+}
+
+// LinkCandidates pairs each thread with earlier threads that ended at most opt.MaxGap before it started
+// and whose titles are similar enough. Threads without a start time are ignored. For each later thread
+// the most similar (then closest) earlier threads come first; the result is ordered by the later
+// thread's start.
+func LinkCandidates(threads []ThreadSummary, opt LinkCandidateOptions) []LinkCandidate {
+	var dated []ThreadSummary
+	for _, t := range threads {
+		if t.ConversationID != "" && t.ThreadStart != nil {
+			dated = append(dated, t)
+		}
+	}
+	sort.SliceStable(dated, func(i, j int) bool {
+		if *dated[i].ThreadStart != *dated[j].ThreadStart {
+			return *dated[i].ThreadStart < *dated[j].ThreadStart
+		}
+		return dated[i].ConversationID < dated[j].ConversationID
+	})
+
+	var out []LinkCandidate
+	for j, to := range dated {
+		var found []LinkCandidate
+		for i := j - 1; i >= 0; i-- {
+			from := dated[i]
+			if *from.ThreadStart == *to.ThreadStart {
+				continue
+			}
+			end := *from.ThreadStart
+			if from.ThreadUpdate != nil && *from.ThreadUpdate > end {
+				end = *from.ThreadUpdate
+			}
+			gap := time.Duration((*to.ThreadStart - end) * float64(time.Second))
+			if gap < 0 {
+				gap = 0
+			}
+			if opt.MaxGap > 0 && gap > opt.MaxGap {
+				// Earlier threads are sorted by start, not end, so a later one may still be in range.
+				continue
+			}
+			sim := TitleSimilarity(from, to)
+			if sim < opt.MinTitleSimilarity || sim == 0 {
+				continue
+			}
+			found = append(found, LinkCandidate{From: from, To: to, TitleSimilarity: sim, Gap: gap})
+		}
+		sort.SliceStable(found, func(a, b int) bool {
+			if found[a].TitleSimilarity != found[b].TitleSimilarity {
+				return found[a].TitleSimilarity > found[b].TitleSimilarity
+			}
+			return found[a].Gap < found[b].Gap
+		})
+		if opt.MaxPerThread > 0 && len(found) > opt.MaxPerThread {
+			found = found[:opt.MaxPerThread]
+		}
+		out = append(out, found...)
+	}
+	return out
+}
+
+// TitleSimilarity is the Jaccard overlap of the content words of two threads' titles, taking the
+// better of their generated and original titles. Placeholder titles ("New chat") never match, and
+// continuation words ("part 2", "continued") are ignored.
+func TitleSimilarity(a, b ThreadSummary) float64 {
+	best := 0.0
+	for _, pair := range [][2]string{{a.Title, b.Title}, {a.OriginalTitle, b.OriginalTitle}, {a.Title, b.OriginalTitle}, {a.OriginalTitle, b.Title}} {
+		if s := titleJaccard(pair[0], pair[1]); s > best {
+			best = s
+		}
+	}
+	return best
+}
+
+// titleNoise are words that mark a continuation rather than a topic.
+var titleNoise = wordSet(`continued continuation cont part again new another follow followup round session`)
+
+func titleWords(title string) map[string]bool {
+	title = NormalizeTitle(title)
+	if title == "" || IsPlaceholderTitle(title) {
+		return nil
+	}
+	out := map[string]bool{}
+	for _, w := range extractiveTerms(title) {
+		if _, noise := titleNoise[w]; noise || isDigits(w) {
+			continue
+		}
+		out[w] = true
+	}
+	return out
+}
+
+func titleJaccard(a, b string) float64 {
+	wa, wb := titleWords(a), titleWords(b)
+	if len(wa) == 0 || len(wb) == 0 {
+		return 0
+	}
+	shared := 0
+	for w := range wa {
+		if wb[w] {
+			shared++
+		}
+	}
+	union := len(wa) + len(wb) - shared
+	return math.Round(float64(shared)/float64(union)*100) / 100
+}
+
+// LinkSourceText is the rollup text the continuation check reads for one thread.
+func LinkSourceText(ts ThreadSummary) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "title=%s\n", ts.Title)
+	if ts.OriginalTitle != "" && ts.OriginalTitle != ts.Title {
+		fmt.Fprintf(&b, "original_title=%s\n", ts.OriginalTitle)
+	}
+	if ts.ThreadStart != nil {
+		fmt.Fprintf(&b, "started=%s\n", time.Unix(int64(*ts.ThreadStart), 0).UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintf(&b, "summary:\n%s\n", strings.TrimSpace(ts.Summary))
+	if len(ts.KeyPoints) > 0 {
+		b.WriteString("key_points:\n")
+		for _, kp := range ts.KeyPoints {
+			fmt.Fprintf(&b, "- %s\n", strings.TrimSpace(kp))
+		}
+	}
+	return b.String()
+}
+
+// LinkSourceHash is the hex SHA-256 of the two threads' LinkSourceText.
+func LinkSourceHash(from, to ThreadSummary) string {
+	sum := sha256.Sum256([]byte(LinkSourceText(from) + "\x00" + LinkSourceText(to)))
+	return hex.EncodeToString(sum[:])
+}
+
+// SagaSourceHash is the hex SHA-256 of the members' LinkSourceText, in order.
+func SagaSourceHash(members []ThreadSummary) string {
+	h := sha256.New()
+	for _, m := range members {
+		h.Write([]byte(LinkSourceText(m)))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// LoadThreadLinks reads thread_links.jsonl into id -> latest row. A missing file yields none; torn lines
+// are skipped.
+func LoadThreadLinks(path string) (map[string]ThreadLink, error) {
+	out := map[string]ThreadLink{}
+	b, err := os.ReadFile(layout.LongPath(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return out, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read thread links %s: %w", path, err)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(make([]byte, 0, 1<<20), 64<<20)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var row ThreadLink
+		if err := json.Unmarshal(line, &row); err != nil || row.From == "" || row.To == "" {
+			continue
+		}
+		row.ID = ThreadLinkID(row.From, row.To)
+		out[row.ID] = row
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read thread links %s: %w", path, err)
+	}
+	return out, nil
+}
+
+// Sagas groups conversations joined by confirmed continuation links. Each saga has at least two
+// members, sorted by ID; sagas are ordered by their first member.
+func Sagas(links map[string]ThreadLink) [][]string {
+	parent := map[string]string{}
+	var find func(string) string
+	find = func(x string) string {
+		p, ok := parent[x]
+		if !ok {
+			parent[x] = x
+			return x
+		}
+		if p == x {
+			return x
+		}
+		root := find(p)
+		parent[x] = root
+		return root
+	}
+	for _, l := range links {
+		if !l.Continuation {
+			continue
+		}
+		a, b := find(l.From), find(l.To)
+		if a != b {
+			if b < a {
+				a, b = b, a
+			}
+			parent[b] = a
+		}
+	}
+	groups := map[string][]string{}
+	for id := range parent {
+		root := find(id)
+		groups[root] = append(groups[root], id)
+	}
+	var out [][]string
+	for _, g := range groups {
+		if len(g) < 2 {
+			continue
+		}
+		sort.Strings(g)
+		out = append(out, g)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i][0] < out[j][0] })
+	return out
+}
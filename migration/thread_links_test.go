@@ -0,0 +1,102 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func linkThread(id, title string, start, update float64) ThreadSummary {
+	return ThreadSummary{ConversationID: id, Title: title, ThreadStart: &start, ThreadUpdate: &update}
+}
+
+func TestTitleSimilarity_IgnoresContinuationWordsAndPlaceholders(t *testing.T) {
+	t.Parallel()
+
+	a := ThreadSummary{Title: "Garden irrigation plan"}
+	b := ThreadSummary{Title: "Garden irrigation plan (part 2, continued)"}
+	if got := TitleSimilarity(a, b); got != 1 {
+		t.Fatalf("similarity=%v want 1", got)
+	}
+	if got := TitleSimilarity(a, ThreadSummary{Title: "Garden lighting"}); got != 0.25 {
+		t.Fatalf("partial similarity=%v want 0.25", got)
+	}
+	if got := TitleSimilarity(ThreadSummary{Title: "New chat"}, ThreadSummary{Title: "New chat"}); got != 0 {
+		t.Fatalf("placeholder similarity=%v", got)
+	}
+	// The export's original titles count too.
+	c := ThreadSummary{Title: "Watering schedule", OriginalTitle: "Garden irrigation plan"}
+	if got := TitleSimilarity(a, c); got != 1 {
+		t.Fatalf("original-title similarity=%v", got)
+	}
+}
+
+func TestLinkCandidates_TimeWindowAndRanking(t *testing.T) {
+	t.Parallel()
+
+	day := 24 * 3600.0
+	threads := []ThreadSummary{
+		linkThread("c", "Garden irrigation plan continued", 10*day, 10*day),
+		linkThread("a", "Garden irrigation plan", 0, 2*day),
+		linkThread("b", "Garden irrigation budget", 3*day, 3*day),
+		linkThread("far", "Garden irrigation plan", 40*day, 40*day),
+		linkThread("other", "Tax return questions", 4*day, 4*day),
+		{ConversationID: "undated", Title: "Garden irrigation plan"},
+	}
+	got := LinkCandidates(threads, LinkCandidateOptions{MaxGap: 14 * 24 * time.Hour, MinTitleSimilarity: 0.3, MaxPerThread: 1})
+	var pairs []string
+	for _, c := range got {
+		pairs = append(pairs, ThreadLinkID(c.From.ConversationID, c.To.ConversationID))
+	}
+	// c prefers a (identical topic words) over b; far is outside the window of everything.
+	want := []string{"a>b", "a>c"}
+	if !reflect.DeepEqual(pairs, want) {
+		t.Fatalf("pairs=%v want %v", pairs, want)
+	}
+	if got[0].Gap != 24*time.Hour {
+		t.Fatalf("gap=%v want 24h (measured from the earlier thread's last update)", got[0].Gap)
+	}
+}
+
+func TestLoadThreadLinks_LastRowWinsAndSagas(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), ThreadLinksFileName)
+	data := `{"from":"a","to":"b","continuation":false}
+{"from":"a","to":"b","continuation":true,"confidence":0.9}
+{"from":"b","to":"c","continuation":true}
+{"from":"x","to":"y","continuation":false}
+{"from":"d","to":"e","continuation":true}
+{"from":"torn`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	links, err := LoadThreadLinks(path)
+	if err != nil {
+		t.Fatalf("LoadThreadLinks: %v", err)
+	}
+	if len(links) != 4 || !links["a>b"].Continuation || links["a>b"].ID != "a>b" {
+		t.Fatalf("links=%+v", links)
+	}
+	if got, want := Sagas(links), [][]string{{"a", "b", "c"}, {"d", "e"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("sagas=%v want %v", got, want)
+	}
+
+	missing, err := LoadThreadLinks(filepath.Join(t.TempDir(), "none.jsonl"))
+	if err != nil || len(missing) != 0 {
+		t.Fatalf("missing file: links=%v err=%v", missing, err)
+	}
+}
+
+func TestLinkSourceHash_ChangesWithEitherRollup(t *testing.T) {
+	t.Parallel()
+
+	a, b := ThreadSummary{Title: "A", Summary: "one"}, ThreadSummary{Title: "B", Summary: "two"}
+	h := LinkSourceHash(a, b)
+	b.Summary = "three"
+	if LinkSourceHash(a, b) == h || LinkSourceHash(b, a) == LinkSourceHash(a, b) {
+		t.Fatalf("hash does not track rollup content and order")
+	}
+}
@@ -0,0 +1,70 @@
+package migration
+
+// ThreadStatsFileName is the per-conversation stats file archive-splitter writes with -stats.
+const ThreadStatsFileName = "threads_stats.jsonl"
+
+// ThreadStats is one row of threads_stats.jsonl: size and shape facts about a split conversation,
+// cheap to compute while splitting and enough to plan importance scoring, cost estimates, and filters
+// before any model call.
+type ThreadStats struct {
+	ConversationID string   `json:"conversation_id"`
+	File           string   `json:"file"`
+	Source         string   `json:"source,omitempty"`
+	Title          string   `json:"title,omitempty"`
+	Project        string   `json:"project,omitempty"`
+	SourceType     string   `json:"source_type,omitempty"`
+	CreateTime     *float64 `json:"create_time,omitempty"`
+	UpdateTime     *float64 `json:"update_time,omitempty"`
+
+	// FirstMessageTime and LastMessageTime span the timestamped messages (unix seconds).
+	FirstMessageTime *float64 `json:"first_message_time,omitempty"`
+	LastMessageTime  *float64 `json:"last_message_time,omitempty"`
+
+	Messages  int            `json:"messages"`
+	Turns     int            `json:"turns"`
+	Roles     map[string]int `json:"roles,omitempty"`
+	ToolCalls int            `json:"tool_calls,omitempty"`
+
+	// TextBytes is the message text carried into the thread file; RawBytes is the conversation's size in
+	// the export and FileBytes the size of the written thread file.
+	TextBytes int64 `json:"text_bytes"`
+	RawBytes  int64 `json:"raw_bytes"`
+	FileBytes int64 `json:"file_bytes"`
+}
+
+// BuildThreadStats computes the stats row for a simplified conversation written to file.
+func BuildThreadStats(thread SimplifiedConversation, file string, rawBytes, fileBytes int64) ThreadStats {
+	st := ThreadStats{
+		ConversationID: thread.ConversationID,
+		File:           file,
+		Source:         thread.Source,
+		Title:          thread.Title,
+		Project:        thread.Project.Label(),
+		SourceType:     NormalizeSourceType(thread.SourceType),
+		CreateTime:     thread.CreateTime,
+		UpdateTime:     thread.UpdateTime,
+		Messages:       len(thread.Messages),
+		Turns:          len(BuildTurns(thread)),
+		RawBytes:       rawBytes,
+		FileBytes:      fileBytes,
+	}
+	for _, m := range thread.Messages {
+		if st.Roles == nil {
+			st.Roles = map[string]int{}
+		}
+		st.Roles[m.Role]++
+		if m.ToolCall != nil {
+			st.ToolCalls++
+		}
+		st.TextBytes += int64(len(m.Text))
+		if t := m.CreateTime; t != nil {
+			if st.FirstMessageTime == nil || *t < *st.FirstMessageTime {
+				st.FirstMessageTime = t
+			}
+			if st.LastMessageTime == nil || *t > *st.LastMessageTime {
+				st.LastMessageTime = t
+			}
+		}
+	}
+	return st
+}
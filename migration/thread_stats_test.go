@@ -0,0 +1,66 @@
+package migration
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitConversationArchive_WritesThreadStats(t *testing.T) {
+	t.Parallel()
+
+	in := `[{"title":"A","conversation_id":"c1","id":"c1","create_time":1,"update_time":9,"current_node":"m3","mapping":{"m1":{"id":"m1","message":{"author":{"role":"user","name":null},"create_time":5,"content":{"content_type":"text","parts":["hi"]},"metadata":{}},"parent":null,"children":["m2"]},"m2":{"id":"m2","message":{"author":{"role":"assistant","name":null},"create_time":3,"content":{"content_type":"text","parts":["hello"]},"metadata":{}},"parent":"m1","children":["m3"]},"m3":{"id":"m3","message":{"author":{"role":"user","name":null},"create_time":8,"content":{"content_type":"text","parts":["bye"]},"metadata":{}},"parent":"m2","children":[]}}},{"title":"B","conversation_id":"c2","id":"c2","mapping":{}}]`
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "in.json")
+	if err := os.WriteFile(inPath, []byte(in), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+
+	outDir := filepath.Join(dir, "out")
+	statsPath := filepath.Join(outDir, ThreadStatsFileName)
+	res, err := SplitConversationArchive(context.Background(), inPath, outDir, SplitOptions{StatsPath: statsPath})
+	if err != nil {
+		t.Fatalf("SplitConversationArchive: %v", err)
+	}
+
+	f, err := os.Open(statsPath)
+	if err != nil {
+		t.Fatalf("open stats: %v", err)
+	}
+	defer f.Close()
+	var rows []ThreadStats
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var st ThreadStats
+		if err := json.Unmarshal(sc.Bytes(), &st); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		rows = append(rows, st)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("rows=%d, want 2", len(rows))
+	}
+
+	c1 := rows[0]
+	if c1.ConversationID != "c1" || c1.File != "c1.json" || c1.Title != "A" {
+		t.Fatalf("c1=%+v", c1)
+	}
+	if c1.Messages != 3 || c1.Turns != 2 || c1.Roles["user"] != 2 || c1.Roles["assistant"] != 1 {
+		t.Fatalf("counts: messages=%d turns=%d roles=%v", c1.Messages, c1.Turns, c1.Roles)
+	}
+	if *c1.FirstMessageTime != 3 || *c1.LastMessageTime != 8 || *c1.UpdateTime != 9 {
+		t.Fatalf("times: first=%v last=%v update=%v", *c1.FirstMessageTime, *c1.LastMessageTime, *c1.UpdateTime)
+	}
+	if c1.TextBytes != int64(len("hi")+len("hello")+len("bye")) || c1.RawBytes == 0 {
+		t.Fatalf("bytes: text=%d raw=%d", c1.TextBytes, c1.RawBytes)
+	}
+	if c1.FileBytes+rows[1].FileBytes != res.BytesWritten {
+		t.Fatalf("file bytes %d+%d != %d", c1.FileBytes, rows[1].FileBytes, res.BytesWritten)
+	}
+	if rows[1].Messages != 0 || rows[1].Roles != nil {
+		t.Fatalf("c2=%+v", rows[1])
+	}
+}
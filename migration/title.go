@@ -0,0 +1,87 @@
+package migration
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxTitleRunes caps normalized thread titles.
+const MaxTitleRunes = 80
+
+// placeholderTitles are export titles that say nothing about the thread.
+var placeholderTitles = map[string]struct{}{
+	"new chat":         {},
+	"new conversation": {},
+	"untitled":         {},
+	"untitled chat":    {},
+	"chat":             {},
+	"conversation":     {},
+}
+
+// NormalizeTitle cleans a model- or export-provided title: whitespace is collapsed, wrapping quotes and
+// markdown markers are stripped, a trailing period is dropped, and the result is capped at MaxTitleRunes
+// on a word boundary.
+func NormalizeTitle(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	s = strings.TrimLeft(s, "#*_ ")
+	s = strings.TrimRight(s, "*_ ")
+	for len(s) >= 2 {
+		first, _ := utf8.DecodeRuneInString(s)
+		last, _ := utf8.DecodeLastRuneInString(s)
+		if !isQuotePair(first, last) {
+			break
+		}
+		s = strings.TrimSpace(s[utf8.RuneLen(first) : len(s)-utf8.RuneLen(last)])
+	}
+	if strings.HasSuffix(s, ".") && !strings.HasSuffix(s, "..") {
+		s = strings.TrimSuffix(s, ".")
+	}
+	if utf8.RuneCountInString(s) > MaxTitleRunes {
+		r := []rune(s)[:MaxTitleRunes]
+		cut := string(r)
+		if i := strings.LastIndexByte(cut, ' '); i > MaxTitleRunes/2 {
+			cut = cut[:i]
+		}
+		s = strings.TrimRight(cut, " ,;:-") + "…"
+	}
+	return s
+}
+
+func isQuotePair(first, last rune) bool {
+	switch first {
+	case '"':
+		return last == '"'
+	case '\'':
+		return last == '\''
+	case '“':
+		return last == '”'
+	case '`':
+		return last == '`'
+	}
+	return false
+}
+
+// IsPlaceholderTitle reports whether title is empty, a generic export title like "New chat", or
+// visibly truncated.
+func IsPlaceholderTitle(title string) bool {
+	t := strings.ToLower(NormalizeTitle(title))
+	if t == "" {
+		return true
+	}
+	if _, ok := placeholderTitles[t]; ok {
+		return true
+	}
+	return strings.HasSuffix(t, "...") || strings.HasSuffix(t, "…")
+}
+
+// ThreadTitle picks the title used for a thread in rollups, indexes, and shards: the normalized generated
+// title, or the normalized export title when the model produced nothing usable.
+func ThreadTitle(generated, original string) string {
+	if t := NormalizeTitle(generated); t != "" && !IsPlaceholderTitle(t) {
+		return t
+	}
+	if t := NormalizeTitle(original); !IsPlaceholderTitle(t) {
+		return t
+	}
+	return NormalizeTitle(generated)
+}
@@ -0,0 +1,59 @@
+package migration
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"  Planning   the\ttrip  ": "Planning the trip",
+		`"Quoted Title"`:           "Quoted Title",
+		"“Curly quotes”":           "Curly quotes",
+		"## **Markdown title**":    "Markdown title",
+		"Ends with a period.":      "Ends with a period",
+		"Keeps ellipsis...":        "Keeps ellipsis...",
+		"":                         "",
+	}
+	for in, want := range cases {
+		if got := NormalizeTitle(in); got != want {
+			t.Fatalf("NormalizeTitle(%q)=%q want %q", in, got, want)
+		}
+	}
+
+	long := NormalizeTitle(strings.Repeat("word ", 40))
+	if utf8.RuneCountInString(long) > MaxTitleRunes+1 || !strings.HasSuffix(long, "…") {
+		t.Fatalf("long=%q", long)
+	}
+}
+
+func TestThreadTitle_PrefersGeneratedOverPlaceholders(t *testing.T) {
+	t.Parallel()
+
+	for _, p := range []string{"New chat", "  untitled ", "Help me with the…", ""} {
+		if !IsPlaceholderTitle(p) {
+			t.Fatalf("IsPlaceholderTitle(%q)=false", p)
+		}
+	}
+	if IsPlaceholderTitle("Sourdough starter troubleshooting") {
+		t.Fatalf("descriptive title flagged as placeholder")
+	}
+
+	if got := ThreadTitle(" Sourdough starter fixes. ", "New chat"); got != "Sourdough starter fixes" {
+		t.Fatalf("generated: %q", got)
+	}
+	if got := ThreadTitle("", "Tax questions 2024"); got != "Tax questions 2024" {
+		t.Fatalf("fallback to original: %q", got)
+	}
+	if got := ThreadTitle("", "New chat"); got != "" {
+		t.Fatalf("placeholder original: %q", got)
+	}
+
+	probs := ThreadSummaryProblems(ThreadSummary{Title: "New chat", Summary: "Fine.", KeyPoints: []string{"k"}})
+	if len(probs) != 1 || probs[0] != "placeholder title" {
+		t.Fatalf("problems=%v", probs)
+	}
+}
@@ -0,0 +1,184 @@
+package migration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TurnSentimentSuffix ends the per-turn sentiment artifact chunk-summarizer -turn-sentiment writes
+// next to a chunk's sentiment summary.
+const TurnSentimentSuffix = ".turns.sentiment.json"
+
+// DateLayout is the date format of -turn-sentiment ranges.
+const DateLayout = "2006-01-02"
+
+// DateRange is an inclusive range of UTC days; a zero bound is open.
+type DateRange struct {
+	From, To time.Time
+}
+
+// DateRanges is a -turn-sentiment spec: "2024-01-01..2024-03-31,2024-06-01..", each range inclusive
+// and either end optional. A single date selects that day.
+type DateRanges []DateRange
+
+// ParseDateRanges parses a comma-separated list of date ranges. Empty returns nil.
+func ParseDateRanges(spec string) (DateRanges, error) {
+	var out DateRanges
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "..")
+		if !isRange {
+			to = from
+		}
+		var r DateRange
+		var err error
+		if s := strings.TrimSpace(from); s != "" {
+			if r.From, err = time.Parse(DateLayout, s); err != nil {
+				return nil, fmt.Errorf("invalid date range %q: %w", part, err)
+			}
+		}
+		if s := strings.TrimSpace(to); s != "" {
+			if r.To, err = time.Parse(DateLayout, s); err != nil {
+				return nil, fmt.Errorf("invalid date range %q: %w", part, err)
+			}
+		}
+		if r.From.IsZero() && r.To.IsZero() {
+			return nil, fmt.Errorf("invalid date range %q: want YYYY-MM-DD..YYYY-MM-DD", part)
+		}
+		if !r.From.IsZero() && !r.To.IsZero() && r.To.Before(r.From) {
+			return nil, fmt.Errorf("invalid date range %q: ends before it starts", part)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// Contains reports whether unix time sec falls on a day in any range.
+func (rs DateRanges) Contains(sec float64) bool {
+	if sec <= 0 {
+		return false
+	}
+	t := time.Unix(int64(sec), 0).UTC()
+	for _, r := range rs {
+		if !r.From.IsZero() && t.Before(r.From) {
+			continue
+		}
+		if !r.To.IsZero() && !t.Before(r.To.AddDate(0, 0, 1)) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// MatchChunk reports whether any of chunk's messages was written in a range. Chunks whose messages
+// carry no times match on the thread start time.
+func (rs DateRanges) MatchChunk(chunk Chunk) bool {
+	timed := false
+	for _, m := range chunk.Messages {
+		if m.CreateTime == nil || *m.CreateTime <= 0 {
+			continue
+		}
+		timed = true
+		if rs.Contains(*m.CreateTime) {
+			return true
+		}
+	}
+	return !timed && chunk.ThreadStart != nil && rs.Contains(*chunk.ThreadStart)
+}
+
+// TurnSentiment is one turn's affect from the lightweight per-turn classification.
+type TurnSentiment struct {
+	Turn int `json:"turn"`
+	// Affect is the turn's single dominant emotion label.
+	Affect string `json:"affect"`
+	// Valence runs from -1 (negative) to 1 (positive); Intensity from 0 (flat) to 1 (intense).
+	Valence   float64 `json:"valence"`
+	Intensity float64 `json:"intensity"`
+}
+
+// ChunkTurnSentiment is the *.turns.sentiment.json artifact for one chunk.
+type ChunkTurnSentiment struct {
+	ConversationID string          `json:"conversation_id"`
+	ChunkNumber    int             `json:"chunk_number"`
+	TurnStart      int             `json:"turn_start"`
+	TurnEnd        int             `json:"turn_end"`
+	Turns          []TurnSentiment `json:"turns"`
+	Model          string          `json:"model,omitempty"`
+}
+
+// Normalize keeps one entry per turn within [TurnStart, TurnEnd), in turn order, with trimmed
+// lowercase affect labels and valence and intensity clamped to their ranges.
+func (c *ChunkTurnSentiment) Normalize() {
+	seen := make(map[int]bool, len(c.Turns))
+	turns := c.Turns[:0]
+	for _, t := range c.Turns {
+		if t.Turn < c.TurnStart || t.Turn >= c.TurnEnd || seen[t.Turn] {
+			continue
+		}
+		seen[t.Turn] = true
+		t.Affect = strings.ToLower(strings.TrimSpace(t.Affect))
+		t.Valence = min(max(t.Valence, -1), 1)
+		t.Intensity = min(max(t.Intensity, 0), 1)
+		turns = append(turns, t)
+	}
+	sort.Slice(turns, func(i, j int) bool { return turns[i].Turn < turns[j].Turn })
+	c.Turns = turns
+}
+
+// TurnSentimentAggregate is the summary of a chunk's turn-level sentiment carried in its sentiment
+// artifact, pointing at the full per-turn file.
+type TurnSentimentAggregate struct {
+	Path          string  `json:"path"`
+	Turns         int     `json:"turns"`
+	MeanValence   float64 `json:"mean_valence"`
+	MeanIntensity float64 `json:"mean_intensity"`
+	// LowTurn and HighTurn are the turns with the lowest and highest valence.
+	LowTurn  int `json:"low_turn"`
+	HighTurn int `json:"high_turn"`
+	// PeakTurn is the most intense turn.
+	PeakTurn int `json:"peak_turn"`
+	// Affects are the turn labels, most frequent first.
+	Affects []string `json:"affects,omitempty"`
+}
+
+// AggregateTurnSentiment summarizes c's turns; it returns nil when there are none. path is recorded
+// as the aggregate's Path.
+func AggregateTurnSentiment(c ChunkTurnSentiment, path string) *TurnSentimentAggregate {
+	if len(c.Turns) == 0 {
+		return nil
+	}
+	agg := &TurnSentimentAggregate{Path: path, Turns: len(c.Turns)}
+	low, high, peak := c.Turns[0], c.Turns[0], c.Turns[0]
+	counts := make(map[string]int)
+	for _, t := range c.Turns {
+		agg.MeanValence += t.Valence
+		agg.MeanIntensity += t.Intensity
+		if t.Valence < low.Valence {
+			low = t
+		}
+		if t.Valence > high.Valence {
+			high = t
+		}
+		if t.Intensity > peak.Intensity {
+			peak = t
+		}
+		if t.Affect != "" {
+			if counts[t.Affect] == 0 {
+				agg.Affects = append(agg.Affects, t.Affect)
+			}
+			counts[t.Affect]++
+		}
+	}
+	agg.MeanValence /= float64(len(c.Turns))
+	agg.MeanIntensity /= float64(len(c.Turns))
+	agg.LowTurn, agg.HighTurn, agg.PeakTurn = low.Turn, high.Turn, peak.Turn
+	// Stable, so ties keep the order labels first appeared in.
+	sort.SliceStable(agg.Affects, func(i, j int) bool { return counts[agg.Affects[i]] > counts[agg.Affects[j]] })
+	return agg
+}
@@ -0,0 +1,75 @@
+package migration
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDateRanges_MatchChunk(t *testing.T) {
+	t.Parallel()
+
+	for _, bad := range []string{"2024-13-01", "..", "2024-03-01..2024-02-01"} {
+		if _, err := ParseDateRanges(bad); err == nil {
+			t.Fatalf("ParseDateRanges(%q): expected error", bad)
+		}
+	}
+	rs, err := ParseDateRanges("2024-01-01..2024-01-31, 2024-06-01..")
+	if err != nil {
+		t.Fatalf("ParseDateRanges: %v", err)
+	}
+	day := func(s string, hour int) float64 {
+		d, _ := time.Parse(DateLayout, s)
+		return float64(d.Add(time.Duration(hour) * time.Hour).Unix())
+	}
+	for sec, want := range map[float64]bool{
+		day("2024-01-31", 23): true,
+		day("2024-02-01", 0):  false,
+		day("2025-03-05", 12): true,
+		day("2023-12-31", 23): false,
+	} {
+		if got := rs.Contains(sec); got != want {
+			t.Fatalf("Contains(%v)=%v want %v", time.Unix(int64(sec), 0).UTC(), got, want)
+		}
+	}
+
+	out, in := day("2024-03-01", 0), day("2024-01-15", 0)
+	if rs.MatchChunk(Chunk{Messages: []SimplifiedMessage{{CreateTime: &out}}}) {
+		t.Fatal("chunk outside the ranges matched")
+	}
+	if !rs.MatchChunk(Chunk{Messages: []SimplifiedMessage{{CreateTime: &out}, {CreateTime: &in}}}) {
+		t.Fatal("chunk with a message in range did not match")
+	}
+	if !rs.MatchChunk(Chunk{ThreadStart: &in, Messages: []SimplifiedMessage{{Text: "untimed"}}}) {
+		t.Fatal("untimed chunk did not fall back to the thread start")
+	}
+}
+
+func TestAggregateTurnSentiment(t *testing.T) {
+	t.Parallel()
+
+	ts := ChunkTurnSentiment{TurnStart: 10, TurnEnd: 14, Turns: []TurnSentiment{
+		{Turn: 12, Affect: " Relief ", Valence: 0.8, Intensity: 0.4},
+		{Turn: 10, Affect: "worry", Valence: -0.6, Intensity: 1.7},
+		{Turn: 11, Affect: "worry", Valence: -0.2, Intensity: 0.5},
+		{Turn: 11, Affect: "joy", Valence: 1},
+		{Turn: 20, Affect: "joy", Valence: 1},
+	}}
+	ts.Normalize()
+	if len(ts.Turns) != 3 || ts.Turns[0].Turn != 10 || ts.Turns[0].Intensity != 1 || ts.Turns[2].Affect != "relief" {
+		t.Fatalf("Normalize: %+v", ts.Turns)
+	}
+
+	agg := AggregateTurnSentiment(ts, "c1/chunk_0001"+TurnSentimentSuffix)
+	if agg.Turns != 3 || agg.LowTurn != 10 || agg.HighTurn != 12 || agg.PeakTurn != 10 {
+		t.Fatalf("aggregate=%+v", agg)
+	}
+	if len(agg.Affects) != 2 || agg.Affects[0] != "worry" {
+		t.Fatalf("Affects=%v", agg.Affects)
+	}
+	if agg.MeanValence > 0 || agg.MeanValence < -0.01 {
+		t.Fatalf("MeanValence=%v", agg.MeanValence)
+	}
+	if AggregateTurnSentiment(ChunkTurnSentiment{}, "") != nil {
+		t.Fatal("expected nil aggregate without turns")
+	}
+}